@@ -11,6 +11,10 @@
 //
 //	tokmesh-server [flags]
 //	tokmesh-server --config /path/to/config.yaml
+//	tokmesh-server --config /path/to/config.yaml --inspect
+//
+// With --inspect the server verifies its data directory offline and exits
+// instead of starting.
 //
 // The server loads configuration, initializes infrastructure components,
 // and starts all configured listeners.
@@ -11,21 +11,30 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
 	"github.com/yndnr/tokmesh-go/internal/core/service"
 	"github.com/yndnr/tokmesh-go/internal/infra/confloader"
 	"github.com/yndnr/tokmesh-go/internal/infra/shutdown"
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
 	"github.com/yndnr/tokmesh-go/internal/server/clusterserver"
 	"github.com/yndnr/tokmesh-go/internal/server/config"
 	"github.com/yndnr/tokmesh-go/internal/server/httpserver"
 	"github.com/yndnr/tokmesh-go/internal/server/httpserver/handler"
+	"github.com/yndnr/tokmesh-go/internal/server/localserver"
 	"github.com/yndnr/tokmesh-go/internal/server/redisserver"
 	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/archive"
+	"github.com/yndnr/tokmesh-go/internal/storage/inspect"
 	"github.com/yndnr/tokmesh-go/internal/storage/memory"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
 	"github.com/yndnr/tokmesh-go/internal/telemetry/logger"
 )
 
@@ -48,6 +57,7 @@ func run() error {
 	var (
 		configFile  = flag.String("config", "", "Path to configuration file")
 		showVersion = flag.Bool("version", false, "Show version information")
+		inspectData = flag.Bool("inspect", false, "Verify the data directory offline and exit")
 	)
 	flag.Parse()
 
@@ -63,6 +73,11 @@ func run() error {
 		return fmt.Errorf("load config: %w", err)
 	}
 
+	// Inspect the data directory without starting the server
+	if *inspectData {
+		return runInspect(os.Stdout, cfg.Storage.DataDir)
+	}
+
 	// Initialize logger
 	log, slogLogger, err := initLogger(cfg)
 	if err != nil {
@@ -94,18 +109,51 @@ func run() error {
 
 	// Create HTTP handler
 	httpHandler := handler.New(services.Session, services.Token, services.Auth, slogLogger)
+	httpHandler.SetPointInTimeRecoverer(storageEngine)
+	httpHandler.SetWALInspector(storageEngine)
+	httpHandler.SetSnapshotScheduler(storageEngine)
+
+	// Create HTTP server, serving the handler behind the router's
+	// authentication, durability and audit middleware
+	routerCfg, err := config.ToRouterConfig(cfg, slogLogger)
+	if err != nil {
+		return fmt.Errorf("create http router config: %w", err)
+	}
+	routerCfg.SessionService = services.Session
+	routerCfg.TokenService = services.Token
+	routerCfg.AuthService = services.Auth
+	routerCfg.Handler = httpHandler
+	httpServer := httpserver.New(cfg.Server.HTTP.Addr, httpserver.NewRouter(routerCfg))
+	httpTLSConfig, httpCertWatcher, err := config.ToHTTPTLSConfig(cfg, slogLogger)
+	if err != nil {
+		return fmt.Errorf("create http tls config: %w", err)
+	}
 
-	// Create HTTP server
-	httpServer := httpserver.New(cfg.Server.HTTP.Addr, httpHandler)
+	// Metrics, including the expiry of every served certificate
+	metricsRegistry := prometheus.NewRegistry()
+	metricsRegistry.MustRegister(collectors.NewGoCollector())
+	metricsRegistry.MustRegister(storageEngine.Collectors()...)
+	metricsRegistry.MustRegister(httpHandler.Collectors()...)
+	httpHandler.SetMetricsGatherer(metricsRegistry)
+	if httpCertWatcher != nil {
+		metricsRegistry.MustRegister(tlsroots.ExpiryCollector("http", httpCertWatcher))
+		httpHandler.AddTLSCertificate("http", httpCertWatcher)
+	}
 
 	// Create Redis server if enabled
 	var redisServer *redisserver.Server
+	var redisCfg *redisserver.Config
+	var redisCertWatcher *tlsroots.Watcher
 	if cfg.Server.Redis.Enabled {
-		redisCfg := &redisserver.Config{
-			PlainEnabled: true,
-			PlainAddress: cfg.Server.Redis.Addr,
+		redisCfg, redisCertWatcher, err = config.ToRedisConfig(cfg, slogLogger)
+		if err != nil {
+			return fmt.Errorf("create redis config: %w", err)
 		}
 		redisServer = redisserver.New(redisCfg, services.Session, services.Token, services.Auth, slogLogger)
+		if redisCertWatcher != nil {
+			metricsRegistry.MustRegister(tlsroots.ExpiryCollector("redis", redisCertWatcher))
+			httpHandler.AddTLSCertificate("redis", redisCertWatcher)
+		}
 	}
 
 	// Create cluster server if cluster mode is enabled
@@ -125,6 +173,22 @@ func run() error {
 			return fmt.Errorf("create cluster server: %w", err)
 		}
 
+		// Replicated revoke-by-query entries revoke this node's sessions
+		// through the session service, which publishes the revocations
+		clusterServer.SetRevokeQueryHandler(func(q *service.RevokeQuery) {
+			revoked, err := services.Session.RevokeByQuery(context.Background(), q, nil)
+			if err != nil {
+				log.Error("replicated revoke query failed", "revoked", revoked, "error", err)
+				return
+			}
+			log.Info("replicated revoke query applied", "revoked", revoked)
+		})
+		// Sessions migrated away invalidate their keyspace and tracking
+		// listeners, as revocations do
+		clusterServer.SetSessionsRemovedHandler(services.Session.PublishDeleted)
+		httpHandler.SetRevokeReplicator(clusterServer)
+		metricsRegistry.MustRegister(clusterServer.Collector())
+
 		// Start cluster server
 		if err := clusterServer.Start(ctx); err != nil {
 			return fmt.Errorf("start cluster server: %w", err)
@@ -137,10 +201,27 @@ func run() error {
 			"gossip_port", cfg.Cluster.GossipPort)
 	}
 
+	// Create the local management socket server if configured
+	var localServer *localserver.Server
+	if cfg.Server.Local.Path != "" {
+		localHandler := localserver.NewHandler()
+		localHandler.SetStatus(httpHandler.StatusSummary)
+		localHandler.SetMetricsGatherer(metricsRegistry)
+		localServer = localserver.New(cfg.Server.Local.Path, localHandler)
+	}
+
 	// Setup graceful shutdown
 	shutdownHandler := shutdown.NewHandler(30 * time.Second)
 
-	// Register shutdown hooks (reverse order of startup)
+	// Register shutdown hooks (reverse order of startup). Hooks run last
+	// registered first, so the storage engine, whose Close may take a
+	// shutdown snapshot, closes after every server has stopped accepting
+	// writes.
+	shutdownHandler.OnShutdown(func(ctx context.Context) error {
+		log.Info("shutting down storage engine")
+		return storageEngine.Close()
+	})
+
 	if clusterServer != nil {
 		shutdownHandler.OnShutdown(func(ctx context.Context) error {
 			log.Info("shutting down cluster server")
@@ -155,22 +236,67 @@ func run() error {
 		})
 	}
 
+	if redisCertWatcher != nil {
+		shutdownHandler.OnShutdown(func(ctx context.Context) error {
+			redisCertWatcher.Stop()
+			return nil
+		})
+	}
+
+	if httpCertWatcher != nil {
+		shutdownHandler.OnShutdown(func(ctx context.Context) error {
+			httpCertWatcher.Stop()
+			return nil
+		})
+	}
+
+	if localServer != nil {
+		shutdownHandler.OnShutdown(func(ctx context.Context) error {
+			log.Info("shutting down local socket server")
+			return localServer.Shutdown(ctx)
+		})
+	}
+
 	shutdownHandler.OnShutdown(func(ctx context.Context) error {
 		log.Info("shutting down HTTP server")
 		return httpServer.Shutdown(ctx)
 	})
 
+	// Remove expired sessions periodically; removals are published as
+	// expiration events (keyspace notifications, tracking invalidations).
+	gcCtx, stopGC := context.WithCancel(ctx)
+	go runGC(gcCtx, services.Session, cfg.Storage.GCInterval, log)
 	shutdownHandler.OnShutdown(func(ctx context.Context) error {
-		log.Info("shutting down storage engine")
-		return storageEngine.Close()
+		stopGC()
+		return nil
 	})
 
 	// Start Redis server if enabled
 	if redisServer != nil {
+		if redisCertWatcher != nil {
+			redisCertWatcher.StartAsync()
+		}
 		if err := redisServer.Start(ctx); err != nil {
 			return fmt.Errorf("start redis server: %w", err)
 		}
-		log.Info("Redis server listening", "addr", cfg.Server.Redis.Addr)
+		if redisCfg.PlainEnabled {
+			log.Info("Redis server listening", "addr", redisCfg.PlainAddress)
+		}
+		if redisCfg.TLSEnabled {
+			log.Info("Redis server listening with TLS", "addr", redisCfg.TLSAddress,
+				"client_cert_keys", len(redisCfg.CertAPIKeys))
+		}
+	}
+
+	// Start local socket server in goroutine; it is optional, so a failure
+	// (e.g. a missing socket directory) is only logged.
+	if localServer != nil {
+		go func() {
+			log.Info("local socket server listening", "path", cfg.Server.Local.Path)
+			if err := localServer.ListenAndServe(); err != nil {
+				log.Warn("local socket server error", "path", cfg.Server.Local.Path, "error", err)
+			}
+		}()
 	}
 
 	// Start HTTP server in goroutine
@@ -178,8 +304,10 @@ func run() error {
 		log.Info("HTTP server listening", "addr", cfg.Server.HTTP.Addr)
 
 		var err error
-		if cfg.Server.HTTP.TLSCertFile != "" && cfg.Server.HTTP.TLSKeyFile != "" {
-			err = httpServer.ListenAndServeTLS(cfg.Server.HTTP.TLSCertFile, cfg.Server.HTTP.TLSKeyFile)
+		if httpTLSConfig != nil {
+			// Rotated certificates are served without a restart
+			httpCertWatcher.StartAsync()
+			err = httpServer.ListenAndServeTLSConfig(httpTLSConfig)
 		} else {
 			err = httpServer.ListenAndServe()
 		}
@@ -200,6 +328,67 @@ func run() error {
 	return nil
 }
 
+// runGC removes expired sessions every interval until ctx is done.
+func runGC(ctx context.Context, sessions *service.SessionService, interval time.Duration, log logger.Logger) {
+	if interval <= 0 {
+		interval = config.DefaultGCInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := sessions.GC(ctx)
+			if err != nil {
+				log.Error("session gc failed", "error", err)
+				continue
+			}
+			if count > 0 {
+				log.Debug("expired sessions removed", "count", count)
+			}
+		}
+	}
+}
+
+// runInspect verifies the data directory offline, as 'tokmesh-cli data
+// verify' does, and fails if recovery would not rebuild every session.
+func runInspect(w io.Writer, dataDir string) error {
+	report, err := inspect.Inspect(inspect.Options{DataDir: dataDir})
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range report.Segments {
+		state := "open"
+		switch {
+		case seg.Problem != "":
+			state = "damaged"
+		case seg.Sealed:
+			state = "sealed"
+		}
+		fmt.Fprintf(w, "wal segment %d: %d entries, %d bytes, %s\n", seg.ID, seg.Entries, seg.Size, state)
+	}
+	for _, s := range report.Snapshots {
+		if s.Problem != "" {
+			fmt.Fprintf(w, "snapshot %s: %s\n", s.ID, s.Problem)
+			continue
+		}
+		fmt.Fprintf(w, "snapshot %s: %d sessions, wal offset %s\n", s.ID, s.SessionCount, inspect.FormatOffset(s.WALLastOffset))
+	}
+
+	if !report.OK() {
+		for _, p := range report.Problems {
+			fmt.Fprintf(w, "problem: %s\n", p)
+		}
+		return fmt.Errorf("data directory %s has %d problem(s) (see 'tokmesh-cli data repair')", dataDir, len(report.Problems))
+	}
+	fmt.Fprintf(w, "data directory %s is OK\n", dataDir)
+	return nil
+}
+
 // loadConfig loads configuration from file and environment.
 func loadConfig(configFile string) (*config.ServerConfig, error) {
 	// Start with defaults
@@ -254,6 +443,11 @@ func initStorage(cfg *config.ServerConfig, log *slog.Logger) (*storage.Engine, e
 	storageCfg.Logger = log
 	storageCfg.NodeID = cfg.Cluster.NodeID
 
+	// Configure WAL sync mode if specified
+	if cfg.Storage.WALSyncMode != "" {
+		storageCfg.WAL.SyncMode = wal.SyncMode(cfg.Storage.WALSyncMode)
+	}
+
 	// Configure WAL sync interval if specified
 	if cfg.Storage.WALSyncInterval > 0 {
 		storageCfg.WAL.SyncInterval = cfg.Storage.WALSyncInterval
@@ -264,9 +458,68 @@ func initStorage(cfg *config.ServerConfig, log *slog.Logger) (*storage.Engine, e
 		storageCfg.Snapshot.RetentionCount = cfg.Storage.SnapshotKeep
 	}
 
+	// Take snapshots as the WAL grows and ages, and on shutdown
+	snap := cfg.Storage.Snapshot
+	storageCfg.SnapshotInterval = snap.Interval
+	storageCfg.SnapshotPolicy = storage.SnapshotPolicy{
+		MaxWALBytes:   snap.WALBytes,
+		MaxWALEntries: snap.WALEntries,
+		CheckInterval: snap.CheckInterval,
+		HighWriteRate: snap.HighWriteRate,
+		MaxDefer:      snap.MaxDefer,
+		OnShutdown:    snap.OnShutdown,
+	}
+	if snap.RetentionDays > 0 {
+		storageCfg.Snapshot.RetentionDays = snap.RetentionDays
+	}
+
+	storageCfg.TouchCoalesceInterval = cfg.Storage.TouchCoalesceInterval
+	storageCfg.WALArchiveDir = cfg.Storage.WALArchiveDir
+
+	// Select the persistence backend
+	if cfg.Storage.Backend != "" {
+		storageCfg.Backend = cfg.Storage.Backend
+	}
+	storageCfg.CacheSize = cfg.Storage.CacheSessions
+
+	// Ship WAL segments and snapshots to the archive
+	if cfg.Storage.Archive.Target != "" {
+		target, err := newArchiveTarget(&cfg.Storage.Archive)
+		if err != nil {
+			return nil, err
+		}
+		storageCfg.Archive = &archive.Config{
+			Target:       target,
+			ScanInterval: cfg.Storage.Archive.ScanInterval,
+			MaxRetries:   cfg.Storage.Archive.MaxRetries,
+			RetryBackoff: cfg.Storage.Archive.RetryBackoff,
+			Retention: archive.Retention{
+				MaxAge:       time.Duration(cfg.Storage.Archive.RetentionDays) * 24 * time.Hour,
+				MinSnapshots: cfg.Storage.Archive.RetentionMinSnapshots,
+			},
+		}
+		log.Info("archive shipping enabled", "target", target.String())
+	}
+
 	return storage.New(storageCfg)
 }
 
+// newArchiveTarget returns the archive target configured by
+// storage.archive.
+func newArchiveTarget(cfg *config.ArchiveConfig) (archive.Target, error) {
+	if cfg.Target == "s3" {
+		return archive.NewS3Target(archive.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			Prefix:          cfg.S3Prefix,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+		})
+	}
+	return archive.NewDirTarget(cfg.Dir)
+}
+
 // Services holds all initialized services.
 type Services struct {
 	Session *service.SessionService
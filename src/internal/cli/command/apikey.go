@@ -57,6 +57,10 @@ func APIKeyCommand() *cli.Command {
 						Value: 1000,
 						Usage: "Rate limit (QPS)",
 					},
+					&cli.StringFlag{
+						Name:  "durability",
+						Usage: "Default write durability (none, buffered, fsync); the server's by default",
+					},
 				},
 				Action: apikeyCreate,
 			},
@@ -196,6 +200,9 @@ func apikeyCreate(c *cli.Context) error {
 	if desc := c.String("description"); desc != "" {
 		body["description"] = desc
 	}
+	if d := c.String("durability"); d != "" {
+		body["durability"] = d
+	}
 
 	resp, err := client.Post(ctx, "/admin/v1/keys", body)
 	if err != nil {
@@ -2,10 +2,21 @@
 package command
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
 	"github.com/yndnr/tokmesh-go/internal/cli/connection"
 )
 
@@ -13,46 +24,217 @@ import (
 func ConnectCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "connect",
-		Usage:     "Connect to a TokMesh server",
-		ArgsUsage: "[SERVER]",
+		Usage:     "Connect to a TokMesh server or connection profile",
+		ArgsUsage: "[PROFILE|SERVER]",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "name",
 				Aliases: []string{"n"},
 				Usage:   "Connection name (for saved connections)",
 			},
+			&cli.BoolFlag{
+				Name:  "test",
+				Usage: "Check reachability, TLS and authentication, then exit",
+			},
 		},
 		Action: connectAction,
 	}
 }
 
 func connectAction(c *cli.Context) error {
-	flags := ParseGlobalFlags(c)
-	server := c.Args().First()
-	if server == "" {
-		server = flags.Server
+	conn, err := connectTarget(c)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("test") {
+		return testConnection(c.Context, os.Stdout, conn)
 	}
 
 	mgr := GetConnectionManager(c)
 	if mgr == nil {
 		return fmt.Errorf("connection manager not initialized")
 	}
+	if name := c.String("name"); name != "" {
+		conn.Name = name
+	}
+
+	if err := mgr.Connect(conn); err != nil {
+		return fmt.Errorf("connect failed: %w", err)
+	}
+
+	fmt.Printf("Connected to %s\n", connectionTarget(conn))
+	return nil
+}
 
-	conn := &connection.Connection{
-		Name:     c.String("name"),
-		Server:   server,
+// connectTarget returns the connection named by the argument, a profile
+// name or a server address, or without one the connection selected by
+// the global flags.
+func connectTarget(c *cli.Context) (*connection.Connection, error) {
+	arg := c.Args().First()
+	if arg == "" {
+		return ResolveConnection(c)
+	}
+
+	flags := ParseGlobalFlags(c)
+	cfg, err := config.Load(flags.Config)
+	if err != nil {
+		return nil, err
+	}
+	if cc, ok := cfg.Connections[arg]; ok {
+		return connection.FromProfile(c.Context, arg, cc)
+	}
+	return &connection.Connection{
+		Server:   arg,
 		APIKeyID: flags.APIKeyID,
 		APIKey:   flags.APIKey,
+	}, nil
+}
+
+// connectionTarget describes where conn points to.
+func connectionTarget(conn *connection.Connection) string {
+	if conn.Socket != "" {
+		return "unix://" + conn.Socket
 	}
+	return conn.Server
+}
 
-	if err := mgr.Connect(conn); err != nil {
-		return fmt.Errorf("connect failed: %w", err)
+// connectTestTimeout bounds each request of connect --test.
+const connectTestTimeout = 5 * time.Second
+
+// testConnection checks that conn's server is reachable, reports its TLS
+// session and verifies the API key, writing one line per check. It
+// fails if any check fails.
+func testConnection(ctx context.Context, w io.Writer, conn *connection.Connection) error {
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	if conn.Name != "" {
+		fmt.Fprintf(w, "Testing profile %q (%s)\n", conn.Name, connectionTarget(conn))
+	} else {
+		fmt.Fprintf(w, "Testing %s\n", connectionTarget(conn))
+	}
+	report := func(check, result, detail string) {
+		fmt.Fprintf(w, "  %-10s %-5s %s\n", check, result, detail)
+	}
+
+	if conn.Socket != "" {
+		data, err := connection.NewSocketClient(conn.Socket).Query("status", connectTestTimeout)
+		if err != nil {
+			report("socket", "FAIL", err.Error())
+			return fmt.Errorf("connection test failed")
+		}
+		var status struct {
+			Status  string `json:"status"`
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(data, &status); err != nil {
+			report("socket", "FAIL", "unexpected response: "+strings.TrimSpace(string(data)))
+			return fmt.Errorf("connection test failed")
+		}
+		report("socket", "OK", fmt.Sprintf("server %s, version %s", status.Status, status.Version))
+		return nil
+	}
+
+	client, err := conn.HTTPClient()
+	if err != nil {
+		report("tls", "FAIL", err.Error())
+		return fmt.Errorf("connection test failed")
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, connectTestTimeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := client.Get(reqCtx, "/health")
+	if err != nil {
+		if msg, ok := tlsFailure(err); ok {
+			report("reachable", "OK", client.BaseURL())
+			report("tls", "FAIL", msg)
+		} else {
+			report("reachable", "FAIL", err.Error())
+		}
+		return fmt.Errorf("connection test failed")
+	}
+	elapsed := time.Since(start)
+	resp.Body.Close()
 
-	fmt.Printf("Connected to %s\n", server)
+	failed := false
+	if resp.StatusCode == http.StatusOK {
+		report("reachable", "OK", fmt.Sprintf("GET /health answered %d in %s", resp.StatusCode, elapsed.Round(time.Millisecond)))
+	} else {
+		report("reachable", "FAIL", fmt.Sprintf("GET /health answered %d", resp.StatusCode))
+		failed = true
+	}
+
+	if resp.TLS != nil {
+		report("tls", "OK", describeTLS(resp.TLS))
+	} else {
+		report("tls", "-", "plain HTTP")
+	}
+
+	if conn.APIKeyID == "" && conn.APIKey == "" {
+		report("auth", "SKIP", "no API key configured")
+	} else {
+		reqCtx, cancel := context.WithTimeout(ctx, connectTestTimeout)
+		defer cancel()
+		resp, err := client.Get(reqCtx, "/admin/v1/status/summary")
+		switch {
+		case err != nil:
+			report("auth", "FAIL", err.Error())
+			failed = true
+		case resp.StatusCode == http.StatusForbidden:
+			resp.Body.Close()
+			report("auth", "OK", fmt.Sprintf("API key %s authenticated (no admin permission)", conn.APIKeyID))
+		default:
+			if err := connection.ParseResponse(resp, nil); err != nil {
+				report("auth", "FAIL", err.Error())
+				failed = true
+			} else {
+				report("auth", "OK", fmt.Sprintf("API key %s authenticated", conn.APIKeyID))
+			}
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("connection test failed")
+	}
 	return nil
 }
 
+// describeTLS summarizes a TLS session: protocol version and the server
+// certificate's subject and expiry.
+func describeTLS(state *tls.ConnectionState) string {
+	desc := tls.VersionName(state.Version)
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		days := int(time.Until(cert.NotAfter).Hours() / 24)
+		desc += fmt.Sprintf(", certificate %q expires %s (%d days)",
+			cert.Subject.String(), cert.NotAfter.Format(time.DateOnly), days)
+	}
+	return desc
+}
+
+// tlsFailure reports whether err is a TLS handshake or certificate
+// verification failure, with a description.
+func tlsFailure(err error) (string, bool) {
+	var (
+		verifyErr   *tls.CertificateVerificationError
+		unknownErr  x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+		recordErr   tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &verifyErr):
+		return "certificate verification failed: " + verifyErr.Err.Error(), true
+	case errors.As(err, &unknownErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return "certificate verification failed: " + err.Error(), true
+	case errors.As(err, &recordErr):
+		return "server does not speak TLS (try http://)", true
+	}
+	return "", false
+}
+
 // DisconnectCommand returns the disconnect command.
 func DisconnectCommand() *cli.Command {
 	return &cli.Command{
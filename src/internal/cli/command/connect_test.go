@@ -1,8 +1,18 @@
 package command
 
 import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
 )
 
 func TestConnectCommand(t *testing.T) {
@@ -24,6 +34,9 @@ func TestConnectCommand(t *testing.T) {
 	if !flagNames["name"] {
 		t.Error("connect should have --name flag")
 	}
+	if !flagNames["test"] {
+		t.Error("connect should have --test flag")
+	}
 
 	if cmd.Action == nil {
 		t.Error("connect should have an action")
@@ -73,6 +86,147 @@ func TestConnectAction_WithDefaultServer(t *testing.T) {
 	}
 }
 
+func TestConnectAction_Profile(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	// A profile name argument selects the profile
+	ctx := makeTestContext(server, map[string]any{"config": writeProfiles(t)}, []string{"local"})
+	if err := connectAction(ctx); err != nil {
+		t.Fatalf("connectAction() error = %v", err)
+	}
+	conn := GetConnectionManager(ctx).Current()
+	if conn == nil || conn.Name != "local" || conn.Socket != "/run/tokmesh/tokmesh.sock" {
+		t.Errorf("connected to %+v, want profile local", conn)
+	}
+}
+
+func TestTestConnection_HTTP(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+	server.handle("/health", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, healthResponse{Status: "healthy"})
+	})
+	server.handle("/admin/v1/status/summary", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-API-Key-ID") {
+		case "tmak-admin":
+			jsonResponse(w, http.StatusOK, map[string]any{"status": "running"})
+		case "tmak-user":
+			errorResponse(w, http.StatusForbidden, "TM-AUTH-4030", "permission denied")
+		default:
+			errorResponse(w, http.StatusUnauthorized, "TM-AUTH-4010", "invalid API key")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		keyID   string
+		wantErr bool
+		want    []string
+	}{
+		{"admin key", "tmak-admin", false, []string{"reachable  OK", "tls        -", "auth       OK    API key tmak-admin authenticated"}},
+		{"non-admin key", "tmak-user", false, []string{"auth       OK", "no admin permission"}},
+		{"bad key", "tmak-bad", true, []string{"auth       FAIL", "invalid API key"}},
+		{"no key", "", false, []string{"auth       SKIP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &connection.Connection{Server: server.URL, APIKeyID: tt.keyID}
+			if tt.keyID != "" {
+				conn.APIKey = "tmas_secret"
+			}
+			var buf bytes.Buffer
+			err := testConnection(context.Background(), &buf, conn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("testConnection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTestConnection_Unreachable(t *testing.T) {
+	server := newMockServer()
+	server.Close()
+
+	var buf bytes.Buffer
+	err := testConnection(context.Background(), &buf, &connection.Connection{Server: server.URL})
+	if err == nil || !strings.Contains(buf.String(), "reachable  FAIL") {
+		t.Errorf("err = %v, output:\n%s", err, buf.String())
+	}
+}
+
+func TestTestConnection_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, healthResponse{Status: "healthy"})
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	// Trusted through the profile's CA file
+	var buf bytes.Buffer
+	conn := &connection.Connection{Name: "tls", Server: server.URL, TLS: true, CAFile: caFile}
+	if err := testConnection(context.Background(), &buf, conn); err != nil {
+		t.Fatalf("testConnection() error = %v\n%s", err, buf.String())
+	}
+	for _, want := range []string{`Testing profile "tls"`, "tls        OK    TLS 1.3", "expires"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	// Untrusted without it
+	buf.Reset()
+	conn = &connection.Connection{Server: server.URL, TLS: true}
+	err := testConnection(context.Background(), &buf, conn)
+	if err == nil || !strings.Contains(buf.String(), "certificate verification failed") {
+		t.Errorf("err = %v, output:\n%s", err, buf.String())
+	}
+}
+
+func TestTestConnection_Socket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "tokmesh.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 64)
+		conn.Read(buf)
+		conn.Write([]byte(`{"status":"running","version":"1.2.3"}` + "\n"))
+		conn.Close()
+	}()
+
+	var buf bytes.Buffer
+	if err := testConnection(context.Background(), &buf, &connection.Connection{Socket: socketPath}); err != nil {
+		t.Fatalf("testConnection() error = %v\n%s", err, buf.String())
+	}
+	if !strings.Contains(buf.String(), "socket     OK    server running, version 1.2.3") {
+		t.Errorf("output:\n%s", buf.String())
+	}
+
+	// Nobody listening any more
+	listener.Close()
+	buf.Reset()
+	if err := testConnection(context.Background(), &buf, &connection.Connection{Socket: socketPath}); err == nil {
+		t.Errorf("testConnection() succeeded without a server:\n%s", buf.String())
+	}
+}
+
 func TestDisconnectAction_NotConnected(t *testing.T) {
 	server := newMockServer()
 	defer server.Close()
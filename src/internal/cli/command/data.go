@@ -0,0 +1,540 @@
+// Package command provides CLI command definitions for tokmesh-cli.
+package command
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/archive"
+	"github.com/yndnr/tokmesh-go/internal/storage/inspect"
+)
+
+// defaultDataDir is tokmesh-server's default storage.data_dir.
+const defaultDataDir = "/var/lib/tokmesh-server/data"
+
+// DataCommand returns the data subcommand group, which inspects and
+// repairs a server data directory offline. The server must be stopped
+// before repairing.
+//
+// @design DS-0102
+func DataCommand() *cli.Command {
+	dataDirFlag := &cli.StringFlag{
+		Name:    "data-dir",
+		Aliases: []string{"d"},
+		Usage:   "Server data directory (storage.data_dir), holding data/wal and data/snapshots",
+		EnvVars: []string{"TOKMESH_DATA_DIR"},
+		Value:   defaultDataDir,
+	}
+
+	return &cli.Command{
+		Name:  "data",
+		Usage: "Offline data directory inspection and repair",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "inspect",
+				Usage:  "List WAL segments and snapshots with offsets, counts and checksums",
+				Flags:  []cli.Flag{dataDirFlag},
+				Action: dataInspect,
+			},
+			{
+				Name:   "verify",
+				Usage:  "Verify the WAL segments, snapshots and the chain between them",
+				Flags:  []cli.Flag{dataDirFlag},
+				Action: dataVerify,
+			},
+			{
+				Name:  "dump",
+				Usage: "Dump WAL entries, or the sessions of a snapshot, as JSON lines",
+				Flags: []cli.Flag{
+					dataDirFlag,
+					&cli.BoolFlag{
+						Name:  "mask-pii",
+						Usage: "Mask user IDs, IP addresses, user agents, device IDs and data values (token hashes are kept)",
+					},
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "Start at this WAL offset, SEGMENT[:OFFSET]",
+					},
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "Dump the sessions of this snapshot file instead of the WAL",
+					},
+				},
+				Action: dataDump,
+			},
+			{
+				Name:  "repair",
+				Usage: "Truncate a torn WAL tail and quarantine corrupt snapshots",
+				Flags: []cli.Flag{
+					dataDirFlag,
+					&cli.BoolFlag{
+						Name:    "force",
+						Aliases: []string{"f"},
+						Usage:   "Skip confirmation",
+					},
+				},
+				Action: dataRepair,
+			},
+			{
+				Name:  "pitr",
+				Usage: "Recover the sessions as they were at a time or WAL offset into a new data directory or snapshot",
+				Flags: append([]cli.Flag{
+					dataDirFlag,
+					&cli.StringFlag{
+						Name:  "archive-dir",
+						Usage: "WAL archive directory (storage.wal_archive_dir), for segments compacted out of the WAL",
+					},
+				}, pitrFlags()...),
+				Action: dataPITR,
+			},
+			{
+				Name:  "archive",
+				Usage: "List, verify and restore the WAL and snapshot archive (storage.archive)",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List the archived WAL segments and snapshots",
+						Flags:  archiveFlags(),
+						Action: dataArchiveList,
+					},
+					{
+						Name:   "verify",
+						Usage:  "Verify the archived files against the manifest checksums",
+						Flags:  archiveFlags(),
+						Action: dataArchiveVerify,
+					},
+					{
+						Name:   "restore",
+						Usage:  "Pull the archive into a data directory, for the server to recover or for data pitr",
+						Flags:  append(archiveFlags(), dataDirFlag),
+						Action: dataArchiveRestore,
+					},
+				},
+			},
+		},
+	}
+}
+
+// archiveFlags returns the flags selecting an archive target, as
+// storage.archive does.
+func archiveFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "dir",
+			Usage: "Archive directory (storage.archive.dir)",
+		},
+		&cli.StringFlag{
+			Name:  "s3-endpoint",
+			Usage: "S3-compatible endpoint URL (storage.archive.s3_endpoint)",
+		},
+		&cli.StringFlag{
+			Name:  "s3-region",
+			Usage: "S3 signing region",
+			Value: archive.DefaultS3Region,
+		},
+		&cli.StringFlag{
+			Name:  "s3-bucket",
+			Usage: "S3 bucket",
+		},
+		&cli.StringFlag{
+			Name:  "s3-prefix",
+			Usage: "S3 object name prefix",
+		},
+		&cli.StringFlag{
+			Name:    "s3-access-key-id",
+			Usage:   "S3 access key ID",
+			EnvVars: []string{"TOKMESH_ARCHIVE_S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "s3-secret-access-key",
+			Usage:   "S3 secret access key (prefer the environment variable)",
+			EnvVars: []string{"TOKMESH_ARCHIVE_S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"},
+		},
+	}
+}
+
+// archiveTarget returns the archive target selected by archiveFlags.
+func archiveTarget(c *cli.Context) (archive.Target, error) {
+	switch {
+	case c.String("dir") != "" && c.String("s3-endpoint") != "":
+		return nil, fmt.Errorf("--dir and --s3-endpoint are mutually exclusive")
+	case c.String("dir") != "":
+		if _, err := os.Stat(c.String("dir")); err != nil {
+			return nil, err
+		}
+		return archive.NewDirTarget(c.String("dir"))
+	case c.String("s3-endpoint") != "":
+		return archive.NewS3Target(archive.S3Config{
+			Endpoint:        c.String("s3-endpoint"),
+			Region:          c.String("s3-region"),
+			Bucket:          c.String("s3-bucket"),
+			Prefix:          c.String("s3-prefix"),
+			AccessKeyID:     c.String("s3-access-key-id"),
+			SecretAccessKey: c.String("s3-secret-access-key"),
+		})
+	default:
+		return nil, fmt.Errorf("--dir or --s3-endpoint is required")
+	}
+}
+
+func dataArchiveList(c *cli.Context) error {
+	target, err := archiveTarget(c)
+	if err != nil {
+		return err
+	}
+	m, err := archive.ReadManifest(context.Background(), target)
+	if err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) != output.FormatTable {
+		return output.NewFormatter(output.Format(flags.Output), flags.Wide).Format(c.App.Writer, m)
+	}
+
+	table := &output.Table{
+		Headers: []string{"NAME", "KIND", "WAL OFFSET", "CREATED", "SIZE", "ARCHIVED", "CHECKSUM"},
+	}
+	for _, f := range m.Files {
+		row := []string{f.Name, f.Kind, "-", "-", fmt.Sprintf("%d", f.Size),
+			f.ArchivedAt.UTC().Format(time.RFC3339), shortChecksum(f.SHA256, flags.Wide)}
+		if f.Kind == archive.KindSnapshot {
+			row[2] = inspect.FormatOffset(f.WALLastOffset)
+			row[3] = time.UnixMilli(f.CreatedAt).UTC().Format(time.RFC3339)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	fmt.Fprintf(c.App.Writer, "Archive: %s\n", target)
+	return table.Render(c.App.Writer)
+}
+
+func dataArchiveVerify(c *cli.Context) error {
+	target, err := archiveTarget(c)
+	if err != nil {
+		return err
+	}
+	problems, err := archive.Verify(context.Background(), target)
+	if err != nil {
+		return err
+	}
+
+	w := c.App.Writer
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "OK: every archived file matches the manifest")
+		return nil
+	}
+	fmt.Fprintf(w, "%d problem(s):\n", len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(w, "  - %s\n", p)
+	}
+	return fmt.Errorf("archive has %d problem(s)", len(problems))
+}
+
+func dataArchiveRestore(c *cli.Context) error {
+	target, err := archiveTarget(c)
+	if err != nil {
+		return err
+	}
+	cfg := storage.DefaultConfig(c.String("data-dir"))
+	res, err := archive.Restore(context.Background(), target, archive.RestoreOptions{
+		WALDir:      cfg.WAL.Dir,
+		SnapshotDir: cfg.Snapshot.Dir,
+	})
+	if err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) != output.FormatTable {
+		return output.NewFormatter(output.Format(flags.Output), flags.Wide).Format(c.App.Writer, res)
+	}
+	fmt.Fprintf(c.App.Writer, "Restored %d WAL segment(s) and %d snapshot(s), %d bytes, into %s (%d already present).\n",
+		res.Segments, res.Snapshots, res.Bytes, c.String("data-dir"), res.Skipped)
+	fmt.Fprintln(c.App.Writer, "Start tokmesh-server on it to recover, or run 'tokmesh-cli data pitr' on it.")
+	return nil
+}
+
+// pitrFlags returns the target and output flags of point-in-time recovery.
+func pitrFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "to-time",
+			Usage: "Recover up to this time, RFC 3339",
+		},
+		&cli.StringFlag{
+			Name:  "to-offset",
+			Usage: "Recover up to this WAL offset, SEGMENT[:OFFSET]",
+		},
+		&cli.StringFlag{
+			Name:  "output-data-dir",
+			Usage: "Write the result to this new data directory, to start a server on",
+		},
+		&cli.StringFlag{
+			Name:  "output-snapshot-dir",
+			Usage: "Write the result as a snapshot to this directory",
+		},
+	}
+}
+
+// parseRecoveryTarget parses the --to-time and --to-offset flags.
+func parseRecoveryTarget(c *cli.Context) (storage.RecoveryTarget, error) {
+	var target storage.RecoveryTarget
+	if s := c.String("to-time"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return target, fmt.Errorf("invalid --to-time %q, must be RFC 3339", s)
+		}
+		target.Time = t
+	}
+	if s := c.String("to-offset"); s != "" {
+		offset, err := inspect.ParseOffset(s)
+		if err != nil {
+			return target, err
+		}
+		target.Offset = offset
+	}
+	if target.IsZero() {
+		return target, fmt.Errorf("--to-time or --to-offset is required")
+	}
+	return target, nil
+}
+
+func dataPITR(c *cli.Context) error {
+	target, err := parseRecoveryTarget(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := storage.RecoverToPoint(context.Background(), storage.PointInTimeConfig{
+		DataDir:           c.String("data-dir"),
+		WALArchiveDir:     c.String("archive-dir"),
+		Target:            target,
+		OutputDataDir:     c.String("output-data-dir"),
+		OutputSnapshotDir: c.String("output-snapshot-dir"),
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) != output.FormatTable {
+		return output.NewFormatter(output.Format(flags.Output), flags.Wide).Format(c.App.Writer, res)
+	}
+
+	w := c.App.Writer
+	if res.BaseSnapshot != "" {
+		fmt.Fprintf(w, "Base snapshot:   %s (WAL %s)\n", res.BaseSnapshot, inspect.FormatOffset(res.BaseWALOffset))
+	} else {
+		fmt.Fprintln(w, "Base snapshot:   none")
+	}
+	fmt.Fprintf(w, "Entries applied: %d\n", res.EntriesApplied)
+	fmt.Fprintf(w, "Stopped at:      %s", inspect.FormatOffset(res.StopOffset))
+	if res.LastTimestamp > 0 {
+		fmt.Fprintf(w, " (%s)", time.UnixMilli(res.LastTimestamp).UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Sessions:        %d\n", res.SessionCount)
+	fmt.Fprintf(w, "Written to:      %s\n", res.Snapshot.Path)
+	if !res.TargetReached {
+		fmt.Fprintln(w, "Warning: the WAL ends before the target; the result is the latest recoverable state.")
+	}
+	return nil
+}
+
+func dataInspect(c *cli.Context) error {
+	report, err := inspect.Inspect(inspect.Options{DataDir: c.String("data-dir")})
+	if err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) != output.FormatTable {
+		return output.NewFormatter(output.Format(flags.Output), flags.Wide).Format(c.App.Writer, report)
+	}
+
+	w := c.App.Writer
+	segments := &output.Table{
+		Headers: []string{"SEGMENT", "ENTRIES", "FIRST OFFSET", "LAST OFFSET", "LAST WRITE", "SIZE", "STATE", "CHECKSUM"},
+	}
+	for _, seg := range report.Segments {
+		state := "open"
+		switch {
+		case seg.Problem != "":
+			state = "damaged"
+		case seg.Sealed:
+			state = "sealed"
+		}
+		row := []string{fmt.Sprintf("%d", seg.ID), fmt.Sprintf("%d", seg.Entries), "-", "-", "-",
+			fmt.Sprintf("%d", seg.Size), state, shortChecksum(seg.Checksum, flags.Wide)}
+		if seg.Entries > 0 {
+			row[2] = inspect.FormatOffset(seg.FirstOffset)
+			row[3] = inspect.FormatOffset(seg.LastOffset)
+			row[4] = time.UnixMilli(seg.LastTimestamp).UTC().Format(time.RFC3339)
+		}
+		segments.Rows = append(segments.Rows, row)
+	}
+	fmt.Fprintf(w, "WAL: %s\n", report.WALDir)
+	if err := segments.Render(w); err != nil {
+		return err
+	}
+
+	snapshots := &output.Table{
+		Headers: []string{"SNAPSHOT", "SESSIONS", "WAL OFFSET", "CREATED", "SIZE", "STATE", "CHECKSUM"},
+	}
+	for _, s := range report.Snapshots {
+		row := []string{s.ID, "-", "-", "-", fmt.Sprintf("%d", s.Size), "ok", shortChecksum(s.Checksum, flags.Wide)}
+		if s.Problem != "" {
+			row[5] = "unreadable"
+			if s.Corrupt {
+				row[5] = "corrupt"
+			}
+		} else {
+			row[1] = fmt.Sprintf("%d", s.SessionCount)
+			row[2] = inspect.FormatOffset(s.WALLastOffset)
+			row[3] = time.UnixMilli(s.CreatedAt).UTC().Format(time.RFC3339)
+			if s.Encrypted {
+				row[5] = "encrypted"
+			}
+		}
+		snapshots.Rows = append(snapshots.Rows, row)
+	}
+	fmt.Fprintf(w, "\nSnapshots: %s\n", report.SnapshotDir)
+	if err := snapshots.Render(w); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	writeProblems(w, report)
+	return nil
+}
+
+// shortChecksum abbreviates a hex checksum unless wide output is on.
+func shortChecksum(sum string, wide bool) string {
+	switch {
+	case sum == "":
+		return "-"
+	case wide || len(sum) <= 12:
+		return sum
+	default:
+		return sum[:12]
+	}
+}
+
+// writeProblems writes the verification result of a report.
+func writeProblems(w io.Writer, report *inspect.Report) {
+	if report.OK() {
+		fmt.Fprint(w, "OK: ")
+		if rp := report.RecoveryPoint(); rp != nil {
+			fmt.Fprintf(w, "recovery loads snapshot %s and replays the WAL from %s\n", rp.ID, inspect.FormatOffset(rp.WALLastOffset))
+		} else {
+			fmt.Fprintln(w, "recovery replays the whole WAL")
+		}
+		return
+	}
+	fmt.Fprintf(w, "%d problem(s):\n", len(report.Problems))
+	for _, p := range report.Problems {
+		fmt.Fprintf(w, "  - %s\n", p)
+	}
+}
+
+func dataVerify(c *cli.Context) error {
+	report, err := inspect.Inspect(inspect.Options{DataDir: c.String("data-dir")})
+	if err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) != output.FormatTable {
+		result := map[string]any{"ok": report.OK(), "problems": report.Problems, "repairs": report.Repairs()}
+		if err := output.NewFormatter(output.Format(flags.Output), flags.Wide).Format(c.App.Writer, result); err != nil {
+			return err
+		}
+	} else {
+		writeProblems(c.App.Writer, report)
+		if len(report.Repairs()) > 0 {
+			fmt.Fprintln(c.App.Writer, "Run 'tokmesh-cli data repair' with the server stopped to fix what can be repaired.")
+		}
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("data directory has %d problem(s)", len(report.Problems))
+	}
+	return nil
+}
+
+func dataDump(c *cli.Context) error {
+	opts := inspect.Options{DataDir: c.String("data-dir")}
+	dopts := inspect.DumpOptions{MaskPII: c.Bool("mask-pii")}
+
+	if path := c.String("snapshot"); path != "" {
+		if c.IsSet("from") {
+			return fmt.Errorf("--from applies to the WAL, not to --snapshot")
+		}
+		return inspect.DumpSnapshot(c.App.Writer, opts, path, dopts)
+	}
+	if from := c.String("from"); from != "" {
+		offset, err := inspect.ParseOffset(from)
+		if err != nil {
+			return err
+		}
+		dopts.From = offset
+	}
+	return inspect.Dump(c.App.Writer, opts, dopts)
+}
+
+func dataRepair(c *cli.Context) error {
+	report, err := inspect.Inspect(inspect.Options{DataDir: c.String("data-dir")})
+	if err != nil {
+		return err
+	}
+
+	w := c.App.Writer
+	repairs := report.Repairs()
+	if len(repairs) == 0 {
+		if report.OK() {
+			fmt.Fprintln(w, "Nothing to repair.")
+			return nil
+		}
+		writeProblems(w, report)
+		return fmt.Errorf("no automatic repair for these problems")
+	}
+
+	fmt.Fprintln(w, "Repairs:")
+	for _, rp := range repairs {
+		fmt.Fprintf(w, "  - %s\n", rp)
+	}
+	if !c.Bool("force") {
+		fmt.Fprint(w, "Make sure tokmesh-server is stopped. Apply these repairs? [y/N]: ")
+		answer, _ := bufio.NewReader(c.App.Reader).ReadString('\n')
+		if a := strings.TrimSpace(answer); a != "y" && a != "Y" {
+			fmt.Fprintln(w, "Cancelled.")
+			return nil
+		}
+	}
+
+	for _, rp := range repairs {
+		if err := rp.Apply(); err != nil {
+			return fmt.Errorf("%s: %w", rp.Action, err)
+		}
+		fmt.Fprintf(w, "Applied: %s %s\n", rp.Action, rp.Path)
+	}
+
+	after, err := inspect.Inspect(inspect.Options{DataDir: c.String("data-dir")})
+	if err != nil {
+		return err
+	}
+	writeProblems(w, after)
+	if !after.OK() {
+		return fmt.Errorf("data directory has %d problem(s) left", len(after.Problems))
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/archive"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// writeDataDir writes a data directory with a snapshot of one session and
+// a second session in the WAL after it.
+func writeDataDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := storage.DefaultConfig(dir)
+	cfg.WAL.SyncMode = wal.SyncModeSync
+	engine, err := storage.New(cfg)
+	if err != nil {
+		t.Fatalf("storage.New: %v", err)
+	}
+	ctx := context.Background()
+	for i, user := range []string{"alice", "bob"} {
+		s, _ := domain.NewSession(user)
+		s.TokenHash = "tmth_" + user
+		s.IPAddress = "198.51.100.1"
+		s.SetExpiration(time.Hour)
+		if errs := engine.CreateBatch(ctx, []*domain.Session{s}); errs[0] != nil {
+			t.Fatalf("CreateBatch: %v", errs[0])
+		}
+		if i == 0 {
+			if _, err := engine.TriggerSnapshot(ctx); err != nil {
+				t.Fatalf("TriggerSnapshot: %v", err)
+			}
+		}
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return dir
+}
+
+// runData runs a data subcommand and returns its output.
+func runData(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	app := App()
+	var out bytes.Buffer
+	app.Writer = &out
+	app.Reader = strings.NewReader(stdin)
+	err := app.Run(append([]string{app.Name}, args...))
+	return out.String(), err
+}
+
+func TestDataCommand(t *testing.T) {
+	cmd := DataCommand()
+	if cmd.Name != "data" {
+		t.Errorf("Name = %q, want %q", cmd.Name, "data")
+	}
+
+	subcommands := make(map[string]bool)
+	for _, sub := range cmd.Subcommands {
+		subcommands[sub.Name] = true
+	}
+	for _, name := range []string{"inspect", "verify", "dump", "repair", "pitr", "archive"} {
+		if !subcommands[name] {
+			t.Errorf("missing subcommand: %s", name)
+		}
+	}
+}
+
+func TestData_InspectAndVerify(t *testing.T) {
+	dir := writeDataDir(t)
+
+	out, err := runData(t, "", "data", "inspect", "--data-dir", dir)
+	if err != nil {
+		t.Fatalf("data inspect: %v", err)
+	}
+	for _, want := range []string{"SEGMENT", "sealed", "SNAPSHOT", "OK: recovery loads snapshot"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("inspect output missing %q:\n%s", want, out)
+		}
+	}
+
+	out, err = runData(t, "", "--output", "json", "data", "inspect", "--data-dir", dir)
+	if err != nil {
+		t.Fatalf("data inspect -o json: %v", err)
+	}
+	var report struct {
+		Segments  []map[string]any `json:"segments"`
+		Snapshots []map[string]any `json:"snapshots"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("json output: %v\n%s", err, out)
+	}
+	if len(report.Segments) != 1 || len(report.Snapshots) != 1 || report.Segments[0]["entries"] != 2.0 {
+		t.Errorf("json report = %s", out)
+	}
+
+	if _, err := runData(t, "", "data", "verify", "--data-dir", dir); err != nil {
+		t.Errorf("data verify of a healthy directory: %v", err)
+	}
+	if _, err := runData(t, "", "data", "verify", "--data-dir", filepath.Join(dir, "missing")); err == nil {
+		t.Error("data verify of a missing directory should fail")
+	}
+}
+
+func TestData_Dump(t *testing.T) {
+	dir := writeDataDir(t)
+
+	out, err := runData(t, "", "data", "dump", "--data-dir", dir, "--mask-pii")
+	if err != nil {
+		t.Fatalf("data dump: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("dump = %d lines, want 2:\n%s", len(lines), out)
+	}
+	if !strings.Contains(lines[1], `"token_hash":"tmth_bob"`) || strings.Contains(out, "198.51.100.1") || strings.Contains(out, `"bob"`) {
+		t.Errorf("masked dump:\n%s", out)
+	}
+
+	var first struct {
+		Offset string `json:"offset"`
+	}
+	json.Unmarshal([]byte(lines[1]), &first)
+	out, err = runData(t, "", "data", "dump", "--data-dir", dir, "--from", first.Offset)
+	if err != nil {
+		t.Fatalf("data dump --from: %v", err)
+	}
+	if strings.Count(out, "\n") != 1 || !strings.Contains(out, `"user_id":"bob"`) {
+		t.Errorf("dump --from %s:\n%s", first.Offset, out)
+	}
+
+	if _, err := runData(t, "", "data", "dump", "--data-dir", dir, "--from", "x:1"); err == nil {
+		t.Error("dump with an invalid offset should fail")
+	}
+}
+
+func TestData_PITR(t *testing.T) {
+	dir := writeDataDir(t)
+
+	// Recover up to bob's entry: only alice, from the snapshot
+	out, err := runData(t, "", "--output", "json", "data", "dump", "--data-dir", dir)
+	if err != nil {
+		t.Fatalf("data dump: %v", err)
+	}
+	var bob struct {
+		Offset string `json:"offset"`
+	}
+	json.Unmarshal([]byte(strings.Split(strings.TrimSpace(out), "\n")[1]), &bob)
+
+	snapDir := t.TempDir()
+	out, err = runData(t, "", "--output", "json", "data", "pitr", "--data-dir", dir,
+		"--to-offset", bob.Offset, "--output-snapshot-dir", snapDir)
+	if err != nil {
+		t.Fatalf("data pitr --to-offset: %v", err)
+	}
+	var res struct {
+		BaseSnapshot  string `json:"base_snapshot"`
+		SessionCount  int    `json:"session_count"`
+		TargetReached bool   `json:"target_reached"`
+	}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("json output: %v\n%s", err, out)
+	}
+	if res.BaseSnapshot == "" || res.SessionCount != 1 || !res.TargetReached {
+		t.Errorf("pitr --to-offset = %s", out)
+	}
+
+	// Recover up to now into a new data directory: the WAL ends first
+	restored := filepath.Join(t.TempDir(), "restored")
+	out, err = runData(t, "", "data", "pitr", "--data-dir", dir,
+		"--to-time", time.Now().Add(time.Minute).Format(time.RFC3339), "--output-data-dir", restored)
+	if err != nil {
+		t.Fatalf("data pitr --to-time: %v", err)
+	}
+	if !strings.Contains(out, "Sessions:        2") || !strings.Contains(out, "Warning") {
+		t.Errorf("pitr --to-time output:\n%s", out)
+	}
+	if _, err := runData(t, "", "data", "verify", "--data-dir", restored); err != nil {
+		t.Errorf("data verify of the recovered directory: %v", err)
+	}
+
+	if _, err := runData(t, "", "data", "pitr", "--data-dir", dir, "--output-data-dir", t.TempDir()); err == nil {
+		t.Error("pitr without a target should fail")
+	}
+}
+
+func TestData_Archive(t *testing.T) {
+	dir := writeDataDir(t)
+	archiveDir := t.TempDir()
+
+	// Ship the data directory, as the server does
+	target, _ := archive.NewDirTarget(archiveDir)
+	cfg := storage.DefaultConfig(dir)
+	shipper, err := archive.NewShipper(archive.Config{
+		Target:        target,
+		WALDir:        cfg.WAL.Dir,
+		SnapshotDir:   cfg.Snapshot.Dir,
+		ActiveSegment: func() uint64 { return 1 << 31 },
+	})
+	if err != nil {
+		t.Fatalf("NewShipper: %v", err)
+	}
+	if err := shipper.Ship(context.Background()); err != nil {
+		t.Fatalf("Ship: %v", err)
+	}
+
+	out, err := runData(t, "", "data", "archive", "list", "--dir", archiveDir)
+	if err != nil {
+		t.Fatalf("data archive list: %v", err)
+	}
+	for _, want := range []string{"wal/wal-00000001.log", "snapshots/snapshot-", "CHECKSUM"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("list output missing %q:\n%s", want, out)
+		}
+	}
+	if _, err := runData(t, "", "data", "archive", "verify", "--dir", archiveDir); err != nil {
+		t.Errorf("data archive verify: %v", err)
+	}
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	out, err = runData(t, "", "data", "archive", "restore", "--dir", archiveDir, "--data-dir", restored)
+	if err != nil {
+		t.Fatalf("data archive restore: %v", err)
+	}
+	if !strings.Contains(out, "Restored 1 WAL segment(s) and 1 snapshot(s)") {
+		t.Errorf("restore output:\n%s", out)
+	}
+	if _, err := runData(t, "", "data", "verify", "--data-dir", restored); err != nil {
+		t.Errorf("data verify of the restored directory: %v", err)
+	}
+
+	if _, err := runData(t, "", "data", "archive", "list"); err == nil {
+		t.Error("archive list without a target should fail")
+	}
+}
+
+func TestData_Repair(t *testing.T) {
+	dir := writeDataDir(t)
+
+	// A crash mid-write leaves the segment unsealed with a partial entry.
+	segment := filepath.Join(dir, "data", "wal", "wal-00000001.log")
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	data = append(data[:len(data)-wal.ChecksumSize], 0, 0, 1, 0, 9)
+	if err := os.WriteFile(segment, data, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := runData(t, "", "data", "verify", "--data-dir", dir); err == nil {
+		t.Fatal("data verify should fail on a torn tail")
+	}
+
+	out, err := runData(t, "n\n", "data", "repair", "--data-dir", dir)
+	if err != nil || !strings.Contains(out, "Cancelled.") {
+		t.Fatalf("declined repair: %v\n%s", err, out)
+	}
+	if st, _ := os.Stat(segment); st.Size() != int64(len(data)) {
+		t.Fatal("declined repair changed the segment")
+	}
+
+	out, err = runData(t, "y\n", "data", "repair", "--data-dir", dir)
+	if err != nil {
+		t.Fatalf("data repair: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "truncate "+segment) || !strings.Contains(out, "OK: ") {
+		t.Errorf("repair output:\n%s", out)
+	}
+
+	out, err = runData(t, "", "data", "repair", "--data-dir", dir, "--force")
+	if err != nil || !strings.Contains(out, "Nothing to repair.") {
+		t.Errorf("repair of a healthy directory: %v\n%s", err, out)
+	}
+}
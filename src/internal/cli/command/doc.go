@@ -4,11 +4,17 @@
 //
 //   - root.go: Root command, global flags, mode detection
 //   - session.go: Session subcommand group
+//   - session_transfer.go: Session import/export (JSONL and CSV)
 //   - apikey.go: API key subcommand group
 //   - config.go: Configuration subcommand group
 //   - backup.go: Backup/restore subcommand group
 //   - system.go: System subcommand group
-//   - connect.go: Connection management commands
+//   - connect.go: Connection management commands and connect --test
+//   - profile.go: Connection profiles (list/add/remove/default)
+//   - data.go: Offline data directory inspection, dump and repair
+//   - wal.go: WAL status and tail of a running server
+//   - top.go: Live dashboard of server and cluster metrics
+//   - shell.go: Interactive shell (REPL) entry point and completion specs
 //
 // Commands follow a consistent pattern of parsing flags,
 // calling the appropriate service, and formatting output.
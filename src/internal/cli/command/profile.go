@@ -0,0 +1,314 @@
+// Package command provides CLI command definitions for tokmesh-cli.
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
+)
+
+// ProfileCommand returns the profile subcommand group, which manages the
+// saved connection profiles in the CLI config file. Secrets are kept in
+// the separate credentials file, or read from an environment variable or
+// a command at use.
+//
+// @design DS-0601
+func ProfileCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "profile",
+		Usage: "Connection profile management",
+		Subcommands: []*cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "List connection profiles",
+				Action:  profileList,
+			},
+			{
+				Name:      "add",
+				Usage:     "Add or replace a connection profile",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "server",
+						Usage: "Server address, e.g. https://tokmesh.example.com:5443",
+					},
+					&cli.StringFlag{
+						Name:  "socket",
+						Usage: "Local management socket path (instead of --server)",
+					},
+					&cli.StringFlag{
+						Name:  "key-id",
+						Usage: "API key ID",
+					},
+					&cli.StringFlag{
+						Name:  "secret",
+						Usage: "API key secret, stored in the credentials file ('-' reads it from stdin)",
+					},
+					&cli.StringFlag{
+						Name:  "secret-env",
+						Usage: "Environment variable holding the API key secret",
+					},
+					&cli.StringFlag{
+						Name:  "secret-command",
+						Usage: "Command printing the API key secret, e.g. a password manager CLI",
+					},
+					&cli.StringFlag{
+						Name:  "ca-file",
+						Usage: "CA certificate file verifying the server",
+					},
+					&cli.StringFlag{
+						Name:  "cert-file",
+						Usage: "Client certificate file for mTLS",
+					},
+					&cli.StringFlag{
+						Name:  "key-file",
+						Usage: "Client private key file for mTLS",
+					},
+					&cli.BoolFlag{
+						Name:  "insecure-skip-verify",
+						Usage: "Do not verify the server certificate (testing only)",
+					},
+					&cli.BoolFlag{
+						Name:  "default",
+						Usage: "Make it the default profile",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Replace an existing profile",
+					},
+				},
+				Action: profileAdd,
+			},
+			{
+				Name:      "remove",
+				Aliases:   []string{"rm"},
+				Usage:     "Remove a connection profile and its stored secret",
+				ArgsUsage: "PROFILE",
+				Action:    profileRemove,
+			},
+			{
+				Name:      "default",
+				Usage:     "Show or set the default profile",
+				ArgsUsage: "[PROFILE]",
+				Action:    profileDefault,
+			},
+		},
+	}
+}
+
+// profileInfo is a row of profile list.
+type profileInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Server  string `json:"server"`
+	KeyID   string `json:"key_id"`
+	Secret  string `json:"secret"`
+	Default bool   `json:"default"`
+}
+
+func profileList(c *cli.Context) error {
+	flags := ParseGlobalFlags(c)
+	cfg, err := config.Load(flags.Config)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Connections))
+	for name := range cfg.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := make([]profileInfo, 0, len(names))
+	for _, name := range names {
+		cc := cfg.Connections[name]
+		info := profileInfo{
+			Name:    name,
+			Type:    profileType(cc),
+			Server:  cc.Server,
+			KeyID:   cc.APIKeyID,
+			Secret:  cc.SecretSource(),
+			Default: cfg.CurrentConnection == name,
+		}
+		if cc.Socket != "" {
+			info.Server = cc.Socket
+		}
+		if info.Secret == "" {
+			info.Secret = "-"
+		}
+		profiles = append(profiles, info)
+	}
+
+	if len(profiles) == 0 && output.Format(flags.Output) == output.FormatTable {
+		fmt.Fprintln(c.App.Writer, "No connection profiles (add one with 'tokmesh-cli profile add')")
+		return nil
+	}
+	return output.NewFormatter(output.Format(flags.Output), flags.Wide).Format(c.App.Writer, profiles)
+}
+
+// profileType names the transport of a profile.
+func profileType(cc config.ConnectionConfig) string {
+	switch {
+	case cc.Socket != "":
+		return "socket"
+	case cc.TLS || strings.HasPrefix(cc.Server, "https://"):
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+func profileAdd(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("profile name required")
+	}
+
+	cc := config.ConnectionConfig{
+		Server:             c.String("server"),
+		Socket:             c.String("socket"),
+		APIKeyID:           c.String("key-id"),
+		APIKey:             c.String("secret"),
+		APIKeyEnv:          c.String("secret-env"),
+		APIKeyCommand:      c.String("secret-command"),
+		CAFile:             c.String("ca-file"),
+		CertFile:           c.String("cert-file"),
+		KeyFile:            c.String("key-file"),
+		InsecureSkipVerify: c.Bool("insecure-skip-verify"),
+	}
+	if (cc.Server == "") == (cc.Socket == "") {
+		return fmt.Errorf("exactly one of --server and --socket is required")
+	}
+
+	sources := 0
+	for _, s := range []string{cc.APIKey, cc.APIKeyEnv, cc.APIKeyCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("use only one of --secret, --secret-env and --secret-command")
+	}
+	if cc.Socket != "" && (sources > 0 || cc.APIKeyID != "") {
+		return fmt.Errorf("a socket profile needs no API key")
+	}
+
+	tlsSet := cc.CAFile != "" || cc.CertFile != "" || cc.KeyFile != "" || cc.InsecureSkipVerify
+	if tlsSet {
+		if cc.Socket != "" {
+			return fmt.Errorf("TLS options do not apply to a socket profile")
+		}
+		if _, err := connection.LoadTLSConfig(cc.CAFile, cc.CertFile, cc.KeyFile, cc.InsecureSkipVerify); err != nil {
+			return err
+		}
+	}
+	cc.TLS = tlsSet || strings.HasPrefix(cc.Server, "https://")
+
+	if cc.APIKey == "-" {
+		secret, err := readSecret(c.App.Reader)
+		if err != nil {
+			return err
+		}
+		cc.APIKey = secret
+	}
+
+	flags := ParseGlobalFlags(c)
+	cfg, err := config.Load(flags.Config)
+	if err != nil {
+		return err
+	}
+	if _, exists := cfg.Connections[name]; exists && !c.Bool("force") {
+		return fmt.Errorf("profile %q already exists (use --force to replace it)", name)
+	}
+	cfg.Connections[name] = cc
+	if c.Bool("default") || cfg.CurrentConnection == "" {
+		cfg.CurrentConnection = name
+	}
+	if err := config.Save(cfg, flags.Config); err != nil {
+		return fmt.Errorf("save cli config: %w", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "Profile %q saved", name)
+	if cfg.CurrentConnection == name {
+		fmt.Fprint(c.App.Writer, " (default)")
+	}
+	fmt.Fprintln(c.App.Writer)
+	return nil
+}
+
+// readSecret reads a secret from the first line of r.
+func readSecret(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return "", fmt.Errorf("read secret: empty input")
+	}
+	return secret, nil
+}
+
+func profileRemove(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("profile name required")
+	}
+
+	flags := ParseGlobalFlags(c)
+	cfg, err := config.Load(flags.Config)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Connections[name]; !ok {
+		return fmt.Errorf("no connection profile %q", name)
+	}
+	delete(cfg.Connections, name)
+	if cfg.CurrentConnection == name {
+		cfg.CurrentConnection = ""
+	}
+	if err := config.Save(cfg, flags.Config); err != nil {
+		return fmt.Errorf("save cli config: %w", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "Profile %q removed\n", name)
+	return nil
+}
+
+func profileDefault(c *cli.Context) error {
+	flags := ParseGlobalFlags(c)
+	cfg, err := config.Load(flags.Config)
+	if err != nil {
+		return err
+	}
+
+	name := c.Args().First()
+	if name == "" {
+		if cfg.CurrentConnection == "" {
+			fmt.Fprintln(c.App.Writer, "No default profile")
+		} else {
+			fmt.Fprintln(c.App.Writer, cfg.CurrentConnection)
+		}
+		return nil
+	}
+
+	if _, ok := cfg.Connections[name]; !ok {
+		return fmt.Errorf("no connection profile %q", name)
+	}
+	cfg.CurrentConnection = name
+	if err := config.Save(cfg, flags.Config); err != nil {
+		return fmt.Errorf("save cli config: %w", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "Default profile: %s\n", name)
+	return nil
+}
@@ -0,0 +1,182 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
+)
+
+// runProfile runs a profile subcommand against the config at path and
+// returns its output.
+func runProfile(t *testing.T, path, stdin string, args ...string) (string, error) {
+	t.Helper()
+	app := App()
+	var out bytes.Buffer
+	app.Writer = &out
+	app.Reader = strings.NewReader(stdin)
+	err := app.Run(append([]string{app.Name, "--config", path, "profile"}, args...))
+	return out.String(), err
+}
+
+func TestProfileCommand(t *testing.T) {
+	cmd := ProfileCommand()
+	if cmd.Name != "profile" {
+		t.Errorf("Name = %q, want %q", cmd.Name, "profile")
+	}
+
+	subcommands := make(map[string]bool)
+	for _, sub := range cmd.Subcommands {
+		subcommands[sub.Name] = true
+	}
+	for _, name := range []string{"list", "add", "remove", "default"} {
+		if !subcommands[name] {
+			t.Errorf("missing subcommand: %s", name)
+		}
+	}
+}
+
+func TestProfile_AddListRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli.yaml")
+
+	if _, err := runProfile(t, path, "tmas_from_stdin\n", "add",
+		"--server", "https://tokmesh.example.com:5443", "--key-id", "tmak-prod", "--secret", "-", "prod"); err != nil {
+		t.Fatalf("profile add prod: %v", err)
+	}
+	if _, err := runProfile(t, path, "", "add",
+		"--server", "localhost:5080", "--key-id", "tmak-ci", "--secret-command", "pass show tokmesh/ci", "ci"); err != nil {
+		t.Fatalf("profile add ci: %v", err)
+	}
+	out, err := runProfile(t, path, "", "add", "--socket", "/run/tokmesh/tokmesh.sock", "--default", "local")
+	if err != nil {
+		t.Fatalf("profile add local: %v", err)
+	}
+	if !strings.Contains(out, `Profile "local" saved (default)`) {
+		t.Errorf("add output = %q", out)
+	}
+
+	// The secret is only in the credentials file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if strings.Contains(string(data), "tmas_from_stdin") {
+		t.Errorf("cli.yaml contains the secret:\n%s", data)
+	}
+	creds, err := config.LoadCredentials(config.CredentialsPath(path))
+	if err != nil {
+		t.Fatalf("LoadCredentials: %v", err)
+	}
+	if creds.Profiles["prod"].APIKey != "tmas_from_stdin" {
+		t.Errorf("stored secret = %q", creds.Profiles["prod"].APIKey)
+	}
+
+	out, err = runProfile(t, path, "", "list")
+	if err != nil {
+		t.Fatalf("profile list: %v", err)
+	}
+	for _, want := range []string{"prod", "https", "tmak-prod", "file", "ci", "command", "local", "socket", "/run/tokmesh/tokmesh.sock"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("list output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "tmas_from_stdin") {
+		t.Errorf("list output shows the secret:\n%s", out)
+	}
+
+	// Remove the default profile
+	if _, err := runProfile(t, path, "", "remove", "local"); err != nil {
+		t.Fatalf("profile remove: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := cfg.Connections["local"]; ok {
+		t.Error("profile local still exists")
+	}
+	if cfg.CurrentConnection != "" {
+		t.Errorf("default = %q after removing it, want none", cfg.CurrentConnection)
+	}
+	if _, err := runProfile(t, path, "", "remove", "local"); err == nil {
+		t.Error("removing a missing profile should fail")
+	}
+}
+
+func TestProfile_ListJSON(t *testing.T) {
+	path := writeProfiles(t)
+
+	app := App()
+	var out bytes.Buffer
+	app.Writer = &out
+	if err := app.Run([]string{app.Name, "--config", path, "--output", "json", "profile", "list"}); err != nil {
+		t.Fatalf("profile list: %v", err)
+	}
+
+	var profiles []profileInfo
+	if err := json.Unmarshal(out.Bytes(), &profiles); err != nil {
+		t.Fatalf("parse output: %v\n%s", err, out.String())
+	}
+	if len(profiles) != 2 || profiles[0].Name != "local" || profiles[1].Name != "prod" {
+		t.Fatalf("profiles = %+v", profiles)
+	}
+	if !profiles[1].Default || profiles[1].Type != "https" || profiles[1].Secret != "file" {
+		t.Errorf("prod = %+v", profiles[1])
+	}
+}
+
+func TestProfile_AddValidation(t *testing.T) {
+	path := writeProfiles(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no target", []string{"add", "x"}, "exactly one of --server and --socket"},
+		{"both targets", []string{"add", "--server", "a:1", "--socket", "/s", "x"}, "exactly one of --server and --socket"},
+		{"two secrets", []string{"add", "--server", "a:1", "--secret", "s", "--secret-env", "E", "x"}, "only one of"},
+		{"socket with key", []string{"add", "--socket", "/s", "--key-id", "k", "x"}, "needs no API key"},
+		{"missing CA", []string{"add", "--server", "a:1", "--ca-file", "/nonexistent/ca.pem", "x"}, "ca.pem"},
+		{"existing", []string{"add", "--server", "a:1", "prod"}, "--force"},
+		{"no name", []string{"add", "--server", "a:1"}, "name required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runProfile(t, path, "", tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := runProfile(t, path, "", "add", "--server", "a:1", "--force", "prod"); err != nil {
+		t.Errorf("add --force: %v", err)
+	}
+}
+
+func TestProfile_Default(t *testing.T) {
+	path := writeProfiles(t)
+
+	out, err := runProfile(t, path, "", "default")
+	if err != nil || strings.TrimSpace(out) != "prod" {
+		t.Errorf("default = %q, %v; want prod", out, err)
+	}
+	if _, err := runProfile(t, path, "", "default", "local"); err != nil {
+		t.Fatalf("default local: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.CurrentConnection != "local" {
+		t.Errorf("default = %q, want local", cfg.CurrentConnection)
+	}
+	if _, err := runProfile(t, path, "", "default", "staging"); err == nil {
+		t.Error("default with a missing profile should fail")
+	}
+}
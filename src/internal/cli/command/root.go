@@ -5,11 +5,13 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
 	"github.com/yndnr/tokmesh-go/internal/cli/connection"
 )
 
@@ -29,11 +31,17 @@ func App() *cli.App {
 		Flags:   globalFlags(),
 		Commands: []*cli.Command{
 			ConnectCommand(),
+			ProfileCommand(),
 			SessionCommand(),
 			APIKeyCommand(),
 			SystemCommand(),
 			ConfigCommand(),
+			DataCommand(),
+			WALCommand(),
+			TopCommand(),
+			ShellCommand(),
 		},
+		Action: rootAction,
 		Before: func(c *cli.Context) error {
 			// Initialize connection manager
 			mgr := connection.NewManager()
@@ -67,6 +75,18 @@ func globalFlags() []cli.Flag {
 			Usage:   "API Key secret for authentication",
 			EnvVars: []string{"TOKMESH_API_KEY"},
 		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Aliases: []string{"P"},
+			Usage:   "Connection profile to use (default: the default profile unless --server is given)",
+			EnvVars: []string{"TOKMESH_PROFILE"},
+		},
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "CLI config file holding the connection profiles",
+			EnvVars: []string{"TOKMESH_CLI_CONFIG"},
+			Value:   config.DefaultConfigPath(),
+		},
 		&cli.StringFlag{
 			Name:    "output",
 			Aliases: []string{"o"},
@@ -93,6 +113,11 @@ type GlobalFlags struct {
 	APIKeyID string
 	APIKey   string
 
+	// Profile is the connection profile selected by --profile.
+	Profile string
+	// Config is the CLI config file path.
+	Config string
+
 	// Output format
 	Output string // table, json, yaml
 	Wide   bool
@@ -107,6 +132,8 @@ func ParseGlobalFlags(c *cli.Context) *GlobalFlags {
 		Server:   c.String("server"),
 		APIKeyID: c.String("api-key-id"),
 		APIKey:   c.String("api-key"),
+		Profile:  c.String("profile"),
+		Config:   c.String("config"),
 		Output:   c.String("output"),
 		Wide:     c.Bool("wide"),
 		Verbose:  c.Bool("verbose"),
@@ -121,14 +148,56 @@ func GetConnectionManager(c *cli.Context) *connection.Manager {
 	return nil
 }
 
-// EnsureConnected checks if connected and returns the HTTP client.
-func EnsureConnected(c *cli.Context) (*connection.HTTPClient, error) {
+// ResolveConnection returns the connection selected by the global
+// flags: the --profile profile, else the default profile unless --server
+// is given, else the --server address. Connection flags given explicitly
+// override the profile's settings.
+func ResolveConnection(c *cli.Context) (*connection.Connection, error) {
 	flags := ParseGlobalFlags(c)
+	fromFlags := &connection.Connection{
+		Server:   flags.Server,
+		APIKeyID: flags.APIKeyID,
+		APIKey:   flags.APIKey,
+	}
+	if flags.Profile == "" && c.IsSet("server") {
+		return fromFlags, nil
+	}
 
-	// Create HTTP client with provided credentials
-	client := connection.NewHTTPClient(flags.Server, flags.APIKeyID, flags.APIKey)
+	cfg, err := config.Load(flags.Config)
+	if err != nil {
+		return nil, err
+	}
+	name := flags.Profile
+	if name == "" {
+		name = cfg.CurrentConnection
+		if _, ok := cfg.Connections[name]; !ok {
+			return fromFlags, nil
+		}
+	}
+	cc, ok := cfg.Connections[name]
+	if !ok {
+		return nil, fmt.Errorf("no connection profile %q (see 'tokmesh-cli profile list')", name)
+	}
+	if c.IsSet("server") {
+		cc.Server, cc.Socket = flags.Server, ""
+	}
+	if c.IsSet("api-key-id") {
+		cc.APIKeyID = flags.APIKeyID
+	}
+	if c.IsSet("api-key") {
+		cc.APIKey, cc.APIKeyEnv, cc.APIKeyCommand = flags.APIKey, "", ""
+	}
+	return connection.FromProfile(context.Background(), name, cc)
+}
 
-	return client, nil
+// EnsureConnected resolves the connection (see ResolveConnection) and
+// returns its HTTP client.
+func EnsureConnected(c *cli.Context) (*connection.HTTPClient, error) {
+	conn, err := ResolveConnection(c)
+	if err != nil {
+		return nil, err
+	}
+	return conn.HTTPClient()
 }
 
 // PrintError prints an error message to stderr.
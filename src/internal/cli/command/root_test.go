@@ -3,9 +3,14 @@ package command
 import (
 	"bytes"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
 )
 
 func TestApp(t *testing.T) {
@@ -28,7 +33,7 @@ func TestApp(t *testing.T) {
 		commandNames[cmd.Name] = true
 	}
 
-	requiredCommands := []string{"connect", "session", "apikey", "system", "config"}
+	requiredCommands := []string{"connect", "profile", "session", "apikey", "system", "config"}
 	for _, name := range requiredCommands {
 		if !commandNames[name] {
 			t.Errorf("missing required command: %s", name)
@@ -44,7 +49,7 @@ func TestApp_GlobalFlags(t *testing.T) {
 		flagNames[flag.Names()[0]] = true
 	}
 
-	requiredFlags := []string{"server", "api-key-id", "api-key", "output", "wide", "verbose"}
+	requiredFlags := []string{"server", "api-key-id", "api-key", "profile", "config", "output", "wide", "verbose"}
 	for _, name := range requiredFlags {
 		if !flagNames[name] {
 			t.Errorf("missing required flag: %s", name)
@@ -206,6 +211,95 @@ func TestEnsureConnected(t *testing.T) {
 	}
 }
 
+// writeProfiles saves a CLI config with a default "prod" HTTPS profile
+// and a "local" socket profile, returning its path.
+func writeProfiles(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cli.yaml")
+	cfg := config.Default()
+	cfg.Connections["prod"] = config.ConnectionConfig{
+		Server:   "tokmesh.example.com:5443",
+		APIKeyID: "tmak-prod",
+		APIKey:   "tmas_prod",
+		TLS:      true,
+	}
+	cfg.Connections["local"] = config.ConnectionConfig{Socket: "/run/tokmesh/tokmesh.sock"}
+	cfg.CurrentConnection = "prod"
+	if err := config.Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return path
+}
+
+// resolveWith runs ResolveConnection with the given global flags.
+func resolveWith(args ...string) (*connection.Connection, error) {
+	var (
+		conn *connection.Connection
+		err  error
+	)
+	app := &cli.App{
+		Flags: globalFlags(),
+		Action: func(c *cli.Context) error {
+			conn, err = ResolveConnection(c)
+			return nil
+		},
+	}
+	if runErr := app.Run(append([]string{"test"}, args...)); runErr != nil {
+		return nil, runErr
+	}
+	return conn, err
+}
+
+func TestResolveConnection(t *testing.T) {
+	path := writeProfiles(t)
+
+	// The default profile, with its stored secret
+	conn, err := resolveWith("--config", path)
+	if err != nil {
+		t.Fatalf("ResolveConnection: %v", err)
+	}
+	if conn.Name != "prod" || conn.Server != "https://tokmesh.example.com:5443" || conn.APIKey != "tmas_prod" {
+		t.Errorf("default profile = %+v", conn)
+	}
+
+	// Explicit flags override the profile
+	conn, err = resolveWith("--config", path, "--profile", "prod", "--api-key-id", "tmak-ci", "--api-key", "tmas_ci")
+	if err != nil {
+		t.Fatalf("ResolveConnection: %v", err)
+	}
+	if conn.Name != "prod" || conn.APIKeyID != "tmak-ci" || conn.APIKey != "tmas_ci" {
+		t.Errorf("overridden profile = %+v", conn)
+	}
+
+	// TOKMESH_PROFILE selects a profile
+	t.Setenv("TOKMESH_PROFILE", "local")
+	conn, err = resolveWith("--config", path)
+	if err != nil {
+		t.Fatalf("ResolveConnection: %v", err)
+	}
+	if conn.Socket != "/run/tokmesh/tokmesh.sock" {
+		t.Errorf("TOKMESH_PROFILE=local resolved to %+v", conn)
+	}
+	if _, err := conn.HTTPClient(); err == nil {
+		t.Error("HTTPClient() of a socket profile should fail")
+	}
+	t.Setenv("TOKMESH_PROFILE", "")
+
+	// --server without a profile bypasses the default profile
+	conn, err = resolveWith("--config", path, "--server", "localhost:8080")
+	if err != nil {
+		t.Fatalf("ResolveConnection: %v", err)
+	}
+	if conn.Name != "" || conn.Server != "localhost:8080" || conn.APIKey != "" {
+		t.Errorf("--server resolved to %+v", conn)
+	}
+
+	// An unknown profile is an error
+	if _, err := resolveWith("--config", path, "--profile", "staging"); err == nil || !strings.Contains(err.Error(), `"staging"`) {
+		t.Errorf("unknown profile: err = %v", err)
+	}
+}
+
 func TestPrintError(t *testing.T) {
 	// Capture stderr
 	oldStderr := os.Stderr
@@ -4,7 +4,10 @@ package command
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -39,6 +42,43 @@ func SessionCommand() *cli.Command {
 						Value: 20,
 						Usage: "Page size (max 100)",
 					},
+					&cli.StringFlag{
+						Name:  "device-id",
+						Usage: "Filter by exact device ID",
+					},
+					&cli.StringFlag{
+						Name:  "device-prefix",
+						Usage: "Filter by device ID prefix",
+					},
+					&cli.StringFlag{
+						Name:  "created-by",
+						Usage: "Filter by creating API key ID",
+					},
+					&cli.StringSliceFlag{
+						Name:    "data",
+						Aliases: []string{"d"},
+						Usage:   "Filter by session data as KEY=VALUE pairs (all must match)",
+					},
+					&cli.DurationFlag{
+						Name:  "expiring-within",
+						Usage: "Only sessions expiring within this duration (e.g., 10m)",
+					},
+					&cli.StringFlag{
+						Name:  "sort-by",
+						Usage: "Sort by created_at or last_active",
+					},
+					&cli.StringFlag{
+						Name:  "sort-order",
+						Usage: "Sort order: asc or desc",
+					},
+					&cli.StringFlag{
+						Name:  "cursor",
+						Usage: "Resume cursor-based listing from a previous next cursor",
+					},
+					&cli.IntFlag{
+						Name:  "limit",
+						Usage: "Use cursor-based pagination with this page size (max 100)",
+					},
 				},
 				Action: sessionList,
 			},
@@ -112,6 +152,123 @@ func SessionCommand() *cli.Command {
 				},
 				Action: sessionRevokeAll,
 			},
+			{
+				Name:  "revoke-query",
+				Usage: "Revoke all sessions matching criteria (e.g., a compromised API key)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "user-id",
+						Aliases: []string{"u"},
+						Usage:   "Match user ID",
+					},
+					&cli.StringFlag{
+						Name:  "device-id",
+						Usage: "Match device ID",
+					},
+					&cli.StringFlag{
+						Name:  "created-by",
+						Usage: "Match creating API key ID",
+					},
+					&cli.StringFlag{
+						Name:  "ip",
+						Usage: "Match creating or last access IP address or CIDR (e.g., 10.0.0.0/8)",
+					},
+					&cli.StringSliceFlag{
+						Name:    "data",
+						Aliases: []string{"d"},
+						Usage:   "Match session data as KEY=VALUE pairs (all must match)",
+					},
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: "Reason recorded in the audit log",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only count matching sessions",
+					},
+					&cli.BoolFlag{
+						Name:  "wait",
+						Usage: "Wait for background revocation jobs to finish",
+					},
+					&cli.BoolFlag{
+						Name:    "force",
+						Aliases: []string{"f"},
+						Usage:   "Skip confirmation",
+					},
+				},
+				Action: sessionRevokeQuery,
+			},
+			{
+				Name:  "export",
+				Usage: "Export sessions (including token hashes) to JSONL or CSV",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Output file (default: stdout)",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: jsonl or csv (default: from file extension, else jsonl)",
+					},
+					&cli.StringFlag{
+						Name:    "user-id",
+						Aliases: []string{"u"},
+						Usage:   "Filter by user ID",
+					},
+					&cli.StringFlag{
+						Name:  "device-id",
+						Usage: "Filter by exact device ID",
+					},
+					&cli.StringFlag{
+						Name:  "device-prefix",
+						Usage: "Filter by device ID prefix",
+					},
+					&cli.StringFlag{
+						Name:  "created-by",
+						Usage: "Filter by creating API key ID",
+					},
+					&cli.StringSliceFlag{
+						Name:    "data",
+						Aliases: []string{"d"},
+						Usage:   "Filter by session data as KEY=VALUE pairs (all must match)",
+					},
+					&cli.DurationFlag{
+						Name:  "expiring-within",
+						Usage: "Only sessions expiring within this duration (e.g., 10m)",
+					},
+				},
+				Action: sessionExport,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import sessions from a JSONL or CSV export",
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Input format: jsonl or csv (default: from file extension, else jsonl)",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Validate records without importing them",
+					},
+					&cli.IntFlag{
+						Name:  "batch-size",
+						Value: 500,
+						Usage: "Records per request (max 1000)",
+					},
+					&cli.BoolFlag{
+						Name:  "resume",
+						Usage: "Skip records already imported by an interrupted run",
+					},
+					&cli.StringFlag{
+						Name:  "state-file",
+						Usage: "Progress file used by --resume (default: FILE.import-state)",
+					},
+				},
+				Action: sessionImport,
+			},
 		},
 	}
 }
@@ -125,27 +282,39 @@ func sessionList(c *cli.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	path := "/sessions"
-	params := []string{}
-	if userID := c.String("user-id"); userID != "" {
-		params = append(params, fmt.Sprintf("user_id=%s", userID))
+	params, err := sessionFilterParams(c)
+	if err != nil {
+		return err
 	}
-	if page := c.Int("page"); page > 0 {
-		params = append(params, fmt.Sprintf("page=%d", page))
+	if sortBy := c.String("sort-by"); sortBy != "" {
+		params.Set("sort_by", sortBy)
 	}
-	if pageSize := c.Int("page-size"); pageSize > 0 {
-		params = append(params, fmt.Sprintf("page_size=%d", pageSize))
+	if sortOrder := c.String("sort-order"); sortOrder != "" {
+		params.Set("sort_order", sortOrder)
 	}
-	if len(params) > 0 {
-		path += "?"
-		for i, p := range params {
-			if i > 0 {
-				path += "&"
-			}
-			path += p
+
+	// --cursor/--limit select cursor pagination; otherwise page/page-size apply.
+	if cursor, limit := c.String("cursor"), c.Int("limit"); cursor != "" || limit > 0 {
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		if limit > 0 {
+			params.Set("limit", strconv.Itoa(limit))
+		}
+	} else {
+		if page := c.Int("page"); page > 0 {
+			params.Set("page", strconv.Itoa(page))
+		}
+		if pageSize := c.Int("page-size"); pageSize > 0 {
+			params.Set("page_size", strconv.Itoa(pageSize))
 		}
 	}
 
+	path := "/sessions"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
 	resp, err := client.Get(ctx, path)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
@@ -158,14 +327,50 @@ func sessionList(c *cli.Context) error {
 			CreatedAt time.Time `json:"created_at"`
 			ExpiresAt time.Time `json:"expires_at"`
 		} `json:"items"`
-		Total int `json:"total"`
+		Total      int    `json:"total"`
+		NextCursor string `json:"next_cursor"`
 	}
 	if err := connection.ParseResponse(resp, &result); err != nil {
 		return err
 	}
 
 	flags := ParseGlobalFlags(c)
-	return outputSessions(flags, result.Items, result.Total)
+	if err := outputSessions(flags, result.Items, result.Total); err != nil {
+		return err
+	}
+	if result.NextCursor != "" && output.Format(flags.Output) != output.FormatJSON {
+		fmt.Printf("Next cursor: %s\n", result.NextCursor)
+	}
+	return nil
+}
+
+// sessionFilterParams builds the session filter query parameters shared by
+// list and export.
+func sessionFilterParams(c *cli.Context) (url.Values, error) {
+	params := url.Values{}
+	if userID := c.String("user-id"); userID != "" {
+		params.Set("user_id", userID)
+	}
+	if deviceID := c.String("device-id"); deviceID != "" {
+		params.Set("device_id", deviceID)
+	}
+	if prefix := c.String("device-prefix"); prefix != "" {
+		params.Set("device_id_prefix", prefix)
+	}
+	if createdBy := c.String("created-by"); createdBy != "" {
+		params.Set("created_by", createdBy)
+	}
+	for _, d := range c.StringSlice("data") {
+		key, value, ok := strings.Cut(d, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --data %q: expected KEY=VALUE", d)
+		}
+		params.Add("data", key+":"+value)
+	}
+	if within := c.Duration("expiring-within"); within > 0 {
+		params.Set("expires_within_seconds", strconv.FormatInt(int64(within.Seconds()), 10))
+	}
+	return params, nil
 }
 
 func outputSessions(flags *GlobalFlags, sessions any, total int) error {
@@ -196,7 +401,10 @@ func outputSessions(flags *GlobalFlags, sessions any, total int) error {
 		if err := table.Render(os.Stdout); err != nil {
 			return err
 		}
-		fmt.Printf("\nTotal: %d sessions\n", total)
+		// Cursor pagination does not count matches (total is -1).
+		if total >= 0 {
+			fmt.Printf("\nTotal: %d sessions\n", total)
+		}
 		return nil
 	}
 }
@@ -389,6 +597,140 @@ func sessionRevokeAll(c *cli.Context) error {
 	return nil
 }
 
+// revokeQueryPollInterval is how often --wait polls a revocation job.
+var revokeQueryPollInterval = time.Second
+
+func sessionRevokeQuery(c *cli.Context) error {
+	body := map[string]any{}
+	for flag, field := range map[string]string{
+		"user-id":    "user_id",
+		"device-id":  "device_id",
+		"created-by": "created_by",
+		"ip":         "ip",
+	} {
+		if v := c.String(flag); v != "" {
+			body[field] = v
+		}
+	}
+	if dataFlags := c.StringSlice("data"); len(dataFlags) > 0 {
+		data := make(map[string]string)
+		for _, d := range dataFlags {
+			key, value, ok := strings.Cut(d, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid --data %q: expected KEY=VALUE", d)
+			}
+			data[key] = value
+		}
+		body["data"] = data
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("at least one of --user-id, --device-id, --created-by, --ip or --data is required")
+	}
+	if reason := c.String("reason"); reason != "" {
+		body["reason"] = reason
+	}
+
+	client, err := EnsureConnected(c)
+	if err != nil {
+		return err
+	}
+
+	type revokeResult struct {
+		Matched    int    `json:"matched"`
+		Revoked    int    `json:"revoked"`
+		JobID      string `json:"job_id"`
+		Replicated bool   `json:"replicated"`
+	}
+	post := func(dryRun bool) (*revokeResult, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		body["dry_run"] = dryRun
+		resp, err := client.Post(ctx, "/sessions/revoke:query", body)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		var result revokeResult
+		if err := connection.ParseResponse(resp, &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	// Count first: for a dry run, and so the confirmation shows the impact.
+	if c.Bool("dry-run") || !c.Bool("force") {
+		result, err := post(true)
+		if err != nil {
+			return err
+		}
+		if c.Bool("dry-run") {
+			fmt.Printf("%d sessions match (on this node).\n", result.Matched)
+			return nil
+		}
+		fmt.Printf("This will revoke %d sessions on this node (and matching sessions on other cluster nodes). Continue? [y/N]: ", result.Matched)
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "y" && confirm != "Y" {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	}
+
+	result, err := post(false)
+	if err != nil {
+		return err
+	}
+
+	if result.JobID == "" {
+		fmt.Printf("%d sessions revoked.\n", result.Revoked)
+	} else {
+		fmt.Printf("Revoking %d sessions in background job %s.\n", result.Matched, result.JobID)
+		if c.Bool("wait") {
+			if err := waitForJob(client, result.JobID); err != nil {
+				return err
+			}
+		}
+	}
+	if result.Replicated {
+		fmt.Println("Revocation replicated to all cluster nodes.")
+	}
+	return nil
+}
+
+// waitForJob polls a background job until it finishes, printing progress.
+func waitForJob(client *connection.HTTPClient, jobID string) error {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		resp, err := client.Get(ctx, "/admin/v1/jobs/"+jobID)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("request failed: %w", err)
+		}
+		var job struct {
+			State string `json:"state"`
+			Total int    `json:"total"`
+			Done  int    `json:"done"`
+			Error string `json:"error"`
+		}
+		err = connection.ParseResponse(resp, &job)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\r%s: %d/%d", job.State, job.Done, job.Total)
+		switch job.State {
+		case "succeeded":
+			fmt.Println()
+			return nil
+		case "failed":
+			fmt.Println()
+			return fmt.Errorf("job %s failed: %s", jobID, job.Error)
+		}
+		time.Sleep(revokeQueryPollInterval)
+	}
+}
+
 // truncateID truncates long IDs for display.
 func truncateID(id string) string {
 	if len(id) <= 16 {
@@ -1,8 +1,10 @@
 package command
 
 import (
+	"encoding/json"
 	"flag"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -30,7 +32,7 @@ func TestSessionCommand_Structure(t *testing.T) {
 		subNames[sub.Name] = true
 	}
 
-	requiredSubs := []string{"list", "get", "create", "renew", "revoke", "revoke-all"}
+	requiredSubs := []string{"list", "get", "create", "renew", "revoke", "revoke-all", "revoke-query", "export", "import"}
 	for _, name := range requiredSubs {
 		if !subNames[name] {
 			t.Errorf("missing subcommand: %s", name)
@@ -233,6 +235,51 @@ func TestSessionList_WithFilters(t *testing.T) {
 	}
 }
 
+func TestSessionList_CursorAndFilters(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	var received url.Values
+	server.handle("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Query()
+		jsonResponse(w, http.StatusOK, map[string]any{
+			"items":       []sessionResponse{sampleSession()},
+			"total":       -1,
+			"next_cursor": "abc",
+		})
+	})
+
+	ctx := makeTestContext(server, map[string]any{
+		"output":          "json",
+		"device-prefix":   "ios-",
+		"created-by":      "key-1",
+		"expiring-within": 10 * time.Minute,
+		"cursor":          "prev",
+		"limit":           5,
+		"page":            3,
+	}, nil)
+
+	if err := sessionList(ctx); err != nil {
+		t.Fatalf("sessionList() error = %v", err)
+	}
+
+	want := map[string]string{
+		"device_id_prefix":       "ios-",
+		"created_by":             "key-1",
+		"expires_within_seconds": "600",
+		"cursor":                 "prev",
+		"limit":                  "5",
+	}
+	for k, v := range want {
+		if got := received.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if received.Has("page") {
+		t.Error("page must not be sent in cursor mode")
+	}
+}
+
 func TestSessionList_ServerError(t *testing.T) {
 	server := newMockServer()
 	defer server.Close()
@@ -413,6 +460,88 @@ func TestSessionRevoke_MissingID(t *testing.T) {
 	}
 }
 
+func TestSessionRevokeQuery_WaitForJob(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	revokeQueryPollInterval = time.Millisecond
+	defer func() { revokeQueryPollInterval = time.Second }()
+
+	server.handle("/sessions/revoke:query", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["created_by"] != "tmak-bad" || body["ip"] != "10.0.0.0/8" || body["reason"] != "leak" {
+			t.Errorf("unexpected body: %v", body)
+		}
+		if data, _ := body["data"].(map[string]any); data["tenant"] != "acme" {
+			t.Errorf("unexpected data: %v", body["data"])
+		}
+		if body["dry_run"] == true {
+			t.Error("--force must skip the dry run")
+		}
+		jsonResponse(w, http.StatusAccepted, map[string]any{"matched": 5000, "job_id": "tmjb-1"})
+	})
+
+	polls := 0
+	server.handle("/admin/v1/jobs/tmjb-1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		state := "running"
+		if polls > 1 {
+			state = "succeeded"
+		}
+		jsonResponse(w, http.StatusOK, map[string]any{"state": state, "total": 5000, "done": 2500 * polls})
+	})
+
+	ctx := makeTestContext(server, map[string]any{
+		"created-by": "tmak-bad",
+		"ip":         "10.0.0.0/8",
+		"data":       []string{"tenant=acme"},
+		"reason":     "leak",
+		"force":      true,
+		"wait":       true,
+	}, nil)
+
+	if err := sessionRevokeQuery(ctx); err != nil {
+		t.Fatalf("sessionRevokeQuery() error = %v", err)
+	}
+	if polls != 2 {
+		t.Errorf("polls = %d, want 2", polls)
+	}
+}
+
+func TestSessionRevokeQuery_DryRun(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/sessions/revoke:query", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["dry_run"] != true {
+			t.Error("expected dry_run")
+		}
+		jsonResponse(w, http.StatusOK, map[string]any{"matched": 3, "dry_run": true})
+	})
+
+	ctx := makeTestContext(server, map[string]any{
+		"device-id": "ios-1",
+		"dry-run":   true,
+	}, nil)
+
+	if err := sessionRevokeQuery(ctx); err != nil {
+		t.Errorf("sessionRevokeQuery() error = %v", err)
+	}
+}
+
+func TestSessionRevokeQuery_MissingCriteria(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	ctx := makeTestContext(server, map[string]any{"reason": "cleanup", "force": true}, nil)
+	if err := sessionRevokeQuery(ctx); err == nil {
+		t.Error("sessionRevokeQuery() expected error without criteria")
+	}
+}
+
 func TestSessionRevokeAll_WithForce(t *testing.T) {
 	server := newMockServer()
 	defer server.Close()
@@ -0,0 +1,549 @@
+// Package command provides CLI command definitions for tokmesh-cli.
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
+)
+
+// Session transfer formats.
+const (
+	transferFormatJSONL = "jsonl"
+	transferFormatCSV   = "csv"
+)
+
+// maxTransferLineBytes bounds a single JSONL record (matches the server).
+const maxTransferLineBytes = 1 << 20
+
+// sessionCSVHeader lists the CSV columns. Timestamps are RFC 3339 and data
+// is a JSON object.
+var sessionCSVHeader = []string{
+	"id", "user_id", "token_hash", "device_id",
+	"ip_address", "user_agent", "last_access_ip", "last_access_ua",
+	"created_by", "created_at", "expires_at", "last_active", "data",
+}
+
+// sessionRecord is the portable session record exchanged by export and
+// import. It mirrors the server's session encoding; timestamps are Unix
+// milliseconds.
+type sessionRecord struct {
+	ID           string            `json:"id"`
+	UserID       string            `json:"user_id"`
+	TokenHash    string            `json:"token_hash"`
+	IPAddress    string            `json:"ip_address,omitempty"`
+	UserAgent    string            `json:"user_agent,omitempty"`
+	LastAccessIP string            `json:"last_access_ip,omitempty"`
+	LastAccessUA string            `json:"last_access_ua,omitempty"`
+	DeviceID     string            `json:"device_id,omitempty"`
+	CreatedBy    string            `json:"created_by,omitempty"`
+	CreatedAt    int64             `json:"created_at"`
+	ExpiresAt    int64             `json:"expires_at"`
+	LastActive   int64             `json:"last_active"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+// csvRow encodes the record in sessionCSVHeader column order.
+func (r *sessionRecord) csvRow() []string {
+	data := ""
+	if len(r.Data) > 0 {
+		b, _ := json.Marshal(r.Data)
+		data = string(b)
+	}
+	return []string{
+		r.ID, r.UserID, r.TokenHash, r.DeviceID,
+		r.IPAddress, r.UserAgent, r.LastAccessIP, r.LastAccessUA,
+		r.CreatedBy, formatRecordTime(r.CreatedAt), formatRecordTime(r.ExpiresAt), formatRecordTime(r.LastActive), data,
+	}
+}
+
+// parseCSVRecord decodes a CSV row. Columns are looked up by header name,
+// so their order and any extra columns do not matter.
+func parseCSVRecord(columns map[string]int, row []string) (*sessionRecord, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	r := &sessionRecord{
+		ID:           get("id"),
+		UserID:       get("user_id"),
+		TokenHash:    get("token_hash"),
+		DeviceID:     get("device_id"),
+		IPAddress:    get("ip_address"),
+		UserAgent:    get("user_agent"),
+		LastAccessIP: get("last_access_ip"),
+		LastAccessUA: get("last_access_ua"),
+		CreatedBy:    get("created_by"),
+	}
+
+	var err error
+	if r.CreatedAt, err = parseRecordTime(get("created_at")); err != nil {
+		return nil, fmt.Errorf("created_at: %w", err)
+	}
+	if r.ExpiresAt, err = parseRecordTime(get("expires_at")); err != nil {
+		return nil, fmt.Errorf("expires_at: %w", err)
+	}
+	if r.LastActive, err = parseRecordTime(get("last_active")); err != nil {
+		return nil, fmt.Errorf("last_active: %w", err)
+	}
+	if data := get("data"); data != "" {
+		if err := json.Unmarshal([]byte(data), &r.Data); err != nil {
+			return nil, fmt.Errorf("data: must be a JSON object of strings")
+		}
+	}
+	return r, nil
+}
+
+// formatRecordTime formats Unix milliseconds as RFC 3339 (empty for zero).
+func formatRecordTime(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// parseRecordTime accepts RFC 3339 or Unix milliseconds (empty is zero).
+func parseRecordTime(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return t.UnixMilli(), nil
+}
+
+// transferFormat resolves --format, defaulting from the file extension.
+func transferFormat(format, file string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			return transferFormatCSV, nil
+		}
+		return transferFormatJSONL, nil
+	}
+	switch format = strings.ToLower(format); format {
+	case transferFormatJSONL, transferFormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid --format %q: expected jsonl or csv", format)
+	}
+}
+
+func sessionExport(c *cli.Context) error {
+	file := c.String("file")
+	format, err := transferFormat(c.String("format"), file)
+	if err != nil {
+		return err
+	}
+	params, err := sessionFilterParams(c)
+	if err != nil {
+		return err
+	}
+
+	client, err := EnsureConnected(c)
+	if err != nil {
+		return err
+	}
+
+	// Exports may run long; bound them by Ctrl-C rather than a timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	path := "/admin/v1/sessions/export"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := client.GetStream(ctx, path)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return connection.ParseResponse(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	if file != "" && file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	count, err := writeSessionRecords(w, resp.Body, format)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return fmt.Errorf("export failed after %d sessions: %w", count, err)
+	}
+
+	// Report on stderr so stdout stays a clean export.
+	fmt.Fprintf(os.Stderr, "Exported %d sessions.\n", count)
+	return nil
+}
+
+// writeSessionRecords converts the server's JSONL export stream to format.
+// Returns the number of records written.
+func writeSessionRecords(w io.Writer, r io.Reader, format string) (int, error) {
+	var csvw *csv.Writer
+	if format == transferFormatCSV {
+		csvw = csv.NewWriter(w)
+		if err := csvw.Write(sessionCSVHeader); err != nil {
+			return 0, err
+		}
+		defer csvw.Flush()
+	}
+
+	br := bufio.NewReader(r)
+	count := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// The server terminates every record; a partial line means
+				// the stream was cut off.
+				return count, errors.New("export stream truncated")
+			}
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if csvw == nil {
+			if _, err := w.Write(line); err != nil {
+				return count, err
+			}
+		} else {
+			var record sessionRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return count, fmt.Errorf("decode record: %w", err)
+			}
+			if err := csvw.Write(record.csvRow()); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+}
+
+// sessionRecordReader yields import records as single-line JSON together
+// with their line number in the source file.
+type sessionRecordReader interface {
+	Next() (line int, record []byte, err error)
+}
+
+// jsonlRecordReader reads JSONL input, passing records through unchanged.
+type jsonlRecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLRecordReader(r io.Reader) *jsonlRecordReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxTransferLineBytes)
+	return &jsonlRecordReader{scanner: scanner}
+}
+
+func (r *jsonlRecordReader) Next() (int, []byte, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if text := bytes.TrimSpace(r.scanner.Bytes()); len(text) > 0 {
+			return r.line, append([]byte(nil), text...), nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return r.line, nil, fmt.Errorf("line %d: %w", r.line+1, err)
+	}
+	return r.line, nil, io.EOF
+}
+
+// csvRecordReader reads CSV input with a header row and converts each row
+// to JSON.
+type csvRecordReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVRecordReader(r io.Reader) (*csvRecordReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"id", "token_hash", "expires_at"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing column %q", required)
+		}
+	}
+	return &csvRecordReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvRecordReader) Next() (int, []byte, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	record, err := parseCSVRecord(r.columns, row)
+	if err != nil {
+		return line, nil, fmt.Errorf("line %d: %w", line, err)
+	}
+	data, err := json.Marshal(record)
+	return line, data, err
+}
+
+// countingReader counts bytes read, for progress reporting.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// importResult mirrors the server's import response.
+type importResult struct {
+	Total    int `json:"total"`
+	Imported int `json:"imported"`
+	Existing int `json:"existing"`
+	Expired  int `json:"expired"`
+	Failed   int `json:"failed"`
+	Errors   []struct {
+		Line      int    `json:"line"`
+		SessionID string `json:"session_id"`
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+	} `json:"errors"`
+}
+
+func sessionImport(c *cli.Context) error {
+	file := c.Args().First()
+	if file == "" {
+		return fmt.Errorf("input file required")
+	}
+	format, err := transferFormat(c.String("format"), file)
+	if err != nil {
+		return err
+	}
+	batchSize := c.Int("batch-size")
+	if batchSize <= 0 || batchSize > 1000 {
+		return fmt.Errorf("invalid --batch-size %d: must be 1-1000", batchSize)
+	}
+	dryRun := c.Bool("dry-run")
+	stateFile := c.String("state-file")
+	if stateFile == "" {
+		stateFile = file + ".import-state"
+	}
+
+	// Records before the saved offset were acknowledged by a previous run.
+	skip := 0
+	if c.Bool("resume") && !dryRun {
+		if skip, err = readImportState(stateFile); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("open input file: %w", err)
+	}
+	defer f.Close()
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	counter := &countingReader{r: f}
+	var records sessionRecordReader
+	if format == transferFormatCSV {
+		if records, err = newCSVRecordReader(counter); err != nil {
+			return err
+		}
+	} else {
+		records = newJSONLRecordReader(counter)
+	}
+
+	client, err := EnsureConnected(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	path := "/admin/v1/sessions/import"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+
+	var (
+		total   importResult
+		batch   bytes.Buffer
+		lines   []int
+		done    int
+		sent    int
+		title   = "Importing"
+		failure []string
+	)
+	if dryRun {
+		title = "Validating"
+	}
+	progress := output.NewProgressBar(os.Stderr, title)
+
+	send := func() error {
+		resp, err := client.PostStream(ctx, path, "application/x-ndjson", bytes.NewReader(batch.Bytes()))
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		var result importResult
+		if err := connection.ParseResponse(resp, &result); err != nil {
+			return err
+		}
+
+		total.Total += result.Total
+		total.Imported += result.Imported
+		total.Existing += result.Existing
+		total.Expired += result.Expired
+		total.Failed += result.Failed
+		for _, e := range result.Errors {
+			// The server numbers lines within this request.
+			line := e.Line
+			if e.Line >= 1 && e.Line <= len(lines) {
+				line = lines[e.Line-1]
+			}
+			failure = append(failure, fmt.Sprintf("  line %d: [%s] %s", line, e.Code, e.Message))
+		}
+
+		sent = done
+		if !dryRun {
+			if err := writeImportState(stateFile, sent); err != nil {
+				return err
+			}
+		}
+		batch.Reset()
+		lines = lines[:0]
+		progress.Update(counter.n, size)
+		return nil
+	}
+
+	for {
+		line, record, err := records.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read %s (imported through record %d): %w", file, sent, err)
+		}
+		done++
+		if done <= skip {
+			continue
+		}
+
+		batch.Write(record)
+		batch.WriteByte('\n')
+		lines = append(lines, line)
+		if len(lines) >= batchSize {
+			if err := send(); err != nil {
+				return fmt.Errorf("import interrupted after %d records (re-run with --resume): %w", sent, err)
+			}
+		}
+	}
+	if len(lines) > 0 {
+		if err := send(); err != nil {
+			return fmt.Errorf("import interrupted after %d records (re-run with --resume): %w", sent, err)
+		}
+	}
+	progress.Finish()
+
+	if !dryRun {
+		_ = os.Remove(stateFile)
+	}
+
+	prefix := ""
+	if dryRun {
+		prefix = "Dry run: "
+	}
+	if skip > 0 {
+		fmt.Printf("Resumed after %d records.\n", min(skip, done))
+	}
+	fmt.Printf("%s%d records: %d imported, %d existing, %d expired, %d failed.\n",
+		prefix, total.Total, total.Imported, total.Existing, total.Expired, total.Failed)
+	for _, msg := range failure {
+		fmt.Println(msg)
+	}
+	if total.Failed > len(failure) {
+		fmt.Printf("  ... and %d more\n", total.Failed-len(failure))
+	}
+
+	if total.Failed > 0 {
+		return fmt.Errorf("%d records failed", total.Failed)
+	}
+	return nil
+}
+
+// readImportState returns the number of records acknowledged by a previous
+// import run, or 0 if there is no state file.
+func readImportState(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read state file: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid state file %s", path)
+	}
+	return n, nil
+}
+
+// writeImportState records the number of acknowledged records.
+func writeImportState(path string, n int) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(n)+"\n"), 0600); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+	return nil
+}
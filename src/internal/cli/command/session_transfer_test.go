@@ -0,0 +1,230 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testExportStream = `{"id":"tmss-01","user_id":"u1","token_hash":"tmth-aa","created_at":1700000000000,"expires_at":1900000000000,"last_active":1700000000000,"data":{"tenant":"acme"}}
+{"id":"tmss-02","user_id":"u2","token_hash":"tmth-bb","device_id":"ios-1","created_at":1700000000001,"expires_at":1900000000000,"last_active":1700000000001}
+`
+
+func TestTransferFormat(t *testing.T) {
+	tests := []struct {
+		format, file, want string
+		wantErr            bool
+	}{
+		{"", "out.csv", transferFormatCSV, false},
+		{"", "out.jsonl", transferFormatJSONL, false},
+		{"", "", transferFormatJSONL, false},
+		{"CSV", "out.jsonl", transferFormatCSV, false},
+		{"xml", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := transferFormat(tt.format, tt.file)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("transferFormat(%q, %q) = %q, %v", tt.format, tt.file, got, err)
+		}
+	}
+}
+
+func TestParseRecordTime(t *testing.T) {
+	for _, s := range []string{"1700000000000", "2023-11-14T22:13:20.000Z"} {
+		ms, err := parseRecordTime(s)
+		if err != nil || ms != 1700000000000 {
+			t.Errorf("parseRecordTime(%q) = %d, %v", s, ms, err)
+		}
+	}
+	if _, err := parseRecordTime("yesterday"); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+}
+
+func TestSessionExport_CSV(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/admin/v1/sessions/export", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("user_id"); got != "u1" {
+			t.Errorf("user_id = %q, want u1", got)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(testExportStream))
+	})
+
+	out := filepath.Join(t.TempDir(), "sessions.csv")
+	ctx := makeTestContext(server, map[string]any{
+		"file":    out,
+		"format":  "",
+		"user-id": "u1",
+	}, nil)
+
+	if err := sessionExport(ctx); err != nil {
+		t.Fatalf("sessionExport failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d lines", len(lines))
+	}
+	if lines[0] != strings.Join(sessionCSVHeader, ",") {
+		t.Errorf("header = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "2023-11-14T22:13:20.000Z") || !strings.Contains(lines[1], `"{""tenant"":""acme""}"`) {
+		t.Errorf("row 1 = %q", lines[1])
+	}
+}
+
+func TestSessionExport_Truncated(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/admin/v1/sessions/export", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"tmss-01"}` + "\n" + `{"id":"tm`))
+	})
+
+	ctx := makeTestContext(server, map[string]any{
+		"file": filepath.Join(t.TempDir(), "out.jsonl"),
+	}, nil)
+
+	if err := sessionExport(ctx); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("expected truncation error, got %v", err)
+	}
+}
+
+func TestSessionImport_Resume(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	var received []string
+	requests := 0
+	server.handle("/admin/v1/sessions/import", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("dry_run") != "" {
+			t.Error("unexpected dry_run")
+		}
+		scanner := bufio.NewScanner(r.Body)
+		n := 0
+		for scanner.Scan() {
+			var record sessionRecord
+			json.Unmarshal(scanner.Bytes(), &record)
+			received = append(received, record.ID)
+			n++
+		}
+		jsonResponse(w, http.StatusOK, map[string]any{"total": n, "imported": n})
+	})
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sessions.jsonl")
+	var content strings.Builder
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		content.WriteString(`{"id":"tmss-` + id + `"}` + "\n\n")
+	}
+	os.WriteFile(file, []byte(content.String()), 0600)
+
+	stateFile := file + ".import-state"
+	os.WriteFile(stateFile, []byte("2\n"), 0600)
+
+	ctx := makeTestContext(server, map[string]any{
+		"batch-size": 2,
+		"resume":     true,
+	}, []string{file})
+
+	if err := sessionImport(ctx); err != nil {
+		t.Fatalf("sessionImport failed: %v", err)
+	}
+
+	if strings.Join(received, ",") != "tmss-c,tmss-d,tmss-e" {
+		t.Errorf("received = %v, want records after the saved offset", received)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Error("state file should be removed after a completed import")
+	}
+}
+
+func TestSessionImport_CSVDryRun(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/admin/v1/sessions/import", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dry_run") != "true" {
+			t.Error("expected dry_run=true")
+		}
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Scan()
+		var record sessionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record: %v", err)
+		}
+		if record.ExpiresAt != 1700000000000 || record.Data["tenant"] != "acme" {
+			t.Errorf("record = %+v", record)
+		}
+		jsonResponse(w, http.StatusOK, map[string]any{
+			"total":    2,
+			"imported": 1,
+			"failed":   1,
+			"errors": []map[string]any{
+				{"line": 2, "code": "TM-TOKN-4000", "message": "invalid token_hash format"},
+			},
+		})
+	})
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sessions.csv")
+	os.WriteFile(file, []byte("id,token_hash,expires_at,data\n"+
+		`tmss-a,tmth-aa,2023-11-14T22:13:20Z,"{""tenant"":""acme""}"`+"\n"+
+		"tmss-b,bad,1700000000000,\n"), 0600)
+
+	ctx := makeTestContext(server, map[string]any{
+		"batch-size": 500,
+		"dry-run":    true,
+	}, []string{file})
+
+	err := sessionImport(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 records failed") {
+		t.Errorf("expected failure count error, got %v", err)
+	}
+	if _, err := os.Stat(file + ".import-state"); !os.IsNotExist(err) {
+		t.Error("dry run must not write a state file")
+	}
+}
+
+func TestSessionImport_Errors(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	t.Run("missing file argument", func(t *testing.T) {
+		ctx := makeTestContext(server, map[string]any{"batch-size": 500}, nil)
+		if err := sessionImport(ctx); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("invalid batch size", func(t *testing.T) {
+		ctx := makeTestContext(server, map[string]any{"batch-size": 5000}, []string{"x.jsonl"})
+		if err := sessionImport(ctx); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("CSV missing required column", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "bad.csv")
+		os.WriteFile(file, []byte("id,user_id\n"), 0600)
+		ctx := makeTestContext(server, map[string]any{"batch-size": 500}, []string{file})
+		if err := sessionImport(ctx); err == nil || !strings.Contains(err.Error(), "token_hash") {
+			t.Errorf("expected missing column error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+// Package command provides CLI command definitions for tokmesh-cli.
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
+	"github.com/yndnr/tokmesh-go/internal/cli/repl"
+)
+
+// shellRunning is set while the interactive shell runs, so "shell" typed
+// inside it does not start a nested one.
+var shellRunning bool
+
+// ShellCommand returns the shell command, which starts interactive mode.
+//
+// @design DS-0602
+func ShellCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "shell",
+		Usage:  "Start an interactive shell (default when run on a terminal without a command)",
+		Action: shellAction,
+	}
+}
+
+// rootAction runs when no command is given: on a terminal it starts the
+// shell, otherwise it shows help like the default action.
+func rootAction(c *cli.Context) error {
+	if c.NArg() == 0 && repl.IsTerminal() {
+		return shellAction(c)
+	}
+	if c.NArg() > 0 {
+		return cli.ShowCommandHelp(c, c.Args().First())
+	}
+	return cli.ShowAppHelp(c)
+}
+
+func shellAction(c *cli.Context) error {
+	if shellRunning {
+		return fmt.Errorf("already in the interactive shell")
+	}
+	shellRunning = true
+	defer func() { shellRunning = false }()
+
+	flags := ParseGlobalFlags(c)
+	opts := []repl.Option{
+		repl.WithExecutor(runShellCommand),
+		repl.WithOutput(output.Format(flags.Output)),
+		repl.WithCommands(CommandSpecs(c.App)),
+	}
+	if c.IsSet("config") {
+		opts = append(opts, repl.WithConfigPath(flags.Config))
+	}
+	// An explicit profile or connection flags take precedence over the
+	// default profile.
+	if c.IsSet("profile") || c.IsSet("server") || c.IsSet("api-key-id") || c.IsSet("api-key") {
+		conn, err := ResolveConnection(c)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, repl.WithConnection(conn))
+	}
+
+	fmt.Printf("tokmesh-cli %s interactive shell. Type \\help for shell commands, help for CLI commands.\n", Version)
+	return repl.New(opts...).Run()
+}
+
+// runShellCommand runs one command line of the shell on a fresh App.
+func runShellCommand(args []string) error {
+	app := App()
+	// A failing command must not exit the shell.
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	return app.Run(append([]string{app.Name}, args...))
+}
+
+// CommandSpecs describes the app's command tree for shell completion.
+func CommandSpecs(app *cli.App) []repl.CommandSpec {
+	specs := []repl.CommandSpec{{Flags: flagNames(app.Flags)}}
+
+	var walk func(prefix string, cmds []*cli.Command)
+	walk = func(prefix string, cmds []*cli.Command) {
+		for _, cmd := range cmds {
+			if cmd.Hidden || cmd.Name == "shell" || cmd.Name == "help" {
+				continue
+			}
+			path := strings.TrimSpace(prefix + " " + cmd.Name)
+			specs = append(specs, repl.CommandSpec{
+				Path:  path,
+				Arg:   repl.ArgKindFor(cmd.ArgsUsage),
+				Flags: flagNames(cmd.Flags),
+			})
+			walk(path, cmd.Subcommands)
+		}
+	}
+	walk("", app.Commands)
+	return specs
+}
+
+// flagNames returns the flags' names with their dashes.
+func flagNames(flags []cli.Flag) []string {
+	var names []string
+	for _, f := range flags {
+		for _, n := range f.Names() {
+			if len(n) == 1 {
+				names = append(names, "-"+n)
+			} else {
+				names = append(names, "--"+n)
+			}
+		}
+	}
+	return names
+}
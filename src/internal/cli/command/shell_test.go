@@ -0,0 +1,73 @@
+package command
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/repl"
+)
+
+func TestCommandSpecs(t *testing.T) {
+	specs := CommandSpecs(App())
+
+	byPath := make(map[string]repl.CommandSpec)
+	for _, spec := range specs {
+		byPath[spec.Path] = spec
+	}
+
+	tests := []struct {
+		path string
+		arg  repl.ArgKind
+		flag string
+	}{
+		{"", repl.ArgNone, "--output"},
+		{"session get", repl.ArgSessionID, ""},
+		{"session revoke", repl.ArgSessionID, "--force"},
+		{"apikey rotate", repl.ArgAPIKeyID, ""},
+		{"session list", repl.ArgNone, "--user-id"},
+		{"config server show", repl.ArgNone, "--merged"},
+	}
+	for _, tt := range tests {
+		spec, ok := byPath[tt.path]
+		if !ok {
+			t.Errorf("no spec for %q", tt.path)
+			continue
+		}
+		if spec.Arg != tt.arg {
+			t.Errorf("%q Arg = %d, want %d", tt.path, spec.Arg, tt.arg)
+		}
+		if tt.flag != "" && !containsString(spec.Flags, tt.flag) {
+			t.Errorf("%q Flags = %v, missing %q", tt.path, spec.Flags, tt.flag)
+		}
+	}
+	if _, ok := byPath["shell"]; ok {
+		t.Error("shell should not be offered inside the shell")
+	}
+}
+
+func TestRunShellCommand(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/health", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "healthy"})
+	})
+
+	if err := runShellCommand([]string{"--output", "json", "--server", server.URL, "system", "health"}); err != nil {
+		t.Errorf("runShellCommand(system health) error = %v", err)
+	}
+
+	// Errors are returned to the shell rather than exiting the process.
+	if err := runShellCommand([]string{"--server", server.URL, "session", "get"}); err == nil {
+		t.Error("runShellCommand(session get) without ID should fail")
+	}
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -41,6 +41,21 @@ func SystemCommand() *cli.Command {
 				},
 				Action: systemGC,
 			},
+			{
+				Name:  "pitr",
+				Usage: "Recover the sessions as they were at a time or WAL offset into a new data directory or snapshot on the server",
+				Flags: append(pitrFlags(),
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: "Reason recorded in the audit log",
+					},
+					&cli.BoolFlag{
+						Name:  "wait",
+						Usage: "Wait for the recovery job to finish",
+					},
+				),
+				Action: systemPITR,
+			},
 		},
 	}
 }
@@ -180,3 +195,49 @@ func systemGC(c *cli.Context) error {
 		return nil
 	}
 }
+
+func systemPITR(c *cli.Context) error {
+	if _, err := parseRecoveryTarget(c); err != nil {
+		return err
+	}
+	client, err := EnsureConnected(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	body := map[string]any{
+		"target_time":         c.String("to-time"),
+		"target_offset":       c.String("to-offset"),
+		"output_data_dir":     c.String("output-data-dir"),
+		"output_snapshot_dir": c.String("output-snapshot-dir"),
+		"reason":              c.String("reason"),
+	}
+	resp, err := client.Post(ctx, "/admin/v1/backups/pitr", body)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	var result struct {
+		JobID string `json:"job_id"`
+	}
+	if err := connection.ParseResponse(resp, &result); err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) == output.FormatJSON {
+		formatter := &output.JSONFormatter{}
+		if err := formatter.Format(os.Stdout, result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Point-in-time recovery started: job %s\n", result.JobID)
+	}
+	if !c.Bool("wait") {
+		return nil
+	}
+	return waitForJob(client, result.JobID)
+}
@@ -1,8 +1,10 @@
 package command
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -27,7 +29,7 @@ func TestSystemCommand(t *testing.T) {
 		subNames[sub.Name] = true
 	}
 
-	requiredSubs := []string{"status", "health", "gc"}
+	requiredSubs := []string{"status", "health", "gc", "pitr"}
 	for _, name := range requiredSubs {
 		if !subNames[name] {
 			t.Errorf("missing subcommand: %s", name)
@@ -301,3 +303,47 @@ func TestSystemGC_ServerError(t *testing.T) {
 		t.Error("systemGC() expected error for server error")
 	}
 }
+
+func TestSystemPITR_WaitForJob(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	revokeQueryPollInterval = time.Millisecond
+	defer func() { revokeQueryPollInterval = time.Second }()
+
+	server.handle("/admin/v1/backups/pitr", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["target_time"] != "2026-01-02T03:04:05Z" || body["output_data_dir"] != "/var/lib/restored" || body["reason"] != "undo revoke" {
+			t.Errorf("unexpected body: %v", body)
+		}
+		jsonResponse(w, http.StatusAccepted, map[string]any{"job_id": "tmjb-1"})
+	})
+	server.handle("/admin/v1/jobs/tmjb-1", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]any{"state": "succeeded", "done": 10})
+	})
+
+	ctx := makeTestContext(server, map[string]any{
+		"to-time":         "2026-01-02T03:04:05Z",
+		"output-data-dir": "/var/lib/restored",
+		"reason":          "undo revoke",
+		"wait":            true,
+	}, nil)
+
+	if err := systemPITR(ctx); err != nil {
+		t.Fatalf("systemPITR() error = %v", err)
+	}
+}
+
+func TestSystemPITR_InvalidTarget(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	ctx := makeTestContext(server, map[string]any{
+		"to-time":         "yesterday",
+		"output-data-dir": "/var/lib/restored",
+	}, nil)
+	if err := systemPITR(ctx); err == nil {
+		t.Error("systemPITR() expected error for invalid --to-time")
+	}
+}
@@ -0,0 +1,593 @@
+// Package command provides CLI command definitions for tokmesh-cli.
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
+)
+
+// Metrics read by top, as exported by tokmesh-server.
+const (
+	metricHTTPRequests  = "tokmesh_http_requests_total"
+	metricHTTPDuration  = "tokmesh_http_request_duration_seconds"
+	metricSessions      = "tokmesh_sessions_active"
+	metricWALSize       = "tokmesh_wal_size_bytes"
+	metricWALFsync      = "tokmesh_wal_fsync_duration_seconds"
+	metricLastSnapshot  = "tokmesh_snapshot_last_timestamp_seconds"
+	metricClusterShards = "tokmesh_cluster_node_shards"
+
+	// validateEndpoint is the endpoint label of token validation.
+	validateEndpoint = "POST /tokens/validate"
+)
+
+const (
+	defaultTopInterval   = 2 * time.Second
+	topRequestTimeout    = 10 * time.Second
+	topMaxEndpointsShown = 15
+
+	// clearScreen moves the cursor home and clears the terminal.
+	clearScreen = "\033[H\033[2J"
+)
+
+// TopCommand returns the top command, a continuously refreshing
+// dashboard of server and cluster metrics.
+//
+// @design DS-0601
+func TopCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "top",
+		Aliases: []string{"watch"},
+		Usage:   "Show a live dashboard of server and cluster metrics",
+		Description: "Polls the admin status and metrics of the server, over HTTP or the\n" +
+			"local management socket (--socket), and shows request rates and\n" +
+			"latency by endpoint, sessions, WAL size and fsync latency, snapshot\n" +
+			"age and the shards of every cluster node.",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "interval",
+				Value: defaultTopInterval,
+				Usage: "Refresh interval",
+			},
+			&cli.StringFlag{
+				Name:  "socket",
+				Usage: "Read from the local management socket at this path instead of HTTP",
+			},
+			&cli.IntFlag{
+				Name:  "iterations",
+				Usage: "Stop after this many refreshes (0: until interrupted)",
+			},
+		},
+		Action: topAction,
+	}
+}
+
+func topAction(c *cli.Context) error {
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	var src topSource
+	if path := c.String("socket"); path != "" {
+		src = &socketTopSource{path: path, client: connection.NewSocketClient(path)}
+	} else {
+		conn, err := ResolveConnection(c)
+		if err != nil {
+			return err
+		}
+		if conn.Socket != "" {
+			src = &socketTopSource{path: conn.Socket, client: connection.NewSocketClient(conn.Socket)}
+		} else {
+			client, err := conn.HTTPClient()
+			if err != nil {
+				return err
+			}
+			src = &httpTopSource{client: client}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	redraw := readline.IsTerminal(int(os.Stdout.Fd()))
+	return runTop(ctx, os.Stdout, src, interval, c.Int("iterations"), redraw)
+}
+
+// runTop samples src every interval and renders the dashboard until ctx
+// is done or iterations (if positive) refreshes were shown. With redraw
+// each refresh replaces the previous one on the terminal.
+func runTop(ctx context.Context, w io.Writer, src topSource, interval time.Duration, iterations int, redraw bool) error {
+	var prev *topSample
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for n := 1; ; n++ {
+		cur, err := takeTopSample(ctx, src)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if redraw {
+			fmt.Fprint(w, clearScreen)
+		}
+		renderTop(w, src.Target(), interval, prev, cur)
+		prev = cur
+
+		if iterations > 0 && n >= iterations {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// topSource provides the server status and metrics.
+type topSource interface {
+	// Target describes the server, e.g. its URL.
+	Target() string
+	Status(ctx context.Context) (map[string]any, error)
+	Metrics(ctx context.Context) (map[string]*dto.MetricFamily, error)
+}
+
+// httpTopSource reads GET /admin/v1/status/summary and GET /metrics.
+type httpTopSource struct {
+	client *connection.HTTPClient
+}
+
+func (s *httpTopSource) Target() string { return s.client.BaseURL() }
+
+func (s *httpTopSource) Status(ctx context.Context) (map[string]any, error) {
+	resp, err := s.client.Get(ctx, "/admin/v1/status/summary")
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	var result map[string]any
+	if err := connection.ParseResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	// The server wraps results in a response envelope.
+	if data, ok := result["data"].(map[string]any); ok {
+		return data, nil
+	}
+	return result, nil
+}
+
+func (s *httpTopSource) Metrics(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	resp, err := s.client.Get(ctx, "/metrics")
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics request failed with status %d", resp.StatusCode)
+	}
+	return parseMetrics(resp.Body)
+}
+
+// socketTopSource runs the "status" and "metrics" commands of the local
+// management socket.
+type socketTopSource struct {
+	path   string
+	client *connection.SocketClient
+}
+
+func (s *socketTopSource) Target() string { return "unix://" + s.path }
+
+func (s *socketTopSource) Status(ctx context.Context) (map[string]any, error) {
+	data, err := s.client.Query("status", topRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("socket request failed: %w", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("parse status: %s", strings.TrimSpace(string(data)))
+	}
+	return result, nil
+}
+
+func (s *socketTopSource) Metrics(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	data, err := s.client.Query("metrics", topRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("socket request failed: %w", err)
+	}
+	families, err := parseMetrics(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse metrics: %s", strings.TrimSpace(string(data)))
+	}
+	return families, nil
+}
+
+// parseMetrics parses metrics in Prometheus text format.
+func parseMetrics(r io.Reader) (map[string]*dto.MetricFamily, error) {
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	return parser.TextToMetricFamilies(r)
+}
+
+// topSample is one poll of the server.
+type topSample struct {
+	at       time.Time
+	status   map[string]any
+	families map[string]*dto.MetricFamily
+}
+
+func takeTopSample(ctx context.Context, src topSource) (*topSample, error) {
+	ctx, cancel := context.WithTimeout(ctx, topRequestTimeout)
+	defer cancel()
+
+	status, err := src.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	families, err := src.Metrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &topSample{at: time.Now(), status: status, families: families}, nil
+}
+
+// renderTop writes the dashboard for cur. Rates and latency percentiles
+// cover the interval since prev; without prev there are no rates and
+// percentiles cover the server's lifetime.
+func renderTop(w io.Writer, target string, interval time.Duration, prev, cur *topSample) {
+	header := []string{"TokMesh top - " + target}
+	if v, ok := cur.status["version"].(string); ok {
+		header = append(header, "version "+v)
+	}
+	if up, ok := cur.status["uptime_seconds"].(float64); ok {
+		header = append(header, "uptime "+(time.Duration(up)*time.Second).String())
+	}
+	header = append(header, "every "+interval.String(), cur.at.Format("15:04:05"))
+	fmt.Fprintln(w, strings.Join(header, " | "))
+	fmt.Fprintln(w)
+
+	var elapsed float64
+	if prev != nil {
+		elapsed = cur.at.Sub(prev.at).Seconds()
+	}
+	endpoints := endpointStats(prev, cur, elapsed)
+
+	// Server
+	summary := &output.Table{Headers: []string{"SERVER", "VALUE"}}
+	if v, ok := gaugeValue(cur.families, metricSessions); ok {
+		summary.AddRow("Active sessions", strconv.FormatFloat(v, 'f', 0, 64))
+	}
+	if prev != nil {
+		var total float64
+		for _, e := range endpoints {
+			total += e.rate
+		}
+		summary.AddRow("Requests/s", formatRate(total))
+	}
+	for _, e := range endpoints {
+		if e.endpoint == validateEndpoint {
+			summary.AddRow("Validate p50 / p99", formatLatency(e.p50)+" / "+formatLatency(e.p99))
+		}
+	}
+	if v, ok := gaugeValue(cur.families, metricWALSize); ok {
+		summary.AddRow("WAL size", output.FormatBytes(int64(v)))
+	}
+	if cur.families[metricWALFsync] != nil {
+		p50, p99 := math.NaN(), math.NaN()
+		if h := histogramDelta(prev, cur, metricWALFsync, nil); h != nil {
+			p50, p99 = h.quantile(0.5), h.quantile(0.99)
+		}
+		summary.AddRow("WAL fsync p50 / p99", formatLatency(p50)+" / "+formatLatency(p99))
+	}
+	if v, ok := gaugeValue(cur.families, metricLastSnapshot); ok {
+		age := "never"
+		if v > 0 {
+			age = cur.at.Sub(time.Unix(0, int64(v*1e9))).Round(time.Second).String()
+		}
+		summary.AddRow("Snapshot age", age)
+	}
+	summary.Render(w)
+	fmt.Fprintln(w)
+
+	// Requests by endpoint
+	requests := &output.Table{Headers: []string{"ENDPOINT", "REQ/S", "ERR/S", "P50", "P99"}}
+	for i, e := range endpoints {
+		if i == topMaxEndpointsShown {
+			break
+		}
+		rate, errRate := "-", "-"
+		if prev != nil {
+			rate, errRate = formatRate(e.rate), formatRate(e.errRate)
+		}
+		requests.AddRow(e.endpoint, rate, errRate, formatLatency(e.p50), formatLatency(e.p99))
+	}
+	if len(requests.Rows) == 0 {
+		fmt.Fprintln(w, "No requests served yet.")
+	} else {
+		requests.Render(w)
+	}
+	fmt.Fprintln(w)
+
+	// Cluster
+	nodes := clusterNodes(cur.families)
+	if len(nodes) == 0 {
+		fmt.Fprintln(w, "Cluster: standalone")
+		fmt.Fprintln(w)
+		return
+	}
+	cluster := &output.Table{Headers: []string{"NODE", "ROLE", "STATE", "PRIMARY", "REPLICA"}}
+	for _, n := range nodes {
+		cluster.AddRow(n.id, n.role, n.state,
+			strconv.FormatFloat(n.primary, 'f', 0, 64), strconv.FormatFloat(n.replica, 'f', 0, 64))
+	}
+	cluster.Render(w)
+	fmt.Fprintln(w)
+}
+
+// endpointStat is the traffic of one HTTP endpoint.
+type endpointStat struct {
+	endpoint string
+	total    float64
+	rate     float64
+	errRate  float64
+	p50, p99 float64
+}
+
+// endpointStats returns the request rate, 5xx rate and latency of every
+// endpoint, busiest first.
+func endpointStats(prev, cur *topSample, elapsed float64) []endpointStat {
+	curCounts, curErrs := requestCounts(cur)
+	var prevCounts, prevErrs map[string]float64
+	if prev != nil {
+		prevCounts, prevErrs = requestCounts(prev)
+	}
+
+	stats := make([]endpointStat, 0, len(curCounts))
+	for endpoint, total := range curCounts {
+		s := endpointStat{endpoint: endpoint, total: total}
+		if elapsed > 0 {
+			s.rate = counterRate(prevCounts[endpoint], total, elapsed)
+			s.errRate = counterRate(prevErrs[endpoint], curErrs[endpoint], elapsed)
+		}
+		if h := histogramDelta(prev, cur, metricHTTPDuration, map[string]string{"endpoint": endpoint}); h != nil {
+			s.p50, s.p99 = h.quantile(0.5), h.quantile(0.99)
+		}
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].rate != stats[j].rate {
+			return stats[i].rate > stats[j].rate
+		}
+		if stats[i].total != stats[j].total {
+			return stats[i].total > stats[j].total
+		}
+		return stats[i].endpoint < stats[j].endpoint
+	})
+	return stats
+}
+
+// requestCounts sums the request counter by endpoint, in total and for
+// 5xx responses.
+func requestCounts(s *topSample) (total, errs map[string]float64) {
+	total = make(map[string]float64)
+	errs = make(map[string]float64)
+	mf := s.families[metricHTTPRequests]
+	if mf == nil {
+		return total, errs
+	}
+	for _, m := range mf.GetMetric() {
+		labels := labelMap(m)
+		v := m.GetCounter().GetValue()
+		total[labels["endpoint"]] += v
+		if strings.HasPrefix(labels["code"], "5") {
+			errs[labels["endpoint"]] += v
+		}
+	}
+	return total, errs
+}
+
+// counterRate returns the per-second increase of a counter, treating a
+// decrease as a server restart.
+func counterRate(prev, cur, elapsed float64) float64 {
+	if cur < prev {
+		prev = 0
+	}
+	return (cur - prev) / elapsed
+}
+
+// gaugeValue returns the sum of a gauge family's values.
+func gaugeValue(families map[string]*dto.MetricFamily, name string) (float64, bool) {
+	mf := families[name]
+	if mf == nil || len(mf.GetMetric()) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, m := range mf.GetMetric() {
+		sum += m.GetGauge().GetValue()
+	}
+	return sum, true
+}
+
+// clusterNode is one row of the cluster table.
+type clusterNode struct {
+	id, role, state  string
+	primary, replica float64
+}
+
+// clusterNodes returns the nodes reported by the cluster shard gauge,
+// ordered by node ID.
+func clusterNodes(families map[string]*dto.MetricFamily) []clusterNode {
+	mf := families[metricClusterShards]
+	if mf == nil {
+		return nil
+	}
+
+	byID := make(map[string]*clusterNode)
+	for _, m := range mf.GetMetric() {
+		labels := labelMap(m)
+		n := byID[labels["node_id"]]
+		if n == nil {
+			n = &clusterNode{id: labels["node_id"], role: labels["role"], state: labels["state"]}
+			byID[n.id] = n
+		}
+		switch labels["kind"] {
+		case "primary":
+			n.primary += m.GetGauge().GetValue()
+		case "replica":
+			n.replica += m.GetGauge().GetValue()
+		}
+	}
+
+	nodes := make([]clusterNode, 0, len(byID))
+	for _, n := range byID {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	return nodes
+}
+
+// labelMap returns a metric's labels by name.
+func labelMap(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	return labels
+}
+
+// histogram holds cumulative bucket counts.
+type histogram struct {
+	bounds []float64 // upper bounds, ascending, without +Inf
+	counts []float64 // cumulative counts per bound
+	total  float64   // including observations above the last bound
+}
+
+// findHistogram returns the histogram of the family's metric matching
+// labels, merging all matches.
+func findHistogram(s *topSample, name string, labels map[string]string) *histogram {
+	mf := s.families[name]
+	if mf == nil {
+		return nil
+	}
+
+	var h *histogram
+	for _, m := range mf.GetMetric() {
+		ml := labelMap(m)
+		match := true
+		for k, v := range labels {
+			if ml[k] != v {
+				match = false
+				break
+			}
+		}
+		if !match || m.GetHistogram() == nil {
+			continue
+		}
+
+		buckets := m.GetHistogram().GetBucket()
+		if h == nil {
+			h = &histogram{bounds: make([]float64, 0, len(buckets)), counts: make([]float64, len(buckets))}
+			for _, b := range buckets {
+				h.bounds = append(h.bounds, b.GetUpperBound())
+			}
+		}
+		if len(buckets) != len(h.bounds) {
+			continue
+		}
+		for i, b := range buckets {
+			h.counts[i] += float64(b.GetCumulativeCount())
+		}
+		h.total += float64(m.GetHistogram().GetSampleCount())
+	}
+	return h
+}
+
+// histogramDelta returns the observations of a histogram between prev
+// and cur, or since the server started without prev or after a restart.
+// It returns nil when there are no observations.
+func histogramDelta(prev, cur *topSample, name string, labels map[string]string) *histogram {
+	h := findHistogram(cur, name, labels)
+	if h == nil {
+		return nil
+	}
+	if prev != nil {
+		if p := findHistogram(prev, name, labels); p != nil && len(p.counts) == len(h.counts) && p.total <= h.total {
+			d := &histogram{bounds: h.bounds, counts: make([]float64, len(h.counts)), total: h.total - p.total}
+			for i := range h.counts {
+				d.counts[i] = h.counts[i] - p.counts[i]
+			}
+			h = d
+		}
+	}
+	if h.total == 0 {
+		return nil
+	}
+	return h
+}
+
+// quantile estimates the q-quantile by linear interpolation within the
+// bucket holding it, like PromQL histogram_quantile. Observations above
+// the last bound are reported as the last bound.
+func (h *histogram) quantile(q float64) float64 {
+	if h.total == 0 || len(h.bounds) == 0 {
+		return math.NaN()
+	}
+	rank := q * h.total
+	lower, below := 0.0, 0.0
+	for i, upper := range h.bounds {
+		if h.counts[i] >= rank {
+			inBucket := h.counts[i] - below
+			if inBucket <= 0 {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-below)/inBucket
+		}
+		lower, below = upper, h.counts[i]
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// formatRate formats a per-second rate.
+func formatRate(v float64) string {
+	if v >= 100 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// formatLatency formats a latency in seconds, or "-" if unknown.
+func formatLatency(sec float64) string {
+	if sec <= 0 || math.IsNaN(sec) {
+		return "-"
+	}
+	d := time.Duration(sec * float64(time.Second))
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
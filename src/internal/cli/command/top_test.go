@@ -0,0 +1,223 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+)
+
+// topMetrics returns server metrics after n validations, each 2ms.
+func topMetrics(n int) string {
+	return fmt.Sprintf(`# TYPE tokmesh_http_requests_total counter
+tokmesh_http_requests_total{code="200",endpoint="POST /tokens/validate"} %d
+tokmesh_http_requests_total{code="500",endpoint="POST /tokens/validate"} 1
+tokmesh_http_requests_total{code="200",endpoint="GET /health"} 3
+# TYPE tokmesh_http_request_duration_seconds histogram
+tokmesh_http_request_duration_seconds_bucket{endpoint="POST /tokens/validate",le="0.001"} 0
+tokmesh_http_request_duration_seconds_bucket{endpoint="POST /tokens/validate",le="0.004"} %d
+tokmesh_http_request_duration_seconds_bucket{endpoint="POST /tokens/validate",le="+Inf"} %d
+tokmesh_http_request_duration_seconds_sum{endpoint="POST /tokens/validate"} 1
+tokmesh_http_request_duration_seconds_count{endpoint="POST /tokens/validate"} %d
+# TYPE tokmesh_sessions_active gauge
+tokmesh_sessions_active 1234
+# TYPE tokmesh_wal_size_bytes gauge
+tokmesh_wal_size_bytes 2097152
+# TYPE tokmesh_wal_fsync_duration_seconds histogram
+tokmesh_wal_fsync_duration_seconds_bucket{le="0.0001"} 5
+tokmesh_wal_fsync_duration_seconds_bucket{le="+Inf"} 5
+tokmesh_wal_fsync_duration_seconds_sum 0.0003
+tokmesh_wal_fsync_duration_seconds_count 5
+# TYPE tokmesh_snapshot_last_timestamp_seconds gauge
+tokmesh_snapshot_last_timestamp_seconds %d
+# TYPE tokmesh_cluster_node_shards gauge
+tokmesh_cluster_node_shards{kind="primary",node_id="node-a",role="leader",state="alive"} 128
+tokmesh_cluster_node_shards{kind="replica",node_id="node-a",role="leader",state="alive"} 64
+tokmesh_cluster_node_shards{kind="primary",node_id="node-b",role="follower",state="alive"} 64
+`, n, n+1, n+1, n+1, time.Now().Add(-90*time.Second).Unix())
+}
+
+func TestTopCommand(t *testing.T) {
+	cmd := TopCommand()
+	if cmd.Name != "top" {
+		t.Errorf("Name = %q, want %q", cmd.Name, "top")
+	}
+
+	flagNames := make(map[string]bool)
+	for _, flag := range cmd.Flags {
+		flagNames[flag.Names()[0]] = true
+	}
+	for _, name := range []string{"interval", "socket", "iterations"} {
+		if !flagNames[name] {
+			t.Errorf("missing flag: --%s", name)
+		}
+	}
+}
+
+func TestRunTop_HTTP(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	var polls atomic.Int32
+	server.handle("/admin/v1/status/summary", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]any{
+			"code": "OK",
+			"data": map[string]any{"status": "running", "version": "1.2.3", "uptime_seconds": 3700},
+		})
+	})
+	server.handle("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// 100 validations between polls
+		n := 100 * int(polls.Add(1))
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, topMetrics(n))
+	})
+
+	src := &httpTopSource{client: connection.NewHTTPClient(server.URL, "", "")}
+	var buf bytes.Buffer
+	if err := runTop(context.Background(), &buf, src, 50*time.Millisecond, 2, false); err != nil {
+		t.Fatalf("runTop: %v", err)
+	}
+
+	out := buf.String()
+	frames := strings.Split(out, "TokMesh top - ")
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 2:\n%s", len(frames)-1, out)
+	}
+	for _, want := range []string{
+		"version 1.2.3",
+		"uptime 1h1m40s",
+		"Active sessions",
+		"1234",
+		"2.0 MB",
+		"Validate p50 / p99",
+		"POST /tokens/validate",
+		"node-a", "leader", "128",
+		"node-b", "follower",
+	} {
+		if !strings.Contains(frames[2], want) {
+			t.Errorf("second frame missing %q:\n%s", want, frames[2])
+		}
+	}
+	if !strings.Contains(frames[2], "Requests/s") {
+		t.Errorf("second frame has no request rate:\n%s", frames[2])
+	}
+	if strings.Contains(frames[1], "Requests/s") {
+		t.Errorf("first frame has a request rate:\n%s", frames[1])
+	}
+	if !strings.Contains(frames[2], "Snapshot age") || !strings.Contains(frames[2], "1m3") {
+		t.Errorf("second frame missing snapshot age of about 90s:\n%s", frames[2])
+	}
+}
+
+func TestRunTop_Socket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "top.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	// Answer "status" and "metrics" like the local management server
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 64)
+			n, _ := conn.Read(buf)
+			switch strings.TrimSpace(string(buf[:n])) {
+			case "status":
+				conn.Write([]byte(`{"status":"running","version":"sock"}` + "\n"))
+			case "metrics":
+				conn.Write([]byte(topMetrics(10)))
+			}
+			conn.Close()
+		}
+	}()
+
+	src := &socketTopSource{path: socketPath, client: connection.NewSocketClient(socketPath)}
+	var buf bytes.Buffer
+	if err := runTop(context.Background(), &buf, src, time.Second, 1, true); err != nil {
+		t.Fatalf("runTop: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, clearScreen) {
+		t.Error("redraw output does not clear the screen")
+	}
+	for _, want := range []string{"unix://" + socketPath, "version sock", "POST /tokens/validate", "node-b"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunTop_Error(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+	server.handle("/admin/v1/status/summary", func(w http.ResponseWriter, r *http.Request) {
+		errorResponse(w, http.StatusUnauthorized, "TM-AUTH-4010", "missing API key")
+	})
+
+	src := &httpTopSource{client: connection.NewHTTPClient(server.URL, "", "")}
+	err := runTop(context.Background(), &bytes.Buffer{}, src, time.Second, 1, false)
+	if err == nil || !strings.Contains(err.Error(), "missing API key") {
+		t.Errorf("err = %v, want the server error", err)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &histogram{
+		bounds: []float64{0.001, 0.002, 0.004},
+		counts: []float64{50, 90, 100},
+		total:  100,
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0.25, 0.0005},
+		{0.5, 0.001},
+		{0.7, 0.0015},
+		{0.99, 0.0038},
+	}
+	for _, tt := range tests {
+		if got := h.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	// Observations above the last bound report the last bound.
+	h.total = 200
+	if got := h.quantile(0.99); got != 0.004 {
+		t.Errorf("quantile(0.99) with +Inf observations = %v, want 0.004", got)
+	}
+}
+
+func TestFormatLatency(t *testing.T) {
+	tests := []struct {
+		sec  float64
+		want string
+	}{
+		{0, "-"},
+		{math.NaN(), "-"},
+		{0.00025, "250µs"},
+		{0.0012345, "1.23ms"},
+		{1.5, "1.5s"},
+	}
+	for _, tt := range tests {
+		if got := formatLatency(tt.sec); got != tt.want {
+			t.Errorf("formatLatency(%v) = %q, want %q", tt.sec, got, tt.want)
+		}
+	}
+}
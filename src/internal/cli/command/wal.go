@@ -0,0 +1,312 @@
+// Package command provides CLI command definitions for tokmesh-cli.
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
+)
+
+// defaultWALFollowInterval is how often wal tail --follow polls.
+const defaultWALFollowInterval = time.Second
+
+// WALCommand returns the wal subcommand group, which inspects the
+// write-ahead log of a running server.
+func WALCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "wal",
+		Usage: "Inspect the write-ahead log of the server",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "status",
+				Usage:  "Show the WAL writer state and segment files",
+				Action: walStatus,
+			},
+			{
+				Name:  "tail",
+				Usage: "Show the latest WAL entries, or the entries from an offset",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "Show the entries from this offset (SEGMENT[:OFFSET]) instead of the latest ones",
+					},
+					&cli.IntFlag{
+						Name:    "limit",
+						Aliases: []string{"n"},
+						Usage:   "Number of entries",
+						Value:   20,
+					},
+					&cli.StringSliceFlag{
+						Name:  "op",
+						Usage: "Show only these operations (create, update, delete, touch, set_expiry)",
+					},
+					&cli.StringFlag{
+						Name:  "session-id",
+						Usage: "Show only the entries of a session",
+					},
+					&cli.StringFlag{
+						Name:  "user-id",
+						Usage: "Show only the entries of a user's sessions",
+					},
+					&cli.BoolFlag{
+						Name:  "reveal",
+						Usage: "Show token hashes and PII unmasked (admin only, audited)",
+					},
+					&cli.BoolFlag{
+						Name:    "follow",
+						Aliases: []string{"f"},
+						Usage:   "Keep printing new entries until interrupted",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Usage: "Polling interval with --follow",
+						Value: defaultWALFollowInterval,
+					},
+				},
+				Action: walTail,
+			},
+		},
+	}
+}
+
+// walStatusResult is the response of GET /admin/v1/wal/status.
+type walStatusResult struct {
+	SegmentID           uint64     `json:"segment_id"`
+	Offset              string     `json:"offset"`
+	PendingFsyncBytes   int64      `json:"pending_fsync_bytes"`
+	PendingFsyncEntries int        `json:"pending_fsync_entries"`
+	LastFsyncAt         *time.Time `json:"last_fsync_at,omitempty"`
+	SegmentCount        int        `json:"segment_count"`
+	TotalBytes          int64      `json:"total_bytes"`
+	Segments            []struct {
+		ID         uint64    `json:"id"`
+		File       string    `json:"file"`
+		SizeBytes  int64     `json:"size_bytes"`
+		Active     bool      `json:"active"`
+		ModifiedAt time.Time `json:"modified_at"`
+	} `json:"segments"`
+	SnapshotOffset string     `json:"snapshot_offset,omitempty"`
+	LastSnapshotAt *time.Time `json:"last_snapshot_at,omitempty"`
+}
+
+func walStatus(c *cli.Context) error {
+	client, err := EnsureConnected(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := client.Get(ctx, "/admin/v1/wal/status")
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	var result walStatusResult
+	if err := connection.ParseResponse(resp, &result); err != nil {
+		return err
+	}
+
+	flags := ParseGlobalFlags(c)
+	if output.Format(flags.Output) == output.FormatJSON {
+		formatter := &output.JSONFormatter{}
+		return formatter.Format(os.Stdout, result)
+	}
+
+	never := func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Local().Format(time.RFC3339)
+	}
+	fmt.Printf("WAL Status\n")
+	fmt.Printf("==========\n\n")
+	fmt.Printf("Segment:         %d\n", result.SegmentID)
+	fmt.Printf("Offset:          %s\n", result.Offset)
+	fmt.Printf("Pending fsync:   %s (%d entries)\n", output.FormatBytes(result.PendingFsyncBytes), result.PendingFsyncEntries)
+	fmt.Printf("Last fsync:      %s\n", never(result.LastFsyncAt))
+	fmt.Printf("Segments:        %d (%s)\n", result.SegmentCount, output.FormatBytes(result.TotalBytes))
+	if result.SnapshotOffset != "" {
+		fmt.Printf("Snapshot offset: %s\n", result.SnapshotOffset)
+	}
+	fmt.Printf("Last snapshot:   %s\n\n", never(result.LastSnapshotAt))
+
+	table := &output.Table{Headers: []string{"ID", "FILE", "SIZE", "MODIFIED", "ACTIVE"}}
+	for _, seg := range result.Segments {
+		active := ""
+		if seg.Active {
+			active = "*"
+		}
+		table.Rows = append(table.Rows, []string{
+			strconv.FormatUint(seg.ID, 10),
+			seg.File,
+			output.FormatBytes(seg.SizeBytes),
+			seg.ModifiedAt.Local().Format("2006-01-02 15:04:05"),
+			active,
+		})
+	}
+	return table.Render(os.Stdout)
+}
+
+// walLogsResult is the response of GET /admin/v1/wal/logs. Entries are
+// kept as received for JSON output.
+type walLogsResult struct {
+	Entries    []json.RawMessage `json:"entries"`
+	NextOffset string            `json:"next_offset"`
+	More       bool              `json:"more"`
+}
+
+// walLogEntry holds the fields of a WAL entry shown as text.
+type walLogEntry struct {
+	Offset    string    `json:"offset"`
+	Op        string    `json:"op"`
+	Timestamp time.Time `json:"timestamp"`
+	SessionID string    `json:"session_id"`
+	Version   uint64    `json:"version"`
+	Encrypted bool      `json:"encrypted"`
+	Session   *struct {
+		UserID string `json:"user_id"`
+	} `json:"session"`
+	AccessIP  string     `json:"access_ip"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func walTail(c *cli.Context) error {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(c.Int("limit")))
+	if from := c.String("from"); from != "" {
+		params.Set("from", from)
+	} else {
+		params.Set("tail", "true")
+	}
+	if ops := c.StringSlice("op"); len(ops) > 0 {
+		params.Set("op", strings.Join(ops, ","))
+	}
+	if sessionID := c.String("session-id"); sessionID != "" {
+		params.Set("session_id", sessionID)
+	}
+	if userID := c.String("user-id"); userID != "" {
+		params.Set("user_id", userID)
+	}
+	if c.Bool("reveal") {
+		params.Set("reveal", "true")
+	}
+
+	client, err := EnsureConnected(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	flags := ParseGlobalFlags(c)
+	jsonOutput := output.Format(flags.Output) == output.FormatJSON
+	return runWALTail(ctx, os.Stdout, client, params, jsonOutput, c.Bool("follow"), c.Duration("interval"))
+}
+
+// runWALTail prints the WAL entries selected by params. With follow it
+// then polls for new entries every interval until ctx is done.
+func runWALTail(ctx context.Context, w io.Writer, client *connection.HTTPClient, params url.Values, jsonOutput, follow bool, interval time.Duration) error {
+	for {
+		page, err := fetchWALLogs(ctx, client, params)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := printWALEntries(w, page.Entries, jsonOutput); err != nil {
+			return err
+		}
+
+		// Continue after the entries shown, oldest first.
+		params.Del("tail")
+		params.Set("from", page.NextOffset)
+		if page.More {
+			if !follow {
+				if !jsonOutput {
+					fmt.Fprintf(w, "More entries: --from %s\n", page.NextOffset)
+				}
+				return nil
+			}
+			continue
+		}
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetchWALLogs requests a page of WAL entries.
+func fetchWALLogs(ctx context.Context, client *connection.HTTPClient, params url.Values) (*walLogsResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := client.Get(ctx, "/admin/v1/wal/logs?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	var page walLogsResult
+	if err := connection.ParseResponse(resp, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// printWALEntries prints entries as JSON lines, or one line of text each.
+func printWALEntries(w io.Writer, entries []json.RawMessage, jsonOutput bool) error {
+	for _, raw := range entries {
+		if jsonOutput {
+			if _, err := fmt.Fprintf(w, "%s\n", raw); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var e walLogEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return fmt.Errorf("decode wal entry: %w", err)
+		}
+		var details []string
+		if e.Session != nil {
+			details = append(details, "user="+e.Session.UserID)
+		}
+		if e.Version > 0 {
+			details = append(details, "version="+strconv.FormatUint(e.Version, 10))
+		}
+		if e.AccessIP != "" {
+			details = append(details, "ip="+e.AccessIP)
+		}
+		if e.ExpiresAt != nil {
+			details = append(details, "expires="+e.ExpiresAt.Local().Format(time.RFC3339))
+		}
+		if e.Encrypted {
+			details = append(details, "encrypted")
+		}
+		if _, err := fmt.Fprintf(w, "%-14s %s %-10s %s %s\n",
+			e.Offset, e.Timestamp.Local().Format("2006-01-02 15:04:05.000"), e.Op, e.SessionID, strings.Join(details, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
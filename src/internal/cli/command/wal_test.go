@@ -0,0 +1,188 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+)
+
+func TestWALCommand(t *testing.T) {
+	cmd := WALCommand()
+	if cmd.Name != "wal" {
+		t.Errorf("Name = %q, want %q", cmd.Name, "wal")
+	}
+
+	subcommands := make(map[string]bool)
+	for _, sub := range cmd.Subcommands {
+		subcommands[sub.Name] = true
+	}
+	for _, name := range []string{"status", "tail"} {
+		if !subcommands[name] {
+			t.Errorf("missing subcommand %q", name)
+		}
+	}
+}
+
+func TestWALStatus(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/admin/v1/wal/status", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]any{
+			"segment_id":          3,
+			"offset":              "3:512",
+			"pending_fsync_bytes": 40,
+			"segment_count":       1,
+			"total_bytes":         512,
+			"segments": []map[string]any{
+				{"id": 3, "file": "wal-00000003.log", "size_bytes": 512, "active": true, "modified_at": time.Now()},
+			},
+		})
+	})
+
+	for _, format := range []string{"table", "json"} {
+		ctx := testContext(server, "--output", format)
+		if err := walStatus(ctx); err != nil {
+			t.Errorf("walStatus() with %s output: %v", format, err)
+		}
+	}
+}
+
+func TestWALStatus_Error(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/admin/v1/wal/status", func(w http.ResponseWriter, r *http.Request) {
+		errorResponse(w, http.StatusNotFound, "TM-ADMIN-4041", "no WAL with this storage backend")
+	})
+
+	if err := walStatus(testContext(server)); err == nil {
+		t.Error("walStatus() expected error")
+	}
+}
+
+func TestWALTail_Params(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	var query url.Values
+	server.handle("/admin/v1/wal/logs", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		jsonResponse(w, http.StatusOK, map[string]any{"entries": []any{}, "next_offset": "2:8"})
+	})
+
+	ctx := makeTestContext(server, map[string]any{
+		"from":       "2:8",
+		"limit":      5,
+		"op":         []string{"create", "delete"},
+		"session-id": "tmss-1",
+		"user-id":    "alice",
+		"reveal":     true,
+	}, nil)
+	if err := walTail(ctx); err != nil {
+		t.Fatalf("walTail() error = %v", err)
+	}
+
+	want := url.Values{
+		"from":       {"2:8"},
+		"limit":      {"5"},
+		"op":         {"create,delete"},
+		"session_id": {"tmss-1"},
+		"user_id":    {"alice"},
+		"reveal":     {"true"},
+	}
+	if query.Encode() != want.Encode() {
+		t.Errorf("query = %s, want %s", query.Encode(), want.Encode())
+	}
+}
+
+func TestRunWALTail_Follow(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var queries []string
+	server.handle("/admin/v1/wal/logs", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, r.URL.RawQuery)
+
+		entry := func(offset, op string) map[string]any {
+			return map[string]any{"offset": offset, "op": op, "timestamp": time.Now(), "session_id": "tmss-1"}
+		}
+		switch len(queries) {
+		case 1:
+			jsonResponse(w, http.StatusOK, map[string]any{
+				"entries":     []any{entry("1:8", "create")},
+				"next_offset": "1:60",
+			})
+		case 2:
+			// A full page: the next one is requested without waiting.
+			jsonResponse(w, http.StatusOK, map[string]any{
+				"entries":     []any{entry("1:60", "touch")},
+				"next_offset": "1:90",
+				"more":        true,
+			})
+		default:
+			cancel()
+			jsonResponse(w, http.StatusOK, map[string]any{"entries": []any{}, "next_offset": "1:90"})
+		}
+	})
+
+	client := connection.NewHTTPClient(server.URL, "", "")
+	params := url.Values{"limit": {"1"}, "tail": {"true"}}
+	var buf bytes.Buffer
+	if err := runWALTail(ctx, &buf, client, params, false, true, time.Millisecond); err != nil {
+		t.Fatalf("runWALTail() error = %v", err)
+	}
+
+	want := []string{"limit=1&tail=true", "from=1%3A60&limit=1", "from=1%3A90&limit=1"}
+	if strings.Join(queries, " ") != strings.Join(want, " ") {
+		t.Errorf("queries = %v, want %v", queries, want)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "1:8") || !strings.Contains(out, "touch") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRunWALTail_More(t *testing.T) {
+	server := newMockServer()
+	defer server.Close()
+
+	server.handle("/admin/v1/wal/logs", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]any{
+			"entries":     []any{map[string]any{"offset": "1:8", "op": "create", "session_id": "tmss-1", "session": map[string]any{"user_id": "masked:ab"}}},
+			"next_offset": "1:60",
+			"more":        true,
+		})
+	})
+
+	client := connection.NewHTTPClient(server.URL, "", "")
+	var buf bytes.Buffer
+	if err := runWALTail(context.Background(), &buf, client, url.Values{"from": {"1"}}, false, false, time.Second); err != nil {
+		t.Fatalf("runWALTail() error = %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "user=masked:ab") || !strings.Contains(out, "More entries: --from 1:60") {
+		t.Errorf("output = %q", out)
+	}
+
+	buf.Reset()
+	if err := runWALTail(context.Background(), &buf, client, url.Values{"from": {"1"}}, true, false, time.Second); err != nil {
+		t.Fatalf("runWALTail() JSON error = %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], `{"offset":"1:8"`) {
+		t.Errorf("JSON output = %q", buf.String())
+	}
+}
@@ -2,8 +2,11 @@
 package config
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -88,6 +91,8 @@ func TestSave_CreateDirectory(t *testing.T) {
 }
 
 func TestSave_EmptyPath(t *testing.T) {
+	// Save now writes the file, so keep it out of the real home directory.
+	t.Setenv("HOME", t.TempDir())
 	cfg := Default()
 
 	// This may fail due to permissions on default path, which is acceptable
@@ -167,3 +172,178 @@ func TestConnectionConfig_Struct(t *testing.T) {
 		t.Error("TLS should be true")
 	}
 }
+
+func TestSaveLoad_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli.yaml")
+
+	cfg := Default()
+	cfg.DefaultOutput = "json"
+	cfg.CurrentConnection = "prod"
+	cfg.Connections["prod"] = ConnectionConfig{
+		Server:   "https://prod.example.com",
+		APIKeyID: "tmak-prod",
+		APIKey:   "tmas_secret",
+		TLS:      true,
+	}
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("config file mode = %o, want 600", perm)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got.DefaultOutput != "json" || got.CurrentConnection != "prod" {
+		t.Errorf("Load = %+v", got)
+	}
+	if got.DefaultServer != "http://localhost:5080" {
+		t.Errorf("DefaultServer = %q, want default", got.DefaultServer)
+	}
+	if got.Connections["prod"] != cfg.Connections["prod"] {
+		t.Errorf("Connections[prod] = %+v, want %+v", got.Connections["prod"], cfg.Connections["prod"])
+	}
+}
+
+func TestLoad_InvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli.yaml")
+	if err := os.WriteFile(path, []byte("connections: [unclosed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load should fail for invalid YAML")
+	}
+}
+
+func TestSave_SecretsInCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli.yaml")
+
+	cfg := Default()
+	cfg.Connections["prod"] = ConnectionConfig{Server: "https://prod.example.com", APIKeyID: "tmak-prod", APIKey: "tmas_prodsecret"}
+	cfg.Connections["vault"] = ConnectionConfig{Server: "https://vault.example.com", APIKeyID: "tmak-vault", APIKeyCommand: "pass show tokmesh"}
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "tmas_prodsecret") {
+		t.Errorf("cli.yaml contains the secret:\n%s", data)
+	}
+
+	credsPath := filepath.Join(dir, "credentials")
+	if CredentialsPath(path) != credsPath {
+		t.Errorf("CredentialsPath = %q, want %q", CredentialsPath(path), credsPath)
+	}
+	info, err := os.Stat(credsPath)
+	if err != nil {
+		t.Fatalf("Stat credentials: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("credentials mode = %o, want 600", perm)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got.Connections["prod"].APIKey != "tmas_prodsecret" {
+		t.Errorf("prod APIKey = %q, want it from the credentials file", got.Connections["prod"].APIKey)
+	}
+	if got.Connections["vault"].SecretSource() != SecretSourceCommand {
+		t.Errorf("vault SecretSource = %q, want command", got.Connections["vault"].SecretSource())
+	}
+
+	// Removing the profile removes its secret.
+	delete(got.Connections, "prod")
+	if err := Save(got, path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	creds, err := LoadCredentials(credsPath)
+	if err != nil {
+		t.Fatalf("LoadCredentials failed: %v", err)
+	}
+	if len(creds.Profiles) != 0 {
+		t.Errorf("credentials = %+v, want none", creds.Profiles)
+	}
+}
+
+func TestLoad_LegacySecretMigrated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli.yaml")
+	legacy := "connections:\n  dev:\n    server: http://localhost:5080\n    api_key_id: tmak-dev\n    api_key: tmas_legacy\n"
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Connections["dev"].APIKey != "tmas_legacy" {
+		t.Fatalf("APIKey = %q, want the legacy secret", cfg.Connections["dev"].APIKey)
+	}
+
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "tmas_legacy") {
+		t.Errorf("cli.yaml still contains the secret after Save:\n%s", data)
+	}
+	if cfg, err = Load(path); err != nil || cfg.Connections["dev"].APIKey != "tmas_legacy" {
+		t.Errorf("reloaded APIKey = %q, %v", cfg.Connections["dev"].APIKey, err)
+	}
+}
+
+func TestLoadCredentials_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte("profiles: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCredentials(path); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("LoadCredentials err = %v, want a permission error", err)
+	}
+}
+
+func TestConnectionConfig_ResolveAPIKey(t *testing.T) {
+	ctx := context.Background()
+
+	if secret, err := (ConnectionConfig{APIKey: "tmas_file"}).ResolveAPIKey(ctx); err != nil || secret != "tmas_file" {
+		t.Errorf("file: %q, %v", secret, err)
+	}
+
+	t.Setenv("TOKMESH_TEST_SECRET", "tmas_env")
+	if secret, err := (ConnectionConfig{APIKeyEnv: "TOKMESH_TEST_SECRET"}).ResolveAPIKey(ctx); err != nil || secret != "tmas_env" {
+		t.Errorf("env: %q, %v", secret, err)
+	}
+	if _, err := (ConnectionConfig{APIKeyEnv: "TOKMESH_TEST_UNSET"}).ResolveAPIKey(ctx); err == nil {
+		t.Error("env: want error for an unset variable")
+	}
+
+	if runtime.GOOS != "windows" {
+		if secret, err := (ConnectionConfig{APIKeyCommand: "echo '  tmas_cmd '"}).ResolveAPIKey(ctx); err != nil || secret != "tmas_cmd" {
+			t.Errorf("command: %q, %v", secret, err)
+		}
+		if _, err := (ConnectionConfig{APIKeyCommand: "exit 3"}).ResolveAPIKey(ctx); err == nil {
+			t.Error("command: want error for a failing command")
+		}
+	}
+
+	if secret, err := (ConnectionConfig{}).ResolveAPIKey(ctx); err != nil || secret != "" {
+		t.Errorf("none: %q, %v", secret, err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package config defines the CLI configuration structure.
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Secret sources reported by ConnectionConfig.SecretSource.
+const (
+	SecretSourceNone    = ""
+	SecretSourceFile    = "file"
+	SecretSourceEnv     = "env"
+	SecretSourceCommand = "command"
+)
+
+// Credentials holds the API key secrets of the connection profiles. It is
+// stored apart from cli.yaml, readable by the owner only, so the config
+// file can be shared or inspected without leaking secrets.
+type Credentials struct {
+	Profiles map[string]ProfileCredentials `yaml:"profiles"`
+}
+
+// ProfileCredentials holds the secrets of one profile.
+type ProfileCredentials struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// CredentialsPath returns the credentials file belonging to the config
+// file at configPath: "credentials" in the same directory.
+func CredentialsPath(configPath string) string {
+	if configPath == "" {
+		configPath = DefaultConfigPath()
+	}
+	return filepath.Join(filepath.Dir(configPath), "credentials")
+}
+
+// LoadCredentials loads a credentials file. A missing file holds no
+// credentials. Like ssh, it refuses a file other users can access.
+func LoadCredentials(path string) (*Credentials, error) {
+	creds := &Credentials{Profiles: make(map[string]ProfileCredentials)}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("credentials file %s is accessible by other users (mode %o); run chmod 600 %s",
+			path, info.Mode().Perm(), path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+	if err := yaml.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("parse credentials %s: %w", path, err)
+	}
+	if creds.Profiles == nil {
+		creds.Profiles = make(map[string]ProfileCredentials)
+	}
+	return creds, nil
+}
+
+// SaveCredentials writes a credentials file with 0600 permissions.
+func SaveCredentials(creds *Credentials, path string) error {
+	data, err := yaml.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("encode credentials: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to path with 0600 permissions, through a
+// temporary file so a failed write never truncates the existing file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SecretSource reports where the profile's API key secret comes from:
+// the credentials file, an environment variable, a command, or nowhere.
+func (c ConnectionConfig) SecretSource() string {
+	switch {
+	case c.APIKey != "":
+		return SecretSourceFile
+	case c.APIKeyEnv != "":
+		return SecretSourceEnv
+	case c.APIKeyCommand != "":
+		return SecretSourceCommand
+	default:
+		return SecretSourceNone
+	}
+}
+
+// ResolveAPIKey returns the profile's API key secret from its source.
+// A command runs through the shell with the terminal attached, so a
+// password manager may prompt; its trimmed standard output is the secret.
+func (c ConnectionConfig) ResolveAPIKey(ctx context.Context) (string, error) {
+	switch c.SecretSource() {
+	case SecretSourceFile:
+		return c.APIKey, nil
+	case SecretSourceEnv:
+		secret := os.Getenv(c.APIKeyEnv)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s holding the api key is not set", c.APIKeyEnv)
+		}
+		return secret, nil
+	case SecretSourceCommand:
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", c.APIKeyCommand)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", c.APIKeyCommand)
+		}
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("api key command failed: %w", err)
+		}
+		secret := strings.TrimSpace(string(out))
+		if secret == "" {
+			return "", fmt.Errorf("api key command printed no secret")
+		}
+		return secret, nil
+	default:
+		return "", nil
+	}
+}
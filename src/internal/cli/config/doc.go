@@ -4,6 +4,8 @@
 //
 //   - spec.go: CLIConfig struct (~/.tokmesh/cli.yaml)
 //   - loader.go: Configuration loading and merging
+//   - credentials.go: API key secrets (~/.tokmesh/credentials, 0600)
+//     and their env/command sources
 //
 // Configuration includes:
 //
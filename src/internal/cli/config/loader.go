@@ -2,8 +2,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+
+	"go.yaml.in/yaml/v3"
 )
 
 // DefaultConfigPath returns the default CLI config file path.
@@ -12,37 +15,77 @@ func DefaultConfigPath() string {
 	return filepath.Join(homeDir, ".tokmesh", "cli.yaml")
 }
 
-// Load loads CLI configuration from file.
+// Load loads CLI configuration from file. A missing file yields the
+// default configuration; settings absent from the file keep their
+// defaults.
 func Load(path string) (*CLIConfig, error) {
 	if path == "" {
 		path = DefaultConfigPath()
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
 		return Default(), nil
 	}
+	if err != nil {
+		return nil, fmt.Errorf("read cli config: %w", err)
+	}
+
+	cfg := Default()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse cli config %s: %w", path, err)
+	}
+	if cfg.Connections == nil {
+		cfg.Connections = make(map[string]ConnectionConfig)
+	}
 
-	// TODO: Read and parse YAML file
-	// TODO: Decrypt API keys
-	return Default(), nil
+	creds, err := LoadCredentials(CredentialsPath(path))
+	if err != nil {
+		return nil, err
+	}
+	for name, pc := range creds.Profiles {
+		if cc, ok := cfg.Connections[name]; ok && cc.APIKey == "" {
+			cc.APIKey = pc.APIKey
+			cfg.Connections[name] = cc
+		}
+	}
+	return cfg, nil
 }
 
-// Save saves CLI configuration to file.
+// Save saves CLI configuration to file. API key secrets are written to
+// the credentials file (see CredentialsPath) instead, which then holds
+// exactly the secrets of cfg's profiles. Both files are written with
+// 0600 permissions, through temporary files so a failed write never
+// truncates them.
 func Save(cfg *CLIConfig, path string) error {
 	if path == "" {
 		path = DefaultConfigPath()
 	}
 
-	// Ensure directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
+	stripped := *cfg
+	stripped.Connections = make(map[string]ConnectionConfig, len(cfg.Connections))
+	creds := &Credentials{Profiles: make(map[string]ProfileCredentials)}
+	for name, cc := range cfg.Connections {
+		if cc.APIKey != "" {
+			creds.Profiles[name] = ProfileCredentials{APIKey: cc.APIKey}
+			cc.APIKey = ""
+		}
+		stripped.Connections[name] = cc
 	}
 
-	// TODO: Encrypt API keys before saving
-	// TODO: Write YAML file with appropriate permissions (0600)
-	return nil
+	// Secrets first, so a failure never drops one from both files.
+	credsPath := CredentialsPath(path)
+	if _, err := os.Stat(credsPath); len(creds.Profiles) > 0 || err == nil {
+		if err := SaveCredentials(creds, credsPath); err != nil {
+			return err
+		}
+	}
+
+	data, err := yaml.Marshal(&stripped)
+	if err != nil {
+		return fmt.Errorf("encode cli config: %w", err)
+	}
+	return writeFileAtomic(path, data)
 }
 
 // Merge merges environment variables and flags into config.
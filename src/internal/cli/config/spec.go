@@ -14,12 +14,39 @@ type CLIConfig struct {
 	CurrentConnection string `yaml:"current_connection"`
 }
 
-// ConnectionConfig stores saved connection details.
+// ConnectionConfig stores a saved connection profile: an HTTP(S) server
+// or the local management socket, and where its API key secret comes
+// from.
 type ConnectionConfig struct {
-	Server   string `yaml:"server"`
-	APIKeyID string `yaml:"api_key_id"`
-	APIKey   string `yaml:"api_key"` // Encrypted at rest
-	TLS      bool   `yaml:"tls"`
+	Server   string `yaml:"server,omitempty"`
+	APIKeyID string `yaml:"api_key_id,omitempty"`
+	TLS      bool   `yaml:"tls,omitempty"`
+
+	// APIKey is the secret. Save keeps it in the credentials file, never
+	// in cli.yaml; a secret found in cli.yaml (older versions) is still
+	// read and moved on the next Save.
+	APIKey string `yaml:"api_key,omitempty"`
+
+	// APIKeyEnv names an environment variable holding the secret.
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+
+	// APIKeyCommand is a shell command printing the secret, e.g. a
+	// password manager CLI.
+	APIKeyCommand string `yaml:"api_key_command,omitempty"`
+
+	// CAFile verifies the server certificate instead of the system roots.
+	CAFile string `yaml:"ca_file,omitempty"`
+
+	// CertFile and KeyFile are the client certificate for mTLS.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+
+	// Socket is the path of the server's local management socket. A
+	// socket profile has no server and needs no API key.
+	Socket string `yaml:"socket,omitempty"`
 }
 
 // Default returns the default CLI configuration.
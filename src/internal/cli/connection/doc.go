@@ -2,7 +2,8 @@
 //
 // This package manages connections to TokMesh servers:
 //
-//   - manager.go: Connection state machine and lifecycle
+//   - manager.go: Connection state machine and lifecycle, and
+//     conversion of saved connection profiles
 //   - http.go: HTTP/HTTPS client implementation
 //   - socket.go: Unix socket/named pipe client
 //
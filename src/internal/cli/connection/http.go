@@ -4,10 +4,13 @@ package connection
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
@@ -20,15 +23,29 @@ type HTTPClient struct {
 	apiKey   string
 }
 
+// HTTPOption configures an HTTPClient.
+type HTTPOption func(*HTTPClient)
+
+// WithTLSConfig sets the TLS configuration for https servers, e.g. a
+// custom CA or a client certificate (see LoadTLSConfig).
+func WithTLSConfig(cfg *tls.Config) HTTPOption {
+	return func(c *HTTPClient) {
+		c.client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: cfg,
+		}
+	}
+}
+
 // NewHTTPClient creates a new HTTP client.
-func NewHTTPClient(server, apiKeyID, apiKey string) *HTTPClient {
+func NewHTTPClient(server, apiKeyID, apiKey string, opts ...HTTPOption) *HTTPClient {
 	// Ensure baseURL has http:// prefix
 	baseURL := server
 	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
 		baseURL = "http://" + baseURL
 	}
 
-	return &HTTPClient{
+	c := &HTTPClient{
 		baseURL:  baseURL,
 		apiKeyID: apiKeyID,
 		apiKey:   apiKey,
@@ -36,6 +53,45 @@ func NewHTTPClient(server, apiKeyID, apiKey string) *HTTPClient {
 			Timeout: 30 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// LoadTLSConfig builds a client TLS configuration: caFile, if set,
+// replaces the system roots for verifying the server; certFile and
+// keyFile, if set, are the client certificate for mTLS.
+func LoadTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca file %s holds no PEM certificates", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("client certificate and key files must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
 }
 
 // Get performs a GET request.
@@ -73,6 +129,38 @@ func (c *HTTPClient) Post(ctx context.Context, path string, body any) (*http.Res
 	return c.client.Do(req)
 }
 
+// GetStream performs a GET request for a streaming response body.
+// Unlike Get, the request is bounded only by ctx, not the client timeout.
+func (c *HTTPClient) GetStream(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	c.addHeaders(req)
+	return c.streamClient().Do(req)
+}
+
+// PostStream performs a POST request with a raw streaming body.
+// Unlike Post, the request is bounded only by ctx, not the client timeout.
+func (c *HTTPClient) PostStream(ctx context.Context, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	c.addHeaders(req)
+	req.Header.Set("Content-Type", contentType)
+
+	return c.streamClient().Do(req)
+}
+
+// streamClient returns a client sharing the transport but without the
+// overall request timeout, which would cut off long transfers.
+func (c *HTTPClient) streamClient() *http.Client {
+	return &http.Client{Transport: c.client.Transport}
+}
+
 // addHeaders adds authentication and common headers.
 func (c *HTTPClient) addHeaders(req *http.Request) {
 	if c.apiKeyID != "" && c.apiKey != "" {
@@ -2,11 +2,23 @@ package connection
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewHTTPClient(t *testing.T) {
@@ -133,6 +145,45 @@ func TestHTTPClient_Post_NilBody(t *testing.T) {
 	defer resp.Body.Close()
 }
 
+func TestHTTPClient_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key-ID") != "keyid" {
+			t.Errorf("X-API-Key-ID = %q, want %q", r.Header.Get("X-API-Key-ID"), "keyid")
+		}
+		if r.Method == http.MethodPost {
+			if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+			}
+			io.Copy(w, r.Body)
+			return
+		}
+		w.Write([]byte("{}\n{}\n"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "keyid", "secret")
+
+	resp, err := client.GetStream(context.Background(), "/export")
+	if err != nil {
+		t.Fatalf("GetStream failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "{}\n{}\n" {
+		t.Errorf("GetStream body = %q", body)
+	}
+
+	resp, err = client.PostStream(context.Background(), "/import", "application/x-ndjson", strings.NewReader("{}\n"))
+	if err != nil {
+		t.Fatalf("PostStream failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "{}\n" {
+		t.Errorf("PostStream body = %q", body)
+	}
+}
+
 func TestHTTPClient_NoAuth(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Auth headers should be empty
@@ -235,3 +286,107 @@ func TestParseResponse_NilTarget(t *testing.T) {
 		t.Errorf("ParseResponse with nil target should not error: %v", err)
 	}
 }
+
+// writePEM writes a PEM block to a file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and returns its
+// parsed form and the paths of its certificate and key files.
+func newClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tokmesh-cli"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, writePEM(t, dir, "client.crt", "CERTIFICATE", der), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestHTTPClient_CustomCAAndClientCert(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := newClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cn":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writePEM(t, dir, "ca.crt", "CERTIFICATE", server.Certificate().Raw)
+
+	// Without the CA the server certificate is not trusted.
+	if _, err := NewHTTPClient(server.URL, "", "").Get(context.Background(), "/"); err == nil {
+		t.Error("Get without custom CA should fail")
+	}
+
+	// Without a client certificate the server rejects the handshake.
+	tlsCfg, err := LoadTLSConfig(caFile, "", "", false)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig: %v", err)
+	}
+	if _, err := NewHTTPClient(server.URL, "", "", WithTLSConfig(tlsCfg)).Get(context.Background(), "/"); err == nil {
+		t.Error("Get without client certificate should fail")
+	}
+
+	conn := &Connection{Server: server.URL, CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+	client, err := conn.HTTPClient()
+	if err != nil {
+		t.Fatalf("HTTPClient: %v", err)
+	}
+	resp, err := client.Get(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	var got struct{ CN string }
+	if err := ParseResponse(resp, &got); err != nil || got.CN != "tokmesh-cli" {
+		t.Errorf("server saw client %q, %v", got.CN, err)
+	}
+}
+
+func TestLoadTLSConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.crt")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	tests := []struct {
+		name                      string
+		caFile, certFile, keyFile string
+	}{
+		{"missing ca file", filepath.Join(dir, "missing.crt"), "", ""},
+		{"ca file without certificates", notPEM, "", ""},
+		{"cert without key", "", notPEM, ""},
+		{"invalid key pair", "", notPEM, notPEM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadTLSConfig(tt.caFile, tt.certFile, tt.keyFile, false); err == nil {
+				t.Error("LoadTLSConfig should fail")
+			}
+		})
+	}
+}
@@ -1,6 +1,15 @@
 // Package connection provides connection management for tokmesh-cli.
 package connection
 
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
+)
+
 // Manager manages connections to TokMesh servers.
 type Manager struct {
 	current *Connection
@@ -13,6 +22,70 @@ type Connection struct {
 	APIKeyID string
 	APIKey   string
 	TLS      bool
+
+	// TLS settings of an https server.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Socket is the local management socket path; such a connection
+	// has no HTTP server.
+	Socket string
+}
+
+// FromProfile converts a saved connection profile, resolving its API key
+// secret (which may run the profile's secret command). A TLS profile
+// whose server has no scheme is reached over https.
+func FromProfile(ctx context.Context, name string, cc config.ConnectionConfig) (*Connection, error) {
+	secret, err := cc.ResolveAPIKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	server := cc.Server
+	if cc.TLS && server != "" && !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	return &Connection{
+		Name:               name,
+		Server:             server,
+		APIKeyID:           cc.APIKeyID,
+		APIKey:             secret,
+		TLS:                cc.TLS,
+		CAFile:             cc.CAFile,
+		CertFile:           cc.CertFile,
+		KeyFile:            cc.KeyFile,
+		InsecureSkipVerify: cc.InsecureSkipVerify,
+		Socket:             cc.Socket,
+	}, nil
+}
+
+// HTTPClient returns an HTTP client for the connection, with its TLS
+// settings. It fails for a local socket connection.
+func (c *Connection) HTTPClient() (*HTTPClient, error) {
+	if c.Socket != "" {
+		return nil, fmt.Errorf("%s is a local socket connection (%s), which only supports top and connect --test",
+			c.label(), c.Socket)
+	}
+
+	var opts []HTTPOption
+	if c.CAFile != "" || c.CertFile != "" || c.KeyFile != "" || c.InsecureSkipVerify {
+		tlsCfg, err := LoadTLSConfig(c.CAFile, c.CertFile, c.KeyFile, c.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLSConfig(tlsCfg))
+	}
+	return NewHTTPClient(c.Server, c.APIKeyID, c.APIKey, opts...), nil
+}
+
+// label names the connection in messages.
+func (c *Connection) label() string {
+	if c.Name != "" {
+		return "profile " + strconv.Quote(c.Name)
+	}
+	return "the connection"
 }
 
 // NewManager creates a new connection manager.
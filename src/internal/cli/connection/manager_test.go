@@ -1,7 +1,11 @@
 package connection
 
 import (
+	"context"
+	"strings"
 	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
 )
 
 func TestNewManager(t *testing.T) {
@@ -104,3 +108,34 @@ func TestConnection_Fields(t *testing.T) {
 		t.Error("TLS should be true")
 	}
 }
+
+func TestFromProfile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("TOKMESH_TEST_PROFILE_SECRET", "tmas_env")
+	conn, err := FromProfile(ctx, "prod", config.ConnectionConfig{
+		Server:    "tokmesh.example.com:5443",
+		TLS:       true,
+		APIKeyID:  "tmak-prod",
+		APIKeyEnv: "TOKMESH_TEST_PROFILE_SECRET",
+		CAFile:    "/etc/tokmesh/ca.crt",
+	})
+	if err != nil {
+		t.Fatalf("FromProfile: %v", err)
+	}
+	if conn.Name != "prod" || conn.Server != "https://tokmesh.example.com:5443" || conn.APIKey != "tmas_env" || conn.CAFile != "/etc/tokmesh/ca.crt" {
+		t.Errorf("conn = %+v", conn)
+	}
+
+	if _, err := FromProfile(ctx, "broken", config.ConnectionConfig{APIKeyEnv: "TOKMESH_TEST_UNSET"}); err == nil || !strings.Contains(err.Error(), `profile "broken"`) {
+		t.Errorf("err = %v, want an error naming the profile", err)
+	}
+
+	local, err := FromProfile(ctx, "local", config.ConnectionConfig{Socket: "/run/tokmesh.sock"})
+	if err != nil {
+		t.Fatalf("FromProfile: %v", err)
+	}
+	if _, err := local.HTTPClient(); err == nil || !strings.Contains(err.Error(), "local socket") {
+		t.Errorf("HTTPClient err = %v, want a local socket error", err)
+	}
+}
@@ -3,7 +3,9 @@ package connection
 
 import (
 	"bufio"
+	"io"
 	"net"
+	"time"
 )
 
 // SocketClient provides Unix socket communication for local management.
@@ -55,3 +57,24 @@ func (c *SocketClient) Execute(cmd string) (string, error) {
 
 	return response, nil
 }
+
+// Query sends a command on a new connection and returns the whole
+// response, which the server ends by closing the connection. Unlike
+// Execute it suits multi-line responses such as "metrics".
+func (c *SocketClient) Query(cmd string, timeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", c.path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(conn)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNewSocketClient(t *testing.T) {
@@ -172,6 +173,39 @@ func TestSocketClient_Close_WithConnection(t *testing.T) {
 	}
 }
 
+func TestSocketClient_Query(t *testing.T) {
+	tmpDir := t.TempDir()
+	socketPath := filepath.Join(tmpDir, "query.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	// Answer with several lines, then close
+	go func() {
+		conn, _ := listener.Accept()
+		if conn != nil {
+			defer conn.Close()
+			buf := make([]byte, 1024)
+			n, _ := conn.Read(buf)
+			conn.Write([]byte("cmd " + string(buf[:n]) + "line 2\nline 3\n"))
+		}
+	}()
+
+	client := NewSocketClient(socketPath)
+	response, err := client.Query("metrics", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	want := "cmd metrics\nline 2\nline 3\n"
+	if string(response) != want {
+		t.Errorf("response = %q, want %q", response, want)
+	}
+}
+
 func TestMain(m *testing.M) {
 	// Clean up any stale test sockets
 	os.Exit(m.Run())
@@ -123,11 +123,16 @@ func TestJSONFormatter_Format(t *testing.T) {
 func TestYAMLFormatter_Format(t *testing.T) {
 	f := &YAMLFormatter{}
 
-	t.Run("formats data (stub)", func(t *testing.T) {
+	t.Run("formats struct using json tags", func(t *testing.T) {
 		data := struct {
-			Name string `json:"name"`
+			Name  string   `json:"name"`
+			Count int64    `json:"count"`
+			Tags  []string `json:"tags"`
+			Empty string   `json:"empty,omitempty"`
 		}{
-			Name: "test",
+			Name:  "test",
+			Count: 1700000000123,
+			Tags:  []string{"a", "b"},
 		}
 
 		var buf bytes.Buffer
@@ -136,7 +141,24 @@ func TestYAMLFormatter_Format(t *testing.T) {
 			t.Fatalf("Format() error = %v", err)
 		}
 
-		// YAML formatter is a stub (TODO), so it returns empty
-		// Just verify it doesn't error
+		output := buf.String()
+		for _, want := range []string{"name: test\n", "count: 1700000000123\n", "tags:\n  - a\n  - b\n"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Format() = %q, missing %q", output, want)
+			}
+		}
+		if strings.Contains(output, "empty") {
+			t.Errorf("Format() = %q, omitempty field present", output)
+		}
+	})
+
+	t.Run("formats nil as YAML", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := f.Format(&buf, nil); err != nil {
+			t.Fatalf("Format(nil) error = %v", err)
+		}
+		if got := strings.TrimSpace(buf.String()); got != "null" {
+			t.Errorf("Format(nil) = %q, want 'null'", got)
+		}
 	})
 }
@@ -62,7 +62,7 @@ func (p *ProgressBar) Finish() {
 
 func (p *ProgressBar) render() {
 	if p.total <= 0 {
-		fmt.Fprintf(p.w, "\r%s %s", p.title, formatBytes(p.current))
+		fmt.Fprintf(p.w, "\r%s %s", p.title, FormatBytes(p.current))
 		return
 	}
 
@@ -81,13 +81,13 @@ func (p *ProgressBar) render() {
 		p.title,
 		bar,
 		percentStr,
-		formatBytes(p.current),
-		formatBytes(p.total),
+		FormatBytes(p.current),
+		FormatBytes(p.total),
 	)
 }
 
-// formatBytes formats bytes to human readable string.
-func formatBytes(b int64) string {
+// FormatBytes formats bytes to a human readable string, e.g. "1.5 MB".
+func FormatBytes(b int64) string {
 	const unit = 1024
 	if b < unit {
 		return fmt.Sprintf("%d B", b)
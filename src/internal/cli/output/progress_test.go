@@ -102,9 +102,9 @@ func TestFormatBytes(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := formatBytes(tt.input)
+		got := FormatBytes(tt.input)
 		if got != tt.want {
-			t.Errorf("formatBytes(%d) = %q, want %q", tt.input, got, tt.want)
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.input, got, tt.want)
 		}
 	}
 }
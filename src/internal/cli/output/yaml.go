@@ -1,13 +1,65 @@
 // Package output provides output formatting for tokmesh-cli.
 package output
 
-import "io"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.yaml.in/yaml/v3"
+)
 
 // YAMLFormatter formats data as YAML.
 type YAMLFormatter struct{}
 
-// Format formats data as YAML.
+// Format formats data as YAML. Data is converted through JSON first so
+// field names and omitempty follow the json tags the response types
+// already carry, keeping YAML and JSON output consistent.
 func (f *YAMLFormatter) Format(w io.Writer, data any) error {
-	// TODO: Use gopkg.in/yaml.v3 for YAML encoding
-	return nil
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encode yaml: %w", err)
+	}
+
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("encode yaml: %w", err)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(yamlValue(doc)); err != nil {
+		return fmt.Errorf("encode yaml: %w", err)
+	}
+	return encoder.Close()
+}
+
+// yamlValue converts json.Number values so integers are written as YAML
+// integers rather than quoted strings.
+func yamlValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any:
+		for k, e := range v {
+			v[k] = yamlValue(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = yamlValue(e)
+		}
+		return v
+	default:
+		return v
+	}
 }
@@ -1,11 +1,80 @@
 // Package repl provides the interactive REPL mode for tokmesh-cli.
 package repl
 
-import "strings"
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ArgKind identifies what a command's positional argument names, so it
+// can be completed with live values.
+type ArgKind int
+
+const (
+	// ArgNone is an argument without completion.
+	ArgNone ArgKind = iota
+	// ArgSessionID is a session ID, completed from the server.
+	ArgSessionID
+	// ArgAPIKeyID is an API key ID, completed from the server.
+	ArgAPIKeyID
+	// ArgNodeID is a cluster node ID, completed from the server.
+	ArgNodeID
+	// ArgConnection is a saved connection name from the CLI config.
+	ArgConnection
+)
+
+// ArgKindFor maps a command's ArgsUsage placeholder (e.g. "SESSION_ID")
+// to its ArgKind.
+func ArgKindFor(usage string) ArgKind {
+	switch strings.Trim(usage, "[]. ") {
+	case "SESSION_ID":
+		return ArgSessionID
+	case "KEY_ID":
+		return ArgAPIKeyID
+	case "NODE_ID":
+		return ArgNodeID
+	case "CONNECTION_NAME", "PROFILE", "PROFILE|SERVER":
+		return ArgConnection
+	default:
+		return ArgNone
+	}
+}
+
+// CommandSpec describes a command for completion.
+type CommandSpec struct {
+	// Path is the space-separated command path, e.g. "session get".
+	// An empty path declares global flags.
+	Path string
+	// Arg is the kind of the command's first positional argument.
+	Arg ArgKind
+	// Flags are the command's flag names with dashes, e.g. "--ttl", "-t".
+	Flags []string
+}
+
+// Source supplies live completion candidates from the server.
+type Source interface {
+	SessionIDs(ctx context.Context) ([]string, error)
+	APIKeyIDs(ctx context.Context) ([]string, error)
+	NodeIDs(ctx context.Context) ([]string, error)
+}
+
+// outputFormats are the values of --output and \output.
+var outputFormats = []string{"json", "table", "yaml"}
 
 // Completer provides command completion for the REPL.
+//
+// Completion is context aware: the words before the cursor select a
+// command path, and the word under the cursor is completed as a
+// subcommand, a flag, a flag value or the command's argument. Session,
+// API key and node IDs come from the Source; saved connection names
+// from the connections callback.
 type Completer struct {
-	commands []string
+	commands    []string
+	args        map[string]ArgKind
+	flags       map[string][]string
+	source      Source
+	connections func() []string
 }
 
 // NewCompleter creates a new Completer.
@@ -20,9 +89,47 @@ func NewCompleter() *Completer {
 			"connect", "disconnect", "use",
 			"help", "exit", "quit",
 		},
+		args: map[string]ArgKind{
+			"session get":    ArgSessionID,
+			"session delete": ArgSessionID,
+			"session extend": ArgSessionID,
+			"apikey delete":  ArgAPIKeyID,
+			"use":            ArgConnection,
+		},
+		flags: make(map[string][]string),
 	}
 }
 
+// SetCommands replaces the command table, typically with one derived
+// from the CLI's real command tree.
+func (c *Completer) SetCommands(specs []CommandSpec) {
+	c.commands = c.commands[:0]
+	c.args = make(map[string]ArgKind)
+	c.flags = make(map[string][]string)
+	for _, spec := range specs {
+		if spec.Path != "" {
+			c.commands = append(c.commands, spec.Path)
+		}
+		if spec.Arg != ArgNone {
+			c.args[spec.Path] = spec.Arg
+		}
+		if len(spec.Flags) > 0 {
+			c.flags[spec.Path] = spec.Flags
+		}
+	}
+	c.commands = append(c.commands, "help", "exit", "quit")
+}
+
+// SetSource sets the source of live IDs.
+func (c *Completer) SetSource(source Source) {
+	c.source = source
+}
+
+// SetConnections sets the callback listing saved connection names.
+func (c *Completer) SetConnections(fn func() []string) {
+	c.connections = fn
+}
+
 // Complete returns completion suggestions for the given prefix.
 func (c *Completer) Complete(prefix string) []string {
 	var suggestions []string
@@ -33,3 +140,166 @@ func (c *Completer) Complete(prefix string) []string {
 	}
 	return suggestions
 }
+
+// CompleteLine returns the candidates for the word being typed at the end
+// of line. Candidates are whole words, sorted; the caller replaces the
+// partial word with one of them.
+func (c *Completer) CompleteLine(ctx context.Context, line string) []string {
+	words := strings.Fields(line)
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\t") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	// Meta-commands.
+	if len(words) == 0 && strings.HasPrefix(word, `\`) {
+		return matching(metaCommandNames(), word)
+	}
+	if len(words) > 0 && strings.HasPrefix(words[0], `\`) {
+		if len(words) > 1 {
+			return nil
+		}
+		switch words[0] {
+		case `\connect`, `\use`:
+			return matching(c.connectionNames(), word)
+		case `\output`:
+			return matching(outputFormats, word)
+		case `\history`:
+			return matching([]string{"clear"}, word)
+		}
+		return nil
+	}
+
+	if n := len(words); n > 0 && (words[n-1] == "-o" || words[n-1] == "--output") {
+		return matching(outputFormats, word)
+	}
+
+	path, positional := c.commandPath(words)
+	if strings.HasPrefix(word, "-") {
+		flags := append(append([]string(nil), c.flags[path]...), c.flags[""]...)
+		return matching(flags, word)
+	}
+	if positional > 0 {
+		return nil
+	}
+
+	if subs := c.subcommands(path); len(subs) > 0 {
+		return matching(subs, word)
+	}
+	return matching(c.argValues(ctx, c.args[path]), word)
+}
+
+// commandPath returns the longest known command path formed by the
+// leading non-flag words, and the number of positional words after it.
+func (c *Completer) commandPath(words []string) (string, int) {
+	known := make(map[string]bool, len(c.commands))
+	for _, cmd := range c.commands {
+		known[cmd] = true
+	}
+
+	path := ""
+	positional := 0
+	for _, w := range words {
+		if strings.HasPrefix(w, "-") {
+			continue
+		}
+		next := strings.TrimSpace(path + " " + w)
+		if positional == 0 && known[next] {
+			path = next
+			continue
+		}
+		positional++
+	}
+	return path, positional
+}
+
+// subcommands returns the words that may follow path.
+func (c *Completer) subcommands(path string) []string {
+	prefix := ""
+	if path != "" {
+		prefix = path + " "
+	}
+	var subs []string
+	seen := make(map[string]bool)
+	for _, cmd := range c.commands {
+		if !strings.HasPrefix(cmd, prefix) || cmd == path {
+			continue
+		}
+		next, _, _ := strings.Cut(cmd[len(prefix):], " ")
+		if next != "" && !seen[next] {
+			seen[next] = true
+			subs = append(subs, next)
+		}
+	}
+	return subs
+}
+
+// argValues returns the live values for an argument kind. Errors are
+// ignored: completion never interrupts typing.
+func (c *Completer) argValues(ctx context.Context, kind ArgKind) []string {
+	if kind == ArgConnection {
+		return c.connectionNames()
+	}
+	if c.source == nil {
+		return nil
+	}
+
+	var values []string
+	switch kind {
+	case ArgSessionID:
+		values, _ = c.source.SessionIDs(ctx)
+	case ArgAPIKeyID:
+		values, _ = c.source.APIKeyIDs(ctx)
+	case ArgNodeID:
+		values, _ = c.source.NodeIDs(ctx)
+	}
+	return values
+}
+
+func (c *Completer) connectionNames() []string {
+	if c.connections == nil {
+		return nil
+	}
+	return c.connections()
+}
+
+// matching returns the sorted, de-duplicated candidates starting with
+// prefix.
+func matching(candidates []string, prefix string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, s := range candidates {
+		if strings.HasPrefix(s, prefix) && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// readlineCompleter adapts a Completer to readline's AutoCompleter.
+type readlineCompleter struct {
+	completer *Completer
+	ctx       context.Context
+}
+
+// Do returns the suffixes completing the word before pos and the length
+// of that word.
+func (a readlineCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	head := string(line[:pos])
+	word := ""
+	if i := strings.LastIndexAny(head, " \t"); i >= 0 {
+		word = head[i+1:]
+	} else {
+		word = head
+	}
+
+	candidates := a.completer.CompleteLine(a.ctx, head)
+	out := make([][]rune, 0, len(candidates))
+	for _, cand := range candidates {
+		out = append(out, []rune(cand[len(word):]+" "))
+	}
+	return out, len([]rune(word))
+}
@@ -1,6 +1,8 @@
 package repl
 
 import (
+	"context"
+	"reflect"
 	"testing"
 )
 
@@ -127,3 +129,122 @@ func TestCompleter_Commands(t *testing.T) {
 		}
 	}
 }
+
+// fakeSource is a completion source with fixed IDs.
+type fakeSource struct{}
+
+func (fakeSource) SessionIDs(context.Context) ([]string, error) {
+	return []string{"tmss-b", "tmss-a"}, nil
+}
+
+func (fakeSource) APIKeyIDs(context.Context) ([]string, error) {
+	return []string{"tmak-admin", "tmak-issuer"}, nil
+}
+
+func (fakeSource) NodeIDs(context.Context) ([]string, error) {
+	return []string{"tmnd-node1"}, nil
+}
+
+func newTestCompleter() *Completer {
+	c := NewCompleter()
+	c.SetCommands([]CommandSpec{
+		{Flags: []string{"--output", "-o", "--server"}},
+		{Path: "session"},
+		{Path: "session list", Flags: []string{"--user-id", "--page-size"}},
+		{Path: "session get", Arg: ArgSessionID},
+		{Path: "session revoke", Arg: ArgSessionID, Flags: []string{"--force"}},
+		{Path: "apikey"},
+		{Path: "apikey rotate", Arg: ArgAPIKeyID},
+		{Path: "cluster"},
+		{Path: "cluster remove", Arg: ArgNodeID},
+		{Path: "use", Arg: ArgConnection},
+	})
+	c.SetSource(fakeSource{})
+	c.SetConnections(func() []string { return []string{"dev", "prod"} })
+	return c
+}
+
+func TestCompleter_CompleteLine(t *testing.T) {
+	c := newTestCompleter()
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{"apikey", "cluster", "exit", "help", "quit", "session", "use"}},
+		{"se", []string{"session"}},
+		{"session ", []string{"get", "list", "revoke"}},
+		{"session re", []string{"revoke"}},
+		{"session get ", []string{"tmss-a", "tmss-b"}},
+		{"session revoke --force tmss-a", []string{"tmss-a"}},
+		{"session get tmss-a ", nil},
+		{"apikey rotate tmak-i", []string{"tmak-issuer"}},
+		{"cluster remove ", []string{"tmnd-node1"}},
+		{"use p", []string{"prod"}},
+		{"session list --", []string{"--output", "--page-size", "--server", "--user-id"}},
+		{"session list -o ", []string{"json", "table", "yaml"}},
+		{`\o`, []string{`\output`}},
+		{`\output y`, []string{"yaml"}},
+		{`\connect `, []string{"dev", "prod"}},
+		{`\use d`, []string{"dev"}},
+		{`\history `, []string{"clear"}},
+		{`\use dev `, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := c.CompleteLine(context.Background(), tt.line)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompleteLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_CompleteLine_NoSource(t *testing.T) {
+	c := newTestCompleter()
+	c.SetSource(nil)
+
+	if got := c.CompleteLine(context.Background(), "session get "); got != nil {
+		t.Errorf("CompleteLine without source = %q, want nil", got)
+	}
+}
+
+func TestReadlineCompleter_Do(t *testing.T) {
+	a := readlineCompleter{completer: newTestCompleter(), ctx: context.Background()}
+
+	line := []rune("session get tmss-")
+	got, length := a.Do(line, len(line))
+	if length != len("tmss-") {
+		t.Errorf("length = %d, want %d", length, len("tmss-"))
+	}
+	if len(got) != 2 || string(got[0]) != "a " || string(got[1]) != "b " {
+		t.Errorf("Do = %q, want [a  b ]", got)
+	}
+
+	// Completion applies to the word before the cursor.
+	line = []rune("sess get")
+	got, length = a.Do(line, 4)
+	if length != 4 || len(got) != 1 || string(got[0]) != "ion " {
+		t.Errorf("Do at cursor = %q, %d", got, length)
+	}
+}
+
+func TestArgKindFor(t *testing.T) {
+	tests := map[string]ArgKind{
+		"SESSION_ID":        ArgSessionID,
+		"KEY_ID":            ArgAPIKeyID,
+		"NODE_ID":           ArgNodeID,
+		"CONNECTION_NAME":   ArgConnection,
+		"[CONNECTION_NAME]": ArgConnection,
+		"PROFILE":           ArgConnection,
+		"[PROFILE|SERVER]":  ArgConnection,
+		"FILE":              ArgNone,
+		"":                  ArgNone,
+	}
+	for usage, want := range tests {
+		if got := ArgKindFor(usage); got != want {
+			t.Errorf("ArgKindFor(%q) = %d, want %d", usage, got, want)
+		}
+	}
+}
@@ -2,16 +2,19 @@
 //
 // This package implements the Read-Eval-Print Loop for interactive sessions:
 //
-//   - repl.go: Main REPL loop and command dispatch
-//   - completer.go: Tab completion for commands and arguments
-//   - history.go: Command history persistence
+//   - repl.go: Main REPL loop, meta-commands and command dispatch
+//   - completer.go: Context-aware Tab completion for commands and arguments
+//   - source.go: Live session, API key and node IDs for completion
+//   - history.go: Command history persistence with secret redaction
 //
 // Features:
 //
-//   - Command auto-completion
-//   - History search and navigation
-//   - Multi-line input support
-//   - Colored output
+//   - Readline-style line editing with Ctrl-R reverse history search
+//   - Completion of commands, flags, output formats, saved connections
+//     and IDs fetched from the connected server
+//   - \connect, \use, \connections and \output to switch connection and
+//     output format without leaving the shell
+//   - Persistent history with API key secrets and tokens redacted
 //
 // @design DS-0602
 package repl
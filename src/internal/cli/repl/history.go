@@ -5,9 +5,14 @@ import (
 	"bufio"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 // History manages command history for the REPL.
+//
+// Entries are redacted before they are stored, so API key secrets and
+// session tokens typed on the command line never reach the history file.
 type History struct {
 	entries []string
 	maxSize int
@@ -24,9 +29,9 @@ func NewHistory() *History {
 	}
 }
 
-// Add adds a command to history.
+// Add adds a command to history, redacting secrets.
 func (h *History) Add(cmd string) {
-	h.entries = append(h.entries, cmd)
+	h.entries = append(h.entries, Redact(cmd))
 	if len(h.entries) > h.maxSize {
 		h.entries = h.entries[1:]
 	}
@@ -40,6 +45,11 @@ func (h *History) Get(index int) string {
 	return h.entries[len(h.entries)-1-index]
 }
 
+// Entries returns the history entries, oldest first.
+func (h *History) Entries() []string {
+	return append([]string(nil), h.entries...)
+}
+
 // Load loads history from file.
 func (h *History) Load() error {
 	file, err := os.Open(h.file)
@@ -55,17 +65,20 @@ func (h *History) Load() error {
 	for scanner.Scan() {
 		h.entries = append(h.entries, scanner.Text())
 	}
+	if len(h.entries) > h.maxSize {
+		h.entries = h.entries[len(h.entries)-h.maxSize:]
+	}
 	return scanner.Err()
 }
 
-// Save saves history to file.
+// Save saves history to file, readable only by the owner.
 func (h *History) Save() error {
 	dir := filepath.Dir(h.file)
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return err
 	}
 
-	file, err := os.Create(h.file)
+	file, err := os.OpenFile(h.file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
@@ -78,3 +91,50 @@ func (h *History) Save() error {
 	}
 	return nil
 }
+
+// Clear removes all entries and the history file.
+func (h *History) Clear() error {
+	h.entries = h.entries[:0]
+	if err := os.Remove(h.file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// redactedValue replaces secrets in history entries.
+const redactedValue = "[REDACTED]"
+
+// secretFlags are flags whose value is a secret.
+var secretFlags = map[string]bool{
+	"--api-key": true,
+	"-K":        true,
+	"--secret":  true,
+	"--token":   true,
+}
+
+// secretPattern matches API key secrets (tmas_) and session tokens (tmtk_)
+// wherever they appear, for example inside a --data JSON document.
+var secretPattern = regexp.MustCompile(`\b(tmas|tmtk)_[A-Za-z0-9_-]+`)
+
+// Redact replaces secret values in a command line with [REDACTED]: the
+// values of --api-key, -K, --secret and --token (as a separate word or
+// after "="), and any API key secret or session token.
+func Redact(line string) string {
+	words := strings.Fields(line)
+	changed := false
+	for i, w := range words {
+		if i > 0 && secretFlags[words[i-1]] {
+			words[i] = redactedValue
+			changed = true
+			continue
+		}
+		if name, _, ok := strings.Cut(w, "="); ok && secretFlags[name] {
+			words[i] = name + "=" + redactedValue
+			changed = true
+		}
+	}
+	if changed {
+		line = strings.Join(words, " ")
+	}
+	return secretPattern.ReplaceAllString(line, redactedValue)
+}
@@ -3,6 +3,7 @@ package repl
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -186,3 +187,62 @@ func TestHistory_File_Default(t *testing.T) {
 		t.Errorf("history file should be named 'history', got %q", filepath.Base(h.file))
 	}
 }
+
+func TestRedact(t *testing.T) {
+	token := "tmtk_" + strings.Repeat("a", 43)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"session list", "session list"},
+		{"--api-key tmas_abc session list", "--api-key [REDACTED] session list"},
+		{"-k tmak-1 -K s3cret apikey list", "-k tmak-1 -K [REDACTED] apikey list"},
+		{"--api-key=s3cret system status", "--api-key=[REDACTED] system status"},
+		{`\connect prod:5080 tmak-1 tmas_xyz`, `\connect prod:5080 tmak-1 [REDACTED]`},
+		{`session create --user-id u1 --data '{"t":"` + token + `"}'`, `session create --user-id u1 --data '{"t":"[REDACTED]"}'`},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.line); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestHistory_Add_Redacts(t *testing.T) {
+	h := NewHistory()
+	h.Add("--api-key tmas_secret apikey list")
+
+	if got := h.Get(0); strings.Contains(got, "tmas_secret") {
+		t.Errorf("history entry %q contains the secret", got)
+	}
+}
+
+func TestHistory_SavePermissionsAndClear(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history")
+	h := &History{
+		entries: []string{"cmd"},
+		maxSize: 1000,
+		file:    historyFile,
+	}
+
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	info, err := os.Stat(historyFile)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("history file mode = %o, want 600", perm)
+	}
+
+	if err := h.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if len(h.Entries()) != 0 {
+		t.Errorf("entries after Clear = %v", h.Entries())
+	}
+	if _, err := os.Stat(historyFile); !os.IsNotExist(err) {
+		t.Errorf("history file still exists after Clear: %v", err)
+	}
+}
@@ -3,71 +3,590 @@ package repl
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
 )
 
+// Executor runs one CLI command. args are the words of the command line
+// preceded by the global flags of the current connection and output
+// format, without the program name.
+type Executor func(args []string) error
+
+// Option configures a REPL.
+type Option func(*REPL)
+
+// WithExecutor sets the function running CLI commands.
+func WithExecutor(exec Executor) Option {
+	return func(r *REPL) {
+		r.exec = exec
+	}
+}
+
+// WithConfigPath sets the CLI config file holding saved connections. The
+// default is config.DefaultConfigPath.
+func WithConfigPath(path string) Option {
+	return func(r *REPL) {
+		r.configPath = path
+	}
+}
+
+// WithConnection sets the initial connection. Without it the REPL starts
+// on the config's current connection, if any.
+func WithConnection(conn *connection.Connection) Option {
+	return func(r *REPL) {
+		r.conn = conn
+	}
+}
+
+// WithOutput sets the initial output format.
+func WithOutput(format output.Format) Option {
+	return func(r *REPL) {
+		r.format = format
+	}
+}
+
+// WithCommands replaces the completer's command table.
+func WithCommands(specs []CommandSpec) Option {
+	return func(r *REPL) {
+		r.completer.SetCommands(specs)
+	}
+}
+
+// WithIO sets the REPL's input and output.
+func WithIO(input io.Reader, out io.Writer) Option {
+	return func(r *REPL) {
+		r.input = input
+		r.output = out
+	}
+}
+
 // REPL represents the Read-Eval-Print Loop.
+//
+// On a terminal, lines are read with readline-style editing: cursor
+// movement, Up/Down history, Ctrl-R reverse search and context-aware Tab
+// completion. Otherwise lines are read as plain text, e.g. from a pipe.
+// Lines starting with a backslash are meta-commands that change the
+// REPL's connection and output format; other lines run CLI commands.
 type REPL struct {
 	input     io.Reader
 	output    io.Writer
 	completer *Completer
 	history   *History
+
+	exec       Executor
+	configPath string
+	conn       *connection.Connection
+	format     output.Format
+	source     *ServerSource
 }
 
 // New creates a new REPL instance.
-func New() *REPL {
-	return &REPL{
+func New(opts ...Option) *REPL {
+	r := &REPL{
 		input:     os.Stdin,
 		output:    os.Stdout,
 		completer: NewCompleter(),
 		history:   NewHistory(),
+		format:    output.FormatTable,
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+
+	if r.conn == nil {
+		if cfg, err := config.Load(r.configPath); err == nil && cfg.CurrentConnection != "" {
+			if cc, ok := cfg.Connections[cfg.CurrentConnection]; ok {
+				conn, err := connection.FromProfile(context.Background(), cfg.CurrentConnection, cc)
+				if err != nil {
+					fmt.Fprintf(r.output, "Warning: %v\n", err)
+				}
+				r.conn = conn
+			}
+		}
+	}
+
+	r.source = NewServerSource(r.client)
+	r.completer.SetSource(r.source)
+	r.completer.SetConnections(r.connectionNames)
+	return r
 }
 
 // Run starts the REPL loop.
 func (r *REPL) Run() error {
+	// readline puts the process's stdin into raw mode, so line editing
+	// is only available when reading from a terminal stdin.
+	if r.input == io.Reader(os.Stdin) && IsTerminal() {
+		return r.runTerminal()
+	}
+
 	reader := bufio.NewReader(r.input)
 
 	for {
 		// Print prompt
-		fmt.Fprint(r.output, "tokmesh> ")
+		fmt.Fprint(r.output, r.prompt())
 
 		// Read line
 		line, err := reader.ReadString('\n')
-		if err == io.EOF {
+		if err == io.EOF && line == "" {
 			fmt.Fprintln(r.output)
 			return nil
 		}
-		if err != nil {
+		if err != nil && err != io.EOF {
 			return err
 		}
 
-		// Trim and skip empty lines
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+		if r.handle(line) {
+			return nil
 		}
+	}
+}
 
-		// Add to history
-		r.history.Add(line)
+// runTerminal runs the loop with line editing. History is loaded from and
+// saved to the history file only here: piped input is not recorded.
+func (r *REPL) runTerminal() error {
+	_ = r.history.Load()
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 r.prompt(),
+		AutoComplete:           readlineCompleter{completer: r.completer, ctx: context.Background()},
+		HistoryLimit:           r.history.maxSize,
+		DisableAutoSaveHistory: true,
+		HistorySearchFold:      true,
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+		Stdout:                 r.output,
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
 
-		// Handle special commands
-		if line == "exit" || line == "quit" {
+	for _, entry := range r.history.Entries() {
+		_ = rl.SaveHistory(entry)
+	}
+	defer func() {
+		if err := r.history.Save(); err != nil {
+			fmt.Fprintf(r.output, "Warning: save history: %v\n", err)
+		}
+	}()
+
+	for {
+		rl.SetPrompt(r.prompt())
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if err == io.EOF {
 			return nil
 		}
+		if err != nil {
+			return err
+		}
 
-		// Execute command
-		if err := r.execute(line); err != nil {
-			fmt.Fprintf(r.output, "Error: %v\n", err)
+		if strings.TrimSpace(line) != "" {
+			// readline's own history gets the redacted entry as well, so
+			// a secret does not come back with the Up key either.
+			_ = rl.SaveHistory(Redact(strings.TrimSpace(line)))
+		}
+		if r.handle(line) {
+			return nil
 		}
 	}
 }
 
+// handle runs one input line and reports whether the REPL should exit.
+func (r *REPL) handle(line string) bool {
+	// Trim and skip empty lines
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+
+	// Add to history
+	r.history.Add(line)
+
+	// Handle special commands
+	if line == "exit" || line == "quit" || line == `\q` {
+		return true
+	}
+
+	// Execute command
+	if err := r.execute(line); err != nil {
+		fmt.Fprintf(r.output, "Error: %v\n", err)
+	}
+	return false
+}
+
 func (r *REPL) execute(line string) error {
-	// TODO: Parse line into command and args
-	// TODO: Execute via CLI command handlers
+	args, err := splitLine(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	// connect, disconnect and use change the REPL's own connection, like
+	// their meta-command forms.
+	switch args[0] {
+	case "connect", "disconnect", "use":
+		args[0] = `\` + args[0]
+	}
+	if strings.HasPrefix(args[0], `\`) {
+		return r.meta(args[0], args[1:])
+	}
+
+	if r.exec == nil {
+		return fmt.Errorf("commands are not available in this shell")
+	}
+	defer r.source.Invalidate()
+	return r.exec(append(r.globalArgs(), args...))
+}
+
+// globalArgs returns the global flags selecting the current connection
+// and output format. A saved connection is selected by its profile, so
+// its TLS settings apply, with the secret it resolved to.
+func (r *REPL) globalArgs() []string {
+	args := []string{"--output", string(r.format)}
+	if r.conn != nil {
+		if r.conn.Name != "" {
+			args = append(args, "--profile", r.conn.Name)
+			if r.configPath != "" {
+				args = append(args, "--config", r.configPath)
+			}
+		}
+		if r.conn.Server != "" {
+			args = append(args, "--server", r.conn.Server)
+		}
+		if r.conn.APIKeyID != "" {
+			args = append(args, "--api-key-id", r.conn.APIKeyID)
+		}
+		if r.conn.APIKey != "" {
+			args = append(args, "--api-key", r.conn.APIKey)
+		}
+	}
+	return args
+}
+
+// metaCommands lists the meta-commands with their usage.
+var metaCommands = map[string]string{
+	`\connect`:     `\connect NAME | SERVER [KEY_ID SECRET]   connect to a saved connection or a server`,
+	`\connections`: `\connections                             list saved connections`,
+	`\disconnect`:  `\disconnect                              drop the current connection`,
+	`\help`:        `\help                                    show this help`,
+	`\history`:     `\history [clear]                         show or clear the command history`,
+	`\output`:      `\output [table|json|yaml]                show or set the output format`,
+	`\q`:           `\q                                       exit (also exit, quit)`,
+	`\use`:         `\use NAME                                connect to a saved connection and make it the default`,
+}
+
+func metaCommandNames() []string {
+	names := make([]string, 0, len(metaCommands))
+	for name := range metaCommands {
+		names = append(names, name)
+	}
+	return names
+}
+
+// meta runs a meta-command.
+func (r *REPL) meta(name string, args []string) error {
+	switch name {
+	case `\connect`:
+		return r.metaConnect(args, false)
+	case `\use`:
+		if len(args) != 1 {
+			return fmt.Errorf("usage: \\use NAME")
+		}
+		return r.metaConnect(args, true)
+	case `\disconnect`:
+		if r.conn == nil {
+			fmt.Fprintln(r.output, "Not connected to any server")
+			return nil
+		}
+		r.conn = nil
+		fmt.Fprintln(r.output, "Disconnected")
+		return nil
+	case `\connections`:
+		return r.metaConnections()
+	case `\output`:
+		return r.metaOutput(args)
+	case `\history`:
+		return r.metaHistory(args)
+	case `\help`:
+		names := metaCommandNames()
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintln(r.output, "  "+metaCommands[n])
+		}
+		fmt.Fprintln(r.output, "Other lines run tokmesh-cli commands, e.g. 'session list'; 'help' lists them.")
+		return nil
+	default:
+		return fmt.Errorf("unknown meta-command %s (see \\help)", name)
+	}
+}
+
+// metaConnect switches to a saved connection, or with persist also makes
+// it the config's current connection. An argument that is not a saved
+// connection name is a server address, optionally followed by an API key
+// ID and secret.
+func (r *REPL) metaConnect(args []string, persist bool) error {
+	if len(args) == 0 {
+		if r.conn == nil {
+			fmt.Fprintln(r.output, "Not connected to any server")
+		} else {
+			fmt.Fprintf(r.output, "Connected to %s\n", r.label())
+		}
+		return nil
+	}
+
+	cfg, err := config.Load(r.configPath)
+	if err != nil {
+		return err
+	}
+
+	var conn *connection.Connection
+	if cc, ok := cfg.Connections[args[0]]; ok && len(args) == 1 {
+		conn, err = connection.FromProfile(context.Background(), args[0], cc)
+		if err != nil {
+			return err
+		}
+	} else if persist {
+		return fmt.Errorf("no saved connection %q", args[0])
+	} else {
+		if len(args) != 1 && len(args) != 3 {
+			return fmt.Errorf("usage: \\connect NAME | SERVER [KEY_ID SECRET]")
+		}
+		conn = &connection.Connection{Server: args[0]}
+		if len(args) == 3 {
+			conn.APIKeyID, conn.APIKey = args[1], args[2]
+		} else if r.conn != nil {
+			conn.APIKeyID, conn.APIKey = r.conn.APIKeyID, r.conn.APIKey
+		}
+	}
+
+	if persist {
+		cfg.CurrentConnection = conn.Name
+		if err := config.Save(cfg, r.configPath); err != nil {
+			return fmt.Errorf("save cli config: %w", err)
+		}
+	}
+
+	r.conn = conn
+	r.source.Invalidate()
+	fmt.Fprintf(r.output, "Connected to %s\n", r.label())
+	if err := r.ping(); err != nil {
+		fmt.Fprintf(r.output, "Warning: server not reachable: %v\n", err)
+	}
+	return nil
+}
+
+// ping checks that the current server answers its health endpoint, or
+// its local management socket its status command.
+func (r *REPL) ping() error {
+	if r.conn.Socket != "" {
+		_, err := connection.NewSocketClient(r.conn.Socket).Query("status", 5*time.Second)
+		return err
+	}
+
+	client, err := r.conn.HTTPClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := client.Get(ctx, "/health")
+	if err != nil {
+		return err
+	}
+	return connection.ParseResponse(resp, nil)
+}
+
+func (r *REPL) metaConnections() error {
+	cfg, err := config.Load(r.configPath)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Connections) == 0 {
+		fmt.Fprintln(r.output, "No saved connections")
+		return nil
+	}
+
+	type savedConn struct {
+		Name     string `json:"name"`
+		Server   string `json:"server"`
+		APIKeyID string `json:"api_key_id"`
+		Current  bool   `json:"current"`
+		Default  bool   `json:"default"`
+	}
+	conns := make([]savedConn, 0, len(cfg.Connections))
+	for _, name := range r.connectionNames() {
+		cc := cfg.Connections[name]
+		server := cc.Server
+		if cc.Socket != "" {
+			server = "unix://" + cc.Socket
+		}
+		conns = append(conns, savedConn{
+			Name:     name,
+			Server:   server,
+			APIKeyID: cc.APIKeyID,
+			Current:  r.conn != nil && r.conn.Name == name,
+			Default:  cfg.CurrentConnection == name,
+		})
+	}
+	return output.NewFormatter(r.format, false).Format(r.output, conns)
+}
+
+func (r *REPL) metaOutput(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(r.output, "Output format: %s\n", r.format)
+		return nil
+	}
+	format := output.Format(args[0])
+	switch format {
+	case output.FormatTable, output.FormatJSON, output.FormatYAML:
+	default:
+		return fmt.Errorf("unknown output format %q (table, json, yaml)", args[0])
+	}
+	r.format = format
+	fmt.Fprintf(r.output, "Output format: %s\n", r.format)
 	return nil
 }
+
+func (r *REPL) metaHistory(args []string) error {
+	switch {
+	case len(args) == 0:
+		for i, entry := range r.history.Entries() {
+			fmt.Fprintf(r.output, "%5d  %s\n", i+1, entry)
+		}
+		return nil
+	case len(args) == 1 && args[0] == "clear":
+		return r.history.Clear()
+	default:
+		return fmt.Errorf("usage: \\history [clear]")
+	}
+}
+
+// prompt returns the prompt, naming the current connection.
+func (r *REPL) prompt() string {
+	if r.conn == nil {
+		return "tokmesh> "
+	}
+	return "tokmesh:" + r.label() + "> "
+}
+
+// label names the current connection.
+func (r *REPL) label() string {
+	if r.conn.Name != "" {
+		return r.conn.Name
+	}
+	return r.conn.Server
+}
+
+// client returns an HTTP client for the current connection, or nil.
+func (r *REPL) client() *connection.HTTPClient {
+	if r.conn == nil {
+		return nil
+	}
+	client, err := r.conn.HTTPClient()
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// connectionNames returns the sorted names of the saved connections.
+func (r *REPL) connectionNames() []string {
+	cfg, err := config.Load(r.configPath)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Connections))
+	for name := range cfg.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitLine splits a command line into words like a POSIX shell: words
+// are separated by blanks, single quotes preserve everything literally,
+// and double quotes and backslashes escape as usual. A leading backslash
+// of a meta-command is kept.
+func splitLine(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for i, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case quote == '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(c)
+			}
+		case c == '\\' && i == 0:
+			word.WriteRune(c)
+			inWord = true
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// IsTerminal reports whether stdin and stdout are a terminal, i.e. whether
+// the REPL can offer line editing.
+func IsTerminal() bool {
+	return readline.DefaultIsTerminal()
+}
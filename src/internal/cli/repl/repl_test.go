@@ -2,8 +2,16 @@ package repl
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/config"
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+	"github.com/yndnr/tokmesh-go/internal/cli/output"
 )
 
 func TestNew(t *testing.T) {
@@ -146,3 +154,186 @@ func TestREPL_Run_WhitespaceHandling(t *testing.T) {
 		t.Errorf("command not trimmed properly: %q", history.Get(1))
 	}
 }
+
+// newTestREPL returns a REPL reading input, with a config file in a
+// temporary directory and an executor recording the commands it runs.
+func newTestREPL(t *testing.T, input string, cfg *config.CLIConfig) (*REPL, *bytes.Buffer, *[][]string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cli.yaml")
+	if cfg != nil {
+		if err := config.Save(cfg, path); err != nil {
+			t.Fatalf("Save config: %v", err)
+		}
+	}
+
+	var runs [][]string
+	out := &bytes.Buffer{}
+	r := New(
+		WithIO(strings.NewReader(input), out),
+		WithConfigPath(path),
+		WithExecutor(func(args []string) error {
+			runs = append(runs, args)
+			return nil
+		}),
+	)
+	r.history.file = filepath.Join(t.TempDir(), "history")
+	return r, out, &runs
+}
+
+func TestREPL_Execute_GlobalArgs(t *testing.T) {
+	r, _, runs := newTestREPL(t, "session get 'tmss-a b'\n\\output json\nsession list\n", nil)
+	r.conn = &connection.Connection{Server: "localhost:5080", APIKeyID: "tmak-1", APIKey: "tmas_secret"}
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	want := [][]string{
+		{"--output", "table", "--server", "localhost:5080", "--api-key-id", "tmak-1", "--api-key", "tmas_secret", "session", "get", "tmss-a b"},
+		{"--output", "json", "--server", "localhost:5080", "--api-key-id", "tmak-1", "--api-key", "tmas_secret", "session", "list"},
+	}
+	if !reflect.DeepEqual(*runs, want) {
+		t.Errorf("executed %q, want %q", *runs, want)
+	}
+}
+
+func TestREPL_Execute_ProfileArgs(t *testing.T) {
+	r, _, runs := newTestREPL(t, "session list\n", nil)
+	r.configPath = "/etc/tokmesh/cli.yaml"
+	r.conn = &connection.Connection{Name: "local", Socket: "/run/tokmesh/tokmesh.sock"}
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	want := [][]string{
+		{"--output", "table", "--profile", "local", "--config", "/etc/tokmesh/cli.yaml", "session", "list"},
+	}
+	if !reflect.DeepEqual(*runs, want) {
+		t.Errorf("executed %q, want %q", *runs, want)
+	}
+	if r.client() != nil {
+		t.Error("client() of a socket connection should be nil")
+	}
+}
+
+func TestREPL_Output(t *testing.T) {
+	r, out, _ := newTestREPL(t, "\\output yaml\n\\output xml\n\\output\n", nil)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if r.format != output.FormatYAML {
+		t.Errorf("format = %q, want yaml", r.format)
+	}
+	if !strings.Contains(out.String(), `unknown output format "xml"`) {
+		t.Errorf("output = %q, want unknown format error", out.String())
+	}
+}
+
+func TestREPL_ConnectAndUse(t *testing.T) {
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer health.Close()
+
+	cfg := config.Default()
+	cfg.Connections["dev"] = config.ConnectionConfig{Server: health.URL, APIKeyID: "tmak-dev", APIKey: "tmas_dev"}
+	cfg.Connections["prod"] = config.ConnectionConfig{Server: health.URL, APIKeyID: "tmak-prod", APIKey: "tmas_prod"}
+
+	r, out, _ := newTestREPL(t, "\\connect dev\nuse prod\n\\use missing\n", cfg)
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	if r.conn == nil || r.conn.Name != "prod" || r.conn.APIKeyID != "tmak-prod" {
+		t.Fatalf("conn = %+v, want prod", r.conn)
+	}
+	if r.prompt() != "tokmesh:prod> " {
+		t.Errorf("prompt = %q", r.prompt())
+	}
+	if strings.Contains(out.String(), "Warning") {
+		t.Errorf("output = %q, want no warning for a reachable server", out.String())
+	}
+	if !strings.Contains(out.String(), `no saved connection "missing"`) {
+		t.Errorf("output = %q, want missing connection error", out.String())
+	}
+
+	// \use makes the connection the default, so a new REPL starts on it.
+	saved, err := config.Load(r.configPath)
+	if err != nil {
+		t.Fatalf("Load config: %v", err)
+	}
+	if saved.CurrentConnection != "prod" {
+		t.Errorf("CurrentConnection = %q, want prod", saved.CurrentConnection)
+	}
+	r2 := New(WithConfigPath(r.configPath))
+	if r2.conn == nil || r2.conn.Name != "prod" {
+		t.Errorf("new REPL conn = %+v, want prod", r2.conn)
+	}
+}
+
+func TestREPL_ConnectServer(t *testing.T) {
+	r, out, _ := newTestREPL(t, "\\connect 127.0.0.1:1 tmak-1 tmas_s\n\\disconnect\n\\disconnect\n", nil)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{"Connected to 127.0.0.1:1", "Warning: server not reachable", "Disconnected", "Not connected to any server"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output = %q, missing %q", got, want)
+		}
+	}
+	if r.conn != nil {
+		t.Errorf("conn = %+v, want nil after disconnect", r.conn)
+	}
+	if strings.Contains(r.history.Get(2), "tmas_s") {
+		t.Errorf("history entry %q contains the secret", r.history.Get(2))
+	}
+}
+
+func TestREPL_Connections(t *testing.T) {
+	cfg := config.Default()
+	cfg.CurrentConnection = "dev"
+	cfg.Connections["dev"] = config.ConnectionConfig{Server: "dev:5080", APIKeyID: "tmak-dev"}
+
+	r, out, _ := newTestREPL(t, "\\output json\n\\connections\n", cfg)
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	for _, want := range []string{`"name": "dev"`, `"server": "dev:5080"`, `"current": true`, `"default": true`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output = %q, missing %q", out.String(), want)
+		}
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"session list", []string{"session", "list"}, false},
+		{"  session\tget   x ", []string{"session", "get", "x"}, false},
+		{`session create --data '{"a": "b c"}'`, []string{"session", "create", "--data", `{"a": "b c"}`}, false},
+		{`a "b \"c\" d" e\ f`, []string{"a", `b "c" d`, "e f"}, false},
+		{`\connect prod`, []string{`\connect`, "prod"}, false},
+		{`a ''`, []string{"a", ""}, false},
+		{`a 'b`, nil, true},
+		{`a b\`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package repl provides the interactive REPL mode for tokmesh-cli.
+package repl
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+)
+
+const (
+	// sourceCacheTTL is how long fetched IDs are reused, so pressing Tab
+	// repeatedly does not query the server each time.
+	sourceCacheTTL = 10 * time.Second
+
+	// sourceTimeout bounds a completion request; a slow server must not
+	// freeze the prompt.
+	sourceTimeout = 2 * time.Second
+
+	// sourceSessionLimit is the number of most recent sessions offered.
+	sourceSessionLimit = 100
+)
+
+// ServerSource fetches completion candidates from the server of the
+// current connection.
+type ServerSource struct {
+	client func() *connection.HTTPClient
+
+	mu    sync.Mutex
+	cache map[string]cachedIDs
+}
+
+type cachedIDs struct {
+	base    string
+	ids     []string
+	fetched time.Time
+}
+
+// NewServerSource creates a source querying the server returned by
+// client. A nil client disables live completion.
+func NewServerSource(client func() *connection.HTTPClient) *ServerSource {
+	return &ServerSource{
+		client: client,
+		cache:  make(map[string]cachedIDs),
+	}
+}
+
+// SessionIDs returns the IDs of the most recently created sessions.
+func (s *ServerSource) SessionIDs(ctx context.Context) ([]string, error) {
+	path := "/sessions?page_size=" + strconv.Itoa(sourceSessionLimit) + "&sort_by=created_at&sort_order=desc"
+	return s.fetch(ctx, path, func(c *connection.HTTPClient, path string) ([]string, error) {
+		var result struct {
+			Items []struct {
+				ID string `json:"id"`
+			} `json:"items"`
+		}
+		if err := get(ctx, c, path, &result); err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(result.Items))
+		for _, item := range result.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids, nil
+	})
+}
+
+// APIKeyIDs returns the IDs of all API keys.
+func (s *ServerSource) APIKeyIDs(ctx context.Context) ([]string, error) {
+	return s.fetch(ctx, "/admin/v1/keys", func(c *connection.HTTPClient, path string) ([]string, error) {
+		var result struct {
+			Keys []struct {
+				KeyID string `json:"key_id"`
+			} `json:"keys"`
+		}
+		if err := get(ctx, c, path, &result); err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(result.Keys))
+		for _, key := range result.Keys {
+			ids = append(ids, key.KeyID)
+		}
+		return ids, nil
+	})
+}
+
+// NodeIDs returns the IDs of the cluster nodes.
+func (s *ServerSource) NodeIDs(ctx context.Context) ([]string, error) {
+	return s.fetch(ctx, "/admin/v1/cluster/nodes", func(c *connection.HTTPClient, path string) ([]string, error) {
+		var result struct {
+			Nodes []struct {
+				NodeID string `json:"node_id"`
+			} `json:"nodes"`
+		}
+		if err := get(ctx, c, path, &result); err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(result.Nodes))
+		for _, node := range result.Nodes {
+			ids = append(ids, node.NodeID)
+		}
+		return ids, nil
+	})
+}
+
+// fetch returns the cached IDs for path, refreshing them when stale or
+// when the connection changed.
+func (s *ServerSource) fetch(ctx context.Context, path string, load func(*connection.HTTPClient, string) ([]string, error)) ([]string, error) {
+	if s.client == nil {
+		return nil, nil
+	}
+	c := s.client()
+	if c == nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.cache[path]; ok && e.base == c.BaseURL() && time.Since(e.fetched) < sourceCacheTTL {
+		return e.ids, nil
+	}
+	ids, err := load(c, path)
+	if err != nil {
+		return nil, err
+	}
+	s.cache[path] = cachedIDs{base: c.BaseURL(), ids: ids, fetched: time.Now()}
+	return ids, nil
+}
+
+// Invalidate drops cached IDs, e.g. after a command created or revoked
+// sessions. It is a no-op on a nil source.
+func (s *ServerSource) Invalidate() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.cache = make(map[string]cachedIDs)
+	s.mu.Unlock()
+}
+
+func get(ctx context.Context, c *connection.HTTPClient, path string, target any) error {
+	ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+	defer cancel()
+
+	resp, err := c.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	return connection.ParseResponse(resp, target)
+}
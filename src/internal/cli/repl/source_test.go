@@ -0,0 +1,71 @@
+package repl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/cli/connection"
+)
+
+func TestServerSource(t *testing.T) {
+	var sessionCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/sessions":
+			sessionCalls.Add(1)
+			if r.URL.Query().Get("page_size") != "100" {
+				t.Errorf("page_size = %q", r.URL.Query().Get("page_size"))
+			}
+			w.Write([]byte(`{"items":[{"id":"tmss-1"},{"id":"tmss-2"}],"total":2}`))
+		case "/admin/v1/keys":
+			w.Write([]byte(`{"keys":[{"key_id":"tmak-1"}]}`))
+		case "/admin/v1/cluster/nodes":
+			w.Write([]byte(`{"nodes":[{"node_id":"tmnd-1"},{"node_id":"tmnd-2"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := connection.NewHTTPClient(srv.URL, "tmak-1", "tmas_secret")
+	s := NewServerSource(func() *connection.HTTPClient { return client })
+	ctx := context.Background()
+
+	ids, err := s.SessionIDs(ctx)
+	if err != nil || !reflect.DeepEqual(ids, []string{"tmss-1", "tmss-2"}) {
+		t.Errorf("SessionIDs = %v, %v", ids, err)
+	}
+	ids, err = s.APIKeyIDs(ctx)
+	if err != nil || !reflect.DeepEqual(ids, []string{"tmak-1"}) {
+		t.Errorf("APIKeyIDs = %v, %v", ids, err)
+	}
+	ids, err = s.NodeIDs(ctx)
+	if err != nil || !reflect.DeepEqual(ids, []string{"tmnd-1", "tmnd-2"}) {
+		t.Errorf("NodeIDs = %v, %v", ids, err)
+	}
+
+	// Cached until invalidated.
+	_, _ = s.SessionIDs(ctx)
+	if n := sessionCalls.Load(); n != 1 {
+		t.Errorf("session requests = %d, want 1 (cached)", n)
+	}
+	s.Invalidate()
+	_, _ = s.SessionIDs(ctx)
+	if n := sessionCalls.Load(); n != 2 {
+		t.Errorf("session requests = %d, want 2 after Invalidate", n)
+	}
+}
+
+func TestServerSource_NotConnected(t *testing.T) {
+	s := NewServerSource(func() *connection.HTTPClient { return nil })
+
+	ids, err := s.SessionIDs(context.Background())
+	if err != nil || ids != nil {
+		t.Errorf("SessionIDs without connection = %v, %v", ids, err)
+	}
+}
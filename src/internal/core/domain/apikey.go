@@ -320,6 +320,10 @@ type APIKey struct {
 	// Description is an optional description.
 	Description string `json:"description,omitempty"`
 
+	// Durability is the default write durability of requests made with
+	// the key; empty follows the server's WAL sync mode.
+	Durability Durability `json:"durability,omitempty"`
+
 	// CreatedAt is the creation timestamp (Unix MS).
 	CreatedAt int64 `json:"created_at"`
 
@@ -505,6 +509,10 @@ func (k *APIKey) Validate() error {
 		violations = append(violations, "description exceeds 256 characters")
 	}
 
+	if !IsValidDurability(string(k.Durability)) {
+		violations = append(violations, "invalid durability")
+	}
+
 	if len(violations) > 0 {
 		return ErrAPIKeyValidation.WithDetails(strings.Join(violations, "; "))
 	}
@@ -0,0 +1,34 @@
+// Package domain defines the core domain models for TokMesh.
+package domain
+
+// Durability is how durable a write must be before it is acknowledged.
+//
+// @design DS-0102
+type Durability string
+
+const (
+	// DurabilityDefault follows the server's WAL sync mode.
+	DurabilityDefault Durability = ""
+
+	// DurabilityNone acknowledges a write once it is buffered in memory;
+	// a crash can lose it.
+	DurabilityNone Durability = "none"
+
+	// DurabilityBuffered acknowledges a write once it is handed to the
+	// operating system; it survives a crash of the process, not of the
+	// host.
+	DurabilityBuffered Durability = "buffered"
+
+	// DurabilityFsync acknowledges a write once it is fsynced to disk.
+	DurabilityFsync Durability = "fsync"
+)
+
+// IsValidDurability checks if a string is a valid durability level. The
+// empty string (DurabilityDefault) is valid.
+func IsValidDurability(s string) bool {
+	switch Durability(s) {
+	case DurabilityDefault, DurabilityNone, DurabilityBuffered, DurabilityFsync:
+		return true
+	}
+	return false
+}
@@ -153,7 +153,15 @@ func (s *Session) TTLDuration() time.Duration {
 // Touch updates the LastActive timestamp and optionally the access info.
 // Input strings are truncated to their maximum allowed lengths to prevent DoS attacks.
 func (s *Session) Touch(ip, userAgent string) {
-	s.LastActive = time.Now().UnixMilli()
+	s.TouchAt(time.Now().UnixMilli(), ip, userAgent)
+}
+
+// TouchAt is Touch with the access time given in Unix milliseconds, as
+// when a logged touch is applied again. LastActive never moves backwards.
+func (s *Session) TouchAt(lastActive int64, ip, userAgent string) {
+	if lastActive > s.LastActive {
+		s.LastActive = lastActive
+	}
 	if ip != "" {
 		// Truncate to prevent memory bloat from malicious input
 		if len(ip) > MaxIPAddressLength {
@@ -262,6 +270,25 @@ func (s *Session) DataSize() int {
 	return size
 }
 
+// PatchData applies a JSON Merge Patch (RFC 7396) to the Data map.
+// A nil value removes the key; any other value sets it.
+// The result is not validated; call Validate afterwards.
+func (s *Session) PatchData(patch map[string]*string) {
+	if len(patch) == 0 {
+		return
+	}
+	if s.Data == nil {
+		s.Data = make(map[string]string, len(patch))
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(s.Data, k)
+			continue
+		}
+		s.Data[k] = *v
+	}
+}
+
 // SetExpiration sets the expiration time from a TTL duration.
 func (s *Session) SetExpiration(ttl time.Duration) {
 	s.ExpiresAt = time.Now().Add(ttl).UnixMilli()
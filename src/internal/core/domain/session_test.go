@@ -311,6 +311,35 @@ func TestSession_DataSize(t *testing.T) {
 	}
 }
 
+func TestSession_PatchData(t *testing.T) {
+	session, _ := NewSession("user-123")
+	session.Data["keep"] = "1"
+	session.Data["drop"] = "2"
+
+	v := "new"
+	session.PatchData(map[string]*string{
+		"drop":  nil,
+		"added": &v,
+	})
+
+	if _, ok := session.Data["drop"]; ok {
+		t.Error("PatchData() should remove keys with nil values")
+	}
+	if session.Data["added"] != "new" {
+		t.Errorf("Data[added] = %q, want new", session.Data["added"])
+	}
+	if session.Data["keep"] != "1" {
+		t.Errorf("Data[keep] = %q, want 1", session.Data["keep"])
+	}
+
+	// Nil Data map is allocated on demand
+	session.Data = nil
+	session.PatchData(map[string]*string{"k": &v})
+	if session.Data["k"] != "new" {
+		t.Errorf("Data[k] = %q, want new", session.Data["k"])
+	}
+}
+
 func TestSession_SetExpiration(t *testing.T) {
 	session, _ := NewSession("user-123")
 	ttl := time.Hour
@@ -170,6 +170,40 @@ func (s *AuthService) ValidateAPIKey(ctx context.Context, req *ValidateAPIKeyReq
 	}, nil
 }
 
+// AuthenticateTrustedKeyRequest contains parameters for AuthenticateTrustedKey.
+type AuthenticateTrustedKeyRequest struct {
+	KeyID    string
+	ClientIP string
+}
+
+// AuthenticateTrustedKey returns an API key for a caller whose identity was
+// established out of band, e.g. by a verified TLS client certificate mapped
+// to the key. No secret is checked; status, expiry and IP allowlists still
+// apply.
+//
+// @design DS-0103
+func (s *AuthService) AuthenticateTrustedKey(ctx context.Context, req *AuthenticateTrustedKeyRequest) (*ValidateAPIKeyResponse, error) {
+	apiKey, err := s.repo.Get(ctx, req.KeyID)
+	if err != nil {
+		return nil, domain.ErrAPIKeyNotFound.WithCause(err)
+	}
+	if apiKey.Status != domain.KeyStatusActive {
+		return nil, domain.ErrAPIKeyDisabled
+	}
+	if apiKey.IsExpired() {
+		return nil, domain.ErrAPIKeyInvalid.WithDetails("api key expired")
+	}
+	if err := s.checkIPAllowlist(req.ClientIP, apiKey.Allowlist); err != nil {
+		return nil, err
+	}
+
+	apiKey.Touch()
+	return &ValidateAPIKeyResponse{
+		Valid:  true,
+		APIKey: apiKey,
+	}, nil
+}
+
 // CheckPermission checks if an API key has the required permission.
 // Reference: DS-0103 Section 5.4
 func (s *AuthService) CheckPermission(apiKey *domain.APIKey, perm domain.Permission) error {
@@ -502,6 +536,7 @@ type CreateAPIKeyRequest struct {
 	Name        string
 	Role        string
 	Description string
+	Durability  string // Default write durability; empty follows the server
 }
 
 // CreateAPIKeyResponse contains the result of creating an API key.
@@ -522,6 +557,10 @@ func (s *AuthService) CreateAPIKey(ctx context.Context, req *CreateAPIKeyRequest
 	}
 
 	apiKey.Description = req.Description
+	if !domain.IsValidDurability(req.Durability) {
+		return nil, domain.ErrInvalidArgument.WithDetails("durability must be one of: none, buffered, fsync")
+	}
+	apiKey.Durability = domain.Durability(req.Durability)
 
 	// Persist to storage
 	if err := s.repo.Create(ctx, apiKey); err != nil {
@@ -553,6 +592,7 @@ type APIKeyInfo struct {
 	Name        string
 	Role        string
 	Description string
+	Durability  string
 	Enabled     bool
 	CreatedAt   time.Time
 	LastUsedAt  time.Time
@@ -577,6 +617,7 @@ func (s *AuthService) ListAPIKeys(ctx context.Context, req *ListAPIKeysRequest)
 			Name:        key.Name,
 			Role:        string(key.Role),
 			Description: key.Description,
+			Durability:  string(key.Durability),
 			Enabled:     key.Status == domain.KeyStatusActive,
 			CreatedAt:   key.CreatedAtTime(),
 			LastUsedAt:  key.LastUsedAtTime(),
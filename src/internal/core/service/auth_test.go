@@ -91,6 +91,19 @@ func TestAuthService_CreateAPIKey(t *testing.T) {
 		}
 	})
 
+	t.Run("durability", func(t *testing.T) {
+		resp, err := svc.CreateAPIKey(ctx, &CreateAPIKeyRequest{Name: "fsync-key", Role: "issuer", Durability: "fsync"})
+		if err != nil {
+			t.Fatalf("CreateAPIKey failed: %v", err)
+		}
+		if key, _ := repo.Get(ctx, resp.KeyID); key.Durability != domain.DurabilityFsync {
+			t.Errorf("Durability = %q, want fsync", key.Durability)
+		}
+		if _, err := svc.CreateAPIKey(ctx, &CreateAPIKeyRequest{Name: "bad", Role: "issuer", Durability: "eventually"}); !domain.IsDomainError(err, "TM-ARG-1001") {
+			t.Errorf("CreateAPIKey with invalid durability = %v", err)
+		}
+	})
+
 	t.Run("create issuer key", func(t *testing.T) {
 		resp, err := svc.CreateAPIKey(ctx, &CreateAPIKeyRequest{
 			Name: "test-issuer-key",
@@ -772,6 +785,34 @@ func TestAuthService_CreateAPIKeyCustomRole(t *testing.T) {
 }
 
 // TestAuthService_ValidateAPIKeyWithCache tests cache behavior in validation.
+func TestAuthService_AuthenticateTrustedKey(t *testing.T) {
+	repo := newMockAPIKeyRepo()
+	svc := NewAuthService(repo, nil)
+	ctx := context.Background()
+
+	createResp, err := svc.CreateAPIKey(ctx, &CreateAPIKeyRequest{
+		Name: "gateway",
+		Role: "validator",
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	resp, err := svc.AuthenticateTrustedKey(ctx, &AuthenticateTrustedKeyRequest{KeyID: createResp.KeyID, ClientIP: "10.0.0.1"})
+	if err != nil || !resp.Valid || resp.APIKey.KeyID != createResp.KeyID {
+		t.Fatalf("AuthenticateTrustedKey = %+v, %v", resp, err)
+	}
+
+	if _, err := svc.AuthenticateTrustedKey(ctx, &AuthenticateTrustedKeyRequest{KeyID: "tmak-missing"}); !domain.IsDomainError(err, domain.ErrAPIKeyNotFound.Code) {
+		t.Errorf("missing key: got %v", err)
+	}
+
+	svc.UpdateAPIKeyStatus(ctx, &UpdateAPIKeyStatusRequest{KeyID: createResp.KeyID, Enabled: false})
+	if _, err := svc.AuthenticateTrustedKey(ctx, &AuthenticateTrustedKeyRequest{KeyID: createResp.KeyID}); !domain.IsDomainError(err, domain.ErrAPIKeyDisabled.Code) {
+		t.Errorf("disabled key: got %v", err)
+	}
+}
+
 func TestAuthService_ValidateAPIKeyWithCache(t *testing.T) {
 	repo := newMockAPIKeyRepo()
 	svc := NewAuthService(repo, nil)
@@ -0,0 +1,312 @@
+// Package service provides domain services for TokMesh.
+//
+// This file contains the bulk create, revoke and validate operations.
+//
+// Reference: specs/2-designs/DS-0103-核心服务层设计.md Section 3
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// MaxBatchSize is the maximum number of items accepted by a single bulk
+// operation.
+const MaxBatchSize = 1000
+
+// SessionBatchRepository is optionally implemented by a SessionRepository
+// that can persist several writes with a single durable commit (one WAL
+// group commit). Results are per item, in input order.
+//
+// When the repository does not implement it, bulk operations fall back to
+// one repository call per item.
+//
+// @design DS-0103
+type SessionBatchRepository interface {
+	// CreateBatch creates sessions and returns one error (or nil) per session.
+	CreateBatch(ctx context.Context, sessions []*domain.Session) []error
+
+	// DeleteBatch deletes sessions and returns one error (or nil) per ID.
+	DeleteBatch(ctx context.Context, ids []string) []error
+}
+
+// TokenBatchRepository is optionally implemented by a TokenRepository that
+// can persist several touch updates with a single durable commit.
+//
+// @design DS-0103
+type TokenBatchRepository interface {
+	// UpdateSessionBatch updates sessions and returns one error (or nil) per session.
+	UpdateSessionBatch(ctx context.Context, sessions []*domain.Session) []error
+}
+
+// SessionTouch is one touch of a bulk touch: LastActive (Unix
+// milliseconds), and the access IP and user agent when not empty.
+type SessionTouch struct {
+	ID         string
+	LastActive int64
+	IP         string
+	UserAgent  string
+}
+
+// SessionTouchBatchRepository is optionally implemented by a
+// SessionTouchRepository that can persist several touches with a single
+// durable commit.
+//
+// @design DS-0103
+type SessionTouchBatchRepository interface {
+	// TouchSessionBatch applies touches as TouchSession does and returns
+	// the updated sessions and one error (or nil) per touch.
+	TouchSessionBatch(ctx context.Context, touches []SessionTouch) ([]*domain.Session, []error)
+}
+
+// checkBatchSize rejects empty and oversized batches.
+func checkBatchSize(n int) error {
+	if n == 0 {
+		return domain.ErrMissingArgument.WithDetails("batch is empty")
+	}
+	if n > MaxBatchSize {
+		return domain.ErrInvalidArgument.WithDetails(
+			fmt.Sprintf("batch has %d items (max %d)", n, MaxBatchSize),
+		)
+	}
+	return nil
+}
+
+// CreateSessionBatchResult is the outcome of one item of a bulk create.
+// Exactly one of Response and Err is set.
+//
+// @design DS-0103
+type CreateSessionBatchResult struct {
+	Response *CreateSessionResponse
+	Err      error
+}
+
+// CreateBatch creates up to MaxBatchSize sessions.
+//
+// Each request is validated independently (a bad item does not fail the
+// batch); the valid sessions are then persisted together. Sessions earlier
+// in the batch count against the per-user quota of later ones.
+//
+// @req RQ-0102
+// @design DS-0103
+func (s *SessionService) CreateBatch(ctx context.Context, reqs []*CreateSessionRequest) ([]CreateSessionBatchResult, error) {
+	// 1. Validate batch
+	if err := checkBatchSize(len(reqs)); err != nil {
+		return nil, err
+	}
+
+	results := make([]CreateSessionBatchResult, len(reqs))
+
+	// 2. Build and validate each session
+	pending := make(map[string]int)
+	sessions := make([]*domain.Session, 0, len(reqs))
+	tokens := make([]string, 0, len(reqs))
+	index := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		if req == nil {
+			results[i].Err = domain.ErrMissingArgument.WithDetails("request is required")
+			continue
+		}
+		session, plainToken, err := s.newSession(ctx, req, pending[req.UserID])
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		pending[req.UserID]++
+		sessions = append(sessions, session)
+		tokens = append(tokens, plainToken)
+		index = append(index, i)
+	}
+
+	// 3. Persist valid sessions together
+	for j, err := range s.createSessions(ctx, sessions) {
+		i := index[j]
+		if err != nil {
+			results[i].Err = domain.ErrStorageError.WithCause(err)
+			continue
+		}
+		results[i].Response = &CreateSessionResponse{
+			SessionID: sessions[j].ID,
+			Token:     tokens[j],
+			ExpiresAt: sessions[j].ExpiresAt,
+			Session:   sessions[j],
+		}
+	}
+
+	return results, nil
+}
+
+// createSessions persists sessions, using a single commit when the
+// repository supports it.
+func (s *SessionService) createSessions(ctx context.Context, sessions []*domain.Session) []error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	if batch, ok := s.repo.(SessionBatchRepository); ok {
+		return batch.CreateBatch(ctx, sessions)
+	}
+
+	errs := make([]error, len(sessions))
+	for i, session := range sessions {
+		errs[i] = s.repo.Create(ctx, session)
+	}
+	return errs
+}
+
+// RevokeSessionBatchResult is the outcome of one item of a bulk revoke.
+//
+// @design DS-0103
+type RevokeSessionBatchResult struct {
+	// Revoked is false when the session did not exist (not an error:
+	// revocation is idempotent).
+	Revoked bool
+	Err     error
+}
+
+// RevokeBatch revokes up to MaxBatchSize sessions by ID.
+//
+// @req RQ-0102
+// @design DS-0103
+func (s *SessionService) RevokeBatch(ctx context.Context, sessionIDs []string) ([]RevokeSessionBatchResult, error) {
+	// 1. Validate batch
+	if err := checkBatchSize(len(sessionIDs)); err != nil {
+		return nil, err
+	}
+
+	results := make([]RevokeSessionBatchResult, len(sessionIDs))
+
+	ids := make([]string, 0, len(sessionIDs))
+	index := make([]int, 0, len(sessionIDs))
+	for i, id := range sessionIDs {
+		if id == "" {
+			results[i].Err = domain.ErrMissingArgument.WithDetails("session_id is required")
+			continue
+		}
+		ids = append(ids, id)
+		index = append(index, i)
+	}
+
+	// 2. Delete from storage together (幂等操作)
+	var errs []error
+	if batch, ok := s.repo.(SessionBatchRepository); ok && len(ids) > 0 {
+		errs = batch.DeleteBatch(ctx, ids)
+	} else {
+		errs = make([]error, len(ids))
+		for j, id := range ids {
+			errs[j] = s.repo.Delete(ctx, id)
+		}
+	}
+
+	revoked := make([]string, 0, len(ids))
+	for j, err := range errs {
+		i := index[j]
+		switch {
+		case err == nil:
+			results[i].Revoked = true
+			revoked = append(revoked, ids[j])
+		case domain.IsDomainError(err, "TM-SESS-4040"):
+			// Treat "not found" as success (idempotent)
+		default:
+			results[i].Err = domain.ErrStorageError.WithCause(err)
+		}
+	}
+	s.publish(SessionEventDeleted, revoked...)
+
+	return results, nil
+}
+
+// ValidateTokenBatchResult is the outcome of one item of a bulk validation.
+// Err is set when the token is not valid.
+//
+// @design DS-0103
+type ValidateTokenBatchResult struct {
+	Response *ValidateTokenResponse
+	Err      error
+}
+
+// ValidateBatch validates up to MaxBatchSize tokens.
+//
+// Touch updates requested by the batch are persisted together; as with
+// Validate, a failed touch does not invalidate the token.
+//
+// @req RQ-0103
+// @design DS-0103
+func (s *TokenService) ValidateBatch(ctx context.Context, reqs []*ValidateTokenRequest) ([]ValidateTokenBatchResult, error) {
+	// 1. Validate batch
+	if err := checkBatchSize(len(reqs)); err != nil {
+		return nil, err
+	}
+
+	results := make([]ValidateTokenBatchResult, len(reqs))
+
+	// 2. Resolve each token
+	var touched []*domain.Session
+	var index []int
+	for i, req := range reqs {
+		if req == nil {
+			results[i].Err = domain.ErrMissingArgument.WithDetails("request is required")
+			continue
+		}
+		session, err := s.lookup(ctx, req.Token)
+		if err != nil {
+			results[i] = ValidateTokenBatchResult{
+				Response: &ValidateTokenResponse{Valid: false},
+				Err:      err,
+			}
+			continue
+		}
+		results[i].Response = &ValidateTokenResponse{Valid: true, Session: session}
+		if req.Touch {
+			touched = append(touched, touchedClone(session, req))
+			index = append(index, i)
+		}
+	}
+
+	// 3. Persist touches together (best-effort)
+	if len(touched) == 0 {
+		return results, nil
+	}
+	var errs []error
+	if toucher, ok := s.repo.(SessionTouchBatchRepository); ok {
+		now := time.Now().UnixMilli()
+		touches := make([]SessionTouch, len(index))
+		for j, i := range index {
+			touches[j] = SessionTouch{ID: touched[j].ID, LastActive: now, IP: reqs[i].ClientIP, UserAgent: reqs[i].UserAgent}
+		}
+		updated, errs := toucher.TouchSessionBatch(ctx, touches)
+		for j, err := range errs {
+			if err == nil {
+				results[index[j]].Response.Session = updated[j]
+			}
+		}
+		return results, nil
+	}
+	if toucher, ok := s.repo.(SessionTouchRepository); ok {
+		now := time.Now().UnixMilli()
+		for j, i := range index {
+			req := reqs[i]
+			if updated, err := toucher.TouchSession(ctx, touched[j].ID, now, req.ClientIP, req.UserAgent); err == nil {
+				results[i].Response.Session = updated
+			}
+		}
+		return results, nil
+	}
+	if batch, ok := s.repo.(TokenBatchRepository); ok {
+		errs = batch.UpdateSessionBatch(ctx, touched)
+	} else {
+		errs = make([]error, len(touched))
+		for j, session := range touched {
+			errs[j] = s.repo.UpdateSession(ctx, session)
+		}
+	}
+	for j, err := range errs {
+		if err == nil {
+			results[index[j]].Response.Session = touched[j]
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,210 @@
+// Package service provides domain services for TokMesh.
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// mockBatchSessionRepo adds SessionBatchRepository to mockSessionRepo and
+// records how many batch commits were made.
+type mockBatchSessionRepo struct {
+	*mockSessionRepo
+	batches int
+}
+
+func (m *mockBatchSessionRepo) CreateBatch(ctx context.Context, sessions []*domain.Session) []error {
+	m.batches++
+	errs := make([]error, len(sessions))
+	for i, session := range sessions {
+		errs[i] = m.Create(ctx, session)
+	}
+	return errs
+}
+
+func (m *mockBatchSessionRepo) DeleteBatch(ctx context.Context, ids []string) []error {
+	m.batches++
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		errs[i] = m.Delete(ctx, id)
+	}
+	return errs
+}
+
+// mockBatchTokenRepo adds TokenBatchRepository to mockTokenRepo.
+type mockBatchTokenRepo struct {
+	*mockTokenRepo
+	batches int
+}
+
+func (m *mockBatchTokenRepo) UpdateSessionBatch(ctx context.Context, sessions []*domain.Session) []error {
+	m.batches++
+	errs := make([]error, len(sessions))
+	for i, session := range sessions {
+		errs[i] = m.UpdateSession(ctx, session)
+	}
+	return errs
+}
+
+func TestCheckBatchSize(t *testing.T) {
+	if err := checkBatchSize(0); !domain.IsDomainError(err, "TM-ARG-1002") {
+		t.Errorf("checkBatchSize(0) = %v, want TM-ARG-1002", err)
+	}
+	if err := checkBatchSize(MaxBatchSize); err != nil {
+		t.Errorf("checkBatchSize(max) = %v, want nil", err)
+	}
+	if err := checkBatchSize(MaxBatchSize + 1); !domain.IsDomainError(err, "TM-ARG-1001") {
+		t.Errorf("checkBatchSize(max+1) = %v, want TM-ARG-1001", err)
+	}
+}
+
+func TestSessionService_CreateBatch(t *testing.T) {
+	repo := &mockBatchSessionRepo{mockSessionRepo: newMockSessionRepo()}
+	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
+	svc := NewSessionService(repo, tokenSvc)
+
+	ctx := context.Background()
+
+	results, err := svc.CreateBatch(ctx, []*CreateSessionRequest{
+		{UserID: "user1", TTL: time.Hour},
+		{UserID: ""},
+		{UserID: "user2", Token: "not-a-token"},
+		{UserID: "user1", Data: map[string]string{"k": "v"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("len(results) = %d, want 4", len(results))
+	}
+
+	for _, i := range []int{0, 3} {
+		if results[i].Err != nil || results[i].Response == nil {
+			t.Fatalf("results[%d] = %+v, want success", i, results[i])
+		}
+		if results[i].Response.Token == "" {
+			t.Errorf("results[%d] should include the plaintext token", i)
+		}
+	}
+	if !domain.IsDomainError(results[1].Err, "TM-ARG-1002") {
+		t.Errorf("results[1].Err = %v, want TM-ARG-1002", results[1].Err)
+	}
+	if !domain.IsDomainError(results[2].Err, "TM-TOKN-4000") {
+		t.Errorf("results[2].Err = %v, want TM-TOKN-4000", results[2].Err)
+	}
+
+	if repo.batches != 1 {
+		t.Errorf("batch commits = %d, want 1", repo.batches)
+	}
+	if len(repo.sessions) != 2 {
+		t.Errorf("stored sessions = %d, want 2", len(repo.sessions))
+	}
+}
+
+func TestSessionService_CreateBatch_QuotaWithinBatch(t *testing.T) {
+	repo := newMockSessionRepo()
+	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
+	svc := NewSessionService(repo, tokenSvc)
+
+	reqs := make([]*CreateSessionRequest, domain.MaxSessionsPerUser+1)
+	for i := range reqs {
+		reqs[i] = &CreateSessionRequest{UserID: "quota-user"}
+	}
+
+	results, err := svc.CreateBatch(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	last := results[len(results)-1]
+	if !domain.IsDomainError(last.Err, "TM-SESS-4002") {
+		t.Errorf("last result = %v, want TM-SESS-4002", last.Err)
+	}
+	if results[0].Err != nil {
+		t.Errorf("first result = %v, want success", results[0].Err)
+	}
+}
+
+func TestSessionService_CreateBatch_TooLarge(t *testing.T) {
+	svc := NewSessionService(newMockSessionRepo(), NewTokenService(newMockTokenRepo(), nil))
+
+	_, err := svc.CreateBatch(context.Background(), make([]*CreateSessionRequest, MaxBatchSize+1))
+	if !domain.IsDomainError(err, "TM-ARG-1001") {
+		t.Errorf("expected TM-ARG-1001, got %v", err)
+	}
+}
+
+func TestSessionService_RevokeBatch(t *testing.T) {
+	repo := &mockBatchSessionRepo{mockSessionRepo: newMockSessionRepo()}
+	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
+	svc := NewSessionService(repo, tokenSvc)
+
+	ctx := context.Background()
+
+	created, err := svc.Create(ctx, &CreateSessionRequest{UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	results, err := svc.RevokeBatch(ctx, []string{created.SessionID, "missing", ""})
+	if err != nil {
+		t.Fatalf("RevokeBatch failed: %v", err)
+	}
+
+	if !results[0].Revoked || results[0].Err != nil {
+		t.Errorf("results[0] = %+v, want revoked", results[0])
+	}
+	if results[1].Revoked || results[1].Err != nil {
+		t.Errorf("results[1] = %+v, want idempotent success", results[1])
+	}
+	if !domain.IsDomainError(results[2].Err, "TM-ARG-1002") {
+		t.Errorf("results[2].Err = %v, want TM-ARG-1002", results[2].Err)
+	}
+	if repo.batches != 1 {
+		t.Errorf("batch commits = %d, want 1", repo.batches)
+	}
+}
+
+func TestTokenService_ValidateBatch(t *testing.T) {
+	tokenRepo := &mockBatchTokenRepo{mockTokenRepo: newMockTokenRepo()}
+	svc := NewTokenService(tokenRepo, nil)
+
+	ctx := context.Background()
+
+	token, hash, _ := svc.GenerateToken()
+	session, _ := domain.NewSession("user1")
+	session.TokenHash = hash
+	session.SetExpiration(time.Hour)
+	session.LastActive = 0
+	tokenRepo.AddSession(session)
+
+	otherToken, _, _ := svc.GenerateToken()
+
+	results, err := svc.ValidateBatch(ctx, []*ValidateTokenRequest{
+		{Token: token, Touch: true, ClientIP: "10.0.0.1"},
+		{Token: otherToken},
+		{Token: "garbage"},
+	})
+	if err != nil {
+		t.Fatalf("ValidateBatch failed: %v", err)
+	}
+
+	if results[0].Err != nil || !results[0].Response.Valid {
+		t.Fatalf("results[0] = %+v, want valid", results[0])
+	}
+	if results[0].Response.Session.LastAccessIP != "10.0.0.1" {
+		t.Errorf("touched session LastAccessIP = %q, want 10.0.0.1", results[0].Response.Session.LastAccessIP)
+	}
+	if !domain.IsDomainError(results[1].Err, "TM-TOKN-4010") || results[1].Response.Valid {
+		t.Errorf("results[1] = %+v, want TM-TOKN-4010", results[1])
+	}
+	if !domain.IsDomainError(results[2].Err, "TM-TOKN-4000") {
+		t.Errorf("results[2].Err = %v, want TM-TOKN-4000", results[2].Err)
+	}
+	if tokenRepo.batches != 1 {
+		t.Errorf("batch commits = %d, want 1", tokenRepo.batches)
+	}
+}
@@ -0,0 +1,29 @@
+// Package service provides domain services for TokMesh.
+package service
+
+import (
+	"context"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// durabilityKey is the context key for the requested write durability.
+type durabilityKey struct{}
+
+// WithDurability returns a context requesting durability d for the
+// writes made with it. DurabilityDefault leaves ctx unchanged.
+//
+// @design DS-0102
+func WithDurability(ctx context.Context, d domain.Durability) context.Context {
+	if d == domain.DurabilityDefault {
+		return ctx
+	}
+	return context.WithValue(ctx, durabilityKey{}, d)
+}
+
+// DurabilityFromContext returns the write durability requested by ctx,
+// or DurabilityDefault.
+func DurabilityFromContext(ctx context.Context) domain.Durability {
+	d, _ := ctx.Value(durabilityKey{}).(domain.Durability)
+	return d
+}
@@ -0,0 +1,166 @@
+// Package service provides domain services for TokMesh.
+//
+// This file contains tracking for long-running background jobs.
+//
+// Reference: specs/2-designs/DS-0103-核心服务层设计.md Section 3
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// JobIDPrefix is the prefix of background job IDs.
+const JobIDPrefix = "tmjb-"
+
+// DefaultJobRetention is the number of jobs JobManager remembers.
+const DefaultJobRetention = 100
+
+// JobState is the lifecycle state of a background job.
+type JobState string
+
+// Job states.
+const (
+	JobStateRunning   JobState = "running"
+	JobStateSucceeded JobState = "succeeded"
+	JobStateFailed    JobState = "failed"
+)
+
+// Job is a snapshot of a background job.
+//
+// @design DS-0103
+type Job struct {
+	ID         string
+	Kind       string // e.g. "revoke_query"
+	State      JobState
+	Total      int // Expected items, if known
+	Done       int // Items processed so far
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt time.Time // Zero while running
+}
+
+// JobFunc is the body of a background job. It reports progress through
+// progress and returns when the job is finished.
+type JobFunc func(ctx context.Context, progress func(done int)) error
+
+// JobManager runs background jobs and keeps their status for polling.
+//
+// Only the most recent jobs are retained; older finished jobs are
+// forgotten. Jobs run to completion independently of the request that
+// started them.
+//
+// @design DS-0103
+type JobManager struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	order     []string // Job IDs, oldest first
+	retention int
+	wg        sync.WaitGroup
+}
+
+// NewJobManager creates a JobManager retaining up to retention jobs
+// (DefaultJobRetention if <= 0).
+func NewJobManager(retention int) *JobManager {
+	if retention <= 0 {
+		retention = DefaultJobRetention
+	}
+	return &JobManager{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+	}
+}
+
+// Start runs fn in the background and returns the new job's snapshot.
+func (m *JobManager) Start(kind string, total int, fn JobFunc) (Job, error) {
+	id, err := generateJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:        id,
+		Kind:      kind,
+		State:     JobStateRunning,
+		Total:     total,
+		CreatedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = job
+	m.order = append(m.order, id)
+	m.evictLocked()
+	snapshot := *job
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		err := fn(context.Background(), func(done int) {
+			m.mu.Lock()
+			job.Done = done
+			m.mu.Unlock()
+		})
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		job.FinishedAt = time.Now()
+		if err != nil {
+			job.State = JobStateFailed
+			job.Error = err.Error()
+			return
+		}
+		job.State = JobStateSucceeded
+	}()
+
+	return snapshot, nil
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Wait blocks until all started jobs have finished.
+func (m *JobManager) Wait() {
+	m.wg.Wait()
+}
+
+// evictLocked drops the oldest finished jobs beyond the retention limit.
+// Running jobs are never evicted.
+func (m *JobManager) evictLocked() {
+	for i := 0; len(m.jobs) > m.retention && i < len(m.order); {
+		id := m.order[i]
+		if m.jobs[id].State == JobStateRunning {
+			i++
+			continue
+		}
+		delete(m.jobs, id)
+		m.order = append(m.order[:i], m.order[i+1:]...)
+	}
+}
+
+// generateJobID generates a new job ID using ULID.
+// Format: tmjb-{ulid_lowercase}.
+func generateJobID() (string, error) {
+	entropy := ulid.Monotonic(rand.Reader, 0)
+	id, err := ulid.New(ulid.Timestamp(time.Now()), entropy)
+	if err != nil {
+		return "", domain.ErrInternalServer.WithCause(err)
+	}
+	return JobIDPrefix + strings.ToLower(id.String()), nil
+}
@@ -7,6 +7,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -23,7 +24,10 @@ type SessionRepository interface {
 	// Get retrieves a session by ID.
 	Get(ctx context.Context, id string) (*domain.Session, error)
 
-	// Update updates an existing session (with optimistic locking).
+	// Update updates an existing session (with optimistic locking). It
+	// fails with ErrSessionVersionConflict unless the stored version is
+	// expectedVersion, and sets session.Version to the new version,
+	// expectedVersion+1.
 	Update(ctx context.Context, session *domain.Session, expectedVersion uint64) error
 
 	// Delete deletes a session by ID.
@@ -45,22 +49,46 @@ type SessionRepository interface {
 	DeleteExpired(ctx context.Context) (int, error)
 }
 
+// SessionCountRepository is optionally implemented by a repository that
+// can count its sessions without listing them.
+//
+// @design DS-0103
+type SessionCountRepository interface {
+	// Count returns the number of stored sessions, which may include
+	// expired sessions not yet removed by cleanup.
+	Count(ctx context.Context) int
+}
+
 // SessionFilter defines filter criteria for session queries.
 //
 // @design DS-0103
 type SessionFilter struct {
-	UserID        string
-	DeviceID      string
-	CreatedBy     string // API Key ID
-	IPAddress     string
-	Status        string     // "active" or "expired"
-	CreatedAfter  *time.Time
-	CreatedBefore *time.Time
-	ActiveAfter   *time.Time
-	SortBy        string // "created_at" (default) or "last_active"
-	SortOrder     string // "desc" (default) or "asc"
-	Page          int    // 1-indexed
-	PageSize      int    // default 20, max 100
+	UserID         string
+	DeviceID       string
+	DeviceIDPrefix string
+	CreatedBy      string // API Key ID
+	IPAddress      string
+	Data           map[string]string // Every key/value pair must match exactly
+	Status         string            // "active" or "expired"
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	ActiveAfter    *time.Time
+	ExpiresWithin  time.Duration // Only sessions expiring within this window
+	SortBy         string        // "created_at" (default) or "last_active"
+	SortOrder      string        // "desc" (default) or "asc"
+	Page           int           // 1-indexed
+	PageSize       int           // default 20, max 100
+
+	// Cursor is the opaque keyset cursor returned by a previous page.
+	// Setting Cursor or Limit switches the listing to keyset pagination,
+	// in which case Page/PageSize are ignored and no total is computed.
+	Cursor string
+	Limit  int // default 20, max 100
+}
+
+// Keyset reports whether the filter requests keyset (cursor) pagination.
+func (f *SessionFilter) Keyset() bool {
+	return f.Cursor != "" || f.Limit > 0
 }
 
 // SessionService handles session lifecycle operations.
@@ -70,6 +98,7 @@ type SessionFilter struct {
 type SessionService struct {
 	repo         SessionRepository
 	tokenService *TokenService
+	listeners    sessionListeners
 }
 
 // NewSessionService creates a new SessionService.
@@ -115,19 +144,44 @@ type CreateSessionResponse struct {
 // @req RQ-0102
 // @design DS-0103
 func (s *SessionService) Create(ctx context.Context, req *CreateSessionRequest) (*CreateSessionResponse, error) {
+	// 1-5. Build and validate the session
+	session, plainToken, err := s.newSession(ctx, req, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. Persist to storage
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, domain.ErrStorageError.WithCause(err)
+	}
+
+	// 7. Return response (including plaintext token)
+	return &CreateSessionResponse{
+		SessionID: session.ID,
+		Token:     plainToken,
+		ExpiresAt: session.ExpiresAt,
+		Session:   session,
+	}, nil
+}
+
+// newSession builds and validates the session for a create request without
+// persisting it. pending is the number of sessions for the same user that
+// are about to be created alongside it and count against the quota.
+func (s *SessionService) newSession(ctx context.Context, req *CreateSessionRequest, pending int) (*domain.Session, string, error) {
 	// 1. Validate required fields
 	if req.UserID == "" {
-		return nil, domain.ErrMissingArgument.WithDetails("user_id is required")
+		return nil, "", domain.ErrMissingArgument.WithDetails("user_id is required")
 	}
 
 	// 2. Check user quota (max 50 sessions per user)
 	count, err := s.repo.CountByUserID(ctx, req.UserID)
 	if err != nil {
-		return nil, domain.ErrStorageError.WithCause(err)
+		return nil, "", domain.ErrStorageError.WithCause(err)
 	}
+	count += pending
 
 	if count >= domain.MaxSessionsPerUser {
-		return nil, domain.ErrSessionQuotaExceeded.WithDetails(
+		return nil, "", domain.ErrSessionQuotaExceeded.WithDetails(
 			fmt.Sprintf("user has %d sessions (max %d)", count, domain.MaxSessionsPerUser),
 		)
 	}
@@ -137,7 +191,7 @@ func (s *SessionService) Create(ctx context.Context, req *CreateSessionRequest)
 	if req.Token != "" {
 		// Client provided token, validate format
 		if !domain.ValidateTokenFormat(req.Token) {
-			return nil, domain.ErrTokenMalformed.WithDetails("provided token format is invalid")
+			return nil, "", domain.ErrTokenMalformed.WithDetails("provided token format is invalid")
 		}
 		plainToken = req.Token
 		tokenHash = s.tokenService.ComputeTokenHash(plainToken)
@@ -146,14 +200,14 @@ func (s *SessionService) Create(ctx context.Context, req *CreateSessionRequest)
 		var err error
 		plainToken, tokenHash, err = s.tokenService.GenerateToken()
 		if err != nil {
-			return nil, domain.ErrInternalServer.WithCause(err)
+			return nil, "", domain.ErrInternalServer.WithCause(err)
 		}
 	}
 
 	// 4. Create session entity
 	session, err := domain.NewSession(req.UserID)
 	if err != nil {
-		return nil, domain.ErrInternalServer.WithCause(err)
+		return nil, "", domain.ErrInternalServer.WithCause(err)
 	}
 
 	// Set fields
@@ -178,21 +232,10 @@ func (s *SessionService) Create(ctx context.Context, req *CreateSessionRequest)
 
 	// 5. Validate session
 	if err := session.Validate(); err != nil {
-		return nil, err
-	}
-
-	// 6. Persist to storage
-	if err := s.repo.Create(ctx, session); err != nil {
-		return nil, domain.ErrStorageError.WithCause(err)
+		return nil, "", err
 	}
 
-	// 7. Return response (including plaintext token)
-	return &CreateSessionResponse{
-		SessionID: session.ID,
-		Token:     plainToken,
-		ExpiresAt: session.ExpiresAt,
-		Session:   session,
-	}, nil
+	return session, plainToken, nil
 }
 
 // ============================================================================
@@ -246,10 +289,28 @@ type ListSessionsRequest struct {
 //
 // @design DS-0103
 type ListSessionsResponse struct {
-	Items    []*domain.Session
-	Total    int
-	Page     int
-	PageSize int
+	Items      []*domain.Session
+	Total      int // -1 in keyset mode, where counting every match is not done
+	Page       int
+	PageSize   int
+	NextCursor string // Empty when there are no further keyset pages
+}
+
+// Count returns the number of stored sessions, which may include expired
+// sessions not yet removed by cleanup. It counts through the repository
+// when it implements SessionCountRepository, and otherwise takes the
+// total of a one-item listing.
+//
+// @design DS-0103
+func (s *SessionService) Count(ctx context.Context) (int, error) {
+	if counter, ok := s.repo.(SessionCountRepository); ok {
+		return counter.Count(ctx), nil
+	}
+	_, total, err := s.repo.List(ctx, &SessionFilter{Page: 1, PageSize: 1})
+	if err != nil {
+		return 0, domain.ErrStorageError.WithCause(err)
+	}
+	return total, nil
 }
 
 // List retrieves sessions matching the filter criteria.
@@ -263,6 +324,23 @@ func (s *SessionService) List(ctx context.Context, req *ListSessionsRequest) (*L
 	}
 
 	// Set defaults
+	if filter.SortBy == "" {
+		filter.SortBy = "created_at"
+	}
+	if filter.SortOrder == "" {
+		filter.SortOrder = "desc"
+	}
+	if filter.SortBy != "created_at" && filter.SortBy != "last_active" {
+		return nil, domain.ErrInvalidArgument.WithDetails("sort_by must be created_at or last_active")
+	}
+	if filter.SortOrder != "asc" && filter.SortOrder != "desc" {
+		return nil, domain.ErrInvalidArgument.WithDetails("sort_order must be asc or desc")
+	}
+
+	if filter.Keyset() {
+		return s.listKeyset(ctx, filter)
+	}
+
 	if filter.Page == 0 {
 		filter.Page = 1
 	}
@@ -271,12 +349,6 @@ func (s *SessionService) List(ctx context.Context, req *ListSessionsRequest) (*L
 	} else if filter.PageSize > 100 {
 		filter.PageSize = 100 // Max 100 per page
 	}
-	if filter.SortBy == "" {
-		filter.SortBy = "created_at"
-	}
-	if filter.SortOrder == "" {
-		filter.SortOrder = "desc"
-	}
 
 	// Query storage
 	items, total, err := s.repo.List(ctx, filter)
@@ -292,6 +364,49 @@ func (s *SessionService) List(ctx context.Context, req *ListSessionsRequest) (*L
 	}, nil
 }
 
+// listKeyset serves a keyset-paginated listing.
+//
+// One extra row is requested from storage to learn whether another page
+// exists without counting the full result set.
+func (s *SessionService) listKeyset(ctx context.Context, filter *SessionFilter) (*ListSessionsResponse, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := DecodeSessionCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != filter.SortBy || cursor.SortOrder != filter.SortOrder {
+			return nil, domain.ErrInvalidArgument.WithDetails("cursor does not match sort_by/sort_order")
+		}
+	}
+
+	query := *filter
+	query.Limit = limit + 1
+	items, _, err := s.repo.List(ctx, &query)
+	if err != nil {
+		return nil, domain.ErrStorageError.WithCause(err)
+	}
+
+	var next string
+	if len(items) > limit {
+		items = items[:limit]
+		next = NewSessionCursor(items[limit-1], filter.SortBy, filter.SortOrder).Encode()
+	}
+
+	return &ListSessionsResponse{
+		Items:      items,
+		Total:      -1,
+		PageSize:   limit,
+		NextCursor: next,
+	}, nil
+}
+
 // ============================================================================
 // Session Update Operation
 // ============================================================================
@@ -358,7 +473,6 @@ func (s *SessionService) Update(ctx context.Context, req *UpdateSessionRequest)
 	}
 
 	session.LastActive = time.Now().UnixMilli()
-	session.IncrVersion()
 
 	// 5. Validate session
 	if err := session.Validate(); err != nil {
@@ -374,3 +488,129 @@ func (s *SessionService) Update(ctx context.Context, req *UpdateSessionRequest)
 		Session: session,
 	}, nil
 }
+
+// ============================================================================
+// Session Patch Operation
+// ============================================================================
+
+// patchRetryLimit bounds retries of unconditional patches that lose an
+// optimistic-locking race to a concurrent writer.
+const patchRetryLimit = 3
+
+// PatchSessionRequest contains parameters for a partial session update.
+// Used by PATCH /sessions/{id} and the TM.HSET/TM.HDEL commands.
+//
+// @design DS-0301
+type PatchSessionRequest struct {
+	SessionID string
+
+	// Data is a JSON Merge Patch for the Data map: a nil value deletes
+	// the key, any other value sets it.
+	Data map[string]*string
+
+	// ClearData removes all Data keys before Data is applied
+	// ("data": null in a merge patch document).
+	ClearData bool
+
+	// DeviceID replaces the device ID when non-nil ("" clears it).
+	DeviceID *string
+
+	// ExpectedVersion makes the patch conditional on the current
+	// Session.Version (compare-and-set). Zero applies unconditionally.
+	ExpectedVersion uint64
+}
+
+// PatchSessionResponse contains the result of a session patch.
+//
+// @design DS-0301
+type PatchSessionResponse struct {
+	Session *domain.Session
+
+	// DataAdded and DataRemoved count Data keys that did not exist before
+	// the patch and keys that were deleted by it.
+	DataAdded   int
+	DataRemoved int
+}
+
+// Patch atomically applies a partial update to a session.
+//
+// With ExpectedVersion set, the patch fails with TM-SESS-4091 unless the
+// session is still at that version. Without it, the patch is re-applied
+// to fresh data if a concurrent writer wins the race.
+// The resulting Data must respect MaxDataTotalSize.
+//
+// @req RQ-0102
+// @design DS-0301
+func (s *SessionService) Patch(ctx context.Context, req *PatchSessionRequest) (*PatchSessionResponse, error) {
+	// 1. Validate input
+	if req.SessionID == "" {
+		return nil, domain.ErrMissingArgument.WithDetails("session_id is required")
+	}
+
+	for attempt := 1; ; attempt++ {
+		// 2. Get existing session
+		session, err := s.repo.Get(ctx, req.SessionID)
+		if err != nil {
+			return nil, domain.ErrSessionNotFound.WithCause(err)
+		}
+
+		// 3. Check if expired or deleted
+		if session.IsExpired() {
+			return nil, domain.ErrSessionExpired
+		}
+		if session.IsDeleted {
+			return nil, domain.ErrSessionNotFound
+		}
+
+		// 4. Compare-and-set precondition
+		if req.ExpectedVersion != 0 && session.Version != req.ExpectedVersion {
+			return nil, domain.ErrSessionVersionConflict.WithDetails(
+				fmt.Sprintf("expected version %d, current version %d", req.ExpectedVersion, session.Version),
+			)
+		}
+
+		// 5. Apply patch
+		oldVersion := session.Version
+		before := session.Data
+		if req.ClearData {
+			session.Data = make(map[string]string)
+		} else {
+			session.Data = make(map[string]string, len(before))
+			for k, v := range before {
+				session.Data[k] = v
+			}
+		}
+		session.PatchData(req.Data)
+		if req.DeviceID != nil {
+			session.DeviceID = *req.DeviceID
+		}
+
+		// 6. Validate session (enforces MaxDataTotalSize)
+		if err := session.Validate(); err != nil {
+			return nil, err
+		}
+
+		// 7. Persist with optimistic locking
+		err = s.repo.Update(ctx, session, oldVersion)
+		if err == nil {
+			resp := &PatchSessionResponse{Session: session}
+			for k := range session.Data {
+				if _, ok := before[k]; !ok {
+					resp.DataAdded++
+				}
+			}
+			for k := range before {
+				if _, ok := session.Data[k]; !ok {
+					resp.DataRemoved++
+				}
+			}
+			return resp, nil
+		}
+		if !errors.Is(err, domain.ErrSessionVersionConflict) {
+			return nil, domain.ErrStorageError.WithCause(err)
+		}
+		if req.ExpectedVersion != 0 || attempt >= patchRetryLimit {
+			return nil, domain.ErrSessionVersionConflict.WithCause(err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package service provides domain services for TokMesh.
+//
+// This file contains the keyset cursor used for session listing.
+//
+// Reference: specs/2-designs/DS-0103-核心服务层设计.md Section 3
+package service
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// sessionCursorVersion is bumped whenever the cursor layout changes so that
+// stale cursors are rejected instead of being misinterpreted.
+const sessionCursorVersion = "v1"
+
+// SessionCursor is the decoded position of a keyset-paginated session listing.
+//
+// A page continues strictly after (Value, ID) in the requested sort order,
+// where Value is the sort column (created_at or last_active, Unix ms) and
+// ID breaks ties. Because positions are keys rather than offsets, pages
+// stay stable while sessions are concurrently created or revoked.
+//
+// @design DS-0103
+type SessionCursor struct {
+	SortBy    string
+	SortOrder string
+	Value     int64
+	ID        string
+}
+
+// NewSessionCursor builds the cursor that resumes after the given session.
+func NewSessionCursor(session *domain.Session, sortBy, sortOrder string) *SessionCursor {
+	return &SessionCursor{
+		SortBy:    sortBy,
+		SortOrder: sortOrder,
+		Value:     SessionSortValue(session, sortBy),
+		ID:        session.ID,
+	}
+}
+
+// Encode returns the opaque, URL-safe representation of the cursor.
+func (c *SessionCursor) Encode() string {
+	raw := strings.Join([]string{
+		sessionCursorVersion,
+		c.SortBy,
+		c.SortOrder,
+		strconv.FormatInt(c.Value, 10),
+		c.ID,
+	}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeSessionCursor parses a cursor produced by Encode.
+// Returns TM-ARG-1001 if the cursor is malformed.
+func DecodeSessionCursor(s string) (*SessionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, domain.ErrInvalidArgument.WithDetails("malformed cursor")
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 5 || parts[0] != sessionCursorVersion || parts[4] == "" {
+		return nil, domain.ErrInvalidArgument.WithDetails("malformed cursor")
+	}
+
+	value, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, domain.ErrInvalidArgument.WithDetails("malformed cursor")
+	}
+
+	return &SessionCursor{
+		SortBy:    parts[1],
+		SortOrder: parts[2],
+		Value:     value,
+		ID:        parts[4],
+	}, nil
+}
+
+// SessionSortValue returns the value of the sort column for a session.
+func SessionSortValue(session *domain.Session, sortBy string) int64 {
+	if sortBy == "last_active" {
+		return session.LastActive
+	}
+	return session.CreatedAt
+}
@@ -0,0 +1,93 @@
+// Package service provides business logic services for TokMesh.
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// SessionEventType identifies how a session was removed. Values match the
+// event names of Redis keyspace notifications.
+type SessionEventType string
+
+const (
+	// SessionEventDeleted is published when a session is revoked.
+	SessionEventDeleted SessionEventType = "del"
+	// SessionEventExpired is published when GC removes an expired session.
+	SessionEventExpired SessionEventType = "expired"
+)
+
+// SessionEvent reports that a session stopped being valid, so caches of
+// its validation can be invalidated.
+type SessionEvent struct {
+	Type      SessionEventType
+	SessionID string
+}
+
+// SessionListener receives session events after the change is stored.
+// Listeners run synchronously on the goroutine making the change and must
+// not block.
+type SessionListener func(events []SessionEvent)
+
+// ExpiredSessionRepository is optionally implemented by a SessionRepository
+// that can report which sessions DeleteExpired removed. Without it, GC
+// cannot publish expiration events.
+//
+// @design DS-0103
+type ExpiredSessionRepository interface {
+	// DeleteExpiredSessions deletes all expired sessions and returns them.
+	DeleteExpiredSessions(ctx context.Context) ([]*domain.Session, error)
+}
+
+// sessionListeners is the set of listeners of a SessionService.
+type sessionListeners struct {
+	mu        sync.RWMutex
+	listeners []SessionListener
+}
+
+// AddListener registers a listener for revocations and expirations.
+//
+// Changes made through this service are published, including revoke
+// queries replicated from other cluster nodes, which are run through
+// RevokeByQuery. Removals made directly in storage, such as sessions
+// cleaned up after their shard migrated away, are published by whoever
+// makes them with PublishDeleted.
+//
+// @design DS-0103
+func (s *SessionService) AddListener(l SessionListener) {
+	s.listeners.mu.Lock()
+	defer s.listeners.mu.Unlock()
+	s.listeners.listeners = append(s.listeners.listeners, l)
+}
+
+// PublishDeleted publishes the removal of sessions deleted without this
+// service, so keyspace and tracking listeners still see them.
+//
+// @design DS-0103
+func (s *SessionService) PublishDeleted(ids []string) {
+	s.publish(SessionEventDeleted, ids...)
+}
+
+// publish delivers events to the registered listeners.
+func (s *SessionService) publish(typ SessionEventType, ids ...string) {
+	if len(ids) == 0 {
+		return
+	}
+
+	s.listeners.mu.RLock()
+	listeners := s.listeners.listeners
+	s.listeners.mu.RUnlock()
+	if len(listeners) == 0 {
+		return
+	}
+
+	events := make([]SessionEvent, len(ids))
+	for i, id := range ids {
+		events[i] = SessionEvent{Type: typ, SessionID: id}
+	}
+	for _, l := range listeners {
+		l(events)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// expiredSessionRepo adds ExpiredSessionRepository to the mock repository.
+type expiredSessionRepo struct {
+	*mockSessionRepo
+}
+
+func (r expiredSessionRepo) DeleteExpiredSessions(ctx context.Context) ([]*domain.Session, error) {
+	var expired []*domain.Session
+	now := time.Now().UnixMilli()
+	for _, s := range r.sessions {
+		if s.ExpiresAt > 0 && s.ExpiresAt < now {
+			expired = append(expired, s)
+		}
+	}
+	if _, err := r.DeleteExpired(ctx); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+func TestSessionService_Listeners(t *testing.T) {
+	repo := expiredSessionRepo{newMockSessionRepo()}
+	svc := NewSessionService(repo, NewTokenService(newMockTokenRepo(), nil))
+	ctx := context.Background()
+
+	var got []SessionEvent
+	svc.AddListener(func(events []SessionEvent) { got = append(got, events...) })
+	create := func(userID string, ttl time.Duration) string {
+		t.Helper()
+		resp, err := svc.Create(ctx, &CreateSessionRequest{UserID: userID, TTL: ttl})
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return resp.SessionID
+	}
+	expect := func(typ SessionEventType, ids ...string) {
+		t.Helper()
+		var gotIDs []string
+		for _, ev := range got {
+			if ev.Type != typ {
+				t.Errorf("event type = %q, want %q", ev.Type, typ)
+			}
+			gotIDs = append(gotIDs, ev.SessionID)
+		}
+		sort.Strings(gotIDs)
+		sort.Strings(ids)
+		if len(gotIDs) != len(ids) {
+			t.Fatalf("events for %v, want %v", gotIDs, ids)
+		}
+		for i := range ids {
+			if gotIDs[i] != ids[i] {
+				t.Fatalf("events for %v, want %v", gotIDs, ids)
+			}
+		}
+		got = nil
+	}
+
+	t.Run("revoke", func(t *testing.T) {
+		id := create("user1", time.Hour)
+		if _, err := svc.Revoke(ctx, &RevokeSessionRequest{SessionID: id}); err != nil {
+			t.Fatalf("Revoke failed: %v", err)
+		}
+		expect(SessionEventDeleted, id)
+
+		// Revoking a missing session is idempotent and publishes nothing.
+		if _, err := svc.Revoke(ctx, &RevokeSessionRequest{SessionID: id}); err != nil {
+			t.Fatalf("Revoke failed: %v", err)
+		}
+		expect(SessionEventDeleted)
+	})
+
+	t.Run("revoke batch", func(t *testing.T) {
+		a, b := create("user2", time.Hour), create("user2", time.Hour)
+		if _, err := svc.RevokeBatch(ctx, []string{a, "missing", b}); err != nil {
+			t.Fatalf("RevokeBatch failed: %v", err)
+		}
+		expect(SessionEventDeleted, a, b)
+	})
+
+	t.Run("revoke by user", func(t *testing.T) {
+		a, b := create("user3", time.Hour), create("user3", time.Hour)
+		if _, err := svc.RevokeByUser(ctx, &RevokeByUserRequest{UserID: "user3"}); err != nil {
+			t.Fatalf("RevokeByUser failed: %v", err)
+		}
+		expect(SessionEventDeleted, a, b)
+	})
+
+	t.Run("revoke by query", func(t *testing.T) {
+		// Replicated revoke queries are applied on every node this way
+		a, b := create("user5", time.Hour), create("user5", time.Hour)
+		if _, err := svc.RevokeByQuery(ctx, &RevokeQuery{UserID: "user5"}, nil); err != nil {
+			t.Fatalf("RevokeByQuery failed: %v", err)
+		}
+		expect(SessionEventDeleted, a, b)
+	})
+
+	t.Run("publish deleted", func(t *testing.T) {
+		svc.PublishDeleted([]string{"migrated1", "migrated2"})
+		expect(SessionEventDeleted, "migrated1", "migrated2")
+
+		svc.PublishDeleted(nil)
+		expect(SessionEventDeleted)
+	})
+
+	t.Run("gc", func(t *testing.T) {
+		create("user4", time.Hour)
+		expired := create("user4", time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		count, err := svc.GC(ctx)
+		if err != nil {
+			t.Fatalf("GC failed: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("GC cleaned %d sessions, want 1", count)
+		}
+		expect(SessionEventExpired, expired)
+	})
+}
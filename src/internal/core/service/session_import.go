@@ -0,0 +1,178 @@
+// Package service provides domain services for TokMesh.
+//
+// This file contains bulk session import for migrations.
+//
+// Reference: specs/2-designs/DS-0103-核心服务层设计.md Section 3
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// ImportStatus is the outcome of importing a single session record.
+type ImportStatus string
+
+// Import statuses.
+const (
+	ImportStatusImported ImportStatus = "imported" // Persisted (or would be, in a dry run)
+	ImportStatusExists   ImportStatus = "exists"   // A session with this ID is already stored
+	ImportStatusExpired  ImportStatus = "expired"  // Record already expired, skipped
+	ImportStatusFailed   ImportStatus = "failed"   // Record rejected, see Err
+)
+
+// ImportSessionsRequest contains parameters for a bulk session import.
+//
+// @design DS-0103
+type ImportSessionsRequest struct {
+	// Sessions are complete session records, e.g. exported from another
+	// cluster. IDs, token hashes and timestamps are preserved.
+	Sessions []*domain.Session
+
+	// DryRun validates records without persisting them.
+	DryRun bool
+}
+
+// ImportSessionResult is the outcome of one record of an import.
+//
+// @design DS-0103
+type ImportSessionResult struct {
+	Status ImportStatus
+	Err    error
+}
+
+// Import bulk-loads up to MaxBatchSize existing sessions, preserving their
+// IDs, token hashes and expirations.
+//
+// Records that already exist are reported as ImportStatusExists rather than
+// failing, so an interrupted import can simply be re-run. Expired records
+// are skipped. Valid records are persisted together.
+//
+// @req RQ-0102
+// @design DS-0103
+func (s *SessionService) Import(ctx context.Context, req *ImportSessionsRequest) ([]ImportSessionResult, error) {
+	// 1. Validate batch
+	if err := checkBatchSize(len(req.Sessions)); err != nil {
+		return nil, err
+	}
+
+	results := make([]ImportSessionResult, len(req.Sessions))
+	now := time.Now().UnixMilli()
+
+	// 2. Validate each record
+	pending := make(map[string]int)
+	seen := make(map[string]bool)
+	var sessions []*domain.Session
+	var index []int
+	for i, record := range req.Sessions {
+		session, err := s.importSession(ctx, record, now, pending)
+		switch {
+		case errors.Is(err, domain.ErrSessionConflict) || (session != nil && seen[session.ID]):
+			results[i].Status = ImportStatusExists
+			continue
+		case errors.Is(err, domain.ErrSessionExpired):
+			results[i].Status = ImportStatusExpired
+			continue
+		case err != nil:
+			results[i] = ImportSessionResult{Status: ImportStatusFailed, Err: err}
+			continue
+		}
+
+		seen[session.ID] = true
+		pending[session.UserID]++
+		results[i].Status = ImportStatusImported
+		sessions = append(sessions, session)
+		index = append(index, i)
+	}
+
+	if req.DryRun {
+		return results, nil
+	}
+
+	// 3. Persist valid records together
+	for j, err := range s.createSessions(ctx, sessions) {
+		if err == nil {
+			continue
+		}
+		i := index[j]
+		if errors.Is(err, domain.ErrSessionConflict) {
+			results[i].Status = ImportStatusExists
+			continue
+		}
+		results[i] = ImportSessionResult{Status: ImportStatusFailed, Err: domain.ErrStorageError.WithCause(err)}
+	}
+
+	return results, nil
+}
+
+// importSession normalizes and validates one import record.
+// Returns ErrSessionConflict if the session already exists and
+// ErrSessionExpired if the record has already expired.
+func (s *SessionService) importSession(ctx context.Context, record *domain.Session, now int64, pending map[string]int) (*domain.Session, error) {
+	// 1. Validate required fields
+	if record == nil {
+		return nil, domain.ErrMissingArgument.WithDetails("record is required")
+	}
+	if record.ID == "" {
+		return nil, domain.ErrMissingArgument.WithDetails("id is required")
+	}
+	if !domain.IsValidSessionID(record.ID) {
+		return nil, domain.ErrInvalidArgument.WithDetails("invalid session id format")
+	}
+	if record.TokenHash == "" {
+		return nil, domain.ErrMissingArgument.WithDetails("token_hash is required")
+	}
+	if !domain.ValidateTokenHashFormat(record.TokenHash) {
+		return nil, domain.ErrTokenMalformed.WithDetails("invalid token_hash format")
+	}
+	if record.ExpiresAt <= 0 {
+		return nil, domain.ErrMissingArgument.WithDetails("expires_at is required")
+	}
+
+	// 2. Skip expired records
+	if record.ExpiresAt <= now {
+		return nil, domain.ErrSessionExpired
+	}
+
+	// 3. Normalize
+	session := record.Clone()
+	session.Version = 1
+	session.IsDeleted = false
+	if session.CreatedAt == 0 {
+		session.CreatedAt = now
+	}
+	if session.LastActive == 0 {
+		session.LastActive = session.CreatedAt
+	}
+	session.TTL = session.ExpiresAt - session.CreatedAt
+	if session.Data == nil {
+		session.Data = make(map[string]string)
+	}
+
+	if err := session.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 4. Detect already imported sessions
+	if _, err := s.repo.Get(ctx, session.ID); err == nil {
+		return session, domain.ErrSessionConflict
+	}
+
+	// 5. Check user quota
+	count, err := s.repo.CountByUserID(ctx, session.UserID)
+	if err != nil {
+		return nil, domain.ErrStorageError.WithCause(err)
+	}
+	count += pending[session.UserID]
+	if count >= domain.MaxSessionsPerUser {
+		return nil, domain.ErrSessionQuotaExceeded.WithDetails(
+			fmt.Sprintf("user has %d sessions (max %d)", count, domain.MaxSessionsPerUser),
+		)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,104 @@
+// Package service provides domain services for TokMesh.
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// newImportRecord builds an exportable session record for tests.
+func newImportRecord(t *testing.T, userID string, ttl time.Duration) *domain.Session {
+	t.Helper()
+	session, err := domain.NewSession(userID)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	_, hash, err := domain.GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	session.TokenHash = hash
+	session.CreatedAt = time.Now().Add(-time.Hour).UnixMilli()
+	session.ExpiresAt = time.Now().Add(ttl).UnixMilli()
+	session.Version = 7
+	return session
+}
+
+func TestSessionService_Import(t *testing.T) {
+	repo := &mockBatchSessionRepo{mockSessionRepo: newMockSessionRepo()}
+	svc := NewSessionService(repo, NewTokenService(newMockTokenRepo(), nil))
+
+	ctx := context.Background()
+
+	valid := newImportRecord(t, "user1", time.Hour)
+	expired := newImportRecord(t, "user1", -time.Minute)
+	badHash := newImportRecord(t, "user2", time.Hour)
+	badHash.TokenHash = "not-a-hash"
+	badID := newImportRecord(t, "user2", time.Hour)
+	badID.ID = "session-1"
+
+	records := []*domain.Session{valid, expired, badHash, badID, valid}
+
+	t.Run("dry run persists nothing", func(t *testing.T) {
+		results, err := svc.Import(ctx, &ImportSessionsRequest{Sessions: records, DryRun: true})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if results[0].Status != ImportStatusImported {
+			t.Errorf("results[0] = %+v, want imported", results[0])
+		}
+		if len(repo.sessions) != 0 {
+			t.Errorf("stored sessions = %d, want 0", len(repo.sessions))
+		}
+	})
+
+	t.Run("imports valid records", func(t *testing.T) {
+		results, err := svc.Import(ctx, &ImportSessionsRequest{Sessions: records})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+
+		want := []ImportStatus{ImportStatusImported, ImportStatusExpired, ImportStatusFailed, ImportStatusFailed, ImportStatusExists}
+		for i, status := range want {
+			if results[i].Status != status {
+				t.Errorf("results[%d].Status = %s, want %s (err: %v)", i, results[i].Status, status, results[i].Err)
+			}
+		}
+		if !domain.IsDomainError(results[2].Err, "TM-TOKN-4000") {
+			t.Errorf("results[2].Err = %v, want TM-TOKN-4000", results[2].Err)
+		}
+		if repo.batches != 1 {
+			t.Errorf("batch commits = %d, want 1", repo.batches)
+		}
+
+		stored, err := repo.Get(ctx, valid.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if stored.TokenHash != valid.TokenHash || stored.ExpiresAt != valid.ExpiresAt || stored.CreatedAt != valid.CreatedAt {
+			t.Error("import must preserve token hash and timestamps")
+		}
+		if stored.Version != 1 {
+			t.Errorf("Version = %d, want 1", stored.Version)
+		}
+	})
+
+	t.Run("re-import reports existing", func(t *testing.T) {
+		results, err := svc.Import(ctx, &ImportSessionsRequest{Sessions: []*domain.Session{valid}})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if results[0].Status != ImportStatusExists {
+			t.Errorf("results[0] = %+v, want exists", results[0])
+		}
+	})
+
+	t.Run("rejects empty batch", func(t *testing.T) {
+		if _, err := svc.Import(ctx, &ImportSessionsRequest{}); !domain.IsDomainError(err, "TM-ARG-1002") {
+			t.Errorf("expected TM-ARG-1002, got %v", err)
+		}
+	})
+}
@@ -8,6 +8,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,6 +19,22 @@ import (
 // Session Lifecycle Operations
 // ============================================================================
 
+// SessionTouchRepository is optionally implemented by a repository that
+// can persist a touch or an expiration change without rewriting the
+// whole session. Neither changes the session version.
+//
+// @design DS-0103
+type SessionTouchRepository interface {
+	// TouchSession sets LastActive (Unix milliseconds), and the access IP
+	// and user agent when not empty, and returns the updated session.
+	TouchSession(ctx context.Context, id string, lastActive int64, ip, userAgent string) (*domain.Session, error)
+
+	// SetSessionExpiry sets ExpiresAt (Unix milliseconds) and the TTL hint
+	// (milliseconds), and LastActive when not zero, and returns the
+	// updated session.
+	SetSessionExpiry(ctx context.Context, id string, expiresAt, ttl, lastActive int64) (*domain.Session, error)
+}
+
 // RenewSessionRequest contains parameters for session renewal.
 //
 // @design DS-0103
@@ -60,13 +77,28 @@ func (s *SessionService) Renew(ctx context.Context, req *RenewSessionRequest) (*
 		return nil, domain.ErrSessionNotFound
 	}
 
-	// 4. Update expiration and last active (乐观锁)
+	// 4. Lightweight path: only the expiration is persisted
+	if toucher, ok := s.repo.(SessionTouchRepository); ok {
+		now := time.Now()
+		updated, err := toucher.SetSessionExpiry(ctx, req.SessionID,
+			now.Add(req.TTL).UnixMilli(), req.TTL.Milliseconds(), now.UnixMilli())
+		if err != nil {
+			if errors.Is(err, domain.ErrSessionNotFound) {
+				return nil, domain.ErrSessionNotFound.WithCause(err)
+			}
+			return nil, domain.ErrStorageError.WithCause(err)
+		}
+		return &RenewSessionResponse{
+			NewExpiresAt: updated.ExpiresAt,
+		}, nil
+	}
+
+	// 5. Update expiration and last active (乐观锁)
 	oldVersion := session.Version
 	session.SetExpiration(req.TTL)
 	session.LastActive = time.Now().UnixMilli()
-	session.IncrVersion()
 
-	// 5. Persist with optimistic locking
+	// 6. Persist with optimistic locking
 	if err := s.repo.Update(ctx, session, oldVersion); err != nil {
 		return nil, domain.ErrSessionVersionConflict.WithCause(err)
 	}
@@ -113,16 +145,29 @@ func (s *SessionService) Touch(ctx context.Context, req *TouchSessionRequest) (*
 		return nil, domain.ErrSessionExpired.WithDetails(fmt.Sprintf("session %s has expired", req.SessionID))
 	}
 
-	// 4. Update last_active and optionally last_access_ip with optimistic locking
+	// 4. Lightweight path: only the touch is persisted
 	now := time.Now().UnixMilli()
+	if toucher, ok := s.repo.(SessionTouchRepository); ok {
+		updated, err := toucher.TouchSession(ctx, req.SessionID, now, req.ClientIP, "")
+		if err != nil {
+			if errors.Is(err, domain.ErrSessionNotFound) {
+				return nil, err
+			}
+			return nil, domain.ErrStorageError.WithCause(err)
+		}
+		return &TouchSessionResponse{
+			LastActive: updated.LastActive,
+		}, nil
+	}
+
+	// 5. Update last_active and optionally last_access_ip with optimistic locking
 	oldVersion := session.Version
 	session.LastActive = now
 	if req.ClientIP != "" {
 		session.LastAccessIP = req.ClientIP
 	}
-	session.IncrVersion()
 
-	// 5. Save to storage (with optimistic locking)
+	// 6. Save to storage (with optimistic locking)
 	if err := s.repo.Update(ctx, session, oldVersion); err != nil {
 		if domain.IsDomainError(err, "TM-SESS-4091") {
 			// Version conflict - retry once with fresh data
@@ -136,7 +181,6 @@ func (s *SessionService) Touch(ctx context.Context, req *TouchSessionRequest) (*
 			if req.ClientIP != "" {
 				session.LastAccessIP = req.ClientIP
 			}
-			session.IncrVersion()
 			if err := s.repo.Update(ctx, session, oldVersion); err != nil {
 				return nil, domain.ErrStorageError.WithCause(err)
 			}
@@ -183,6 +227,7 @@ func (s *SessionService) Revoke(ctx context.Context, req *RevokeSessionRequest)
 		}
 		return nil, domain.ErrStorageError.WithCause(err)
 	}
+	s.publish(SessionEventDeleted, req.SessionID)
 
 	// TODO: If req.Sync is true, wait for cluster confirmation
 	// This will be implemented in the cluster layer
@@ -234,6 +279,12 @@ func (s *SessionService) RevokeByUser(ctx context.Context, req *RevokeByUserRequ
 		return nil, domain.ErrStorageError.WithCause(err)
 	}
 
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	s.publish(SessionEventDeleted, ids...)
+
 	return &RevokeByUserResponse{
 		RevokedCount: count,
 	}, nil
@@ -242,8 +293,24 @@ func (s *SessionService) RevokeByUser(ctx context.Context, req *RevokeByUserRequ
 // GC performs garbage collection on expired sessions.
 // This should be called periodically by a background task.
 //
+// Removed sessions are published as expiration events if the repository
+// implements ExpiredSessionRepository.
+//
 // @design DS-0103
 func (s *SessionService) GC(ctx context.Context) (int, error) {
+	if repo, ok := s.repo.(ExpiredSessionRepository); ok {
+		sessions, err := repo.DeleteExpiredSessions(ctx)
+		if err != nil {
+			return 0, domain.ErrStorageError.WithCause(err)
+		}
+		ids := make([]string, len(sessions))
+		for i, session := range sessions {
+			ids[i] = session.ID
+		}
+		s.publish(SessionEventExpired, ids...)
+		return len(sessions), nil
+	}
+
 	count, err := s.repo.DeleteExpired(ctx)
 	if err != nil {
 		return 0, domain.ErrStorageError.WithCause(err)
@@ -0,0 +1,211 @@
+// Package service provides domain services for TokMesh.
+//
+// This file contains revoke-by-criteria for incident response.
+//
+// Reference: specs/2-designs/DS-0103-核心服务层设计.md Section 3
+package service
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// revokeQueryPageSize is the number of sessions scanned and revoked per
+// batch by RevokeByQuery.
+const revokeQueryPageSize = 100
+
+// RevokeQuery selects sessions to revoke by attribute. Every non-empty
+// criterion must match; at least one is required.
+//
+// RevokeQuery is JSON-encoded when replicated to other cluster nodes.
+//
+// @design DS-0103
+type RevokeQuery struct {
+	UserID    string `json:"user_id,omitempty"`
+	DeviceID  string `json:"device_id,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"` // API Key ID
+
+	// IP is an address or CIDR prefix, matched against both the creating
+	// and the last access IP.
+	IP string `json:"ip,omitempty"`
+
+	// Data lists session data attributes; every pair must match exactly.
+	Data map[string]string `json:"data,omitempty"`
+
+	// CreatedBefore (Unix ms) limits the query to sessions that existed
+	// when the revocation was issued, so re-applying it later (e.g. on
+	// replication replay) cannot revoke newer sessions. 0 means no limit.
+	CreatedBefore int64 `json:"created_before,omitempty"`
+
+	prefix netip.Prefix // Parsed IP, set by Validate
+}
+
+// Validate checks the query and parses IP.
+func (q *RevokeQuery) Validate() error {
+	if q.UserID == "" && q.DeviceID == "" && q.CreatedBy == "" && q.IP == "" && len(q.Data) == 0 {
+		return domain.ErrMissingArgument.WithDetails("at least one of user_id, device_id, created_by, ip or data is required")
+	}
+	for key := range q.Data {
+		if key == "" {
+			return domain.ErrInvalidArgument.WithDetails("data keys must not be empty")
+		}
+	}
+
+	q.prefix = netip.Prefix{}
+	if q.IP == "" {
+		return nil
+	}
+	if strings.Contains(q.IP, "/") {
+		prefix, err := netip.ParsePrefix(q.IP)
+		if err != nil {
+			return domain.ErrInvalidArgument.WithDetails("invalid ip: must be an IP address or CIDR")
+		}
+		q.prefix = prefix.Masked()
+		return nil
+	}
+	addr, err := netip.ParseAddr(q.IP)
+	if err != nil {
+		return domain.ErrInvalidArgument.WithDetails("invalid ip: must be an IP address or CIDR")
+	}
+	q.prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+	return nil
+}
+
+// Matches reports whether the session satisfies every criterion.
+// Validate must have been called.
+func (q *RevokeQuery) Matches(session *domain.Session) bool {
+	if q.UserID != "" && session.UserID != q.UserID {
+		return false
+	}
+	if q.DeviceID != "" && session.DeviceID != q.DeviceID {
+		return false
+	}
+	if q.CreatedBy != "" && session.CreatedBy != q.CreatedBy {
+		return false
+	}
+	if q.CreatedBefore > 0 && session.CreatedAt > q.CreatedBefore {
+		return false
+	}
+	for key, value := range q.Data {
+		if v, ok := session.Data[key]; !ok || v != value {
+			return false
+		}
+	}
+	if q.prefix.IsValid() && !q.containsIP(session.IPAddress) && !q.containsIP(session.LastAccessIP) {
+		return false
+	}
+	return true
+}
+
+// containsIP reports whether ip lies within the query's IP prefix.
+func (q *RevokeQuery) containsIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && q.prefix.Contains(addr.Unmap())
+}
+
+// filter returns the keyset listing filter that pre-selects candidates
+// using the indexed criteria. IP prefixes are applied by Matches.
+func (q *RevokeQuery) filter() *SessionFilter {
+	filter := &SessionFilter{
+		UserID:    q.UserID,
+		DeviceID:  q.DeviceID,
+		CreatedBy: q.CreatedBy,
+		Data:      q.Data,
+		SortBy:    "created_at",
+		SortOrder: "asc",
+		Limit:     revokeQueryPageSize,
+	}
+	if q.CreatedBefore > 0 {
+		// CreatedBefore is exclusive in the filter; the query is inclusive.
+		before := time.UnixMilli(q.CreatedBefore + 1)
+		filter.CreatedBefore = &before
+	}
+	return filter
+}
+
+// scanQuery walks every session matching q in pages, calling fn with the
+// matching IDs of each page.
+func (s *SessionService) scanQuery(ctx context.Context, q *RevokeQuery, fn func(ids []string) error) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+
+	filter := q.filter()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		resp, err := s.List(ctx, &ListSessionsRequest{Filter: filter})
+		if err != nil {
+			return err
+		}
+
+		var ids []string
+		for _, session := range resp.Items {
+			if q.Matches(session) {
+				ids = append(ids, session.ID)
+			}
+		}
+		if len(ids) > 0 {
+			if err := fn(ids); err != nil {
+				return err
+			}
+		}
+
+		if resp.NextCursor == "" {
+			return nil
+		}
+		filter.Cursor = resp.NextCursor
+	}
+}
+
+// CountByQuery returns the number of sessions matching q, e.g. for a dry
+// run before RevokeByQuery.
+//
+// @req RQ-0102
+// @design DS-0103
+func (s *SessionService) CountByQuery(ctx context.Context, q *RevokeQuery) (int, error) {
+	count := 0
+	err := s.scanQuery(ctx, q, func(ids []string) error {
+		count += len(ids)
+		return nil
+	})
+	return count, err
+}
+
+// RevokeByQuery revokes every session matching q, persisting each page of
+// matches as one batch. onProgress, if non-nil, is called with the running
+// total after each batch.
+//
+// Returns the number of sessions revoked, which is accurate even if an
+// error stops the scan part-way.
+//
+// @req RQ-0102
+// @design DS-0103
+func (s *SessionService) RevokeByQuery(ctx context.Context, q *RevokeQuery, onProgress func(revoked int)) (int, error) {
+	revoked := 0
+	err := s.scanQuery(ctx, q, func(ids []string) error {
+		results, err := s.RevokeBatch(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				return result.Err
+			}
+			if result.Revoked {
+				revoked++
+			}
+		}
+		if onProgress != nil {
+			onProgress(revoked)
+		}
+		return nil
+	})
+	return revoked, err
+}
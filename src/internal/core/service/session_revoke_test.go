@@ -0,0 +1,174 @@
+// Package service provides domain services for TokMesh.
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+func TestRevokeQuery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   RevokeQuery
+		wantErr string
+	}{
+		{"empty", RevokeQuery{}, "TM-ARG-1002"},
+		{"only created_before", RevokeQuery{CreatedBefore: 1}, "TM-ARG-1002"},
+		{"ip", RevokeQuery{IP: "10.0.0.1"}, ""},
+		{"cidr", RevokeQuery{IP: "10.0.0.0/8"}, ""},
+		{"ipv6 cidr", RevokeQuery{IP: "2001:db8::/32"}, ""},
+		{"bad ip", RevokeQuery{IP: "10.0.0"}, "TM-ARG-1001"},
+		{"bad cidr", RevokeQuery{IP: "10.0.0.0/33"}, "TM-ARG-1001"},
+		{"empty data key", RevokeQuery{Data: map[string]string{"": "x"}}, "TM-ARG-1001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !domain.IsDomainError(err, tt.wantErr) {
+				t.Errorf("Validate() = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRevokeQuery_Matches(t *testing.T) {
+	session := &domain.Session{
+		UserID:       "user1",
+		DeviceID:     "ios-1",
+		CreatedBy:    "tmak-1",
+		IPAddress:    "10.1.2.3",
+		LastAccessIP: "192.168.0.7",
+		CreatedAt:    1000,
+		Data:         map[string]string{"tenant": "acme"},
+	}
+
+	tests := []struct {
+		name  string
+		query RevokeQuery
+		want  bool
+	}{
+		{"created_by", RevokeQuery{CreatedBy: "tmak-1"}, true},
+		{"other key", RevokeQuery{CreatedBy: "tmak-2"}, false},
+		{"creating ip in cidr", RevokeQuery{IP: "10.0.0.0/8"}, true},
+		{"last access ip", RevokeQuery{IP: "192.168.0.7"}, true},
+		{"ip outside cidr", RevokeQuery{IP: "172.16.0.0/12"}, false},
+		{"data", RevokeQuery{Data: map[string]string{"tenant": "acme"}}, true},
+		{"data mismatch", RevokeQuery{Data: map[string]string{"tenant": "other"}}, false},
+		{"all criteria", RevokeQuery{UserID: "user1", DeviceID: "ios-1", IP: "10.1.2.3", Data: map[string]string{"tenant": "acme"}}, true},
+		{"one criterion fails", RevokeQuery{UserID: "user1", DeviceID: "android"}, false},
+		{"created before", RevokeQuery{UserID: "user1", CreatedBefore: 1000}, true},
+		{"created after cutoff", RevokeQuery{UserID: "user1", CreatedBefore: 999}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.query.Validate(); err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if got := tt.query.Matches(session); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionService_RevokeByQuery(t *testing.T) {
+	repo := &mockBatchSessionRepo{mockSessionRepo: newMockSessionRepo()}
+	svc := NewSessionService(repo, NewTokenService(newMockTokenRepo(), nil))
+
+	ctx := context.Background()
+
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "172.16.0.1"} {
+		if _, err := svc.Create(ctx, &CreateSessionRequest{UserID: "user1", ClientIP: ip}); err != nil {
+			t.Fatalf("Create %d failed: %v", i, err)
+		}
+	}
+
+	query := &RevokeQuery{IP: "10.0.0.0/24"}
+
+	count, err := svc.CountByQuery(ctx, query)
+	if err != nil {
+		t.Fatalf("CountByQuery failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("CountByQuery = %d, want 3", count)
+	}
+
+	var progress []int
+	revoked, err := svc.RevokeByQuery(ctx, query, func(n int) { progress = append(progress, n) })
+	if err != nil {
+		t.Fatalf("RevokeByQuery failed: %v", err)
+	}
+	if revoked != 3 {
+		t.Errorf("revoked = %d, want 3", revoked)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 3 {
+		t.Errorf("progress = %v, want final 3", progress)
+	}
+	if len(repo.sessions) != 1 {
+		t.Errorf("remaining sessions = %d, want 1", len(repo.sessions))
+	}
+
+	// Re-running is a no-op
+	if revoked, err := svc.RevokeByQuery(ctx, query, nil); err != nil || revoked != 0 {
+		t.Errorf("second RevokeByQuery = %d, %v; want 0, nil", revoked, err)
+	}
+
+	if _, err := svc.RevokeByQuery(ctx, &RevokeQuery{}, nil); !domain.IsDomainError(err, "TM-ARG-1002") {
+		t.Errorf("empty query: expected TM-ARG-1002, got %v", err)
+	}
+}
+
+func TestJobManager(t *testing.T) {
+	jobs := NewJobManager(2)
+
+	release := make(chan struct{})
+	job, err := jobs.Start("test", 10, func(ctx context.Context, progress func(int)) error {
+		progress(5)
+		<-release
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if job.State != JobStateRunning || job.Total != 10 {
+		t.Errorf("job = %+v, want running with total 10", job)
+	}
+
+	failed, _ := jobs.Start("test", 0, func(context.Context, func(int)) error {
+		return errors.New("boom")
+	})
+
+	close(release)
+	jobs.Wait()
+
+	got, ok := jobs.Get(job.ID)
+	if !ok || got.State != JobStateSucceeded || got.Done != 5 || got.FinishedAt.IsZero() {
+		t.Errorf("job = %+v, want succeeded with done 5", got)
+	}
+	if got, _ := jobs.Get(failed.ID); got.State != JobStateFailed || got.Error != "boom" {
+		t.Errorf("failed job = %+v", got)
+	}
+
+	// Retention evicts the oldest finished job
+	third, _ := jobs.Start("test", 0, func(context.Context, func(int)) error { return nil })
+	jobs.Wait()
+	if _, ok := jobs.Get(job.ID); ok {
+		t.Error("oldest job should be evicted")
+	}
+	if _, ok := jobs.Get(third.ID); !ok {
+		t.Error("newest job should be retained")
+	}
+
+	if _, ok := jobs.Get("tmjb-missing"); ok {
+		t.Error("expected missing job")
+	}
+}
@@ -3,6 +3,9 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -49,7 +52,8 @@ func (m *mockSessionRepo) Update(ctx context.Context, session *domain.Session, e
 	if existing.Version != expectedVersion {
 		return domain.ErrSessionVersionConflict
 	}
-	m.sessions[session.ID] = session
+	session.Version = expectedVersion + 1
+	m.sessions[session.ID] = session.Clone()
 	return nil
 }
 
@@ -464,6 +468,128 @@ func TestSessionService_List(t *testing.T) {
 	})
 }
 
+// countingSessionRepo implements SessionCountRepository.
+type countingSessionRepo struct {
+	*mockSessionRepo
+	counted int
+}
+
+func (r *countingSessionRepo) Count(ctx context.Context) int {
+	r.counted++
+	return len(r.sessions)
+}
+
+func (r *countingSessionRepo) List(ctx context.Context, filter *SessionFilter) ([]*domain.Session, int, error) {
+	return nil, 0, errors.New("listed instead of counted")
+}
+
+func TestSessionService_Count(t *testing.T) {
+	ctx := context.Background()
+	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
+
+	t.Run("lists without a counter", func(t *testing.T) {
+		svc := NewSessionService(newMockSessionRepo(), tokenSvc)
+		for i := 0; i < 2; i++ {
+			if _, err := svc.Create(ctx, &CreateSessionRequest{UserID: "user_a", TTL: time.Hour}); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		if n, err := svc.Count(ctx); err != nil || n != 2 {
+			t.Errorf("Count() = %d, %v, want 2", n, err)
+		}
+	})
+
+	t.Run("counts through the repository", func(t *testing.T) {
+		repo := &countingSessionRepo{mockSessionRepo: newMockSessionRepo()}
+		svc := NewSessionService(repo, tokenSvc)
+		if _, err := svc.Create(ctx, &CreateSessionRequest{UserID: "user_a", TTL: time.Hour}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if n, err := svc.Count(ctx); err != nil || n != 1 || repo.counted != 1 {
+			t.Errorf("Count() = %d, %v (counted %d), want 1", n, err, repo.counted)
+		}
+	})
+}
+
+// TestSessionService_ListKeyset tests cursor-based session listing.
+func TestSessionService_ListKeyset(t *testing.T) {
+	repo := newMockSessionRepo()
+	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
+	svc := NewSessionService(repo, tokenSvc)
+
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Create(ctx, &CreateSessionRequest{UserID: "user_a", TTL: time.Hour}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	t.Run("returns next cursor when more rows exist", func(t *testing.T) {
+		resp, err := svc.List(ctx, &ListSessionsRequest{Filter: &SessionFilter{Limit: 2}})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(resp.Items) != 2 {
+			t.Fatalf("len(Items) = %d, want 2", len(resp.Items))
+		}
+		if resp.Total != -1 {
+			t.Errorf("Total = %d, want -1", resp.Total)
+		}
+		cursor, err := DecodeSessionCursor(resp.NextCursor)
+		if err != nil {
+			t.Fatalf("DecodeSessionCursor: %v", err)
+		}
+		if cursor.ID != resp.Items[1].ID || cursor.SortBy != "created_at" || cursor.SortOrder != "desc" {
+			t.Errorf("cursor = %+v, want position of last item", cursor)
+		}
+	})
+
+	t.Run("no next cursor on last page", func(t *testing.T) {
+		resp, err := svc.List(ctx, &ListSessionsRequest{Filter: &SessionFilter{Limit: 5}})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if resp.NextCursor != "" {
+			t.Errorf("NextCursor = %q, want empty", resp.NextCursor)
+		}
+	})
+
+	t.Run("rejects cursor for a different sort", func(t *testing.T) {
+		cursor := (&SessionCursor{SortBy: "last_active", SortOrder: "desc", Value: 1, ID: "tmss-x"}).Encode()
+		_, err := svc.List(ctx, &ListSessionsRequest{Filter: &SessionFilter{Cursor: cursor}})
+		if !domain.IsDomainError(err, "TM-ARG-1001") {
+			t.Errorf("error = %v, want TM-ARG-1001", err)
+		}
+	})
+
+	t.Run("rejects unknown sort column", func(t *testing.T) {
+		_, err := svc.List(ctx, &ListSessionsRequest{Filter: &SessionFilter{SortBy: "user_id"}})
+		if !domain.IsDomainError(err, "TM-ARG-1001") {
+			t.Errorf("error = %v, want TM-ARG-1001", err)
+		}
+	})
+}
+
+// TestSessionCursor_RoundTrip tests cursor encoding and decoding.
+func TestSessionCursor_RoundTrip(t *testing.T) {
+	in := &SessionCursor{SortBy: "last_active", SortOrder: "asc", Value: 1700000000123, ID: "tmss-01h0000000000000000000000"}
+
+	out, err := DecodeSessionCursor(in.Encode())
+	if err != nil {
+		t.Fatalf("DecodeSessionCursor: %v", err)
+	}
+	if *out != *in {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+
+	for _, bad := range []string{"", "!!!", "djF8eA", "djJ8Y3JlYXRlZF9hdHw8ZGVzY3wxfGlk"} {
+		if _, err := DecodeSessionCursor(bad); !domain.IsDomainError(err, "TM-ARG-1001") {
+			t.Errorf("DecodeSessionCursor(%q) error = %v, want TM-ARG-1001", bad, err)
+		}
+	}
+}
+
 // TestSessionService_Touch tests session touch (last_active update).
 func TestSessionService_Touch(t *testing.T) {
 	repo := newMockSessionRepo()
@@ -548,6 +674,74 @@ func TestSessionService_Touch(t *testing.T) {
 }
 
 // TestSessionService_GC tests garbage collection of expired sessions.
+// mockTouchSessionRepo adds SessionTouchRepository to mockSessionRepo.
+type mockTouchSessionRepo struct {
+	*mockSessionRepo
+	touches, expiries int
+}
+
+func (m *mockTouchSessionRepo) TouchSession(ctx context.Context, id string, lastActive int64, ip, userAgent string) (*domain.Session, error) {
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+	m.touches++
+	session.TouchAt(lastActive, ip, userAgent)
+	return session.Clone(), nil
+}
+
+func (m *mockTouchSessionRepo) SetSessionExpiry(ctx context.Context, id string, expiresAt, ttl, lastActive int64) (*domain.Session, error) {
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+	m.expiries++
+	session.ExpiresAt, session.TTL = expiresAt, ttl
+	if lastActive > session.LastActive {
+		session.LastActive = lastActive
+	}
+	return session.Clone(), nil
+}
+
+func TestSessionService_LightweightTouchAndRenew(t *testing.T) {
+	repo := &mockTouchSessionRepo{mockSessionRepo: newMockSessionRepo()}
+	svc := NewSessionService(repo, NewTokenService(newMockTokenRepo(), nil))
+	ctx := context.Background()
+
+	createResp, err := svc.Create(ctx, &CreateSessionRequest{UserID: "user123", TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	version := createResp.Session.Version
+
+	touchResp, err := svc.Touch(ctx, &TouchSessionRequest{SessionID: createResp.SessionID, ClientIP: "192.0.2.9"})
+	if err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	renewResp, err := svc.Renew(ctx, &RenewSessionRequest{SessionID: createResp.SessionID, TTL: 2 * time.Hour})
+	if err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+	if repo.touches != 1 || repo.expiries != 1 {
+		t.Fatalf("touches = %d, expiries = %d, want 1 each", repo.touches, repo.expiries)
+	}
+
+	session := repo.sessions[createResp.SessionID]
+	if session.Version != version {
+		t.Errorf("Version = %d, want %d (unchanged)", session.Version, version)
+	}
+	if session.LastAccessIP != "192.0.2.9" || session.LastActive < touchResp.LastActive {
+		t.Errorf("touch not applied: %+v", session)
+	}
+	if session.ExpiresAt != renewResp.NewExpiresAt || session.TTL != (2*time.Hour).Milliseconds() {
+		t.Errorf("ExpiresAt = %d, TTL = %d, want %d and 2h", session.ExpiresAt, session.TTL, renewResp.NewExpiresAt)
+	}
+
+	if _, err := svc.Renew(ctx, &RenewSessionRequest{SessionID: "non-existent", TTL: time.Hour}); !domain.IsDomainError(err, "TM-SESS-4040") {
+		t.Errorf("Renew of a missing session = %v", err)
+	}
+}
+
 func TestSessionService_GC(t *testing.T) {
 	repo := newMockSessionRepo()
 	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
@@ -899,3 +1093,118 @@ func TestSessionService_Update(t *testing.T) {
 		}
 	})
 }
+
+func TestSessionService_Patch(t *testing.T) {
+	repo := newMockSessionRepo()
+	tokenSvc := NewTokenService(newMockTokenRepo(), nil)
+	svc := NewSessionService(repo, tokenSvc)
+
+	ctx := context.Background()
+
+	createResp, err := svc.Create(ctx, &CreateSessionRequest{
+		UserID: "user123",
+		TTL:    time.Hour,
+		Data:   map[string]string{"a": "1", "b": "2"},
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	strPtr := func(s string) *string { return &s }
+
+	t.Run("set and delete keys", func(t *testing.T) {
+		resp, err := svc.Patch(ctx, &PatchSessionRequest{
+			SessionID: createResp.SessionID,
+			Data:      map[string]*string{"a": strPtr("10"), "b": nil, "c": strPtr("3")},
+		})
+		if err != nil {
+			t.Fatalf("Patch failed: %v", err)
+		}
+
+		got := resp.Session.Data
+		if got["a"] != "10" || got["c"] != "3" {
+			t.Errorf("Data = %v, want a=10 c=3", got)
+		}
+		if _, ok := got["b"]; ok {
+			t.Error("key b should be deleted")
+		}
+		if resp.DataAdded != 1 || resp.DataRemoved != 1 {
+			t.Errorf("DataAdded/DataRemoved = %d/%d, want 1/1", resp.DataAdded, resp.DataRemoved)
+		}
+	})
+
+	t.Run("clear data and device", func(t *testing.T) {
+		resp, err := svc.Patch(ctx, &PatchSessionRequest{
+			SessionID: createResp.SessionID,
+			ClearData: true,
+			Data:      map[string]*string{"z": strPtr("26")},
+			DeviceID:  strPtr("device-9"),
+		})
+		if err != nil {
+			t.Fatalf("Patch failed: %v", err)
+		}
+		if len(resp.Session.Data) != 1 || resp.Session.Data["z"] != "26" {
+			t.Errorf("Data = %v, want only z=26", resp.Session.Data)
+		}
+		if resp.Session.DeviceID != "device-9" {
+			t.Errorf("DeviceID = %q, want device-9", resp.Session.DeviceID)
+		}
+	})
+
+	t.Run("expected version matches", func(t *testing.T) {
+		current, _ := svc.Get(ctx, &GetSessionRequest{SessionID: createResp.SessionID})
+
+		resp, err := svc.Patch(ctx, &PatchSessionRequest{
+			SessionID:       createResp.SessionID,
+			Data:            map[string]*string{"v": strPtr("ok")},
+			ExpectedVersion: current.Version,
+		})
+		if err != nil {
+			t.Fatalf("Patch failed: %v", err)
+		}
+		if resp.Session.Version != current.Version+1 {
+			t.Errorf("Version = %d, want %d", resp.Session.Version, current.Version+1)
+		}
+	})
+
+	t.Run("stale expected version", func(t *testing.T) {
+		current, _ := svc.Get(ctx, &GetSessionRequest{SessionID: createResp.SessionID})
+
+		_, err := svc.Patch(ctx, &PatchSessionRequest{
+			SessionID:       createResp.SessionID,
+			Data:            map[string]*string{"v": strPtr("stale")},
+			ExpectedVersion: current.Version - 1,
+		})
+		if !domain.IsDomainError(err, "TM-SESS-4091") {
+			t.Fatalf("expected TM-SESS-4091, got %v", err)
+		}
+
+		after, _ := svc.Get(ctx, &GetSessionRequest{SessionID: createResp.SessionID})
+		if after.Data["v"] != "ok" {
+			t.Errorf("Data[v] = %q, conditional patch must not be applied", after.Data["v"])
+		}
+	})
+
+	t.Run("exceeds MaxDataTotalSize", func(t *testing.T) {
+		big := strings.Repeat("x", domain.MaxDataValueLength)
+		patch := make(map[string]*string)
+		for i := 0; i*domain.MaxDataValueLength <= domain.MaxDataTotalSize; i++ {
+			patch[fmt.Sprintf("k%d", i)] = &big
+		}
+
+		_, err := svc.Patch(ctx, &PatchSessionRequest{
+			SessionID: createResp.SessionID,
+			Data:      patch,
+		})
+		if !domain.IsDomainError(err, "TM-SESS-4001") {
+			t.Fatalf("expected TM-SESS-4001, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := svc.Patch(ctx, &PatchSessionRequest{SessionID: "missing"})
+		if !domain.IsDomainError(err, "TM-SESS-4040") {
+			t.Errorf("expected TM-SESS-4040, got %v", err)
+		}
+	})
+}
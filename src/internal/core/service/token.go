@@ -121,49 +121,26 @@ type ValidateTokenResponse struct {
 // @req RQ-0103
 // @design DS-0103
 func (s *TokenService) Validate(ctx context.Context, req *ValidateTokenRequest) (*ValidateTokenResponse, error) {
-	// 1. Validate token format
-	if !domain.ValidateTokenFormat(req.Token) {
-		return &ValidateTokenResponse{
-			Valid:   false,
-			Session: nil,
-		}, domain.ErrTokenMalformed
-	}
-
-	// 2. Compute token hash
-	tokenHash := s.ComputeTokenHash(req.Token)
-
-	// 3. Lookup session by token hash
-	session, err := s.repo.GetSessionByTokenHash(ctx, tokenHash)
+	// 1-5. Resolve the token to a live session
+	session, err := s.lookup(ctx, req.Token)
 	if err != nil {
-		// Session not found or storage error
-		return &ValidateTokenResponse{
-			Valid:   false,
-			Session: nil,
-		}, domain.ErrTokenInvalid.WithCause(err)
-	}
-
-	// 4. Check if session is expired
-	if session.IsExpired() {
-		return &ValidateTokenResponse{
-			Valid:   false,
-			Session: nil,
-		}, domain.ErrSessionExpired
-	}
-
-	// 5. Check if session is deleted
-	if session.IsDeleted {
 		return &ValidateTokenResponse{
 			Valid:   false,
 			Session: nil,
-		}, domain.ErrSessionNotFound
+		}, err
 	}
 
 	// 6. Optionally touch the session (update last access info)
-	if req.Touch {
+	if toucher, ok := s.repo.(SessionTouchRepository); ok && req.Touch {
+		// Lightweight touch: no new version, only the touch is persisted
+		// (best-effort, as below)
+		touched, err := toucher.TouchSession(ctx, session.ID, time.Now().UnixMilli(), req.ClientIP, req.UserAgent)
+		if err == nil {
+			session = touched
+		}
+	} else if req.Touch {
 		// Clone session before modification to ensure consistency
-		updated := session.Clone()
-		updated.Touch(req.ClientIP, req.UserAgent)
-		updated.IncrVersion()
+		updated := touchedClone(session, req)
 
 		// Update in storage (best-effort, don't fail validation on update error)
 		if err := s.repo.UpdateSession(ctx, updated); err != nil {
@@ -182,6 +159,45 @@ func (s *TokenService) Validate(ctx context.Context, req *ValidateTokenRequest)
 	}, nil
 }
 
+// lookup resolves a plaintext token to its live (not expired, not deleted)
+// session.
+func (s *TokenService) lookup(ctx context.Context, token string) (*domain.Session, error) {
+	// 1. Validate token format
+	if !domain.ValidateTokenFormat(token) {
+		return nil, domain.ErrTokenMalformed
+	}
+
+	// 2. Compute token hash
+	tokenHash := s.ComputeTokenHash(token)
+
+	// 3. Lookup session by token hash
+	session, err := s.repo.GetSessionByTokenHash(ctx, tokenHash)
+	if err != nil {
+		// Session not found or storage error
+		return nil, domain.ErrTokenInvalid.WithCause(err)
+	}
+
+	// 4. Check if session is expired
+	if session.IsExpired() {
+		return nil, domain.ErrSessionExpired
+	}
+
+	// 5. Check if session is deleted
+	if session.IsDeleted {
+		return nil, domain.ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// touchedClone returns a copy of session with the request's access info applied.
+func touchedClone(session *domain.Session, req *ValidateTokenRequest) *domain.Session {
+	updated := session.Clone()
+	updated.Touch(req.ClientIP, req.UserAgent)
+	updated.IncrVersion()
+	return updated
+}
+
 // MaxNonceLength is the maximum allowed nonce length to prevent DoS attacks.
 const MaxNonceLength = 256
 
@@ -307,3 +307,110 @@ func TestTokenService_CheckNonce(t *testing.T) {
 		}
 	})
 }
+
+// mockTouchTokenRepo adds SessionTouchRepository to mockTokenRepo.
+type mockTouchTokenRepo struct {
+	*mockTokenRepo
+	touches int
+}
+
+func (m *mockTouchTokenRepo) TouchSession(ctx context.Context, id string, lastActive int64, ip, userAgent string) (*domain.Session, error) {
+	for _, session := range m.sessions {
+		if session.ID == id {
+			m.touches++
+			session.TouchAt(lastActive, ip, userAgent)
+			return session.Clone(), nil
+		}
+	}
+	return nil, domain.ErrSessionNotFound
+}
+
+func (m *mockTouchTokenRepo) SetSessionExpiry(ctx context.Context, id string, expiresAt, ttl, lastActive int64) (*domain.Session, error) {
+	return nil, domain.ErrSessionNotFound
+}
+
+func TestTokenService_ValidateLightweightTouch(t *testing.T) {
+	repo := &mockTouchTokenRepo{mockTokenRepo: newMockTokenRepo()}
+	svc := NewTokenService(repo, nil)
+
+	session, _ := domain.NewSession("user123")
+	plainToken, tokenHash, _ := domain.GenerateToken()
+	session.TokenHash = tokenHash
+	session.SetExpiration(time.Hour)
+	repo.AddSession(session)
+	version := session.Version
+
+	resp, err := svc.Validate(context.Background(), &ValidateTokenRequest{
+		Token:     plainToken,
+		Touch:     true,
+		ClientIP:  "192.0.2.10",
+		UserAgent: "agent",
+	})
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if repo.touches != 1 {
+		t.Errorf("touches = %d, want 1", repo.touches)
+	}
+	if resp.Session.LastAccessIP != "192.0.2.10" || resp.Session.LastAccessUA != "agent" || resp.Session.Version != version {
+		t.Errorf("Session = %+v, want touched with version %d", resp.Session, version)
+	}
+
+	results, err := svc.ValidateBatch(context.Background(), []*ValidateTokenRequest{
+		{Token: plainToken, Touch: true, ClientIP: "192.0.2.11"},
+		{Token: plainToken},
+	})
+	if err != nil {
+		t.Fatalf("ValidateBatch failed: %v", err)
+	}
+	if repo.touches != 2 || results[0].Response.Session.LastAccessIP != "192.0.2.11" {
+		t.Errorf("touches = %d, session = %+v", repo.touches, results[0].Response.Session)
+	}
+}
+
+// mockTouchBatchTokenRepo adds SessionTouchBatchRepository to
+// mockTouchTokenRepo.
+type mockTouchBatchTokenRepo struct {
+	*mockTouchTokenRepo
+	batches int
+}
+
+func (m *mockTouchBatchTokenRepo) TouchSessionBatch(ctx context.Context, touches []SessionTouch) ([]*domain.Session, []error) {
+	m.batches++
+	sessions := make([]*domain.Session, len(touches))
+	errs := make([]error, len(touches))
+	for i, t := range touches {
+		sessions[i], errs[i] = m.mockTouchTokenRepo.TouchSession(ctx, t.ID, t.LastActive, t.IP, t.UserAgent)
+	}
+	return sessions, errs
+}
+
+func TestTokenService_ValidateBatchTouchBatch(t *testing.T) {
+	repo := &mockTouchBatchTokenRepo{mockTouchTokenRepo: &mockTouchTokenRepo{mockTokenRepo: newMockTokenRepo()}}
+	svc := NewTokenService(repo, nil)
+
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		session, _ := domain.NewSession("user123")
+		plainToken, tokenHash, _ := domain.GenerateToken()
+		session.TokenHash = tokenHash
+		session.SetExpiration(time.Hour)
+		repo.AddSession(session)
+		tokens = append(tokens, plainToken)
+	}
+
+	results, err := svc.ValidateBatch(context.Background(), []*ValidateTokenRequest{
+		{Token: tokens[0], Touch: true, ClientIP: "192.0.2.20"},
+		{Token: tokens[1], Touch: true, UserAgent: "agent"},
+		{Token: tokens[2]},
+	})
+	if err != nil {
+		t.Fatalf("ValidateBatch failed: %v", err)
+	}
+	if repo.batches != 1 || repo.touches != 2 {
+		t.Errorf("batches = %d, touches = %d; want 1 batch of 2 touches", repo.batches, repo.touches)
+	}
+	if results[0].Response.Session.LastAccessIP != "192.0.2.20" || results[1].Response.Session.LastAccessUA != "agent" {
+		t.Errorf("sessions = %+v, %+v, want touched", results[0].Response.Session, results[1].Response.Session)
+	}
+}
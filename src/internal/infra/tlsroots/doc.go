@@ -4,6 +4,8 @@
 //
 //   - roots.go: System certificates + custom CA loading
 //   - watcher.go: Certificate hot-reload via fsnotify
+//   - server.go: Server TLS configs, client certificate identities
+//   - metrics.go: Certificate expiry metric
 //
 // Features:
 //
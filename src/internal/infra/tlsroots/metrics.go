@@ -0,0 +1,18 @@
+// Package tlsroots provides TLS certificate management.
+package tlsroots
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ExpiryCollector returns a gauge reporting the expiry time (Unix seconds)
+// of the certificate a listener currently serves, so alerts can fire
+// before a rotation failure turns into an outage.
+func ExpiryCollector(listener string, w *Watcher) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "tokmesh",
+		Name:        "tls_certificate_expiry_timestamp_seconds",
+		Help:        "Expiry time of the TLS certificate served by a listener, in Unix seconds.",
+		ConstLabels: prometheus.Labels{"listener": listener},
+	}, func() float64 {
+		return float64(w.NotAfter().Unix())
+	})
+}
@@ -0,0 +1,108 @@
+// Package tlsroots provides TLS certificate management.
+package tlsroots
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+)
+
+// ServerConfig creates a TLS server config that serves the watcher's
+// current certificate, so rotated certificates are picked up without a
+// restart.
+//
+// If clientCAs is non-nil, client certificates are verified against it:
+// required if requireClientCert is set, otherwise optional (clients
+// without a certificate authenticate by other means).
+func ServerConfig(w *Watcher, clientCAs *Pool, requireClientCert bool) *tls.Config {
+	cfg := &tls.Config{
+		GetCertificate: w.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs.Pool()
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg
+}
+
+// CertIdentities returns the identities a certificate asserts, in the
+// form used to map client certificates to principals, most specific
+// first:
+//
+//   - "URI:<uri>" for each URI SAN (e.g. SPIFFE IDs)
+//   - "DNS:<name>" for each DNS SAN
+//   - "EMAIL:<address>" for each email SAN
+//   - "CN=<common name>" for the subject common name
+func CertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, uri := range cert.URIs {
+		ids = append(ids, "URI:"+uri.String())
+	}
+	for _, name := range cert.DNSNames {
+		ids = append(ids, "DNS:"+name)
+	}
+	for _, email := range cert.EmailAddresses {
+		ids = append(ids, "EMAIL:"+email)
+	}
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, "CN="+cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// ParseTLSVersion parses a TLS version name ("1.2" or "1.3"). An empty name
+// selects TLS 1.2, the minimum the server accepts.
+func ParseTLSVersion(name string) (uint16, error) {
+	switch name {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tlsroots: unsupported tls version %q (want 1.2 or 1.3)", name)
+	}
+}
+
+// ParseCipherSuites parses cipher suite names as reported by
+// tls.CipherSuites (e.g. "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256").
+// Insecure suites are rejected. Names only restrict TLS 1.2; TLS 1.3 suites
+// are not configurable.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	byName := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		byName[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("tlsroots: unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// IsLoopbackAddr reports whether a listen address binds only to loopback,
+// where serving plaintext does not expose traffic to the network.
+func IsLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
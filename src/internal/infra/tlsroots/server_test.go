@@ -0,0 +1,157 @@
+// Package tlsroots provides TLS certificate management.
+package tlsroots
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCertIdentities(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/gateway")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "gateway"},
+		URIs:           []*url.URL{spiffe},
+		DNSNames:       []string{"gw.example.org"},
+		EmailAddresses: []string{"ops@example.org"},
+	}
+
+	want := []string{
+		"URI:spiffe://example.org/gateway",
+		"DNS:gw.example.org",
+		"EMAIL:ops@example.org",
+		"CN=gateway",
+	}
+	if got := CertIdentities(cert); !reflect.DeepEqual(got, want) {
+		t.Errorf("CertIdentities() = %v, want %v", got, want)
+	}
+
+	if got := CertIdentities(&x509.Certificate{}); len(got) != 0 {
+		t.Errorf("CertIdentities(empty) = %v, want none", got)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	generateTestCertAndKey(t, certFile, keyFile)
+
+	w, err := NewWatcher(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+
+	cfg := ServerConfig(w, nil, false)
+	if cfg.ClientAuth != tls.NoClientCert || cfg.ClientCAs != nil {
+		t.Errorf("without client CAs: ClientAuth = %v", cfg.ClientAuth)
+	}
+	if cert, err := cfg.GetCertificate(nil); err != nil || cert == nil {
+		t.Errorf("GetCertificate() = %v, %v", cert, err)
+	}
+
+	pool := NewEmptyPool()
+	if err := pool.AddCertFile(certFile); err != nil {
+		t.Fatalf("AddCertFile() error = %v", err)
+	}
+	if cfg := ServerConfig(w, pool, false); cfg.ClientAuth != tls.VerifyClientCertIfGiven || cfg.ClientCAs == nil {
+		t.Errorf("optional client certs: ClientAuth = %v", cfg.ClientAuth)
+	}
+	if cfg := ServerConfig(w, pool, true); cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("required client certs: ClientAuth = %v", cfg.ClientAuth)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    uint16
+		wantErr bool
+	}{
+		{"", tls.VersionTLS12, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"1.3", tls.VersionTLS13, false},
+		{"1.1", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTLSVersion(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseTLSVersion(%q) = %v, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	if err != nil {
+		t.Fatalf("ParseCipherSuites() error = %v", err)
+	}
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("ParseCipherSuites() = %v, want %v", ids, want)
+	}
+
+	if ids, err := ParseCipherSuites(nil); ids != nil || err != nil {
+		t.Errorf("ParseCipherSuites(nil) = %v, %v", ids, err)
+	}
+	// Insecure suites are rejected like unknown ones.
+	for _, name := range []string{"TLS_RSA_WITH_RC4_128_SHA", "NOT_A_SUITE"} {
+		if _, err := ParseCipherSuites([]string{name}); err == nil {
+			t.Errorf("ParseCipherSuites(%q) should fail", name)
+		}
+	}
+}
+
+func TestExpiryCollector(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	generateTestCertAndKey(t, certFile, keyFile)
+
+	w, err := NewWatcher(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	notAfter := w.NotAfter()
+	if notAfter.Before(time.Now()) {
+		t.Fatalf("NotAfter() = %v, want a future time", notAfter)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(ExpiryCollector("http", w))
+	families, err := registry.Gather()
+	if err != nil || len(families) != 1 {
+		t.Fatalf("Gather() = %v, %v", families, err)
+	}
+	m := families[0].GetMetric()[0]
+	if got := int64(m.GetGauge().GetValue()); got != notAfter.Unix() {
+		t.Errorf("gauge = %d, want %d", got, notAfter.Unix())
+	}
+	if l := m.GetLabel()[0]; l.GetName() != "listener" || l.GetValue() != "http" {
+		t.Errorf("label = %s=%s", l.GetName(), l.GetValue())
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:6379": true,
+		"[::1]:6379":     true,
+		"localhost:6379": true,
+		"0.0.0.0:6379":   false,
+		":6379":          false,
+		"10.0.0.1:6379":  false,
+		"invalid":        false,
+	}
+	for addr, want := range tests {
+		if got := IsLoopbackAddr(addr); got != want {
+			t.Errorf("IsLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
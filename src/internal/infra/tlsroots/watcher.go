@@ -181,6 +181,16 @@ func (w *Watcher) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certif
 	return w.cert, nil
 }
 
+// NotAfter returns the expiry time of the current certificate.
+func (w *Watcher) NotAfter() time.Time {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.cert == nil || w.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return w.cert.Leaf.NotAfter
+}
+
 // debouncedReload reloads the certificate with debouncing.
 func (w *Watcher) debouncedReload() error {
 	w.reloadMu.Lock()
@@ -7,12 +7,18 @@ package clusterserver
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/hashicorp/raft"
+
+	"github.com/yndnr/tokmesh-go/internal/core/service"
 )
 
 // LogEntryType defines the type of Raft log entry.
@@ -30,6 +36,9 @@ const (
 
 	// LogEntryConfigChange changes cluster configuration.
 	LogEntryConfigChange LogEntryType = 4
+
+	// LogEntryRevokeQuery revokes matching sessions on every node.
+	LogEntryRevokeQuery LogEntryType = 5
 )
 
 // LogEntry represents a Raft log entry.
@@ -56,6 +65,15 @@ type MemberLeavePayload struct {
 	NodeID string `json:"node_id"`
 }
 
+// RevokeQueryPayload is the payload for cluster-wide revoke-by-query.
+type RevokeQueryPayload struct {
+	Query service.RevokeQuery `json:"query"`
+
+	// Origin is the node that accepted the request. It revokes its own
+	// sessions while handling it, so it skips the entry.
+	Origin string `json:"origin,omitempty"`
+}
+
 // FSM implements the Raft finite state machine.
 //
 // This is the core component that applies Raft log entries to the cluster state.
@@ -67,6 +85,19 @@ type FSM struct {
 	shardMap *ShardMap
 	members  map[string]*Member // nodeID -> Member
 
+	// onRevokeQuery revokes matching local sessions (optional).
+	onRevokeQuery func(q *service.RevokeQuery)
+
+	// Revoke-by-query entries are run one at a time, in log order, by
+	// runRevokeQueries; revokeApplied is the index of the last one run,
+	// persisted in revokeIndexPath so a replayed entry is not run again.
+	revokeMu        sync.Mutex
+	nodeID          string
+	revokeIndexPath string
+	revokeApplied   uint64
+	revokePending   []pendingRevoke
+	revoking        bool
+
 	// Logger
 	logger *slog.Logger
 }
@@ -124,6 +155,9 @@ func (f *FSM) Apply(log *raft.Log) interface{} {
 	case LogEntryConfigChange:
 		f.applyConfigChange(entry.Payload)
 
+	case LogEntryRevokeQuery:
+		f.applyRevokeQuery(log.Index, entry.Payload)
+
 	default:
 		// FATAL: Unknown log type indicates version mismatch or data corruption
 		f.logger.Error("FATAL: unknown log entry type",
@@ -191,6 +225,124 @@ func (f *FSM) applyConfigChange(payload json.RawMessage) {
 	f.logger.Info("config change applied")
 }
 
+// pendingRevoke is a revoke-by-query entry waiting to be run.
+type pendingRevoke struct {
+	index uint64
+	query service.RevokeQuery
+}
+
+// applyRevokeQuery hands a revoke-by-query to the local session store.
+//
+// Session data lives outside the FSM, so this has no effect on FSM state.
+// The revocation runs asynchronously to keep Apply fast. Entries this
+// node originated, or already ran before a restart, are skipped.
+func (f *FSM) applyRevokeQuery(index uint64, payload json.RawMessage) {
+	var revoke RevokeQueryPayload
+	if err := json.Unmarshal(payload, &revoke); err != nil {
+		f.logger.Error("FATAL: failed to unmarshal revoke query payload", "error", err)
+		panic(fmt.Sprintf("applyRevokeQuery: unmarshal failed: %v", err))
+	}
+
+	if f.onRevokeQuery == nil {
+		f.logger.Warn("revoke query ignored: no session handler registered")
+		return
+	}
+
+	f.revokeMu.Lock()
+	defer f.revokeMu.Unlock()
+
+	if revoke.Origin != "" && revoke.Origin == f.nodeID {
+		return
+	}
+	if index <= f.revokeApplied {
+		f.logger.Debug("revoke query already applied", "log_index", index)
+		return
+	}
+
+	f.logger.Info("revoke query applied",
+		"log_index", index,
+		"origin", revoke.Origin,
+		"created_by", revoke.Query.CreatedBy,
+		"device_id", revoke.Query.DeviceID,
+		"ip", revoke.Query.IP)
+
+	f.revokePending = append(f.revokePending, pendingRevoke{index: index, query: revoke.Query})
+	if !f.revoking {
+		f.revoking = true
+		go f.runRevokeQueries(f.onRevokeQuery)
+	}
+}
+
+// runRevokeQueries runs the pending revoke-by-query entries in order,
+// recording each one as applied once it has run.
+func (f *FSM) runRevokeQueries(fn func(q *service.RevokeQuery)) {
+	for {
+		f.revokeMu.Lock()
+		if len(f.revokePending) == 0 {
+			f.revoking = false
+			f.revokeMu.Unlock()
+			return
+		}
+		next := f.revokePending[0]
+		f.revokePending = f.revokePending[1:]
+		f.revokeMu.Unlock()
+
+		fn(&next.query)
+
+		f.revokeMu.Lock()
+		f.revokeApplied = next.index
+		if err := f.saveRevokeApplied(); err != nil {
+			f.logger.Warn("save applied revoke query index failed", "error", err)
+		}
+		f.revokeMu.Unlock()
+	}
+}
+
+// SetRevokeQueryHandler registers the function that revokes local sessions
+// for replicated revoke-by-query entries.
+func (f *FSM) SetRevokeQueryHandler(fn func(q *service.RevokeQuery)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onRevokeQuery = fn
+}
+
+// TrackRevokeQueries makes the FSM skip the revoke-by-query entries
+// originated by nodeID, and the entries run before a restart, whose last
+// index is kept in the file at path. It must be called before Raft
+// starts applying entries.
+func (f *FSM) TrackRevokeQueries(nodeID, path string) error {
+	f.revokeMu.Lock()
+	defer f.revokeMu.Unlock()
+
+	f.nodeID = nodeID
+	f.revokeIndexPath = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read applied revoke query index: %w", err)
+	}
+	index, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse applied revoke query index: %w", err)
+	}
+	f.revokeApplied = index
+	return nil
+}
+
+// saveRevokeApplied persists revokeApplied. Caller must hold revokeMu.
+func (f *FSM) saveRevokeApplied() error {
+	if f.revokeIndexPath == "" {
+		return nil
+	}
+	tmp := f.revokeIndexPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(f.revokeApplied, 10)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.revokeIndexPath)
+}
+
 // Snapshot creates a snapshot of the FSM state.
 //
 // This is called by Raft to create a snapshot for log compaction.
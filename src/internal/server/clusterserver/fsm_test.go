@@ -8,10 +8,15 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/raft"
+
+	"github.com/yndnr/tokmesh-go/internal/core/service"
 )
 
 func TestNewFSM(t *testing.T) {
@@ -214,6 +219,97 @@ func TestApply_ConfigChange(t *testing.T) {
 	}
 }
 
+func TestApply_RevokeQuery(t *testing.T) {
+	fsm := NewFSM(nil)
+
+	payload, _ := json.Marshal(RevokeQueryPayload{
+		Query: service.RevokeQuery{CreatedBy: "tmak-1", CreatedBefore: 1000},
+	})
+	raftLog := &raft.Log{
+		Index: 1,
+		Term:  1,
+		Type:  raft.LogCommand,
+		Data:  mustMarshalJSON(t, LogEntry{Type: LogEntryRevokeQuery, Payload: payload}),
+	}
+
+	// Without a handler the entry is a no-op
+	fsm.Apply(raftLog)
+
+	got := make(chan *service.RevokeQuery, 1)
+	fsm.SetRevokeQueryHandler(func(q *service.RevokeQuery) { got <- q })
+	fsm.Apply(raftLog)
+
+	select {
+	case q := <-got:
+		if q.CreatedBy != "tmak-1" || q.CreatedBefore != 1000 {
+			t.Errorf("query = %+v", q)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("revoke query handler not called")
+	}
+}
+
+func TestApply_RevokeQueryOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), revokeIndexFile)
+	revokeLog := func(index uint64, origin string) *raft.Log {
+		payload, _ := json.Marshal(RevokeQueryPayload{
+			Query:  service.RevokeQuery{CreatedBy: "tmak-1", CreatedBefore: 1000},
+			Origin: origin,
+		})
+		return &raft.Log{
+			Index: index,
+			Term:  1,
+			Type:  raft.LogCommand,
+			Data:  mustMarshalJSON(t, LogEntry{Type: LogEntryRevokeQuery, Payload: payload}),
+		}
+	}
+
+	newFSM := func() (*FSM, chan *service.RevokeQuery) {
+		fsm := NewFSM(nil)
+		if err := fsm.TrackRevokeQueries("node-b", path); err != nil {
+			t.Fatalf("TrackRevokeQueries: %v", err)
+		}
+		got := make(chan *service.RevokeQuery, 4)
+		fsm.SetRevokeQueryHandler(func(q *service.RevokeQuery) { got <- q })
+		return fsm, got
+	}
+
+	fsm, got := newFSM()
+	fsm.Apply(revokeLog(3, "node-a"))
+	fsm.Apply(revokeLog(4, "node-b")) // revoked by this node when handled
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("revoke query handler not called")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if data, _ := os.ReadFile(path); string(data) == "3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("applied index not saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// After a restart, the replayed log only runs the new entry
+	fsm, got = newFSM()
+	fsm.Apply(revokeLog(3, "node-a"))
+	fsm.Apply(revokeLog(4, "node-b"))
+	fsm.Apply(revokeLog(5, "node-a"))
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("new revoke query not run after a restart")
+	}
+	select {
+	case q := <-got:
+		t.Fatalf("revoke query run again: %+v", q)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 func TestApply_UnknownType(t *testing.T) {
 	fsm := NewFSM(nil)
 
@@ -0,0 +1,52 @@
+// Package clusterserver provides the cluster communication server.
+package clusterserver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// nodeShardsDesc describes the per-node shard gauge.
+var nodeShardsDesc = prometheus.NewDesc(
+	"tokmesh_cluster_node_shards",
+	"Shards held by a cluster node, by role (leader or follower), gossip state and kind (primary or replica).",
+	[]string{"node_id", "role", "state", "kind"}, nil,
+)
+
+// metricsCollector reports the cluster membership and shard distribution
+// as seen by this node.
+type metricsCollector struct {
+	s *Server
+}
+
+// Collector returns a Prometheus collector for the per-node shard counts.
+//
+// @design DS-0401
+func (s *Server) Collector() prometheus.Collector {
+	return &metricsCollector{s: s}
+}
+
+// Describe implements prometheus.Collector.
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodeShardsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	leaderID, _ := c.s.Leader()
+	primaries, replicas := c.s.GetShardMap().CountByNode()
+
+	for nodeID, m := range c.s.GetMembers() {
+		role := "follower"
+		if nodeID == leaderID || m.IsLeader {
+			role = "leader"
+		}
+		state := m.State
+		if state == "" {
+			state = "unknown"
+		}
+		ch <- prometheus.MustNewConstMetric(nodeShardsDesc, prometheus.GaugeValue,
+			float64(primaries[nodeID]), nodeID, role, state, "primary")
+		ch <- prometheus.MustNewConstMetric(nodeShardsDesc, prometheus.GaugeValue,
+			float64(replicas[nodeID]), nodeID, role, state, "replica")
+	}
+}
@@ -72,6 +72,10 @@ type RebalanceManager struct {
 	tasks   map[uint32]*TransferTask // shard_id -> task
 	running atomic.Bool
 
+	// onRemoved receives the IDs of the sessions cleaned up after their
+	// shard migrated away (guarded by mu)
+	onRemoved func(ids []string)
+
 	logger *slog.Logger
 }
 
@@ -404,38 +408,55 @@ func (rm *RebalanceManager) cleanupShardData(ctx context.Context, shardID uint32
 	rm.logger.Info("cleaning up migrated shard data",
 		"shard_id", shardID)
 
-	deletedCount := 0
+	var removed []string
 	var lastErr error
 
-	// Scan and delete all sessions belonging to this shard
+	// Collect the shard's sessions, then delete them: the scan holds
+	// storage read locks that a delete in its callback would wait on.
+	var ids []string
 	rm.storage.Scan(func(sess *domain.Session) bool {
-		// Only delete sessions from the specified shard
-		if sess.ShardID != shardID {
-			return true // Continue scanning
+		if sess.ShardID == shardID {
+			ids = append(ids, sess.ID)
 		}
+		return true // Continue scanning
+	})
 
+	for _, id := range ids {
 		// Delete session from local storage
-		if err := rm.storage.Delete(ctx, sess.ID); err != nil {
+		if err := rm.storage.Delete(ctx, id); err != nil {
 			rm.logger.Warn("failed to delete session during cleanup",
-				"session_id", sess.ID,
+				"session_id", id,
 				"shard_id", shardID,
 				"error", err)
 			lastErr = err
 			// Continue cleanup even if individual deletes fail
-		} else {
-			deletedCount++
+			continue
 		}
+		removed = append(removed, id)
+	}
 
-		return true // Continue scanning
-	})
+	rm.mu.RLock()
+	onRemoved := rm.onRemoved
+	rm.mu.RUnlock()
+	if onRemoved != nil && len(removed) > 0 {
+		onRemoved(removed)
+	}
 
 	rm.logger.Info("shard data cleanup completed",
 		"shard_id", shardID,
-		"deleted_count", deletedCount)
+		"deleted_count", len(removed))
 
 	return lastErr
 }
 
+// SetRemovedHandler registers the function that receives the IDs of the
+// sessions deleted from local storage after their shard migrated away.
+func (rm *RebalanceManager) SetRemovedHandler(fn func(ids []string)) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.onRemoved = fn
+}
+
 // updateTaskError updates task status to failed with error message.
 func (rm *RebalanceManager) updateTaskError(task *TransferTask, errMsg string) {
 	task.mu.Lock()
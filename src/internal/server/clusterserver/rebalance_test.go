@@ -603,6 +603,44 @@ func TestCleanupShardData_NilStorage(t *testing.T) {
 	}
 }
 
+// TestCleanupShardData_RemovedHandler tests that cleaned up sessions are
+// reported to the removed handler.
+func TestCleanupShardData_RemovedHandler(t *testing.T) {
+	ctx := context.Background()
+	engine, err := storage.New(storage.DefaultConfig(t.TempDir()))
+	if err != nil {
+		t.Fatalf("storage.New: %v", err)
+	}
+	defer engine.Close()
+
+	var moved string
+	for i, shardID := range []uint32{3, 4} {
+		sess, _ := domain.NewSession(fmt.Sprintf("user%d", i))
+		sess.ShardID = shardID
+		sess.SetExpiration(time.Hour)
+		if err := engine.Create(ctx, sess); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if shardID == 3 {
+			moved = sess.ID
+		}
+	}
+
+	manager := NewRebalanceManager(DefaultRebalanceConfig(), engine, nil)
+	var removed []string
+	manager.SetRemovedHandler(func(ids []string) { removed = append(removed, ids...) })
+
+	if err := manager.cleanupShardData(ctx, 3); err != nil {
+		t.Fatalf("cleanupShardData: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != moved {
+		t.Errorf("removed = %v, want [%s]", removed, moved)
+	}
+	if engine.Count(ctx) != 1 {
+		t.Errorf("sessions left = %d, want 1", engine.Count(ctx))
+	}
+}
+
 // TestTriggerRebalance_AlreadyRunning tests that concurrent rebalancing is blocked.
 func TestTriggerRebalance_AlreadyRunning(t *testing.T) {
 	cfg := DefaultRebalanceConfig()
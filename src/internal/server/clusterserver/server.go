@@ -14,11 +14,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/yndnr/tokmesh-go/api/proto/v1/clusterv1connect"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
 	"github.com/yndnr/tokmesh-go/internal/storage"
 )
 
@@ -147,6 +150,14 @@ func NewServer(cfg Config) (*Server, error) {
 
 	// Create FSM
 	fsm := NewFSM(cfg.Logger)
+	if cfg.RaftDataDir != "" {
+		if err := os.MkdirAll(cfg.RaftDataDir, 0755); err != nil {
+			return nil, fmt.Errorf("create raft data dir: %w", err)
+		}
+		if err := fsm.TrackRevokeQueries(cfg.NodeID, filepath.Join(cfg.RaftDataDir, revokeIndexFile)); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create shard map (will be populated from FSM state)
 	shardMap := NewShardMap()
@@ -458,6 +469,52 @@ func (s *Server) ApplyMemberLeave(nodeID string) error {
 	return nil
 }
 
+// revokeIndexFile, in the Raft data directory, holds the index of the
+// last revoke-by-query entry run on this node.
+const revokeIndexFile = "revoke-applied-index"
+
+// ApplyRevokeQuery replicates a revoke-by-query to every node through Raft.
+// Each other node then revokes its own matching sessions; this node,
+// the origin, revokes its own while handling the request.
+//
+// This must be called on the leader node.
+func (s *Server) ApplyRevokeQuery(q *service.RevokeQuery) error {
+	if !s.IsLeader() {
+		return ErrNotLeader
+	}
+
+	entry := LogEntry{
+		Type: LogEntryRevokeQuery,
+	}
+
+	data, err := encodeLogEntry(entry, RevokeQueryPayload{Query: *q, Origin: s.config.NodeID})
+	if err != nil {
+		return fmt.Errorf("encode log entry: %w", err)
+	}
+
+	if err := s.raft.Apply(data, s.config.Timeouts.RaftApply); err != nil {
+		return fmt.Errorf("raft apply: %w", err)
+	}
+
+	s.logger.Info("revoke query replicated", "created_by", q.CreatedBy, "ip", q.IP)
+	return nil
+}
+
+// SetRevokeQueryHandler registers the function that revokes local sessions
+// when a replicated revoke-by-query is applied.
+func (s *Server) SetRevokeQueryHandler(fn func(q *service.RevokeQuery)) {
+	s.fsm.SetRevokeQueryHandler(fn)
+}
+
+// SetSessionsRemovedHandler registers the function that receives the IDs
+// of the sessions deleted from this node after their shard migrated away.
+// It has no effect without storage, where nothing is migrated.
+func (s *Server) SetSessionsRemovedHandler(fn func(ids []string)) {
+	if s.rebalanceManager != nil {
+		s.rebalanceManager.SetRemovedHandler(fn)
+	}
+}
+
 // GetShardOwner returns the node ID owning the given shard.
 func (s *Server) GetShardOwner(shardID uint32) (string, bool) {
 	shardMap := s.fsm.GetShardMap()
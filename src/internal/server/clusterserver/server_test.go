@@ -9,7 +9,11 @@ import (
 	"encoding/json"
 	"io"
 	"log/slog"
+	"strings"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // TestServer_GetMembers tests GetMembers method.
@@ -420,6 +424,47 @@ func TestServer_GetStats(t *testing.T) {
 	}
 }
 
+// TestServer_Collector tests the per-node shard metrics.
+func TestServer_Collector(t *testing.T) {
+	cfg := Config{
+		NodeID:            "node-a",
+		RaftBindAddr:      "127.0.0.1:15810",
+		GossipBindAddr:    "127.0.0.1",
+		GossipBindPort:    15811,
+		RaftDataDir:       t.TempDir(),
+		Bootstrap:         true,
+		ReplicationFactor: 1,
+		Logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	setLeaderState(server, true, "node-a", "127.0.0.1:15810")
+
+	server.fsm.members["node-a"] = &Member{NodeID: "node-a", State: "alive"}
+	server.fsm.members["node-b"] = &Member{NodeID: "node-b", State: "alive"}
+	server.fsm.shardMap.AssignShard(1, "node-a", []string{"node-b"})
+	server.fsm.shardMap.AssignShard(2, "node-a", nil)
+	server.fsm.shardMap.AssignShard(3, "node-b", []string{"node-a"})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(server.Collector())
+
+	expected := `
+# HELP tokmesh_cluster_node_shards Shards held by a cluster node, by role (leader or follower), gossip state and kind (primary or replica).
+# TYPE tokmesh_cluster_node_shards gauge
+tokmesh_cluster_node_shards{kind="primary",node_id="node-a",role="leader",state="alive"} 2
+tokmesh_cluster_node_shards{kind="primary",node_id="node-b",role="follower",state="alive"} 1
+tokmesh_cluster_node_shards{kind="replica",node_id="node-a",role="leader",state="alive"} 1
+tokmesh_cluster_node_shards{kind="replica",node_id="node-b",role="follower",state="alive"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
 // TestServer_NewServerWithStorage tests NewServer with storage configuration.
 func TestServer_NewServerWithStorage(t *testing.T) {
 	cfg := Config{
@@ -253,6 +253,25 @@ func (m *ShardMap) GetAllNodes() []string {
 	return nodes
 }
 
+// CountByNode returns the number of shards each node holds as primary
+// and as replica.
+func (m *ShardMap) CountByNode() (primaries, replicas map[string]int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	primaries = make(map[string]int)
+	for _, nodeID := range m.Shards {
+		primaries[nodeID]++
+	}
+	replicas = make(map[string]int)
+	for _, nodeIDs := range m.Replicas {
+		for _, nodeID := range nodeIDs {
+			replicas[nodeID]++
+		}
+	}
+	return primaries, replicas
+}
+
 // Stats returns shard map statistics.
 type ShardMapStats struct {
 	TotalShards      int
@@ -173,6 +173,148 @@ func TestVerify_InvalidSnapshotKeep(t *testing.T) {
 	}
 }
 
+func TestVerify_GCInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		wantErr  bool
+	}{
+		{0, false},
+		{time.Second, false},
+		{100 * time.Millisecond, false},
+		{time.Minute, false},
+		{10 * time.Millisecond, true},
+		{time.Hour, true},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Storage.DataDir = t.TempDir()
+		cfg.Storage.GCInterval = tt.interval
+		if err := Verify(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("gc_interval %s: err = %v, wantErr %v", tt.interval, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVerify_WALSyncMode(t *testing.T) {
+	for mode, wantErr := range map[string]bool{"": false, "sync": false, "batch": false, "group": false, "async": true} {
+		cfg := Default()
+		cfg.Storage.DataDir = t.TempDir()
+		cfg.Storage.WALSyncMode = mode
+		if err := Verify(cfg); (err != nil) != wantErr {
+			t.Errorf("wal_sync_mode %q: err = %v, wantErr %v", mode, err, wantErr)
+		}
+	}
+}
+
+func TestVerify_StorageBackend(t *testing.T) {
+	for backend, wantErr := range map[string]bool{"": false, "wal": false, "badger": false, "bolt": true} {
+		cfg := Default()
+		cfg.Storage.DataDir = t.TempDir()
+		cfg.Storage.Backend = backend
+		if err := Verify(cfg); (err != nil) != wantErr {
+			t.Errorf("backend %q: err = %v, wantErr %v", backend, err, wantErr)
+		}
+	}
+
+	cfg := Default()
+	cfg.Storage.DataDir = t.TempDir()
+	cfg.Storage.CacheSessions = -1
+	if err := Verify(cfg); err == nil {
+		t.Error("cache_sessions -1: expected error")
+	}
+}
+
+func TestVerify_TouchCoalesceInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		wantErr  bool
+	}{
+		{0, false},
+		{time.Second, false},
+		{5 * time.Minute, false},
+		{10 * time.Millisecond, true},
+		{time.Hour, true},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Storage.DataDir = t.TempDir()
+		cfg.Storage.TouchCoalesceInterval = tt.interval
+		if err := Verify(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("touch_coalesce_interval %s: err = %v, wantErr %v", tt.interval, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVerify_WALArchiveDir(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.DataDir = t.TempDir()
+	cfg.Storage.WALArchiveDir = cfg.Storage.DataDir + "/archive"
+	if err := Verify(cfg); err != nil {
+		t.Errorf("wal_archive_dir: %v", err)
+	}
+
+	cfg.Storage.WALArchiveDir = cfg.Storage.DataDir + "/data/wal/"
+	if err := Verify(cfg); err == nil {
+		t.Error("wal_archive_dir in the WAL directory: expected error")
+	}
+}
+
+func TestVerify_Archive(t *testing.T) {
+	dataDir := t.TempDir()
+	tests := []struct {
+		name    string
+		archive ArchiveConfig
+		wantErr bool
+	}{
+		{"off", ArchiveConfig{}, false},
+		{"dir", ArchiveConfig{Target: "dir", Dir: "/mnt/nfs/tokmesh"}, false},
+		{"dir missing", ArchiveConfig{Target: "dir"}, true},
+		{"dir in data", ArchiveConfig{Target: "dir", Dir: dataDir + "/data/archive"}, true},
+		{"s3", ArchiveConfig{Target: "s3", S3Endpoint: "http://127.0.0.1:9000", S3Bucket: "tokmesh", S3AccessKeyID: "ak", S3SecretAccessKey: "sk"}, false},
+		{"s3 no credentials", ArchiveConfig{Target: "s3", S3Endpoint: "http://127.0.0.1:9000", S3Bucket: "tokmesh"}, true},
+		{"unknown target", ArchiveConfig{Target: "ftp"}, true},
+		{"negative retention", ArchiveConfig{Target: "dir", Dir: "/mnt/nfs/tokmesh", RetentionDays: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Storage.DataDir = dataDir
+			cfg.Storage.Archive = tt.archive
+			if err := Verify(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify_Snapshot(t *testing.T) {
+	dataDir := t.TempDir()
+	tests := []struct {
+		name     string
+		snapshot func(*SnapshotConfig)
+		wantErr  bool
+	}{
+		{"default", func(*SnapshotConfig) {}, false},
+		{"all off", func(c *SnapshotConfig) { *c = SnapshotConfig{} }, false},
+		{"negative interval", func(c *SnapshotConfig) { c.Interval = -time.Second }, true},
+		{"negative wal bytes", func(c *SnapshotConfig) { c.WALBytes = -1 }, true},
+		{"negative write rate", func(c *SnapshotConfig) { c.HighWriteRate = -1 }, true},
+		{"check interval too short", func(c *SnapshotConfig) { c.CheckInterval = time.Millisecond }, true},
+		{"check interval too long", func(c *SnapshotConfig) { c.CheckInterval = time.Hour }, true},
+		{"negative retention", func(c *SnapshotConfig) { c.RetentionDays = -1 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Storage.DataDir = dataDir
+			tt.snapshot(&cfg.Storage.Snapshot)
+			if err := Verify(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestVerify_CreateDataDir(t *testing.T) {
 	dir := t.TempDir()
 	newDir := dir + "/subdir/data"
@@ -5,15 +5,31 @@ import "time"
 
 // Default configuration values.
 const (
-	DefaultHTTPAddr  = "127.0.0.1:5080"
-	DefaultHTTPSAddr = "127.0.0.1:5443"
-	DefaultRedisAddr = "127.0.0.1:6379"
-	DefaultClusterAddr = "127.0.0.1:5343"
-	DefaultLocalSocket = "/var/run/tokmesh-server/tokmesh-server.sock"
+	DefaultHTTPAddr     = "127.0.0.1:5080"
+	DefaultHTTPSAddr    = "127.0.0.1:5443"
+	DefaultRedisAddr    = "127.0.0.1:6379"
+	DefaultRedisTLSAddr = "127.0.0.1:6380"
+	DefaultClusterAddr  = "127.0.0.1:5343"
+	DefaultLocalSocket  = "/var/run/tokmesh-server/tokmesh-server.sock"
 
 	DefaultDataDir         = "/var/lib/tokmesh-server/data"
+	DefaultStorageBackend  = "wal"
+	DefaultWALSyncMode     = "group"
 	DefaultWALSyncInterval = 100 * time.Millisecond
 	DefaultSnapshotKeep    = 3
+	DefaultGCInterval      = time.Second
+
+	DefaultSnapshotInterval      = time.Hour
+	DefaultSnapshotWALBytes      = 256 << 20
+	DefaultSnapshotWALEntries    = 1_000_000
+	DefaultSnapshotCheckInterval = 10 * time.Second
+	DefaultSnapshotHighWriteRate = 20_000
+	DefaultSnapshotMaxDefer      = 5 * time.Minute
+	DefaultSnapshotRetentionDays = 7
+
+	DefaultArchiveScanInterval = time.Minute
+	DefaultArchiveMaxRetries   = 5
+	DefaultArchiveRetryBackoff = time.Second
 
 	DefaultLogLevel  = "info"
 	DefaultLogFormat = "json"
@@ -27,8 +43,12 @@ func Default() *ServerConfig {
 				Addr: DefaultHTTPAddr,
 			},
 			Redis: RedisConfig{
-				Enabled: false,
-				Addr:    DefaultRedisAddr,
+				Enabled:      false,
+				Addr:         DefaultRedisAddr,
+				PlainEnabled: true,
+				TLS: RedisTLSConfig{
+					Addr: DefaultRedisTLSAddr,
+				},
 			},
 			Cluster: ClusterConfig{
 				Addr: DefaultClusterAddr,
@@ -39,8 +59,26 @@ func Default() *ServerConfig {
 		},
 		Storage: StorageSection{
 			DataDir:         DefaultDataDir,
+			Backend:         DefaultStorageBackend,
+			WALSyncMode:     DefaultWALSyncMode,
 			WALSyncInterval: DefaultWALSyncInterval,
 			SnapshotKeep:    DefaultSnapshotKeep,
+			GCInterval:      DefaultGCInterval,
+			Archive: ArchiveConfig{
+				ScanInterval: DefaultArchiveScanInterval,
+				MaxRetries:   DefaultArchiveMaxRetries,
+				RetryBackoff: DefaultArchiveRetryBackoff,
+			},
+			Snapshot: SnapshotConfig{
+				Interval:      DefaultSnapshotInterval,
+				WALBytes:      DefaultSnapshotWALBytes,
+				WALEntries:    DefaultSnapshotWALEntries,
+				CheckInterval: DefaultSnapshotCheckInterval,
+				HighWriteRate: DefaultSnapshotHighWriteRate,
+				MaxDefer:      DefaultSnapshotMaxDefer,
+				OnShutdown:    true,
+				RetentionDays: DefaultSnapshotRetentionDays,
+			},
 		},
 		Log: LogSection{
 			Level:  DefaultLogLevel,
@@ -0,0 +1,71 @@
+// Package config defines the server configuration structure.
+//
+// @design DS-0301
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
+	"github.com/yndnr/tokmesh-go/internal/server/httpserver"
+)
+
+// ToRouterConfig converts ServerConfig to the configuration of the HTTP
+// router, on top of httpserver.DefaultRouterConfig. The caller sets the
+// services, or the handler, before calling httpserver.NewRouter.
+func ToRouterConfig(cfg *ServerConfig, logger *slog.Logger) (*httpserver.RouterConfig, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("server config is nil")
+	}
+
+	routerCfg := httpserver.DefaultRouterConfig()
+	routerCfg.Logger = logger
+	routerCfg.CertAPIKeys = cfg.Server.HTTP.CertAPIKeys
+	return routerCfg, nil
+}
+
+// ToHTTPTLSConfig builds the TLS configuration of the HTTPS listener. It
+// returns nil if HTTPS is not configured.
+//
+// The certificate is served by the returned watcher, so a rotated
+// certificate (e.g. renewed by cert-manager) is picked up without a
+// restart; the caller starts the watcher and stops it on shutdown. Client
+// certificates are verified against security.tls_ca_file if set.
+func ToHTTPTLSConfig(cfg *ServerConfig, logger *slog.Logger) (*tls.Config, *tlsroots.Watcher, error) {
+	if cfg == nil {
+		return nil, nil, fmt.Errorf("server config is nil")
+	}
+	hc := &cfg.Server.HTTP
+	if hc.TLSCertFile == "" || hc.TLSKeyFile == "" {
+		return nil, nil, nil
+	}
+
+	minVersion, err := tlsroots.ParseTLSVersion(hc.TLSMinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipherSuites, err := tlsroots.ParseCipherSuites(hc.TLSCipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watcher, err := tlsroots.NewWatcher(hc.TLSCertFile, hc.TLSKeyFile, tlsroots.WithLogger(logger))
+	if err != nil {
+		return nil, nil, fmt.Errorf("load http tls certificate: %w", err)
+	}
+
+	var clientCAs *tlsroots.Pool
+	if cfg.Security.TLSCAFile != "" {
+		clientCAs = tlsroots.NewEmptyPool()
+		if err := clientCAs.AddCertFile(cfg.Security.TLSCAFile); err != nil {
+			return nil, nil, fmt.Errorf("load client ca: %w", err)
+		}
+	}
+
+	tlsConfig := tlsroots.ServerConfig(watcher, clientCAs, hc.RequireClientCert)
+	tlsConfig.MinVersion = minVersion
+	tlsConfig.CipherSuites = cipherSuites
+	return tlsConfig, watcher, nil
+}
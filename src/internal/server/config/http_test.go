@@ -0,0 +1,139 @@
+// Package config defines the server configuration structure.
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/server/httpserver"
+	"github.com/yndnr/tokmesh-go/internal/storage/memory"
+)
+
+func TestVerifyHTTPTLS(t *testing.T) {
+	withCA := &SecuritySection{TLSCAFile: "ca.pem"}
+	tests := []struct {
+		name    string
+		cfg     HTTPConfig
+		sec     *SecuritySection
+		wantErr bool
+	}{
+		{"plain", HTTPConfig{}, &SecuritySection{}, false},
+		{"tls", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", TLSMinVersion: "1.3"}, &SecuritySection{}, false},
+		{"cert without key", HTTPConfig{TLSCertFile: "c.pem"}, &SecuritySection{}, true},
+		{"bad min version", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", TLSMinVersion: "1.0"}, &SecuritySection{}, true},
+		{"bad cipher suite", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, &SecuritySection{}, true},
+		{"client cert without ca", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", RequireClientCert: true}, &SecuritySection{}, true},
+		{"client cert without tls", HTTPConfig{RequireClientCert: true}, withCA, true},
+		{"client cert", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", RequireClientCert: true}, withCA, false},
+		{"cert keys", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", CertAPIKeys: map[string]string{"DNS:gw.example.org": "tmak-1"}}, withCA, false},
+		{"invalid identity", HTTPConfig{TLSCertFile: "c.pem", TLSKeyFile: "k.pem", CertAPIKeys: map[string]string{"gw": "tmak-1"}}, withCA, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyHTTPTLS(&tt.cfg, tt.sec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyHTTPTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToHTTPTLSConfig(t *testing.T) {
+	cfg := Default()
+	tlsConfig, watcher, err := ToHTTPTLSConfig(cfg, slog.Default())
+	if err != nil || tlsConfig != nil || watcher != nil {
+		t.Fatalf("without certificate: %v, %v, %v", tlsConfig, watcher, err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCertAndKey(t, certFile, keyFile)
+
+	cfg.Server.HTTP.TLSCertFile = certFile
+	cfg.Server.HTTP.TLSKeyFile = keyFile
+	cfg.Server.HTTP.TLSMinVersion = "1.3"
+	cfg.Server.HTTP.TLSCipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	cfg.Security.TLSCAFile = certFile
+
+	tlsConfig, watcher, err = ToHTTPTLSConfig(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("ToHTTPTLSConfig failed: %v", err)
+	}
+	if watcher == nil || tlsConfig.GetCertificate == nil {
+		t.Fatal("certificate should be served by the watcher")
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x", tlsConfig.MinVersion)
+	}
+	if len(tlsConfig.CipherSuites) != 1 || tlsConfig.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("CipherSuites = %v", tlsConfig.CipherSuites)
+	}
+	if tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven || tlsConfig.ClientCAs == nil {
+		t.Errorf("ClientAuth = %v, want optional verification against security.tls_ca_file", tlsConfig.ClientAuth)
+	}
+
+	cfg.Server.HTTP.RequireClientCert = true
+	if tlsConfig, _, _ = ToHTTPTLSConfig(cfg, slog.Default()); tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("ClientAuth = %v, want required", tlsConfig.ClientAuth)
+	}
+}
+
+func TestToRouterConfig_CertAPIKeys(t *testing.T) {
+	store := memory.New()
+	tokenSvc := service.NewTokenService(store, nil)
+	authSvc := service.NewAuthService(memory.NewAPIKeyStore(), nil)
+	key, err := authSvc.CreateAPIKey(context.Background(), &service.CreateAPIKeyRequest{Name: "gateway", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	writeTestCertAndKey(t, certFile, filepath.Join(dir, "key.pem"))
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+
+	cfg := Default()
+	cfg.Server.HTTP.CertAPIKeys = map[string]string{"CN=test.local": key.KeyID}
+	routerCfg, err := ToRouterConfig(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("ToRouterConfig: %v", err)
+	}
+	routerCfg.SessionService = service.NewSessionService(store, tokenSvc)
+	routerCfg.TokenService = tokenSvc
+	routerCfg.AuthService = authSvc
+	router := httpserver.NewRouter(routerCfg)
+
+	get := func(state *tls.ConnectionState) int {
+		req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		req.TLS = state
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := get(nil); code != http.StatusUnauthorized {
+		t.Errorf("without credentials: status = %d, want 401", code)
+	}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	if code := get(verified); code != http.StatusOK {
+		t.Errorf("with a mapped client certificate: status = %d, want 200", code)
+	}
+}
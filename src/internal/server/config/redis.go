@@ -0,0 +1,53 @@
+// Package config defines the server configuration structure.
+//
+// @design DS-0301
+package config
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
+	"github.com/yndnr/tokmesh-go/internal/server/redisserver"
+)
+
+// ToRedisConfig converts ServerConfig to redisserver.Config.
+//
+// When TLS is enabled, the returned watcher serves the listener's
+// certificate; the caller starts it so certificate rotation is picked up
+// without a restart, and stops it on shutdown. The watcher is nil
+// otherwise.
+func ToRedisConfig(cfg *ServerConfig, logger *slog.Logger) (*redisserver.Config, *tlsroots.Watcher, error) {
+	if cfg == nil {
+		return nil, nil, fmt.Errorf("server config is nil")
+	}
+	rc := &cfg.Server.Redis
+
+	redisCfg := &redisserver.Config{
+		PlainEnabled:       rc.PlainEnabled,
+		PlainAddress:       rc.Addr,
+		AllowInsecurePlain: rc.AllowInsecurePlain,
+	}
+	if !rc.TLS.Enabled {
+		return redisCfg, nil, nil
+	}
+
+	watcher, err := tlsroots.NewWatcher(rc.TLS.CertFile, rc.TLS.KeyFile, tlsroots.WithLogger(logger))
+	if err != nil {
+		return nil, nil, fmt.Errorf("load redis tls certificate: %w", err)
+	}
+
+	var clientCAs *tlsroots.Pool
+	if rc.TLS.ClientCAFile != "" {
+		clientCAs = tlsroots.NewEmptyPool()
+		if err := clientCAs.AddCertFile(rc.TLS.ClientCAFile); err != nil {
+			return nil, nil, fmt.Errorf("load redis client ca: %w", err)
+		}
+	}
+
+	redisCfg.TLSEnabled = true
+	redisCfg.TLSAddress = rc.TLS.Addr
+	redisCfg.TLSConfig = tlsroots.ServerConfig(watcher, clientCAs, rc.TLS.RequireClientCert)
+	redisCfg.CertAPIKeys = rc.TLS.CertAPIKeys
+	return redisCfg, watcher, nil
+}
@@ -0,0 +1,151 @@
+// Package config defines the server configuration structure.
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyRedis(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RedisConfig
+		wantErr bool
+	}{
+		{"disabled", RedisConfig{Addr: "0.0.0.0:6379", PlainEnabled: true}, false},
+		{"loopback plain", RedisConfig{Enabled: true, Addr: "127.0.0.1:6379", PlainEnabled: true}, false},
+		{"non-loopback plain", RedisConfig{Enabled: true, Addr: "0.0.0.0:6379", PlainEnabled: true}, true},
+		{"non-loopback plain allowed", RedisConfig{Enabled: true, Addr: "0.0.0.0:6379", PlainEnabled: true, AllowInsecurePlain: true}, false},
+		{"no listener", RedisConfig{Enabled: true}, true},
+		{"tls without cert", RedisConfig{Enabled: true, TLS: RedisTLSConfig{Enabled: true, Addr: "0.0.0.0:6380"}}, true},
+		{"tls", RedisConfig{Enabled: true, TLS: RedisTLSConfig{Enabled: true, Addr: "0.0.0.0:6380", CertFile: "c.pem", KeyFile: "k.pem"}}, false},
+		{"cert keys without client ca", RedisConfig{Enabled: true, TLS: RedisTLSConfig{
+			Enabled: true, CertFile: "c.pem", KeyFile: "k.pem",
+			CertAPIKeys: map[string]string{"CN=gateway": "tmak-1"},
+		}}, true},
+		{"require client cert without client ca", RedisConfig{Enabled: true, TLS: RedisTLSConfig{
+			Enabled: true, CertFile: "c.pem", KeyFile: "k.pem", RequireClientCert: true,
+		}}, true},
+		{"invalid identity", RedisConfig{Enabled: true, TLS: RedisTLSConfig{
+			Enabled: true, CertFile: "c.pem", KeyFile: "k.pem", ClientCAFile: "ca.pem",
+			CertAPIKeys: map[string]string{"gateway": "tmak-1"},
+		}}, true},
+		{"cert keys", RedisConfig{Enabled: true, TLS: RedisTLSConfig{
+			Enabled: true, CertFile: "c.pem", KeyFile: "k.pem", ClientCAFile: "ca.pem",
+			CertAPIKeys: map[string]string{"CN=gateway": "tmak-1", "URI:spiffe://example.org/gw": "tmak-2"},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyRedis(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToRedisConfig_Plain(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Redis.Enabled = true
+
+	redisCfg, watcher, err := ToRedisConfig(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("ToRedisConfig failed: %v", err)
+	}
+	if watcher != nil {
+		t.Error("watcher should be nil without TLS")
+	}
+	if !redisCfg.PlainEnabled || redisCfg.PlainAddress != DefaultRedisAddr {
+		t.Errorf("plain = %v %q", redisCfg.PlainEnabled, redisCfg.PlainAddress)
+	}
+	if redisCfg.TLSEnabled {
+		t.Error("TLSEnabled should be false")
+	}
+}
+
+func TestToRedisConfig_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCertAndKey(t, certFile, keyFile)
+
+	cfg := Default()
+	cfg.Server.Redis.Enabled = true
+	cfg.Server.Redis.PlainEnabled = false
+	cfg.Server.Redis.TLS = RedisTLSConfig{
+		Enabled:           true,
+		Addr:              "0.0.0.0:6380",
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		ClientCAFile:      certFile,
+		RequireClientCert: true,
+		CertAPIKeys:       map[string]string{"CN=gateway": "tmak-1"},
+	}
+
+	redisCfg, watcher, err := ToRedisConfig(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("ToRedisConfig failed: %v", err)
+	}
+	if watcher == nil {
+		t.Fatal("watcher should be set with TLS")
+	}
+	if !redisCfg.TLSEnabled || redisCfg.TLSAddress != "0.0.0.0:6380" {
+		t.Errorf("tls = %v %q", redisCfg.TLSEnabled, redisCfg.TLSAddress)
+	}
+	if redisCfg.TLSConfig == nil || redisCfg.TLSConfig.GetCertificate == nil || redisCfg.TLSConfig.ClientCAs == nil {
+		t.Error("TLSConfig should serve the watched certificate and verify client certificates")
+	}
+	if redisCfg.CertAPIKeys["CN=gateway"] != "tmak-1" {
+		t.Errorf("CertAPIKeys = %v", redisCfg.CertAPIKeys)
+	}
+
+	cfg.Server.Redis.TLS.CertFile = filepath.Join(dir, "missing.pem")
+	if _, _, err := ToRedisConfig(cfg, slog.Default()); err == nil {
+		t.Error("expected error for missing certificate")
+	}
+}
+
+// writeTestCertAndKey writes a self-signed certificate and key pair.
+func writeTestCertAndKey(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test.local"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
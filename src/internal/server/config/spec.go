@@ -21,16 +21,53 @@ type ServerSection struct {
 }
 
 // HTTPConfig configures the HTTP server.
+//
+// HTTPS is enabled by setting TLSCertFile and TLSKeyFile. If
+// security.tls_ca_file is set, client certificates signed by it are
+// verified.
 type HTTPConfig struct {
 	Addr        string `koanf:"addr"`
 	TLSCertFile string `koanf:"tls_cert_file"`
 	TLSKeyFile  string `koanf:"tls_key_file"`
+	// TLSMinVersion is the minimum TLS version, "1.2" (default) or "1.3".
+	TLSMinVersion string `koanf:"tls_min_version"`
+	// TLSCipherSuites restricts the TLS 1.2 cipher suites (Go names, e.g.
+	// "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"); empty keeps Go's defaults.
+	TLSCipherSuites []string `koanf:"tls_cipher_suites"`
+	// RequireClientCert rejects clients without a verified certificate.
+	RequireClientCert bool `koanf:"require_client_cert"`
+	// CertAPIKeys maps client certificate identities ("URI:<uri>",
+	// "DNS:<name>", "EMAIL:<address>" or "CN=<common name>") to the API
+	// key IDs such clients authenticate as.
+	CertAPIKeys map[string]string `koanf:"cert_api_keys"`
 }
 
 // RedisConfig configures the Redis protocol server.
 type RedisConfig struct {
 	Enabled bool   `koanf:"enabled"`
 	Addr    string `koanf:"addr"`
+	// PlainEnabled enables the plaintext listener on Addr.
+	PlainEnabled bool `koanf:"plain_enabled"`
+	// AllowInsecurePlain permits the plaintext listener on a non-loopback
+	// address.
+	AllowInsecurePlain bool           `koanf:"allow_insecure_plain"`
+	TLS                RedisTLSConfig `koanf:"tls"`
+}
+
+// RedisTLSConfig configures the TLS listener of the Redis protocol server.
+type RedisTLSConfig struct {
+	Enabled  bool   `koanf:"enabled"`
+	Addr     string `koanf:"addr"`
+	CertFile string `koanf:"cert_file"`
+	KeyFile  string `koanf:"key_file"`
+	// ClientCAFile enables client certificate verification against the
+	// CAs in this PEM file.
+	ClientCAFile      string `koanf:"client_ca_file"`
+	RequireClientCert bool   `koanf:"require_client_cert"`
+	// CertAPIKeys maps client certificate identities ("URI:<uri>",
+	// "DNS:<name>", "EMAIL:<address>" or "CN=<common name>") to the API
+	// key IDs such clients authenticate as.
+	CertAPIKeys map[string]string `koanf:"cert_api_keys"`
 }
 
 // ClusterConfig configures the cluster server.
@@ -45,9 +82,97 @@ type LocalConfig struct {
 
 // StorageSection configures storage behavior.
 type StorageSection struct {
-	DataDir         string        `koanf:"data_dir"`
+	DataDir string `koanf:"data_dir"`
+	// Backend is where sessions are persisted: "wal" (default) keeps all
+	// of them in memory, logged to the WAL; "badger" keeps them in
+	// Badger, with memory as a cache.
+	//
+	// Switching a data directory from "wal" to "badger" migrates online:
+	// on the first start with "badger", the server recovers the WAL data
+	// as the "wal" backend would, then serves requests while it copies
+	// every session into Badger; cache_sessions applies once the copy is
+	// done. A copy interrupted by a shutdown starts over on the next
+	// start, keeping the writes made meanwhile.
+	Backend string `koanf:"backend"`
+	// CacheSessions, with the badger backend, is the maximum number of
+	// sessions kept in memory. Zero keeps all of them.
+	CacheSessions int `koanf:"cache_sessions"`
+	// WALSyncMode is when writes are acknowledged by default: "group"
+	// once fsynced (sharing fsyncs between concurrent writes), "sync"
+	// once fsynced one batch at a time, or "batch" once buffered in
+	// memory. API keys and requests can select another durability.
+	WALSyncMode     string        `koanf:"wal_sync_mode"`
 	WALSyncInterval time.Duration `koanf:"wal_sync_interval"`
 	SnapshotKeep    int           `koanf:"snapshot_keep"`
+	// GCInterval is how often expired sessions are removed (and their
+	// expiration published).
+	GCInterval time.Duration `koanf:"gc_interval"`
+	// TouchCoalesceInterval, if set, logs at most one touch per session
+	// per interval; the latest touch is still logged. Zero logs every
+	// touch.
+	TouchCoalesceInterval time.Duration `koanf:"touch_coalesce_interval"`
+	// WALArchiveDir, if set, receives the WAL segments compacted after a
+	// snapshot instead of deleting them, for point-in-time recovery.
+	WALArchiveDir string `koanf:"wal_archive_dir"`
+	// Archive ships closed WAL segments and snapshots off the node for
+	// disaster recovery.
+	Archive ArchiveConfig `koanf:"archive"`
+	// Snapshot configures when snapshots are taken with the wal backend.
+	Snapshot SnapshotConfig `koanf:"snapshot"`
+}
+
+// SnapshotConfig configures when snapshots are taken, with the wal
+// backend: as the WAL grows past the latest snapshot, as it ages, and on
+// shutdown. Zero disables a trigger.
+type SnapshotConfig struct {
+	// Interval is the maximum age of the latest snapshot, if writes were
+	// logged since.
+	Interval time.Duration `koanf:"interval"`
+	// WALBytes and WALEntries take a snapshot once the WAL holds this
+	// many bytes or entries past the latest snapshot.
+	WALBytes   int64 `koanf:"wal_bytes"`
+	WALEntries int64 `koanf:"wal_entries"`
+	// CheckInterval is how often the triggers are evaluated.
+	CheckInterval time.Duration `koanf:"check_interval"`
+	// HighWriteRate, in WAL entries per second, postpones a due snapshot
+	// while writes are faster, for at most MaxDefer.
+	HighWriteRate float64       `koanf:"high_write_rate"`
+	MaxDefer      time.Duration `koanf:"max_defer"`
+	// OnShutdown takes a snapshot on shutdown if writes were logged
+	// since the latest one, for a faster restart.
+	OnShutdown bool `koanf:"on_shutdown"`
+	// RetentionDays keeps the snapshots of this many days besides the
+	// snapshot_keep newest ones; zero means 7.
+	RetentionDays int `koanf:"retention_days"`
+}
+
+// ArchiveConfig configures shipping closed WAL segments and snapshots to
+// an archive, which "tokmesh-cli data archive restore" pulls back.
+type ArchiveConfig struct {
+	// Target is where to ship: "" (off), "dir" (a local directory or
+	// NFS mount) or "s3" (an S3-compatible object store, e.g. MinIO).
+	Target string `koanf:"target"`
+	Dir    string `koanf:"dir"`
+
+	S3Endpoint        string `koanf:"s3_endpoint"`
+	S3Region          string `koanf:"s3_region"`
+	S3Bucket          string `koanf:"s3_bucket"`
+	S3Prefix          string `koanf:"s3_prefix"`
+	S3AccessKeyID     string `koanf:"s3_access_key_id"`
+	S3SecretAccessKey string `koanf:"s3_secret_access_key"`
+
+	// ScanInterval is how often unshipped files are looked for, besides
+	// after WAL rotations and snapshots.
+	ScanInterval time.Duration `koanf:"scan_interval"`
+	// MaxRetries and RetryBackoff retry failed uploads with a doubling
+	// backoff before waiting for the next scan.
+	MaxRetries   int           `koanf:"max_retries"`
+	RetryBackoff time.Duration `koanf:"retry_backoff"`
+	// RetentionDays deletes archived snapshots older than this, with the
+	// WAL segments they cover, keeping at least RetentionMinSnapshots.
+	// Zero keeps everything.
+	RetentionDays         int `koanf:"retention_days"`
+	RetentionMinSnapshots int `koanf:"retention_min_snapshots"`
 }
 
 // SecuritySection configures security settings.
@@ -3,7 +3,13 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
 )
 
 // Verify validates the configuration.
@@ -11,6 +17,9 @@ func Verify(cfg *ServerConfig) error {
 	if err := verifyServer(&cfg.Server); err != nil {
 		return err
 	}
+	if err := verifyHTTPTLS(&cfg.Server.HTTP, &cfg.Security); err != nil {
+		return err
+	}
 	if err := verifyStorage(&cfg.Storage); err != nil {
 		return err
 	}
@@ -21,9 +30,89 @@ func verifyServer(cfg *ServerSection) error {
 	// TODO: Validate address formats
 	// TODO: Check for port conflicts
 	// TODO: Verify TLS cert/key files exist if specified
+	if err := verifyRedis(&cfg.Redis); err != nil {
+		return err
+	}
 	return nil
 }
 
+// verifyRedis validates the Redis protocol server configuration.
+//
+// Plaintext on a non-loopback address must be allowed explicitly, since
+// AUTH secrets and tokens would cross the network in clear text.
+func verifyRedis(cfg *RedisConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if !cfg.PlainEnabled && !cfg.TLS.Enabled {
+		return errors.New("server.redis: at least one of plain_enabled and tls.enabled is required")
+	}
+	if cfg.PlainEnabled && !cfg.AllowInsecurePlain && !tlsroots.IsLoopbackAddr(cfg.Addr) {
+		return fmt.Errorf("server.redis.addr %q is not a loopback address: enable tls and disable plain_enabled, or set allow_insecure_plain", cfg.Addr)
+	}
+
+	tlsCfg := &cfg.TLS
+	if !tlsCfg.Enabled {
+		return nil
+	}
+	if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+		return errors.New("server.redis.tls.cert_file and server.redis.tls.key_file are required")
+	}
+	if tlsCfg.ClientCAFile == "" && (tlsCfg.RequireClientCert || len(tlsCfg.CertAPIKeys) > 0) {
+		return errors.New("server.redis.tls.client_ca_file is required for client certificate authentication")
+	}
+	return verifyCertAPIKeys("server.redis.tls.cert_api_keys", tlsCfg.CertAPIKeys)
+}
+
+// verifyHTTPTLS validates the HTTPS settings of the HTTP server.
+func verifyHTTPTLS(cfg *HTTPConfig, sec *SecuritySection) error {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("server.http.tls_cert_file and server.http.tls_key_file must be set together")
+	}
+	if _, err := tlsroots.ParseTLSVersion(cfg.TLSMinVersion); err != nil {
+		return fmt.Errorf("server.http.tls_min_version: %w", err)
+	}
+	if _, err := tlsroots.ParseCipherSuites(cfg.TLSCipherSuites); err != nil {
+		return fmt.Errorf("server.http.tls_cipher_suites: %w", err)
+	}
+
+	if !cfg.RequireClientCert && len(cfg.CertAPIKeys) == 0 {
+		return nil
+	}
+	if cfg.TLSCertFile == "" {
+		return errors.New("server.http: client certificate authentication requires tls_cert_file and tls_key_file")
+	}
+	if sec.TLSCAFile == "" {
+		return errors.New("server.http: client certificate authentication requires security.tls_ca_file")
+	}
+	return verifyCertAPIKeys("server.http.cert_api_keys", cfg.CertAPIKeys)
+}
+
+// verifyCertAPIKeys validates a client certificate identity to API key
+// mapping.
+func verifyCertAPIKeys(field string, certAPIKeys map[string]string) error {
+	for identity, keyID := range certAPIKeys {
+		if !validCertIdentity(identity) {
+			return fmt.Errorf("%s: invalid identity %q (want URI:, DNS:, EMAIL: or CN= prefix)", field, identity)
+		}
+		if keyID == "" {
+			return fmt.Errorf("%s: empty key ID for %q", field, identity)
+		}
+	}
+	return nil
+}
+
+// validCertIdentity reports whether s has the form of a certificate
+// identity produced by tlsroots.CertIdentities.
+func validCertIdentity(s string) bool {
+	for _, prefix := range []string{"URI:", "DNS:", "EMAIL:", "CN="} {
+		if strings.HasPrefix(s, prefix) && len(s) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func verifyStorage(cfg *StorageSection) error {
 	if cfg.DataDir == "" {
 		return errors.New("storage.data_dir is required")
@@ -34,9 +123,88 @@ func verifyStorage(cfg *StorageSection) error {
 		return errors.New("cannot create data directory: " + err.Error())
 	}
 
+	switch cfg.Backend {
+	case "", "wal", "badger":
+	default:
+		return fmt.Errorf("storage.backend must be one of: wal, badger (got %q)", cfg.Backend)
+	}
+
+	if cfg.CacheSessions < 0 {
+		return errors.New("storage.cache_sessions must not be negative")
+	}
+
+	switch cfg.WALSyncMode {
+	case "", "sync", "batch", "group":
+	default:
+		return fmt.Errorf("storage.wal_sync_mode must be one of: sync, batch, group (got %q)", cfg.WALSyncMode)
+	}
+
 	if cfg.SnapshotKeep < 1 {
 		return errors.New("storage.snapshot_keep must be at least 1")
 	}
 
+	if cfg.GCInterval != 0 && (cfg.GCInterval < 100*time.Millisecond || cfg.GCInterval > time.Minute) {
+		return fmt.Errorf("storage.gc_interval must be between 100ms and 1m (got %s)", cfg.GCInterval)
+	}
+
+	if cfg.TouchCoalesceInterval != 0 && (cfg.TouchCoalesceInterval < 100*time.Millisecond || cfg.TouchCoalesceInterval > 5*time.Minute) {
+		return fmt.Errorf("storage.touch_coalesce_interval must be 0 or between 100ms and 5m (got %s)", cfg.TouchCoalesceInterval)
+	}
+
+	if cfg.WALArchiveDir != "" && filepath.Clean(cfg.WALArchiveDir) == filepath.Join(cfg.DataDir, "data", "wal") {
+		return errors.New("storage.wal_archive_dir must not be the WAL directory")
+	}
+
+	if err := verifySnapshot(&cfg.Snapshot); err != nil {
+		return err
+	}
+
+	return verifyArchive(&cfg.Archive, cfg.DataDir)
+}
+
+func verifySnapshot(cfg *SnapshotConfig) error {
+	if cfg.Interval < 0 || cfg.MaxDefer < 0 {
+		return errors.New("storage.snapshot.interval and max_defer must not be negative")
+	}
+	if cfg.WALBytes < 0 || cfg.WALEntries < 0 || cfg.HighWriteRate < 0 {
+		return errors.New("storage.snapshot.wal_bytes, wal_entries and high_write_rate must not be negative")
+	}
+	if cfg.CheckInterval != 0 && (cfg.CheckInterval < 100*time.Millisecond || cfg.CheckInterval > 10*time.Minute) {
+		return fmt.Errorf("storage.snapshot.check_interval must be 0 or between 100ms and 10m (got %s)", cfg.CheckInterval)
+	}
+	if cfg.RetentionDays < 0 {
+		return errors.New("storage.snapshot.retention_days must not be negative")
+	}
+	return nil
+}
+
+func verifyArchive(cfg *ArchiveConfig, dataDir string) error {
+	switch cfg.Target {
+	case "":
+		return nil
+	case "dir":
+		if cfg.Dir == "" {
+			return errors.New("storage.archive.dir is required with target dir")
+		}
+		if rel, err := filepath.Rel(filepath.Join(dataDir, "data"), cfg.Dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return errors.New("storage.archive.dir must be outside storage.data_dir/data")
+		}
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return errors.New("storage.archive.s3_endpoint and storage.archive.s3_bucket are required with target s3")
+		}
+		if cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return errors.New("storage.archive.s3_access_key_id and storage.archive.s3_secret_access_key are required with target s3")
+		}
+	default:
+		return fmt.Errorf("storage.archive.target must be one of: dir, s3 (got %q)", cfg.Target)
+	}
+
+	if cfg.MaxRetries < 0 {
+		return errors.New("storage.archive.max_retries must not be negative")
+	}
+	if cfg.RetentionDays < 0 || cfg.RetentionMinSnapshots < 0 {
+		return errors.New("storage.archive.retention_days and retention_min_snapshots must not be negative")
+	}
 	return nil
 }
@@ -2,14 +2,20 @@
 //
 // This package implements the primary external API using stdlib net/http:
 //
-//   - Session endpoints: /sessions, /sessions/{id}, /sessions/{id}/renew
-//   - Token endpoints: /tokens/validate
-//   - Admin endpoints: /admin/v1/*
+//   - Session endpoints: /sessions, /sessions/{id}, /sessions/{id}/renew,
+//     /sessions:batch, /sessions/revoke:batch, and the admin-only
+//     revoke-by-criteria endpoint /sessions/revoke:query
+//   - Token endpoints: /tokens/validate, /tokens/validate:batch
+//   - Admin endpoints: /admin/v1/*, including streaming session
+//     import/export at /admin/v1/sessions/import and /admin/v1/sessions/export,
+//     and background job status at /admin/v1/jobs/{job_id}
 //   - Health endpoints: /health, /ready, /metrics
 //
 // Features:
 //
 //   - TLS support with automatic certificate reload
+//   - Optional mTLS: verified client certificates can authenticate as a
+//     mapped API key (MiddlewareConfig.CertAPIKeys)
 //   - Middleware chain: Auth, RateLimit, Audit, RequestID
 //   - Graceful shutdown with configurable timeout
 //   - Prometheus metrics integration
@@ -3,21 +3,133 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/inspect"
 )
 
+// CertificateSource reports the certificate a TLS listener currently
+// serves. It is implemented by tlsroots.Watcher.
+type CertificateSource interface {
+	NotAfter() time.Time
+}
+
+// tlsListener is a TLS listener reported in the status summary.
+type tlsListener struct {
+	name string
+	src  CertificateSource
+}
+
+// AddTLSCertificate reports a TLS listener's certificate expiry in the
+// status summary. It must be called before the handler serves requests.
+func (h *Handler) AddTLSCertificate(listener string, src CertificateSource) {
+	h.certs = append(h.certs, tlsListener{name: listener, src: src})
+}
+
+// SnapshotScheduler reports the snapshot policy. It is implemented by
+// the storage engine.
+type SnapshotScheduler interface {
+	SnapshotSchedule() (*storage.SnapshotSchedule, error)
+}
+
+// SetSnapshotScheduler reports the snapshot policy in the status
+// summary. It must be called before the handler serves requests.
+func (h *Handler) SetSnapshotScheduler(s SnapshotScheduler) {
+	h.snapshots = s
+}
+
 // handleAdminStatus handles GET /admin/v1/status/summary.
 //
 // @design DS-0302
 func (h *Handler) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
-	h.writeJSON(w, r, http.StatusOK, map[string]any{
-		"status":  "running",
-		"version": "dev",
-		"time":    time.Now().UTC().Format(time.RFC3339),
-	})
+	h.writeJSON(w, r, http.StatusOK, h.StatusSummary())
+}
+
+// StatusSummary returns the server status served on
+// GET /admin/v1/status/summary, for transports other than HTTP.
+//
+// @design DS-0302
+func (h *Handler) StatusSummary() map[string]any {
+	now := time.Now()
+	status := map[string]any{
+		"status":         "running",
+		"version":        "dev",
+		"time":           now.UTC().Format(time.RFC3339),
+		"started_at":     h.startedAt.UTC().Format(time.RFC3339),
+		"uptime_seconds": int64(now.Sub(h.startedAt).Seconds()),
+	}
+
+	if len(h.certs) > 0 {
+		certs := make([]TLSCertificateStatus, 0, len(h.certs))
+		for _, l := range h.certs {
+			notAfter := l.src.NotAfter()
+			certs = append(certs, TLSCertificateStatus{
+				Listener:         l.name,
+				NotAfter:         notAfter.UTC(),
+				ExpiresInSeconds: int64(notAfter.Sub(now).Seconds()),
+			})
+		}
+		status["tls_certificates"] = certs
+	}
+
+	if h.snapshots != nil {
+		if sched, err := h.snapshots.SnapshotSchedule(); err == nil {
+			status["snapshot_schedule"] = snapshotScheduleToStatus(sched)
+		} else if !errors.Is(err, storage.ErrNoWAL) {
+			h.logger.Warn("snapshot schedule unavailable", "error", err)
+		}
+	}
+	return status
+}
+
+// snapshotScheduleToStatus converts the storage snapshot schedule.
+func snapshotScheduleToStatus(s *storage.SnapshotSchedule) *SnapshotScheduleStatus {
+	st := &SnapshotScheduleStatus{
+		Policy: SnapshotPolicyStatus{
+			MaxWALBytes:     s.Policy.MaxWALBytes,
+			MaxWALEntries:   s.Policy.MaxWALEntries,
+			MaxAgeMs:        s.MaxAge.Milliseconds(),
+			CheckIntervalMs: s.Policy.CheckInterval.Milliseconds(),
+			HighWriteRate:   s.Policy.HighWriteRate,
+			MaxDeferMs:      s.Policy.MaxDefer.Milliseconds(),
+			OnShutdown:      s.Policy.OnShutdown,
+		},
+		WALBytes:       s.WALBytes,
+		WALEntries:     s.WALEntries,
+		WriteRate:      s.WriteRate,
+		LastSnapshotAt: optionalTime(s.LastSnapshot),
+		LastCheckAt:    optionalTime(s.LastCheck),
+		NextCheckAt:    optionalTime(s.NextCheck),
+		DeferredSince:  optionalTime(s.DeferredSince),
+		Snapshots:      s.Snapshots,
+		Deferrals:      s.Deferrals,
+		Failures:       s.Failures,
+	}
+	if d := s.LastDecision; d != nil {
+		st.LastDecision = &SnapshotDecisionStatus{At: d.At, Action: d.Action, Trigger: d.Trigger, Reason: d.Reason}
+	}
+	if r := s.LastRun; r != nil {
+		st.LastRun = &SnapshotRunStatus{
+			Trigger:      r.Trigger,
+			StartedAt:    r.Started,
+			DurationMs:   r.Duration.Milliseconds(),
+			SnapshotMs:   r.Snapshot.Milliseconds(),
+			PruneMs:      r.Prune.Milliseconds(),
+			CompactMs:    r.Compact.Milliseconds(),
+			SessionCount: r.SessionCount,
+			SizeBytes:    r.Size,
+			Error:        r.Err,
+		}
+		if r.WALOffset > 0 {
+			st.LastRun.WALOffset = inspect.FormatOffset(r.WALOffset)
+		}
+	}
+	return st
 }
 
 // handleGCTrigger handles POST /admin/v1/gc/trigger.
@@ -63,12 +175,17 @@ func (h *Handler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid role, must be one of: metrics, validator, issuer, admin", nil)
 		return
 	}
+	if !domain.IsValidDurability(req.Durability) {
+		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid durability, must be one of: none, buffered, fsync", nil)
+		return
+	}
 
 	// Create API key
 	resp, err := h.authSvc.CreateAPIKey(r.Context(), &service.CreateAPIKeyRequest{
 		Name:        req.Name,
 		Role:        req.Role,
 		Description: req.Description,
+		Durability:  req.Durability,
 	})
 	if err != nil {
 		h.handleServiceError(w, r, err)
@@ -109,6 +226,7 @@ func (h *Handler) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 			Name:        key.Name,
 			Role:        key.Role,
 			Description: key.Description,
+			Durability:  key.Durability,
 			Enabled:     key.Enabled,
 			CreatedAt:   key.CreatedAt,
 			LastUsedAt:  key.LastUsedAt,
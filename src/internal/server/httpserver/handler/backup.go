@@ -0,0 +1,123 @@
+// Package handler provides HTTP request handlers for TokMesh.
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/inspect"
+)
+
+// pitrJobKind identifies point-in-time recovery background jobs.
+const pitrJobKind = "pitr"
+
+// PointInTimeRecoverer recovers the sessions as they were at a point in
+// time. It is implemented by the storage engine.
+type PointInTimeRecoverer interface {
+	RecoverToPoint(ctx context.Context, cfg storage.PointInTimeConfig, progress func(applied int)) (*storage.PointInTimeResult, error)
+}
+
+// SetPointInTimeRecoverer enables POST /admin/v1/backups/pitr. Without a
+// recoverer the endpoint is not found.
+func (h *Handler) SetPointInTimeRecoverer(r PointInTimeRecoverer) {
+	h.pitr = r
+}
+
+// handlePointInTimeRecovery handles POST /admin/v1/backups/pitr.
+//
+// Rebuilds the sessions as they were at a target time or WAL offset into
+// a new data directory or snapshot on the server, e.g. to undo a mass
+// revocation. The served sessions are not changed: the operator restarts
+// the server on the output. Recovery runs as a background job (202
+// Accepted).
+//
+// @design DS-0302
+func (h *Handler) handlePointInTimeRecovery(w http.ResponseWriter, r *http.Request) {
+	if h.pitr == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req PointInTimeRecoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", "invalid request body", nil)
+		return
+	}
+
+	cfg := storage.PointInTimeConfig{
+		OutputDataDir:     req.OutputDataDir,
+		OutputSnapshotDir: req.OutputSnapshotDir,
+	}
+	if req.TargetTime == "" && req.TargetOffset == "" {
+		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-1002", "target_time or target_offset is required", nil)
+		return
+	}
+	if req.TargetTime != "" {
+		t, err := time.Parse(time.RFC3339, req.TargetTime)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid target_time, must be RFC 3339", nil)
+			return
+		}
+		cfg.Target.Time = t
+	}
+	if req.TargetOffset != "" {
+		offset, err := inspect.ParseOffset(req.TargetOffset)
+		if err != nil || offset == 0 {
+			h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid target_offset, must be SEGMENT[:OFFSET]", nil)
+			return
+		}
+		cfg.Target.Offset = offset
+	}
+	output := req.OutputDataDir
+	if output == "" {
+		output = req.OutputSnapshotDir
+	}
+	if (req.OutputDataDir == "") == (req.OutputSnapshotDir == "") || !filepath.IsAbs(output) {
+		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "exactly one of output_data_dir and output_snapshot_dir is required, as an absolute path", nil)
+		return
+	}
+
+	requestID := getRequestID(r)
+	h.auditPointInTimeRecovery("pitr started", requestID, req)
+
+	job, err := h.jobs.Start(pitrJobKind, 0, func(ctx context.Context, progress func(int)) error {
+		res, err := h.pitr.RecoverToPoint(ctx, cfg, progress)
+		if err != nil {
+			h.auditPointInTimeRecovery("pitr failed", requestID, req, "error", err.Error())
+			return err
+		}
+		h.auditPointInTimeRecovery("pitr finished", requestID, req,
+			"base_snapshot", res.BaseSnapshot,
+			"entries_applied", res.EntriesApplied,
+			"stop_offset", inspect.FormatOffset(res.StopOffset),
+			"target_reached", res.TargetReached,
+			"session_count", res.SessionCount,
+			"snapshot", res.Snapshot.Path)
+		return nil
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusAccepted, PointInTimeRecoveryResponse{JobID: job.ID})
+}
+
+// auditPointInTimeRecovery records a point-in-time recovery in the audit
+// log.
+func (h *Handler) auditPointInTimeRecovery(msg, requestID string, req PointInTimeRecoveryRequest, attrs ...any) {
+	attrs = append([]any{
+		"audit", true,
+		"request_id", requestID,
+		"target_time", req.TargetTime,
+		"target_offset", req.TargetOffset,
+		"output_data_dir", req.OutputDataDir,
+		"output_snapshot_dir", req.OutputSnapshotDir,
+		"reason", req.Reason,
+	}, attrs...)
+	h.logger.Info(msg, attrs...)
+}
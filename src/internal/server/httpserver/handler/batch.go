@@ -0,0 +1,159 @@
+// Package handler provides HTTP request handlers for TokMesh.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// handleBatchCreateSessions handles POST /sessions:batch.
+//
+// Items succeed or fail independently; the response is 200 with one
+// result per item unless the batch itself is invalid.
+//
+// @design DS-0301
+func (h *Handler) handleBatchCreateSessions(w http.ResponseWriter, r *http.Request) {
+	var req BatchCreateSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", "invalid request body", nil)
+		return
+	}
+
+	// Build service requests
+	clientIP := getClientIP(r)
+	svcReqs := make([]*service.CreateSessionRequest, len(req.Items))
+	for i, item := range req.Items {
+		svcReqs[i] = &service.CreateSessionRequest{
+			UserID:    item.UserID,
+			DeviceID:  item.DeviceID,
+			Data:      item.Data,
+			ClientIP:  clientIP,
+			UserAgent: r.UserAgent(),
+		}
+		if item.TTLSeconds > 0 {
+			svcReqs[i].TTL = time.Duration(item.TTLSeconds) * time.Second
+		}
+	}
+
+	// Call service
+	results, err := h.sessionSvc.CreateBatch(r.Context(), svcReqs)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := BatchCreateSessionsResponse{Items: make([]BatchCreateSessionResult, len(results))}
+	for i, result := range results {
+		if result.Err != nil {
+			resp.Items[i].Error = batchItemError(result.Err)
+			resp.Failed++
+			continue
+		}
+		expiresAt := time.UnixMilli(result.Response.ExpiresAt)
+		resp.Items[i] = BatchCreateSessionResult{
+			SessionID: result.Response.SessionID,
+			Token:     result.Response.Token,
+			ExpiresAt: &expiresAt,
+		}
+		resp.Succeeded++
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// handleBatchRevokeSessions handles POST /sessions/revoke:batch.
+//
+// @design DS-0301
+func (h *Handler) handleBatchRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	var req BatchRevokeSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", "invalid request body", nil)
+		return
+	}
+
+	// Call service
+	results, err := h.sessionSvc.RevokeBatch(r.Context(), req.SessionIDs)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := BatchRevokeSessionsResponse{Items: make([]BatchRevokeSessionResult, len(results))}
+	for i, result := range results {
+		resp.Items[i] = BatchRevokeSessionResult{
+			SessionID: req.SessionIDs[i],
+			Revoked:   result.Revoked,
+		}
+		if result.Err != nil {
+			resp.Items[i].Error = batchItemError(result.Err)
+			resp.Failed++
+		} else if result.Revoked {
+			resp.RevokedCount++
+		}
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// handleBatchValidateTokens handles POST /tokens/validate:batch.
+//
+// As with POST /tokens/validate, invalid tokens are reported per item
+// rather than as HTTP errors.
+//
+// @design DS-0301
+func (h *Handler) handleBatchValidateTokens(w http.ResponseWriter, r *http.Request) {
+	var req BatchValidateTokensRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", "invalid request body", nil)
+		return
+	}
+
+	// Build service requests
+	clientIP := getClientIP(r)
+	svcReqs := make([]*service.ValidateTokenRequest, len(req.Items))
+	for i, item := range req.Items {
+		svcReqs[i] = &service.ValidateTokenRequest{
+			Token:     item.Token,
+			Touch:     item.Touch,
+			ClientIP:  clientIP,
+			UserAgent: r.UserAgent(),
+		}
+	}
+
+	// Call service
+	results, err := h.tokenSvc.ValidateBatch(r.Context(), svcReqs)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := BatchValidateTokensResponse{Items: make([]ValidateTokenResponse, len(results))}
+	for i, result := range results {
+		if result.Err != nil {
+			resp.Items[i] = ValidateTokenResponse{Valid: false, Message: result.Err.Error()}
+			continue
+		}
+		session := result.Response.Session
+		resp.Items[i] = ValidateTokenResponse{
+			Valid:     true,
+			SessionID: session.ID,
+			UserID:    session.UserID,
+			ExpiresAt: time.UnixMilli(session.ExpiresAt),
+		}
+		resp.Valid++
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// batchItemError converts a per-item service error to its API form.
+func batchItemError(err error) *ErrorResponse {
+	if domain.IsDomainError(err, "") {
+		return &ErrorResponse{Code: domain.GetErrorCode(err), Message: err.Error()}
+	}
+	return &ErrorResponse{Code: "TM-SYS-5000", Message: "internal server error"}
+}
@@ -6,6 +6,7 @@
 //   - token.go: Token validation
 //   - admin.go: Administrative operations
 //   - health.go: Health and readiness checks
+//   - metrics.go: Per-endpoint request count and latency metrics
 //
 // All handlers follow a consistent pattern:
 //
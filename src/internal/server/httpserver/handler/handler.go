@@ -8,10 +8,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
@@ -24,8 +28,19 @@ type Handler struct {
 	sessionSvc *service.SessionService
 	tokenSvc   *service.TokenService
 	authSvc    *service.AuthService
+	jobs       *service.JobManager
+	replicator RevokeReplicator
+	pitr       PointInTimeRecoverer
+	wal        WALInspector
+	snapshots  SnapshotScheduler
+	apiKeyOf   func(context.Context) *domain.APIKey
+	certs      []tlsListener
+	metrics    prometheus.Gatherer
+	startedAt  time.Time
 	logger     *slog.Logger
 	mux        *http.ServeMux
+
+	requestMetrics *requestMetrics
 }
 
 // New creates a new Handler with the given services.
@@ -36,8 +51,12 @@ func New(sessionSvc *service.SessionService, tokenSvc *service.TokenService, aut
 		sessionSvc: sessionSvc,
 		tokenSvc:   tokenSvc,
 		authSvc:    authSvc,
+		jobs:       service.NewJobManager(0),
+		startedAt:  time.Now(),
 		logger:     logger,
 		mux:        http.NewServeMux(),
+
+		requestMetrics: newRequestMetrics(),
 	}
 
 	h.registerRoutes()
@@ -46,7 +65,14 @@ func New(sessionSvc *service.SessionService, tokenSvc *service.TokenService, aut
 
 // ServeHTTP implements http.Handler.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.mux.ServeHTTP(w, r)
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	h.mux.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	// The mux has set r.Pattern to the matched route.
+	h.requestMetrics.observe(r, rec.status, time.Since(start))
 }
 
 // registerRoutes registers all HTTP routes.
@@ -54,11 +80,16 @@ func (h *Handler) registerRoutes() {
 	// Health endpoints (no auth required)
 	h.mux.HandleFunc("GET /health", h.handleHealth)
 	h.mux.HandleFunc("GET /ready", h.handleReady)
+	h.mux.HandleFunc("GET /metrics", h.handleMetrics)
 
 	// Session endpoints
 	h.mux.HandleFunc("GET /sessions", h.handleListSessions)
 	h.mux.HandleFunc("POST /sessions", h.handleCreateSession)
+	h.mux.HandleFunc("POST /sessions:batch", h.handleBatchCreateSessions)
+	h.mux.HandleFunc("POST /sessions/revoke:batch", h.handleBatchRevokeSessions)
+	h.mux.HandleFunc("POST /sessions/revoke:query", h.handleRevokeSessionsByQuery)
 	h.mux.HandleFunc("GET /sessions/{id}", h.handleGetSession)
+	h.mux.HandleFunc("PATCH /sessions/{id}", h.handlePatchSession)
 	h.mux.HandleFunc("POST /sessions/{id}/touch", h.handleTouchSession)
 	h.mux.HandleFunc("POST /sessions/{id}/renew", h.handleRenewSession)
 	h.mux.HandleFunc("POST /sessions/{id}/revoke", h.handleRevokeSession)
@@ -68,10 +99,17 @@ func (h *Handler) registerRoutes() {
 
 	// Token endpoints
 	h.mux.HandleFunc("POST /tokens/validate", h.handleValidateToken)
+	h.mux.HandleFunc("POST /tokens/validate:batch", h.handleBatchValidateTokens)
 
 	// Admin endpoints
 	h.mux.HandleFunc("GET /admin/v1/status/summary", h.handleAdminStatus)
 	h.mux.HandleFunc("POST /admin/v1/gc/trigger", h.handleGCTrigger)
+	h.mux.HandleFunc("POST /admin/v1/sessions/import", h.handleImportSessions)
+	h.mux.HandleFunc("GET /admin/v1/sessions/export", h.handleExportSessions)
+	h.mux.HandleFunc("GET /admin/v1/jobs/{job_id}", h.handleGetJob)
+	h.mux.HandleFunc("POST /admin/v1/backups/pitr", h.handlePointInTimeRecovery)
+	h.mux.HandleFunc("GET /admin/v1/wal/status", h.handleWALStatus)
+	h.mux.HandleFunc("GET /admin/v1/wal/logs", h.handleWALLogs)
 
 	// API Key management endpoints
 	h.mux.HandleFunc("POST /admin/v1/keys", h.handleCreateAPIKey)
@@ -115,6 +153,24 @@ func getRequestID(r *http.Request) string {
 	return ""
 }
 
+// SetAPIKeyResolver sets how the authenticated API key of a request is
+// found, e.g. httpserver.GetAPIKeyFromContext. Without a resolver callers
+// have no role, and role-dependent responses are the most restricted.
+func (h *Handler) SetAPIKeyResolver(fn func(context.Context) *domain.APIKey) {
+	h.apiKeyOf = fn
+}
+
+// callerRole returns the role of the request's API key, or "" if unknown.
+func (h *Handler) callerRole(r *http.Request) domain.Role {
+	if h.apiKeyOf == nil {
+		return ""
+	}
+	if key := h.apiKeyOf(r.Context()); key != nil {
+		return key.Role
+	}
+	return ""
+}
+
 // handleServiceError converts service errors to HTTP responses.
 func (h *Handler) handleServiceError(w http.ResponseWriter, r *http.Request, err error) {
 	if domain.IsDomainError(err, "") {
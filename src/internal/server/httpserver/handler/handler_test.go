@@ -6,6 +6,8 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -16,8 +18,13 @@ import (
 	"time"
 
 	"github.com/oklog/ulid/v2"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/memory"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
 )
 
 // mockSessionRepo implements service.SessionRepository for testing.
@@ -48,12 +55,17 @@ func (r *mockSessionRepo) Create(_ context.Context, session *domain.Session) err
 	return nil
 }
 
-func (r *mockSessionRepo) Update(_ context.Context, session *domain.Session, _ uint64) error {
+func (r *mockSessionRepo) Update(_ context.Context, session *domain.Session, expectedVersion uint64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, ok := r.sessions[session.ID]; !ok {
+	existing, ok := r.sessions[session.ID]
+	if !ok {
 		return domain.ErrSessionNotFound
 	}
+	if existing.Version != expectedVersion {
+		return domain.ErrSessionVersionConflict
+	}
+	session.Version = expectedVersion + 1
 	r.sessions[session.ID] = session.Clone()
 	return nil
 }
@@ -249,6 +261,17 @@ func testHandler() (*Handler, *mockSessionRepo, *mockAPIKeyRepo) {
 	return h, sessionRepo, apiKeyRepo
 }
 
+// testStoreHandler creates a test handler backed by the memory store, for
+// endpoints that rely on its keyset pagination.
+func testStoreHandler() (*Handler, *memory.Store) {
+	store := memory.New()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	tokenSvc := service.NewTokenService(store, nil)
+	sessionSvc := service.NewSessionService(store, tokenSvc)
+	authSvc := service.NewAuthService(newMockAPIKeyRepo(), nil)
+	return New(sessionSvc, tokenSvc, authSvc, logger), store
+}
+
 // TestHandler_Health tests health endpoints.
 func TestHandler_Health(t *testing.T) {
 	h, _, _ := testHandler()
@@ -416,6 +439,109 @@ func TestHandler_GetSession(t *testing.T) {
 	})
 }
 
+// TestHandler_PatchSession tests partial session updates.
+func TestHandler_PatchSession(t *testing.T) {
+	h, sessionRepo, _ := testHandler()
+
+	session := &domain.Session{
+		ID:        "tmss-01234567890123456789abcd",
+		UserID:    "user-123",
+		DeviceID:  "device-1",
+		Data:      map[string]string{"role": "user", "theme": "dark"},
+		CreatedAt: time.Now().UnixMilli(),
+		ExpiresAt: time.Now().Add(24 * time.Hour).UnixMilli(),
+		Version:   3,
+	}
+	sessionRepo.Create(context.Background(), session)
+
+	patch := func(body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/sessions/"+session.ID, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("applies merge patch", func(t *testing.T) {
+		rec := patch(`{"data":{"role":"admin","theme":null}}`, `"3"`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		stored, _ := sessionRepo.Get(context.Background(), session.ID)
+		if stored.Data["role"] != "admin" {
+			t.Errorf("expected role=admin, got %q", stored.Data["role"])
+		}
+		if _, ok := stored.Data["theme"]; ok {
+			t.Error("expected theme to be removed")
+		}
+		if etag := rec.Header().Get("ETag"); etag != formatETagVersion(stored.Version) {
+			t.Errorf("expected ETag %s, got %s", formatETagVersion(stored.Version), etag)
+		}
+	})
+
+	t.Run("stale If-Match returns 412", func(t *testing.T) {
+		rec := patch(`{"data":{"role":"guest"}}`, `W/"3"`)
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status 412, got %d", rec.Code)
+		}
+	})
+
+	t.Run("wildcard If-Match is unconditional", func(t *testing.T) {
+		rec := patch(`{"device_id":null}`, "*")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		stored, _ := sessionRepo.Get(context.Background(), session.ID)
+		if stored.DeviceID != "" {
+			t.Errorf("expected device_id to be cleared, got %q", stored.DeviceID)
+		}
+	})
+
+	t.Run("rejects immutable fields", func(t *testing.T) {
+		rec := patch(`{"user_id":"other"}`, "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects malformed If-Match", func(t *testing.T) {
+		rec := patch(`{"data":{}}`, `"abc"`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects oversized data", func(t *testing.T) {
+		var b strings.Builder
+		b.WriteString(`{"data":{`)
+		for i := 0; i < 5; i++ {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, `"k%d":"%s"`, i, strings.Repeat("x", domain.MaxDataValueLength))
+		}
+		b.WriteString(`}}`)
+
+		rec := patch(b.String(), "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("returns 404 for non-existent session", func(t *testing.T) {
+		req := httptest.NewRequest("PATCH", "/sessions/non-existent", strings.NewReader(`{}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
 // TestHandler_RevokeSession tests session revocation.
 func TestHandler_RevokeSession(t *testing.T) {
 	h, sessionRepo, _ := testHandler()
@@ -503,6 +629,130 @@ func TestHandler_ValidateToken(t *testing.T) {
 	})
 }
 
+// TestHandler_BatchSessions tests the bulk create and revoke endpoints.
+func TestHandler_BatchSessions(t *testing.T) {
+	h, sessionRepo, _ := testHandler()
+
+	post := func(path, body string) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		data, _ := resp.Data.(map[string]any)
+		return rec, data
+	}
+
+	var created []string
+
+	t.Run("creates sessions with per-item results", func(t *testing.T) {
+		rec, data := post("/sessions:batch", `{"items":[{"user_id":"u1"},{"user_id":""},{"user_id":"u2","ttl_seconds":60}]}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if data["succeeded"] != float64(2) || data["failed"] != float64(1) {
+			t.Errorf("expected 2 succeeded / 1 failed, got %v / %v", data["succeeded"], data["failed"])
+		}
+
+		items := data["items"].([]any)
+		if len(items) != 3 {
+			t.Fatalf("expected 3 items, got %d", len(items))
+		}
+		for _, i := range []int{0, 2} {
+			item := items[i].(map[string]any)
+			if item["token"] == "" || item["session_id"] == "" {
+				t.Errorf("item %d should have session_id and token: %v", i, item)
+			}
+			created = append(created, item["session_id"].(string))
+		}
+		failed := items[1].(map[string]any)["error"].(map[string]any)
+		if failed["code"] != "TM-ARG-1002" {
+			t.Errorf("expected TM-ARG-1002 for item 1, got %v", failed["code"])
+		}
+	})
+
+	t.Run("revokes sessions idempotently", func(t *testing.T) {
+		body, _ := json.Marshal(BatchRevokeSessionsRequest{SessionIDs: append(created, "missing")})
+		rec, data := post("/sessions/revoke:batch", string(body))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if data["failed"] != float64(0) {
+			t.Errorf("expected 0 failed, got %v", data["failed"])
+		}
+		items := data["items"].([]any)
+		if len(items) != 3 {
+			t.Fatalf("expected 3 items, got %d", len(items))
+		}
+		if items[0].(map[string]any)["revoked"] != true {
+			t.Errorf("expected item 0 to be revoked: %v", items[0])
+		}
+		if _, ok := items[2].(map[string]any)["error"]; ok {
+			t.Errorf("expected missing session to succeed: %v", items[2])
+		}
+		if _, err := sessionRepo.Get(context.Background(), created[0]); err == nil {
+			t.Error("expected session to be revoked")
+		}
+	})
+
+	t.Run("rejects empty batch", func(t *testing.T) {
+		rec, _ := post("/sessions:batch", `{"items":[]}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects oversized batch", func(t *testing.T) {
+		ids := make([]string, service.MaxBatchSize+1)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("tmss-%d", i)
+		}
+		body, _ := json.Marshal(BatchRevokeSessionsRequest{SessionIDs: ids})
+		rec, _ := post("/sessions/revoke:batch", string(body))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+// TestHandler_BatchValidateTokens tests bulk token validation.
+func TestHandler_BatchValidateTokens(t *testing.T) {
+	h, _, _ := testHandler()
+
+	body := `{"items":[{"token":"invalid-token-format"},{"token":"tmtk_AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}]}`
+	req := httptest.NewRequest("POST", "/tokens/validate:batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	data := resp.Data.(map[string]any)
+	items := data["items"].([]any)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+	for i, item := range items {
+		if item.(map[string]any)["valid"] != false {
+			t.Errorf("item %d: expected valid to be false", i)
+		}
+	}
+	if data["valid"] != float64(0) {
+		t.Errorf("expected valid count 0, got %v", data["valid"])
+	}
+}
+
 // TestHandler_ListSessions tests session listing.
 func TestHandler_ListSessions(t *testing.T) {
 	h, sessionRepo, _ := testHandler()
@@ -579,6 +829,166 @@ func TestHandler_AdminStatus(t *testing.T) {
 	})
 }
 
+// fixedCert is a CertificateSource with a fixed expiry.
+type fixedCert time.Time
+
+func (c fixedCert) NotAfter() time.Time { return time.Time(c) }
+
+// TestHandler_AdminStatus_TLSCertificates tests certificate expiry reporting.
+func TestHandler_AdminStatus_TLSCertificates(t *testing.T) {
+	h, _, _ := testHandler()
+	h.AddTLSCertificate("http", fixedCert(time.Now().Add(48*time.Hour)))
+
+	req := httptest.NewRequest("GET", "/admin/v1/status/summary", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data struct {
+			TLSCertificates []TLSCertificateStatus `json:"tls_certificates"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	certs := resp.Data.TLSCertificates
+	if len(certs) != 1 || certs[0].Listener != "http" {
+		t.Fatalf("tls_certificates = %+v", certs)
+	}
+	if secs := certs[0].ExpiresInSeconds; secs < 47*3600 || secs > 48*3600 {
+		t.Errorf("expires_in_seconds = %d, want about 48h", secs)
+	}
+}
+
+// fixedSchedule is a SnapshotScheduler with a fixed schedule.
+type fixedSchedule struct {
+	sched *storage.SnapshotSchedule
+	err   error
+}
+
+func (f fixedSchedule) SnapshotSchedule() (*storage.SnapshotSchedule, error) {
+	return f.sched, f.err
+}
+
+// TestHandler_AdminStatus_SnapshotSchedule tests snapshot schedule reporting.
+func TestHandler_AdminStatus_SnapshotSchedule(t *testing.T) {
+	now := time.Now()
+	h, _, _ := testHandler()
+	h.SetSnapshotScheduler(fixedSchedule{sched: &storage.SnapshotSchedule{
+		Policy:     storage.SnapshotPolicy{MaxWALEntries: 100, CheckInterval: 10 * time.Second, OnShutdown: true},
+		MaxAge:     time.Hour,
+		WALEntries: 7,
+		LastCheck:  now,
+		LastDecision: &storage.SnapshotDecision{
+			At: now, Action: storage.DecisionDefer, Trigger: storage.TriggerWALEntries, Reason: "busy",
+		},
+		LastRun: &storage.SnapshotRun{
+			Trigger: storage.TriggerMaxAge, Started: now, Duration: 1500 * time.Millisecond,
+			Snapshot: time.Second, Compact: 500 * time.Millisecond, SessionCount: 3, WALOffset: 2<<32 | 64,
+		},
+		Deferrals: 1,
+	}})
+
+	req := httptest.NewRequest("GET", "/admin/v1/status/summary", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data struct {
+			SnapshotSchedule *SnapshotScheduleStatus `json:"snapshot_schedule"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	st := resp.Data.SnapshotSchedule
+	if st == nil {
+		t.Fatal("snapshot_schedule missing")
+	}
+	if st.Policy.MaxWALEntries != 100 || st.Policy.MaxAgeMs != 3600000 || st.Policy.CheckIntervalMs != 10000 || !st.Policy.OnShutdown {
+		t.Errorf("policy = %+v", st.Policy)
+	}
+	if st.WALEntries != 7 || st.LastCheckAt == nil || st.LastSnapshotAt != nil || st.Deferrals != 1 {
+		t.Errorf("schedule = %+v", st)
+	}
+	if d := st.LastDecision; d == nil || d.Action != "defer" || d.Trigger != "wal_entries" {
+		t.Errorf("last_decision = %+v", d)
+	}
+	if r := st.LastRun; r == nil || r.DurationMs != 1500 || r.SnapshotMs != 1000 || r.CompactMs != 500 || r.WALOffset != "2:64" {
+		t.Errorf("last_run = %+v", r)
+	}
+
+	// Not reported without a WAL
+	h.SetSnapshotScheduler(fixedSchedule{err: storage.ErrNoWAL})
+	if _, ok := h.StatusSummary()["snapshot_schedule"]; ok {
+		t.Error("snapshot_schedule reported without a WAL")
+	}
+}
+
+// TestHandler_Metrics tests the metrics endpoint.
+func TestHandler_Metrics(t *testing.T) {
+	h, _, _ := testHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without gatherer: status = %d, want 404", rec.Code)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test."}, func() float64 { return 42 }))
+	h.SetMetricsGatherer(registry)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "test_gauge 42") {
+		t.Errorf("status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHandler_RequestMetrics tests per-endpoint request metrics.
+func TestHandler_RequestMetrics(t *testing.T) {
+	h, _, _ := testHandler()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(h.Collectors()...)
+	h.SetMetricsGatherer(registry)
+
+	for _, path := range []string{"/health", "/health", "/no-such-route"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`tokmesh_http_requests_total{code="200",endpoint="GET /health"} 2`,
+		`tokmesh_http_requests_total{code="404",endpoint="unmatched"} 1`,
+		`tokmesh_http_request_duration_seconds_count{endpoint="GET /health"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+// TestHandler_StatusSummary tests the status reported to other transports.
+func TestHandler_StatusSummary(t *testing.T) {
+	h, _, _ := testHandler()
+
+	status := h.StatusSummary()
+	if status["status"] != "running" {
+		t.Errorf("status = %v, want running", status["status"])
+	}
+	if up, ok := status["uptime_seconds"].(int64); !ok || up < 0 {
+		t.Errorf("uptime_seconds = %v", status["uptime_seconds"])
+	}
+	if _, ok := status["started_at"].(string); !ok {
+		t.Errorf("started_at = %v", status["started_at"])
+	}
+}
+
 // TestResponse_Envelope tests the response envelope format.
 func TestResponse_Envelope(t *testing.T) {
 	t.Run("success response has correct structure", func(t *testing.T) {
@@ -1157,6 +1567,588 @@ func TestHandler_ListSessions_Pagination(t *testing.T) {
 	})
 }
 
+// TestHandler_ListSessions_Cursor tests cursor pagination and extended filters.
+func TestHandler_ListSessions_Cursor(t *testing.T) {
+	h, sessionRepo, _ := testHandler()
+
+	for i := 0; i < 3; i++ {
+		session := &domain.Session{
+			ID:        newTestSessionID(),
+			UserID:    "user-cursor-test",
+			TokenHash: "test-token-hash-cursor-" + string(rune('A'+i)),
+			CreatedAt: time.Now().UnixMilli() + int64(i),
+			ExpiresAt: time.Now().Add(24 * time.Hour).UnixMilli(),
+			Version:   1,
+		}
+		sessionRepo.Create(context.Background(), session)
+	}
+
+	t.Run("limit returns next_cursor", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/sessions?limit=2", nil)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var resp struct {
+			Data ListSessionsResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(resp.Data.Items) != 2 {
+			t.Errorf("items = %d, want 2", len(resp.Data.Items))
+		}
+		if resp.Data.NextCursor == "" {
+			t.Error("expected next_cursor")
+		}
+		if resp.Data.Total != -1 {
+			t.Errorf("total = %d, want -1", resp.Data.Total)
+		}
+	})
+
+	t.Run("rejects malformed cursor", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/sessions?cursor=%21%21", nil)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("rejects malformed data filter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/sessions?data=tenant", nil)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("rejects invalid expires_within_seconds", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/sessions?expires_within_seconds=-5", nil)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("accepts extended filters", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/sessions?device_id_prefix=ios&created_by=key-1&data=tenant:acme&expires_within_seconds=600&sort_by=last_active&sort_order=asc", nil)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// TestHandler_SessionTransfer tests streaming export and import.
+func TestHandler_SessionTransfer(t *testing.T) {
+	src, srcRepo := testStoreHandler()
+
+	var ids []string
+	for i := 0; i < 150; i++ {
+		session, _ := domain.NewSession(fmt.Sprintf("user-transfer-%d", i))
+		_, session.TokenHash, _ = domain.GenerateToken()
+		session.CreatedAt = time.Now().UnixMilli() + int64(i)
+		session.ExpiresAt = time.Now().Add(time.Hour).UnixMilli()
+		session.Version = 1
+		if err := srcRepo.Create(context.Background(), session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		ids = append(ids, session.ID)
+	}
+
+	// Export spans multiple listing pages
+	req := httptest.NewRequest("GET", "/admin/v1/sessions/export", nil)
+	rec := httptest.NewRecorder()
+	src.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	exported := rec.Body.String()
+	if lines := strings.Count(exported, "\n"); lines != 150 {
+		t.Fatalf("exported %d lines, want 150", lines)
+	}
+
+	dst, dstRepo := testStoreHandler()
+
+	importBody := func(path, body string) (*httptest.ResponseRecorder, ImportSessionsResponse) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		dst.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data ImportSessionsResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return rec, resp.Data
+	}
+
+	t.Run("dry run validates without persisting", func(t *testing.T) {
+		rec, resp := importBody("/admin/v1/sessions/import?dry_run=true", exported+"{not json}\n")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if !resp.DryRun || resp.Total != 151 || resp.Imported != 150 || resp.Failed != 1 {
+			t.Errorf("unexpected dry run result: %+v", resp)
+		}
+		if len(resp.Errors) != 1 || resp.Errors[0].Line != 151 {
+			t.Errorf("expected error on line 151, got %+v", resp.Errors)
+		}
+		if _, err := dstRepo.Get(context.Background(), ids[0]); err == nil {
+			t.Error("dry run must not store sessions")
+		}
+	})
+
+	t.Run("imports exported sessions", func(t *testing.T) {
+		rec, resp := importBody("/admin/v1/sessions/import", exported)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if resp.Imported != 150 || resp.Failed != 0 {
+			t.Errorf("unexpected import result: %+v", resp)
+		}
+		for _, id := range ids {
+			want, _ := srcRepo.Get(context.Background(), id)
+			got, err := dstRepo.Get(context.Background(), id)
+			if err != nil || got.TokenHash != want.TokenHash || got.ExpiresAt != want.ExpiresAt {
+				t.Fatalf("session %s not imported intact", id)
+			}
+		}
+	})
+
+	t.Run("re-import reports existing", func(t *testing.T) {
+		_, resp := importBody("/admin/v1/sessions/import", exported)
+		if resp.Existing != 150 || resp.Imported != 0 {
+			t.Errorf("unexpected re-import result: %+v", resp)
+		}
+	})
+
+	t.Run("export rejects malformed filter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin/v1/sessions/export?data=tenant", nil)
+		rec := httptest.NewRecorder()
+		src.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+// mockRevokeReplicator records replicated revoke queries.
+type mockRevokeReplicator struct {
+	queries []*service.RevokeQuery
+	err     error
+}
+
+func (m *mockRevokeReplicator) ApplyRevokeQuery(q *service.RevokeQuery) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.queries = append(m.queries, q)
+	return nil
+}
+
+// TestHandler_RevokeSessionsByQuery tests revoke-by-criteria.
+func TestHandler_RevokeSessionsByQuery(t *testing.T) {
+	h, store := testStoreHandler()
+	replicator := &mockRevokeReplicator{}
+	h.SetRevokeReplicator(replicator)
+
+	addSessions := func(n int, createdBy, ip string) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			session, _ := domain.NewSession(fmt.Sprintf("user-%s-%d", createdBy, i))
+			_, session.TokenHash, _ = domain.GenerateToken()
+			session.CreatedBy = createdBy
+			session.IPAddress = ip
+			session.CreatedAt = time.Now().Add(-time.Minute).UnixMilli()
+			session.ExpiresAt = time.Now().Add(time.Hour).UnixMilli()
+			if err := store.Create(context.Background(), session); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+	}
+	addSessions(3, "tmak-bad", "10.0.0.1")
+	addSessions(2, "tmak-good", "192.168.1.1")
+
+	post := func(body string) (*httptest.ResponseRecorder, RevokeSessionsByQueryResponse) {
+		req := httptest.NewRequest("POST", "/sessions/revoke:query", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data RevokeSessionsByQueryResponse `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp.Data
+	}
+
+	t.Run("dry run counts matches", func(t *testing.T) {
+		rec, resp := post(`{"ip":"10.0.0.0/8","dry_run":true}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if resp.Matched != 3 || resp.Revoked != 0 || !resp.DryRun {
+			t.Errorf("unexpected dry run result: %+v", resp)
+		}
+		if len(replicator.queries) != 0 {
+			t.Error("dry run must not replicate")
+		}
+	})
+
+	t.Run("revokes matching sessions", func(t *testing.T) {
+		rec, resp := post(`{"created_by":"tmak-bad","reason":"key leaked"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if resp.Matched != 3 || resp.Revoked != 3 || !resp.Replicated {
+			t.Errorf("unexpected result: %+v", resp)
+		}
+		if len(replicator.queries) != 1 || replicator.queries[0].CreatedBy != "tmak-bad" || replicator.queries[0].CreatedBefore == 0 {
+			t.Errorf("replicated queries = %+v", replicator.queries)
+		}
+		if n, _ := store.CountByUserID(context.Background(), "user-tmak-good-0"); n != 1 {
+			t.Error("non-matching sessions must survive")
+		}
+	})
+
+	t.Run("large matches run as a job", func(t *testing.T) {
+		addSessions(revokeQueryAsyncThreshold+1, "tmak-bulk", "10.9.9.9")
+
+		rec, resp := post(`{"created_by":"tmak-bulk"}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", rec.Code)
+		}
+		if resp.JobID == "" {
+			t.Fatal("expected job_id")
+		}
+		h.jobs.Wait()
+
+		req := httptest.NewRequest("GET", "/admin/v1/jobs/"+resp.JobID, nil)
+		jobRec := httptest.NewRecorder()
+		h.ServeHTTP(jobRec, req)
+
+		var job struct {
+			Data JobResponse `json:"data"`
+		}
+		json.NewDecoder(jobRec.Body).Decode(&job)
+		if job.Data.State != "succeeded" || job.Data.Done != revokeQueryAsyncThreshold+1 || job.Data.FinishedAt == nil {
+			t.Errorf("unexpected job: %+v", job.Data)
+		}
+	})
+
+	t.Run("fails when not replicated", func(t *testing.T) {
+		replicator.err = errors.New("not the leader")
+		defer func() { replicator.err = nil }()
+
+		rec, _ := post(`{"created_by":"tmak-good"}`)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status 503, got %d", rec.Code)
+		}
+		if n, _ := store.CountByUserID(context.Background(), "user-tmak-good-0"); n != 1 {
+			t.Error("sessions revoked although the revocation was not replicated")
+		}
+	})
+
+	t.Run("rejects empty query", func(t *testing.T) {
+		rec, _ := post(`{}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects invalid CIDR", func(t *testing.T) {
+		rec, _ := post(`{"ip":"10.0.0.0/99"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin/v1/jobs/tmjb-missing", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+// mockPointInTimeRecoverer records point-in-time recovery requests.
+type mockPointInTimeRecoverer struct {
+	cfgs []storage.PointInTimeConfig
+}
+
+func (m *mockPointInTimeRecoverer) RecoverToPoint(ctx context.Context, cfg storage.PointInTimeConfig, progress func(int)) (*storage.PointInTimeResult, error) {
+	m.cfgs = append(m.cfgs, cfg)
+	progress(2)
+	return &storage.PointInTimeResult{EntriesApplied: 2, TargetReached: true, Snapshot: &snapshot.Info{Path: "/tmp/snap"}}, nil
+}
+
+// TestHandler_PointInTimeRecovery tests the point-in-time recovery job.
+func TestHandler_PointInTimeRecovery(t *testing.T) {
+	h, _ := testStoreHandler()
+
+	post := func(body string) (*httptest.ResponseRecorder, PointInTimeRecoveryResponse) {
+		req := httptest.NewRequest("POST", "/admin/v1/backups/pitr", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data PointInTimeRecoveryResponse `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp.Data
+	}
+
+	t.Run("not found without recoverer", func(t *testing.T) {
+		rec, _ := post(`{"target_offset":"1","output_snapshot_dir":"/tmp/out"}`)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+
+	recoverer := &mockPointInTimeRecoverer{}
+	h.SetPointInTimeRecoverer(recoverer)
+
+	t.Run("starts a job", func(t *testing.T) {
+		rec, resp := post(`{"target_time":"2026-01-02T03:04:05Z","target_offset":"3:100","output_data_dir":"/tmp/restored"}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", rec.Code)
+		}
+		h.jobs.Wait()
+
+		if len(recoverer.cfgs) != 1 {
+			t.Fatalf("recoveries = %d, want 1", len(recoverer.cfgs))
+		}
+		cfg := recoverer.cfgs[0]
+		if cfg.Target.Offset != 3<<32|100 || cfg.Target.Time.Unix() != 1767323045 || cfg.OutputDataDir != "/tmp/restored" {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+
+		req := httptest.NewRequest("GET", "/admin/v1/jobs/"+resp.JobID, nil)
+		jobRec := httptest.NewRecorder()
+		h.ServeHTTP(jobRec, req)
+
+		var job struct {
+			Data JobResponse `json:"data"`
+		}
+		json.NewDecoder(jobRec.Body).Decode(&job)
+		if job.Data.Kind != pitrJobKind || job.Data.State != "succeeded" || job.Data.Done != 2 {
+			t.Errorf("unexpected job: %+v", job.Data)
+		}
+	})
+
+	invalid := []struct {
+		name string
+		body string
+	}{
+		{"no target", `{"output_data_dir":"/tmp/out"}`},
+		{"bad time", `{"target_time":"yesterday","output_data_dir":"/tmp/out"}`},
+		{"bad offset", `{"target_offset":"x","output_data_dir":"/tmp/out"}`},
+		{"no output", `{"target_offset":"1"}`},
+		{"two outputs", `{"target_offset":"1","output_data_dir":"/tmp/a","output_snapshot_dir":"/tmp/b"}`},
+		{"relative output", `{"target_offset":"1","output_data_dir":"out"}`},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := post(tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+// mockWALInspector serves a fixed WAL status and page, recording the
+// queries.
+type mockWALInspector struct {
+	status  *storage.WALStatus
+	page    *storage.WALLogPage
+	err     error
+	queries []storage.WALLogQuery
+}
+
+func (m *mockWALInspector) WALStatus() (*storage.WALStatus, error) {
+	return m.status, m.err
+}
+
+func (m *mockWALInspector) WALLogs(ctx context.Context, q storage.WALLogQuery) (*storage.WALLogPage, error) {
+	m.queries = append(m.queries, q)
+	return m.page, m.err
+}
+
+func TestHandler_WALStatus(t *testing.T) {
+	h, _ := testStoreHandler()
+
+	get := func() (*httptest.ResponseRecorder, WALStatusResponse) {
+		req := httptest.NewRequest("GET", "/admin/v1/wal/status", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data WALStatusResponse `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp.Data
+	}
+
+	if rec, _ := get(); rec.Code != http.StatusNotFound {
+		t.Errorf("without inspector: expected status 404, got %d", rec.Code)
+	}
+
+	synced := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	inspector := &mockWALInspector{status: &storage.WALStatus{
+		WriterStatus: wal.WriterStatus{SegmentID: 3, Offset: 3<<32 | 512, PendingBytes: 40, PendingEntries: 2, LastSync: synced},
+		Segments: []wal.SegmentFile{
+			{ID: 2, Path: "/data/wal/wal-00000002.log", Size: 1000},
+			{ID: 3, Path: "/data/wal/wal-00000003.log", Size: 512},
+		},
+		TotalBytes:     1512,
+		SnapshotOffset: 2<<32 | 100,
+	}}
+	h.SetWALInspector(inspector)
+
+	rec, resp := get()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.SegmentID != 3 || resp.Offset != "3:512" || resp.PendingFsyncBytes != 40 || resp.PendingFsyncEntries != 2 {
+		t.Errorf("unexpected writer status: %+v", resp)
+	}
+	if resp.LastFsyncAt == nil || !resp.LastFsyncAt.Equal(synced) || resp.LastSnapshotAt != nil {
+		t.Errorf("last fsync %v, last snapshot %v", resp.LastFsyncAt, resp.LastSnapshotAt)
+	}
+	if resp.SegmentCount != 2 || resp.TotalBytes != 1512 || resp.SnapshotOffset != "2:100" {
+		t.Errorf("unexpected segments: %+v", resp)
+	}
+	if resp.Segments[0].File != "wal-00000002.log" || resp.Segments[0].Active || !resp.Segments[1].Active {
+		t.Errorf("unexpected segment list: %+v", resp.Segments)
+	}
+
+	inspector.err = storage.ErrNoWAL
+	if rec, _ := get(); rec.Code != http.StatusNotFound {
+		t.Errorf("badger backend: expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestHandler_WALLogs(t *testing.T) {
+	h, _ := testStoreHandler()
+
+	get := func(query string) (*httptest.ResponseRecorder, WALLogsResponse) {
+		req := httptest.NewRequest("GET", "/admin/v1/wal/logs"+query, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data WALLogsResponse `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp.Data
+	}
+
+	if rec, _ := get(""); rec.Code != http.StatusNotFound {
+		t.Errorf("without inspector: expected status 404, got %d", rec.Code)
+	}
+
+	session := &domain.Session{
+		ID:        "tmss-1",
+		UserID:    "alice",
+		TokenHash: "tmth_secret",
+		IPAddress: "10.0.0.1",
+		Data:      map[string]string{"email": "alice@example.com"},
+		Version:   1,
+	}
+	inspector := &mockWALInspector{page: &storage.WALLogPage{
+		Entries: []storage.WALLogEntry{
+			{Offset: 1<<32 | 8, Entry: &wal.Entry{OpType: wal.OpTypeCreate, SessionID: "tmss-1", Version: 1, Session: session}},
+			{Offset: 1<<32 | 90, Entry: &wal.Entry{OpType: wal.OpTypeTouch, SessionID: "tmss-1", LastActive: 1, AccessIP: "10.0.0.2"}},
+		},
+		NextOffset: 1<<32 | 140,
+		More:       true,
+	}}
+	h.SetWALInspector(inspector)
+
+	t.Run("masks by default", func(t *testing.T) {
+		rec, resp := get("?from=1:8&limit=2&op=create,touch&session_id=tmss-1&user_id=alice&tail=true")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		q := inspector.queries[len(inspector.queries)-1]
+		if q.From != 1<<32|8 || q.Limit != 2 || len(q.Ops) != 2 || q.Ops[1] != wal.OpTypeTouch ||
+			q.SessionID != "tmss-1" || q.UserID != "alice" || !q.Tail {
+			t.Errorf("unexpected query: %+v", q)
+		}
+		if !resp.Masked || !resp.More || resp.NextOffset != "1:140" || len(resp.Entries) != 2 {
+			t.Fatalf("unexpected page: %+v", resp)
+		}
+		created := resp.Entries[0]
+		if created.Offset != "1:8" || created.Op != "create" || created.Session == nil {
+			t.Fatalf("unexpected entry: %+v", created)
+		}
+		body := rec.Body.String()
+		for _, secret := range []string{"alice", "tmth_secret", "10.0.0.1", "10.0.0.2"} {
+			if strings.Contains(body, secret) {
+				t.Errorf("masked response contains %q", secret)
+			}
+		}
+		if created.Session.ID != "tmss-1" || !strings.HasPrefix(created.Session.TokenHash, "masked:") {
+			t.Errorf("unexpected masked session: %+v", created.Session)
+		}
+	})
+
+	t.Run("reveal requires the admin role", func(t *testing.T) {
+		if rec, _ := get("?reveal=true"); rec.Code != http.StatusForbidden {
+			t.Errorf("without a role: expected status 403, got %d", rec.Code)
+		}
+
+		role := domain.RoleIssuer
+		h.SetAPIKeyResolver(func(context.Context) *domain.APIKey { return &domain.APIKey{Role: role} })
+		if rec, _ := get("?reveal=true"); rec.Code != http.StatusForbidden {
+			t.Errorf("issuer: expected status 403, got %d", rec.Code)
+		}
+
+		role = domain.RoleAdmin
+		rec, resp := get("?reveal=true")
+		if rec.Code != http.StatusOK || resp.Masked {
+			t.Fatalf("admin: status %d, masked %v", rec.Code, resp.Masked)
+		}
+		s := resp.Entries[0].Session
+		if s.UserID != "alice" || s.TokenHash != "tmth_secret" || s.Data["email"] != "alice@example.com" || resp.Entries[1].AccessIP != "10.0.0.2" {
+			t.Errorf("unexpected revealed entries: %+v", resp.Entries)
+		}
+	})
+
+	for _, query := range []string{"?from=x", "?limit=0", "?limit=100000", "?op=drop"} {
+		t.Run("invalid "+query, func(t *testing.T) {
+			if rec, _ := get(query); rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
 // TestHandler_CreateAPIKey_Validation tests API key creation validation.
 func TestHandler_CreateAPIKey_Validation(t *testing.T) {
 	h, _, _ := testHandler()
@@ -4,8 +4,17 @@ package handler
 import (
 	"net/http"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// SetMetricsGatherer serves the gatherer's metrics on GET /metrics.
+// Without a gatherer the endpoint is not found.
+func (h *Handler) SetMetricsGatherer(g prometheus.Gatherer) {
+	h.metrics = g
+}
+
 // handleHealth handles GET /health.
 //
 // @design DS-0301
@@ -25,3 +34,14 @@ func (h *Handler) handleReady(w http.ResponseWriter, r *http.Request) {
 		"time":   time.Now().UTC().Format(time.RFC3339),
 	})
 }
+
+// handleMetrics handles GET /metrics in Prometheus text format.
+//
+// @design DS-0301
+func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.metrics == nil {
+		http.NotFound(w, r)
+		return
+	}
+	promhttp.HandlerFor(h.metrics, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,77 @@
+// Package handler provides HTTP request handlers for TokMesh.
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestMetrics counts requests and observes their latency per endpoint.
+// The endpoint label is the matched route pattern (e.g.
+// "POST /tokens/validate"), so session IDs never become label values.
+type requestMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newRequestMetrics() *requestMetrics {
+	return &requestMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tokmesh",
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by endpoint and status code.",
+		}, []string{"endpoint", "code"}),
+		// Buckets from 100µs to about 3.3s.
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "tokmesh",
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency in seconds by endpoint.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"endpoint"}),
+	}
+}
+
+// observe records a served request.
+func (m *requestMetrics) observe(r *http.Request, status int, elapsed time.Duration) {
+	endpoint := r.Pattern
+	if endpoint == "" {
+		endpoint = "unmatched"
+	}
+	m.requests.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(endpoint).Observe(elapsed.Seconds())
+}
+
+// Collectors returns the HTTP request metrics for registration.
+func (h *Handler) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{h.requestMetrics.requests, h.requestMetrics.duration}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,167 @@
+// Package handler provides HTTP request handlers for TokMesh.
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// revokeQueryAsyncThreshold is the match count above which a
+// revoke-by-query runs as a background job.
+const revokeQueryAsyncThreshold = 1000
+
+// revokeQueryJobKind identifies revoke-by-query background jobs.
+const revokeQueryJobKind = "revoke_query"
+
+// RevokeReplicator propagates a revoke-by-query to the other cluster nodes.
+// It is implemented by the cluster server, which fails on a follower.
+type RevokeReplicator interface {
+	ApplyRevokeQuery(q *service.RevokeQuery) error
+}
+
+// SetRevokeReplicator enables cluster-wide revoke-by-query. Without a
+// replicator, revocations only affect this node's sessions.
+func (h *Handler) SetRevokeReplicator(r RevokeReplicator) {
+	h.replicator = r
+}
+
+// handleRevokeSessionsByQuery handles POST /sessions/revoke:query.
+//
+// Revokes every session matching the given criteria, e.g. all sessions
+// created by a compromised API key or seen from an IP range. Matches are
+// counted first; a dry run stops there. Up to revokeQueryAsyncThreshold
+// matches are revoked before responding, larger revocations run as a
+// background job (202 Accepted). In cluster mode the revocation is
+// replicated first, and fails with 503 if it cannot be, as on a follower.
+//
+// The query is bounded to sessions created before the request, so
+// sessions created afterwards are never revoked.
+//
+// @design DS-0302
+func (h *Handler) handleRevokeSessionsByQuery(w http.ResponseWriter, r *http.Request) {
+	var req RevokeSessionsByQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", "invalid request body", nil)
+		return
+	}
+
+	query := &service.RevokeQuery{
+		UserID:        req.UserID,
+		DeviceID:      req.DeviceID,
+		CreatedBy:     req.CreatedBy,
+		IP:            req.IP,
+		Data:          req.Data,
+		CreatedBefore: time.Now().UnixMilli(),
+	}
+	if err := query.Validate(); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	// Count matches
+	matched, err := h.sessionSvc.CountByQuery(r.Context(), query)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := RevokeSessionsByQueryResponse{DryRun: req.DryRun, Matched: matched}
+	if req.DryRun {
+		h.writeJSON(w, r, http.StatusOK, resp)
+		return
+	}
+
+	requestID := getRequestID(r)
+	h.auditRevokeQuery("revoke by query started", requestID, query, req.Reason, "matched", matched)
+
+	// Propagate to the other nodes, which hold other shards and may have
+	// matches even when this node has none. A revocation that cannot be
+	// replicated, as on a follower, fails rather than stay on this node.
+	if h.replicator != nil {
+		if err := h.replicator.ApplyRevokeQuery(query); err != nil {
+			h.logger.Warn("revoke query not replicated", "request_id", requestID, "error", err)
+			h.writeError(w, r, http.StatusServiceUnavailable, "TM-SYS-5030", "revocation could not be replicated to the cluster; send it to the leader", nil)
+			return
+		}
+		resp.Replicated = true
+	}
+
+	if matched > revokeQueryAsyncThreshold {
+		job, err := h.jobs.Start(revokeQueryJobKind, matched, func(ctx context.Context, progress func(int)) error {
+			revoked, err := h.sessionSvc.RevokeByQuery(ctx, query, progress)
+			h.auditRevokeQuery("revoke by query finished", requestID, query, req.Reason, "revoked", revoked, "error", errString(err))
+			return err
+		})
+		if err != nil {
+			h.handleServiceError(w, r, err)
+			return
+		}
+		resp.JobID = job.ID
+		h.writeJSON(w, r, http.StatusAccepted, resp)
+		return
+	}
+
+	// Revocation continues past a client disconnect.
+	resp.Revoked, err = h.sessionSvc.RevokeByQuery(context.WithoutCancel(r.Context()), query, nil)
+	h.auditRevokeQuery("revoke by query finished", requestID, query, req.Reason, "revoked", resp.Revoked, "error", errString(err))
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// auditRevokeQuery records a revoke-by-query in the audit log.
+func (h *Handler) auditRevokeQuery(msg, requestID string, q *service.RevokeQuery, reason string, attrs ...any) {
+	attrs = append([]any{
+		"audit", true,
+		"request_id", requestID,
+		"user_id", q.UserID,
+		"device_id", q.DeviceID,
+		"created_by", q.CreatedBy,
+		"ip", q.IP,
+		"data", q.Data,
+		"created_before", q.CreatedBefore,
+		"reason", reason,
+	}, attrs...)
+	h.logger.Info(msg, attrs...)
+}
+
+// handleGetJob handles GET /admin/v1/jobs/{job_id}.
+//
+// @design DS-0302
+func (h *Handler) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.jobs.Get(r.PathValue("job_id"))
+	if !ok {
+		h.writeError(w, r, http.StatusNotFound, "TM-ADMIN-4041", "job not found", nil)
+		return
+	}
+
+	resp := JobResponse{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		State:     string(job.State),
+		Total:     job.Total,
+		Done:      job.Done,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+	}
+	if !job.FinishedAt.IsZero() {
+		resp.FinishedAt = &job.FinishedAt
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// errString returns err's message, or "" for nil.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -4,7 +4,11 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
@@ -68,9 +72,109 @@ func (h *Handler) handleGetSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", formatETagVersion(session.Version))
 	h.writeJSON(w, r, http.StatusOK, sessionToResponse(session))
 }
 
+// handlePatchSession handles PATCH /sessions/{id}.
+//
+// The body is a JSON Merge Patch (RFC 7396) over the mutable session
+// fields ("data" and "device_id"). An If-Match header carrying the
+// session version makes the update a compare-and-set; a stale version
+// yields 412 Precondition Failed.
+//
+// @design DS-0301
+func (h *Handler) handlePatchSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if sessionID == "" {
+		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-1002", "session_id is required", nil)
+		return
+	}
+
+	svcReq, err := parseSessionMergePatch(r.Body)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", err.Error(), nil)
+		return
+	}
+	svcReq.SessionID = sessionID
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, ok := parseETagVersion(ifMatch)
+		if !ok {
+			h.writeError(w, r, http.StatusBadRequest, "TM-ARG-1001", "If-Match must be a session version", nil)
+			return
+		}
+		svcReq.ExpectedVersion = version
+	}
+
+	// Call service
+	resp, err := h.sessionSvc.Patch(r.Context(), svcReq)
+	if err != nil {
+		if svcReq.ExpectedVersion != 0 && domain.IsDomainError(err, "TM-SESS-4091") {
+			h.writeError(w, r, http.StatusPreconditionFailed, "TM-SESS-4091", err.Error(), nil)
+			return
+		}
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", formatETagVersion(resp.Session.Version))
+	h.writeJSON(w, r, http.StatusOK, sessionToResponse(resp.Session))
+}
+
+// parseSessionMergePatch decodes a JSON Merge Patch document for a session.
+// Only "data" (object or null) and "device_id" (string or null) may appear.
+func parseSessionMergePatch(body io.Reader) (*service.PatchSessionRequest, error) {
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch document")
+	}
+
+	req := &service.PatchSessionRequest{}
+	for field, raw := range doc {
+		isNull := string(raw) == "null"
+		switch field {
+		case "data":
+			if isNull {
+				req.ClearData = true
+				continue
+			}
+			if err := json.Unmarshal(raw, &req.Data); err != nil {
+				return nil, fmt.Errorf("data must be an object of string or null values")
+			}
+		case "device_id":
+			deviceID := ""
+			if !isNull {
+				if err := json.Unmarshal(raw, &deviceID); err != nil {
+					return nil, fmt.Errorf("device_id must be a string or null")
+				}
+			}
+			req.DeviceID = &deviceID
+		default:
+			return nil, fmt.Errorf("field %q cannot be patched", field)
+		}
+	}
+
+	return req, nil
+}
+
+// parseETagVersion parses a session version from an ETag-style header
+// value: 3, "3" or W/"3".
+func parseETagVersion(v string) (uint64, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+	v = strings.Trim(v, `"`)
+	version, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || version == 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// formatETagVersion formats a session version as a strong ETag.
+func formatETagVersion(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
 // handleRenewSession handles POST /sessions/{id}/renew.
 //
 // @design DS-0301
@@ -161,13 +265,19 @@ func (h *Handler) handleListSessions(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
 	query := r.URL.Query()
 
-	filter := &service.SessionFilter{
-		UserID:   query.Get("user_id"),
-		DeviceID: query.Get("device_id"),
-		Status:   query.Get("status"),
+	filter, err := parseSessionFilter(query)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-1001", err.Error(), nil)
+		return
 	}
 
-	// Parse pagination
+	// Parse pagination (limit/cursor select keyset mode, page/page_size offset mode)
+	if limit := query.Get("limit"); limit != "" {
+		var l int
+		if _, err := fmt.Sscanf(limit, "%d", &l); err == nil && l > 0 {
+			filter.Limit = l
+		}
+	}
 	if page := query.Get("page"); page != "" {
 		var p int
 		if _, err := fmt.Sscanf(page, "%d", &p); err == nil && p > 0 {
@@ -197,13 +307,51 @@ func (h *Handler) handleListSessions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.writeJSON(w, r, http.StatusOK, ListSessionsResponse{
-		Items:    items,
-		Total:    resp.Total,
-		Page:     resp.Page,
-		PageSize: resp.PageSize,
+		Items:      items,
+		Total:      resp.Total,
+		Page:       resp.Page,
+		PageSize:   resp.PageSize,
+		NextCursor: resp.NextCursor,
 	})
 }
 
+// parseSessionFilter parses the session filter query parameters shared by
+// listing and export (everything except pagination).
+func parseSessionFilter(query url.Values) (*service.SessionFilter, error) {
+	filter := &service.SessionFilter{
+		UserID:         query.Get("user_id"),
+		DeviceID:       query.Get("device_id"),
+		DeviceIDPrefix: query.Get("device_id_prefix"),
+		CreatedBy:      query.Get("created_by"),
+		Status:         query.Get("status"),
+		SortBy:         query.Get("sort_by"),
+		SortOrder:      query.Get("sort_order"),
+		Cursor:         query.Get("cursor"),
+	}
+
+	// Parse Data filters: data=key:value, repeatable
+	for _, pair := range query["data"] {
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("data filter must be key:value")
+		}
+		if filter.Data == nil {
+			filter.Data = make(map[string]string)
+		}
+		filter.Data[key] = value
+	}
+
+	if within := query.Get("expires_within_seconds"); within != "" {
+		secs, err := strconv.ParseInt(within, 10, 64)
+		if err != nil || secs <= 0 {
+			return nil, fmt.Errorf("expires_within_seconds must be a positive integer")
+		}
+		filter.ExpiresWithin = time.Duration(secs) * time.Second
+	}
+
+	return filter, nil
+}
+
 // handleRevokeUserSessions handles POST /users/{user_id}/sessions/revoke.
 //
 // @design DS-0301
@@ -241,5 +389,6 @@ func sessionToResponse(s *domain.Session) SessionResponse {
 		LastActive:   time.UnixMilli(s.LastActive),
 		LastAccessIP: s.LastAccessIP,
 		Data:         s.Data,
+		Version:      s.Version,
 	}
 }
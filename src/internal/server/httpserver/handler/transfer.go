@@ -0,0 +1,201 @@
+// Package handler provides HTTP request handlers for TokMesh.
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// Session import/export limits.
+const (
+	// importBatchSize is the number of records committed per WAL batch.
+	importBatchSize = 500
+
+	// maxImportLineBytes bounds a single JSONL record.
+	maxImportLineBytes = 1 << 20
+
+	// maxImportErrors bounds the rejected records listed in the response.
+	maxImportErrors = 100
+
+	// exportPageSize is the number of sessions fetched per listing page.
+	exportPageSize = 100
+)
+
+// handleImportSessions handles POST /admin/v1/sessions/import.
+//
+// The body is a stream of session records, one JSON object per line
+// (JSONL, as produced by the export endpoint). Records are validated and
+// written through the WAL in batches as the body is read, so arbitrarily
+// large imports use bounded memory. IDs, token hashes and timestamps are
+// preserved; records whose ID already exists are counted as existing,
+// which makes a re-run after interruption safe.
+//
+// Query parameters:
+//   - dry_run=true: validate only, persist nothing
+//
+// @design DS-0302
+func (h *Handler) handleImportSessions(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	resp := &ImportSessionsResponse{DryRun: dryRun}
+	batch := make([]*domain.Session, 0, importBatchSize)
+	lines := make([]int, 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		results, err := h.sessionSvc.Import(r.Context(), &service.ImportSessionsRequest{
+			Sessions: batch,
+			DryRun:   dryRun,
+		})
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			switch result.Status {
+			case service.ImportStatusImported:
+				resp.Imported++
+			case service.ImportStatusExists:
+				resp.Existing++
+			case service.ImportStatusExpired:
+				resp.Expired++
+			default:
+				item := batchItemError(result.Err)
+				resp.addError(lines[i], batch[i].ID, item.Code, item.Message)
+			}
+		}
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxImportLineBytes)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		resp.Total++
+
+		var session domain.Session
+		if err := json.Unmarshal(text, &session); err != nil {
+			resp.addError(line, "", "TM-SYS-4000", "invalid JSON record")
+			continue
+		}
+		batch = append(batch, &session)
+		lines = append(lines, line)
+
+		if len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				h.writeImportError(w, r, err, resp)
+				return
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// Batches already committed stay committed; report progress so
+		// the client can resume.
+		h.writeError(w, r, http.StatusBadRequest, "TM-SYS-4000", "read request body: "+err.Error(), resp)
+		return
+	}
+	if err := flush(); err != nil {
+		h.writeImportError(w, r, err, resp)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// writeImportError reports a batch-level import failure together with the
+// progress made before it.
+func (h *Handler) writeImportError(w http.ResponseWriter, r *http.Request, err error, resp *ImportSessionsResponse) {
+	if !domain.IsDomainError(err, "") {
+		h.logger.Error("session import failed", "error", err)
+		h.writeError(w, r, http.StatusInternalServerError, "TM-SYS-5000", "internal server error", resp)
+		return
+	}
+	code := domain.GetErrorCode(err)
+	h.writeError(w, r, errorCodeToHTTPStatus(code), code, err.Error(), resp)
+}
+
+// addError records a rejected import record.
+func (resp *ImportSessionsResponse) addError(line int, sessionID, code, message string) {
+	resp.Failed++
+	if len(resp.Errors) < maxImportErrors {
+		resp.Errors = append(resp.Errors, ImportSessionError{
+			Line:      line,
+			SessionID: sessionID,
+			Code:      code,
+			Message:   message,
+		})
+	}
+}
+
+// handleExportSessions handles GET /admin/v1/sessions/export.
+//
+// Streams the matching sessions as JSONL (one complete session record per
+// line, including token hashes) in created_at order. Accepts the same
+// filters as GET /sessions; a cursor resumes an interrupted export.
+//
+// @design DS-0302
+func (h *Handler) handleExportSessions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSessionFilter(r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, "TM-ARG-1001", err.Error(), nil)
+		return
+	}
+	if filter.SortBy == "" {
+		filter.SortBy = "created_at"
+	}
+	if filter.SortOrder == "" {
+		filter.SortOrder = "asc"
+	}
+	filter.Limit = exportPageSize
+
+	enc := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+	started := false
+
+	for {
+		resp, err := h.sessionSvc.List(r.Context(), &service.ListSessionsRequest{Filter: filter})
+		if err != nil {
+			if !started {
+				h.handleServiceError(w, r, err)
+				return
+			}
+			// Headers are already sent; the client detects the truncated
+			// stream by the missing trailing newline or short count.
+			h.logger.Error("session export aborted", "error", err)
+			return
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("X-Request-ID", getRequestID(r))
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		for _, session := range resp.Items {
+			if err := enc.Encode(session); err != nil {
+				return // Client went away
+			}
+		}
+		_ = rc.Flush()
+
+		if resp.NextCursor == "" || r.Context().Err() != nil {
+			return
+		}
+		filter.Cursor = resp.NextCursor
+	}
+}
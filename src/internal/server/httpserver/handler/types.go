@@ -111,6 +111,7 @@ type SessionResponse struct {
 	LastActive   time.Time         `json:"last_active"`
 	LastAccessIP string            `json:"last_access_ip,omitempty"`
 	Data         map[string]string `json:"data,omitempty"`
+	Version      uint64            `json:"version"`
 }
 
 // ErrorResponse is the standard error response format.
@@ -123,12 +124,16 @@ type ErrorResponse struct {
 
 // ListSessionsResponse is the response body for GET /sessions.
 //
+// With cursor pagination (limit/cursor query parameters) Total is -1 and
+// Page is omitted; NextCursor is set while more pages remain.
+//
 // @design DS-0301
 type ListSessionsResponse struct {
-	Items    []SessionResponse `json:"items"`
-	Total    int               `json:"total"`
-	Page     int               `json:"page"`
-	PageSize int               `json:"page_size"`
+	Items      []SessionResponse `json:"items"`
+	Total      int               `json:"total"`
+	Page       int               `json:"page,omitempty"`
+	PageSize   int               `json:"page_size"`
+	NextCursor string            `json:"next_cursor,omitempty"`
 }
 
 // RevokeUserSessionsResponse is the response body for POST /users/{user_id}/sessions/revoke.
@@ -138,6 +143,317 @@ type RevokeUserSessionsResponse struct {
 	RevokedCount int `json:"revoked_count"`
 }
 
+// BatchCreateSessionsRequest is the request body for POST /sessions:batch.
+//
+// @design DS-0301
+type BatchCreateSessionsRequest struct {
+	Items []CreateSessionRequest `json:"items"`
+}
+
+// BatchCreateSessionResult is one item of POST /sessions:batch.
+// Either Error or the session fields are set.
+//
+// @design DS-0301
+type BatchCreateSessionResult struct {
+	SessionID string         `json:"session_id,omitempty"`
+	Token     string         `json:"token,omitempty"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchCreateSessionsResponse is the response body for POST /sessions:batch.
+// Items are in request order.
+//
+// @design DS-0301
+type BatchCreateSessionsResponse struct {
+	Items     []BatchCreateSessionResult `json:"items"`
+	Succeeded int                        `json:"succeeded"`
+	Failed    int                        `json:"failed"`
+}
+
+// BatchRevokeSessionsRequest is the request body for POST /sessions/revoke:batch.
+//
+// @design DS-0301
+type BatchRevokeSessionsRequest struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// BatchRevokeSessionResult is one item of POST /sessions/revoke:batch.
+// Revoked is false for sessions that did not exist.
+//
+// @design DS-0301
+type BatchRevokeSessionResult struct {
+	SessionID string         `json:"session_id"`
+	Revoked   bool           `json:"revoked"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchRevokeSessionsResponse is the response body for POST /sessions/revoke:batch.
+//
+// @design DS-0301
+type BatchRevokeSessionsResponse struct {
+	Items        []BatchRevokeSessionResult `json:"items"`
+	RevokedCount int                        `json:"revoked_count"`
+	Failed       int                        `json:"failed"`
+}
+
+// BatchValidateTokensRequest is the request body for POST /tokens/validate:batch.
+//
+// @design DS-0301
+type BatchValidateTokensRequest struct {
+	Items []ValidateTokenRequest `json:"items"`
+}
+
+// BatchValidateTokensResponse is the response body for POST /tokens/validate:batch.
+// Items are in request order.
+//
+// @design DS-0301
+type BatchValidateTokensResponse struct {
+	Items []ValidateTokenResponse `json:"items"`
+	Valid int                     `json:"valid"`
+}
+
+// RevokeSessionsByQueryRequest is the request body for POST /sessions/revoke:query.
+// Every non-empty criterion must match; at least one is required.
+//
+// @design DS-0302
+type RevokeSessionsByQueryRequest struct {
+	UserID    string            `json:"user_id,omitempty"`
+	DeviceID  string            `json:"device_id,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"` // API key ID
+	IP        string            `json:"ip,omitempty"`         // Address or CIDR
+	Data      map[string]string `json:"data,omitempty"`
+	DryRun    bool              `json:"dry_run,omitempty"`
+	Reason    string            `json:"reason,omitempty"` // Recorded in the audit log
+}
+
+// RevokeSessionsByQueryResponse is the response body for POST /sessions/revoke:query.
+//
+// Large revocations run in the background: JobID is set, Revoked is 0 and
+// progress is polled at GET /admin/v1/jobs/{job_id}. Replicated reports
+// whether the revocation was propagated to the other cluster nodes.
+//
+// @design DS-0302
+type RevokeSessionsByQueryResponse struct {
+	DryRun     bool   `json:"dry_run"`
+	Matched    int    `json:"matched"`
+	Revoked    int    `json:"revoked"`
+	JobID      string `json:"job_id,omitempty"`
+	Replicated bool   `json:"replicated"`
+}
+
+// PointInTimeRecoveryRequest is the request body for
+// POST /admin/v1/backups/pitr. At least one target and exactly one output
+// are required; outputs are absolute paths on the server.
+//
+// @design DS-0302
+type PointInTimeRecoveryRequest struct {
+	TargetTime   string `json:"target_time,omitempty"`   // RFC 3339
+	TargetOffset string `json:"target_offset,omitempty"` // WAL offset, SEGMENT[:OFFSET]
+
+	OutputDataDir     string `json:"output_data_dir,omitempty"`
+	OutputSnapshotDir string `json:"output_snapshot_dir,omitempty"`
+
+	Reason string `json:"reason,omitempty"` // Recorded in the audit log
+}
+
+// PointInTimeRecoveryResponse is the response body for
+// POST /admin/v1/backups/pitr. Recovery runs as a background job, polled
+// at GET /admin/v1/jobs/{job_id}.
+//
+// @design DS-0302
+type PointInTimeRecoveryResponse struct {
+	JobID string `json:"job_id"`
+}
+
+// WALStatusResponse is the response body for GET /admin/v1/wal/status.
+// Offsets are SEGMENT:OFFSET.
+//
+// @design DS-0302
+type WALStatusResponse struct {
+	SegmentID           uint64               `json:"segment_id"`
+	Offset              string               `json:"offset"`
+	PendingFsyncBytes   int64                `json:"pending_fsync_bytes"`
+	PendingFsyncEntries int                  `json:"pending_fsync_entries"`
+	LastFsyncAt         *time.Time           `json:"last_fsync_at,omitempty"`
+	SegmentCount        int                  `json:"segment_count"`
+	TotalBytes          int64                `json:"total_bytes"`
+	Segments            []WALSegmentResponse `json:"segments"`
+	SnapshotOffset      string               `json:"snapshot_offset,omitempty"`
+	LastSnapshotAt      *time.Time           `json:"last_snapshot_at,omitempty"`
+}
+
+// WALSegmentResponse describes a WAL segment file in
+// GET /admin/v1/wal/status.
+//
+// @design DS-0302
+type WALSegmentResponse struct {
+	ID         uint64    `json:"id"`
+	File       string    `json:"file"`
+	SizeBytes  int64     `json:"size_bytes"`
+	Active     bool      `json:"active"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// WALLogsResponse is the response body for GET /admin/v1/wal/logs.
+// NextOffset is the from parameter of the next page; More is set while
+// the page stopped before the end of the WAL.
+//
+// @design DS-0302
+type WALLogsResponse struct {
+	Entries    []WALLogEntryResponse `json:"entries"`
+	NextOffset string                `json:"next_offset"`
+	More       bool                  `json:"more"`
+	Masked     bool                  `json:"masked"`
+}
+
+// WALLogEntryResponse is a decoded WAL entry. Session is set by create
+// and update entries; LastActive, AccessIP and AccessUA by touch, and
+// ExpiresAt and TTL (milliseconds) by set_expiry. When masked, user IDs,
+// token hashes, addresses, user agents, device IDs and data values are
+// replaced by stable pseudonyms.
+//
+// @design DS-0302
+type WALLogEntryResponse struct {
+	Offset    string              `json:"offset"`
+	Op        string              `json:"op"`
+	Timestamp time.Time           `json:"timestamp"`
+	SessionID string              `json:"session_id"`
+	Version   uint64              `json:"version,omitempty"`
+	Encrypted bool                `json:"encrypted,omitempty"`
+	Session   *WALSessionResponse `json:"session,omitempty"`
+
+	LastActive *time.Time `json:"last_active,omitempty"`
+	AccessIP   string     `json:"access_ip,omitempty"`
+	AccessUA   string     `json:"access_ua,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTL        int64      `json:"ttl,omitempty"`
+}
+
+// WALSessionResponse is the session logged by a WAL entry.
+//
+// @design DS-0302
+type WALSessionResponse struct {
+	SessionResponse
+	TokenHash    string `json:"token_hash,omitempty"`
+	LastAccessUA string `json:"last_access_ua,omitempty"`
+}
+
+// JobResponse is the response body for GET /admin/v1/jobs/{job_id}.
+//
+// @design DS-0302
+type JobResponse struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// TLSCertificateStatus reports the certificate a TLS listener serves in
+// GET /admin/v1/status/summary. ExpiresInSeconds is negative once the
+// certificate has expired.
+//
+// @design DS-0302
+type TLSCertificateStatus struct {
+	Listener         string    `json:"listener"`
+	NotAfter         time.Time `json:"not_after"`
+	ExpiresInSeconds int64     `json:"expires_in_seconds"`
+}
+
+// SnapshotScheduleStatus reports the snapshot policy, its latest
+// decision and snapshot run in GET /admin/v1/status/summary. Durations
+// are in milliseconds and offsets are SEGMENT:OFFSET.
+//
+// @design DS-0302
+type SnapshotScheduleStatus struct {
+	Policy         SnapshotPolicyStatus    `json:"policy"`
+	WALBytes       int64                   `json:"wal_bytes_since_snapshot"`
+	WALEntries     int64                   `json:"wal_entries_since_snapshot"`
+	WriteRate      float64                 `json:"write_rate_per_second"`
+	LastSnapshotAt *time.Time              `json:"last_snapshot_at,omitempty"`
+	LastCheckAt    *time.Time              `json:"last_check_at,omitempty"`
+	NextCheckAt    *time.Time              `json:"next_check_at,omitempty"`
+	DeferredSince  *time.Time              `json:"deferred_since,omitempty"`
+	LastDecision   *SnapshotDecisionStatus `json:"last_decision,omitempty"`
+	LastRun        *SnapshotRunStatus      `json:"last_run,omitempty"`
+	Snapshots      uint64                  `json:"snapshots"`
+	Deferrals      uint64                  `json:"deferrals"`
+	Failures       uint64                  `json:"failures"`
+}
+
+// SnapshotPolicyStatus is the snapshot policy in SnapshotScheduleStatus.
+// Zero thresholds are disabled.
+//
+// @design DS-0302
+type SnapshotPolicyStatus struct {
+	MaxWALBytes     int64   `json:"max_wal_bytes"`
+	MaxWALEntries   int64   `json:"max_wal_entries"`
+	MaxAgeMs        int64   `json:"max_age_ms"`
+	CheckIntervalMs int64   `json:"check_interval_ms"`
+	HighWriteRate   float64 `json:"high_write_rate"`
+	MaxDeferMs      int64   `json:"max_defer_ms"`
+	OnShutdown      bool    `json:"on_shutdown"`
+}
+
+// SnapshotDecisionStatus is a scheduling decision in
+// SnapshotScheduleStatus: action is snapshot or defer.
+//
+// @design DS-0302
+type SnapshotDecisionStatus struct {
+	At      time.Time `json:"at"`
+	Action  string    `json:"action"`
+	Trigger string    `json:"trigger"`
+	Reason  string    `json:"reason"`
+}
+
+// SnapshotRunStatus is a snapshot run and its timings in
+// SnapshotScheduleStatus.
+//
+// @design DS-0302
+type SnapshotRunStatus struct {
+	Trigger      string    `json:"trigger"`
+	StartedAt    time.Time `json:"started_at"`
+	DurationMs   int64     `json:"duration_ms"`
+	SnapshotMs   int64     `json:"snapshot_ms"`
+	PruneMs      int64     `json:"prune_ms"`
+	CompactMs    int64     `json:"compact_ms"`
+	SessionCount int64     `json:"session_count"`
+	SizeBytes    int64     `json:"size_bytes"`
+	WALOffset    string    `json:"wal_offset,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// ImportSessionsResponse is the response body for POST /admin/v1/sessions/import.
+//
+// Imported counts records that were persisted (or, in a dry run, that
+// would be). Errors lists at most the first 100 rejected records.
+//
+// @design DS-0302
+type ImportSessionsResponse struct {
+	DryRun   bool                 `json:"dry_run"`
+	Total    int                  `json:"total"`
+	Imported int                  `json:"imported"`
+	Existing int                  `json:"existing"`
+	Expired  int                  `json:"expired"`
+	Failed   int                  `json:"failed"`
+	Errors   []ImportSessionError `json:"errors,omitempty"`
+}
+
+// ImportSessionError describes a rejected import record.
+// Line is the 1-based line number within the request body.
+//
+// @design DS-0302
+type ImportSessionError struct {
+	Line      int    `json:"line"`
+	SessionID string `json:"session_id,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
 // CreateAPIKeyRequest is the request body for POST /admin/v1/keys.
 //
 // @design DS-0302
@@ -145,6 +461,7 @@ type CreateAPIKeyRequest struct {
 	Name        string `json:"name"`
 	Role        string `json:"role"`
 	Description string `json:"description,omitempty"`
+	Durability  string `json:"durability,omitempty"`
 }
 
 // CreateAPIKeyResponse is the response body for POST /admin/v1/keys.
@@ -166,6 +483,7 @@ type APIKeyResponse struct {
 	Name        string    `json:"name"`
 	Role        string    `json:"role"`
 	Description string    `json:"description,omitempty"`
+	Durability  string    `json:"durability,omitempty"`
 	Enabled     bool      `json:"enabled"`
 	CreatedAt   time.Time `json:"created_at"`
 	LastUsedAt  time.Time `json:"last_used_at,omitempty"`
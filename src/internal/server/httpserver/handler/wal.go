@@ -0,0 +1,232 @@
+// Package handler provides HTTP request handlers for TokMesh.
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/inspect"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// WALInspector reports on the write-ahead log. It is implemented by the
+// storage engine.
+type WALInspector interface {
+	WALStatus() (*storage.WALStatus, error)
+	WALLogs(ctx context.Context, q storage.WALLogQuery) (*storage.WALLogPage, error)
+}
+
+// SetWALInspector enables GET /admin/v1/wal/status and
+// GET /admin/v1/wal/logs. Without an inspector the endpoints are not
+// found.
+func (h *Handler) SetWALInspector(i WALInspector) {
+	h.wal = i
+}
+
+// handleWALStatus handles GET /admin/v1/wal/status.
+//
+// @design DS-0302
+func (h *Handler) handleWALStatus(w http.ResponseWriter, r *http.Request) {
+	if h.wal == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	st, err := h.wal.WALStatus()
+	if err != nil {
+		h.handleWALError(w, r, err)
+		return
+	}
+
+	resp := WALStatusResponse{
+		SegmentID:           st.SegmentID,
+		Offset:              inspect.FormatOffset(st.Offset),
+		PendingFsyncBytes:   st.PendingBytes,
+		PendingFsyncEntries: st.PendingEntries,
+		LastFsyncAt:         optionalTime(st.LastSync),
+		SegmentCount:        len(st.Segments),
+		TotalBytes:          st.TotalBytes,
+		Segments:            make([]WALSegmentResponse, len(st.Segments)),
+		LastSnapshotAt:      optionalTime(st.LastSnapshot),
+	}
+	for i, seg := range st.Segments {
+		resp.Segments[i] = WALSegmentResponse{
+			ID:         seg.ID,
+			File:       filepath.Base(seg.Path),
+			SizeBytes:  seg.Size,
+			Active:     seg.ID == st.SegmentID,
+			ModifiedAt: seg.ModTime,
+		}
+	}
+	if st.SnapshotOffset > 0 {
+		resp.SnapshotOffset = inspect.FormatOffset(st.SnapshotOffset)
+	}
+
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// handleWALLogs handles GET /admin/v1/wal/logs.
+//
+// Query parameters: from (SEGMENT[:OFFSET]), limit, tail (the last limit
+// entries), op (comma-separated operations), session_id, user_id and
+// reveal. Token hashes and PII are masked unless an admin caller sets
+// reveal=true, which is audited.
+//
+// @design DS-0302
+func (h *Handler) handleWALLogs(w http.ResponseWriter, r *http.Request) {
+	if h.wal == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	q := storage.WALLogQuery{
+		SessionID: query.Get("session_id"),
+		UserID:    query.Get("user_id"),
+		Tail:      query.Get("tail") == "true",
+	}
+	if from := query.Get("from"); from != "" {
+		offset, err := inspect.ParseOffset(from)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid from, must be SEGMENT[:OFFSET]", nil)
+			return
+		}
+		q.From = offset
+	}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 || l > storage.MaxWALLogLimit {
+			h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid limit, must be 1 to "+strconv.Itoa(storage.MaxWALLogLimit), nil)
+			return
+		}
+		q.Limit = l
+	}
+	if ops := query.Get("op"); ops != "" {
+		for _, name := range strings.Split(ops, ",") {
+			op, ok := wal.ParseOpType(strings.TrimSpace(name))
+			if !ok {
+				h.writeError(w, r, http.StatusBadRequest, "TM-ARG-4001", "invalid op "+strconv.Quote(name), nil)
+				return
+			}
+			q.Ops = append(q.Ops, op)
+		}
+	}
+
+	masked := true
+	if query.Get("reveal") == "true" {
+		if h.callerRole(r) != domain.RoleAdmin {
+			h.writeError(w, r, http.StatusForbidden, "TM-ADMIN-4030", "admin role required to reveal WAL values", nil)
+			return
+		}
+		masked = false
+	}
+
+	page, err := h.wal.WALLogs(r.Context(), q)
+	if err != nil {
+		h.handleWALError(w, r, err)
+		return
+	}
+
+	if !masked {
+		h.logger.Info("wal logs revealed",
+			"audit", true,
+			"request_id", getRequestID(r),
+			"from", inspect.FormatOffset(q.From),
+			"session_id", q.SessionID,
+			"user_id", q.UserID,
+			"entries", len(page.Entries))
+	}
+
+	resp := WALLogsResponse{
+		Entries:    make([]WALLogEntryResponse, len(page.Entries)),
+		NextOffset: inspect.FormatOffset(page.NextOffset),
+		More:       page.More,
+		Masked:     masked,
+	}
+	for i, e := range page.Entries {
+		resp.Entries[i] = walEntryToResponse(e, masked)
+	}
+	h.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// handleWALError writes the response for a failed WAL inspection.
+func (h *Handler) handleWALError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, storage.ErrNoWAL) {
+		h.writeError(w, r, http.StatusNotFound, "TM-ADMIN-4041", "no WAL with this storage backend", nil)
+		return
+	}
+	h.logger.Error("wal inspection failed", "error", err)
+	h.writeError(w, r, http.StatusInternalServerError, "TM-SYS-5000", "wal inspection failed", nil)
+}
+
+// walEntryToResponse converts a WAL entry, masking token hashes and PII
+// if masked.
+func walEntryToResponse(e storage.WALLogEntry, masked bool) WALLogEntryResponse {
+	value := func(v string) string {
+		if masked {
+			return inspect.Mask(v)
+		}
+		return v
+	}
+
+	entry := e.Entry
+	resp := WALLogEntryResponse{
+		Offset:    inspect.FormatOffset(e.Offset),
+		Op:        entry.OpType.String(),
+		Timestamp: time.UnixMilli(entry.Timestamp),
+		SessionID: entry.SessionID,
+		Version:   entry.Version,
+		AccessIP:  value(entry.AccessIP),
+		AccessUA:  value(entry.AccessUA),
+		TTL:       entry.TTL,
+	}
+	if entry.LastActive > 0 {
+		resp.LastActive = optionalTime(time.UnixMilli(entry.LastActive))
+	}
+	if entry.ExpiresAt > 0 {
+		resp.ExpiresAt = optionalTime(time.UnixMilli(entry.ExpiresAt))
+	}
+
+	switch entry.OpType {
+	case wal.OpTypeCreate, wal.OpTypeUpdate:
+		if entry.Session == nil {
+			// Encrypted, read without the cipher.
+			resp.Encrypted = true
+			break
+		}
+		s := sessionToResponse(entry.Session)
+		s.UserID = value(s.UserID)
+		s.IPAddress = value(s.IPAddress)
+		s.UserAgent = value(s.UserAgent)
+		s.DeviceID = value(s.DeviceID)
+		s.LastAccessIP = value(s.LastAccessIP)
+		if masked && s.Data != nil {
+			data := make(map[string]string, len(s.Data))
+			for k, v := range s.Data {
+				data[k] = inspect.Mask(v)
+			}
+			s.Data = data
+		}
+		resp.Session = &WALSessionResponse{
+			SessionResponse: s,
+			TokenHash:       value(entry.Session.TokenHash),
+			LastAccessUA:    value(entry.Session.LastAccessUA),
+		}
+	}
+	return resp
+}
+
+// optionalTime returns a pointer to t, or nil if t is zero.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
 	"github.com/yndnr/tokmesh-go/pkg/token"
 )
 
@@ -49,6 +50,12 @@ type MiddlewareConfig struct {
 	// SkipAuthPaths are paths that don't require authentication.
 	SkipAuthPaths []string
 
+	// CertAPIKeys maps TLS client certificate identities (see
+	// tlsroots.CertIdentities) to API key IDs. Requests without API key
+	// headers that present a verified, mapped certificate authenticate as
+	// that key.
+	CertAPIKeys map[string]string
+
 	// EnableAudit enables audit logging.
 	EnableAudit bool
 }
@@ -109,43 +116,121 @@ func Auth(cfg *MiddlewareConfig) Middleware {
 				}
 			}
 
-			// If no credentials provided, check if path requires auth
-			if keyID == "" || keySecret == "" {
-				writeAuthError(w, "TM-AUTH-4010", "authentication required")
-				return
-			}
-
-			// Validate API key
-			resp, err := cfg.AuthService.ValidateAPIKey(r.Context(), &service.ValidateAPIKeyRequest{
-				KeyID:     keyID,
-				KeySecret: keySecret,
-				ClientIP:  getClientIP(r),
-			})
-			if err != nil {
-				code := domain.GetErrorCode(err)
-				writeAuthError(w, code, err.Error())
-				return
-			}
-
-			if !resp.Valid || resp.APIKey == nil {
-				writeAuthError(w, "TM-AUTH-4011", "invalid API key")
+			apiKey, ok := authenticateRequest(w, r, cfg, keyID, keySecret)
+			if !ok {
 				return
 			}
 
 			// Check rate limit
-			if err := cfg.AuthService.CheckRateLimit(r.Context(), keyID, resp.APIKey.RateLimit); err != nil {
+			if err := cfg.AuthService.CheckRateLimit(r.Context(), apiKey.KeyID, apiKey.RateLimit); err != nil {
 				w.Header().Set("Retry-After", "60")
 				writeAuthError(w, "TM-AUTH-4290", "rate limit exceeded")
 				return
 			}
 
 			// Add API key to context
-			ctx := context.WithValue(r.Context(), ContextKeyAPIKey, resp.APIKey)
+			ctx := context.WithValue(r.Context(), ContextKeyAPIKey, apiKey)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// DurabilityHeader is the request header selecting the write durability
+// of a request: none, buffered or fsync.
+const DurabilityHeader = "X-Durability"
+
+// Durability sets the write durability of a request: the DurabilityHeader
+// if present, otherwise the default of the authenticated API key. It must
+// run after Auth.
+//
+// @design DS-0102
+func Durability() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := domain.DurabilityDefault
+			if apiKey := GetAPIKeyFromContext(r.Context()); apiKey != nil {
+				d = apiKey.Durability
+			}
+			if v := r.Header.Get(DurabilityHeader); v != "" {
+				if !domain.IsValidDurability(v) {
+					writeAuthError(w, "TM-ARG-1001", "invalid "+DurabilityHeader+" header, must be one of: none, buffered, fsync")
+					return
+				}
+				d = domain.Durability(v)
+			}
+
+			ctx := service.WithDurability(r.Context(), d)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authenticateRequest authenticates a request by its API key credentials,
+// or by its TLS client certificate if it carries none. It writes the error
+// response and returns false on failure.
+func authenticateRequest(w http.ResponseWriter, r *http.Request, cfg *MiddlewareConfig, keyID, keySecret string) (*domain.APIKey, bool) {
+	// If no credentials provided, fall back to the client certificate
+	if keyID == "" || keySecret == "" {
+		apiKey, err := authenticateClientCert(r, cfg)
+		if err != nil {
+			code := domain.GetErrorCode(err)
+			writeAuthError(w, code, err.Error())
+			return nil, false
+		}
+		if apiKey == nil {
+			writeAuthError(w, "TM-AUTH-4010", "authentication required")
+			return nil, false
+		}
+		return apiKey, true
+	}
+
+	// Validate API key
+	resp, err := cfg.AuthService.ValidateAPIKey(r.Context(), &service.ValidateAPIKeyRequest{
+		KeyID:     keyID,
+		KeySecret: keySecret,
+		ClientIP:  getClientIP(r),
+	})
+	if err != nil {
+		code := domain.GetErrorCode(err)
+		writeAuthError(w, code, err.Error())
+		return nil, false
+	}
+
+	if !resp.Valid || resp.APIKey == nil {
+		writeAuthError(w, "TM-AUTH-4011", "invalid API key")
+		return nil, false
+	}
+	return resp.APIKey, true
+}
+
+// authenticateClientCert returns the API key mapped to the request's
+// verified TLS client certificate, or nil if the request has no such
+// certificate. The first mapped identity (most specific first) decides.
+//
+// @design DS-0302
+func authenticateClientCert(r *http.Request, cfg *MiddlewareConfig) (*domain.APIKey, error) {
+	// Only certificates verified against the configured client CAs count.
+	if len(cfg.CertAPIKeys) == 0 || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+
+	for _, identity := range tlsroots.CertIdentities(r.TLS.VerifiedChains[0][0]) {
+		keyID, ok := cfg.CertAPIKeys[identity]
+		if !ok {
+			continue
+		}
+		resp, err := cfg.AuthService.AuthenticateTrustedKey(r.Context(), &service.AuthenticateTrustedKeyRequest{
+			KeyID:    keyID,
+			ClientIP: getClientIP(r),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.APIKey, nil
+	}
+	return nil, nil
+}
+
 // RequirePermission creates a middleware that checks for specific permission.
 func RequirePermission(authSvc *service.AuthService, perm domain.Permission) Middleware {
 	return func(next http.Handler) http.Handler {
@@ -311,44 +396,26 @@ func AdminAuth(cfg *MiddlewareConfig) Middleware {
 			// Extract API key from headers
 			keyID, keySecret := extractAPIKeyCredentials(r)
 
-			// If no credentials provided
-			if keyID == "" || keySecret == "" {
-				writeAuthError(w, "TM-AUTH-4010", "API Key not provided")
-				return
-			}
-
-			// Validate API key
-			resp, err := cfg.AuthService.ValidateAPIKey(r.Context(), &service.ValidateAPIKeyRequest{
-				KeyID:     keyID,
-				KeySecret: keySecret,
-				ClientIP:  getClientIP(r),
-			})
-			if err != nil {
-				code := domain.GetErrorCode(err)
-				writeAuthError(w, code, err.Error())
-				return
-			}
-
-			if !resp.Valid || resp.APIKey == nil {
-				writeAuthError(w, "TM-AUTH-4011", "invalid API key")
+			apiKey, ok := authenticateRequest(w, r, cfg, keyID, keySecret)
+			if !ok {
 				return
 			}
 
 			// Check admin role - this is the key difference from regular Auth
-			if resp.APIKey.Role != domain.RoleAdmin {
+			if apiKey.Role != domain.RoleAdmin {
 				writeAuthError(w, "TM-ADMIN-4030", "admin role required")
 				return
 			}
 
 			// Check rate limit
-			if err := cfg.AuthService.CheckRateLimit(r.Context(), keyID, resp.APIKey.RateLimit); err != nil {
+			if err := cfg.AuthService.CheckRateLimit(r.Context(), apiKey.KeyID, apiKey.RateLimit); err != nil {
 				w.Header().Set("Retry-After", "60")
 				writeAuthError(w, "TM-AUTH-4290", "rate limit exceeded")
 				return
 			}
 
 			// Add API key to context
-			ctx := context.WithValue(r.Context(), ContextKeyAPIKey, resp.APIKey)
+			ctx := context.WithValue(r.Context(), ContextKeyAPIKey, apiKey)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -526,7 +593,7 @@ func CORS(allowedOrigins []string) Middleware {
 			if allowed && origin != "" {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key-ID, X-API-Key, X-Request-ID, Authorization")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key-ID, X-API-Key, X-Request-ID, X-Durability, Authorization")
 				w.Header().Set("Access-Control-Max-Age", "86400")
 			}
 
@@ -579,6 +646,8 @@ func writeAuthError(w http.ResponseWriter, code, message string) {
 		status = http.StatusForbidden
 	} else if strings.HasSuffix(code, "-4290") {
 		status = http.StatusTooManyRequests
+	} else if strings.HasPrefix(code, "TM-ARG-") {
+		status = http.StatusBadRequest
 	}
 
 	w.WriteHeader(status)
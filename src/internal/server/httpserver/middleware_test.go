@@ -3,6 +3,9 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -900,6 +903,131 @@ func TestAuth(t *testing.T) {
 	})
 }
 
+// TestAuth_ClientCert tests authentication by mapped TLS client certificates.
+func TestDurability(t *testing.T) {
+	var got domain.Durability
+	handler := Durability()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = service.DurabilityFromContext(r.Context())
+	}))
+
+	key := &domain.APIKey{KeyID: "tmak-test", Durability: domain.DurabilityBuffered}
+	tests := []struct {
+		name   string
+		key    *domain.APIKey
+		header string
+		want   domain.Durability
+		status int
+	}{
+		{"server default", nil, "", domain.DurabilityDefault, http.StatusOK},
+		{"api key default", key, "", domain.DurabilityBuffered, http.StatusOK},
+		{"header overrides key", key, "fsync", domain.DurabilityFsync, http.StatusOK},
+		{"invalid header", key, "eventually", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest(http.MethodPost, "/sessions", nil)
+			if tt.key != nil {
+				req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, tt.key))
+			}
+			if tt.header != "" {
+				req.Header.Set(DurabilityHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status || got != tt.want {
+				t.Errorf("status %d, durability %q; want %d, %q", rec.Code, got, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuth_ClientCert(t *testing.T) {
+	repo := newMockAPIKeyRepo()
+	authSvc := service.NewAuthService(repo, nil)
+
+	adminKey, adminSecret := createTestAPIKey(domain.RoleAdmin)
+	repo.addKey(adminKey, adminSecret)
+	validatorKey, validatorSecret := createTestAPIKey(domain.RoleValidator)
+	repo.addKey(validatorKey, validatorSecret)
+
+	cfg := &MiddlewareConfig{
+		AuthService: authSvc,
+		CertAPIKeys: map[string]string{
+			"CN=admin-tool":      adminKey.KeyID,
+			"DNS:gw.example.org": validatorKey.KeyID,
+			"CN=revoked":         "tmak-missing",
+		},
+	}
+
+	// withCert attaches a verified client certificate to the request.
+	withCert := func(req *http.Request, cert *x509.Certificate) *http.Request {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+		return req
+	}
+
+	var gotKey *domain.APIKey
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = GetAPIKeyFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		middleware Middleware
+		cert       *x509.Certificate
+		verified   bool
+		wantStatus int
+		wantKey    string
+	}{
+		{"mapped SAN", Auth(cfg), &x509.Certificate{DNSNames: []string{"gw.example.org"}, Subject: pkix.Name{CommonName: "gw"}}, true, http.StatusOK, validatorKey.KeyID},
+		{"mapped CN", Auth(cfg), &x509.Certificate{Subject: pkix.Name{CommonName: "admin-tool"}}, true, http.StatusOK, adminKey.KeyID},
+		{"unmapped", Auth(cfg), &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, true, http.StatusUnauthorized, ""},
+		{"unverified", Auth(cfg), &x509.Certificate{Subject: pkix.Name{CommonName: "admin-tool"}}, false, http.StatusUnauthorized, ""},
+		{"unknown key", Auth(cfg), &x509.Certificate{Subject: pkix.Name{CommonName: "revoked"}}, true, http.StatusUnauthorized, ""},
+		{"admin", AdminAuth(cfg), &x509.Certificate{Subject: pkix.Name{CommonName: "admin-tool"}}, true, http.StatusOK, adminKey.KeyID},
+		{"admin requires admin role", AdminAuth(cfg), &x509.Certificate{DNSNames: []string{"gw.example.org"}}, true, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKey = nil
+			req := httptest.NewRequest("GET", "/sessions", nil)
+			if tt.verified {
+				req = withCert(req, tt.cert)
+			} else {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+			}
+			rec := httptest.NewRecorder()
+
+			tt.middleware(ok).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantKey != "" && (gotKey == nil || gotKey.KeyID != tt.wantKey) {
+				t.Errorf("authenticated key = %v, want %s", gotKey, tt.wantKey)
+			}
+		})
+	}
+
+	t.Run("headers take precedence", func(t *testing.T) {
+		gotKey = nil
+		req := withCert(httptest.NewRequest("GET", "/sessions", nil), &x509.Certificate{Subject: pkix.Name{CommonName: "admin-tool"}})
+		req.Header.Set("Authorization", "Bearer "+validatorKey.KeyID+":"+validatorSecret)
+		rec := httptest.NewRecorder()
+
+		Auth(cfg)(ok).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK || gotKey == nil || gotKey.KeyID != validatorKey.KeyID {
+			t.Errorf("status = %d, key = %v, want validator key", rec.Code, gotKey)
+		}
+	})
+}
+
 // TestRequirePermission tests the RequirePermission middleware.
 func TestRequirePermission(t *testing.T) {
 	repo := newMockAPIKeyRepo()
@@ -20,12 +20,20 @@ type RouterConfig struct {
 	// AuthService handles authentication and API key operations.
 	AuthService *service.AuthService
 
+	// Handler serves the routes. If nil, NewRouter creates one from the
+	// services; set it to serve a handler configured by the caller.
+	Handler *handler.Handler
+
 	// Logger for request logging.
 	Logger *slog.Logger
 
 	// SkipAuthPaths are paths that don't require authentication.
 	SkipAuthPaths []string
 
+	// CertAPIKeys maps TLS client certificate identities to API key IDs
+	// (see MiddlewareConfig.CertAPIKeys).
+	CertAPIKeys map[string]string
+
 	// AdminAllowList is the IP/CIDR allowlist for admin API (empty = no restriction).
 	AdminAllowList []string
 
@@ -47,13 +55,18 @@ type RouterConfig struct {
 // @design DS-0301, DS-0302
 func NewRouter(cfg *RouterConfig) http.Handler {
 	// Create handler with services
-	h := handler.New(cfg.SessionService, cfg.TokenService, cfg.AuthService, cfg.Logger)
+	h := cfg.Handler
+	if h == nil {
+		h = handler.New(cfg.SessionService, cfg.TokenService, cfg.AuthService, cfg.Logger)
+	}
+	h.SetAPIKeyResolver(GetAPIKeyFromContext)
 
 	// Create middleware configuration
 	middlewareCfg := &MiddlewareConfig{
 		AuthService:   cfg.AuthService,
 		Logger:        cfg.Logger,
 		SkipAuthPaths: cfg.SkipAuthPaths,
+		CertAPIKeys:   cfg.CertAPIKeys,
 		EnableAudit:   cfg.EnableAudit,
 	}
 
@@ -109,6 +122,7 @@ func NewRouter(cfg *RouterConfig) http.Handler {
 		Recover(cfg.Logger),
 		CORS(cfg.CORSAllowedOrigins),
 		Auth(middlewareCfg),
+		Durability(),
 	)
 	if cfg.EnableAudit {
 		businessHandler = Audit(cfg.Logger)(businessHandler)
@@ -120,7 +134,10 @@ func NewRouter(cfg *RouterConfig) http.Handler {
 	// Session endpoints
 	mux.Handle("GET /sessions", businessHandler)
 	mux.Handle("POST /sessions", businessHandler)
+	mux.Handle("POST /sessions:batch", businessHandler)
+	mux.Handle("POST /sessions/revoke:batch", businessHandler)
 	mux.Handle("GET /sessions/{id}", businessHandler)
+	mux.Handle("PATCH /sessions/{id}", businessHandler)
 	mux.Handle("POST /sessions/{id}/touch", businessHandler)
 	mux.Handle("POST /sessions/{id}/renew", businessHandler)
 	mux.Handle("POST /sessions/{id}/revoke", businessHandler)
@@ -130,6 +147,7 @@ func NewRouter(cfg *RouterConfig) http.Handler {
 
 	// Token endpoints
 	mux.Handle("POST /tokens/validate", businessHandler)
+	mux.Handle("POST /tokens/validate:batch", businessHandler)
 
 	// Admin API endpoints - require admin role + optional network ACL
 	adminMiddlewares := []Middleware{
@@ -161,6 +179,14 @@ func NewRouter(cfg *RouterConfig) http.Handler {
 	mux.Handle("GET /admin/v1/status/summary", adminHandler)
 	mux.Handle("POST /admin/v1/gc/trigger", adminHandler)
 
+	// Session migration
+	mux.Handle("POST /admin/v1/sessions/import", adminHandler)
+	mux.Handle("GET /admin/v1/sessions/export", adminHandler)
+
+	// Incident response: bulk revocation is admin-only despite its path
+	mux.Handle("POST /sessions/revoke:query", adminHandler)
+	mux.Handle("GET /admin/v1/jobs/{job_id}", adminHandler)
+
 	// API Key management endpoints
 	mux.Handle("POST /admin/v1/keys", adminHandler)
 	mux.Handle("GET /admin/v1/keys", adminHandler)
@@ -173,6 +199,7 @@ func NewRouter(cfg *RouterConfig) http.Handler {
 	mux.Handle("GET /admin/v1/backups/snapshots/{snapshot_id}/file", adminHandler)
 	mux.Handle("POST /admin/v1/backups/restores", adminHandler)
 	mux.Handle("GET /admin/v1/backups/restores/{job_id}", adminHandler)
+	mux.Handle("POST /admin/v1/backups/pitr", adminHandler)
 
 	// Audit log endpoints (admin only)
 	mux.Handle("GET /admin/v1/audit/logs", adminHandler)
@@ -6,6 +6,7 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 )
 
@@ -45,6 +46,15 @@ func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
 	return s.httpServer.ListenAndServeTLS(certFile, keyFile)
 }
 
+// ListenAndServeTLSConfig starts the HTTPS server with a TLS configuration
+// that supplies the certificate itself, e.g. through GetCertificate.
+//
+// @design DS-0301
+func (s *Server) ListenAndServeTLSConfig(tlsConfig *tls.Config) error {
+	s.httpServer.TLSConfig = tlsConfig
+	return s.httpServer.ListenAndServeTLS("", "")
+}
+
 // Shutdown gracefully shuts down the server.
 //
 // @design DS-0301
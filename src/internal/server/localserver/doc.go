@@ -5,6 +5,7 @@
 // authentication for localhost administrative operations:
 //
 //   - Server status and health checks
+//   - Prometheus metrics (used by tokmesh-cli top --socket)
 //   - Graceful shutdown
 //   - Configuration reload
 //   - Debug information
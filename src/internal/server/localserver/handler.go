@@ -1,21 +1,44 @@
 // Package localserver provides the local management server.
 package localserver
 
-import "io"
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
 
 // Handler handles local management commands.
-type Handler struct{}
+type Handler struct {
+	status  func() map[string]any
+	metrics prometheus.Gatherer
+}
 
 // NewHandler creates a new Handler.
 func NewHandler() *Handler {
 	return &Handler{}
 }
 
+// SetStatus sets the source of the "status" command's output, e.g. the
+// HTTP handler's status summary.
+func (h *Handler) SetStatus(status func() map[string]any) {
+	h.status = status
+}
+
+// SetMetricsGatherer serves the gatherer's metrics on the "metrics"
+// command.
+func (h *Handler) SetMetricsGatherer(g prometheus.Gatherer) {
+	h.metrics = g
+}
+
 // Execute executes a local management command.
 func (h *Handler) Execute(w io.Writer, cmd string, args []string) error {
 	switch cmd {
 	case "status":
 		return h.handleStatus(w)
+	case "metrics":
+		return h.handleMetrics(w)
 	case "shutdown":
 		return h.handleShutdown(w)
 	case "reload":
@@ -28,8 +51,31 @@ func (h *Handler) Execute(w io.Writer, cmd string, args []string) error {
 	}
 }
 
+// handleStatus writes the server status as a single line of JSON.
 func (h *Handler) handleStatus(w io.Writer) error {
-	// TODO: Return server status (uptime, connections, memory, etc.)
+	status := map[string]any{"status": "running"}
+	if h.status != nil {
+		status = h.status()
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+// handleMetrics writes the server metrics in Prometheus text format.
+func (h *Handler) handleMetrics(w io.Writer) error {
+	if h.metrics == nil {
+		_, err := w.Write([]byte("metrics not available\n"))
+		return err
+	}
+	families, err := h.metrics.Gather()
+	if err != nil {
+		return err
+	}
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
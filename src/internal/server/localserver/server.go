@@ -6,25 +6,38 @@
 package localserver
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// commandTimeout bounds reading a command and writing its response.
+const commandTimeout = 30 * time.Second
+
 // Server represents the local management server.
 type Server struct {
 	listener net.Listener
 	path     string
+	handler  *Handler
 	running  atomic.Bool
 	wg       sync.WaitGroup
 }
 
-// New creates a new local server.
-func New(socketPath string) *Server {
+// New creates a new local server executing commands with handler.
+func New(socketPath string, handler *Handler) *Server {
+	if handler == nil {
+		handler = NewHandler()
+	}
 	return &Server{
-		path: socketPath,
+		path:    socketPath,
+		handler: handler,
 	}
 }
 
@@ -32,11 +45,21 @@ func New(socketPath string) *Server {
 //
 // @req RQ-0303 § 3.2 - Local socket server lifecycle management
 func (s *Server) ListenAndServe() error {
+	// A socket left behind by a crashed server would fail the listen.
+	if fi, err := os.Lstat(s.path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(s.path)
+	}
+
 	var err error
 	s.listener, err = net.Listen("unix", s.path)
 	if err != nil {
 		return err
 	}
+	// Commands are not authenticated: only the owner may connect.
+	if err := os.Chmod(s.path, 0600); err != nil {
+		s.listener.Close()
+		return fmt.Errorf("chmod socket: %w", err)
+	}
 
 	s.running.Store(true)
 
@@ -98,7 +121,24 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	}
 }
 
+// handleConnection executes one command line, e.g. "status", writes its
+// response and closes the connection, so clients read to EOF.
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
-	// TODO: Read and handle commands
+	_ = conn.SetDeadline(time.Now().Add(commandTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	w := bufio.NewWriter(conn)
+	if err := s.handler.Execute(w, fields[0], fields[1:]); err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+	}
+	_ = w.Flush()
 }
@@ -0,0 +1,151 @@
+package localserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// startServer serves h on a socket in a temporary directory and returns
+// the socket path.
+func startServer(t *testing.T, h *Handler) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tokmesh.sock")
+	srv := New(path, h)
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		<-errCh
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return path
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("local server did not start listening")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// query sends cmd and reads the response to EOF.
+func query(t *testing.T, path, cmd string) string {
+	t.Helper()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return string(data)
+}
+
+func TestServer_Commands(t *testing.T) {
+	h := NewHandler()
+	h.SetStatus(func() map[string]any {
+		return map[string]any{"status": "running", "uptime_seconds": 42}
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test."}, func() float64 { return 7 }))
+	h.SetMetricsGatherer(registry)
+
+	path := startServer(t, h)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+
+	var status map[string]any
+	resp := query(t, path, "status")
+	if err := json.Unmarshal([]byte(resp), &status); err != nil {
+		t.Fatalf("status = %q: %v", resp, err)
+	}
+	if status["status"] != "running" || status["uptime_seconds"] != float64(42) {
+		t.Errorf("status = %v", status)
+	}
+
+	if resp := query(t, path, "metrics"); !strings.Contains(resp, "test_gauge 7") {
+		t.Errorf("metrics = %q", resp)
+	}
+
+	if resp := query(t, path, "bogus"); resp != "unknown command: bogus\n" {
+		t.Errorf("bogus = %q", resp)
+	}
+}
+
+func TestServer_RemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokmesh.sock")
+
+	// Leave a socket file behind, as a crashed server would.
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	srv := New(path, nil)
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if resp := tryQuery(path, "status"); strings.Contains(resp, "running") {
+			break
+		}
+		select {
+		case err := <-errCh:
+			t.Fatalf("ListenAndServe: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("local server did not start listening")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	<-errCh
+}
+
+// tryQuery is query without failing, for polling.
+func tryQuery(path, cmd string) string {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return ""
+	}
+	data, _ := io.ReadAll(conn)
+	return string(data)
+}
@@ -88,6 +88,12 @@ type CommandHandler struct {
 	authSvc     *service.AuthService
 	logger      *slog.Logger
 	rateLimiter *rateLimiter
+	srv         *Server // Client registry and stats; nil in tests
+	notify      *notifier
+
+	// txMu isolates EXEC: commands run under the read lock, EXEC under the
+	// write lock.
+	txMu sync.RWMutex
 }
 
 // NewCommandHandler creates a new CommandHandler.
@@ -101,13 +107,24 @@ func NewCommandHandler(sessionSvc *service.SessionService, tokenSvc *service.Tok
 		rl = newRateLimiter(srv.cfg.RateLimit)
 	}
 
-	return &CommandHandler{
+	var lookup func(id int64) (*Conn, bool)
+	if srv != nil {
+		lookup = srv.client
+	}
+
+	h := &CommandHandler{
 		sessionSvc:  sessionSvc,
 		tokenSvc:    tokenSvc,
 		authSvc:     authSvc,
 		logger:      logger,
 		rateLimiter: rl,
+		srv:         srv,
+		notify:      newNotifier(lookup),
 	}
+	if sessionSvc != nil {
+		sessionSvc.AddListener(h.notify.sessionEvents)
+	}
+	return h
 }
 
 // Handle handles a Redis command (RESP array of bulk strings).
@@ -118,18 +135,28 @@ func (h *CommandHandler) Handle(conn *Conn, args [][]byte) {
 	}
 
 	cmdName := normalizeCommandName(args[0])
+	conn.recordCommand(cmdName)
+	if h.srv != nil {
+		h.srv.totalCmds.Add(1)
+	}
+
+	// A RESP2 connection with subscriptions only carries pub/sub traffic.
+	if conn.subscriptions.Load() > 0 && conn.Protocol() < 3 && !subscribedModeCommand(cmdName) {
+		_ = WriteError(conn.bw, "ERR Can't execute '"+strings.ToLower(cmdName)+"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+		return
+	}
 
 	// Connection-level commands (do not require authentication).
+	// Inside MULTI only QUIT runs immediately; the others are queued.
 	switch cmdName {
-	case "PING":
-		h.handlePing(conn, args)
-		return
-	case "AUTH":
-		h.handleAuth(conn, args)
-		return
 	case "QUIT":
 		h.handleQuit(conn, args)
 		return
+	case "PING", "AUTH", "HELLO":
+		if conn.tx == nil {
+			h.execute(conn, cmdName, args)
+			return
+		}
 	}
 
 	// All other commands require authentication.
@@ -152,35 +179,104 @@ func (h *CommandHandler) Handle(conn *Conn, args [][]byte) {
 		}
 	}
 
+	// Transactions.
+	switch cmdName {
+	case "MULTI":
+		h.handleMulti(conn, args)
+		return
+	case "EXEC":
+		h.handleExec(conn, args)
+		return
+	case "DISCARD":
+		h.handleDiscard(conn, args)
+		return
+	}
+	if conn.tx != nil {
+		h.queueCommand(conn, state, cmdName, args)
+		return
+	}
+
 	// Check permissions based on command.
 	if !h.checkPermission(state, cmdName) {
 		_ = WriteError(conn.bw, "ERR TM-AUTH-4030 permission denied for command '"+cmdName+"'")
 		return
 	}
 
+	h.txMu.RLock()
+	defer h.txMu.RUnlock()
+	h.execute(conn, cmdName, args)
+}
+
+// execute runs a command that has passed authentication and permission
+// checks, writing exactly one reply.
+func (h *CommandHandler) execute(conn *Conn, cmdName string, args [][]byte) {
 	switch cmdName {
+	case "PING":
+		h.handlePing(conn, args)
+	case "AUTH":
+		h.handleAuth(conn, args)
+	case "HELLO":
+		h.handleHello(conn, args)
+	case "CLIENT":
+		h.handleClient(conn, args)
+	case "COMMAND":
+		h.handleCommand(conn, args)
+	case "INFO":
+		h.handleInfo(conn, args)
+	case "SUBSCRIBE":
+		h.handleSubscribe(conn, args, false)
+	case "PSUBSCRIBE":
+		h.handleSubscribe(conn, args, true)
+	case "UNSUBSCRIBE":
+		h.handleUnsubscribe(conn, args, false)
+	case "PUNSUBSCRIBE":
+		h.handleUnsubscribe(conn, args, true)
 	case "GET":
 		h.handleGet(conn, args)
 	case "SET":
 		h.handleSet(conn, args)
-	case "DEL":
+	case "DEL", "UNLINK":
 		h.handleDel(conn, args)
 	case "EXPIRE":
 		h.handleExpire(conn, args)
+	case "PEXPIRE":
+		h.expire(conn, args, time.Millisecond)
 	case "TTL":
 		h.handleTTL(conn, args)
+	case "PTTL":
+		h.ttl(conn, args, time.Millisecond)
 	case "EXISTS":
 		h.handleExists(conn, args)
 	case "SCAN":
 		h.handleScan(conn, args)
+	case "MGET":
+		h.handleMGet(conn, args)
+	case "SETEX", "PSETEX":
+		h.handleSetEx(conn, args)
+	case "GETEX":
+		h.handleGetEx(conn, args)
+	case "TYPE":
+		h.handleType(conn, args)
+	case "DBSIZE":
+		h.handleDBSize(conn, args)
 	case "TM.CREATE":
 		h.handleTMCreate(conn, args)
+	case "TM.GET":
+		h.handleTMGet(conn, args)
 	case "TM.VALIDATE":
 		h.handleTMValidate(conn, args)
+	case "TM.MVALIDATE":
+		h.handleTMMValidate(conn, args)
 	case "TM.TOUCH":
 		h.handleTMTouch(conn, args)
 	case "TM.REVOKE_USER":
 		h.handleTMRevokeUser(conn, args)
+	case "TM.HSET":
+		h.handleTMHSet(conn, args)
+	case "TM.HDEL":
+		h.handleTMHDel(conn, args)
+	case "TM.HGETALL":
+		h.handleTMHGetAll(conn, args)
 	default:
 		_ = WriteError(conn.bw, "ERR unknown command '"+cmdName+"'")
 	}
@@ -197,9 +293,12 @@ func (h *CommandHandler) checkPermission(state *ConnState, cmdName string) bool
 	}
 
 	switch cmdName {
-	case "GET", "TTL", "EXISTS", "SCAN", "TM.VALIDATE", "TM.TOUCH":
+	case "PING", "AUTH", "HELLO", "CLIENT", "COMMAND", "INFO":
+		// Connection management; CLIENT LIST/KILL check for admin themselves.
+		return true
+	case "GET", "MGET", "TTL", "PTTL", "EXISTS", "TYPE", "DBSIZE", "SCAN", "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "TM.GET", "TM.VALIDATE", "TM.MVALIDATE", "TM.TOUCH", "TM.HGETALL":
 		return role == "validator" || role == "issuer"
-	case "SET", "DEL", "EXPIRE", "TM.CREATE", "TM.REVOKE_USER":
+	case "SET", "SETEX", "PSETEX", "GETEX", "DEL", "UNLINK", "EXPIRE", "PEXPIRE", "TM.CREATE", "TM.REVOKE_USER", "TM.HSET", "TM.HDEL":
 		return role == "issuer"
 	default:
 		return false
@@ -207,6 +306,17 @@ func (h *CommandHandler) checkPermission(state *ConnState, cmdName string) bool
 }
 
 func (h *CommandHandler) handlePing(conn *Conn, args [][]byte) {
+	if conn.subscriptions.Load() > 0 && conn.Protocol() < 3 {
+		// Subscribed RESP2 clients get a message-shaped reply.
+		_ = WriteArrayHeader(conn.bw, 2)
+		_ = WriteBulkString(conn.bw, "pong")
+		if len(args) > 1 {
+			_ = WriteBulk(conn.bw, args[1])
+		} else {
+			_ = WriteBulkString(conn.bw, "")
+		}
+		return
+	}
 	if len(args) > 1 {
 		_ = WriteBulk(conn.bw, args[1])
 		return
@@ -236,32 +346,46 @@ func (h *CommandHandler) handleAuth(conn *Conn, args [][]byte) {
 		return
 	}
 
+	apiKey, ok := h.authenticate(keyID, keySecret)
+	if !ok {
+		_ = WriteError(conn.bw, "ERR TM-AUTH-4010 invalid credentials")
+		return
+	}
+
+	conn.UpdateState(func(st *ConnState) {
+		st.Authenticated = true
+		st.APIKey = apiKey
+	})
+
+	_ = WriteSimpleString(conn.bw, "OK")
+}
+
+// authenticate validates API key credentials for AUTH and HELLO.
+func (h *CommandHandler) authenticate(keyID, keySecret string) (*service.APIKeyInfo, bool) {
 	ctx := context.Background()
 	resp, err := h.authSvc.ValidateAPIKey(ctx, &service.ValidateAPIKeyRequest{
 		KeyID:     keyID,
 		KeySecret: keySecret,
 	})
 	if err != nil || !resp.Valid {
-		_ = WriteError(conn.bw, "ERR TM-AUTH-4010 invalid credentials")
-		return
+		return nil, false
 	}
+	return apiKeyInfo(resp.APIKey), true
+}
 
-	conn.SetState(ConnState{
-		Authenticated: true,
-		APIKey: &service.APIKeyInfo{
-			KeyID:   resp.APIKey.KeyID,
-			Role:    string(resp.APIKey.Role),
-			Name:    resp.APIKey.Name,
-			Enabled: resp.APIKey.IsActive(),
-		},
-	})
-
-	_ = WriteSimpleString(conn.bw, "OK")
+// apiKeyInfo converts an authenticated API key to connection state.
+func apiKeyInfo(key *domain.APIKey) *service.APIKeyInfo {
+	return &service.APIKeyInfo{
+		KeyID:   key.KeyID,
+		Role:    string(key.Role),
+		Name:    key.Name,
+		Enabled: key.IsActive(),
+	}
 }
 
 func (h *CommandHandler) handleQuit(conn *Conn, _ [][]byte) {
 	_ = WriteSimpleString(conn.bw, "OK")
-	_ = conn.bw.Flush()
+	_ = conn.Flush()
 	_ = conn.Close()
 }
 
@@ -272,8 +396,8 @@ func (h *CommandHandler) handleGet(conn *Conn, args [][]byte) {
 		return
 	}
 
-	sessionID := string(args[1])
-	ctx := context.Background()
+	sessionID := keySessionID(args[1])
+	ctx := conn.requestContext()
 	session, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID})
 	if err != nil {
 		if domain.IsDomainError(err, "TM-SESS-4040") || domain.IsDomainError(err, "TM-SESS-4041") {
@@ -283,7 +407,12 @@ func (h *CommandHandler) handleGet(conn *Conn, args [][]byte) {
 		_ = WriteError(conn.bw, formatRedisError(err))
 		return
 	}
+	h.notify.track(conn, session.ID)
+	writeKeyValue(conn, session)
+}
 
+// writeSessionJSON writes a session as the JSON bulk string GET returns.
+func writeSessionJSON(conn *Conn, session *domain.Session) {
 	data, err := json.Marshal(sessionToRedisResponse(session))
 	if err != nil {
 		_ = WriteError(conn.bw, "ERR failed to marshal session")
@@ -292,9 +421,42 @@ func (h *CommandHandler) handleGet(conn *Conn, args [][]byte) {
 	_ = WriteBulk(conn.bw, data)
 }
 
+// TM.GET <session_id>
+//
+// Returns a session as a native map under RESP3, so clients need no JSON
+// parsing; under RESP2 it replies like GET. Returns null if the session
+// does not exist.
+//
+// @design DS-0301
+func (h *CommandHandler) handleTMGet(conn *Conn, args [][]byte) {
+	if len(args) != 2 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TM.GET' command")
+		return
+	}
+	if conn.Protocol() < 3 {
+		h.handleGet(conn, args)
+		return
+	}
+
+	ctx := conn.requestContext()
+	session, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: string(args[1])})
+	if err != nil {
+		if domain.IsDomainError(err, "TM-SESS-4040") || domain.IsDomainError(err, "TM-SESS-4041") {
+			conn.writeNull()
+			return
+		}
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	h.notify.track(conn, session.ID)
+	conn.writeSessionMap(session)
+}
+
 // SET <key> <value> [EX seconds]
 //
-// Creates or updates a session. The value must be a JSON object.
+// Creates or updates a session, given a session ID key and a JSON object
+// with the session fields. Under any other key, the value is stored as an
+// opaque string (see values.go).
 //
 // Token handling policy:
 //   - CREATE (key does not exist): token field is REQUIRED
@@ -316,23 +478,31 @@ func (h *CommandHandler) handleSet(conn *Conn, args [][]byte) {
 			return
 		}
 		opt := strings.ToUpper(string(args[i]))
-		if opt == "EX" {
-			seconds, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if opt == "EX" || opt == "PX" {
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
 			if err != nil {
 				_ = WriteError(conn.bw, "ERR value is not an integer or out of range")
 				return
 			}
-			ttl = time.Duration(seconds) * time.Second
+			ttl = time.Duration(n) * time.Second
+			if opt == "PX" {
+				ttl = time.Duration(n) * time.Millisecond
+			}
 		}
 	}
 
+	if !isSessionKey(sessionID) {
+		h.setValue(conn, sessionID, args[2], ttl)
+		return
+	}
+
 	var reqData sessionSetRequest
 	if err := json.Unmarshal([]byte(jsonValue), &reqData); err != nil {
 		_ = WriteError(conn.bw, "ERR invalid JSON value")
 		return
 	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 
 	existing, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID})
 	if err != nil && !domain.IsDomainError(err, "TM-SESS-4040") {
@@ -395,19 +565,20 @@ func (h *CommandHandler) handleSet(conn *Conn, args [][]byte) {
 
 // DEL <key> ...
 func (h *CommandHandler) handleDel(conn *Conn, args [][]byte) {
+	name := commandName(args, "DEL")
 	if len(args) < 2 {
-		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'DEL' command")
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for '"+name+"' command")
 		return
 	}
-	if len(args) > 1001 {
-		_ = WriteError(conn.bw, "ERR TM-ARG-4002 maximum 1000 keys per DEL command")
+	if len(args) > MaxKeysPerCommand+1 {
+		_ = WriteError(conn.bw, "ERR TM-ARG-4002 maximum "+strconv.Itoa(MaxKeysPerCommand)+" keys per "+name+" command")
 		return
 	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 	deleted := 0
 	for i := 1; i < len(args); i++ {
-		sessionID := string(args[i])
+		sessionID := keySessionID(args[i])
 		_, err := h.sessionSvc.Revoke(ctx, &service.RevokeSessionRequest{SessionID: sessionID})
 		if err == nil {
 			deleted++
@@ -419,22 +590,32 @@ func (h *CommandHandler) handleDel(conn *Conn, args [][]byte) {
 
 // EXPIRE <key> <seconds>
 func (h *CommandHandler) handleExpire(conn *Conn, args [][]byte) {
+	h.expire(conn, args, time.Second)
+}
+
+// expire implements EXPIRE and PEXPIRE, whose TTL argument counts units.
+// Like Redis, a non-positive TTL deletes the session.
+func (h *CommandHandler) expire(conn *Conn, args [][]byte, unit time.Duration) {
 	if len(args) != 3 {
-		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'EXPIRE' command")
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for '"+commandName(args, "EXPIRE")+"' command")
 		return
 	}
 
-	sessionID := string(args[1])
-	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	sessionID := keySessionID(args[1])
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
 	if err != nil {
 		_ = WriteError(conn.bw, "ERR value is not an integer or out of range")
 		return
 	}
+	if n <= 0 {
+		h.expireNow(conn, sessionID)
+		return
+	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 	_, err = h.sessionSvc.Renew(ctx, &service.RenewSessionRequest{
 		SessionID: sessionID,
-		TTL:       time.Duration(seconds) * time.Second,
+		TTL:       time.Duration(n) * unit,
 	})
 	if err != nil {
 		if domain.IsDomainError(err, "TM-SESS-4040") {
@@ -455,13 +636,18 @@ func (h *CommandHandler) handleExpire(conn *Conn, args [][]byte) {
 //   - -1 if the key exists but has no associated expire (no TTL set)
 //   - Positive integer: remaining seconds until expiration
 func (h *CommandHandler) handleTTL(conn *Conn, args [][]byte) {
+	h.ttl(conn, args, time.Second)
+}
+
+// ttl implements TTL and PTTL, replying in units.
+func (h *CommandHandler) ttl(conn *Conn, args [][]byte, unit time.Duration) {
 	if len(args) != 2 {
-		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TTL' command")
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for '"+commandName(args, "TTL")+"' command")
 		return
 	}
 
-	sessionID := string(args[1])
-	ctx := context.Background()
+	sessionID := keySessionID(args[1])
+	ctx := conn.requestContext()
 	session, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID})
 	if err != nil {
 		if domain.IsDomainError(err, "TM-SESS-4040") {
@@ -471,6 +657,7 @@ func (h *CommandHandler) handleTTL(conn *Conn, args [][]byte) {
 		_ = WriteError(conn.bw, formatRedisError(err))
 		return
 	}
+	h.notify.track(conn, session.ID)
 
 	// ExpiresAt == 0 means no expiration set
 	if session.ExpiresAt == 0 {
@@ -484,7 +671,7 @@ func (h *CommandHandler) handleTTL(conn *Conn, args [][]byte) {
 		_ = WriteInteger(conn.bw, -2)
 		return
 	}
-	_ = WriteInteger(conn.bw, int64(remaining.Seconds()))
+	_ = WriteInteger(conn.bw, int64(remaining/unit))
 }
 
 // EXISTS <key> [key ...]
@@ -494,13 +681,14 @@ func (h *CommandHandler) handleExists(conn *Conn, args [][]byte) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 	count := 0
 	for i := 1; i < len(args); i++ {
-		sessionID := string(args[i])
+		sessionID := keySessionID(args[i])
 		_, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID})
 		if err == nil {
 			count++
+			h.notify.track(conn, sessionID)
 		}
 	}
 	_ = WriteInteger(conn.bw, int64(count))
@@ -540,7 +728,7 @@ func (h *CommandHandler) handleScan(conn *Conn, args [][]byte) {
 		}
 	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 	filter := &service.SessionFilter{
 		Page:     int(cursor) + 1,
 		PageSize: count,
@@ -552,15 +740,12 @@ func (h *CommandHandler) handleScan(conn *Conn, args [][]byte) {
 	}
 
 	// Filter by MATCH pattern if specified
-	var filteredItems []*domain.Session
-	if pattern != "" && pattern != "*" {
-		for _, item := range resp.Items {
-			if matchGlob(pattern, item.ID) {
-				filteredItems = append(filteredItems, item)
-			}
+	var keys []string
+	for _, item := range resp.Items {
+		key := sessionKey(item)
+		if pattern == "" || pattern == "*" || matchGlob(pattern, key) {
+			keys = append(keys, key)
 		}
-	} else {
-		filteredItems = resp.Items
 	}
 
 	nextCursor := "0"
@@ -570,9 +755,9 @@ func (h *CommandHandler) handleScan(conn *Conn, args [][]byte) {
 
 	_ = WriteArrayHeader(conn.bw, 2)
 	_ = WriteBulkString(conn.bw, nextCursor)
-	_ = WriteArrayHeader(conn.bw, len(filteredItems))
-	for _, item := range filteredItems {
-		_ = WriteBulkString(conn.bw, item.ID)
+	_ = WriteArrayHeader(conn.bw, len(keys))
+	for _, key := range keys {
+		_ = WriteBulkString(conn.bw, key)
 	}
 }
 
@@ -640,6 +825,10 @@ func matchGlob(pattern, s string) bool {
 }
 
 // TM.CREATE <key> <value> [TTL seconds]
+//
+// Returns {session_id, token, expires_at}: a JSON bulk string with an
+// RFC 3339 expires_at under RESP2, a native map with expires_at in Unix
+// milliseconds under RESP3.
 func (h *CommandHandler) handleTMCreate(conn *Conn, args [][]byte) {
 	if len(args) < 3 {
 		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TM.CREATE' command")
@@ -648,6 +837,10 @@ func (h *CommandHandler) handleTMCreate(conn *Conn, args [][]byte) {
 
 	sessionID := string(args[1])
 	jsonValue := string(args[2])
+	if !strings.HasPrefix(strings.ToLower(sessionID), domain.SessionIDPrefix) {
+		_ = WriteError(conn.bw, "ERR TM-ARG-4001 TM.CREATE keys must be TokMesh session IDs ("+domain.SessionIDPrefix+"...)")
+		return
+	}
 
 	ttl := 24 * time.Hour
 	if len(args) >= 5 && strings.ToUpper(string(args[3])) == "TTL" {
@@ -665,7 +858,7 @@ func (h *CommandHandler) handleTMCreate(conn *Conn, args [][]byte) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 	resp, err := h.sessionSvc.CreateWithID(ctx, &service.CreateSessionWithIDRequest{
 		SessionID: sessionID,
 		UserID:    reqData.UserID,
@@ -678,6 +871,17 @@ func (h *CommandHandler) handleTMCreate(conn *Conn, args [][]byte) {
 		return
 	}
 
+	if conn.Protocol() >= 3 {
+		conn.writeMapHeader(3)
+		_ = WriteBulkString(conn.bw, "session_id")
+		_ = WriteBulkString(conn.bw, resp.SessionID)
+		_ = WriteBulkString(conn.bw, "token")
+		_ = WriteBulkString(conn.bw, resp.Token)
+		_ = WriteBulkString(conn.bw, "expires_at")
+		_ = WriteInteger(conn.bw, resp.ExpiresAt)
+		return
+	}
+
 	result := map[string]any{
 		"session_id": resp.SessionID,
 		"token":      resp.Token,
@@ -695,7 +899,8 @@ func (h *CommandHandler) handleTMCreate(conn *Conn, args [][]byte) {
 //
 // Validates a token and optionally updates the session's last_active timestamp.
 // Returns:
-//   - "OK" if the token is valid
+//   - "OK" if the token is valid (RESP2)
+//   - The session as a map if the token is valid (RESP3)
 //   - Error if the token is invalid or expired
 //
 // When TOUCH is specified, the session's last_active timestamp is updated.
@@ -721,7 +926,7 @@ func (h *CommandHandler) handleTMValidate(conn *Conn, args [][]byte) {
 		}
 	}
 
-	ctx := context.Background()
+	ctx := conn.requestContext()
 
 	// Extract client IP from connection
 	clientIP := conn.RemoteAddr().String()
@@ -738,10 +943,78 @@ func (h *CommandHandler) handleTMValidate(conn *Conn, args [][]byte) {
 		_ = WriteError(conn.bw, "ERR TM-TOKN-4010 Token invalid")
 		return
 	}
+	if resp.Session != nil {
+		h.notify.track(conn, resp.Session.ID)
+	}
 
+	if conn.Protocol() >= 3 {
+		conn.writeSessionMap(resp.Session)
+		return
+	}
 	_ = WriteSimpleString(conn.bw, "OK")
 }
 
+// TM.MVALIDATE <token> [<token> ...] [TOUCH]
+//
+// Validates up to service.MaxBatchSize tokens in one round trip.
+// Returns an array with one reply per token, in order:
+//   - "OK" if the token is valid (RESP2), or its session as a map (RESP3)
+//   - An error reply if the token is invalid or expired
+//
+// When TOUCH is specified, all touch updates are persisted together.
+//
+// @design DS-0301
+func (h *CommandHandler) handleTMMValidate(conn *Conn, args [][]byte) {
+	tokens := args[1:]
+	touch := false
+	if n := len(tokens); n > 0 && strings.ToUpper(string(tokens[n-1])) == "TOUCH" {
+		touch = true
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) == 0 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TM.MVALIDATE' command")
+		return
+	}
+
+	// Extract client IP from connection
+	clientIP := conn.RemoteAddr().String()
+	if idx := strings.LastIndex(clientIP, ":"); idx != -1 {
+		clientIP = clientIP[:idx]
+	}
+
+	reqs := make([]*service.ValidateTokenRequest, len(tokens))
+	for i, token := range tokens {
+		reqs[i] = &service.ValidateTokenRequest{
+			Token:    string(token),
+			Touch:    touch,
+			ClientIP: clientIP,
+		}
+	}
+
+	ctx := conn.requestContext()
+	results, err := h.tokenSvc.ValidateBatch(ctx, reqs)
+	if err != nil {
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+
+	_ = WriteArrayHeader(conn.bw, len(results))
+	for _, result := range results {
+		if result.Err != nil || !result.Response.Valid {
+			_ = WriteError(conn.bw, "ERR TM-TOKN-4010 Token invalid")
+			continue
+		}
+		if result.Response.Session != nil {
+			h.notify.track(conn, result.Response.Session.ID)
+		}
+		if conn.Protocol() >= 3 {
+			conn.writeSessionMap(result.Response.Session)
+			continue
+		}
+		_ = WriteSimpleString(conn.bw, "OK")
+	}
+}
+
 // TM.TOUCH <session_id>
 //
 // Updates the last_active timestamp of a session without extending the TTL.
@@ -757,7 +1030,7 @@ func (h *CommandHandler) handleTMTouch(conn *Conn, args [][]byte) {
 	}
 
 	sessionID := string(args[1])
-	ctx := context.Background()
+	ctx := conn.requestContext()
 
 	// Extract client IP from connection
 	clientIP := conn.RemoteAddr().String()
@@ -789,7 +1062,7 @@ func (h *CommandHandler) handleTMRevokeUser(conn *Conn, args [][]byte) {
 	}
 
 	userID := string(args[1])
-	ctx := context.Background()
+	ctx := conn.requestContext()
 
 	resp, err := h.sessionSvc.RevokeByUser(ctx, &service.RevokeByUserRequest{UserID: userID})
 	if err != nil {
@@ -799,6 +1072,100 @@ func (h *CommandHandler) handleTMRevokeUser(conn *Conn, args [][]byte) {
 	_ = WriteInteger(conn.bw, int64(resp.RevokedCount))
 }
 
+// TM.HSET <session_id> <field> <value> [<field> <value> ...]
+//
+// Sets individual Data fields of a session without replacing the rest.
+// Returns the number of fields that were added (not updated).
+//
+// @design DS-0301
+func (h *CommandHandler) handleTMHSet(conn *Conn, args [][]byte) {
+	if len(args) < 4 || len(args)%2 != 0 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TM.HSET' command")
+		return
+	}
+
+	patch := make(map[string]*string, (len(args)-2)/2)
+	for i := 2; i < len(args); i += 2 {
+		value := string(args[i+1])
+		patch[string(args[i])] = &value
+	}
+
+	resp, ok := h.patchSessionData(conn, string(args[1]), patch)
+	if !ok {
+		return
+	}
+	_ = WriteInteger(conn.bw, int64(resp.DataAdded))
+}
+
+// TM.HDEL <session_id> <field> [<field> ...]
+//
+// Removes individual Data fields of a session.
+// Returns the number of fields that were removed.
+//
+// @design DS-0301
+func (h *CommandHandler) handleTMHDel(conn *Conn, args [][]byte) {
+	if len(args) < 3 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TM.HDEL' command")
+		return
+	}
+
+	patch := make(map[string]*string, len(args)-2)
+	for _, field := range args[2:] {
+		patch[string(field)] = nil
+	}
+
+	resp, ok := h.patchSessionData(conn, string(args[1]), patch)
+	if !ok {
+		return
+	}
+	_ = WriteInteger(conn.bw, int64(resp.DataRemoved))
+}
+
+// patchSessionData applies a Data merge patch and writes any error reply.
+func (h *CommandHandler) patchSessionData(conn *Conn, sessionID string, patch map[string]*string) (*service.PatchSessionResponse, bool) {
+	ctx := conn.requestContext()
+	resp, err := h.sessionSvc.Patch(ctx, &service.PatchSessionRequest{
+		SessionID: sessionID,
+		Data:      patch,
+	})
+	if err != nil {
+		if domain.IsDomainError(err, "TM-SESS-4040") || domain.IsDomainError(err, "TM-SESS-4041") {
+			_ = WriteError(conn.bw, "ERR TM-SESS-4040 Session not found")
+			return nil, false
+		}
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return nil, false
+	}
+	return resp, true
+}
+
+// TM.HGETALL <session_id>
+//
+// Returns the Data fields of a session as a map (a flat field/value array
+// under RESP2), or an empty map if the session does not exist.
+//
+// @design DS-0301
+func (h *CommandHandler) handleTMHGetAll(conn *Conn, args [][]byte) {
+	if len(args) != 2 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TM.HGETALL' command")
+		return
+	}
+
+	ctx := conn.requestContext()
+	session, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: string(args[1])})
+	if err != nil {
+		if domain.IsDomainError(err, "TM-SESS-4040") || domain.IsDomainError(err, "TM-SESS-4041") {
+			conn.writeMapHeader(0)
+			return
+		}
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	h.notify.track(conn, session.ID)
+
+	conn.writeStringMap(session.Data)
+}
+
 // sessionSetRequest represents the JSON structure for SET/TM.CREATE commands.
 type sessionSetRequest struct {
 	UserID   string            `json:"user_id,omitempty"`
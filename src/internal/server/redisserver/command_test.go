@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -487,7 +488,7 @@ func TestCommandHandler_Set_InvalidJSON(t *testing.T) {
 	tc := newTestConn()
 	defer tc.Close()
 
-	args := [][]byte{[]byte("SET"), []byte("session-id"), []byte("invalid-json")}
+	args := [][]byte{[]byte("SET"), []byte("tmss-session-id"), []byte("invalid-json")}
 	h.handleSet(tc.Conn, args)
 
 	output := tc.FlushAndGetOutput()
@@ -550,6 +551,40 @@ func TestCommandHandler_Set_WithEX(t *testing.T) {
 	}
 }
 
+func TestCommandHandler_Set_OpaqueValue(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	// Values over MaxDataValueLength span fields; binary ones are encoded
+	values := map[string]string{
+		"sess:json":  `{"cookie":{"path":"/"},"userId":"alice"}`,
+		"sess:large": strings.Repeat("x", 2*domain.MaxDataValueLength+1),
+		":1:binary":  "\x80\x05\x95\x00\xff}\x94.",
+		"sess:empty": "",
+	}
+	for key, value := range values {
+		tc.Reset()
+		h.handleSet(tc.Conn, [][]byte{[]byte("SET"), []byte(key), []byte(value), []byte("EX"), []byte("60")})
+		if output := tc.FlushAndGetOutput(); output != "+OK\r\n" {
+			t.Fatalf("SET %s response = %q, want +OK\r\n", key, output)
+		}
+
+		tc.Reset()
+		h.handleGet(tc.Conn, [][]byte{[]byte("GET"), []byte(key)})
+		want := fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+		if output := tc.FlushAndGetOutput(); output != want {
+			t.Errorf("GET %s = %q, want %q", key, output, want)
+		}
+	}
+
+	tc.Reset()
+	h.handleGet(tc.Conn, [][]byte{[]byte("GET"), []byte("sess:missing")})
+	if output := tc.FlushAndGetOutput(); output != "$-1\r\n" {
+		t.Errorf("GET missing = %q, want $-1\r\n", output)
+	}
+}
+
 func TestCommandHandler_Set_Update(t *testing.T) {
 	h, _ := newTestCommandHandlerWithSession()
 	tc := newTestConn()
@@ -1029,6 +1064,29 @@ func TestCommandHandler_TMCreate_Success(t *testing.T) {
 	}
 }
 
+func TestCommandHandler_TMCreate_KeyDurability(t *testing.T) {
+	sessionRepo := newMockSessionRepo()
+	tokenSvc := service.NewTokenService(newMockTokenRepo(), nil)
+	sessionSvc := service.NewSessionService(sessionRepo, tokenSvc)
+	h := NewCommandHandler(sessionSvc, tokenSvc, service.NewAuthService(newMockAPIKeyRepo(), nil), nil, nil)
+	tc := newTestConn()
+	defer tc.Close()
+	tc.SetState(ConnState{
+		Authenticated: true,
+		APIKey:        &service.APIKeyInfo{KeyID: "test-key-id", Role: string(domain.RoleIssuer), Durability: string(domain.DurabilityFsync), Enabled: true},
+	})
+
+	args := [][]byte{[]byte("TM.CREATE"), []byte("tmss-01ARZ3NDEKTSV4RRFFQ69G5FAY"), []byte(`{"user_id":"user123"}`)}
+	h.handleTMCreate(tc.Conn, args)
+
+	if output := tc.FlushAndGetOutput(); !strings.HasPrefix(output, "$") {
+		t.Fatalf("TM.CREATE = %q", output)
+	}
+	if sessionRepo.durability != domain.DurabilityFsync {
+		t.Errorf("durability = %q, want the API key's %q", sessionRepo.durability, domain.DurabilityFsync)
+	}
+}
+
 func TestCommandHandler_TMCreate_WithTTL(t *testing.T) {
 	h, _ := newTestCommandHandler()
 	tc := newTestConn()
@@ -1201,6 +1259,78 @@ func TestCommandHandler_TMValidate_TouchCaseInsensitive(t *testing.T) {
 	}
 }
 
+// ============================================================
+// Test: TM.MVALIDATE command
+// ============================================================
+
+func TestCommandHandler_TMMValidate_WrongArgs(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	h.handleTMMValidate(tc.Conn, [][]byte{[]byte("TM.MVALIDATE"), []byte("TOUCH")})
+
+	output := tc.FlushAndGetOutput()
+	if !strings.Contains(output, "wrong number of arguments") {
+		t.Errorf("expected wrong arguments error, got %q", output)
+	}
+}
+
+func TestCommandHandler_TMMValidate_TooMany(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	args := [][]byte{[]byte("TM.MVALIDATE")}
+	for i := 0; i <= service.MaxBatchSize; i++ {
+		args = append(args, []byte("tmtk_x"))
+	}
+	h.handleTMMValidate(tc.Conn, args)
+
+	output := tc.FlushAndGetOutput()
+	if !strings.Contains(output, "TM-ARG-1001") {
+		t.Errorf("expected batch size error, got %q", output)
+	}
+}
+
+func TestCommandHandler_TMMValidate_Mixed(t *testing.T) {
+	sessionRepo := newMockSessionRepo()
+	tokenRepo := newMockTokenRepo()
+	apiKeyRepo := newMockAPIKeyRepo()
+
+	tokenSvc := service.NewTokenService(tokenRepo, nil)
+	plainToken, tokenHash, _ := tokenSvc.GenerateToken()
+
+	session := &domain.Session{
+		ID:         "tmss-test-mvalidate",
+		UserID:     "user123",
+		TokenHash:  tokenHash,
+		CreatedAt:  time.Now().UnixMilli(),
+		LastActive: time.Now().Add(-time.Hour).UnixMilli(),
+		ExpiresAt:  time.Now().Add(time.Hour).UnixMilli(),
+		Version:    1,
+	}
+	ctx := context.Background()
+	sessionRepo.Create(ctx, session)
+	tokenRepo.sessions[tokenHash] = session
+
+	sessionSvc := service.NewSessionService(sessionRepo, tokenSvc)
+	authSvc := service.NewAuthService(apiKeyRepo, nil)
+
+	h := NewCommandHandler(sessionSvc, tokenSvc, authSvc, nil, nil)
+	tc := newTestConn()
+	defer tc.Close()
+
+	args := [][]byte{[]byte("TM.MVALIDATE"), []byte(plainToken), []byte("invalid-token"), []byte(plainToken), []byte("touch")}
+	h.handleTMMValidate(tc.Conn, args)
+
+	output := tc.FlushAndGetOutput()
+	want := "*3\r\n+OK\r\n-ERR TM-TOKN-4010 Token invalid\r\n+OK\r\n"
+	if output != want {
+		t.Errorf("TM.MVALIDATE response = %q, want %q", output, want)
+	}
+}
+
 // ============================================================
 // Test: TM.TOUCH command
 // ============================================================
@@ -1349,6 +1479,128 @@ func TestCommandHandler_TMTouch_Permission(t *testing.T) {
 // Test: TM.REVOKE_USER command
 // ============================================================
 
+// ============================================================
+// Test: TM.HSET / TM.HDEL / TM.HGETALL commands
+// ============================================================
+
+func TestCommandHandler_TMHSet_WrongArgs(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	args := [][]byte{[]byte("TM.HSET"), []byte("session-id"), []byte("field")}
+	h.handleTMHSet(tc.Conn, args)
+
+	output := tc.FlushAndGetOutput()
+	if !strings.Contains(output, "wrong number of arguments") {
+		t.Errorf("expected wrong arguments error, got %q", output)
+	}
+}
+
+func TestCommandHandler_TMHSet_NotFound(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	args := [][]byte{[]byte("TM.HSET"), []byte("non-existent-session"), []byte("f"), []byte("v")}
+	h.handleTMHSet(tc.Conn, args)
+
+	output := tc.FlushAndGetOutput()
+	if !strings.Contains(output, "TM-SESS-4040") {
+		t.Errorf("expected session not found error, got %q", output)
+	}
+}
+
+func TestCommandHandler_TMHashFields(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+
+	// Two new fields
+	h.handleTMHSet(tc.Conn, [][]byte{
+		[]byte("TM.HSET"), []byte("tmss-test-session-id"),
+		[]byte("role"), []byte("user"), []byte("theme"), []byte("dark"),
+	})
+	if output := tc.FlushAndGetOutput(); output != ":2\r\n" {
+		t.Errorf("TM.HSET response = %q, want :2\\r\\n", output)
+	}
+	tc.Reset()
+
+	// One update, no new fields
+	h.handleTMHSet(tc.Conn, [][]byte{
+		[]byte("TM.HSET"), []byte("tmss-test-session-id"), []byte("role"), []byte("admin"),
+	})
+	if output := tc.FlushAndGetOutput(); output != ":0\r\n" {
+		t.Errorf("TM.HSET update response = %q, want :0\\r\\n", output)
+	}
+	tc.Reset()
+
+	h.handleTMHGetAll(tc.Conn, [][]byte{[]byte("TM.HGETALL"), []byte("tmss-test-session-id")})
+	want := "*4\r\n$4\r\nrole\r\n$5\r\nadmin\r\n$5\r\ntheme\r\n$4\r\ndark\r\n"
+	if output := tc.FlushAndGetOutput(); output != want {
+		t.Errorf("TM.HGETALL response = %q, want %q", output, want)
+	}
+	tc.Reset()
+
+	// One existing and one missing field
+	h.handleTMHDel(tc.Conn, [][]byte{
+		[]byte("TM.HDEL"), []byte("tmss-test-session-id"), []byte("theme"), []byte("missing"),
+	})
+	if output := tc.FlushAndGetOutput(); output != ":1\r\n" {
+		t.Errorf("TM.HDEL response = %q, want :1\\r\\n", output)
+	}
+	tc.Reset()
+
+	h.handleTMHGetAll(tc.Conn, [][]byte{[]byte("TM.HGETALL"), []byte("tmss-test-session-id")})
+	want = "*2\r\n$4\r\nrole\r\n$5\r\nadmin\r\n"
+	if output := tc.FlushAndGetOutput(); output != want {
+		t.Errorf("TM.HGETALL response = %q, want %q", output, want)
+	}
+}
+
+func TestCommandHandler_TMHSet_DataTooLarge(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+
+	big := []byte(strings.Repeat("x", domain.MaxDataValueLength))
+	args := [][]byte{[]byte("TM.HSET"), []byte("tmss-test-session-id")}
+	for i := 0; i < 5; i++ {
+		args = append(args, []byte(fmt.Sprintf("k%d", i)), big)
+	}
+	h.handleTMHSet(tc.Conn, args)
+
+	output := tc.FlushAndGetOutput()
+	if !strings.Contains(output, "TM-SESS-4001") {
+		t.Errorf("expected validation error, got %q", output)
+	}
+}
+
+func TestCommandHandler_TMHGetAll_NotFound(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	h.handleTMHGetAll(tc.Conn, [][]byte{[]byte("TM.HGETALL"), []byte("non-existent-session")})
+
+	if output := tc.FlushAndGetOutput(); output != "*0\r\n" {
+		t.Errorf("TM.HGETALL response = %q, want *0\\r\\n", output)
+	}
+}
+
+func TestCommandHandler_TMHDel_WrongArgs(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+
+	h.handleTMHDel(tc.Conn, [][]byte{[]byte("TM.HDEL"), []byte("session-id")})
+
+	output := tc.FlushAndGetOutput()
+	if !strings.Contains(output, "wrong number of arguments") {
+		t.Errorf("expected wrong arguments error, got %q", output)
+	}
+}
+
 func TestCommandHandler_TMRevokeUser_WrongArgs(t *testing.T) {
 	h, _ := newTestCommandHandler()
 	tc := newTestConn()
@@ -1479,3 +1731,682 @@ func newTestCommandHandlerWithSession() (*CommandHandler, *service.AuthService)
 	h := NewCommandHandler(sessionSvc, tokenSvc, authSvc, nil, nil)
 	return h, authSvc
 }
+
+// ============================================================
+// Test: RESP3 (HELLO, CLIENT, COMMAND, INFO, typed replies)
+// ============================================================
+
+func TestCommandHandler_Hello(t *testing.T) {
+	h, authSvc := newTestCommandHandler()
+	key, err := authSvc.CreateAPIKey(context.Background(), &service.CreateAPIKeyRequest{
+		Name: "hello-key",
+		Role: string(domain.RoleValidator),
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	t.Run("requires authentication", func(t *testing.T) {
+		tc := newTestConn()
+		defer tc.Close()
+		h.Handle(tc.Conn, [][]byte{[]byte("HELLO"), []byte("3")})
+		if out := tc.FlushAndGetOutput(); !strings.HasPrefix(out, "-NOAUTH") {
+			t.Errorf("HELLO without auth = %q, want NOAUTH", out)
+		}
+		if tc.Protocol() != 2 {
+			t.Error("protocol must not change on failure")
+		}
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		tc := newTestConn()
+		defer tc.Close()
+		h.Handle(tc.Conn, [][]byte{[]byte("HELLO"), []byte("4")})
+		if out := tc.FlushAndGetOutput(); !strings.HasPrefix(out, "-NOPROTO") {
+			t.Errorf("HELLO 4 = %q, want NOPROTO", out)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		tc := newTestConn()
+		defer tc.Close()
+		h.Handle(tc.Conn, [][]byte{[]byte("HELLO"), []byte("3"), []byte("AUTH"), []byte(key.KeyID), []byte("wrong")})
+		if out := tc.FlushAndGetOutput(); !strings.Contains(out, "TM-AUTH-4010") {
+			t.Errorf("HELLO with bad AUTH = %q", out)
+		}
+		if tc.GetState().Authenticated || tc.Protocol() != 2 {
+			t.Error("failed HELLO must not authenticate or switch protocol")
+		}
+	})
+
+	t.Run("AUTH and SETNAME", func(t *testing.T) {
+		tc := newTestConn()
+		defer tc.Close()
+		h.Handle(tc.Conn, [][]byte{
+			[]byte("hello"), []byte("3"),
+			[]byte("AUTH"), []byte("default"), []byte(key.KeyID + ":" + key.Secret),
+			[]byte("SETNAME"), []byte("billing-api"),
+		})
+		out := tc.FlushAndGetOutput()
+		if !strings.HasPrefix(out, "%7\r\n$6\r\nserver\r\n$7\r\ntokmesh\r\n") || !strings.Contains(out, "$5\r\nproto\r\n:3\r\n") {
+			t.Errorf("HELLO reply = %q", out)
+		}
+		st := tc.GetState()
+		if !st.Authenticated || st.APIKey.KeyID != key.KeyID || st.ClientName != "billing-api" {
+			t.Errorf("state = %+v", st)
+		}
+		if tc.Protocol() != 3 {
+			t.Errorf("Protocol() = %d, want 3", tc.Protocol())
+		}
+
+		// Downgrade keeps the authentication
+		tc.Reset()
+		h.Handle(tc.Conn, [][]byte{[]byte("HELLO"), []byte("2")})
+		if out := tc.FlushAndGetOutput(); !strings.HasPrefix(out, "*14\r\n") {
+			t.Errorf("HELLO 2 reply = %q, want flat array", out)
+		}
+		if tc.Protocol() != 2 || !tc.GetState().Authenticated {
+			t.Error("HELLO 2 should switch back to RESP2 and stay authenticated")
+		}
+	})
+}
+
+func TestCommandHandler_TypedSessionReplies(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	tc.proto.Store(3)
+
+	session, err := h.sessionSvc.Get(context.Background(), &service.GetSessionRequest{SessionID: "tmss-test-session-id"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	h.Handle(tc.Conn, [][]byte{[]byte("TM.GET"), []byte("tmss-test-session-id")})
+	out := tc.FlushAndGetOutput()
+	if !strings.HasPrefix(out, "%11\r\n$2\r\nid\r\n$20\r\ntmss-test-session-id\r\n") {
+		t.Errorf("TM.GET reply = %q", out)
+	}
+	if want := fmt.Sprintf("$10\r\nexpires_at\r\n:%d\r\n", session.ExpiresAt); !strings.Contains(out, want) {
+		t.Errorf("TM.GET reply = %q, want native expires_at %q", out, want)
+	}
+	if !strings.HasSuffix(out, "$4\r\ndata\r\n%0\r\n") {
+		t.Errorf("TM.GET reply = %q, want empty data map", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("TM.GET"), []byte("tmss-missing")})
+	if out := tc.FlushAndGetOutput(); out != "_\r\n" {
+		t.Errorf("TM.GET missing = %q, want RESP3 null", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("TM.HGETALL"), []byte("tmss-missing")})
+	if out := tc.FlushAndGetOutput(); out != "%0\r\n" {
+		t.Errorf("TM.HGETALL missing = %q, want empty map", out)
+	}
+
+	// RESP2 TM.GET behaves like GET
+	tc.Reset()
+	tc.proto.Store(2)
+	h.Handle(tc.Conn, [][]byte{[]byte("TM.GET"), []byte("tmss-test-session-id")})
+	if out := tc.FlushAndGetOutput(); !strings.HasPrefix(out, "$") || !strings.Contains(out, `"id":"tmss-test-session-id"`) {
+		t.Errorf("RESP2 TM.GET = %q, want JSON bulk", out)
+	}
+}
+
+func TestCommandHandler_TMValidate_RESP3(t *testing.T) {
+	sessionRepo := newMockSessionRepo()
+	tokenRepo := newMockTokenRepo()
+	tokenSvc := service.NewTokenService(tokenRepo, nil)
+	plainToken, tokenHash, _ := tokenSvc.GenerateToken()
+
+	session := &domain.Session{
+		ID:         "tmss-resp3",
+		UserID:     "user123",
+		TokenHash:  tokenHash,
+		CreatedAt:  time.Now().UnixMilli(),
+		LastActive: time.Now().UnixMilli(),
+		ExpiresAt:  time.Now().Add(time.Hour).UnixMilli(),
+		Data:       map[string]string{"role": "admin"},
+		Version:    1,
+	}
+	sessionRepo.Create(context.Background(), session)
+	tokenRepo.sessions[tokenHash] = session
+
+	sessionSvc := service.NewSessionService(sessionRepo, tokenSvc)
+	h := NewCommandHandler(sessionSvc, tokenSvc, service.NewAuthService(newMockAPIKeyRepo(), nil), nil, nil)
+	tc := newTestConn()
+	defer tc.Close()
+	tc.proto.Store(3)
+
+	h.handleTMValidate(tc.Conn, [][]byte{[]byte("TM.VALIDATE"), []byte(plainToken)})
+	out := tc.FlushAndGetOutput()
+	if !strings.HasPrefix(out, "%11\r\n") || !strings.HasSuffix(out, "$4\r\ndata\r\n%1\r\n$4\r\nrole\r\n$5\r\nadmin\r\n") {
+		t.Errorf("TM.VALIDATE RESP3 = %q", out)
+	}
+
+	tc.Reset()
+	h.handleTMMValidate(tc.Conn, [][]byte{[]byte("TM.MVALIDATE"), []byte(plainToken), []byte("bogus")})
+	out = tc.FlushAndGetOutput()
+	if !strings.HasPrefix(out, "*2\r\n%11\r\n") || !strings.HasSuffix(out, "-ERR TM-TOKN-4010 Token invalid\r\n") {
+		t.Errorf("TM.MVALIDATE RESP3 = %q", out)
+	}
+}
+
+func TestCommandHandler_Client(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	tc.id = 42
+
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("ID")})
+	if out := tc.FlushAndGetOutput(); out != ":42\r\n" {
+		t.Errorf("CLIENT ID = %q", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("GETNAME")})
+	if out := tc.FlushAndGetOutput(); out != "$-1\r\n" {
+		t.Errorf("CLIENT GETNAME unset = %q", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("SETNAME"), []byte("bad name")})
+	if out := tc.FlushAndGetOutput(); !strings.HasPrefix(out, "-ERR") {
+		t.Errorf("CLIENT SETNAME with space = %q, want error", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("SETNAME"), []byte("worker-1")})
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("SETINFO"), []byte("LIB-NAME"), []byte("go-redis")})
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("GETNAME")})
+	if out := tc.FlushAndGetOutput(); out != "+OK\r\n+OK\r\n$8\r\nworker-1\r\n" {
+		t.Errorf("CLIENT SETNAME/SETINFO/GETNAME = %q", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("INFO")})
+	out := tc.FlushAndGetOutput()
+	for _, want := range []string{"id=42 ", "name=worker-1 ", "user=test-key-id ", "lib-name=go-redis ", "resp=2 ", "cmd=client\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("CLIENT INFO = %q, missing %q", out, want)
+		}
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("NOPE")})
+	if out := tc.FlushAndGetOutput(); !strings.HasPrefix(out, "-ERR unknown subcommand") {
+		t.Errorf("CLIENT NOPE = %q", out)
+	}
+}
+
+func TestCommandHandler_ClientListKill(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+	srv := New(&Config{}, sessionSvc, tokenSvc, authSvc, nil)
+	h := srv.handler
+
+	admin := newTestConn()
+	defer admin.Close()
+	admin.setAuthenticated()
+	srv.registerConn(admin.Conn)
+
+	other := newTestConn()
+	defer other.Close()
+	other.SetState(ConnState{Authenticated: true, APIKey: &service.APIKeyInfo{KeyID: "tmak-other", Role: string(domain.RoleValidator)}})
+	srv.registerConn(other.Conn)
+
+	// Non-admins may not list or kill
+	h.Handle(other.Conn, [][]byte{[]byte("CLIENT"), []byte("LIST")})
+	if out := other.FlushAndGetOutput(); !strings.Contains(out, "TM-AUTH-4030") {
+		t.Errorf("CLIENT LIST as validator = %q, want permission error", out)
+	}
+
+	h.Handle(admin.Conn, [][]byte{[]byte("CLIENT"), []byte("LIST")})
+	out := admin.FlushAndGetOutput()
+	if strings.Count(out, "id=") != 2 || !strings.Contains(out, "user=tmak-other") {
+		t.Errorf("CLIENT LIST = %q", out)
+	}
+
+	// The filter form skips the caller by default
+	admin.Reset()
+	h.Handle(admin.Conn, [][]byte{[]byte("CLIENT"), []byte("KILL"), []byte("USER"), []byte("test-key-id")})
+	if out := admin.FlushAndGetOutput(); out != ":0\r\n" {
+		t.Errorf("CLIENT KILL USER self = %q, want :0", out)
+	}
+
+	admin.Reset()
+	h.Handle(admin.Conn, [][]byte{[]byte("CLIENT"), []byte("KILL"), []byte("ID"), []byte(strconv.FormatInt(other.ID(), 10))})
+	if out := admin.FlushAndGetOutput(); out != ":1\r\n" {
+		t.Errorf("CLIENT KILL ID = %q, want :1", out)
+	}
+	if !other.closed.Load() {
+		t.Error("killed connection should be closed")
+	}
+
+	admin.Reset()
+	h.Handle(admin.Conn, [][]byte{[]byte("CLIENT"), []byte("KILL"), []byte("10.9.9.9:1")})
+	if out := admin.FlushAndGetOutput(); out != "-ERR No such client\r\n" {
+		t.Errorf("CLIENT KILL legacy = %q", out)
+	}
+}
+
+func TestCommandHandler_CommandAndInfo(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+	srv := New(&Config{}, sessionSvc, tokenSvc, authSvc, nil)
+	h := srv.handler
+
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	srv.registerConn(tc.Conn)
+
+	h.Handle(tc.Conn, [][]byte{[]byte("COMMAND"), []byte("COUNT")})
+	if out := tc.FlushAndGetOutput(); out != fmt.Sprintf(":%d\r\n", len(commandTable)) {
+		t.Errorf("COMMAND COUNT = %q", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("COMMAND"), []byte("INFO"), []byte("get"), []byte("nope")})
+	out := tc.FlushAndGetOutput()
+	want := "*2\r\n*10\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n*1\r\n+@string\r\n*0\r\n*0\r\n*0\r\n$-1\r\n"
+	if out != want {
+		t.Errorf("COMMAND INFO = %q, want %q", out, want)
+	}
+
+	tc.Reset()
+	tc.proto.Store(3)
+	h.Handle(tc.Conn, [][]byte{[]byte("COMMAND"), []byte("DOCS"), []byte("TM.VALIDATE")})
+	out = tc.FlushAndGetOutput()
+	if !strings.HasPrefix(out, "%1\r\n$11\r\ntm.validate\r\n%3\r\n$7\r\nsummary\r\n") {
+		t.Errorf("COMMAND DOCS = %q", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("INFO"), []byte("clients")})
+	out = tc.FlushAndGetOutput()
+	if !strings.HasPrefix(out, "=") || !strings.Contains(out, "connected_clients:1\r\n") || strings.Contains(out, "# Server") {
+		t.Errorf("INFO clients = %q", out)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("INFO")})
+	out = tc.FlushAndGetOutput()
+	for _, want := range []string{"redis_version:" + redisCompatVersion, "total_commands_processed:5"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("INFO = %q, missing %q", out, want)
+		}
+	}
+}
+
+// ============================================================
+// Test: MULTI / EXEC / DISCARD
+// ============================================================
+
+func TestCommandHandler_MultiExec(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+
+	run := func(args ...string) string {
+		tc.Reset()
+		cmd := make([][]byte, len(args))
+		for i, a := range args {
+			cmd[i] = []byte(a)
+		}
+		h.Handle(tc.Conn, cmd)
+		return tc.FlushAndGetOutput()
+	}
+
+	if out := run("EXEC"); out != "-ERR EXEC without MULTI\r\n" {
+		t.Errorf("EXEC without MULTI = %q", out)
+	}
+
+	if out := run("MULTI"); out != "+OK\r\n" {
+		t.Fatalf("MULTI = %q", out)
+	}
+	if out := run("MULTI"); !strings.Contains(out, "nested") {
+		t.Errorf("nested MULTI = %q", out)
+	}
+	for _, cmd := range [][]string{
+		{"PING"},
+		{"TM.HSET", "tmss-test-session-id", "tier", "gold"},
+		{"DEL", "tmss-test-session-id"},
+		{"EXISTS", "tmss-test-session-id"},
+	} {
+		if out := run(cmd...); out != "+QUEUED\r\n" {
+			t.Fatalf("%s = %q, want QUEUED", cmd[0], out)
+		}
+	}
+
+	// Nothing runs before EXEC
+	if _, err := h.sessionSvc.Get(context.Background(), &service.GetSessionRequest{SessionID: "tmss-test-session-id"}); err != nil {
+		t.Fatalf("session revoked before EXEC: %v", err)
+	}
+
+	if out := run("EXEC"); out != "*4\r\n+PONG\r\n:1\r\n:1\r\n:0\r\n" {
+		t.Errorf("EXEC = %q", out)
+	}
+	if tc.tx != nil {
+		t.Error("EXEC should end the transaction")
+	}
+}
+
+func TestCommandHandler_MultiAbort(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.SetState(ConnState{Authenticated: true, APIKey: &service.APIKeyInfo{KeyID: "tmak-v", Role: string(domain.RoleValidator)}})
+
+	h.Handle(tc.Conn, [][]byte{[]byte("MULTI")})
+	h.Handle(tc.Conn, [][]byte{[]byte("GET")})                                 // Wrong arity
+	h.Handle(tc.Conn, [][]byte{[]byte("DEL"), []byte("tmss-test-session-id")}) // Not permitted
+	h.Handle(tc.Conn, [][]byte{[]byte("NOPE")})                                // Unknown
+	h.Handle(tc.Conn, [][]byte{[]byte("EXEC")})
+
+	out := tc.FlushAndGetOutput()
+	want := "+OK\r\n" +
+		"-ERR wrong number of arguments for 'get' command\r\n" +
+		"-ERR TM-AUTH-4030 permission denied for command 'DEL'\r\n" +
+		"-ERR unknown command 'NOPE'\r\n" +
+		"-EXECABORT Transaction discarded because of previous errors.\r\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	if _, err := h.sessionSvc.Get(context.Background(), &service.GetSessionRequest{SessionID: "tmss-test-session-id"}); err != nil {
+		t.Errorf("aborted transaction must not run: %v", err)
+	}
+
+	tc.Reset()
+	h.Handle(tc.Conn, [][]byte{[]byte("MULTI")})
+	h.Handle(tc.Conn, [][]byte{[]byte("GET"), []byte("tmss-test-session-id")})
+	h.Handle(tc.Conn, [][]byte{[]byte("DISCARD")})
+	h.Handle(tc.Conn, [][]byte{[]byte("DISCARD")})
+	if out := tc.FlushAndGetOutput(); out != "+OK\r\n+QUEUED\r\n+OK\r\n-ERR DISCARD without MULTI\r\n" {
+		t.Errorf("DISCARD output = %q", out)
+	}
+}
+
+// ============================================================
+// Test: Keyspace notifications and client tracking
+// ============================================================
+
+func TestCommandHandler_SubscribeKeyspace(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	sub := newTestConn()
+	defer sub.Close()
+	sub.SetState(ConnState{Authenticated: true, APIKey: &service.APIKeyInfo{KeyID: "tmak-v", Role: string(domain.RoleValidator)}})
+	run := func(args ...string) string {
+		sub.Reset()
+		cmd := make([][]byte, len(args))
+		for i, a := range args {
+			cmd[i] = []byte(a)
+		}
+		h.Handle(sub.Conn, cmd)
+		return sub.FlushAndGetOutput()
+	}
+
+	if out := run("SUBSCRIBE", "__keyspace@0__:tmss-test-session-id"); out != "*3\r\n$9\r\nsubscribe\r\n$35\r\n__keyspace@0__:tmss-test-session-id\r\n:1\r\n" {
+		t.Errorf("SUBSCRIBE = %q", out)
+	}
+	if out := run("PSUBSCRIBE", "__keyevent@0__:*"); out != "*3\r\n$10\r\npsubscribe\r\n$16\r\n__keyevent@0__:*\r\n:2\r\n" {
+		t.Errorf("PSUBSCRIBE = %q", out)
+	}
+
+	// RESP2 subscribed mode
+	if out := run("GET", "tmss-test-session-id"); !strings.HasPrefix(out, "-ERR Can't execute 'get'") {
+		t.Errorf("GET while subscribed = %q", out)
+	}
+	if out := run("PING"); out != "*2\r\n$4\r\npong\r\n$0\r\n\r\n" {
+		t.Errorf("PING while subscribed = %q", out)
+	}
+
+	issuer := newTestConn()
+	defer issuer.Close()
+	issuer.setAuthenticated()
+	h.Handle(issuer.Conn, [][]byte{[]byte("DEL"), []byte("tmss-test-session-id")})
+
+	want := "*3\r\n$7\r\nmessage\r\n$35\r\n__keyspace@0__:tmss-test-session-id\r\n$3\r\ndel\r\n" +
+		"*4\r\n$8\r\npmessage\r\n$16\r\n__keyevent@0__:*\r\n$18\r\n__keyevent@0__:del\r\n$20\r\ntmss-test-session-id\r\n"
+	if got := sub.oob.String(); got != want {
+		t.Errorf("notifications = %q, want %q", got, want)
+	}
+
+	if out := run("UNSUBSCRIBE"); out != "*3\r\n$11\r\nunsubscribe\r\n$35\r\n__keyspace@0__:tmss-test-session-id\r\n:1\r\n" {
+		t.Errorf("UNSUBSCRIBE = %q", out)
+	}
+	if out := run("PUNSUBSCRIBE"); out != "*3\r\n$12\r\npunsubscribe\r\n$16\r\n__keyevent@0__:*\r\n:0\r\n" {
+		t.Errorf("PUNSUBSCRIBE = %q", out)
+	}
+	if out := run("UNSUBSCRIBE"); out != "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n" {
+		t.Errorf("UNSUBSCRIBE without subscriptions = %q", out)
+	}
+	if out := run("PING"); out != "+PONG\r\n" {
+		t.Errorf("PING after unsubscribing = %q", out)
+	}
+}
+
+func TestCommandHandler_SubscribeInMulti(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+
+	h.Handle(tc.Conn, [][]byte{[]byte("MULTI")})
+	h.Handle(tc.Conn, [][]byte{[]byte("SUBSCRIBE"), []byte("ch")})
+	if out := tc.FlushAndGetOutput(); out != "+OK\r\n-ERR Command not allowed inside a transaction\r\n" {
+		t.Errorf("SUBSCRIBE in MULTI = %q", out)
+	}
+}
+
+func TestCommandHandler_ClientTracking(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	run := func(args ...string) string {
+		tc.Reset()
+		cmd := make([][]byte, len(args))
+		for i, a := range args {
+			cmd[i] = []byte(a)
+		}
+		h.Handle(tc.Conn, cmd)
+		return tc.FlushAndGetOutput()
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "TRACKING", "ON"}, "-ERR TM-ARG-4001 CLIENT TRACKING without REDIRECT requires RESP3 (HELLO 3)\r\n"},
+		{[]string{"CLIENT", "TRACKING", "MAYBE"}, "-ERR syntax error\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "OPTIN"}, "-ERR TM-ARG-4001 CLIENT TRACKING OPTIN is not supported\r\n"},
+		{[]string{"CLIENT", "TRACKING", "ON", "REDIRECT", "42"}, "-ERR The client ID you want redirect to does not exist\r\n"},
+		{[]string{"CLIENT", "GETREDIR"}, ":-1\r\n"},
+	}
+	for _, tt := range tests {
+		if out := run(tt.args...); out != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, out, tt.want)
+		}
+	}
+
+	tc.proto.Store(3)
+	if out := run("CLIENT", "TRACKING", "ON", "PREFIX", "tmss-"); out != "-ERR PREFIX option requires BCAST mode to be enabled\r\n" {
+		t.Errorf("PREFIX without BCAST = %q", out)
+	}
+	if out := run("CLIENT", "TRACKING", "ON"); out != "+OK\r\n" {
+		t.Fatalf("CLIENT TRACKING ON = %q", out)
+	}
+	if out := run("CLIENT", "GETREDIR"); out != ":0\r\n" {
+		t.Errorf("CLIENT GETREDIR = %q", out)
+	}
+
+	// Only keys read are invalidated.
+	run("GET", "tmss-test-session-id")
+	h.notify.sessionEvents([]service.SessionEvent{{Type: service.SessionEventDeleted, SessionID: "tmss-unread"}})
+	if got := tc.oob.String(); got != "" {
+		t.Errorf("invalidation for unread key = %q", got)
+	}
+
+	issuer := newTestConn()
+	defer issuer.Close()
+	issuer.setAuthenticated()
+	h.Handle(issuer.Conn, [][]byte{[]byte("DEL"), []byte("tmss-test-session-id")})
+
+	want := ">2\r\n$10\r\ninvalidate\r\n*1\r\n$20\r\ntmss-test-session-id\r\n"
+	if got := tc.oob.String(); got != want {
+		t.Errorf("invalidation = %q, want %q", got, want)
+	}
+
+	// A key is invalidated once per read.
+	tc.oob.Reset()
+	h.notify.sessionEvents([]service.SessionEvent{{Type: service.SessionEventExpired, SessionID: "tmss-test-session-id"}})
+	if got := tc.oob.String(); got != "" {
+		t.Errorf("second invalidation = %q", got)
+	}
+
+	if out := run("CLIENT", "TRACKING", "OFF"); out != "+OK\r\n" {
+		t.Errorf("CLIENT TRACKING OFF = %q", out)
+	}
+	if tc.listening() {
+		t.Error("connection should not be listening after TRACKING OFF")
+	}
+}
+
+func TestCommandHandler_ClientTrackingBroadcast(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	tc.proto.Store(3)
+
+	h.Handle(tc.Conn, [][]byte{[]byte("CLIENT"), []byte("TRACKING"), []byte("ON"), []byte("BCAST"), []byte("PREFIX"), []byte("tmss-a")})
+	if out := tc.FlushAndGetOutput(); out != "+OK\r\n" {
+		t.Fatalf("CLIENT TRACKING ON BCAST = %q", out)
+	}
+
+	h.notify.sessionEvents([]service.SessionEvent{
+		{Type: service.SessionEventExpired, SessionID: "tmss-a1"},
+		{Type: service.SessionEventExpired, SessionID: "tmss-b1"},
+		{Type: service.SessionEventExpired, SessionID: "tmss-a2"},
+	})
+
+	want := ">2\r\n$10\r\ninvalidate\r\n*2\r\n$7\r\ntmss-a1\r\n$7\r\ntmss-a2\r\n"
+	if got := tc.oob.String(); got != want {
+		t.Errorf("invalidation = %q, want %q", got, want)
+	}
+}
+
+// ============================================================
+// Test: Generic key commands
+// ============================================================
+
+func TestCommandHandler_KeyCommands(t *testing.T) {
+	h, _ := newTestCommandHandlerWithSession()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	run := func(args ...string) string {
+		tc.Reset()
+		cmd := make([][]byte, len(args))
+		for i, a := range args {
+			cmd[i] = []byte(a)
+		}
+		h.Handle(tc.Conn, cmd)
+		return tc.FlushAndGetOutput()
+	}
+	const id = "tmss-test-session-id"
+
+	if out := run("MGET", id, "tmss-missing"); !strings.HasPrefix(out, "*2\r\n$") || !strings.HasSuffix(out, "$-1\r\n") || !strings.Contains(out, `"id":"`+id+`"`) {
+		t.Errorf("MGET = %q", out)
+	}
+	if out := run("TYPE", id); out != "+string\r\n" {
+		t.Errorf("TYPE = %q", out)
+	}
+	if out := run("TYPE", "tmss-missing"); out != "+none\r\n" {
+		t.Errorf("TYPE missing = %q", out)
+	}
+	if out := run("DBSIZE"); out != ":1\r\n" {
+		t.Errorf("DBSIZE = %q", out)
+	}
+
+	if out := run("PEXPIRE", id, "600000"); out != ":1\r\n" {
+		t.Errorf("PEXPIRE = %q", out)
+	}
+	out := run("PTTL", id)
+	pttl, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(out, ":")), 10, 64)
+	if err != nil || pttl <= 590000 || pttl > 600000 {
+		t.Errorf("PTTL = %q", out)
+	}
+
+	if out := run("GETEX", id, "EX", "3600"); !strings.Contains(out, `"id":"`+id+`"`) {
+		t.Errorf("GETEX = %q", out)
+	}
+	if out := run("TTL", id); out != ":3599\r\n" && out != ":3600\r\n" {
+		t.Errorf("TTL after GETEX = %q", out)
+	}
+	if out := run("GETEX", id, "PERSIST"); out != "-ERR TM-ARG-4001 sessions cannot be made persistent\r\n" {
+		t.Errorf("GETEX PERSIST = %q", out)
+	}
+	if out := run("GETEX", "tmss-missing"); out != "$-1\r\n" {
+		t.Errorf("GETEX missing = %q", out)
+	}
+
+	if out := run("INFO", "keyspace"); !strings.Contains(out, "db0:keys=1,expires=1,avg_ttl=0\r\n") {
+		t.Errorf("INFO keyspace = %q", out)
+	}
+
+	// A non-positive TTL deletes the session.
+	if out := run("PEXPIRE", id, "0"); out != ":1\r\n" {
+		t.Errorf("PEXPIRE 0 = %q", out)
+	}
+	if out := run("PEXPIRE", id, "0"); out != ":0\r\n" {
+		t.Errorf("PEXPIRE 0 on missing = %q", out)
+	}
+	if out := run("PTTL", id); out != ":-2\r\n" {
+		t.Errorf("PTTL missing = %q", out)
+	}
+	if out := run("UNLINK", id); out != ":1\r\n" {
+		t.Errorf("UNLINK = %q", out)
+	}
+	if out := run("DBSIZE"); out != ":0\r\n" {
+		t.Errorf("DBSIZE after delete = %q", out)
+	}
+}
+
+func TestCommandHandler_SetEx(t *testing.T) {
+	h, _ := newTestCommandHandler()
+	tc := newTestConn()
+	defer tc.Close()
+	tc.setAuthenticated()
+	run := func(args ...string) string {
+		tc.Reset()
+		cmd := make([][]byte, len(args))
+		for i, a := range args {
+			cmd[i] = []byte(a)
+		}
+		h.Handle(tc.Conn, cmd)
+		return tc.FlushAndGetOutput()
+	}
+
+	const id = "tmss-01ARZ3NDEKTSV4RRFFQ69G5FAV"
+	value := `{"user_id":"u1","token":"tmtk_ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopq"}`
+	if out := run("SETEX", id, "120", value); out != "+OK\r\n" {
+		t.Fatalf("SETEX = %q", out)
+	}
+	if out := run("TTL", id); out != ":119\r\n" && out != ":120\r\n" {
+		t.Errorf("TTL after SETEX = %q", out)
+	}
+	if out := run("PSETEX", id, "60000", `{"user_id":"u1"}`); out != "+OK\r\n" {
+		t.Fatalf("PSETEX = %q", out)
+	}
+	if out := run("TTL", id); out != ":59\r\n" && out != ":60\r\n" {
+		t.Errorf("TTL after PSETEX = %q", out)
+	}
+	if out := run("SETEX", id, "0", value); out != "-ERR invalid expire time in 'setex' command\r\n" {
+		t.Errorf("SETEX 0 = %q", out)
+	}
+}
@@ -0,0 +1,601 @@
+// Package redisserver provides a Redis protocol compatible server.
+//
+// This file contains protocol negotiation (HELLO), connection management
+// (CLIENT) and server introspection (COMMAND, INFO).
+package redisserver
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/infra/buildinfo"
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
+)
+
+// redisCompatVersion is the Redis version reported by HELLO and INFO.
+// Clients use it for feature detection; TokMesh speaks the RESP3 dialect
+// introduced in Redis 6 and the reply shapes of Redis 7.
+const redisCompatVersion = "7.2.0"
+
+// commandSpec describes a command for COMMAND and COMMAND DOCS.
+type commandSpec struct {
+	name     string
+	arity    int // Positive: exact argument count; negative: minimum
+	flags    []string
+	firstKey int
+	lastKey  int
+	step     int
+	group    string
+	summary  string
+}
+
+// commandTable lists every supported command, in COMMAND reply order.
+var commandTable = []commandSpec{
+	{"ping", -1, []string{"fast", "stale"}, 0, 0, 0, "connection", "Returns the server's liveliness response."},
+	{"auth", -2, []string{"noscript", "loading", "stale", "fast", "no-auth"}, 0, 0, 0, "connection", "Authenticates the connection with an API key."},
+	{"hello", -1, []string{"noscript", "loading", "stale", "fast", "no-auth"}, 0, 0, 0, "connection", "Handshakes with the server, optionally authenticating and selecting the protocol version."},
+	{"quit", -1, []string{"noscript", "loading", "stale", "fast", "no-auth"}, 0, 0, 0, "connection", "Closes the connection."},
+	{"client", -2, []string{"noscript", "loading", "stale"}, 0, 0, 0, "connection", "Manages client connections."},
+	{"command", -1, []string{"loading", "stale"}, 0, 0, 0, "server", "Returns detailed information about all commands."},
+	{"info", -1, []string{"loading", "stale"}, 0, 0, 0, "server", "Returns information and statistics about the server."},
+	{"subscribe", -2, []string{"pubsub", "noscript", "loading", "stale"}, 0, 0, 0, "pubsub", "Listens for keyspace notifications published to channels."},
+	{"psubscribe", -2, []string{"pubsub", "noscript", "loading", "stale"}, 0, 0, 0, "pubsub", "Listens for keyspace notifications published to channels that match patterns."},
+	{"unsubscribe", -1, []string{"pubsub", "noscript", "loading", "stale"}, 0, 0, 0, "pubsub", "Stops listening to channels."},
+	{"punsubscribe", -1, []string{"pubsub", "noscript", "loading", "stale"}, 0, 0, 0, "pubsub", "Stops listening to channel patterns."},
+	{"multi", 1, []string{"noscript", "loading", "stale", "fast"}, 0, 0, 0, "transactions", "Starts a transaction."},
+	{"exec", 1, []string{"noscript", "loading", "stale"}, 0, 0, 0, "transactions", "Executes all commands in a transaction."},
+	{"discard", 1, []string{"noscript", "loading", "stale", "fast"}, 0, 0, 0, "transactions", "Discards a transaction."},
+	{"get", 2, []string{"readonly", "fast"}, 1, 1, 1, "string", "Returns a session as JSON."},
+	{"set", -3, []string{"write", "denyoom"}, 1, 1, 1, "string", "Creates or updates a session from JSON."},
+	{"mget", -2, []string{"readonly", "fast"}, 1, -1, 1, "string", "Returns multiple sessions as JSON."},
+	{"setex", 4, []string{"write", "denyoom"}, 1, 1, 1, "string", "Creates or updates a session with a TTL in seconds."},
+	{"psetex", 4, []string{"write", "denyoom"}, 1, 1, 1, "string", "Creates or updates a session with a TTL in milliseconds."},
+	{"getex", -2, []string{"write", "fast"}, 1, 1, 1, "string", "Returns a session as JSON, optionally renewing it."},
+	{"del", -2, []string{"write"}, 1, -1, 1, "generic", "Revokes one or more sessions."},
+	{"unlink", -2, []string{"write", "fast"}, 1, -1, 1, "generic", "Revokes one or more sessions."},
+	{"expire", 3, []string{"write", "fast"}, 1, 1, 1, "generic", "Renews a session with a new TTL in seconds."},
+	{"pexpire", 3, []string{"write", "fast"}, 1, 1, 1, "generic", "Renews a session with a new TTL in milliseconds."},
+	{"ttl", 2, []string{"readonly", "fast"}, 1, 1, 1, "generic", "Returns the remaining TTL of a session in seconds."},
+	{"pttl", 2, []string{"readonly", "fast"}, 1, 1, 1, "generic", "Returns the remaining TTL of a session in milliseconds."},
+	{"exists", -2, []string{"readonly", "fast"}, 1, -1, 1, "generic", "Counts the given sessions that exist."},
+	{"type", 2, []string{"readonly", "fast"}, 1, 1, 1, "generic", "Returns the type of a key: string for a session, none otherwise."},
+	{"scan", -2, []string{"readonly"}, 0, 0, 0, "generic", "Iterates over session IDs."},
+	{"dbsize", 1, []string{"readonly", "fast"}, 0, 0, 0, "server", "Returns the number of sessions."},
+	{"tm.create", -3, []string{"write", "denyoom"}, 1, 1, 1, "tokmesh", "Creates a session and returns its token."},
+	{"tm.get", 2, []string{"readonly", "fast"}, 1, 1, 1, "tokmesh", "Returns a session."},
+	{"tm.validate", -2, []string{"fast"}, 0, 0, 0, "tokmesh", "Validates a token and returns its session."},
+	{"tm.mvalidate", -2, []string{}, 0, 0, 0, "tokmesh", "Validates multiple tokens in one round trip."},
+	{"tm.touch", 2, []string{"write", "fast"}, 1, 1, 1, "tokmesh", "Updates a session's last active time."},
+	{"tm.revoke_user", 2, []string{"write"}, 0, 0, 0, "tokmesh", "Revokes all sessions of a user."},
+	{"tm.hset", -4, []string{"write", "fast"}, 1, 1, 1, "tokmesh", "Sets session data fields."},
+	{"tm.hdel", -3, []string{"write", "fast"}, 1, 1, 1, "tokmesh", "Removes session data fields."},
+	{"tm.hgetall", 2, []string{"readonly"}, 1, 1, 1, "tokmesh", "Returns all session data fields."},
+}
+
+// lookupCommand returns the spec for a command name (case-insensitive).
+func lookupCommand(name string) (*commandSpec, bool) {
+	name = strings.ToLower(name)
+	for i := range commandTable {
+		if commandTable[i].name == name {
+			return &commandTable[i], true
+		}
+	}
+	return nil, false
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+//
+// Negotiates the RESP version (2 or 3) and returns a map describing the
+// server. AUTH authenticates in the same round trip; the username is the
+// API key ID (or "default" with a "key_id:key_secret" password).
+//
+// @design DS-0301
+func (h *CommandHandler) handleHello(conn *Conn, args [][]byte) {
+	proto := conn.Protocol()
+	if len(args) >= 2 {
+		v, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			_ = WriteError(conn.bw, "ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if v != 2 && v != 3 {
+			_ = WriteError(conn.bw, "NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+
+	var (
+		authArgs [][]byte
+		name     *string
+	)
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch {
+		case opt == "AUTH" && i+2 < len(args):
+			authArgs = args[i+1 : i+3]
+			i += 2
+		case opt == "SETNAME" && i+1 < len(args):
+			n := string(args[i+1])
+			if !validClientName(n) {
+				_ = WriteError(conn.bw, "ERR Client names cannot contain spaces, newlines or special characters.")
+				return
+			}
+			name = &n
+			i++
+		default:
+			_ = WriteError(conn.bw, "ERR Syntax error in HELLO option '"+string(args[i])+"'")
+			return
+		}
+	}
+
+	var apiKey *service.APIKeyInfo
+	if authArgs != nil {
+		keyID, keySecret := string(authArgs[0]), string(authArgs[1])
+		if keyID == "default" {
+			if id, secret, ok := strings.Cut(keySecret, ":"); ok {
+				keyID, keySecret = id, secret
+			}
+		}
+		var ok bool
+		if apiKey, ok = h.authenticate(keyID, keySecret); !ok {
+			_ = WriteError(conn.bw, "ERR TM-AUTH-4010 invalid credentials")
+			return
+		}
+	} else if !conn.GetState().Authenticated {
+		_ = WriteError(conn.bw, "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	conn.UpdateState(func(st *ConnState) {
+		if apiKey != nil {
+			st.Authenticated = true
+			st.APIKey = apiKey
+		}
+		if name != nil {
+			st.ClientName = *name
+		}
+	})
+	conn.proto.Store(int32(proto))
+
+	conn.writeMapHeader(7)
+	_ = WriteBulkString(conn.bw, "server")
+	_ = WriteBulkString(conn.bw, "tokmesh")
+	_ = WriteBulkString(conn.bw, "version")
+	_ = WriteBulkString(conn.bw, redisCompatVersion)
+	_ = WriteBulkString(conn.bw, "proto")
+	_ = WriteInteger(conn.bw, int64(proto))
+	_ = WriteBulkString(conn.bw, "id")
+	_ = WriteInteger(conn.bw, conn.ID())
+	_ = WriteBulkString(conn.bw, "mode")
+	_ = WriteBulkString(conn.bw, "standalone")
+	_ = WriteBulkString(conn.bw, "role")
+	_ = WriteBulkString(conn.bw, "master")
+	_ = WriteBulkString(conn.bw, "modules")
+	_ = WriteArrayHeader(conn.bw, 0)
+}
+
+// authenticateCertificate authenticates a TLS connection whose verified
+// client certificate maps to an API key, so the client needs no AUTH. The
+// first mapped identity (most specific first) decides.
+//
+// @design DS-0301
+func (h *CommandHandler) authenticateCertificate(conn *Conn, cert *x509.Certificate, certAPIKeys map[string]string) bool {
+	for _, identity := range tlsroots.CertIdentities(cert) {
+		keyID, ok := certAPIKeys[identity]
+		if !ok {
+			continue
+		}
+
+		clientIP := conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+		resp, err := h.authSvc.AuthenticateTrustedKey(context.Background(), &service.AuthenticateTrustedKeyRequest{
+			KeyID:    keyID,
+			ClientIP: clientIP,
+		})
+		if err != nil {
+			h.logger.Warn("client certificate maps to unusable api key",
+				"remote", conn.RemoteAddr(), "identity", identity, "key_id", keyID, "error", err)
+			return false
+		}
+
+		conn.UpdateState(func(st *ConnState) {
+			st.Authenticated = true
+			st.APIKey = apiKeyInfo(resp.APIKey)
+		})
+		h.logger.Debug("client authenticated by certificate",
+			"remote", conn.RemoteAddr(), "identity", identity, "key_id", keyID)
+		return true
+	}
+	return false
+}
+
+// validClientName reports whether name is acceptable for CLIENT SETNAME.
+// Like Redis, names are limited to printable ASCII without spaces.
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// CLIENT ID | GETNAME | SETNAME name | SETINFO attr value | INFO | LIST | KILL ...
+//
+// CLIENT LIST and CLIENT KILL expose and affect other connections and
+// require the admin role.
+//
+// @design DS-0301
+func (h *CommandHandler) handleClient(conn *Conn, args [][]byte) {
+	if len(args) < 2 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'CLIENT' command")
+		return
+	}
+
+	sub := strings.ToUpper(string(args[1]))
+	switch sub {
+	case "ID":
+		_ = WriteInteger(conn.bw, conn.ID())
+	case "GETNAME":
+		if name := conn.GetState().ClientName; name != "" {
+			_ = WriteBulkString(conn.bw, name)
+			return
+		}
+		conn.writeNull()
+	case "SETNAME":
+		if len(args) != 3 {
+			_ = WriteError(conn.bw, "ERR wrong number of arguments for 'CLIENT|SETNAME' command")
+			return
+		}
+		name := string(args[2])
+		if !validClientName(name) {
+			_ = WriteError(conn.bw, "ERR Client names cannot contain spaces, newlines or special characters.")
+			return
+		}
+		conn.UpdateState(func(st *ConnState) { st.ClientName = name })
+		_ = WriteSimpleString(conn.bw, "OK")
+	case "SETINFO":
+		h.handleClientSetInfo(conn, args)
+	case "INFO":
+		conn.writeText(clientInfoLine(conn))
+	case "TRACKING":
+		h.handleClientTracking(conn, args)
+	case "GETREDIR":
+		_ = WriteInteger(conn.bw, h.notify.trackingRedirect(conn))
+	case "LIST":
+		if !h.requireAdmin(conn, "CLIENT|LIST") {
+			return
+		}
+		var b strings.Builder
+		for _, c := range h.clients(conn) {
+			b.WriteString(clientInfoLine(c))
+		}
+		conn.writeText(b.String())
+	case "KILL":
+		if !h.requireAdmin(conn, "CLIENT|KILL") {
+			return
+		}
+		h.handleClientKill(conn, args)
+	default:
+		_ = WriteError(conn.bw, "ERR unknown subcommand '"+string(args[1])+"'. Try CLIENT HELP.")
+	}
+}
+
+// handleClientSetInfo handles CLIENT SETINFO LIB-NAME|LIB-VER value, sent
+// by go-redis and other clients right after connecting.
+func (h *CommandHandler) handleClientSetInfo(conn *Conn, args [][]byte) {
+	if len(args) != 4 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'CLIENT|SETINFO' command")
+		return
+	}
+	value := string(args[3])
+	if !validClientName(value) {
+		_ = WriteError(conn.bw, "ERR CLIENT SETINFO values cannot contain spaces, newlines or special characters.")
+		return
+	}
+	switch strings.ToUpper(string(args[2])) {
+	case "LIB-NAME":
+		conn.UpdateState(func(st *ConnState) { st.LibName = value })
+	case "LIB-VER":
+		conn.UpdateState(func(st *ConnState) { st.LibVer = value })
+	default:
+		_ = WriteError(conn.bw, "ERR Unrecognized option '"+string(args[2])+"'")
+		return
+	}
+	_ = WriteSimpleString(conn.bw, "OK")
+}
+
+// CLIENT KILL addr
+// CLIENT KILL [ID id] [ADDR addr] [USER key_id] [SKIPME yes|no]
+//
+// The legacy form replies OK or an error; the filter form replies with the
+// number of clients killed and, like Redis, skips the caller by default.
+func (h *CommandHandler) handleClientKill(conn *Conn, args [][]byte) {
+	if len(args) < 3 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'CLIENT|KILL' command")
+		return
+	}
+
+	legacy := len(args) == 3
+	var (
+		id         int64
+		addr, user string
+		skipMe     = !legacy
+	)
+	if legacy {
+		addr = string(args[2])
+	} else {
+		if len(args)%2 != 0 {
+			_ = WriteError(conn.bw, "ERR syntax error")
+			return
+		}
+		for i := 2; i < len(args); i += 2 {
+			value := string(args[i+1])
+			switch strings.ToUpper(string(args[i])) {
+			case "ID":
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || n <= 0 {
+					_ = WriteError(conn.bw, "ERR client-id should be greater than 0")
+					return
+				}
+				id = n
+			case "ADDR":
+				addr = value
+			case "USER":
+				user = value
+			case "SKIPME":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					_ = WriteError(conn.bw, "ERR syntax error")
+					return
+				}
+			default:
+				_ = WriteError(conn.bw, "ERR syntax error")
+				return
+			}
+		}
+	}
+
+	killed := 0
+	killSelf := false
+	for _, c := range h.clients(conn) {
+		if id != 0 && c.ID() != id {
+			continue
+		}
+		if addr != "" && c.RemoteAddr().String() != addr {
+			continue
+		}
+		if user != "" {
+			if st := c.GetState(); st.APIKey == nil || st.APIKey.KeyID != user {
+				continue
+			}
+		}
+		if c == conn {
+			if skipMe {
+				continue
+			}
+			killSelf = true // Closed after the reply is sent
+		} else {
+			_ = c.Close()
+		}
+		killed++
+	}
+
+	switch {
+	case !legacy:
+		_ = WriteInteger(conn.bw, int64(killed))
+	case killed == 0:
+		_ = WriteError(conn.bw, "ERR No such client")
+	default:
+		_ = WriteSimpleString(conn.bw, "OK")
+	}
+
+	if killSelf {
+		_ = conn.Flush()
+		_ = conn.Close()
+	}
+}
+
+// requireAdmin writes a permission error unless the connection has the
+// admin role.
+func (h *CommandHandler) requireAdmin(conn *Conn, cmdName string) bool {
+	st := conn.GetState()
+	if st.APIKey == nil || st.APIKey.Role != string(domain.RoleAdmin) {
+		_ = WriteError(conn.bw, "ERR TM-AUTH-4030 permission denied for command '"+cmdName+"'")
+		return false
+	}
+	return true
+}
+
+// clients returns the server's connected clients, or just conn when the
+// handler runs without a server (tests).
+func (h *CommandHandler) clients(conn *Conn) []*Conn {
+	if h.srv == nil {
+		return []*Conn{conn}
+	}
+	return h.srv.connections()
+}
+
+// clientInfoLine formats a connection in the CLIENT LIST line format.
+func clientInfoLine(c *Conn) string {
+	st := c.GetState()
+	user := ""
+	if st.APIKey != nil {
+		user = st.APIKey.KeyID
+	}
+
+	c.stateMu.RLock()
+	lastCmd, lastActive := c.lastCmd, c.lastActive
+	c.stateMu.RUnlock()
+
+	now := time.Now()
+	idle := time.Duration(0)
+	if !lastActive.IsZero() {
+		idle = now.Sub(lastActive)
+	}
+	laddr := ""
+	if a := c.netConn.LocalAddr(); a != nil {
+		laddr = a.String()
+	}
+
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d user=%s lib-name=%s lib-ver=%s resp=%d cmd=%s\n",
+		c.ID(), c.RemoteAddr(), laddr, st.ClientName,
+		int64(now.Sub(c.createdAt).Seconds()), int64(idle.Seconds()),
+		user, st.LibName, st.LibVer, c.Protocol(), lastCmd)
+}
+
+// COMMAND [COUNT | LIST | INFO [name ...] | DOCS [name ...]]
+//
+// @design DS-0301
+func (h *CommandHandler) handleCommand(conn *Conn, args [][]byte) {
+	if len(args) == 1 {
+		_ = WriteArrayHeader(conn.bw, len(commandTable))
+		for i := range commandTable {
+			conn.writeCommandInfo(&commandTable[i])
+		}
+		return
+	}
+
+	switch strings.ToUpper(string(args[1])) {
+	case "COUNT":
+		_ = WriteInteger(conn.bw, int64(len(commandTable)))
+	case "LIST":
+		_ = WriteArrayHeader(conn.bw, len(commandTable))
+		for _, spec := range commandTable {
+			_ = WriteBulkString(conn.bw, spec.name)
+		}
+	case "INFO":
+		names := args[2:]
+		if len(names) == 0 {
+			h.handleCommand(conn, args[:1])
+			return
+		}
+		_ = WriteArrayHeader(conn.bw, len(names))
+		for _, name := range names {
+			if spec, ok := lookupCommand(string(name)); ok {
+				conn.writeCommandInfo(spec)
+			} else {
+				conn.writeNull()
+			}
+		}
+	case "DOCS":
+		var specs []*commandSpec
+		if len(args) == 2 {
+			for i := range commandTable {
+				specs = append(specs, &commandTable[i])
+			}
+		}
+		for _, name := range args[2:] {
+			if spec, ok := lookupCommand(string(name)); ok {
+				specs = append(specs, spec)
+			}
+		}
+		conn.writeMapHeader(len(specs))
+		for _, spec := range specs {
+			_ = WriteBulkString(conn.bw, spec.name)
+			conn.writeMapHeader(3)
+			_ = WriteBulkString(conn.bw, "summary")
+			_ = WriteBulkString(conn.bw, spec.summary)
+			_ = WriteBulkString(conn.bw, "since")
+			_ = WriteBulkString(conn.bw, "1.0.0")
+			_ = WriteBulkString(conn.bw, "group")
+			_ = WriteBulkString(conn.bw, spec.group)
+		}
+	default:
+		_ = WriteError(conn.bw, "ERR unknown subcommand '"+string(args[1])+"'. Try COMMAND HELP.")
+	}
+}
+
+// writeCommandInfo writes a command in the Redis 7 COMMAND INFO shape:
+// name, arity, flags, first key, last key, step, ACL categories, tips,
+// key specifications and subcommands.
+func (c *Conn) writeCommandInfo(spec *commandSpec) {
+	_ = WriteArrayHeader(c.bw, 10)
+	_ = WriteBulkString(c.bw, spec.name)
+	_ = WriteInteger(c.bw, int64(spec.arity))
+	c.writeSetHeader(len(spec.flags))
+	for _, flag := range spec.flags {
+		_ = WriteSimpleString(c.bw, flag)
+	}
+	_ = WriteInteger(c.bw, int64(spec.firstKey))
+	_ = WriteInteger(c.bw, int64(spec.lastKey))
+	_ = WriteInteger(c.bw, int64(spec.step))
+	c.writeSetHeader(1)
+	_ = WriteSimpleString(c.bw, "@"+spec.group)
+	_ = WriteArrayHeader(c.bw, 0)
+	_ = WriteArrayHeader(c.bw, 0)
+	_ = WriteArrayHeader(c.bw, 0)
+}
+
+// INFO [section ...]
+//
+// Supported sections are server, clients and stats; "all", "everything"
+// and "default" select every section.
+//
+// @design DS-0301
+func (h *CommandHandler) handleInfo(conn *Conn, args [][]byte) {
+	want := map[string]bool{}
+	for _, arg := range args[1:] {
+		want[strings.ToLower(string(arg))] = true
+	}
+	all := len(want) == 0 || want["all"] || want["everything"] || want["default"]
+
+	var (
+		uptime                time.Duration
+		clients               int
+		totalConns, totalCmds int64
+	)
+	if h.srv != nil {
+		uptime = time.Since(h.srv.startTime)
+		clients = len(h.srv.connections())
+		totalConns = h.srv.totalConns.Load()
+		totalCmds = h.srv.totalCmds.Load()
+	}
+
+	var b strings.Builder
+	if all || want["server"] {
+		b.WriteString("# Server\r\n")
+		fmt.Fprintf(&b, "redis_version:%s\r\n", redisCompatVersion)
+		fmt.Fprintf(&b, "tokmesh_version:%s\r\n", buildinfo.Version)
+		b.WriteString("redis_mode:standalone\r\n")
+		fmt.Fprintf(&b, "process_id:%d\r\n", os.Getpid())
+		fmt.Fprintf(&b, "uptime_in_seconds:%d\r\n", int64(uptime.Seconds()))
+		b.WriteString("\r\n")
+	}
+	if all || want["clients"] {
+		b.WriteString("# Clients\r\n")
+		fmt.Fprintf(&b, "connected_clients:%d\r\n", clients)
+		b.WriteString("\r\n")
+	}
+	if all || want["stats"] {
+		b.WriteString("# Stats\r\n")
+		fmt.Fprintf(&b, "total_connections_received:%d\r\n", totalConns)
+		fmt.Fprintf(&b, "total_commands_processed:%d\r\n", totalCmds)
+		b.WriteString("\r\n")
+	}
+	if all || want["keyspace"] {
+		b.WriteString("# Keyspace\r\n")
+		// Every session expires, so expires always equals keys.
+		if n, err := h.sessionCount(context.Background()); err == nil && n > 0 {
+			fmt.Fprintf(&b, "db0:keys=%d,expires=%d,avg_ttl=0\r\n", n, n)
+		}
+		b.WriteString("\r\n")
+	}
+
+	conn.writeText(strings.TrimSuffix(b.String(), "\r\n"))
+}
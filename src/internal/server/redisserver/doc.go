@@ -1,13 +1,53 @@
 // Package redisserver provides Redis protocol compatible server for TokMesh.
 //
-// This package implements the RESP2 subset required by `RQ-0303`,
-// using only the Go standard library (no third-party RESP server).
+// This package implements the RESP2 subset required by `RQ-0303`, plus
+// RESP3 negotiated with HELLO 3, using only the Go standard library (no
+// third-party RESP server).
 //
 // Supported commands (see `specs/1-requirements/RQ-0303-业务接口规约-Redis协议.md`):
-//   - PING, QUIT
+//   - PING, QUIT, HELLO
 //   - AUTH
+//   - CLIENT ID/GETNAME/SETNAME/SETINFO/INFO/LIST/KILL/TRACKING/GETREDIR,
+//     COMMAND, INFO
 //   - GET, SET, DEL, EXPIRE, TTL, EXISTS, SCAN
-//   - TM.CREATE, TM.VALIDATE, TM.REVOKE_USER
+//   - MGET, SETEX, PSETEX, GETEX, UNLINK, PEXPIRE, PTTL, TYPE, DBSIZE
+//   - TM.CREATE, TM.GET, TM.VALIDATE, TM.MVALIDATE, TM.TOUCH, TM.REVOKE_USER
+//   - TM.HSET, TM.HDEL, TM.HGETALL
+//   - MULTI, EXEC, DISCARD
+//   - SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE
+//
+// Pipelined commands are executed back to back and their replies written
+// in one batch. Replies are buffered per connection up to
+// Config.OutputBufferLimit; clients that exceed it are disconnected.
+//
+// The generic key commands treat session IDs as keys and the session JSON
+// of GET as string values. Under any other key, such as the sess:<id>
+// keys of express-session or the cache keys of Django, SET stores the
+// value as an opaque string, up to about 4KB, in a session of its own
+// that expires like any other (24 hours by default), so Redis session
+// stores that write strings work unmodified. Keyspace notifications and
+// invalidations name the ID of that session, not the key. Hashes, as
+// used by Spring Session, are not supported. A non-positive
+// EXPIRE/PEXPIRE TTL revokes the session.
+//
+// Under RESP3, TM.* commands reply with native maps (sessions, data
+// fields) instead of JSON bulk strings. GET keeps its JSON reply so
+// generic Redis clients can still read it as a string.
+//
+// Session revocations and expirations are published as keyspace
+// notifications (__keyspace@0__:<id>, __keyevent@0__:del|expired) and as
+// CLIENT TRACKING invalidations, in default or BCAST mode, so clients can
+// cache TM.VALIDATE results. Pushes are written while a connection waits
+// for its next command, never in the middle of a reply.
+//
+// The plaintext port is refused on non-loopback addresses unless
+// Config.AllowInsecurePlain is set; remote clients should use the TLS port.
+// TLS clients presenting a verified client certificate whose identity is
+// listed in Config.CertAPIKeys are authenticated as the mapped API key
+// without AUTH.
+//
+// Writes are made with the durability of the connection's API key
+// (none, buffered or fsync), or the server default if it has none.
 //
 // @req RQ-0303
 // @design DS-0301
@@ -0,0 +1,227 @@
+// Package redisserver provides a Redis protocol compatible server.
+//
+// This file contains the generic Redis key commands that session stores of
+// web frameworks rely on (MGET, SETEX, GETEX, TYPE, DBSIZE, ...), mapped
+// onto sessions. Under a session ID key the value is the session JSON of
+// GET; under any other key it is an opaque string (see values.go).
+package redisserver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// MaxKeysPerCommand limits the keys of multi-key commands (DEL, UNLINK,
+// MGET).
+const MaxKeysPerCommand = 1000
+
+// commandName returns the upper-case command name for error messages.
+func commandName(args [][]byte, fallback string) string {
+	if len(args) == 0 {
+		return fallback
+	}
+	return strings.ToUpper(string(args[0]))
+}
+
+// isSessionGone reports whether err means the session does not exist.
+func isSessionGone(err error) bool {
+	return domain.IsDomainError(err, "TM-SESS-4040") || domain.IsDomainError(err, "TM-SESS-4041")
+}
+
+// expireNow revokes a session given a non-positive TTL, replying 1 if it
+// existed and 0 otherwise, like EXPIRE in Redis.
+func (h *CommandHandler) expireNow(conn *Conn, sessionID string) {
+	ctx := conn.requestContext()
+	if _, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID}); err != nil {
+		if isSessionGone(err) {
+			_ = WriteInteger(conn.bw, 0)
+			return
+		}
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	if _, err := h.sessionSvc.Revoke(ctx, &service.RevokeSessionRequest{SessionID: sessionID}); err != nil {
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	_ = WriteInteger(conn.bw, 1)
+}
+
+// MGET <key> [key ...]
+//
+// Returns the value of each key like GET, or null for missing keys.
+func (h *CommandHandler) handleMGet(conn *Conn, args [][]byte) {
+	if len(args) < 2 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'MGET' command")
+		return
+	}
+	if len(args) > MaxKeysPerCommand+1 {
+		_ = WriteError(conn.bw, "ERR TM-ARG-4002 maximum "+strconv.Itoa(MaxKeysPerCommand)+" keys per MGET command")
+		return
+	}
+
+	ctx := conn.requestContext()
+	_ = WriteArrayHeader(conn.bw, len(args)-1)
+	for _, key := range args[1:] {
+		session, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: keySessionID(key)})
+		if err != nil {
+			// Like Redis, MGET never fails per key.
+			conn.writeNull()
+			continue
+		}
+		h.notify.track(conn, session.ID)
+		writeKeyValue(conn, session)
+	}
+}
+
+// SETEX <key> <seconds> <value>
+// PSETEX <key> <milliseconds> <value>
+//
+// Equivalent to SET <key> <value> EX|PX <ttl>.
+func (h *CommandHandler) handleSetEx(conn *Conn, args [][]byte) {
+	name := commandName(args, "SETEX")
+	if len(args) != 4 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for '"+name+"' command")
+		return
+	}
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		_ = WriteError(conn.bw, "ERR value is not an integer or out of range")
+		return
+	}
+	if n <= 0 {
+		_ = WriteError(conn.bw, "ERR invalid expire time in '"+strings.ToLower(name)+"' command")
+		return
+	}
+
+	opt := "EX"
+	if name == "PSETEX" {
+		opt = "PX"
+	}
+	h.handleSet(conn, [][]byte{[]byte("SET"), args[1], args[3], []byte(opt), args[2]})
+}
+
+// GETEX <key> [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds]
+//
+// Returns the value like GET, optionally renewing the session.
+// PERSIST is rejected: sessions always expire.
+func (h *CommandHandler) handleGetEx(conn *Conn, args [][]byte) {
+	if len(args) != 2 && len(args) != 4 {
+		if len(args) == 3 && strings.EqualFold(string(args[2]), "PERSIST") {
+			_ = WriteError(conn.bw, "ERR TM-ARG-4001 sessions cannot be made persistent")
+			return
+		}
+		_ = WriteError(conn.bw, "ERR syntax error")
+		return
+	}
+
+	var ttl time.Duration
+	if len(args) == 4 {
+		n, err := strconv.ParseInt(string(args[3]), 10, 64)
+		if err != nil {
+			_ = WriteError(conn.bw, "ERR value is not an integer or out of range")
+			return
+		}
+		switch strings.ToUpper(string(args[2])) {
+		case "EX":
+			ttl = time.Duration(n) * time.Second
+		case "PX":
+			ttl = time.Duration(n) * time.Millisecond
+		case "EXAT":
+			ttl = time.Until(time.Unix(n, 0))
+		case "PXAT":
+			ttl = time.Until(time.UnixMilli(n))
+		default:
+			_ = WriteError(conn.bw, "ERR syntax error")
+			return
+		}
+		if n <= 0 {
+			_ = WriteError(conn.bw, "ERR invalid expire time in 'getex' command")
+			return
+		}
+	}
+
+	ctx := conn.requestContext()
+	sessionID := keySessionID(args[1])
+	session, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID})
+	if err != nil {
+		if isSessionGone(err) {
+			conn.writeNull()
+			return
+		}
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+
+	switch {
+	case len(args) == 2:
+	case ttl <= 0:
+		// An absolute expiry in the past deletes the key; the value read
+		// before is still returned.
+		if _, err := h.sessionSvc.Revoke(ctx, &service.RevokeSessionRequest{SessionID: sessionID}); err != nil {
+			_ = WriteError(conn.bw, formatRedisError(err))
+			return
+		}
+	default:
+		resp, err := h.sessionSvc.Renew(ctx, &service.RenewSessionRequest{SessionID: sessionID, TTL: ttl})
+		if err != nil {
+			_ = WriteError(conn.bw, formatRedisError(err))
+			return
+		}
+		session.ExpiresAt = resp.NewExpiresAt
+	}
+
+	h.notify.track(conn, session.ID)
+	writeKeyValue(conn, session)
+}
+
+// TYPE <key>
+//
+// Replies "string" for an existing key (GET returns it as a string) and
+// "none" otherwise.
+func (h *CommandHandler) handleType(conn *Conn, args [][]byte) {
+	if len(args) != 2 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'TYPE' command")
+		return
+	}
+
+	ctx := conn.requestContext()
+	if _, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: keySessionID(args[1])}); err != nil {
+		if isSessionGone(err) {
+			_ = WriteSimpleString(conn.bw, "none")
+			return
+		}
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	_ = WriteSimpleString(conn.bw, "string")
+}
+
+// DBSIZE
+//
+// Returns the number of stored sessions.
+func (h *CommandHandler) handleDBSize(conn *Conn, args [][]byte) {
+	if len(args) != 1 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'DBSIZE' command")
+		return
+	}
+
+	n, err := h.sessionCount(context.Background())
+	if err != nil {
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	_ = WriteInteger(conn.bw, int64(n))
+}
+
+// sessionCount returns the number of stored sessions, counted by the
+// repository without listing them.
+func (h *CommandHandler) sessionCount(ctx context.Context) (int, error) {
+	return h.sessionSvc.Count(ctx)
+}
@@ -0,0 +1,431 @@
+// Package redisserver provides a Redis protocol compatible server.
+package redisserver
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// Keyspace notifications and client-side caching.
+//
+// Session revocations and expirations reported by the SessionService are
+// published Redis-style to pub/sub subscribers:
+//
+//	__keyspace@0__:<session_id>  message "del" or "expired"
+//	__keyevent@0__:del|expired   message <session_id>
+//
+// and invalidate the session ID in the caches of clients that enabled
+// CLIENT TRACKING. In default mode a client is told about the sessions it
+// read (GET, TTL, EXISTS, TM.GET, TM.HGETALL, TM.VALIDATE, TM.MVALIDATE);
+// in broadcast mode about every session matching one of its prefixes.
+
+const (
+	keyspaceChannelPrefix = "__keyspace@0__:"
+	keyeventChannelPrefix = "__keyevent@0__:"
+
+	// invalidateChannel carries invalidations to a RESP2 REDIRECT client.
+	invalidateChannel = "__redis__:invalidate"
+)
+
+// MaxTrackedKeys bounds the session IDs remembered for default-mode
+// tracking clients. When the table is full a random key is evicted and its
+// clients are sent an invalidation for it, as Redis does.
+const MaxTrackedKeys = 1 << 20
+
+// notifier routes session events to subscribed and tracking clients.
+//
+// @design DS-0301
+type notifier struct {
+	// lookup finds a REDIRECT target by client ID; nil without a server.
+	lookup func(id int64) (*Conn, bool)
+
+	mu       sync.Mutex
+	channels map[string]map[*Conn]struct{}
+	patterns map[string]map[*Conn]struct{}
+	subs     map[*Conn]*subscriptions
+	trackers map[*Conn]*trackingState
+	tracked  map[string]map[*Conn]struct{} // Session ID -> default-mode readers
+}
+
+// subscriptions are the channels and patterns of one client.
+type subscriptions struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *subscriptions) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// trackingState is the CLIENT TRACKING configuration of one client.
+type trackingState struct {
+	redirect int64 // Client ID receiving the invalidations; 0 for self
+	bcast    bool
+	prefixes []string // Broadcast mode only; empty matches every key
+}
+
+// matches reports whether a broadcast client is interested in key.
+func (t *trackingState) matches(key string) bool {
+	if len(t.prefixes) == 0 {
+		return true
+	}
+	for _, p := range t.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func newNotifier(lookup func(id int64) (*Conn, bool)) *notifier {
+	return &notifier{
+		lookup:   lookup,
+		channels: make(map[string]map[*Conn]struct{}),
+		patterns: make(map[string]map[*Conn]struct{}),
+		subs:     make(map[*Conn]*subscriptions),
+		trackers: make(map[*Conn]*trackingState),
+		tracked:  make(map[string]map[*Conn]struct{}),
+	}
+}
+
+// delivery is a message to queue on a connection once the notifier lock is
+// released.
+type delivery struct {
+	conn *Conn
+	msg  []byte
+}
+
+func deliver(ds []delivery) {
+	for _, d := range ds {
+		d.conn.queueMessage(d.msg)
+	}
+}
+
+// subscribe adds a channel (or pattern) subscription and returns the
+// client's subscription count.
+func (n *notifier) subscribe(c *Conn, name string, pattern bool) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.subs[c]
+	if s == nil {
+		s = &subscriptions{channels: make(map[string]struct{}), patterns: make(map[string]struct{})}
+		n.subs[c] = s
+	}
+	own, index := s.channels, n.channels
+	if pattern {
+		own, index = s.patterns, n.patterns
+	}
+	own[name] = struct{}{}
+	if index[name] == nil {
+		index[name] = make(map[*Conn]struct{})
+	}
+	index[name][c] = struct{}{}
+
+	c.subscriptions.Store(int32(s.count()))
+	return s.count()
+}
+
+// unsubscribe removes a channel (or pattern) subscription and returns the
+// client's remaining subscription count.
+func (n *notifier) unsubscribe(c *Conn, name string, pattern bool) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.subs[c]
+	if s == nil {
+		return 0
+	}
+	n.unsubscribeLocked(c, s, name, pattern)
+	return s.count()
+}
+
+func (n *notifier) unsubscribeLocked(c *Conn, s *subscriptions, name string, pattern bool) {
+	own, index := s.channels, n.channels
+	if pattern {
+		own, index = s.patterns, n.patterns
+	}
+	delete(own, name)
+	if conns := index[name]; conns != nil {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(index, name)
+		}
+	}
+	if s.count() == 0 {
+		delete(n.subs, c)
+	}
+	c.subscriptions.Store(int32(s.count()))
+}
+
+// subscribed returns the client's channels (or patterns), sorted.
+func (n *notifier) subscribed(c *Conn, pattern bool) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.subs[c]
+	if s == nil {
+		return nil
+	}
+	own := s.channels
+	if pattern {
+		own = s.patterns
+	}
+	return sortedKeys(own)
+}
+
+// setTracking enables tracking for a client, or disables it if t is nil.
+func (n *notifier) setTracking(c *Conn, t *trackingState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if t == nil {
+		delete(n.trackers, c)
+	} else {
+		n.trackers[c] = t
+	}
+	c.tracking.Store(t != nil)
+	c.trackKeys.Store(t != nil && !t.bcast)
+}
+
+// trackingRedirect returns the client's REDIRECT target, 0 if tracking
+// without redirection, or -1 if tracking is off.
+func (n *notifier) trackingRedirect(c *Conn) int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	t := n.trackers[c]
+	if t == nil {
+		return -1
+	}
+	return t.redirect
+}
+
+// track records that a default-mode tracking client read keys.
+func (n *notifier) track(c *Conn, keys ...string) {
+	if !c.trackKeys.Load() || len(keys) == 0 {
+		return
+	}
+
+	var ds []delivery
+	n.mu.Lock()
+	for _, key := range keys {
+		conns := n.tracked[key]
+		if conns == nil {
+			if len(n.tracked) >= MaxTrackedKeys {
+				ds = append(ds, n.evictLocked()...)
+			}
+			conns = make(map[*Conn]struct{})
+			n.tracked[key] = conns
+		}
+		conns[c] = struct{}{}
+	}
+	n.mu.Unlock()
+	deliver(ds)
+}
+
+// evictLocked drops one tracked key, invalidating it for its readers.
+func (n *notifier) evictLocked() []delivery {
+	for key := range n.tracked {
+		return n.invalidateLocked([]string{key})
+	}
+	return nil
+}
+
+// removeClient forgets a disconnected client.
+func (n *notifier) removeClient(c *Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if s := n.subs[c]; s != nil {
+		for name := range s.channels {
+			n.unsubscribeLocked(c, s, name, false)
+		}
+		for name := range s.patterns {
+			n.unsubscribeLocked(c, s, name, true)
+		}
+	}
+	delete(n.trackers, c)
+	c.tracking.Store(false)
+	c.trackKeys.Store(false)
+}
+
+// sessionEvents is the SessionService listener.
+func (n *notifier) sessionEvents(events []service.SessionEvent) {
+	var ds []delivery
+	keys := make([]string, 0, len(events))
+
+	n.mu.Lock()
+	for _, ev := range events {
+		ds = n.publishLocked(ds, keyspaceChannelPrefix+ev.SessionID, string(ev.Type))
+		ds = n.publishLocked(ds, keyeventChannelPrefix+string(ev.Type), ev.SessionID)
+		keys = append(keys, ev.SessionID)
+	}
+	ds = append(ds, n.invalidateLocked(keys)...)
+	n.mu.Unlock()
+
+	deliver(ds)
+}
+
+// publishLocked appends the deliveries of a message to channel subscribers
+// and matching pattern subscribers.
+func (n *notifier) publishLocked(ds []delivery, channel, payload string) []delivery {
+	for c := range n.channels[channel] {
+		ds = append(ds, delivery{c, encodeMessage(c.Protocol(), "", channel, payload)})
+	}
+	for pattern, conns := range n.patterns {
+		if !matchGlob(pattern, channel) {
+			continue
+		}
+		for c := range conns {
+			ds = append(ds, delivery{c, encodeMessage(c.Protocol(), pattern, channel, payload)})
+		}
+	}
+	return ds
+}
+
+// invalidateLocked builds the invalidation messages for keys, one per
+// interested client, and stops tracking the keys in default mode.
+func (n *notifier) invalidateLocked(keys []string) []delivery {
+	if len(n.trackers) == 0 {
+		for _, key := range keys {
+			delete(n.tracked, key)
+		}
+		return nil
+	}
+
+	pending := make(map[*Conn][]string)
+	for _, key := range keys {
+		for c := range n.tracked[key] {
+			if t := n.trackers[c]; t != nil && !t.bcast {
+				pending[c] = append(pending[c], key)
+			}
+		}
+		delete(n.tracked, key)
+
+		for c, t := range n.trackers {
+			if t.bcast && t.matches(key) {
+				pending[c] = append(pending[c], key)
+			}
+		}
+	}
+
+	var ds []delivery
+	for c, keys := range pending {
+		if d, ok := n.invalidationLocked(c, n.trackers[c], keys); ok {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// invalidationLocked addresses an invalidation of keys tracked by c, to c
+// itself or its REDIRECT target.
+func (n *notifier) invalidationLocked(c *Conn, t *trackingState, keys []string) (delivery, bool) {
+	if t.redirect == 0 {
+		return delivery{c, encodeInvalidate(keys)}, true
+	}
+
+	var target *Conn
+	if n.lookup != nil {
+		target, _ = n.lookup(t.redirect)
+	}
+	switch {
+	case target == nil:
+		if c.Protocol() < 3 {
+			return delivery{}, false
+		}
+		return delivery{c, encodePush("tracking-redir-broken", strconv.FormatInt(t.redirect, 10))}, true
+	case target.Protocol() >= 3:
+		return delivery{target, encodeInvalidate(keys)}, true
+	default:
+		// RESP2 targets receive invalidations as pub/sub messages, only
+		// while subscribed to the invalidation channel.
+		if _, ok := n.channels[invalidateChannel][target]; !ok {
+			return delivery{}, false
+		}
+		return delivery{target, encodeFrame(func(w *bufio.Writer) {
+			_ = WriteArrayHeader(w, 3)
+			_ = WriteBulkString(w, "message")
+			_ = WriteBulkString(w, invalidateChannel)
+			writeStringArray(w, keys)
+		})}, true
+	}
+}
+
+// encodeFrame renders a message written by fn.
+func encodeFrame(fn func(w *bufio.Writer)) []byte {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	fn(w)
+	_ = w.Flush()
+	return buf.Bytes()
+}
+
+// writePushOrArrayHeader writes a push header for RESP3 and an array
+// header for RESP2, the framing of pub/sub messages.
+func writePushOrArrayHeader(w *bufio.Writer, proto, n int) {
+	if proto >= 3 {
+		_ = WritePushHeader(w, n)
+		return
+	}
+	_ = WriteArrayHeader(w, n)
+}
+
+func writeStringArray(w *bufio.Writer, items []string) {
+	_ = WriteArrayHeader(w, len(items))
+	for _, s := range items {
+		_ = WriteBulkString(w, s)
+	}
+}
+
+// encodeMessage renders a pub/sub "message", or a "pmessage" if pattern
+// is set.
+func encodeMessage(proto int, pattern, channel, payload string) []byte {
+	return encodeFrame(func(w *bufio.Writer) {
+		if pattern == "" {
+			writePushOrArrayHeader(w, proto, 3)
+			_ = WriteBulkString(w, "message")
+		} else {
+			writePushOrArrayHeader(w, proto, 4)
+			_ = WriteBulkString(w, "pmessage")
+			_ = WriteBulkString(w, pattern)
+		}
+		_ = WriteBulkString(w, channel)
+		_ = WriteBulkString(w, payload)
+	})
+}
+
+// encodeInvalidate renders the RESP3 invalidate push for keys.
+func encodeInvalidate(keys []string) []byte {
+	return encodeFrame(func(w *bufio.Writer) {
+		_ = WritePushHeader(w, 2)
+		_ = WriteBulkString(w, "invalidate")
+		writeStringArray(w, keys)
+	})
+}
+
+// encodePush renders a RESP3 push of strings.
+func encodePush(items ...string) []byte {
+	return encodeFrame(func(w *bufio.Writer) {
+		_ = WritePushHeader(w, len(items))
+		for _, s := range items {
+			_ = WriteBulkString(w, s)
+		}
+	})
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+// Package redisserver provides a Redis protocol compatible server.
+package redisserver
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SUBSCRIBE channel [channel ...]
+// PSUBSCRIBE pattern [pattern ...]
+//
+// Replies with one subscribe (psubscribe) message per channel, carrying the
+// client's subscription count. Only keyspace notification channels and
+// __redis__:invalidate ever receive messages; PUBLISH is not supported.
+//
+// @design DS-0301
+func (h *CommandHandler) handleSubscribe(conn *Conn, args [][]byte, pattern bool) {
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+	for _, name := range args[1:] {
+		n := h.notify.subscribe(conn, string(name), pattern)
+		writeSubscriptionReply(conn, kind, string(name), true, n)
+	}
+}
+
+// UNSUBSCRIBE [channel ...]
+// PUNSUBSCRIBE [pattern ...]
+//
+// Without arguments, removes every channel (pattern) subscription.
+func (h *CommandHandler) handleUnsubscribe(conn *Conn, args [][]byte, pattern bool) {
+	kind := "unsubscribe"
+	if pattern {
+		kind = "punsubscribe"
+	}
+
+	names := make([]string, 0, len(args)-1)
+	for _, name := range args[1:] {
+		names = append(names, string(name))
+	}
+	if len(names) == 0 {
+		names = h.notify.subscribed(conn, pattern)
+	}
+	if len(names) == 0 {
+		writeSubscriptionReply(conn, kind, "", false, int(conn.subscriptions.Load()))
+		return
+	}
+	for _, name := range names {
+		n := h.notify.unsubscribe(conn, name, pattern)
+		writeSubscriptionReply(conn, kind, name, true, n)
+	}
+}
+
+// writeSubscriptionReply writes a (un)subscribe confirmation: a push under
+// RESP3, an array under RESP2. A missing channel is written as null.
+func writeSubscriptionReply(conn *Conn, kind, name string, hasName bool, count int) {
+	conn.writePushHeader(3)
+	_ = WriteBulkString(conn.bw, kind)
+	if hasName {
+		_ = WriteBulkString(conn.bw, name)
+	} else {
+		conn.writeNull()
+	}
+	_ = WriteInteger(conn.bw, int64(count))
+}
+
+// subscribedModeCommand reports whether a RESP2 client with subscriptions
+// may run cmdName. Such a client's connection carries pub/sub messages, so
+// like Redis only subscription management, PING and QUIT are allowed.
+func subscribedModeCommand(cmdName string) bool {
+	switch cmdName {
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+		return true
+	}
+	return false
+}
+
+// CLIENT TRACKING ON|OFF [REDIRECT client-id] [BCAST] [PREFIX prefix ...]
+//
+// Enables client-side caching invalidations. In default mode the client is
+// told when a session it read is revoked or expires; in BCAST mode when
+// any session matching one of its prefixes is. Invalidations are sent as
+// RESP3 push messages, or to the REDIRECT client, so a client without
+// REDIRECT must use RESP3. OPTIN, OPTOUT and NOLOOP are not supported.
+//
+// @design DS-0301
+func (h *CommandHandler) handleClientTracking(conn *Conn, args [][]byte) {
+	if len(args) < 3 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'CLIENT|TRACKING' command")
+		return
+	}
+
+	var on bool
+	switch strings.ToUpper(string(args[2])) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		_ = WriteError(conn.bw, "ERR syntax error")
+		return
+	}
+
+	t := &trackingState{}
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch opt {
+		case "REDIRECT":
+			if i+1 >= len(args) {
+				_ = WriteError(conn.bw, "ERR syntax error")
+				return
+			}
+			i++
+			id, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil || id <= 0 {
+				_ = WriteError(conn.bw, "ERR Invalid client ID")
+				return
+			}
+			t.redirect = id
+		case "BCAST":
+			t.bcast = true
+		case "PREFIX":
+			if i+1 >= len(args) {
+				_ = WriteError(conn.bw, "ERR syntax error")
+				return
+			}
+			i++
+			t.prefixes = append(t.prefixes, string(args[i]))
+		case "OPTIN", "OPTOUT", "NOLOOP":
+			_ = WriteError(conn.bw, "ERR TM-ARG-4001 CLIENT TRACKING "+opt+" is not supported")
+			return
+		default:
+			_ = WriteError(conn.bw, "ERR syntax error")
+			return
+		}
+	}
+
+	if !on {
+		h.notify.setTracking(conn, nil)
+		_ = WriteSimpleString(conn.bw, "OK")
+		return
+	}
+
+	if len(t.prefixes) > 0 && !t.bcast {
+		_ = WriteError(conn.bw, "ERR PREFIX option requires BCAST mode to be enabled")
+		return
+	}
+	if t.redirect != 0 && t.redirect == conn.ID() {
+		_ = WriteError(conn.bw, "ERR TM-ARG-4001 a client cannot redirect invalidations to itself")
+		return
+	}
+	if t.redirect != 0 {
+		if _, ok := h.client(t.redirect); !ok {
+			_ = WriteError(conn.bw, "ERR The client ID you want redirect to does not exist")
+			return
+		}
+	} else if conn.Protocol() < 3 {
+		_ = WriteError(conn.bw, "ERR TM-ARG-4001 CLIENT TRACKING without REDIRECT requires RESP3 (HELLO 3)")
+		return
+	}
+
+	h.notify.setTracking(conn, t)
+	_ = WriteSimpleString(conn.bw, "OK")
+}
+
+// client returns the connected client with the given ID.
+func (h *CommandHandler) client(id int64) (*Conn, bool) {
+	if h.srv == nil {
+		return nil, false
+	}
+	return h.srv.client(id)
+}
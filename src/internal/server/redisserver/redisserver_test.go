@@ -3,10 +3,19 @@ package redisserver
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,8 +29,9 @@ import (
 
 // mockSessionRepo implements service.SessionRepository for testing
 type mockSessionRepo struct {
-	sessions map[string]*domain.Session
-	mu       sync.RWMutex
+	sessions   map[string]*domain.Session
+	durability domain.Durability // requested by the last Create
+	mu         sync.RWMutex
 }
 
 func newMockSessionRepo() *mockSessionRepo {
@@ -34,6 +44,7 @@ func (r *mockSessionRepo) Create(ctx context.Context, session *domain.Session) e
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.sessions[session.ID] = session
+	r.durability = service.DurabilityFromContext(ctx)
 	return nil
 }
 
@@ -49,9 +60,14 @@ func (r *mockSessionRepo) Get(ctx context.Context, id string) (*domain.Session,
 func (r *mockSessionRepo) Update(ctx context.Context, session *domain.Session, expectedVersion uint64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, ok := r.sessions[session.ID]; !ok {
+	existing, ok := r.sessions[session.ID]
+	if !ok {
 		return domain.ErrSessionNotFound
 	}
+	if existing.Version != expectedVersion {
+		return domain.ErrSessionVersionConflict
+	}
+	session.Version = expectedVersion + 1
 	r.sessions[session.ID] = session
 	return nil
 }
@@ -690,3 +706,279 @@ func TestServer_ServeConn_ProtocolError(t *testing.T) {
 		t.Error("Connection not closed after protocol error")
 	}
 }
+
+// writeCountingConn counts Write calls on the server side of a connection.
+type writeCountingConn struct {
+	net.Conn
+	writes atomic.Int32
+}
+
+func (c *writeCountingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+func TestServer_ServeConn_PipelineSingleWrite(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+	srv := New(&Config{ReadTimeout: time.Second, WriteTimeout: time.Second, IdleTimeout: time.Second}, sessionSvc, tokenSvc, authSvc, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	counting := &writeCountingConn{Conn: server}
+
+	done := make(chan struct{})
+	go func() {
+		srv.serveConn(context.Background(), newConn(counting))
+		close(done)
+	}()
+
+	// Fits the connection's read buffer, so the server receives it at once.
+	const n = 250
+	pipeline := strings.Repeat("*1\r\n$4\r\nPING\r\n", n)
+	go client.Write([]byte(pipeline))
+
+	want := strings.Repeat("+PONG\r\n", n)
+	buf := make([]byte, len(want))
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(client, buf); err != nil {
+		t.Fatalf("read replies: %v", err)
+	}
+	if string(buf) != want {
+		t.Fatal("unexpected pipeline replies")
+	}
+
+	// All replies to commands received in one read go out in one write.
+	if got := counting.writes.Load(); got != 1 {
+		t.Errorf("writes = %d, want 1 for a %d-command pipeline", got, n)
+	}
+
+	client.Close()
+	<-done
+}
+
+func TestServer_ServeConn_OutputBufferLimit(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+	srv := New(&Config{
+		ReadTimeout:       time.Second,
+		WriteTimeout:      time.Second,
+		IdleTimeout:       time.Second,
+		OutputBufferLimit: 64,
+	}, sessionSvc, tokenSvc, authSvc, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		srv.serveConn(context.Background(), newConn(server))
+		close(done)
+	}()
+
+	// A single reply larger than the limit disconnects the client.
+	payload := strings.Repeat("x", 100)
+	go client.Write([]byte(fmt.Sprintf("*2\r\n$4\r\nPING\r\n$%d\r\n%s\r\n", len(payload), payload)))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed after exceeding the output buffer limit")
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _ := client.Read(make([]byte, 256)); n != 0 {
+		t.Errorf("received %d bytes, want none", n)
+	}
+}
+
+func TestServer_ServeConn_PartialCommandFlushes(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+	srv := New(&Config{ReadTimeout: time.Second, WriteTimeout: time.Second, IdleTimeout: time.Second}, sessionSvc, tokenSvc, authSvc, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go srv.serveConn(context.Background(), newConn(server))
+
+	// A complete command followed by the start of another must still be
+	// answered without waiting for the rest.
+	go client.Write([]byte("*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPI"))
+
+	buf := make([]byte, 7)
+	client.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "+PONG\r\n" {
+		t.Fatalf("reply = %q, %v", buf, err)
+	}
+}
+
+func TestServer_Start_RefusesPlainNonLoopback(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+
+	srv := New(&Config{PlainEnabled: true, PlainAddress: "0.0.0.0:0"}, sessionSvc, tokenSvc, authSvc, nil)
+	if err := srv.Start(context.Background()); err == nil {
+		srv.Shutdown(context.Background())
+		t.Fatal("Start() should refuse plaintext on a non-loopback address")
+	}
+}
+
+// generateTLSTestCert generates a self-signed certificate for commonName.
+func generateTLSTestCert(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServer_ServeConn_ClientCertAuth(t *testing.T) {
+	sessionSvc, tokenSvc, authSvc := newTestServices()
+	createResp, err := authSvc.CreateAPIKey(context.Background(), &service.CreateAPIKeyRequest{
+		Name: "gateway",
+		Role: string(domain.RoleAdmin),
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error = %v", err)
+	}
+
+	serverCert := generateTLSTestCert(t, "tokmesh")
+	clientCert := generateTLSTestCert(t, "gateway")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+
+	tests := []struct {
+		name        string
+		certAPIKeys map[string]string
+		want        string
+	}{
+		{"mapped identity", map[string]string{"CN=gateway": createResp.KeyID}, "$-1\r\n"},
+		{"unmapped identity", map[string]string{"CN=other": createResp.KeyID}, "-NOAUTH"},
+		{"unknown key", map[string]string{"CN=gateway": "tmak-missing"}, "-NOAUTH"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New(&Config{
+				ReadTimeout:  time.Second,
+				WriteTimeout: time.Second,
+				IdleTimeout:  time.Second,
+				CertAPIKeys:  tt.certAPIKeys,
+			}, sessionSvc, tokenSvc, authSvc, nil)
+
+			server, client := net.Pipe()
+			tlsServer := tls.Server(server, &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.VerifyClientCertIfGiven,
+				ClientCAs:    clientCAs,
+			})
+			tlsClient := tls.Client(client, &tls.Config{
+				Certificates:       []tls.Certificate{clientCert},
+				InsecureSkipVerify: true,
+			})
+			defer tlsClient.Close()
+
+			done := make(chan struct{})
+			go func() {
+				srv.serveConn(context.Background(), newConn(tlsServer))
+				close(done)
+			}()
+
+			tlsClient.SetDeadline(time.Now().Add(2 * time.Second))
+			if _, err := tlsClient.Write([]byte("*2\r\n$6\r\nCLIENT\r\n$7\r\nGETNAME\r\n")); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			buf := make([]byte, 256)
+			n, err := tlsClient.Read(buf)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if got := string(buf[:n]); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("CLIENT GETNAME = %q, want prefix %q", got, tt.want)
+			}
+
+			tlsClient.Close()
+			<-done
+		})
+	}
+}
+
+func TestServer_ServeConn_PushWhileIdle(t *testing.T) {
+	sessionRepo := newMockSessionRepo()
+	tokenSvc := service.NewTokenService(newMockTokenRepo(), nil)
+	sessionSvc := service.NewSessionService(sessionRepo, tokenSvc)
+	authSvc := service.NewAuthService(newMockAPIKeyRepo(), nil)
+
+	ctx := context.Background()
+	now := time.Now()
+	_ = sessionRepo.Create(ctx, &domain.Session{
+		ID:        "tmss-push",
+		UserID:    "user1",
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(time.Hour).UnixMilli(),
+		Version:   1,
+	})
+	key, err := authSvc.CreateAPIKey(ctx, &service.CreateAPIKeyRequest{Name: "validator", Role: "validator"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+
+	// An idle timeout shorter than the wait below: subscribed clients are exempt.
+	srv := New(&Config{ReadTimeout: time.Second, WriteTimeout: time.Second, IdleTimeout: 50 * time.Millisecond}, sessionSvc, tokenSvc, authSvc, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn := newConn(server)
+		srv.registerConn(conn)
+		defer srv.unregisterConn(conn)
+		srv.serveConn(ctx, conn)
+	}()
+
+	expect := func(want string) {
+		t.Helper()
+		buf := make([]byte, len(want))
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := io.ReadFull(client, buf); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if string(buf) != want {
+			t.Fatalf("read %q, want %q", buf, want)
+		}
+	}
+
+	go client.Write([]byte(fmt.Sprintf("*3\r\n$4\r\nAUTH\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n"+
+		"*2\r\n$9\r\nSUBSCRIBE\r\n$18\r\n__keyevent@0__:del\r\n",
+		len(key.KeyID), key.KeyID, len(key.Secret), key.Secret)))
+	expect("+OK\r\n*3\r\n$9\r\nsubscribe\r\n$18\r\n__keyevent@0__:del\r\n:1\r\n")
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := sessionSvc.Revoke(ctx, &service.RevokeSessionRequest{SessionID: "tmss-push"}); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	expect("*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:del\r\n$9\r\ntmss-push\r\n")
+
+	client.Close()
+	<-done
+	srv.handler.notify.mu.Lock()
+	defer srv.handler.notify.mu.Unlock()
+	if len(srv.handler.notify.subs) != 0 {
+		t.Error("disconnected client should be unsubscribed")
+	}
+}
@@ -0,0 +1,128 @@
+// Package redisserver provides a Redis protocol compatible server.
+package redisserver
+
+import (
+	"sort"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// Protocol-aware replies.
+//
+// RESP3 types are written natively once a client negotiates RESP3 with
+// HELLO 3. RESP2 connections receive the same fallbacks Redis uses:
+// maps become flat key/value arrays, null becomes the null bulk string,
+// booleans become 0/1 integers and doubles become bulk strings.
+
+// writeNull writes a null reply.
+func (c *Conn) writeNull() {
+	if c.Protocol() >= 3 {
+		_ = WriteNull(c.bw)
+		return
+	}
+	_ = WriteNullBulk(c.bw)
+}
+
+// writeMapHeader writes a map header for n key/value pairs.
+func (c *Conn) writeMapHeader(n int) {
+	if c.Protocol() >= 3 {
+		_ = WriteMapHeader(c.bw, n)
+		return
+	}
+	_ = WriteArrayHeader(c.bw, n*2)
+}
+
+// writeSetHeader writes a set header for n elements.
+func (c *Conn) writeSetHeader(n int) {
+	if c.Protocol() >= 3 {
+		_ = WriteSetHeader(c.bw, n)
+		return
+	}
+	_ = WriteArrayHeader(c.bw, n)
+}
+
+// writePushHeader writes an out-of-band push header for n elements.
+func (c *Conn) writePushHeader(n int) {
+	if c.Protocol() >= 3 {
+		_ = WritePushHeader(c.bw, n)
+		return
+	}
+	_ = WriteArrayHeader(c.bw, n)
+}
+
+// writeBool writes a boolean reply.
+func (c *Conn) writeBool(b bool) {
+	if c.Protocol() >= 3 {
+		_ = WriteBoolean(c.bw, b)
+		return
+	}
+	if b {
+		_ = WriteInteger(c.bw, 1)
+		return
+	}
+	_ = WriteInteger(c.bw, 0)
+}
+
+// writeDouble writes a floating point reply.
+func (c *Conn) writeDouble(f float64) {
+	if c.Protocol() >= 3 {
+		_ = WriteDouble(c.bw, f)
+		return
+	}
+	_ = WriteBulkString(c.bw, formatDouble(f))
+}
+
+// writeText writes human-readable text such as INFO output.
+func (c *Conn) writeText(s string) {
+	if c.Protocol() >= 3 {
+		_ = WriteVerbatim(c.bw, "txt", s)
+		return
+	}
+	_ = WriteBulkString(c.bw, s)
+}
+
+// writeStringMap writes a map of strings with keys in sorted order.
+func (c *Conn) writeStringMap(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	c.writeMapHeader(len(keys))
+	for _, k := range keys {
+		_ = WriteBulkString(c.bw, k)
+		_ = WriteBulkString(c.bw, m[k])
+	}
+}
+
+// writeSessionMap writes a session as a native map. Timestamps are Unix
+// milliseconds and optional fields are always present (empty if unset), so
+// every session reply has the same shape.
+//
+// @design DS-0301
+func (c *Conn) writeSessionMap(s *domain.Session) {
+	c.writeMapHeader(11)
+	_ = WriteBulkString(c.bw, "id")
+	_ = WriteBulkString(c.bw, s.ID)
+	_ = WriteBulkString(c.bw, "user_id")
+	_ = WriteBulkString(c.bw, s.UserID)
+	_ = WriteBulkString(c.bw, "device_id")
+	_ = WriteBulkString(c.bw, s.DeviceID)
+	_ = WriteBulkString(c.bw, "ip_address")
+	_ = WriteBulkString(c.bw, s.IPAddress)
+	_ = WriteBulkString(c.bw, "user_agent")
+	_ = WriteBulkString(c.bw, s.UserAgent)
+	_ = WriteBulkString(c.bw, "created_at")
+	_ = WriteInteger(c.bw, s.CreatedAt)
+	_ = WriteBulkString(c.bw, "expires_at")
+	_ = WriteInteger(c.bw, s.ExpiresAt)
+	_ = WriteBulkString(c.bw, "last_active")
+	_ = WriteInteger(c.bw, s.LastActive)
+	_ = WriteBulkString(c.bw, "last_access_ip")
+	_ = WriteBulkString(c.bw, s.LastAccessIP)
+	_ = WriteBulkString(c.bw, "version")
+	_ = WriteInteger(c.bw, int64(s.Version))
+	_ = WriteBulkString(c.bw, "data")
+	c.writeStringMap(s.Data)
+}
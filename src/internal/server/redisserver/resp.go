@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -57,6 +58,59 @@ func ReadCommand(r *bufio.Reader) ([][]byte, error) {
 	}
 }
 
+// commandBuffered reports whether r already holds a complete command, so
+// ReadCommand will return without waiting for the network. Malformed input
+// also reports true: ReadCommand fails on it without blocking.
+func commandBuffered(r *bufio.Reader) bool {
+	buf, _ := r.Peek(r.Buffered())
+	if len(buf) == 0 {
+		return false
+	}
+	if buf[0] != '*' {
+		return bytes.IndexByte(buf, '\n') >= 0
+	}
+
+	n, buf, ok := parseBufferedLength(buf[1:])
+	if !ok {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		if len(buf) == 0 {
+			return false
+		}
+		if buf[0] != '$' {
+			return true
+		}
+		var size int
+		if size, buf, ok = parseBufferedLength(buf[1:]); !ok {
+			return false
+		}
+		if size < 0 {
+			continue
+		}
+		if len(buf) < size+2 {
+			return false
+		}
+		buf = buf[size+2:]
+	}
+	return true
+}
+
+// parseBufferedLength parses "<n>\r\n" at the start of buf. ok is false if
+// the line is incomplete; unparsable lengths are returned as 0 so the caller
+// lets ReadCommand report them.
+func parseBufferedLength(buf []byte) (n int, rest []byte, ok bool) {
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return 0, nil, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(buf[:i])))
+	if err != nil {
+		return 0, buf[i+1:], true
+	}
+	return n, buf[i+1:], true
+}
+
 func readArrayCommand(r *bufio.Reader) ([][]byte, error) {
 	// "*<n>\r\n"
 	line, err := readLine(r, 64) // Array header is short: "*<number>\r\n"
@@ -200,6 +254,73 @@ func WriteArrayHeader(w *bufio.Writer, n int) error {
 	return err
 }
 
+// RESP3 types (https://github.com/redis/redis-specification).
+// Handlers should use the protocol-aware Conn methods in reply.go, which
+// fall back to RESP2 encodings for connections that have not sent HELLO 3.
+
+// WriteNull writes the RESP3 null.
+func WriteNull(w *bufio.Writer) error {
+	_, err := w.WriteString("_\r\n")
+	return err
+}
+
+// WriteBoolean writes a RESP3 boolean.
+func WriteBoolean(w *bufio.Writer, b bool) error {
+	if b {
+		_, err := w.WriteString("#t\r\n")
+		return err
+	}
+	_, err := w.WriteString("#f\r\n")
+	return err
+}
+
+// WriteDouble writes a RESP3 double, including inf, -inf and nan.
+func WriteDouble(w *bufio.Writer, f float64) error {
+	_, err := w.WriteString("," + formatDouble(f) + "\r\n")
+	return err
+}
+
+// WriteMapHeader writes a RESP3 map header for n key/value pairs.
+func WriteMapHeader(w *bufio.Writer, n int) error {
+	_, err := w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+	return err
+}
+
+// WriteSetHeader writes a RESP3 set header for n elements.
+func WriteSetHeader(w *bufio.Writer, n int) error {
+	_, err := w.WriteString("~" + strconv.Itoa(n) + "\r\n")
+	return err
+}
+
+// WritePushHeader writes a RESP3 push header for n elements.
+func WritePushHeader(w *bufio.Writer, n int) error {
+	_, err := w.WriteString(">" + strconv.Itoa(n) + "\r\n")
+	return err
+}
+
+// WriteVerbatim writes a RESP3 verbatim string with a three-letter format
+// such as "txt".
+func WriteVerbatim(w *bufio.Writer, format, s string) error {
+	if _, err := w.WriteString("=" + strconv.Itoa(len(format)+1+len(s)) + "\r\n" + format + ":"); err != nil {
+		return err
+	}
+	_, err := w.WriteString(s + "\r\n")
+	return err
+}
+
+// formatDouble formats f as RESP3 expects.
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
 func normalizeCommandName(b []byte) string {
 	if len(b) == 0 {
 		return ""
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -576,3 +577,93 @@ func TestRateLimiter_Disabled(t *testing.T) {
 		}
 	}
 }
+
+// ============================================================
+// RESP3 Writer Tests
+// ============================================================
+
+func TestWriteRESP3Types(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *bufio.Writer) error
+		want  string
+	}{
+		{"null", WriteNull, "_\r\n"},
+		{"true", func(w *bufio.Writer) error { return WriteBoolean(w, true) }, "#t\r\n"},
+		{"false", func(w *bufio.Writer) error { return WriteBoolean(w, false) }, "#f\r\n"},
+		{"double", func(w *bufio.Writer) error { return WriteDouble(w, 1.5) }, ",1.5\r\n"},
+		{"double inf", func(w *bufio.Writer) error { return WriteDouble(w, math.Inf(-1)) }, ",-inf\r\n"},
+		{"map", func(w *bufio.Writer) error { return WriteMapHeader(w, 2) }, "%2\r\n"},
+		{"set", func(w *bufio.Writer) error { return WriteSetHeader(w, 3) }, "~3\r\n"},
+		{"push", func(w *bufio.Writer) error { return WritePushHeader(w, 1) }, ">1\r\n"},
+		{"verbatim", func(w *bufio.Writer) error { return WriteVerbatim(w, "txt", "hi") }, "=6\r\ntxt:hi\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			if err := tt.write(w); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			_ = w.Flush()
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConnReplies_ProtocolFallback(t *testing.T) {
+	write := func(c *Conn) {
+		c.writeMapHeader(1)
+		c.writeNull()
+		c.writeBool(true)
+		c.writeDouble(0.25)
+		c.writeSetHeader(0)
+		c.writePushHeader(2)
+		c.writeText("ok")
+	}
+
+	tests := []struct {
+		proto int32
+		want  string
+	}{
+		{0, "*2\r\n$-1\r\n:1\r\n$4\r\n0.25\r\n*0\r\n*2\r\n$2\r\nok\r\n"},
+		{3, "%1\r\n_\r\n#t\r\n,0.25\r\n~0\r\n>2\r\n=6\r\ntxt:ok\r\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		c := &Conn{bw: bufio.NewWriter(&buf)}
+		c.proto.Store(tt.proto)
+		write(c)
+		_ = c.bw.Flush()
+		if buf.String() != tt.want {
+			t.Errorf("proto %d: got %q, want %q", c.Protocol(), buf.String(), tt.want)
+		}
+	}
+}
+
+func TestCommandBuffered(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"", false},
+		{"PING\r\n", true},
+		{"PIN", false},
+		{"*1\r\n$4\r\nPING\r\n", true},
+		{"*1\r\n$4\r\nPI", false},
+		{"*2\r\n$4\r\nPING\r\n", false},
+		{"*2\r\n$3\r\nGET\r\n$-1\r\n", true},
+		{"*2\r\n$3\r\nGET\r\n$1", false},
+		{"*x\r\n", true},
+		{"*1\r\n+PING\r\n", true},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.input))
+		_, _ = r.Peek(len(tt.input)) // Fill the buffer
+		if got := commandBuffered(r); got != tt.want {
+			t.Errorf("commandBuffered(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
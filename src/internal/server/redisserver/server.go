@@ -8,19 +8,36 @@ package redisserver
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/infra/tlsroots"
 )
 
+// DefaultOutputBufferLimit is the default per-client output buffer limit.
+const DefaultOutputBufferLimit = 8 * 1024 * 1024
+
+// pipelineFlushThreshold is the amount of buffered output that is written
+// out mid-pipeline instead of waiting for the pipeline to drain.
+const pipelineFlushThreshold = 64 * 1024
+
+// errOutputBufferLimit is returned when a client's pending replies exceed
+// Config.OutputBufferLimit.
+var errOutputBufferLimit = errors.New("redis: output buffer limit exceeded")
+
 // Config holds the Redis server configuration.
 type Config struct {
 	// PlainEnabled enables the plaintext Redis port (default: false for security).
@@ -33,6 +50,15 @@ type Config struct {
 	TLSAddress string
 	// TLSConfig is the TLS configuration (required if TLSEnabled is true).
 	TLSConfig *tls.Config
+	// AllowInsecurePlain permits the plaintext port on a non-loopback
+	// address. Start refuses otherwise, since AUTH secrets and tokens
+	// would cross the network in clear text.
+	AllowInsecurePlain bool
+	// CertAPIKeys maps client certificate identities to API key IDs (see
+	// tlsroots.CertIdentities, e.g. "CN=gateway" or "DNS:gw.example.com").
+	// TLS clients presenting a verified certificate with a mapped identity
+	// are authenticated as that key without AUTH.
+	CertAPIKeys map[string]string
 	// ReadTimeout is the timeout for reading a command (default: 30s).
 	// Helps prevent slowloris attacks.
 	ReadTimeout time.Duration
@@ -43,6 +69,10 @@ type Config struct {
 	// RateLimit is the maximum number of commands per second per IP (default: 1000).
 	// Set to 0 to disable rate limiting.
 	RateLimit int
+	// OutputBufferLimit is the maximum size of replies buffered for a client
+	// (default: 8MB). Clients exceeding it, e.g. by not reading replies to a
+	// large pipeline, are disconnected.
+	OutputBufferLimit int
 }
 
 // DefaultConfig returns the default configuration.
@@ -56,6 +86,8 @@ func DefaultConfig() *Config {
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  5 * time.Minute,
 		RateLimit:    1000, // 1000 commands per second per IP
+
+		OutputBufferLimit: DefaultOutputBufferLimit,
 	}
 }
 
@@ -69,12 +101,25 @@ type Server struct {
 	lnMu       sync.Mutex // protects plainLn and tlsLn
 	running    atomic.Bool
 	wg         sync.WaitGroup
+
+	// Client registry for CLIENT LIST/KILL and INFO.
+	clientsMu    sync.Mutex
+	clients      map[int64]*Conn
+	nextClientID atomic.Int64
+	startTime    time.Time
+	totalConns   atomic.Int64
+	totalCmds    atomic.Int64
 }
 
 // ConnState holds the state of a client connection.
 type ConnState struct {
 	Authenticated bool
 	APIKey        *service.APIKeyInfo
+
+	// Client metadata set by CLIENT SETNAME/SETINFO and HELLO SETNAME.
+	ClientName string
+	LibName    string
+	LibVer     string
 }
 
 // Conn represents a single Redis client connection.
@@ -86,14 +131,46 @@ type Conn struct {
 	stateMu sync.RWMutex
 	state   ConnState
 
+	// out holds replies until the connection is flushed; nil writes bw
+	// straight through (tests).
+	out          *outputBuffer
+	writeTimeout time.Duration
+
+	// MULTI state; only accessed by the connection's goroutine.
+	tx *transaction
+
+	id         int64        // Client ID, unique per server
+	createdAt  time.Time
+	proto      atomic.Int32 // Negotiated RESP version; 0 means RESP2
+	lastCmd    string       // Protected by stateMu
+	lastActive time.Time    // Protected by stateMu
+
+	// Out-of-band messages (pub/sub messages and invalidation pushes)
+	// queued by other goroutines; see queueMessage.
+	writeMu    sync.Mutex
+	oob        bytes.Buffer  // Protected by writeMu
+	idle       bool          // Protected by writeMu; waiting for a command
+	oobSignal  chan struct{} // Wakes the pusher goroutine
+	pusherOnce sync.Once
+	done       chan struct{} // Closed by Close
+
+	subscriptions atomic.Int32 // Subscribed channels and patterns
+	tracking      atomic.Bool  // CLIENT TRACKING is on, in any mode
+	trackKeys     atomic.Bool  // Keys read are recorded (default tracking mode)
+
 	closed atomic.Bool
 }
 
 func newConn(c net.Conn) *Conn {
+	out := &outputBuffer{limit: DefaultOutputBufferLimit}
 	return &Conn{
-		netConn: c,
-		br:      bufio.NewReader(c),
-		bw:      bufio.NewWriter(c),
+		netConn:   c,
+		createdAt: time.Now(),
+		br:        bufio.NewReader(c),
+		bw:        bufio.NewWriter(out),
+		out:       out,
+		oobSignal: make(chan struct{}, 1),
+		done:      make(chan struct{}),
 		state: ConnState{
 			Authenticated: false,
 			APIKey:        nil,
@@ -105,9 +182,164 @@ func (c *Conn) Close() error {
 	if !c.closed.CompareAndSwap(false, true) {
 		return nil
 	}
+	if c.done != nil {
+		close(c.done)
+	}
 	return c.netConn.Close()
 }
 
+// Flush writes all buffered replies to the client in one write, followed
+// by any out-of-band messages queued while the commands ran.
+func (c *Conn) Flush() error {
+	if err := c.bw.Flush(); err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.out != nil && c.out.Len() > 0 {
+		err := c.write(c.out.Bytes())
+		c.out.reset()
+		if err != nil {
+			return err
+		}
+	}
+	return c.writeQueuedLocked()
+}
+
+// write writes p to the client under the write timeout.
+func (c *Conn) write(p []byte) error {
+	if c.writeTimeout > 0 {
+		if err := c.netConn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	_, err := c.netConn.Write(p)
+	return err
+}
+
+// writeQueuedLocked writes the queued out-of-band messages. The caller
+// holds writeMu.
+func (c *Conn) writeQueuedLocked() error {
+	if c.oob.Len() == 0 {
+		return nil
+	}
+	err := c.write(c.oob.Bytes())
+	c.oob.Reset()
+	return err
+}
+
+// setIdle marks whether the connection is waiting for the next command.
+// Queued messages are written as soon as the connection becomes idle;
+// while a command runs they wait for its replies so the two never
+// interleave.
+func (c *Conn) setIdle(idle bool) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.idle = idle
+	if idle {
+		return c.writeQueuedLocked()
+	}
+	return nil
+}
+
+// queueMessage queues an out-of-band message for the client. It may be
+// called from any goroutine and never blocks on the network: the message
+// is written by the connection's pusher goroutine if the connection is
+// idle, or after the replies of the commands being handled otherwise. A
+// client whose queue grows past its output buffer limit is disconnected.
+func (c *Conn) queueMessage(msg []byte) {
+	if c.closed.Load() {
+		return
+	}
+
+	limit := DefaultOutputBufferLimit
+	if c.out != nil {
+		limit = c.out.limit
+	}
+	c.writeMu.Lock()
+	if limit > 0 && c.oob.Len()+len(msg) > limit {
+		c.writeMu.Unlock()
+		_ = c.Close()
+		return
+	}
+	c.oob.Write(msg)
+	c.writeMu.Unlock()
+
+	if c.done == nil {
+		return
+	}
+	c.pusherOnce.Do(func() { go c.pushLoop() })
+	select {
+	case c.oobSignal <- struct{}{}:
+	default:
+	}
+}
+
+// pushLoop writes queued messages while the connection is idle.
+func (c *Conn) pushLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.oobSignal:
+		}
+
+		c.writeMu.Lock()
+		var err error
+		if c.idle {
+			err = c.writeQueuedLocked()
+		}
+		c.writeMu.Unlock()
+		if err != nil {
+			_ = c.Close()
+			return
+		}
+	}
+}
+
+// listening reports whether the connection waits for pushed messages, and
+// is therefore exempt from the idle timeout.
+func (c *Conn) listening() bool {
+	return c.subscriptions.Load() > 0 || c.tracking.Load()
+}
+
+// pendingOutput returns the number of reply bytes not yet written.
+func (c *Conn) pendingOutput() int {
+	n := c.bw.Buffered()
+	if c.out != nil {
+		n += c.out.Len()
+	}
+	return n
+}
+
+// outputBuffer accumulates a connection's replies in memory between
+// flushes, up to limit bytes. Replies never block on a slow client while
+// a command runs; the client is disconnected instead once the limit is hit.
+type outputBuffer struct {
+	bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (o *outputBuffer) Write(p []byte) (int, error) {
+	if o.limit > 0 && o.Len()+len(p) > o.limit {
+		o.exceeded = true
+		return 0, errOutputBufferLimit
+	}
+	return o.Buffer.Write(p)
+}
+
+// reset empties the buffer, releasing memory grown by an unusually large
+// batch of replies.
+func (o *outputBuffer) reset() {
+	if o.Cap() > 4*pipelineFlushThreshold {
+		o.Buffer = bytes.Buffer{}
+		return
+	}
+	o.Reset()
+}
+
 func (c *Conn) RemoteAddr() net.Addr {
 	return c.netConn.RemoteAddr()
 }
@@ -125,6 +357,45 @@ func (c *Conn) SetState(st ConnState) {
 	c.state = st
 }
 
+// UpdateState modifies the connection state in place, preserving fields
+// fn does not touch.
+func (c *Conn) UpdateState(fn func(st *ConnState)) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	fn(&c.state)
+}
+
+// requestContext returns the context of the connection's commands,
+// requesting the write durability of its API key.
+func (c *Conn) requestContext() context.Context {
+	ctx := context.Background()
+	if st := c.GetState(); st.APIKey != nil {
+		ctx = service.WithDurability(ctx, domain.Durability(st.APIKey.Durability))
+	}
+	return ctx
+}
+
+// ID returns the client ID reported by CLIENT ID and HELLO.
+func (c *Conn) ID() int64 {
+	return c.id
+}
+
+// Protocol returns the negotiated RESP version (2 or 3).
+func (c *Conn) Protocol() int {
+	if p := c.proto.Load(); p != 0 {
+		return int(p)
+	}
+	return 2
+}
+
+// recordCommand notes the command being executed for CLIENT LIST.
+func (c *Conn) recordCommand(cmdName string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.lastCmd = strings.ToLower(cmdName)
+	c.lastActive = time.Now()
+}
+
 // New creates a new Redis protocol server.
 func New(cfg *Config, sessionSvc *service.SessionService, tokenSvc *service.TokenService, authSvc *service.AuthService, logger *slog.Logger) *Server {
 	if cfg == nil {
@@ -135,8 +406,10 @@ func New(cfg *Config, sessionSvc *service.SessionService, tokenSvc *service.Toke
 	}
 
 	s := &Server{
-		cfg:    cfg,
-		logger: logger,
+		cfg:       cfg,
+		logger:    logger,
+		clients:   make(map[int64]*Conn),
+		startTime: time.Now(),
 	}
 
 	s.handler = NewCommandHandler(sessionSvc, tokenSvc, authSvc, s, logger)
@@ -151,6 +424,10 @@ func (s *Server) Start(ctx context.Context) error {
 		return nil
 	}
 
+	if s.cfg.PlainEnabled && !s.cfg.AllowInsecurePlain && !tlsroots.IsLoopbackAddr(s.cfg.PlainAddress) {
+		return fmt.Errorf("redisserver: refusing plaintext listener on non-loopback address %s: use TLS or allow insecure plaintext explicitly", s.cfg.PlainAddress)
+	}
+
 	s.running.Store(true)
 
 	// Start plain server if enabled
@@ -209,6 +486,17 @@ func (s *Server) startTLS(ctx context.Context) error {
 	return s.acceptLoop(ctx, ln)
 }
 
+// Addr returns the address of the plaintext listener, or nil until it is
+// listening. It is useful when PlainAddress uses port 0.
+func (s *Server) Addr() net.Addr {
+	s.lnMu.Lock()
+	defer s.lnMu.Unlock()
+	if s.plainLn == nil {
+		return nil
+	}
+	return s.plainLn.Addr()
+}
+
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.running.Store(false)
@@ -270,11 +558,81 @@ func (s *Server) acceptLoop(ctx context.Context, ln net.Listener) error {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			s.serveConn(ctx, newConn(c))
+			conn := newConn(c)
+			s.registerConn(conn)
+			defer s.unregisterConn(conn)
+			s.serveConn(ctx, conn)
 		}()
 	}
 }
 
+// handshake completes the TLS handshake of a new connection and
+// authenticates it by client certificate if the certificate maps to an API
+// key.
+func (s *Server) handshake(c *Conn, tlsConn *tls.Conn, timeout time.Duration) bool {
+	if err := tlsConn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return false
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		s.logger.Debug("tls handshake failed", "remote", c.RemoteAddr(), "error", err)
+		return false
+	}
+	if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+		return false
+	}
+
+	// Only certificates verified against the configured client CAs count.
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) > 0 && len(s.cfg.CertAPIKeys) > 0 {
+		s.handler.authenticateCertificate(c, chains[0][0], s.cfg.CertAPIKeys)
+	}
+	return true
+}
+
+// registerConn assigns the connection a client ID and tracks it.
+func (s *Server) registerConn(c *Conn) {
+	c.id = s.nextClientID.Add(1)
+	s.totalConns.Add(1)
+	s.clientsMu.Lock()
+	s.clients[c.id] = c
+	s.clientsMu.Unlock()
+}
+
+func (s *Server) unregisterConn(c *Conn) {
+	s.clientsMu.Lock()
+	delete(s.clients, c.id)
+	s.clientsMu.Unlock()
+	s.handler.notify.removeClient(c)
+}
+
+// client returns the connected client with the given ID.
+func (s *Server) client(id int64) (*Conn, bool) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	c, ok := s.clients[id]
+	return c, ok
+}
+
+// connections returns the connected clients ordered by ID.
+func (s *Server) connections() []*Conn {
+	s.clientsMu.Lock()
+	conns := make([]*Conn, 0, len(s.clients))
+	for _, c := range s.clients {
+		conns = append(conns, c)
+	}
+	s.clientsMu.Unlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+	return conns
+}
+
+// serveConn runs the command loop of a connection.
+//
+// Replies are buffered and flushed once every complete command already
+// received has been handled, so a pipeline of N commands costs one write
+// instead of N. Large pipelines are flushed every pipelineFlushThreshold
+// bytes to bound latency.
+//
+// @design DS-0301
 func (s *Server) serveConn(ctx context.Context, c *Conn) {
 	defer c.Close()
 
@@ -291,23 +649,50 @@ func (s *Server) serveConn(ctx context.Context, c *Conn) {
 	if idleTimeout == 0 {
 		idleTimeout = 5 * time.Minute
 	}
+	c.writeTimeout = writeTimeout
+
+	if tlsConn, ok := c.netConn.(*tls.Conn); ok && !s.handshake(c, tlsConn, readTimeout) {
+		return
+	}
+	if c.out != nil && s.cfg.OutputBufferLimit > 0 {
+		c.out.limit = s.cfg.OutputBufferLimit
+	}
 
 	for {
-		// First byte: allow idle timeout (connection can stay idle between commands).
-		if err := c.netConn.SetReadDeadline(time.Now().Add(idleTimeout)); err != nil {
-			return
+		// Flush once the pipeline is drained (the next read would block).
+		if !commandBuffered(c.br) || c.pendingOutput() >= pipelineFlushThreshold {
+			if err := c.Flush(); err != nil {
+				return
+			}
 		}
-		if _, err := c.br.Peek(1); err != nil {
-			if errors.Is(err, io.EOF) {
+
+		if c.br.Buffered() == 0 {
+			// First byte: allow idle timeout (connection can stay idle between commands).
+			// Subscribed and tracking clients wait for pushes and never time out.
+			deadline := time.Now().Add(idleTimeout)
+			if c.listening() {
+				deadline = time.Time{}
+			}
+			if err := c.netConn.SetReadDeadline(deadline); err != nil {
 				return
 			}
-			var netErr net.Error
-			if errors.As(err, &netErr) && netErr.Timeout() {
-				s.logger.Debug("connection timed out", "remote", c.RemoteAddr())
+			if err := c.setIdle(true); err != nil {
+				return
+			}
+			_, err := c.br.Peek(1)
+			_ = c.setIdle(false)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					s.logger.Debug("connection timed out", "remote", c.RemoteAddr())
+					return
+				}
+				s.logger.Debug("connection read error", "remote", c.RemoteAddr(), "error", err)
 				return
 			}
-			s.logger.Debug("connection read error", "remote", c.RemoteAddr(), "error", err)
-			return
 		}
 
 		// After first byte: tighten to per-command read timeout (slowloris protection).
@@ -329,32 +714,29 @@ func (s *Server) serveConn(ctx context.Context, c *Conn) {
 			// Check for limit exceeded (potential attack)
 			if errors.Is(err, ErrLimitExceeded) {
 				s.logger.Warn("protocol limit exceeded", "remote", c.RemoteAddr(), "error", err)
-				_ = c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
 				_ = WriteError(c.bw, "ERR protocol limit exceeded")
-				_ = c.bw.Flush()
+				_ = c.Flush()
 				return // Close connection on limit violation
 			}
-			_ = c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			_ = WriteError(c.bw, "ERR protocol error: "+err.Error())
-			_ = c.bw.Flush()
+			_ = c.Flush()
 			return
 		}
 
 		if len(args) == 0 {
-			_ = c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			_ = WriteError(c.bw, "ERR no command")
-			_ = c.bw.Flush()
 			continue
 		}
 
 		_ = ctx // reserved for future cancellation integration
 		s.handler.Handle(c, args)
 
-		// Set write deadline before flushing response
-		if err := c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		if c.out != nil && c.out.exceeded {
+			s.logger.Warn("client output buffer limit exceeded, closing connection",
+				"remote", c.RemoteAddr(), "limit", c.out.limit)
 			return
 		}
-		if err := c.bw.Flush(); err != nil {
+		if c.closed.Load() {
 			return
 		}
 	}
@@ -0,0 +1,128 @@
+// Package redisserver provides a Redis protocol compatible server.
+//
+// This file contains MULTI/EXEC/DISCARD transactions.
+package redisserver
+
+import "strconv"
+
+// MaxQueuedCommands limits the number of commands queued by MULTI.
+const MaxQueuedCommands = 1000
+
+// transaction is the state of a connection between MULTI and EXEC.
+type transaction struct {
+	queue [][][]byte
+	// aborted is set when a command failed to queue; EXEC then discards
+	// the transaction.
+	aborted bool
+}
+
+// MULTI
+//
+// Starts a transaction. Subsequent commands are checked (existence, arity,
+// permission) and queued instead of executed; EXEC runs them.
+//
+// @design DS-0301
+func (h *CommandHandler) handleMulti(conn *Conn, args [][]byte) {
+	if len(args) != 1 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'MULTI' command")
+		return
+	}
+	if conn.tx != nil {
+		_ = WriteError(conn.bw, "ERR MULTI calls can not be nested")
+		return
+	}
+	conn.tx = &transaction{}
+	_ = WriteSimpleString(conn.bw, "OK")
+}
+
+// queueCommand validates a command issued inside MULTI and queues it.
+// A command that cannot be queued aborts the transaction.
+func (h *CommandHandler) queueCommand(conn *Conn, state *ConnState, cmdName string, args [][]byte) {
+	tx := conn.tx
+
+	spec, ok := lookupCommand(cmdName)
+	switch {
+	case !ok:
+		_ = WriteError(conn.bw, "ERR unknown command '"+cmdName+"'")
+	case !validArity(spec, len(args)):
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for '"+spec.name+"' command")
+	case spec.group == "pubsub":
+		// Subscription replies are one message per channel, which does
+		// not fit the one-reply-per-command EXEC array.
+		_ = WriteError(conn.bw, "ERR Command not allowed inside a transaction")
+	case !h.checkPermission(state, cmdName):
+		_ = WriteError(conn.bw, "ERR TM-AUTH-4030 permission denied for command '"+cmdName+"'")
+	case len(tx.queue) >= MaxQueuedCommands:
+		_ = WriteError(conn.bw, "ERR TM-ARG-4002 maximum "+strconv.Itoa(MaxQueuedCommands)+" commands per transaction")
+	default:
+		tx.queue = append(tx.queue, args)
+		_ = WriteSimpleString(conn.bw, "QUEUED")
+		return
+	}
+	tx.aborted = true
+}
+
+// validArity reports whether argc (including the command name) satisfies
+// the command's arity.
+func validArity(spec *commandSpec, argc int) bool {
+	if spec.arity >= 0 {
+		return argc == spec.arity
+	}
+	return argc >= -spec.arity
+}
+
+// EXEC
+//
+// Runs the queued commands and replies with an array of their replies.
+// No other Redis client command runs while the transaction executes, so
+// a transaction can e.g. revoke a user's old sessions and create a new one
+// without another client observing the intermediate state. Like Redis,
+// a command failing at run time does not roll back the others.
+//
+// Isolation covers the RESP interface only; HTTP API requests may still
+// interleave.
+//
+// @design DS-0301
+func (h *CommandHandler) handleExec(conn *Conn, args [][]byte) {
+	if len(args) != 1 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'EXEC' command")
+		return
+	}
+	tx := conn.tx
+	if tx == nil {
+		_ = WriteError(conn.bw, "ERR EXEC without MULTI")
+		return
+	}
+	conn.tx = nil
+
+	if tx.aborted {
+		_ = WriteError(conn.bw, "EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+
+	h.txMu.Lock()
+	defer h.txMu.Unlock()
+
+	_ = WriteArrayHeader(conn.bw, len(tx.queue))
+	for _, cmd := range tx.queue {
+		h.execute(conn, normalizeCommandName(cmd[0]), cmd)
+	}
+}
+
+// DISCARD
+//
+// Abandons the transaction without running the queued commands.
+//
+// @design DS-0301
+func (h *CommandHandler) handleDiscard(conn *Conn, args [][]byte) {
+	if len(args) != 1 {
+		_ = WriteError(conn.bw, "ERR wrong number of arguments for 'DISCARD' command")
+		return
+	}
+	if conn.tx == nil {
+		_ = WriteError(conn.bw, "ERR DISCARD without MULTI")
+		return
+	}
+	conn.tx = nil
+	_ = WriteSimpleString(conn.bw, "OK")
+}
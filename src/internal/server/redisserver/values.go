@@ -0,0 +1,144 @@
+// Package redisserver provides a Redis protocol compatible server.
+//
+// This file contains the opaque string values that the generic key
+// commands store under keys other than session IDs, such as the
+// sess:<id> keys of express-session or the cache keys of Django.
+package redisserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// An opaque value is stored as a session of its own: its ID is derived
+// from the key, its user ID is its ID, and its Data holds the key and the
+// value, split into fields of at most MaxDataValueLength bytes. Values
+// that are not valid UTF-8 are stored base64-encoded.
+const (
+	valueKeyField      = "_redis_key"
+	valueEncodingField = "_redis_encoding"
+	valueFieldPrefix   = "_redis_value_"
+)
+
+// isSessionKey reports whether key names a session rather than a value.
+func isSessionKey(key string) bool {
+	return strings.HasPrefix(strings.ToLower(key), domain.SessionIDPrefix)
+}
+
+// keySessionID returns the ID of the session stored under key: key itself
+// for a session ID, else the ID derived from it.
+func keySessionID(key []byte) string {
+	if isSessionKey(string(key)) {
+		return string(key)
+	}
+	var id ulid.ULID
+	sum := sha256.Sum256(key)
+	copy(id[:], sum[:])
+	return domain.SessionIDPrefix + strings.ToLower(id.String())
+}
+
+// sessionKey returns the key a session is stored under.
+func sessionKey(session *domain.Session) string {
+	if key, ok := session.Data[valueKeyField]; ok {
+		return key
+	}
+	return session.ID
+}
+
+// encodeValue returns the Data of the session storing value under key.
+func encodeValue(key string, value []byte) map[string]string {
+	s := string(value)
+	data := map[string]string{valueKeyField: key}
+	if !utf8.ValidString(s) {
+		s = base64.StdEncoding.EncodeToString(value)
+		data[valueEncodingField] = "base64"
+	}
+	for i := 0; len(s) > 0; i++ {
+		n := min(len(s), domain.MaxDataValueLength)
+		data[valueFieldPrefix+strconv.Itoa(i)] = s[:n]
+		s = s[n:]
+	}
+	return data
+}
+
+// decodeValue returns the value stored in a session by encodeValue.
+func decodeValue(session *domain.Session) []byte {
+	var b strings.Builder
+	for i := 0; ; i++ {
+		part, ok := session.Data[valueFieldPrefix+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		b.WriteString(part)
+	}
+	if session.Data[valueEncodingField] == "base64" {
+		value, err := base64.StdEncoding.DecodeString(b.String())
+		if err == nil {
+			return value
+		}
+	}
+	return []byte(b.String())
+}
+
+// writeKeyValue writes what GET returns for a session: the value stored
+// under a key other than a session ID, else the session JSON.
+func writeKeyValue(conn *Conn, session *domain.Session) {
+	if _, ok := session.Data[valueKeyField]; ok {
+		_ = WriteBulk(conn.bw, decodeValue(session))
+		return
+	}
+	writeSessionJSON(conn, session)
+}
+
+// setValue implements SET of an opaque value under a key other than a
+// session ID. Sessions always expire, so a value set without a TTL gets
+// the default of 24 hours, and overwriting one keeps its TTL.
+func (h *CommandHandler) setValue(conn *Conn, key string, value []byte, ttl time.Duration) {
+	ctx := conn.requestContext()
+	sessionID := keySessionID([]byte(key))
+	data := encodeValue(key, value)
+
+	_, err := h.sessionSvc.Get(ctx, &service.GetSessionRequest{SessionID: sessionID})
+	switch {
+	case err == nil:
+		_, err = h.sessionSvc.Update(ctx, &service.UpdateSessionRequest{
+			SessionID: sessionID,
+			Data:      data,
+			TTL:       ttl,
+		})
+	case isSessionGone(err):
+		if domain.IsDomainError(err, "TM-SESS-4041") {
+			// Expired but not collected yet: make room for the new value.
+			_, _ = h.sessionSvc.Revoke(ctx, &service.RevokeSessionRequest{SessionID: sessionID})
+		}
+		// The token is never handed out: values are read by key.
+		var token string
+		if token, _, err = domain.GenerateToken(); err != nil {
+			break
+		}
+		if ttl == 0 {
+			ttl = 24 * time.Hour
+		}
+		_, err = h.sessionSvc.CreateWithToken(ctx, &service.CreateSessionWithTokenRequest{
+			SessionID: sessionID,
+			UserID:    sessionID,
+			Token:     token,
+			Data:      data,
+			TTL:       ttl,
+		})
+	}
+	if err != nil {
+		_ = WriteError(conn.bw, formatRedisError(err))
+		return
+	}
+	_ = WriteSimpleString(conn.bw, "OK")
+}
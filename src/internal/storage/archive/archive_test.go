@@ -0,0 +1,352 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+func TestDirTarget(t *testing.T) {
+	ctx := context.Background()
+	target, err := NewDirTarget(filepath.Join(t.TempDir(), "archive"))
+	if err != nil {
+		t.Fatalf("NewDirTarget: %v", err)
+	}
+
+	for _, name := range []string{"wal/a", "wal/b", "snapshots/c"} {
+		if err := target.Put(ctx, name, strings.NewReader(name), int64(len(name))); err != nil {
+			t.Fatalf("Put %s: %v", name, err)
+		}
+	}
+	if err := target.Put(ctx, "wal/short", strings.NewReader("x"), 2); err == nil {
+		t.Error("Put with a short reader should fail")
+	}
+	if err := target.Put(ctx, "../escape", strings.NewReader("x"), 1); err == nil {
+		t.Error("Put outside the directory should fail")
+	}
+
+	names, err := target.List(ctx, "wal/")
+	if err != nil || !reflect.DeepEqual(names, []string{"wal/a", "wal/b"}) {
+		t.Errorf("List = %v (%v), want [wal/a wal/b]", names, err)
+	}
+
+	rc, err := target.Get(ctx, "snapshots/c")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "snapshots/c" {
+		t.Errorf("Get = %q", data)
+	}
+
+	if err := target.Delete(ctx, "wal/a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := target.Delete(ctx, "wal/a"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+	if _, err := target.Get(ctx, "wal/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+// flakyTarget fails the first failures Puts.
+type flakyTarget struct {
+	Target
+	failures atomic.Int32
+}
+
+func (t *flakyTarget) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if t.failures.Add(-1) >= 0 {
+		return errors.New("connection reset")
+	}
+	return t.Target.Put(ctx, name, r, size)
+}
+
+// dataDir is a WAL with closed segments and a snapshot.
+type dataDir struct {
+	walDir, snapDir string
+	writer          *wal.Writer
+}
+
+// newDataDir writes a session per WAL segment and a snapshot.
+func newDataDir(t *testing.T, segments int) *dataDir {
+	t.Helper()
+	root := t.TempDir()
+	d := &dataDir{walDir: filepath.Join(root, "wal"), snapDir: filepath.Join(root, "snapshots")}
+
+	cfg := wal.DefaultConfig(d.walDir)
+	cfg.SyncMode = wal.SyncModeSync
+	cfg.MaxEntryCount = 1
+	w, err := wal.NewWriter(cfg)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	d.writer = w
+
+	var sessions []*domain.Session
+	for i := 0; i < segments; i++ {
+		s, _ := domain.NewSession(fmt.Sprintf("user-%d", i))
+		s.TokenHash = fmt.Sprintf("tmth_%d", i)
+		s.SetExpiration(time.Hour)
+		sessions = append(sessions, s)
+		if err := w.AppendBatch([]*wal.Entry{wal.NewCreateEntry(s)}); err != nil {
+			t.Fatalf("AppendBatch: %v", err)
+		}
+	}
+
+	mgr, err := snapshot.NewManager(snapshot.Config{Dir: d.snapDir})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, err := mgr.Create(sessions, w.CurrentOffset()); err != nil {
+		t.Fatalf("Create snapshot: %v", err)
+	}
+	return d
+}
+
+func (d *dataDir) shipper(t *testing.T, target Target, mutate func(*Config)) *Shipper {
+	t.Helper()
+	cfg := Config{
+		Target:        target,
+		WALDir:        d.walDir,
+		SnapshotDir:   d.snapDir,
+		ActiveSegment: func() uint64 { return d.writer.CurrentOffset() >> 32 },
+		RetryBackoff:  time.Millisecond,
+	}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	s, err := NewShipper(cfg)
+	if err != nil {
+		t.Fatalf("NewShipper: %v", err)
+	}
+	return s
+}
+
+func TestShipper_ShipAndRestore(t *testing.T) {
+	ctx := context.Background()
+	d := newDataDir(t, 4)
+	target, _ := NewDirTarget(filepath.Join(t.TempDir(), "archive"))
+	s := d.shipper(t, target, nil)
+
+	if got := s.UnshippedSegment(); got != 0 {
+		t.Errorf("UnshippedSegment before the manifest is read = %d, want 0", got)
+	}
+	if err := s.Ship(ctx); err != nil {
+		t.Fatalf("Ship: %v", err)
+	}
+
+	// The active segment is not shipped
+	active := d.writer.CurrentOffset() >> 32
+	m, err := ReadManifest(ctx, target)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if n := len(m.Entries(KindWAL)); uint64(n) != active-1 {
+		t.Errorf("segments shipped = %d, want %d", n, active-1)
+	}
+	snaps := m.Entries(KindSnapshot)
+	if len(snaps) != 1 || snaps[0].WALLastOffset == 0 || snaps[0].CreatedAt == 0 || len(snaps[0].SHA256) != 64 {
+		t.Errorf("snapshot entries = %+v", snaps)
+	}
+	if got := s.UnshippedSegment(); got != active {
+		t.Errorf("UnshippedSegment = %d, want active segment %d", got, active)
+	}
+	if st := s.Stats(); st.FilesShipped != int64(len(m.Files)) || st.Pending != 0 {
+		t.Errorf("Stats = %+v", st)
+	}
+
+	// A second pass has nothing to do
+	if err := s.Ship(ctx); err != nil {
+		t.Fatalf("Ship again: %v", err)
+	}
+	if st := s.Stats(); st.FilesShipped != int64(len(m.Files)) {
+		t.Errorf("files shipped twice: %+v", st)
+	}
+
+	// Restore pulls back identical files
+	root := t.TempDir()
+	opts := RestoreOptions{WALDir: filepath.Join(root, "wal"), SnapshotDir: filepath.Join(root, "snapshots")}
+	res, err := Restore(ctx, target, opts)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if uint64(res.Segments) != active-1 || res.Snapshots != 1 {
+		t.Errorf("Restore = %+v", res)
+	}
+	for _, e := range m.Files {
+		dir, src := opts.SnapshotDir, d.snapDir
+		if e.Kind == KindWAL {
+			dir, src = opts.WALDir, d.walDir
+		}
+		base := filepath.Base(e.Name)
+		want, _ := os.ReadFile(filepath.Join(src, base))
+		got, _ := os.ReadFile(filepath.Join(dir, base))
+		if !bytes.Equal(got, want) {
+			t.Errorf("restored %s differs", e.Name)
+		}
+	}
+
+	// Restoring again skips the files
+	if res, err := Restore(ctx, target, opts); err != nil || res.Skipped != len(m.Files) {
+		t.Errorf("Restore again = %+v (%v)", res, err)
+	}
+
+	// Damage is detected
+	if problems, err := Verify(ctx, target); err != nil || len(problems) != 0 {
+		t.Errorf("Verify = %v (%v)", problems, err)
+	}
+	damaged := m.Entries(KindWAL)[0].Name
+	target.Put(ctx, damaged, strings.NewReader("garbage"), 7)
+	if problems, _ := Verify(ctx, target); len(problems) != 1 {
+		t.Errorf("Verify of a damaged archive = %v", problems)
+	}
+	if _, err := Restore(ctx, target, RestoreOptions{WALDir: t.TempDir(), SnapshotDir: t.TempDir()}); err == nil {
+		t.Error("Restore of a damaged archive should fail")
+	}
+}
+
+func TestShipper_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("recovers", func(t *testing.T) {
+		d := newDataDir(t, 2)
+		dir, _ := NewDirTarget(filepath.Join(t.TempDir(), "archive"))
+		target := &flakyTarget{Target: dir}
+		target.failures.Store(2)
+		s := d.shipper(t, target, func(cfg *Config) { cfg.MaxRetries = 2 })
+		if err := s.Ship(ctx); err != nil {
+			t.Fatalf("Ship: %v", err)
+		}
+	})
+
+	t.Run("gives up until the next pass", func(t *testing.T) {
+		d := newDataDir(t, 3)
+		dir, _ := NewDirTarget(filepath.Join(t.TempDir(), "archive"))
+		target := &flakyTarget{Target: dir}
+		target.failures.Store(1)
+		s := d.shipper(t, target, func(cfg *Config) { cfg.MaxRetries = 0 })
+		if err := s.Ship(ctx); err == nil {
+			t.Fatal("Ship should fail")
+		}
+		if st := s.Stats(); st.Failures != 1 || st.LastError == "" {
+			t.Errorf("Stats = %+v", st)
+		}
+		if got := s.UnshippedSegment(); got != 1 {
+			t.Errorf("UnshippedSegment = %d, want 1", got)
+		}
+		if err := s.Ship(ctx); err != nil {
+			t.Fatalf("Ship on the next pass: %v", err)
+		}
+		if st := s.Stats(); st.LastError != "" {
+			t.Errorf("LastError after success = %q", st.LastError)
+		}
+	})
+}
+
+func TestShipper_Background(t *testing.T) {
+	d := newDataDir(t, 2)
+	target, _ := NewDirTarget(filepath.Join(t.TempDir(), "archive"))
+	s := d.shipper(t, target, func(cfg *Config) { cfg.ScanInterval = time.Hour })
+	s.Start()
+	defer s.Close()
+
+	s.Notify()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats().FilesShipped < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("files not shipped in the background: %+v", s.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShipper_Retention(t *testing.T) {
+	ctx := context.Background()
+	target, _ := NewDirTarget(filepath.Join(t.TempDir(), "archive"))
+
+	// Snapshots 40 and 20 days old and a new one, with segments 1 to 6
+	now := time.Now()
+	m := &Manifest{}
+	snapshots := []struct {
+		name    string
+		age     time.Duration
+		segment uint64
+	}{
+		{"snapshots/snapshot-1.snap", 40 * 24 * time.Hour, 2},
+		{"snapshots/snapshot-2.snap", 20 * 24 * time.Hour, 4},
+		{"snapshots/snapshot-3.snap", time.Hour, 6},
+	}
+	for _, s := range snapshots {
+		m.add(ManifestEntry{Name: s.name, Kind: KindSnapshot, WALLastOffset: s.segment << 32, CreatedAt: now.Add(-s.age).UnixMilli()})
+	}
+	for id := uint64(1); id <= 6; id++ {
+		m.add(ManifestEntry{Name: walPrefix + segmentFile(id), Kind: KindWAL, SegmentID: id})
+	}
+	for _, e := range m.Files {
+		target.Put(ctx, e.Name, strings.NewReader("x"), 1)
+	}
+	if err := writeManifest(ctx, target, m); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+
+	retain := func(maxAge time.Duration, minSnapshots int) []string {
+		t.Helper()
+		root := t.TempDir()
+		s, err := NewShipper(Config{
+			Target:        target,
+			WALDir:        filepath.Join(root, "wal"),
+			SnapshotDir:   filepath.Join(root, "snapshots"),
+			ActiveSegment: func() uint64 { return 7 },
+			Retention:     Retention{MaxAge: maxAge, MinSnapshots: minSnapshots},
+		})
+		if err != nil {
+			t.Fatalf("NewShipper: %v", err)
+		}
+		if err := s.Ship(ctx); err != nil {
+			t.Fatalf("Ship: %v", err)
+		}
+		names, _ := target.List(ctx, "")
+		return names
+	}
+
+	// Nothing is old enough
+	if names := retain(60*24*time.Hour, 1); len(names) != 10 {
+		t.Errorf("objects = %v, want all 9 and the manifest", names)
+	}
+
+	// The 40 days old snapshot goes, with the segments before the next
+	want := []string{
+		ManifestName,
+		"snapshots/snapshot-2.snap", "snapshots/snapshot-3.snap",
+		"wal/wal-00000004.log", "wal/wal-00000005.log", "wal/wal-00000006.log",
+	}
+	if names := retain(30*24*time.Hour, 1); !reflect.DeepEqual(names, want) {
+		t.Errorf("objects = %v, want %v", names, want)
+	}
+
+	// MinSnapshots keeps the 20 days old one
+	if names := retain(24*time.Hour, 2); !reflect.DeepEqual(names, want) {
+		t.Errorf("objects = %v, want %v", names, want)
+	}
+	m, _ = ReadManifest(ctx, target)
+	if len(m.Files) != len(want)-1 {
+		t.Errorf("manifest = %+v", m.Files)
+	}
+}
@@ -0,0 +1,24 @@
+// Package archive ships WAL segments and snapshots to an archive target
+// for disaster recovery, and restores them.
+//
+// A Target stores named objects: DirTarget a local directory or NFS
+// mount, S3Target a bucket of an S3-compatible object store (AWS S3,
+// MinIO, ...). The layout under the target is:
+//
+//	manifest.json                     (what is archived, with checksums)
+//	wal/wal-<segment>.log             (closed WAL segments)
+//	snapshots/snapshot-<id>.snap      (snapshots)
+//
+// Files are shipped as they are on disk, so encrypted data stays
+// encrypted. A Shipper scans the WAL and snapshot directories in the
+// background and uploads what is not in the manifest yet, retrying
+// failed uploads, then applies the retention policy: snapshots older
+// than the retention are deleted, keeping a minimum count, along with the
+// WAL segments older than the oldest snapshot kept. Until a segment is
+// shipped the storage engine does not compact it.
+//
+// Restore pulls the archive back into a data directory, verifying every
+// file against the manifest, for Recover or point-in-time recovery.
+//
+// @design DS-0102
+package archive
@@ -0,0 +1,141 @@
+// Package archive ships WAL segments and snapshots to an archive target.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ManifestName is the object name of the archive manifest.
+const ManifestName = "manifest.json"
+
+// manifestVersion is the version of the manifest format written.
+const manifestVersion = 1
+
+// Kinds of archived files.
+const (
+	KindWAL      = "wal"
+	KindSnapshot = "snapshot"
+)
+
+// Object name prefixes of archived files.
+const (
+	walPrefix      = "wal/"
+	snapshotPrefix = "snapshots/"
+)
+
+// Manifest lists the files in an archive.
+type Manifest struct {
+	Version int `json:"version"`
+
+	// NodeID is the node whose data is archived.
+	NodeID string `json:"node_id,omitempty"`
+
+	UpdatedAt time.Time       `json:"updated_at"`
+	Files     []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes an archived file.
+type ManifestEntry struct {
+	// Name is the object name, e.g. "wal/wal-00000003.log".
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+
+	// SegmentID is the ID of a WAL segment.
+	SegmentID uint64 `json:"segment_id,omitempty"`
+
+	// WALLastOffset and CreatedAt (Unix milliseconds) describe a snapshot.
+	WALLastOffset uint64 `json:"wal_last_offset,omitempty"`
+	CreatedAt     int64  `json:"created_at,omitempty"`
+
+	Size int64 `json:"size"`
+
+	// SHA256 is the hex SHA-256 of the file.
+	SHA256 string `json:"sha256"`
+
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Lookup returns the entry of an object, or nil.
+func (m *Manifest) Lookup(name string) *ManifestEntry {
+	for i := range m.Files {
+		if m.Files[i].Name == name {
+			return &m.Files[i]
+		}
+	}
+	return nil
+}
+
+// add adds or replaces an entry, keeping the files sorted by name, which
+// orders segments and snapshots by age.
+func (m *Manifest) add(e ManifestEntry) {
+	if old := m.Lookup(e.Name); old != nil {
+		*old = e
+		return
+	}
+	m.Files = append(m.Files, e)
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+}
+
+// remove removes the entries of the named objects.
+func (m *Manifest) remove(names map[string]bool) {
+	files := m.Files[:0]
+	for _, f := range m.Files {
+		if !names[f.Name] {
+			files = append(files, f)
+		}
+	}
+	m.Files = files
+}
+
+// Entries returns the entries of a kind, oldest first.
+func (m *Manifest) Entries(kind string) []ManifestEntry {
+	var entries []ManifestEntry
+	for _, f := range m.Files {
+		if f.Kind == kind {
+			entries = append(entries, f)
+		}
+	}
+	return entries
+}
+
+// ReadManifest reads the manifest of an archive. An archive without one
+// has an empty manifest.
+func ReadManifest(ctx context.Context, target Target) (*Manifest, error) {
+	rc, err := target.Get(ctx, ManifestName)
+	if errors.Is(err, ErrNotFound) {
+		return &Manifest{Version: manifestVersion}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("archive: read manifest: %w", err)
+	}
+	defer rc.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, fmt.Errorf("archive: decode manifest: %w", err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("archive: unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// writeManifest writes the manifest of an archive.
+func writeManifest(ctx context.Context, target Target, m *Manifest) error {
+	m.Version = manifestVersion
+	m.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := target.Put(ctx, ManifestName, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("archive: write manifest: %w", err)
+	}
+	return nil
+}
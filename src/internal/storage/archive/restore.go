@@ -0,0 +1,176 @@
+// Package archive ships WAL segments and snapshots to an archive target.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	// WALDir and SnapshotDir receive the WAL segments and the snapshots:
+	// the directories of a data directory for Recover or point-in-time
+	// recovery. They are created if needed.
+	WALDir      string
+	SnapshotDir string
+}
+
+// RestoreResult describes a restore.
+type RestoreResult struct {
+	Segments  int   `json:"segments"`
+	Snapshots int   `json:"snapshots"`
+	Bytes     int64 `json:"bytes"`
+
+	// Skipped counts the files already present with the same content.
+	Skipped int `json:"skipped"`
+}
+
+// Restore pulls the files listed in the archive manifest into the WAL and
+// snapshot directories, verifying their size and SHA-256. Files already
+// present are kept if identical; a different file of the same name fails
+// the restore, so a live data directory is never overwritten.
+func Restore(ctx context.Context, target Target, opts RestoreOptions) (*RestoreResult, error) {
+	if opts.WALDir == "" || opts.SnapshotDir == "" {
+		return nil, errors.New("archive: WAL and snapshot directories are required")
+	}
+	m, err := ReadManifest(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("archive: %s is empty", target)
+	}
+
+	for _, dir := range []string{opts.WALDir, opts.SnapshotDir} {
+		if err := os.MkdirAll(dir, dirPerm); err != nil {
+			return nil, fmt.Errorf("archive: create %s: %w", dir, err)
+		}
+	}
+
+	res := &RestoreResult{}
+	for _, e := range m.Files {
+		dir := opts.SnapshotDir
+		if e.Kind == KindWAL {
+			dir = opts.WALDir
+		}
+		dst := filepath.Join(dir, path.Base(e.Name))
+
+		restored, err := restoreFile(ctx, target, e, dst)
+		if err != nil {
+			return nil, fmt.Errorf("archive: restore %s: %w", e.Name, err)
+		}
+		if !restored {
+			res.Skipped++
+			continue
+		}
+		res.Bytes += e.Size
+		if e.Kind == KindWAL {
+			res.Segments++
+		} else {
+			res.Snapshots++
+		}
+	}
+	return res, nil
+}
+
+// restoreFile downloads an archived file to dst, and returns false if an
+// identical file was there already.
+func restoreFile(ctx context.Context, target Target, e ManifestEntry, dst string) (bool, error) {
+	if sum, err := fileSHA256(dst); err == nil {
+		if sum != e.SHA256 {
+			return false, fmt.Errorf("%s exists with different content", dst)
+		}
+		return false, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	rc, err := target.Get(ctx, e.Name)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), rc)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	if n != e.Size {
+		return false, fmt.Errorf("size %d, manifest says %d", n, e.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != e.SHA256 {
+		return false, fmt.Errorf("checksum %s, manifest says %s", sum, e.SHA256)
+	}
+
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return false, err
+	}
+	return true, syncDir(filepath.Dir(dst))
+}
+
+// fileSHA256 returns the hex SHA-256 of a file.
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify checks that every file of the manifest is in the archive with
+// its size and SHA-256, and returns the problems found.
+func Verify(ctx context.Context, target Target) ([]string, error) {
+	m, err := ReadManifest(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, e := range m.Files {
+		rc, err := target.Get(ctx, e.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", e.Name, err))
+			continue
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, rc)
+		rc.Close()
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", e.Name, err))
+		case n != e.Size:
+			problems = append(problems, fmt.Sprintf("%s: size %d, manifest says %d", e.Name, n, e.Size))
+		case hex.EncodeToString(h.Sum(nil)) != e.SHA256:
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", e.Name))
+		}
+	}
+	return problems, nil
+}
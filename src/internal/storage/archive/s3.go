@@ -0,0 +1,337 @@
+// Package archive ships WAL segments and snapshots to an archive target.
+package archive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultS3Region is the signing region when S3Config.Region is empty.
+const DefaultS3Region = "us-east-1"
+
+// unsignedPayload is the payload hash of requests whose body is not
+// hashed before sending.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Config configures an S3Target.
+type S3Config struct {
+	// Endpoint is the object store URL, e.g. "https://s3.eu-west-1.amazonaws.com"
+	// or "http://127.0.0.1:9000" for a local MinIO. Buckets are
+	// addressed by path, which every S3-compatible store supports.
+	Endpoint string
+
+	// Region is the signing region, DefaultS3Region if empty.
+	Region string
+
+	Bucket string
+
+	// Prefix is prepended to object names, e.g. "tokmesh/node-1".
+	Prefix string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// HTTPClient sends the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// S3Target stores the archive in a bucket of an S3-compatible object
+// store, signing requests with AWS Signature Version 4.
+type S3Target struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Target returns a target storing the archive in an S3 bucket.
+func NewS3Target(cfg S3Config) (*S3Target, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("archive: s3 endpoint and bucket are required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("archive: s3 access key ID and secret access key are required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("archive: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultS3Region
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Target{cfg: cfg, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+// key returns the object key of an archive object name.
+func (t *S3Target) key(name string) string {
+	if t.cfg.Prefix == "" {
+		return name
+	}
+	return t.cfg.Prefix + "/" + name
+}
+
+// objectURL returns the path-style URL of an object key, or of the
+// bucket if key is empty.
+func (t *S3Target) objectURL(key string, query url.Values) string {
+	u := *t.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// do signs and sends a request, returning the response of a 2xx status
+// and an error otherwise.
+func (t *S3Target) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	signV4(req, t.cfg, payloadHash, t.now())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		return nil, fmt.Errorf("archive: s3 %s %s: %s: %s", req.Method, req.URL.Path, s3err.Code, s3err.Message)
+	}
+	return nil, fmt.Errorf("archive: s3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+}
+
+// Put implements Target. A seekable r is hashed and signed; other readers
+// are sent as unsigned payloads.
+func (t *S3Target) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	payloadHash := unsignedPayload
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		if _, err := io.CopyN(h, rs, size); err != nil {
+			return err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		payloadHash = hex.EncodeToString(h.Sum(nil))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.objectURL(t.key(name), nil), io.NopCloser(io.LimitReader(r, size)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := t.do(req, payloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get implements Target.
+func (t *S3Target) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.objectURL(t.key(name), nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// List implements Target, with ListObjectsV2.
+func (t *S3Target) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {t.key(prefix)}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.objectURL("", query), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.do(req, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("archive: s3 list: %w", err)
+		}
+		for _, c := range result.Contents {
+			names = append(names, strings.TrimPrefix(c.Key, t.key("")))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete implements Target.
+func (t *S3Target) Delete(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.objectURL(t.key(name), nil), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.do(req, emptyPayloadHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// String implements Target.
+func (t *S3Target) String() string {
+	return fmt.Sprintf("s3:%s/%s/%s", t.endpoint, t.cfg.Bucket, t.cfg.Prefix)
+}
+
+// signV4 signs req with AWS Signature Version 4 for the s3 service. The
+// host, Content-Type, Range and x-amz-* headers are signed.
+func signV4(req *http.Request, cfg S3Config, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretAccessKey), day)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery returns the query string sorted by name, with names and
+// values URI-encoded.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes s as SigV4 requires: every byte but the
+// unreserved characters, and '/' unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
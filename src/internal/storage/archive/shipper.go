@@ -0,0 +1,548 @@
+// Package archive ships WAL segments and snapshots to an archive target.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+// Default shipper settings.
+const (
+	DefaultScanInterval = time.Minute
+	DefaultMaxRetries   = 5
+	DefaultRetryBackoff = time.Second
+
+	// maxRetryBackoff caps the doubling backoff between retries.
+	maxRetryBackoff = time.Minute
+)
+
+// Retention is the retention policy of an archive.
+type Retention struct {
+	// MaxAge is how long snapshots are kept. Zero keeps everything.
+	MaxAge time.Duration
+
+	// MinSnapshots is the number of newest snapshots kept whatever their
+	// age, at least 1.
+	MinSnapshots int
+}
+
+// Config configures a Shipper.
+type Config struct {
+	// Target receives the archive.
+	Target Target
+
+	// WALDir and SnapshotDir are the directories shipped.
+	WALDir      string
+	SnapshotDir string
+
+	// Cipher reads the headers of encrypted snapshots.
+	Cipher adaptive.Cipher
+
+	// NodeID is recorded in the manifest.
+	NodeID string
+
+	// ActiveSegment returns the ID of the WAL segment being written, which
+	// is not shipped until it is closed.
+	ActiveSegment func() uint64
+
+	// ScanInterval is how often the directories are scanned for files to
+	// ship, besides Notify.
+	ScanInterval time.Duration
+
+	// MaxRetries is how many times a failed upload is retried, with a
+	// doubling backoff from RetryBackoff, before the scan gives up until
+	// the next one.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	Retention Retention
+
+	Logger *slog.Logger
+}
+
+// Stats describes the shipping of an archive.
+type Stats struct {
+	Target string `json:"target"`
+
+	// Pending is the number of files waiting to be shipped, as of the
+	// latest scan.
+	Pending int `json:"pending"`
+
+	FilesShipped int64     `json:"files_shipped"`
+	BytesShipped int64     `json:"bytes_shipped"`
+	Failures     int64     `json:"failures"`
+	LastShipped  time.Time `json:"last_shipped,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// Shipper ships closed WAL segments and snapshots to a Target in the
+// background.
+type Shipper struct {
+	cfg       Config
+	snapshots *snapshot.Manager
+	logger    *slog.Logger
+
+	passMu sync.Mutex // serializes passes
+
+	mu       sync.Mutex
+	manifest *Manifest // nil until read from the target
+	stats    Stats
+
+	wake   chan struct{}
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewShipper returns a shipper. Call Start to ship in the background.
+func NewShipper(cfg Config) (*Shipper, error) {
+	if cfg.Target == nil {
+		return nil, errors.New("archive: target is required")
+	}
+	if cfg.WALDir == "" || cfg.SnapshotDir == "" {
+		return nil, errors.New("archive: WAL and snapshot directories are required")
+	}
+	if cfg.ActiveSegment == nil {
+		return nil, errors.New("archive: active segment func is required")
+	}
+	if cfg.ScanInterval <= 0 {
+		cfg.ScanInterval = DefaultScanInterval
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.Retention.MinSnapshots < 1 {
+		cfg.Retention.MinSnapshots = 1
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	mgr, err := snapshot.NewManager(snapshot.Config{Dir: cfg.SnapshotDir, Cipher: cfg.Cipher})
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+
+	return &Shipper{
+		cfg:       cfg,
+		snapshots: mgr,
+		logger:    cfg.Logger.With("archive", cfg.Target.String()),
+		stats:     Stats{Target: cfg.Target.String()},
+		wake:      make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}, nil
+}
+
+// Start ships in the background: every ScanInterval and on Notify.
+func (s *Shipper) Start() {
+	go s.loop()
+}
+
+// Notify asks for a scan soon, e.g. after a snapshot or a WAL rotation.
+func (s *Shipper) Notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops shipping, interrupting retries. Files not shipped yet are
+// shipped after the next Start.
+func (s *Shipper) Close() error {
+	close(s.stopCh)
+	<-s.doneCh
+	return nil
+}
+
+func (s *Shipper) loop() {
+	defer close(s.doneCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(s.cfg.ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Ship(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn("archive shipping failed", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pendingFile is a file to ship.
+type pendingFile struct {
+	path  string
+	entry ManifestEntry
+}
+
+// Ship ships the files not in the archive yet, oldest first, then
+// applies the retention policy. It stops at the first file that cannot
+// be shipped after retries.
+func (s *Shipper) Ship(ctx context.Context) error {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	if err := s.loadManifest(ctx); err != nil {
+		return s.fail(err)
+	}
+
+	pending, err := s.pending()
+	if err != nil {
+		return s.fail(err)
+	}
+	s.mu.Lock()
+	s.stats.Pending = len(pending)
+	s.mu.Unlock()
+
+	for _, f := range pending {
+		if err := s.shipWithRetry(ctx, f); err != nil {
+			return s.fail(fmt.Errorf("ship %s: %w", f.entry.Name, err))
+		}
+		s.mu.Lock()
+		s.stats.Pending--
+		s.mu.Unlock()
+	}
+
+	if err := s.applyRetention(ctx); err != nil {
+		return s.fail(err)
+	}
+	return nil
+}
+
+// fail records a shipping error.
+func (s *Shipper) fail(err error) error {
+	s.mu.Lock()
+	s.stats.Failures++
+	s.stats.LastError = err.Error()
+	s.mu.Unlock()
+	return err
+}
+
+// loadManifest reads the manifest from the target, once.
+func (s *Shipper) loadManifest(ctx context.Context) error {
+	s.mu.Lock()
+	loaded := s.manifest != nil
+	s.mu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	m, err := ReadManifest(ctx, s.cfg.Target)
+	if err != nil {
+		return err
+	}
+	if m.NodeID == "" {
+		m.NodeID = s.cfg.NodeID
+	}
+	s.mu.Lock()
+	s.manifest = m
+	s.mu.Unlock()
+	return nil
+}
+
+// segmentIDs returns the IDs of the WAL segments on disk, sorted.
+func (s *Shipper) segmentIDs() ([]uint64, error) {
+	entries, err := os.ReadDir(s.cfg.WALDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var ids []uint64
+	for _, e := range entries {
+		if id, ok := wal.ParseSegmentFilename(e.Name()); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// pending returns the closed WAL segments and the snapshots not in the
+// manifest, segments first.
+func (s *Shipper) pending() ([]pendingFile, error) {
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := s.snapshots.List()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []pendingFile
+	active := s.cfg.ActiveSegment()
+	for _, id := range ids {
+		name := walPrefix + segmentFile(id)
+		if id >= active || s.manifest.Lookup(name) != nil {
+			continue
+		}
+		pending = append(pending, pendingFile{
+			path:  filepath.Join(s.cfg.WALDir, segmentFile(id)),
+			entry: ManifestEntry{Name: name, Kind: KindWAL, SegmentID: id},
+		})
+	}
+	for _, info := range snaps {
+		name := snapshotPrefix + filepath.Base(info.Path)
+		if s.manifest.Lookup(name) != nil {
+			continue
+		}
+		pending = append(pending, pendingFile{
+			path:  info.Path,
+			entry: ManifestEntry{Name: name, Kind: KindSnapshot},
+		})
+	}
+	return pending, nil
+}
+
+// segmentFile returns the file name of a WAL segment.
+func segmentFile(id uint64) string {
+	return fmt.Sprintf("%s%08d%s", wal.FilePrefix, id, wal.FileExtension)
+}
+
+// shipWithRetry ships a file, retrying with a doubling backoff.
+func (s *Shipper) shipWithRetry(ctx context.Context, f pendingFile) error {
+	backoff := s.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.ship(ctx, f)
+		if err == nil || attempt >= s.cfg.MaxRetries {
+			return err
+		}
+		s.logger.Warn("archive upload failed, retrying", "file", f.entry.Name, "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// ship uploads a file and records it in the manifest. Files removed
+// since the scan (snapshots pruned meanwhile) are skipped.
+func (s *Shipper) ship(ctx context.Context, f pendingFile) error {
+	file, err := os.Open(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	entry := f.entry
+	entry.Size = size
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if entry.Kind == KindSnapshot {
+		info, err := s.snapshots.ReadInfo(f.path)
+		if err != nil {
+			return fmt.Errorf("read snapshot: %w", err)
+		}
+		entry.WALLastOffset = info.WALLastOffset
+		entry.CreatedAt = info.CreatedAt
+	}
+
+	if err := s.cfg.Target.Put(ctx, entry.Name, file, size); err != nil {
+		return err
+	}
+	entry.ArchivedAt = time.Now().UTC()
+
+	// The manifest only lists uploaded files; an upload whose manifest
+	// write fails is uploaded again.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manifest.add(entry)
+	if err := writeManifest(ctx, s.cfg.Target, s.manifest); err != nil {
+		s.manifest.remove(map[string]bool{entry.Name: true})
+		return err
+	}
+
+	s.stats.FilesShipped++
+	s.stats.BytesShipped += size
+	s.stats.LastShipped = entry.ArchivedAt
+	s.stats.LastError = ""
+	s.logger.Info("archived file", "file", entry.Name, "size_bytes", size)
+	return nil
+}
+
+// applyRetention deletes the snapshots older than the retention, keeping
+// the newest MinSnapshots, and the WAL segments preceding the oldest
+// snapshot kept, which no recovery from the archive needs.
+func (s *Shipper) applyRetention(ctx context.Context) error {
+	if s.cfg.Retention.MaxAge <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-s.cfg.Retention.MaxAge).UnixMilli()
+
+	s.mu.Lock()
+	snaps := s.manifest.Entries(KindSnapshot)
+	drop := make(map[string]bool)
+	oldest := -1
+	for i, e := range snaps {
+		if i < len(snaps)-s.cfg.Retention.MinSnapshots && e.CreatedAt < cutoff {
+			drop[e.Name] = true
+			continue
+		}
+		if oldest < 0 {
+			oldest = i
+		}
+	}
+	if len(drop) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	keepSegment := snaps[oldest].WALLastOffset >> 32
+	for _, e := range s.manifest.Entries(KindWAL) {
+		if e.SegmentID < keepSegment {
+			drop[e.Name] = true
+		}
+	}
+
+	// Drop from the manifest first: an object left by a failed delete is
+	// only garbage.
+	s.manifest.remove(drop)
+	err := writeManifest(ctx, s.cfg.Target, s.manifest)
+	if err != nil {
+		s.manifest = nil // read again on the next pass
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(drop))
+	for name := range drop {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.cfg.Target.Delete(ctx, name); err != nil {
+			s.logger.Warn("archive delete failed", "file", name, "error", err)
+		}
+	}
+	s.logger.Info("archive retention applied", "deleted", len(names))
+	return nil
+}
+
+// UnshippedSegment returns the ID of the oldest WAL segment not shipped
+// yet, or of the active segment if all closed ones are. Segments before
+// it may be compacted.
+func (s *Shipper) UnshippedSegment() uint64 {
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.manifest == nil {
+		return 0
+	}
+	active := s.cfg.ActiveSegment()
+	for _, id := range ids {
+		if id >= active {
+			break
+		}
+		if s.manifest.Lookup(walPrefix+segmentFile(id)) == nil {
+			return id
+		}
+	}
+	return active
+}
+
+// Stats returns the shipping statistics.
+func (s *Shipper) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Collectors returns the shipper's Prometheus collectors: files and bytes
+// shipped, failures, files pending and the time of the latest upload.
+func (s *Shipper) Collectors() []prometheus.Collector {
+	stat := func(f func(Stats) float64) func() float64 {
+		return func() float64 { return f(s.Stats()) }
+	}
+	return []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "tokmesh",
+			Subsystem: "archive",
+			Name:      "files_shipped_total",
+			Help:      "Number of WAL segments and snapshots shipped to the archive.",
+		}, stat(func(st Stats) float64 { return float64(st.FilesShipped) })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "tokmesh",
+			Subsystem: "archive",
+			Name:      "bytes_shipped_total",
+			Help:      "Number of bytes shipped to the archive.",
+		}, stat(func(st Stats) float64 { return float64(st.BytesShipped) })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "tokmesh",
+			Subsystem: "archive",
+			Name:      "failures_total",
+			Help:      "Number of archive shipping passes that failed.",
+		}, stat(func(st Stats) float64 { return float64(st.Failures) })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "tokmesh",
+			Subsystem: "archive",
+			Name:      "files_pending",
+			Help:      "Number of files waiting to be shipped to the archive.",
+		}, stat(func(st Stats) float64 { return float64(st.Pending) })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "tokmesh",
+			Subsystem: "archive",
+			Name:      "last_shipped_timestamp_seconds",
+			Help:      "Unix time of the latest file shipped to the archive, 0 if none.",
+		}, stat(func(st Stats) float64 {
+			if st.LastShipped.IsZero() {
+				return 0
+			}
+			return float64(st.LastShipped.UnixMilli()) / 1000
+		})),
+	}
+}
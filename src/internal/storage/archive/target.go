@@ -0,0 +1,178 @@
+// Package archive ships WAL segments and snapshots to an archive target.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by Target.Get for a missing object.
+var ErrNotFound = errors.New("archive: object not found")
+
+// Target stores the archive as named objects. Names are slash-separated
+// paths relative to the target's root.
+type Target interface {
+	// Put stores an object of size bytes read from r, replacing any
+	// object of the same name. A failed Put leaves no partial object.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+
+	// Get opens an object for reading, or returns ErrNotFound.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// List returns the names of the objects under prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete removes an object. Deleting a missing object is not an
+	// error.
+	Delete(ctx context.Context, name string) error
+
+	// String describes the target for logs.
+	String() string
+}
+
+// Archive file permissions, as for the data directory.
+const (
+	dirPerm  = 0750
+	filePerm = 0640
+)
+
+// DirTarget stores the archive in a directory: a local disk or an NFS
+// mount. Objects are written to a temporary file, synced and renamed, so
+// readers never see a partial object.
+type DirTarget struct {
+	dir string
+}
+
+// NewDirTarget returns a target storing the archive under dir, which is
+// created if needed.
+func NewDirTarget(dir string) (*DirTarget, error) {
+	if dir == "" {
+		return nil, errors.New("archive: directory is required")
+	}
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("archive: create directory: %w", err)
+	}
+	return &DirTarget{dir: dir}, nil
+}
+
+// path returns the file path of an object, refusing names escaping the
+// directory.
+func (t *DirTarget) path(name string) (string, error) {
+	clean := path.Clean("/" + name)[1:]
+	if clean == "" || clean != name {
+		return "", fmt.Errorf("archive: invalid object name %q", name)
+	}
+	return filepath.Join(t.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put implements Target.
+func (t *DirTarget) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	p, err := t.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), dirPerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("archive: wrote %d bytes of %s, want %d", n, name, size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(p))
+}
+
+// syncDir fsyncs a directory so a rename in it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Get implements Target.
+func (t *DirTarget) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := t.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// List implements Target.
+func (t *DirTarget) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(t.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(t.dir, p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete implements Target.
+func (t *DirTarget) Delete(ctx context.Context, name string) error {
+	p, err := t.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// String implements Target.
+func (t *DirTarget) String() string {
+	return "dir:" + t.dir
+}
@@ -0,0 +1,26 @@
+// Package codec provides the binary session encoding shared by the WAL
+// and snapshots.
+//
+// A session record is length-prefixed, so records can be concatenated and
+// a reader can skip fields appended by a newer schema:
+//
+//	[Length:4][Body:Length]
+//
+// Body (schema version 1, see SchemaVersion):
+//
+//	ID, UserID, TokenHash, IPAddress, UserAgent,
+//	LastAccessIP, LastAccessUA, DeviceID, CreatedBy   string
+//	CreatedAt, ExpiresAt, LastActive, TTL             varint
+//	Version, ShardID                                  uvarint
+//	Flags                                             byte (bit 0: IsDeleted)
+//	DataCount                                         uvarint
+//	[Key, Value]*DataCount                            string, sorted by key
+//
+// Strings are a uvarint byte length followed by the bytes. Length is a
+// big-endian uint32.
+//
+// The WAL segment header and the snapshot header carry the schema of the
+// records they hold; see the wal and snapshot packages.
+//
+// @design DS-0102
+package codec
@@ -0,0 +1,203 @@
+// Package codec provides the binary session encoding shared by the WAL
+// and snapshots.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// SchemaVersion is the version of the session record layout written by
+// AppendSession.
+const SchemaVersion = 1
+
+// lengthSize is the size of the record length prefix.
+const lengthSize = 4
+
+// flagDeleted marks a soft-deleted session in the flags byte.
+const flagDeleted = 1 << 0
+
+// Errors for decoding.
+var (
+	ErrTruncated = errors.New("codec: truncated session record")
+	ErrMalformed = errors.New("codec: malformed session record")
+)
+
+// AppendSession appends the binary record of s to dst and returns the
+// extended slice.
+func AppendSession(dst []byte, s *domain.Session) []byte {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+
+	for _, str := range [...]string{
+		s.ID, s.UserID, s.TokenHash, s.IPAddress, s.UserAgent,
+		s.LastAccessIP, s.LastAccessUA, s.DeviceID, s.CreatedBy,
+	} {
+		dst = appendString(dst, str)
+	}
+	dst = binary.AppendVarint(dst, s.CreatedAt)
+	dst = binary.AppendVarint(dst, s.ExpiresAt)
+	dst = binary.AppendVarint(dst, s.LastActive)
+	dst = binary.AppendVarint(dst, s.TTL)
+	dst = binary.AppendUvarint(dst, s.Version)
+	dst = binary.AppendUvarint(dst, uint64(s.ShardID))
+
+	var flags byte
+	if s.IsDeleted {
+		flags |= flagDeleted
+	}
+	dst = append(dst, flags)
+
+	dst = binary.AppendUvarint(dst, uint64(len(s.Data)))
+	if len(s.Data) > 0 {
+		keys := make([]string, 0, len(s.Data))
+		for k := range s.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			dst = appendString(dst, k)
+			dst = appendString(dst, s.Data[k])
+		}
+	}
+
+	binary.BigEndian.PutUint32(dst[start:], uint32(len(dst)-start-lengthSize))
+	return dst
+}
+
+// EncodeSession returns the binary record of s.
+func EncodeSession(s *domain.Session) []byte {
+	return AppendSession(nil, s)
+}
+
+// DecodeSession decodes the session record at the start of src and
+// returns it with the number of bytes consumed. Bytes after the known
+// fields of the record are ignored.
+func DecodeSession(src []byte) (*domain.Session, int, error) {
+	if len(src) < lengthSize {
+		return nil, 0, ErrTruncated
+	}
+	n := int(binary.BigEndian.Uint32(src))
+	if n > len(src)-lengthSize {
+		return nil, 0, ErrTruncated
+	}
+	body := src[lengthSize : lengthSize+n]
+
+	// All strings of a session share one allocation.
+	d := decoder{b: body, s: string(body)}
+	s := &domain.Session{
+		ID:           d.string(),
+		UserID:       d.string(),
+		TokenHash:    d.string(),
+		IPAddress:    d.string(),
+		UserAgent:    d.string(),
+		LastAccessIP: d.string(),
+		LastAccessUA: d.string(),
+		DeviceID:     d.string(),
+		CreatedBy:    d.string(),
+		CreatedAt:    d.varint(),
+		ExpiresAt:    d.varint(),
+		LastActive:   d.varint(),
+		TTL:          d.varint(),
+		Version:      d.uvarint(),
+		ShardID:      uint32(d.uvarint()),
+	}
+	s.IsDeleted = d.byte()&flagDeleted != 0
+
+	count := d.uvarint()
+	if count > uint64(len(body)) {
+		return nil, 0, fmt.Errorf("%w: %d data entries", ErrMalformed, count)
+	}
+	if count > 0 {
+		s.Data = make(map[string]string, count)
+		for i := uint64(0); i < count; i++ {
+			k := d.string()
+			s.Data[k] = d.string()
+		}
+	}
+
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	return s, lengthSize + n, nil
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// decoder reads fields from a record body. s is the body as a string, so
+// strings are sliced from it instead of allocated one by one. The first
+// error is kept and later reads return zero values.
+type decoder struct {
+	b   []byte
+	s   string
+	pos int
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b[d.pos:])
+	if n <= 0 {
+		d.fail(n)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b[d.pos:])
+	if n <= 0 {
+		d.fail(n)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.b) {
+		d.err = ErrTruncated
+		return 0
+	}
+	d.pos++
+	return d.b[d.pos-1]
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.b)-d.pos) {
+		d.err = ErrTruncated
+		return ""
+	}
+	s := d.s[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return s
+}
+
+// fail records the error for a varint read that returned n <= 0.
+func (d *decoder) fail(n int) {
+	if n == 0 {
+		d.err = ErrTruncated
+	} else {
+		d.err = fmt.Errorf("%w: varint overflow", ErrMalformed)
+	}
+}
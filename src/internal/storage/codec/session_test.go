@@ -0,0 +1,144 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+func testSession(t testing.TB) *domain.Session {
+	t.Helper()
+	s, err := domain.NewSession("user-1")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	s.TokenHash = "tmth_" + string(bytes.Repeat([]byte("ab"), 32))
+	s.IPAddress = "2001:db8::1"
+	s.UserAgent = "Mozilla/5.0 (X11; Linux x86_64)"
+	s.LastAccessIP = "192.0.2.10"
+	s.LastAccessUA = "curl/8.5.0"
+	s.DeviceID = "device-ü"
+	s.CreatedBy = "tmak-admin"
+	s.SetExpiration(time.Hour)
+	s.LastActive = s.CreatedAt + 1500
+	s.Version = 42
+	s.ShardID = 17
+	s.TTL = -1
+	s.IsDeleted = true
+	s.Data = map[string]string{"role": "admin", "tenant": "acme", "empty": ""}
+	return s
+}
+
+func TestSession_RoundTrip(t *testing.T) {
+	s := testSession(t)
+
+	got, n, err := DecodeSession(EncodeSession(s))
+	if err != nil {
+		t.Fatalf("DecodeSession: %v", err)
+	}
+	if n != len(EncodeSession(s)) {
+		t.Errorf("consumed %d bytes, want %d", n, len(EncodeSession(s)))
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("DecodeSession = %+v, want %+v", got, s)
+	}
+
+	empty := &domain.Session{}
+	if got, _, err := DecodeSession(EncodeSession(empty)); err != nil || !reflect.DeepEqual(got, empty) {
+		t.Errorf("empty session = %+v, %v", got, err)
+	}
+}
+
+func TestSession_Concatenated(t *testing.T) {
+	a, b := testSession(t), testSession(t)
+	b.ID = "tmss-second"
+	b.Data = nil
+
+	buf := AppendSession(AppendSession(nil, a), b)
+	first, n, err := DecodeSession(buf)
+	if err != nil || first.ID != a.ID {
+		t.Fatalf("first = %v, %v", first, err)
+	}
+	second, m, err := DecodeSession(buf[n:])
+	if err != nil || second.ID != b.ID || second.Data != nil {
+		t.Fatalf("second = %+v, %v", second, err)
+	}
+	if n+m != len(buf) {
+		t.Errorf("consumed %d of %d bytes", n+m, len(buf))
+	}
+}
+
+func TestSession_Deterministic(t *testing.T) {
+	s := testSession(t)
+	want := EncodeSession(s)
+	for i := 0; i < 20; i++ {
+		if got := EncodeSession(s); !bytes.Equal(got, want) {
+			t.Fatal("encoding depends on map iteration order")
+		}
+	}
+}
+
+func TestSession_Truncated(t *testing.T) {
+	enc := EncodeSession(testSession(t))
+	for _, n := range []int{0, 3, 4, 20, len(enc) - 1} {
+		if _, _, err := DecodeSession(enc[:n]); !errors.Is(err, ErrTruncated) {
+			t.Errorf("DecodeSession(%d of %d bytes) = %v, want ErrTruncated", n, len(enc), err)
+		}
+	}
+
+	// A length prefix that understates the body.
+	short := append([]byte(nil), enc...)
+	binary.BigEndian.PutUint32(short, uint32(len(enc)-lengthSize-10))
+	if _, _, err := DecodeSession(short); err == nil {
+		t.Error("DecodeSession with a short length prefix should fail")
+	}
+}
+
+func TestSession_IgnoresTrailingFields(t *testing.T) {
+	s := testSession(t)
+	enc := EncodeSession(s)
+
+	// A newer schema appends a field to the body.
+	extended := append(enc, 0x2A)
+	binary.BigEndian.PutUint32(extended, uint32(len(extended)-lengthSize))
+	got, n, err := DecodeSession(extended)
+	if err != nil {
+		t.Fatalf("DecodeSession: %v", err)
+	}
+	if n != len(extended) || !reflect.DeepEqual(got, s) {
+		t.Errorf("DecodeSession = %+v (%d bytes)", got, n)
+	}
+}
+
+func TestSession_SmallerThanJSON(t *testing.T) {
+	s := testSession(t)
+	js, _ := json.Marshal(s)
+	if bin := EncodeSession(s); len(bin) >= len(js) {
+		t.Errorf("binary %d bytes, JSON %d bytes", len(bin), len(js))
+	}
+}
+
+func BenchmarkEncodeSession(b *testing.B) {
+	s := testSession(b)
+	buf := make([]byte, 0, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = AppendSession(buf[:0], s)
+	}
+}
+
+func BenchmarkDecodeSession(b *testing.B) {
+	enc := EncodeSession(testSession(b))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DecodeSession(enc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -8,10 +8,18 @@
 //   - Memory Store: Primary storage using sharded concurrent maps
 //   - WAL: Write-ahead logging for durability and crash recovery
 //   - Snapshot: Periodic snapshots for faster recovery
+//   - Badger: Alternative backend (Config.Backend) keeping sessions in
+//     Badger with TTLs, the memory store acting as a bounded cache, and
+//     migrating the WAL backend's data online, after its first Recover
+//   - Inspect: Offline inspection, dump and repair of a data directory
+//   - Storagetest: Conformance suite run against every
+//     SessionRepository implementation
 //
 // The engine supports:
 //
 //   - Durability: All writes are logged before acknowledgment
+//   - Lightweight touches: Touch and expiry changes log only the changed
+//     fields, optionally coalesced to one touch per session per interval
 //   - Recovery: Automatic recovery from WAL and snapshots on startup
 //   - Performance: Target ≥5,000 TPS per shard, cold start <5s
 //   - Encryption: Optional at-rest encryption using adaptive ciphers
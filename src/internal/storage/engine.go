@@ -13,10 +13,15 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage/archive"
 	"github.com/yndnr/tokmesh-go/internal/storage/memory"
 	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
 	"github.com/yndnr/tokmesh-go/internal/storage/wal"
@@ -28,6 +33,18 @@ const (
 	DefaultSnapshotInterval = time.Hour
 	DefaultWALDir           = "data/wal"
 	DefaultSnapshotDir      = "data/snapshots"
+	DefaultBadgerDir        = "data/badger"
+)
+
+// Storage backends, where the engine persists sessions.
+const (
+	// BackendWAL logs writes to the WAL and keeps every session in
+	// memory, with periodic snapshots.
+	BackendWAL = "wal"
+
+	// BackendBadger keeps sessions in Badger, with TTLs, and the memory
+	// store as a cache, so sessions need not fit in memory.
+	BackendBadger = "badger"
 )
 
 // Config configures the storage engine.
@@ -35,18 +52,53 @@ type Config struct {
 	// DataDir is the base directory for all storage files.
 	DataDir string
 
+	// Backend is where sessions are persisted: BackendWAL (default) or
+	// BackendBadger. The first Recover with BackendBadger of a directory
+	// holding WAL backend data recovers it, and migrates it into Badger in
+	// the background while the engine serves it from memory.
+	Backend string
+
+	// Badger configures the Badger backend.
+	Badger KVConfig
+
+	// CacheSize, with the Badger backend, is the maximum number of
+	// sessions kept in memory. Zero keeps all of them.
+	CacheSize int
+
 	// WAL configuration
 	WAL wal.Config
 
 	// Snapshot configuration
 	Snapshot snapshot.Config
 
+	// WALArchiveDir, if set, receives the WAL segments compacted after a
+	// snapshot instead of deleting them, so RecoverToPoint can replay
+	// them.
+	WALArchiveDir string
+
+	// Archive, if set, ships closed WAL segments and snapshots to
+	// Archive.Target in the background. The directories, cipher, node ID
+	// and logger are the engine's.
+	Archive *archive.Config
+
 	// MaxSessionsPerUser is the session quota per user.
 	MaxSessionsPerUser int
 
-	// SnapshotInterval is the interval between automatic snapshots.
+	// SnapshotInterval is the maximum age of the latest snapshot, with
+	// the WAL backend: an older one is replaced by a new snapshot if
+	// entries were logged since. Zero disables the age trigger.
 	SnapshotInterval time.Duration
 
+	// SnapshotPolicy also takes snapshots, with the WAL backend, as the
+	// WAL grows and on shutdown.
+	SnapshotPolicy SnapshotPolicy
+
+	// TouchCoalesceInterval, if set, limits WAL touch entries to one per
+	// session per interval. The latest touch in between is logged when
+	// the interval has passed, so a crash loses at most an interval of
+	// LastActive updates. Zero logs every touch.
+	TouchCoalesceInterval time.Duration
+
 	// Cipher is the optional encryption cipher.
 	Cipher adaptive.Cipher
 
@@ -61,24 +113,53 @@ type Config struct {
 func DefaultConfig(dataDir string) Config {
 	return Config{
 		DataDir:          dataDir,
+		Backend:          BackendWAL,
+		Badger:           DefaultKVConfig(dataDir + "/" + DefaultBadgerDir),
 		WAL:              wal.DefaultConfig(dataDir + "/" + DefaultWALDir),
 		Snapshot:         snapshot.DefaultConfig(dataDir + "/" + DefaultSnapshotDir),
 		SnapshotInterval: DefaultSnapshotInterval,
+		SnapshotPolicy:   DefaultSnapshotPolicy(),
 		Logger:           slog.Default(),
 	}
 }
 
-// Engine is the storage engine that combines memory, WAL, and snapshots.
+// Engine is the storage engine that combines memory, WAL, and snapshots,
+// or memory as a cache of Badger with the Badger backend.
 type Engine struct {
 	cfg Config
 
 	// Components
 	store    *memory.Store
-	wal      *wal.Writer
+	wal      *wal.Writer // nil with the Badger backend
+	kv       *kvStore    // nil with the WAL backend
 	snapshot *snapshot.Manager
+	touches  *touchCoalescer  // nil unless touches are coalesced
+	archive  *archive.Shipper // nil unless archiving
+	sched    *snapshotScheduler
 
 	// State tracking
-	lastWALOffset uint64
+	lastWALOffset atomic.Uint64 // WAL composite offset applied to memory
+	lastSnapshot  atomic.Int64  // Unix milliseconds, 0 if none
+
+	// lastSnapshotOffset is the WAL offset of the latest snapshot
+	lastSnapshotOffset atomic.Uint64
+
+	// snapshotMu serializes snapshot runs
+	snapshotMu sync.Mutex
+
+	// applyMu is held shared by writers from their WAL append until the
+	// entry is in memory, and exclusively by a snapshot while it takes
+	// lastWALOffset and opens its view, so that no entry at or below the
+	// offset is still on its way to memory.
+	applyMu sync.RWMutex
+
+	// sessionMu orders the writes to each session (WAL backend only)
+	sessionMu sessionLocks
+
+	// Metrics
+	fsyncSeconds  prometheus.Histogram
+	commitEntries prometheus.Histogram
+	commitSeconds prometheus.Histogram
 
 	// Logger
 	logger *slog.Logger
@@ -86,6 +167,10 @@ type Engine struct {
 	// Shutdown
 	stopCh chan struct{}
 	doneCh chan struct{}
+
+	// migrateDone is closed when a migration to Badger started by
+	// Recover has returned; nil if none was.
+	migrateDone chan struct{}
 }
 
 // New creates a new storage engine.
@@ -107,6 +192,39 @@ func New(cfg Config) (*Engine, error) {
 	cfg.Snapshot.Cipher = cfg.Cipher
 	cfg.Snapshot.NodeID = cfg.NodeID
 
+	// Observe WAL fsync latency, keeping any caller hook
+	fsyncSeconds := newFsyncHistogram()
+	onSync := cfg.WAL.OnSync
+	cfg.WAL.OnSync = func(d time.Duration) {
+		fsyncSeconds.Observe(d.Seconds())
+		if onSync != nil {
+			onSync(d)
+		}
+	}
+
+	// Observe WAL group commits, keeping any caller hook
+	commitEntries, commitSeconds := newCommitHistograms()
+	onCommit := cfg.WAL.OnCommit
+	cfg.WAL.OnCommit = func(entries int, d time.Duration) {
+		commitEntries.Observe(float64(entries))
+		commitSeconds.Observe(d.Seconds())
+		if onCommit != nil {
+			onCommit(entries, d)
+		}
+	}
+
+	// Ship segments as they are sealed
+	var shipper *archive.Shipper
+	onRotate := cfg.WAL.OnRotate
+	cfg.WAL.OnRotate = func(sealed uint64) {
+		if shipper != nil {
+			shipper.Notify()
+		}
+		if onRotate != nil {
+			onRotate(sealed)
+		}
+	}
+
 	// Create memory store
 	storeOpts := []memory.Option{}
 	if cfg.MaxSessionsPerUser > 0 {
@@ -114,36 +232,91 @@ func New(cfg Config) (*Engine, error) {
 	}
 	store := memory.New(storeOpts...)
 
-	// Create WAL writer
-	walWriter, err := wal.NewWriter(cfg.WAL)
-	if err != nil {
-		return nil, fmt.Errorf("storage: create wal writer: %w", err)
+	// Create WAL writer, or open Badger
+	var walWriter *wal.Writer
+	var kv *kvStore
+	var err error
+	switch cfg.Backend {
+	case "", BackendWAL:
+		if walWriter, err = wal.NewWriter(cfg.WAL); err != nil {
+			return nil, fmt.Errorf("storage: create wal writer: %w", err)
+		}
+	case BackendBadger:
+		if kv, err = newKVStore(cfg, store); err != nil {
+			return nil, fmt.Errorf("storage: open badger: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
 	}
 
 	// Create snapshot manager
 	snapMgr, err := snapshot.NewManager(cfg.Snapshot)
 	if err != nil {
-		walWriter.Close()
+		if walWriter != nil {
+			walWriter.Close()
+		}
+		if kv != nil {
+			kv.kv.Close()
+		}
 		return nil, fmt.Errorf("storage: create snapshot manager: %w", err)
 	}
 
+	// Create the archive shipper
+	if cfg.Archive != nil {
+		acfg := *cfg.Archive
+		acfg.WALDir = cfg.WAL.Dir
+		acfg.SnapshotDir = cfg.Snapshot.Dir
+		acfg.Cipher = cfg.Cipher
+		acfg.NodeID = cfg.NodeID
+		acfg.Logger = cfg.Logger
+		acfg.ActiveSegment = func() uint64 {
+			if walWriter == nil {
+				return 0
+			}
+			return walWriter.CurrentOffset() >> 32
+		}
+		if shipper, err = archive.NewShipper(acfg); err != nil {
+			if walWriter != nil {
+				walWriter.Close()
+			}
+			if kv != nil {
+				kv.kv.Close()
+			}
+			return nil, fmt.Errorf("storage: create archive shipper: %w", err)
+		}
+	}
+
 	engine := &Engine{
 		cfg:      cfg,
 		store:    store,
 		wal:      walWriter,
+		kv:       kv,
 		snapshot: snapMgr,
+		archive:  shipper,
+		sched:    newSnapshotScheduler(cfg.SnapshotPolicy, cfg.SnapshotInterval),
 		logger:   cfg.Logger,
-		stopCh:   make(chan struct{}),
-		doneCh:   make(chan struct{}),
+
+		fsyncSeconds:  fsyncSeconds,
+		commitEntries: commitEntries,
+		commitSeconds: commitSeconds,
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+	if cfg.TouchCoalesceInterval > 0 {
+		engine.touches = newTouchCoalescer(cfg.TouchCoalesceInterval)
 	}
 
 	// Start background tasks
 	go engine.backgroundLoop()
+	if shipper != nil {
+		shipper.Start()
+	}
 
 	return engine, nil
 }
 
-// Recover recovers data from snapshots and WAL.
+// Recover recovers data from snapshots and WAL, or from Badger with the
+// Badger backend.
 //
 // Recovery process:
 //  1. Load latest snapshot (if exists)
@@ -155,8 +328,48 @@ func (e *Engine) Recover(ctx context.Context) error {
 	startTime := time.Now()
 	e.logger.Info("storage recovery started")
 
-	// Step 1: Load latest snapshot
-	sessions, snapInfo, err := e.snapshot.Load()
+	var err error
+	if e.kv != nil {
+		err = e.recoverKV(ctx)
+	} else {
+		err = e.recoverWAL(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Step 3: Recovery complete
+	elapsed := time.Since(startTime)
+	if elapsed > 5*time.Second {
+		e.logger.Warn("recovery exceeded target",
+			"elapsed", elapsed,
+			"target", "5s")
+	} else {
+		e.logger.Info("recovery completed",
+			"elapsed", elapsed,
+			"session_count", e.store.Count())
+	}
+
+	return nil
+}
+
+// recoverWAL loads the latest snapshot into memory and replays the WAL
+// after it.
+func (e *Engine) recoverWAL(ctx context.Context) error {
+	startTime := time.Now()
+
+	// Step 1: Load latest snapshot, straight into memory as its chunks
+	// are decoded in parallel
+	snapInfo, err := e.snapshot.LoadInto(func(sessions []*domain.Session) error {
+		for i, err := range e.store.Restore(sessions) {
+			if err != nil {
+				e.logger.Warn("failed to restore session from snapshot",
+					"session_id", sessions[i].ID,
+					"error", err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		if errors.Is(err, snapshot.ErrNoSnapshots) {
 			e.logger.Info("no snapshot found, starting with empty store")
@@ -173,17 +386,10 @@ func (e *Engine) Recover(ctx context.Context) error {
 			"wal_last_offset", snapInfo.WALLastOffset,
 			"elapsed", time.Since(startTime))
 
-		// Load sessions into memory
-		for _, sess := range sessions {
-			if err := e.store.Create(ctx, sess); err != nil {
-				e.logger.Warn("failed to restore session from snapshot",
-					"session_id", sess.ID,
-					"error", err)
-			}
-		}
-
 		walOffset = snapInfo.WALLastOffset
-		e.lastWALOffset = walOffset
+		e.lastWALOffset.Store(walOffset)
+		e.lastSnapshot.Store(snapInfo.CreatedAt)
+		e.lastSnapshotOffset.Store(walOffset)
 	}
 
 	// Step 2: Replay WAL entries
@@ -194,24 +400,13 @@ func (e *Engine) Recover(ctx context.Context) error {
 	}
 
 	if applied > 0 {
+		e.sched.recovered(applied)
 		e.logger.Info("wal replayed",
 			"entries_applied", applied,
 			"from_offset", walOffset,
 			"elapsed", time.Since(replayStart))
 	}
 
-	// Step 3: Recovery complete
-	elapsed := time.Since(startTime)
-	if elapsed > 5*time.Second {
-		e.logger.Warn("recovery exceeded target",
-			"elapsed", elapsed,
-			"target", "5s")
-	} else {
-		e.logger.Info("recovery completed",
-			"elapsed", elapsed,
-			"session_count", e.store.Count())
-	}
-
 	return nil
 }
 
@@ -259,7 +454,9 @@ func (e *Engine) replayWAL(ctx context.Context, fromOffset uint64) (int, error)
 		}
 
 		applied++
-		e.lastWALOffset = e.wal.CurrentOffset()
+		if e.wal != nil {
+			e.lastWALOffset.Store(e.wal.CurrentOffset())
+		}
 	}
 
 	if skipped > 0 {
@@ -271,13 +468,19 @@ func (e *Engine) replayWAL(ctx context.Context, fromOffset uint64) (int, error)
 
 // applyEntry applies a WAL entry to the memory store.
 func (e *Engine) applyEntry(ctx context.Context, entry *wal.Entry) error {
+	return applyWALEntry(ctx, e.store, entry)
+}
+
+// applyWALEntry applies a WAL entry to store, as replayed during
+// recovery.
+func applyWALEntry(ctx context.Context, store *memory.Store, entry *wal.Entry) error {
 	switch entry.OpType {
 	case wal.OpTypeCreate:
 		if entry.Session == nil {
 			return fmt.Errorf("missing session data for CREATE")
 		}
 		// Ignore conflict errors during recovery
-		if err := e.store.Create(ctx, entry.Session); err != nil {
+		if err := store.Create(ctx, entry.Session); err != nil {
 			if !errors.Is(err, domain.ErrSessionConflict) {
 				return err
 			}
@@ -288,19 +491,17 @@ func (e *Engine) applyEntry(ctx context.Context, entry *wal.Entry) error {
 		if entry.Session == nil {
 			return fmt.Errorf("missing session data for UPDATE")
 		}
-		// Use version from entry
-		expectedVersion := entry.Session.Version - 1
-		if err := e.store.Update(ctx, entry.Session, expectedVersion); err != nil {
-			// Ignore not found and version conflict during recovery
-			if !errors.Is(err, domain.ErrSessionNotFound) &&
-				!errors.Is(err, domain.ErrSessionVersionConflict) {
+		// The entry holds the session as updated, version included
+		if err := store.UpdateSession(ctx, entry.Session); err != nil {
+			// Ignore not found during recovery
+			if !errors.Is(err, domain.ErrSessionNotFound) {
 				return err
 			}
 		}
 		return nil
 
 	case wal.OpTypeDelete:
-		if err := e.store.Delete(ctx, entry.SessionID); err != nil {
+		if err := store.Delete(ctx, entry.SessionID); err != nil {
 			// Ignore not found during recovery
 			if !errors.Is(err, domain.ErrSessionNotFound) {
 				return err
@@ -308,6 +509,21 @@ func (e *Engine) applyEntry(ctx context.Context, entry *wal.Entry) error {
 		}
 		return nil
 
+	case wal.OpTypeTouch:
+		// Applied in place; ignore sessions deleted since
+		_, err := store.ApplyTouch(ctx, entry.SessionID, entry.LastActive, entry.AccessIP, entry.AccessUA)
+		if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+			return err
+		}
+		return nil
+
+	case wal.OpTypeSetExpiry:
+		_, err := store.SetExpiry(ctx, entry.SessionID, entry.ExpiresAt, entry.TTL, entry.LastActive)
+		if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+			return err
+		}
+		return nil
+
 	default:
 		return fmt.Errorf("unknown entry type: %d", entry.OpType)
 	}
@@ -317,9 +533,19 @@ func (e *Engine) applyEntry(ctx context.Context, entry *wal.Entry) error {
 //
 // The operation is durable: written to WAL before memory.
 func (e *Engine) Create(ctx context.Context, session *domain.Session) error {
+	if e.kv != nil {
+		return e.kv.write(ctx, func() error {
+			return e.kv.createLocked(ctx, session)
+		})
+	}
+
+	defer e.sessionMu.lock(session.ID)()
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
 	// Step 1: Write to WAL
 	entry := wal.NewCreateEntry(session)
-	if err := e.wal.Append(entry); err != nil {
+	if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
 		return fmt.Errorf("write wal: %w", err)
 	}
 
@@ -328,36 +554,60 @@ func (e *Engine) Create(ctx context.Context, session *domain.Session) error {
 		return err
 	}
 
-	e.lastWALOffset = e.wal.CurrentOffset()
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
 	return nil
 }
 
 // Get retrieves a session by ID.
 func (e *Engine) Get(ctx context.Context, id string) (*domain.Session, error) {
+	if e.kv != nil {
+		return e.kv.get(ctx, id)
+	}
 	return e.store.Get(ctx, id)
 }
 
 // GetByToken retrieves a session by token hash.
 func (e *Engine) GetByToken(ctx context.Context, tokenHash string) (*domain.Session, error) {
+	if e.kv != nil {
+		return e.kv.getByToken(ctx, tokenHash)
+	}
 	return e.store.GetByToken(ctx, tokenHash)
 }
 
 // Update updates an existing session.
 //
-// The operation is durable: written to WAL before memory.
+// The operation is durable: written to WAL before memory. An update that
+// memory would reject is not written to WAL.
 func (e *Engine) Update(ctx context.Context, session *domain.Session, expectedVersion uint64) error {
-	// Step 1: Write to WAL
-	entry := wal.NewUpdateEntry(session)
-	if err := e.wal.Append(entry); err != nil {
+	if e.kv != nil {
+		return e.kv.write(ctx, func() error {
+			return e.kv.updateLocked(ctx, session, expectedVersion, true)
+		})
+	}
+
+	defer e.sessionMu.lock(session.ID)()
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
+	// Step 1: Check the version, which holds until the update is applied
+	if err := e.store.CheckUpdate(ctx, session, expectedVersion); err != nil {
+		return err
+	}
+
+	// Step 2: Write to WAL, with the version the update produces
+	updated := session.Clone()
+	updated.Version = expectedVersion + 1
+	entry := wal.NewUpdateEntry(updated)
+	if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
 		return fmt.Errorf("write wal: %w", err)
 	}
 
-	// Step 2: Update memory
+	// Step 3: Update memory
 	if err := e.store.Update(ctx, session, expectedVersion); err != nil {
 		return err
 	}
 
-	e.lastWALOffset = e.wal.CurrentOffset()
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
 	return nil
 }
 
@@ -365,9 +615,19 @@ func (e *Engine) Update(ctx context.Context, session *domain.Session, expectedVe
 //
 // This is used for operations like Touch that don't require strict versioning.
 func (e *Engine) UpdateSession(ctx context.Context, session *domain.Session) error {
+	if e.kv != nil {
+		return e.kv.write(ctx, func() error {
+			return e.kv.updateLocked(ctx, session, 0, false)
+		})
+	}
+
+	defer e.sessionMu.lock(session.ID)()
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
 	// Step 1: Write to WAL
 	entry := wal.NewUpdateEntry(session)
-	if err := e.wal.Append(entry); err != nil {
+	if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
 		return fmt.Errorf("write wal: %w", err)
 	}
 
@@ -376,7 +636,7 @@ func (e *Engine) UpdateSession(ctx context.Context, session *domain.Session) err
 		return err
 	}
 
-	e.lastWALOffset = e.wal.CurrentOffset()
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
 	return nil
 }
 
@@ -384,9 +644,19 @@ func (e *Engine) UpdateSession(ctx context.Context, session *domain.Session) err
 //
 // The operation is durable: written to WAL before memory.
 func (e *Engine) Delete(ctx context.Context, id string) error {
+	if e.kv != nil {
+		return e.kv.write(ctx, func() error {
+			return e.kv.deleteLocked(ctx, id)
+		})
+	}
+
+	defer e.sessionMu.lock(id)()
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
 	// Step 1: Write to WAL
 	entry := wal.NewDeleteEntry(id)
-	if err := e.wal.Append(entry); err != nil {
+	if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
 		return fmt.Errorf("write wal: %w", err)
 	}
 
@@ -395,27 +665,152 @@ func (e *Engine) Delete(ctx context.Context, id string) error {
 		return err
 	}
 
-	e.lastWALOffset = e.wal.CurrentOffset()
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
 	return nil
 }
 
+// CreateBatch creates several sessions with a single WAL commit.
+//
+// The returned slice holds one error (or nil) per session, in order.
+// If the WAL commit fails, every session fails with that error.
+func (e *Engine) CreateBatch(ctx context.Context, sessions []*domain.Session) []error {
+	if e.kv != nil {
+		return e.kv.writeBatch(ctx, len(sessions), func(i int) error {
+			return e.kv.createLocked(ctx, sessions[i])
+		})
+	}
+
+	entries := make([]*wal.Entry, len(sessions))
+	for i, session := range sessions {
+		entries[i] = wal.NewCreateEntry(session)
+	}
+
+	return e.applyBatch(ctx, entries, func(i int) error {
+		return e.store.Create(ctx, sessions[i])
+	})
+}
+
+// UpdateSessionBatch updates several sessions without version checking,
+// with a single WAL commit.
+func (e *Engine) UpdateSessionBatch(ctx context.Context, sessions []*domain.Session) []error {
+	if e.kv != nil {
+		return e.kv.writeBatch(ctx, len(sessions), func(i int) error {
+			return e.kv.updateLocked(ctx, sessions[i], 0, false)
+		})
+	}
+
+	entries := make([]*wal.Entry, len(sessions))
+	for i, session := range sessions {
+		entries[i] = wal.NewUpdateEntry(session)
+	}
+
+	return e.applyBatch(ctx, entries, func(i int) error {
+		return e.store.UpdateSession(ctx, sessions[i])
+	})
+}
+
+// DeleteBatch deletes several sessions with a single WAL commit.
+func (e *Engine) DeleteBatch(ctx context.Context, ids []string) []error {
+	if e.kv != nil {
+		return e.kv.writeBatch(ctx, len(ids), func(i int) error {
+			return e.kv.deleteLocked(ctx, ids[i])
+		})
+	}
+
+	entries := make([]*wal.Entry, len(ids))
+	for i, id := range ids {
+		entries[i] = wal.NewDeleteEntry(id)
+	}
+
+	return e.applyBatch(ctx, entries, func(i int) error {
+		return e.store.Delete(ctx, ids[i])
+	})
+}
+
+// walDurability returns the WAL durability of the writes made with ctx.
+func walDurability(ctx context.Context) wal.Durability {
+	switch service.DurabilityFromContext(ctx) {
+	case domain.DurabilityNone:
+		return wal.DurabilityNone
+	case domain.DurabilityBuffered:
+		return wal.DurabilityBuffered
+	case domain.DurabilityFsync:
+		return wal.DurabilityFsync
+	default:
+		return wal.DurabilityDefault
+	}
+}
+
+// applyBatch commits entries to the WAL as one group, then applies each
+// one to memory and collects the per-item results.
+func (e *Engine) applyBatch(ctx context.Context, entries []*wal.Entry, apply func(i int) error) []error {
+	errs := make([]error, len(entries))
+	if len(entries) == 0 {
+		return errs
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.SessionID
+	}
+	defer e.sessionMu.lockAll(ids)()
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
+	// Step 1: Write to WAL
+	if err := e.wal.AppendBatchDurable(entries, walDurability(ctx)); err != nil {
+		err = fmt.Errorf("write wal: %w", err)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	// Step 2: Apply to memory
+	for i := range entries {
+		errs[i] = apply(i)
+	}
+
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
+	return errs
+}
+
 // List lists sessions matching the filter.
+//
+// With the Badger backend and a bounded cache, a filter that selects no
+// user scans every session in Badger.
 func (e *Engine) List(ctx context.Context, filter *service.SessionFilter) ([]*domain.Session, int, error) {
+	if e.kv != nil {
+		return e.kv.list(ctx, filter)
+	}
 	return e.store.List(ctx, filter)
 }
 
 // CountByUserID counts sessions for a specific user.
 func (e *Engine) CountByUserID(ctx context.Context, userID string) (int, error) {
+	if e.kv != nil {
+		return e.kv.countByUser(ctx, userID)
+	}
 	return e.store.CountByUserID(ctx, userID)
 }
 
 // ListByUserID lists all sessions for a specific user.
 func (e *Engine) ListByUserID(ctx context.Context, userID string) ([]*domain.Session, error) {
+	if e.kv != nil {
+		return e.kv.listByUser(ctx, userID)
+	}
 	return e.store.ListByUserID(ctx, userID)
 }
 
 // DeleteByUserID deletes all sessions for a specific user.
 func (e *Engine) DeleteByUserID(ctx context.Context, userID string) (int, error) {
+	if e.kv != nil {
+		return e.kv.deleteByUser(ctx, userID)
+	}
+
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
 	// Step 1: Get all session IDs for the user
 	sessions, err := e.store.ListByUserID(ctx, userID)
 	if err != nil {
@@ -425,7 +820,7 @@ func (e *Engine) DeleteByUserID(ctx context.Context, userID string) (int, error)
 	// Step 2: Write DELETE entries to WAL
 	for _, sess := range sessions {
 		entry := wal.NewDeleteEntry(sess.ID)
-		if err := e.wal.Append(entry); err != nil {
+		if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
 			e.logger.Error("write wal for bulk delete failed",
 				"session_id", sess.ID,
 				"error", err)
@@ -443,6 +838,9 @@ func (e *Engine) DeleteByUserID(ctx context.Context, userID string) (int, error)
 
 // GetSessionByTokenHash retrieves a session by token hash.
 func (e *Engine) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*domain.Session, error) {
+	if e.kv != nil {
+		return e.kv.getByToken(ctx, tokenHash)
+	}
 	return e.store.GetSessionByTokenHash(ctx, tokenHash)
 }
 
@@ -450,52 +848,134 @@ func (e *Engine) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*
 //
 // This is called by admin API or background tasks.
 func (e *Engine) TriggerSnapshot(ctx context.Context) (*snapshot.Info, error) {
-	e.logger.Info("triggering snapshot")
+	return e.runSnapshot(ctx, TriggerManual)
+}
 
-	// Collect all sessions from memory (use All() for efficiency)
-	sessions := e.store.All()
+// runSnapshot creates a snapshot, then prunes the older snapshots and
+// compacts the WAL behind it, recording the run for SnapshotSchedule.
+func (e *Engine) runSnapshot(ctx context.Context, trigger string) (*snapshot.Info, error) {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+
+	e.logger.Info("triggering snapshot", "trigger", trigger)
+	run := &SnapshotRun{Trigger: trigger, Started: time.Now()}
+	var appended uint64
+	if e.wal != nil {
+		appended = e.wal.Status().Appended
+	}
 
-	// Create snapshot
-	info, err := e.snapshot.Create(sessions, e.lastWALOffset)
+	info, err := e.createSnapshot()
+	run.Snapshot = time.Since(run.Started)
 	if err != nil {
+		run.Duration = run.Snapshot
+		run.Err = err.Error()
+		e.sched.finish(run, appended)
 		return nil, fmt.Errorf("create snapshot: %w", err)
 	}
+	e.lastSnapshot.Store(info.CreatedAt)
+	if e.wal != nil {
+		e.lastSnapshotOffset.Store(info.WALLastOffset)
+	}
 
 	e.logger.Info("snapshot created",
 		"id", info.ID,
+		"trigger", trigger,
 		"session_count", info.SessionCount,
 		"wal_last_offset", info.WALLastOffset,
-		"size_bytes", info.Size)
+		"size_bytes", info.Size,
+		"elapsed", run.Snapshot)
 
 	// Clean up old snapshots
+	pruneStart := time.Now()
 	if err := e.snapshot.Prune(); err != nil {
 		e.logger.Warn("snapshot cleanup failed", "error", err)
 	}
+	run.Prune = time.Since(pruneStart)
+
+	// Best-effort WAL compaction after snapshot, keeping the segments
+	// not shipped to the archive yet.
+	if e.wal != nil {
+		compactStart := time.Now()
+		compactOffset := info.WALLastOffset
+		if e.archive != nil {
+			compactOffset = min(compactOffset, e.archive.UnshippedSegment()<<32)
+		}
+		if err := e.compactor().Compact(compactOffset); err != nil {
+			e.logger.Warn("wal compaction failed", "error", err)
+		}
+		run.Compact = time.Since(compactStart)
+	}
 
-	// Best-effort WAL compaction after snapshot.
-	compactor := wal.NewCompactor(e.cfg.WAL.Dir)
-	if err := compactor.Compact(info.WALLastOffset); err != nil {
-		e.logger.Warn("wal compaction failed", "error", err)
+	if e.archive != nil {
+		e.archive.Notify()
 	}
 
+	run.Duration = time.Since(run.Started)
+	run.SessionCount = info.SessionCount
+	run.Size = info.Size
+	run.WALOffset = info.WALLastOffset
+	e.sched.finish(run, appended)
+
 	return info, nil
 }
 
-// backgroundLoop runs periodic snapshot creation.
+// compactor returns a compactor of the WAL directory, archiving the
+// compacted segments if configured to.
+func (e *Engine) compactor() *wal.Compactor {
+	var opts []wal.CompactorOption
+	if e.cfg.WALArchiveDir != "" {
+		opts = append(opts, wal.WithArchiveDir(e.cfg.WALArchiveDir))
+	}
+	return wal.NewCompactor(e.cfg.WAL.Dir, opts...)
+}
+
+// createSnapshot streams a point-in-time view of the sessions into a new
+// snapshot: of memory, or of Badger with the Badger backend, whose
+// snapshots are backups and are not loaded by Recover.
+func (e *Engine) createSnapshot() (*snapshot.Info, error) {
+	if e.kv != nil {
+		return e.snapshot.CreateFrom(e.kv.scanKV, 0)
+	}
+
+	// Take the WAL offset and open the view with no write between its WAL
+	// append and its memory apply, so every entry up to the offset is in
+	// the view. Entries logged after the offset may be in the view too;
+	// replaying them on recovery is harmless.
+	e.applyMu.Lock()
+	walOffset := e.lastWALOffset.Load()
+	view := e.store.OpenView()
+	e.applyMu.Unlock()
+	defer view.Close()
+
+	return e.snapshot.CreateFrom(view.Scan, walOffset)
+}
+
+// backgroundLoop evaluates the snapshot policy, with the WAL backend,
+// and logs coalesced touches.
 func (e *Engine) backgroundLoop() {
 	defer close(e.doneCh)
 
-	ticker := time.NewTicker(e.cfg.SnapshotInterval)
-	defer ticker.Stop()
+	var snapshotTick <-chan time.Time
+	if e.wal != nil {
+		ticker := time.NewTicker(e.sched.checkInterval())
+		defer ticker.Stop()
+		snapshotTick = ticker.C
+	}
+
+	var touchTick <-chan time.Time
+	if e.touches != nil {
+		touchTicker := time.NewTicker(e.cfg.TouchCoalesceInterval)
+		defer touchTicker.Stop()
+		touchTick = touchTicker.C
+	}
 
 	for {
 		select {
-		case <-ticker.C:
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			if _, err := e.TriggerSnapshot(ctx); err != nil {
-				e.logger.Error("auto snapshot failed", "error", err)
-			}
-			cancel()
+		case <-touchTick:
+			e.flushTouches(false)
+
+		case now := <-snapshotTick:
+			e.checkSnapshot(now)
 
 		case <-e.stopCh:
 			return
@@ -512,11 +992,35 @@ func (e *Engine) Close() error {
 
 	// Wait for background loop to finish
 	<-e.doneCh
+	if e.migrateDone != nil {
+		<-e.migrateDone
+	}
+
+	// Log the touches still coalesced
+	e.flushTouches(true)
+
+	// Snapshot what the next start would otherwise replay
+	e.shutdownSnapshot()
+
+	// Stop shipping; what is left is shipped after a restart
+	if e.archive != nil {
+		e.archive.Close()
+	}
 
 	// Close WAL writer (this will flush pending writes)
-	if err := e.wal.Close(); err != nil {
-		e.logger.Error("close wal failed", "error", err)
-		return err
+	if e.wal != nil {
+		if err := e.wal.Close(); err != nil {
+			e.logger.Error("close wal failed", "error", err)
+			return err
+		}
+	}
+
+	// Close Badger
+	if e.kv != nil {
+		if err := e.kv.kv.Close(); err != nil {
+			e.logger.Error("close badger failed", "error", err)
+			return err
+		}
 	}
 
 	e.logger.Info("storage engine shutdown complete")
@@ -525,11 +1029,18 @@ func (e *Engine) Close() error {
 
 // Count returns the total number of sessions in storage.
 func (e *Engine) Count(ctx context.Context) int {
+	if e.kv != nil {
+		return e.kv.count()
+	}
 	return e.store.Count()
 }
 
 // Scan iterates over all sessions in storage.
 func (e *Engine) Scan(fn func(*domain.Session) bool) {
+	if e.kv != nil {
+		e.kv.scan(fn)
+		return
+	}
 	e.store.Scan(fn)
 }
 
@@ -537,7 +1048,22 @@ func (e *Engine) Scan(fn func(*domain.Session) bool) {
 //
 // This method delegates to the memory store's cleanup routine.
 // Note: Expired sessions are not written to WAL as delete entries
-// because they are naturally cleaned up during recovery.
+// because they are naturally cleaned up during recovery. With the Badger
+// backend they are deleted from Badger too.
 func (e *Engine) DeleteExpired(ctx context.Context) (int, error) {
+	if e.kv != nil {
+		sessions, err := e.kv.deleteExpired(ctx)
+		return len(sessions), err
+	}
 	return e.store.DeleteExpired(ctx)
 }
+
+// DeleteExpiredSessions deletes all expired sessions and returns them, so
+// the service layer can publish expirations. Like DeleteExpired, it writes
+// no WAL entries.
+func (e *Engine) DeleteExpiredSessions(ctx context.Context) ([]*domain.Session, error) {
+	if e.kv != nil {
+		return e.kv.deleteExpired(ctx)
+	}
+	return e.store.DeleteExpiredSessions(ctx)
+}
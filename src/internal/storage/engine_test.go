@@ -3,11 +3,18 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
 	"github.com/yndnr/tokmesh-go/internal/storage/wal"
@@ -437,6 +444,92 @@ func TestEngine_RecoveryFromWAL(t *testing.T) {
 	})
 }
 
+func TestEngine_Batch(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	cfg1 := DefaultConfig(tmpDir)
+	cfg1.SnapshotInterval = time.Hour
+
+	engine1, err := New(cfg1)
+	if err != nil {
+		t.Fatalf("New(1) failed: %v", err)
+	}
+
+	sessions := make([]*domain.Session, 4)
+	ids := make([]string, 4)
+	for i := range sessions {
+		session, _ := domain.NewSession("batch_user")
+		session.TokenHash = "batch_token_" + string(rune('a'+i))
+		session.SetExpiration(time.Hour)
+		sessions[i] = session
+		ids[i] = session.ID
+	}
+	// Duplicate of the first session fails on its own
+	sessions = append(sessions, sessions[0].Clone())
+
+	var _ service.SessionBatchRepository = engine1
+	var _ service.TokenBatchRepository = engine1
+
+	errs := engine1.CreateBatch(ctx, sessions)
+	if len(errs) != 5 {
+		t.Fatalf("CreateBatch returned %d results, want 5", len(errs))
+	}
+	for i := 0; i < 4; i++ {
+		if errs[i] != nil {
+			t.Errorf("CreateBatch[%d] = %v, want nil", i, errs[i])
+		}
+	}
+	if errs[4] == nil {
+		t.Error("CreateBatch should reject a duplicate session")
+	}
+
+	touched := sessions[1].Clone()
+	touched.DeviceID = "touched"
+	touched.IncrVersion()
+	if errs := engine1.UpdateSessionBatch(ctx, []*domain.Session{touched}); errs[0] != nil {
+		t.Fatalf("UpdateSessionBatch failed: %v", errs[0])
+	}
+
+	errs = engine1.DeleteBatch(ctx, []string{ids[2], "missing"})
+	if errs[0] != nil {
+		t.Errorf("DeleteBatch[0] = %v, want nil", errs[0])
+	}
+	if !errors.Is(errs[1], domain.ErrSessionNotFound) {
+		t.Errorf("DeleteBatch[1] = %v, want not found", errs[1])
+	}
+
+	engine1.Close()
+
+	// Everything must survive WAL replay
+	cfg2 := DefaultConfig(tmpDir)
+	cfg2.SnapshotInterval = time.Hour
+
+	engine2, err := New(cfg2)
+	if err != nil {
+		t.Fatalf("New(2) failed: %v", err)
+	}
+	defer engine2.Close()
+
+	if err := engine2.Recover(ctx); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+
+	if count := engine2.Count(ctx); count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+	got, err := engine2.Get(ctx, ids[1])
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.DeviceID != "touched" {
+		t.Errorf("DeviceID = %q, want touched", got.DeviceID)
+	}
+	if _, err := engine2.Get(ctx, ids[2]); err == nil {
+		t.Error("deleted session should not be recovered")
+	}
+}
+
 func TestEngine_ApplyEntry(t *testing.T) {
 	tmpDir := t.TempDir()
 	cfg := DefaultConfig(tmpDir)
@@ -1231,3 +1324,429 @@ func TestEngine_New_WithMaxSessionsPerUser(t *testing.T) {
 		t.Error("Expected quota error for third session")
 	}
 }
+
+func TestEngine_StatsAndCollectors(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := DefaultConfig(tmpDir)
+	cfg.WAL.SyncMode = wal.SyncModeSync
+
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer engine.Close()
+
+	ctx := context.Background()
+	session, _ := domain.NewSession("stats_user")
+	session.TokenHash = "stats_token"
+	session.SetExpiration(time.Hour)
+	// A batch commits at once, so the sync mode WAL fsyncs.
+	if errs := engine.CreateBatch(ctx, []*domain.Session{session}); errs[0] != nil {
+		t.Fatalf("CreateBatch failed: %v", errs[0])
+	}
+
+	stats := engine.Stats()
+	if stats.Sessions != 1 {
+		t.Errorf("Sessions = %d, want 1", stats.Sessions)
+	}
+	if stats.WALSizeBytes <= 0 {
+		t.Errorf("WALSizeBytes = %d, want > 0", stats.WALSizeBytes)
+	}
+	if !stats.LastSnapshot.IsZero() {
+		t.Errorf("LastSnapshot = %v, want zero", stats.LastSnapshot)
+	}
+
+	if _, err := engine.TriggerSnapshot(ctx); err != nil {
+		t.Fatalf("TriggerSnapshot failed: %v", err)
+	}
+	if since := time.Since(engine.Stats().LastSnapshot); since < 0 || since > time.Minute {
+		t.Errorf("LastSnapshot age = %v", since)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(engine.Collectors()...)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	got := make(map[string]*dto.MetricFamily)
+	for _, mf := range families {
+		got[mf.GetName()] = mf
+	}
+	if mf := got["tokmesh_sessions_active"]; mf == nil || mf.Metric[0].GetGauge().GetValue() != 1 {
+		t.Errorf("tokmesh_sessions_active = %v", mf)
+	}
+	if mf := got["tokmesh_wal_size_bytes"]; mf == nil || mf.Metric[0].GetGauge().GetValue() <= 0 {
+		t.Errorf("tokmesh_wal_size_bytes = %v", mf)
+	}
+	if mf := got["tokmesh_snapshot_last_timestamp_seconds"]; mf == nil || mf.Metric[0].GetGauge().GetValue() <= 0 {
+		t.Errorf("tokmesh_snapshot_last_timestamp_seconds = %v", mf)
+	}
+	if mf := got["tokmesh_wal_fsync_duration_seconds"]; mf == nil || mf.Metric[0].GetHistogram().GetSampleCount() == 0 {
+		t.Errorf("tokmesh_wal_fsync_duration_seconds = %v", mf)
+	}
+}
+
+func TestEngine_SnapshotDuringWrites(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	cfg := DefaultConfig(tmpDir)
+	cfg.Snapshot.ChunkSize = 4096
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var ids []string
+	for i := 0; i < 2000; i++ {
+		session, _ := domain.NewSession(fmt.Sprintf("user-%d", i))
+		session.SetExpiration(time.Hour)
+		if err := engine.Create(ctx, session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		ids = append(ids, session.ID)
+	}
+
+	// Write while the snapshot is taken; the snapshot plus the WAL after
+	// its offset must recover the final state.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, id := range ids[:1000] {
+			if i%2 == 0 {
+				_ = engine.Delete(ctx, id)
+			}
+			session, _ := domain.NewSession(fmt.Sprintf("late-%d", i))
+			session.SetExpiration(time.Hour)
+			_ = engine.Create(ctx, session)
+		}
+	}()
+	if _, err := engine.TriggerSnapshot(ctx); err != nil {
+		t.Fatalf("TriggerSnapshot failed: %v", err)
+	}
+	wg.Wait()
+
+	want := make(map[string]bool)
+	engine.Scan(func(s *domain.Session) bool {
+		want[s.ID] = true
+		return true
+	})
+	engine.Close()
+
+	recovered, err := New(DefaultConfig(tmpDir))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer recovered.Close()
+	if err := recovered.Recover(ctx); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+
+	got := make(map[string]bool)
+	recovered.Scan(func(s *domain.Session) bool {
+		got[s.ID] = true
+		return true
+	})
+	if len(got) != len(want) {
+		t.Fatalf("recovered %d sessions, want %d", len(got), len(want))
+	}
+	for id := range want {
+		if !got[id] {
+			t.Fatalf("session %s not recovered", id)
+		}
+	}
+}
+
+// walOps returns the operation types of the WAL entries in dir, in order.
+func walOps(t *testing.T, dir string) []wal.OpType {
+	t.Helper()
+	var ops []wal.OpType
+	_, err := wal.ScanSegments(dir, nil, func(_ uint64, e *wal.Entry) error {
+		ops = append(ops, e.OpType)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanSegments: %v", err)
+	}
+	return ops
+}
+
+func TestEngine_TouchAndSetExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	cfg := DefaultConfig(tmpDir)
+	engine1, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(1) failed: %v", err)
+	}
+
+	session, _ := domain.NewSession("touch_user")
+	session.TokenHash = "touch_engine"
+	session.SetExpiration(time.Hour)
+	if err := engine1.Create(ctx, session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	lastActive := session.LastActive + 1000
+	touched, err := engine1.TouchSession(ctx, session.ID, lastActive, "192.0.2.1", "agent")
+	if err != nil {
+		t.Fatalf("TouchSession: %v", err)
+	}
+	if touched.LastActive != lastActive || touched.LastAccessIP != "192.0.2.1" || touched.Version != session.Version {
+		t.Errorf("TouchSession = %+v", touched)
+	}
+	expiresAt := time.Now().Add(2 * time.Hour).UnixMilli()
+	if _, err := engine1.SetSessionExpiry(ctx, session.ID, expiresAt, (2 * time.Hour).Milliseconds(), lastActive+1000); err != nil {
+		t.Fatalf("SetSessionExpiry: %v", err)
+	}
+	if _, err := engine1.TouchSession(ctx, "tmss-missing", lastActive, "", ""); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("TouchSession of a missing session = %v", err)
+	}
+	engine1.Close()
+
+	ops := walOps(t, cfg.WAL.Dir)
+	want := []wal.OpType{wal.OpTypeCreate, wal.OpTypeTouch, wal.OpTypeSetExpiry, wal.OpTypeTouch}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("WAL ops = %v, want %v", ops, want)
+	}
+
+	// Replay applies the entries in place.
+	engine2, err := New(DefaultConfig(tmpDir))
+	if err != nil {
+		t.Fatalf("New(2) failed: %v", err)
+	}
+	defer engine2.Close()
+	if err := engine2.Recover(ctx); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	got, err := engine2.Get(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.LastActive != lastActive+1000 || got.LastAccessIP != "192.0.2.1" || got.LastAccessUA != "agent" ||
+		got.ExpiresAt != expiresAt || got.Version != session.Version {
+		t.Errorf("recovered session = %+v", got)
+	}
+}
+
+func TestEngine_TouchSessionBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	var commits []int
+	cfg := DefaultConfig(tmpDir)
+	cfg.WAL.SyncMode = wal.SyncModeGroup
+	cfg.WAL.SyncInterval = time.Hour
+	cfg.WAL.OnCommit = func(entries int, _ time.Duration) {
+		commits = append(commits, entries)
+	}
+	engine1, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(1) failed: %v", err)
+	}
+
+	var _ service.SessionTouchBatchRepository = engine1
+
+	sessions := make([]*domain.Session, 2)
+	for i := range sessions {
+		sessions[i], _ = domain.NewSession("touch_batch_user")
+		sessions[i].TokenHash = fmt.Sprintf("touch_batch_%d", i)
+		sessions[i].SetExpiration(time.Hour)
+	}
+	for _, err := range engine1.CreateBatch(ctx, sessions) {
+		if err != nil {
+			t.Fatalf("CreateBatch: %v", err)
+		}
+	}
+
+	lastActive := sessions[0].LastActive + 1000
+	touched, errs := engine1.TouchSessionBatch(ctx, []service.SessionTouch{
+		{ID: sessions[0].ID, LastActive: lastActive, IP: "192.0.2.1"},
+		{ID: "tmss-missing", LastActive: lastActive},
+		{ID: sessions[1].ID, LastActive: lastActive, UserAgent: "agent"},
+	})
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("TouchSessionBatch errs = %v", errs)
+	}
+	if !errors.Is(errs[1], domain.ErrSessionNotFound) {
+		t.Errorf("TouchSessionBatch of a missing session = %v", errs[1])
+	}
+	if touched[0].LastAccessIP != "192.0.2.1" || touched[2].LastAccessUA != "agent" || touched[2].LastActive != lastActive {
+		t.Errorf("TouchSessionBatch = %+v, %+v", touched[0], touched[2])
+	}
+	if !reflect.DeepEqual(commits, []int{2, 3}) {
+		t.Errorf("group commits = %v, want [2 3]", commits)
+	}
+	engine1.Close()
+
+	ops := walOps(t, cfg.WAL.Dir)
+	want := []wal.OpType{wal.OpTypeCreate, wal.OpTypeCreate, wal.OpTypeTouch, wal.OpTypeTouch, wal.OpTypeTouch}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("WAL ops = %v, want %v", ops, want)
+	}
+
+	engine2, err := New(DefaultConfig(tmpDir))
+	if err != nil {
+		t.Fatalf("New(2) failed: %v", err)
+	}
+	defer engine2.Close()
+	if err := engine2.Recover(ctx); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	for i, s := range sessions {
+		got, err := engine2.Get(ctx, s.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.LastActive != lastActive || got.Version != s.Version {
+			t.Errorf("recovered session %d = %+v", i, got)
+		}
+	}
+}
+
+func TestEngine_TouchCoalescing(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	cfg := DefaultConfig(tmpDir)
+	cfg.TouchCoalesceInterval = time.Hour
+	engine1, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(1) failed: %v", err)
+	}
+
+	session, _ := domain.NewSession("coalesce_user")
+	session.TokenHash = "coalesce_engine"
+	session.SetExpiration(time.Hour)
+	if err := engine1.Create(ctx, session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for i := int64(1); i <= 5; i++ {
+		ip := ""
+		if i == 3 {
+			ip = "192.0.2.3"
+		}
+		touched, err := engine1.TouchSession(ctx, session.ID, session.LastActive+i*1000, ip, "")
+		if err != nil {
+			t.Fatalf("TouchSession %d: %v", i, err)
+		}
+		if touched.LastActive != session.LastActive+i*1000 {
+			t.Errorf("touch %d not applied to memory: %+v", i, touched)
+		}
+	}
+
+	// The first touch is logged at once and the latest one on Close.
+	if err := engine1.wal.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if ops := walOps(t, cfg.WAL.Dir); len(ops) != 2 {
+		t.Errorf("WAL ops before Close = %v, want create and one touch", ops)
+	}
+	engine1.Close()
+	if ops := walOps(t, cfg.WAL.Dir); len(ops) != 3 {
+		t.Errorf("WAL ops after Close = %v, want create and two touches", ops)
+	}
+
+	engine2, err := New(DefaultConfig(tmpDir))
+	if err != nil {
+		t.Fatalf("New(2) failed: %v", err)
+	}
+	defer engine2.Close()
+	if err := engine2.Recover(ctx); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	got, err := engine2.Get(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.LastActive != session.LastActive+5000 || got.LastAccessIP != "192.0.2.3" {
+		t.Errorf("recovered session = %+v, want the latest touch", got)
+	}
+}
+
+func TestTouchCoalescer_Due(t *testing.T) {
+	c := newTouchCoalescer(time.Second)
+
+	if !c.admit(wal.NewTouchEntry("a", 1, "", ""), 0) {
+		t.Fatal("first touch should be logged")
+	}
+	if c.admit(wal.NewTouchEntry("a", 2, "", ""), 500) {
+		t.Fatal("touch within the interval should be coalesced")
+	}
+	if got := c.due(900, false); len(got) != 0 {
+		t.Fatalf("due before the interval = %d entries", len(got))
+	}
+	got := c.due(1000, false)
+	if len(got) != 1 || got[0].LastActive != 2 {
+		t.Fatalf("due = %+v, want the pending touch", got)
+	}
+
+	// Sessions not touched for an interval are forgotten.
+	c.due(2000, false)
+	if len(c.logged) != 0 || len(c.pending) != 0 {
+		t.Errorf("coalescer keeps %d logged, %d pending", len(c.logged), len(c.pending))
+	}
+}
+
+func TestEngine_Durability(t *testing.T) {
+	var mu sync.Mutex
+	var commits []int
+	cfg := DefaultConfig(t.TempDir())
+	cfg.WAL.SyncMode = wal.SyncModeGroup
+	cfg.WAL.SyncInterval = time.Hour
+	cfg.WAL.OnCommit = func(entries int, _ time.Duration) {
+		mu.Lock()
+		commits = append(commits, entries)
+		mu.Unlock()
+	}
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer engine.Close()
+
+	create := func(ctx context.Context, name string) {
+		t.Helper()
+		session, _ := domain.NewSession(name)
+		session.TokenHash = "durability_" + name
+		if err := engine.Create(ctx, session); err != nil {
+			t.Fatalf("Create(%s): %v", name, err)
+		}
+	}
+	ctx := context.Background()
+
+	// Group mode acknowledges a write once it is fsynced.
+	create(ctx, "default")
+	// A request can relax that, and its write is made durable with the
+	// next commit.
+	create(service.WithDurability(ctx, domain.DurabilityNone), "none")
+	create(service.WithDurability(ctx, domain.DurabilityBuffered), "buffered")
+	create(service.WithDurability(ctx, domain.DurabilityFsync), "fsync")
+
+	mu.Lock()
+	got := append([]int(nil), commits...)
+	mu.Unlock()
+	if !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("group commits = %v, want [1 3]", got)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(engine.Collectors()...)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "tokmesh_wal_group_commit_entries" {
+			if h := mf.Metric[0].GetHistogram(); h.GetSampleCount() != 2 || h.GetSampleSum() != 4 {
+				t.Errorf("group commit entries = %d samples, sum %v", h.GetSampleCount(), h.GetSampleSum())
+			}
+			return
+		}
+	}
+	t.Error("tokmesh_wal_group_commit_entries not collected")
+}
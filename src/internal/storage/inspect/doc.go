@@ -0,0 +1,15 @@
+// Package inspect examines a TokMesh data directory offline, while the
+// server is stopped.
+//
+// It is the backend of "tokmesh-cli data" and "tokmesh-server --inspect":
+//
+//   - inspect.go: Segment and snapshot listing and chain verification
+//   - dump.go: WAL entries and snapshot sessions as JSONL, PII optionally masked
+//   - repair.go: Truncating a torn WAL tail and quarantining corrupt snapshots
+//
+// Verification checks that recovery (DS-0102) can rebuild every session:
+// the latest valid snapshot plus a gap-free WAL from its offset on, with
+// only the newest segment unsealed and at most a torn tail damaged.
+//
+// @design DS-0102
+package inspect
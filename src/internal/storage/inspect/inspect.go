@@ -0,0 +1,210 @@
+// Package inspect examines a TokMesh data directory offline.
+package inspect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+// Options locates the data directory to inspect.
+type Options struct {
+	// DataDir is the server's storage.data_dir.
+	DataDir string
+
+	// Cipher decrypts an encrypted data directory. Without it encrypted
+	// sessions are counted but not decoded.
+	Cipher adaptive.Cipher
+}
+
+// walDir and snapshotDir return the directories the storage engine uses
+// under DataDir.
+func (o Options) walDir() string {
+	return storage.DefaultConfig(o.DataDir).WAL.Dir
+}
+
+func (o Options) snapshotDir() string {
+	return storage.DefaultConfig(o.DataDir).Snapshot.Dir
+}
+
+// check fails if the data directory does not exist, so a typo is not
+// reported as an empty data directory.
+func (o Options) check() error {
+	if o.DataDir == "" {
+		return fmt.Errorf("inspect: data directory is required")
+	}
+	st, err := os.Stat(o.DataDir)
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("inspect: %s is not a directory", o.DataDir)
+	}
+	return nil
+}
+
+// snapshots returns a snapshot manager for the snapshot directory, or
+// nil if it does not exist.
+func (o Options) snapshots() (*snapshot.Manager, error) {
+	dir := o.snapshotDir()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return snapshot.NewManager(snapshot.Config{Dir: dir, Cipher: o.Cipher})
+}
+
+// SnapshotReport describes a snapshot file. For a snapshot that failed
+// to load only ID, Path and Size are set.
+type SnapshotReport struct {
+	snapshot.Info
+
+	// Problem is why the snapshot failed to load; Corrupt is set when
+	// its checksum or magic bytes are wrong, as opposed to e.g. a
+	// decryption failure.
+	Problem string `json:"problem,omitempty"`
+	Corrupt bool   `json:"corrupt,omitempty"`
+}
+
+// Report is the result of inspecting a data directory.
+type Report struct {
+	WALDir      string               `json:"wal_dir"`
+	SnapshotDir string               `json:"snapshot_dir"`
+	Segments    []*wal.SegmentReport `json:"segments"`
+	Snapshots   []*SnapshotReport    `json:"snapshots"`
+
+	// Problems lists what keeps recovery from rebuilding every session;
+	// empty when the data directory is healthy.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// OK reports whether no problems were found.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// RecoveryPoint returns the snapshot recovery would load: the latest one
+// that loads. It returns nil if there is none.
+func (r *Report) RecoveryPoint() *SnapshotReport {
+	for i := len(r.Snapshots) - 1; i >= 0; i-- {
+		if r.Snapshots[i].Problem == "" {
+			return r.Snapshots[i]
+		}
+	}
+	return nil
+}
+
+// Inspect lists the WAL segments and snapshots of a data directory,
+// reading every entry and snapshot, and verifies the recovery chain.
+func Inspect(opts Options) (*Report, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{WALDir: opts.walDir(), SnapshotDir: opts.snapshotDir()}
+	segments, err := wal.ScanSegments(report.WALDir, opts.Cipher, nil)
+	if err != nil {
+		return nil, fmt.Errorf("inspect: scan wal: %w", err)
+	}
+	report.Segments = segments
+
+	mgr, err := opts.snapshots()
+	if err != nil {
+		return nil, fmt.Errorf("inspect: %w", err)
+	}
+	if mgr != nil {
+		infos, err := mgr.List()
+		if err != nil {
+			return nil, fmt.Errorf("inspect: list snapshots: %w", err)
+		}
+		for _, listed := range infos {
+			sr := &SnapshotReport{Info: *listed}
+			if _, info, err := mgr.LoadFile(listed.Path); err != nil {
+				sr.Problem = err.Error()
+				sr.Corrupt = errors.Is(err, snapshot.ErrChecksumMismatch) || errors.Is(err, snapshot.ErrInvalidMagic)
+			} else {
+				sr.Info = *info
+			}
+			report.Snapshots = append(report.Snapshots, sr)
+		}
+	}
+
+	report.verify()
+	return report, nil
+}
+
+// verify fills in Problems.
+func (r *Report) verify() {
+	for _, s := range r.Snapshots {
+		if s.Problem != "" {
+			r.problemf("snapshot %s: %s", s.ID, s.Problem)
+		}
+	}
+
+	for i, seg := range r.Segments {
+		newest := i == len(r.Segments)-1
+		if i > 0 && seg.ID != r.Segments[i-1].ID+1 {
+			r.problemf("WAL segments %d to %d are missing", r.Segments[i-1].ID+1, seg.ID-1)
+		}
+		switch {
+		case seg.TornTail() && newest:
+			r.problemf("WAL segment %d has a torn tail: %s (%d bytes)", seg.ID, seg.Problem, seg.Size-seg.ValidSize)
+		case seg.Problem != "":
+			r.problemf("WAL segment %d: %s", seg.ID, seg.Problem)
+		case !seg.Sealed && !newest:
+			r.problemf("WAL segment %d is not sealed although newer segments exist", seg.ID)
+		}
+	}
+
+	rp := r.RecoveryPoint()
+	if len(r.Segments) == 0 {
+		return
+	}
+	first, last := r.Segments[0], r.Segments[len(r.Segments)-1]
+	if rp == nil {
+		if first.ID != 1 {
+			r.problemf("no snapshot loads and the WAL starts at segment %d: earlier entries are lost", first.ID)
+		}
+		return
+	}
+	if needed := rp.WALLastOffset >> 32; first.ID > needed {
+		r.problemf("snapshot %s continues at WAL offset %s but the WAL starts at segment %d",
+			rp.ID, FormatOffset(rp.WALLastOffset), first.ID)
+	}
+	if rp.WALLastOffset > last.EndOffset() {
+		r.problemf("snapshot %s continues at WAL offset %s beyond the end of the WAL at %s",
+			rp.ID, FormatOffset(rp.WALLastOffset), FormatOffset(last.EndOffset()))
+	}
+}
+
+func (r *Report) problemf(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// FormatOffset formats a composite WAL offset as "segment:offset".
+func FormatOffset(offset uint64) string {
+	return fmt.Sprintf("%d:%d", offset>>32, uint32(offset))
+}
+
+// ParseOffset parses an offset formatted by FormatOffset. A plain segment
+// ID stands for the start of that segment.
+func ParseOffset(s string) (uint64, error) {
+	segStr, posStr, hasPos := strings.Cut(s, ":")
+	seg, err := strconv.ParseUint(segStr, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("inspect: invalid offset %q", s)
+	}
+	var pos uint64
+	if hasPos {
+		if pos, err = strconv.ParseUint(posStr, 10, 32); err != nil {
+			return 0, fmt.Errorf("inspect: invalid offset %q", s)
+		}
+	}
+	return seg<<32 | pos, nil
+}
@@ -0,0 +1,256 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// newDataDir writes a data directory with two snapshots and WAL entries
+// after them, returning the directory.
+func newDataDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := storage.DefaultConfig(dir)
+	cfg.WAL.SyncMode = wal.SyncModeSync
+	engine, err := storage.New(cfg)
+	if err != nil {
+		t.Fatalf("storage.New: %v", err)
+	}
+
+	ctx := context.Background()
+	create := func(user string) {
+		s, _ := domain.NewSession(user)
+		s.TokenHash = "tmth_" + user
+		s.IPAddress = "203.0.113.7"
+		s.UserAgent = "curl/8.0"
+		s.Data = map[string]string{"email": user + "@example.com"}
+		s.SetExpiration(time.Hour)
+		if errs := engine.CreateBatch(ctx, []*domain.Session{s}); errs[0] != nil {
+			t.Fatalf("CreateBatch: %v", errs[0])
+		}
+	}
+
+	create("alice")
+	if _, err := engine.TriggerSnapshot(ctx); err != nil {
+		t.Fatalf("TriggerSnapshot: %v", err)
+	}
+	create("bob")
+	if _, err := engine.TriggerSnapshot(ctx); err != nil {
+		t.Fatalf("TriggerSnapshot: %v", err)
+	}
+	create("carol")
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return dir
+}
+
+func TestInspect_Healthy(t *testing.T) {
+	dir := newDataDir(t)
+
+	report, err := Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("problems: %v", report.Problems)
+	}
+	if len(report.Snapshots) != 2 {
+		t.Fatalf("snapshots = %d, want 2", len(report.Snapshots))
+	}
+	entries := 0
+	for _, seg := range report.Segments {
+		entries += seg.Entries
+	}
+	if entries != 3 {
+		t.Errorf("WAL entries = %d, want 3", entries)
+	}
+
+	rp := report.RecoveryPoint()
+	if rp == nil || rp.Path != report.Snapshots[1].Path || rp.SessionCount != 2 || rp.Checksum == "" {
+		t.Errorf("recovery point = %+v", rp)
+	}
+	if len(report.Repairs()) != 0 {
+		t.Errorf("repairs for a healthy directory: %v", report.Repairs())
+	}
+}
+
+func TestInspect_MissingDataDir(t *testing.T) {
+	if _, err := Inspect(Options{DataDir: t.TempDir() + "/nope"}); err == nil {
+		t.Error("Inspect of a missing directory should fail")
+	}
+}
+
+func TestDump(t *testing.T) {
+	dir := newDataDir(t)
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, Options{DataDir: dir}, DumpOptions{MaskPII: true}); err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+
+	var records []entryRecord
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var rec entryRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("records = %d, want 3", len(records))
+	}
+
+	s := records[1].Session
+	if records[1].Op != "create" || s == nil {
+		t.Fatalf("record = %+v", records[1])
+	}
+	if s.TokenHash != "tmth_bob" {
+		t.Errorf("token hash = %q, want it kept", s.TokenHash)
+	}
+	for _, v := range []string{s.UserID, s.IPAddress, s.UserAgent, s.Data["email"]} {
+		if !strings.HasPrefix(v, "masked:") {
+			t.Errorf("value %q is not masked", v)
+		}
+	}
+	if records[0].Session.IPAddress != s.IPAddress {
+		t.Error("equal values should mask to the same pseudonym")
+	}
+
+	// From skips earlier entries
+	from, err := ParseOffset(records[2].Offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := Dump(&buf, Options{DataDir: dir}, DumpOptions{From: from}); err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 || !strings.Contains(buf.String(), `"user_id":"carol"`) {
+		t.Errorf("dump from %s:\n%s", records[2].Offset, buf.String())
+	}
+}
+
+func TestDumpSnapshot(t *testing.T) {
+	dir := newDataDir(t)
+	report, err := Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := DumpSnapshot(&buf, Options{DataDir: dir}, report.Snapshots[1].Path, DumpOptions{}); err != nil {
+		t.Fatalf("DumpSnapshot: %v", err)
+	}
+	out := buf.String()
+	if strings.Count(out, "\n") != 2 || !strings.Contains(out, `"user_id":"alice"`) || !strings.Contains(out, `"user_id":"bob"`) {
+		t.Errorf("snapshot dump:\n%s", out)
+	}
+}
+
+func TestInspect_RepairTornTailAndCorruptSnapshot(t *testing.T) {
+	dir := newDataDir(t)
+	report, err := Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	// Unseal the newest segment and tear its tail, and corrupt the
+	// latest snapshot.
+	seg := report.Segments[len(report.Segments)-1]
+	if err := os.Truncate(seg.Path, seg.Size-wal.ChecksumSize); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	f, err := os.OpenFile(seg.Path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	f.Write([]byte{0, 0, 0, 40, 1, 2, 3})
+	f.Close()
+	latest := report.Snapshots[1].Path
+	if err := os.WriteFile(latest, []byte("TOKMSNAP"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	report, err = Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if len(report.Problems) != 2 {
+		t.Fatalf("problems = %v, want a torn tail and a corrupt snapshot", report.Problems)
+	}
+	if rp := report.RecoveryPoint(); rp == nil || rp.Path != report.Snapshots[0].Path {
+		t.Errorf("recovery point = %+v, want the older snapshot", rp)
+	}
+
+	repairs := report.Repairs()
+	if len(repairs) != 2 || repairs[0].Action != ActionTruncate || repairs[1].Action != ActionQuarantine {
+		t.Fatalf("repairs = %v", repairs)
+	}
+	for _, rp := range repairs {
+		if err := rp.Apply(); err != nil {
+			t.Fatalf("Apply(%s): %v", rp, err)
+		}
+	}
+
+	report, err = Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if !report.OK() || len(report.Snapshots) != 1 {
+		t.Errorf("after repair: problems %v, %d snapshots", report.Problems, len(report.Snapshots))
+	}
+	if _, err := os.Stat(latest + snapshot.QuarantineSuffix); err != nil {
+		t.Errorf("quarantined snapshot: %v", err)
+	}
+
+	// The repaired directory recovers every session.
+	engine, err := storage.New(storage.DefaultConfig(dir))
+	if err != nil {
+		t.Fatalf("storage.New: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.Recover(context.Background()); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if n := engine.Count(context.Background()); n != 3 {
+		t.Errorf("recovered %d sessions, want 3", n)
+	}
+}
+
+func TestInspect_MissingSegments(t *testing.T) {
+	dir := newDataDir(t)
+	report, err := Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	// Without snapshots the WAL must start at segment 1.
+	for _, s := range report.Snapshots {
+		os.Remove(s.Path)
+	}
+	seg := report.Segments[0]
+	if err := os.Rename(seg.Path, filepath.Join(filepath.Dir(seg.Path), "wal-00000002.log")); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	report, err = Inspect(Options{DataDir: dir})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if report.OK() || !strings.Contains(strings.Join(report.Problems, "\n"), "earlier entries are lost") {
+		t.Errorf("problems = %v", report.Problems)
+	}
+}
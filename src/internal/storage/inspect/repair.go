@@ -0,0 +1,87 @@
+// Package inspect examines a TokMesh data directory offline.
+package inspect
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// Repair actions.
+const (
+	// ActionTruncate drops the torn tail of the newest WAL segment.
+	ActionTruncate = "truncate"
+	// ActionQuarantine renames a corrupt snapshot so it is no longer
+	// loaded.
+	ActionQuarantine = "quarantine"
+)
+
+// Repair is a change that fixes a problem found by Inspect.
+type Repair struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+
+	// Size is the size to truncate to.
+	Size int64 `json:"size,omitempty"`
+
+	// Reason describes the problem, and what the repair discards.
+	Reason string `json:"reason"`
+}
+
+// Repairs returns the repairs for the report's problems that can be fixed
+// safely: a torn tail of the newest WAL segment, and snapshots with a
+// wrong checksum or magic bytes. Other problems need an operator.
+func (r *Report) Repairs() []Repair {
+	var repairs []Repair
+	if n := len(r.Segments); n > 0 {
+		if seg := r.Segments[n-1]; seg.TornTail() {
+			repairs = append(repairs, Repair{
+				Action: ActionTruncate,
+				Path:   seg.Path,
+				Size:   seg.ValidSize,
+				Reason: fmt.Sprintf("drop %d bytes after the last intact entry (%s)", seg.Size-seg.ValidSize, seg.Problem),
+			})
+		}
+	}
+	for _, s := range r.Snapshots {
+		if s.Corrupt {
+			repairs = append(repairs, Repair{
+				Action: ActionQuarantine,
+				Path:   s.Path,
+				Reason: s.Problem,
+			})
+		}
+	}
+	return repairs
+}
+
+// Apply performs the repair. The server must not be running.
+func (rp Repair) Apply() error {
+	switch rp.Action {
+	case ActionTruncate:
+		return wal.TruncateSegment(rp.Path, rp.Size)
+	case ActionQuarantine:
+		mgr, err := snapshot.NewManager(snapshot.Config{Dir: filepath.Dir(rp.Path)})
+		if err != nil {
+			return err
+		}
+		_, err = mgr.Quarantine(rp.Path)
+		return err
+	default:
+		return fmt.Errorf("inspect: unknown repair action %q", rp.Action)
+	}
+}
+
+// String describes the repair in one line.
+func (rp Repair) String() string {
+	switch rp.Action {
+	case ActionTruncate:
+		return fmt.Sprintf("truncate %s to %d bytes: %s", rp.Path, rp.Size, rp.Reason)
+	case ActionQuarantine:
+		return fmt.Sprintf("quarantine %s as %s: %s", rp.Path, filepath.Base(rp.Path)+snapshot.QuarantineSuffix, rp.Reason)
+	default:
+		return rp.Action + " " + rp.Path
+	}
+}
@@ -0,0 +1,948 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage/codec"
+	"github.com/yndnr/tokmesh-go/internal/storage/memory"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+// Keys of the Badger backend.
+var (
+	kvSessionPrefix = []byte("s/")
+	kvTokenPrefix   = []byte("t/")
+	kvUserPrefix    = []byte("u/")
+	kvMigratedKey   = []byte("m/migrated")
+	kvDeletedPrefix = []byte("m/deleted/")
+)
+
+// kvExpiryGrace is how long the keys of a session outlive it. It exceeds
+// the longest GC interval, so expired sessions are deleted by
+// DeleteExpired, and their expiration published, before Badger drops them.
+const kvExpiryGrace = 5 * time.Minute
+
+func kvSessionKey(id string) []byte {
+	return append(append([]byte{}, kvSessionPrefix...), id...)
+}
+
+func kvDeletedKey(id string) []byte {
+	return append(append([]byte{}, kvDeletedPrefix...), id...)
+}
+
+func kvTokenKey(tokenHash string) []byte {
+	return append(append([]byte{}, kvTokenPrefix...), tokenHash...)
+}
+
+// kvUserKeyPrefix returns the prefix of the user index keys of userID.
+// User IDs are terminated by a zero byte, so no user's prefix is the
+// prefix of another's.
+func kvUserKeyPrefix(userID string) []byte {
+	b := append(append([]byte{}, kvUserPrefix...), userID...)
+	return append(b, 0)
+}
+
+func kvUserKey(userID, id string) []byte {
+	return append(kvUserKeyPrefix(userID), id...)
+}
+
+// kvStore keeps the sessions of the engine in Badger (the Badger
+// backend), with the memory store as a cache in front of it.
+//
+// Keys:
+//
+//	s/<session ID>             session record, encrypted if a cipher is set
+//	t/<token hash>             session ID
+//	u/<user ID>\x00<session ID> empty; lists the sessions of a user
+//	m/migrated                 set once the data of the WAL backend, if
+//	                           any, has been migrated
+//	m/deleted/<session ID>     empty; a session deleted while migrating
+//
+// Expired sessions stay readable until DeleteExpired removes them, like
+// with the WAL backend; their keys expire kvExpiryGrace after the session
+// (Badger TTL) in case it does not.
+//
+// Writes are serialized. Each one is applied to the cache first, which
+// validates it, then committed to Badger, and undone in the cache if the
+// commit fails. It is acknowledged once committed.
+//
+// With a bounded cache, a session missing from the cache is read from
+// Badger, and the checks that span sessions (ID and token conflicts,
+// quota) are made against Badger.
+//
+// While the data of the WAL backend is migrated, the cache holds every
+// session, as if unbounded, and each delete leaves an m/deleted/ key so
+// that a migration started over does not bring the session back.
+type kvStore struct {
+	kv     *BadgerEngine
+	cache  *memory.Store
+	cipher adaptive.Cipher
+	size   int // max cached sessions, 0 for all
+	quota  int
+	logger *slog.Logger
+
+	// mu serializes writes and cache fills.
+	mu sync.Mutex
+
+	// migrating is set while the data of the WAL backend is copied into
+	// Badger. It changes under mu.
+	migrating atomic.Bool
+}
+
+// newKVStore opens the Badger backend of an engine configured by cfg.
+func newKVStore(cfg Config, cache *memory.Store) (*kvStore, error) {
+	kvCfg := cfg.Badger
+	if kvCfg.Dir == "" {
+		kvCfg = DefaultKVConfig(cfg.DataDir + "/" + DefaultBadgerDir)
+	}
+	kv, err := NewBadgerEngine(kvCfg, cfg.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	quota := cfg.MaxSessionsPerUser
+	if quota <= 0 {
+		quota = memory.DefaultMaxSessionsPerUser
+	}
+	return &kvStore{
+		kv:     kv,
+		cache:  cache,
+		cipher: cfg.Cipher,
+		size:   cfg.CacheSize,
+		quota:  quota,
+		logger: cfg.Logger,
+	}, nil
+}
+
+// bounded reports whether the cache holds at most some of the sessions.
+func (s *kvStore) bounded() bool {
+	return s.size > 0 && !s.migrating.Load()
+}
+
+func (s *kvStore) encode(session *domain.Session) ([]byte, error) {
+	value := codec.EncodeSession(session)
+	if s.cipher == nil {
+		return value, nil
+	}
+	encrypted, err := s.cipher.Encrypt(value, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt session: %w", err)
+	}
+	return encrypted, nil
+}
+
+func (s *kvStore) decode(value []byte) (*domain.Session, error) {
+	if s.cipher != nil {
+		decrypted, err := s.cipher.Decrypt(value, nil)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt session: %w", err)
+		}
+		value = decrypted
+	}
+	session, _, err := codec.DecodeSession(value)
+	return session, err
+}
+
+// kvEntries returns the Badger entries of session, whose record is value.
+func kvEntries(session *domain.Session, value []byte) []*badger.Entry {
+	entries := []*badger.Entry{
+		badger.NewEntry(kvSessionKey(session.ID), value),
+		badger.NewEntry(kvUserKey(session.UserID, session.ID), nil),
+	}
+	if session.TokenHash != "" {
+		entries = append(entries, badger.NewEntry(kvTokenKey(session.TokenHash), []byte(session.ID)))
+	}
+	if session.ExpiresAt > 0 {
+		// Expired sessions are removed by DeleteExpired; the TTL only
+		// reclaims the keys it missed.
+		ttl := time.Until(time.UnixMilli(session.ExpiresAt)) + kvExpiryGrace
+		for i, e := range entries {
+			entries[i] = e.WithTTL(ttl)
+		}
+	}
+	return entries
+}
+
+// read reads a session from Badger.
+func (s *kvStore) read(ctx context.Context, id string) (*domain.Session, error) {
+	value, err := s.kv.Get(ctx, kvSessionKey(id))
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, domain.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return s.decode(value)
+}
+
+// commit writes the change of a session from prev to next to Badger;
+// prev is nil for a new session and next nil for a deleted one.
+func (s *kvStore) commit(prev, next *domain.Session) error {
+	var value []byte
+	if next != nil {
+		var err error
+		if value, err = s.encode(next); err != nil {
+			return err
+		}
+	}
+
+	err := s.kv.db.Update(func(txn *badger.Txn) error {
+		if prev != nil {
+			if prev.TokenHash != "" && (next == nil || next.TokenHash != prev.TokenHash) {
+				if err := txn.Delete(kvTokenKey(prev.TokenHash)); err != nil {
+					return err
+				}
+			}
+			if next == nil || next.UserID != prev.UserID {
+				if err := txn.Delete(kvUserKey(prev.UserID, prev.ID)); err != nil {
+					return err
+				}
+			}
+		}
+		if s.migrating.Load() {
+			var err error
+			if next == nil {
+				err = txn.Set(kvDeletedKey(prev.ID), nil)
+			} else if prev == nil {
+				err = txn.Delete(kvDeletedKey(next.ID))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			return txn.Delete(kvSessionKey(prev.ID))
+		}
+		for _, e := range kvEntries(next, value) {
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("write badger: %w", err)
+	}
+	return nil
+}
+
+// sync makes the writes committed so far durable, unless the durability
+// of ctx is none or buffered.
+func (s *kvStore) sync(ctx context.Context) error {
+	switch service.DurabilityFromContext(ctx) {
+	case domain.DurabilityNone, domain.DurabilityBuffered:
+		return nil
+	}
+	if err := s.kv.db.Sync(); err != nil {
+		return fmt.Errorf("sync badger: %w", err)
+	}
+	return nil
+}
+
+// write runs the write fn, then syncs it as required by ctx.
+func (s *kvStore) write(ctx context.Context, fn func() error) error {
+	s.mu.Lock()
+	err := fn()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.sync(ctx)
+}
+
+// writeBatch runs fn for each of the n writes of a batch, then syncs them
+// once. The returned slice holds one error (or nil) per write, in order.
+func (s *kvStore) writeBatch(ctx context.Context, n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	if n == 0 {
+		return errs
+	}
+
+	s.mu.Lock()
+	for i := range errs {
+		errs[i] = fn(i)
+	}
+	s.mu.Unlock()
+
+	if err := s.sync(ctx); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+// cached returns the session with the given ID, expired or not, reading
+// it into the cache from Badger on a miss when the cache is bounded.
+// Caller must hold mu.
+func (s *kvStore) cached(ctx context.Context, id string) (*domain.Session, error) {
+	if session, ok := s.cache.Lookup(id); ok {
+		return session, nil
+	}
+	if !s.bounded() {
+		return nil, domain.ErrSessionNotFound
+	}
+
+	session, err := s.read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.Restore([]*domain.Session{session.Clone()})[0]; err != nil {
+		s.logger.Warn("cache session failed", "session_id", id, "error", err)
+	}
+	s.evict(id)
+	return session, nil
+}
+
+// evict removes sessions other than keep from the cache while it holds
+// more than its size. Caller must hold mu.
+func (s *kvStore) evict(keep string) {
+	for s.bounded() && s.cache.Count() > s.size {
+		var victim string
+		s.cache.Scan(func(session *domain.Session) bool {
+			if session.ID == keep {
+				return true
+			}
+			victim = session.ID
+			return false
+		})
+		if victim == "" {
+			return
+		}
+		_ = s.cache.Delete(context.Background(), victim)
+	}
+}
+
+// restore puts prev back in the cache as the session id, or removes the
+// session if prev is nil. Caller must hold mu.
+func (s *kvStore) restore(id string, prev *domain.Session) {
+	_ = s.cache.Delete(context.Background(), id)
+	if prev != nil {
+		s.cache.Restore([]*domain.Session{prev})
+	}
+}
+
+// createLocked creates a session. Caller must hold mu.
+func (s *kvStore) createLocked(ctx context.Context, session *domain.Session) error {
+	if s.bounded() {
+		if err := s.checkCreate(ctx, session); err != nil {
+			return err
+		}
+	}
+	if err := s.cache.Create(ctx, session); err != nil {
+		return err
+	}
+	if err := s.commit(nil, session); err != nil {
+		s.restore(session.ID, nil)
+		return err
+	}
+	s.evict(session.ID)
+	return nil
+}
+
+// checkCreate makes the checks of memory.Store.Create that span sessions
+// against Badger. Caller must hold mu.
+func (s *kvStore) checkCreate(ctx context.Context, session *domain.Session) error {
+	count, err := s.countByUser(ctx, session.UserID)
+	if err != nil {
+		return err
+	}
+	if count >= s.quota {
+		return domain.ErrSessionQuotaExceeded
+	}
+
+	if _, err := s.read(ctx, session.ID); err == nil {
+		return domain.ErrSessionConflict
+	} else if !errors.Is(err, domain.ErrSessionNotFound) {
+		return err
+	}
+
+	return s.checkToken(ctx, session.TokenHash)
+}
+
+// checkToken returns ErrTokenHashConflict if a session in Badger has the
+// token hash.
+func (s *kvStore) checkToken(ctx context.Context, tokenHash string) error {
+	if tokenHash == "" {
+		return nil
+	}
+	if _, err := s.kv.Get(ctx, kvTokenKey(tokenHash)); err == nil {
+		return domain.ErrTokenHashConflict
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+// mutate applies op to the session id in the cache and commits the result
+// to Badger, undoing op in the cache if the commit fails. op receives the
+// session before the change, nil if there is none. Caller must hold mu.
+func (s *kvStore) mutate(ctx context.Context, id string, op func(prev *domain.Session) error) error {
+	prev, err := s.cached(ctx, id)
+	if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+		return err
+	}
+	if err := op(prev); err != nil {
+		return err
+	}
+
+	next, _ := s.cache.Lookup(id)
+	if err := s.commit(prev, next); err != nil {
+		s.restore(id, prev)
+		return err
+	}
+	return nil
+}
+
+// updateLocked updates a session, checking its version if versioned.
+// Caller must hold mu.
+func (s *kvStore) updateLocked(ctx context.Context, session *domain.Session, expectedVersion uint64, versioned bool) error {
+	return s.mutate(ctx, session.ID, func(prev *domain.Session) error {
+		if s.bounded() && prev != nil && prev.TokenHash != session.TokenHash {
+			if err := s.checkToken(ctx, session.TokenHash); err != nil {
+				return err
+			}
+		}
+		if versioned {
+			return s.cache.Update(ctx, session, expectedVersion)
+		}
+		return s.cache.UpdateSession(ctx, session)
+	})
+}
+
+// deleteLocked deletes a session. Caller must hold mu.
+func (s *kvStore) deleteLocked(ctx context.Context, id string) error {
+	return s.mutate(ctx, id, func(*domain.Session) error {
+		return s.cache.Delete(ctx, id)
+	})
+}
+
+// touchLocked applies a touch to a session, committing it to Badger only
+// if logged. Caller must hold mu.
+func (s *kvStore) touchLocked(ctx context.Context, id string, lastActive int64, ip, userAgent string, logged bool) (*domain.Session, error) {
+	var session *domain.Session
+	apply := func(*domain.Session) error {
+		var err error
+		session, err = s.cache.ApplyTouch(ctx, id, lastActive, ip, userAgent)
+		return err
+	}
+
+	var err error
+	if logged {
+		err = s.mutate(ctx, id, apply)
+	} else if _, err = s.cached(ctx, id); err == nil {
+		err = apply(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// setExpiryLocked sets the expiration of a session. Caller must hold mu.
+func (s *kvStore) setExpiryLocked(ctx context.Context, id string, expiresAt, ttl, lastActive int64) (*domain.Session, error) {
+	var session *domain.Session
+	err := s.mutate(ctx, id, func(*domain.Session) error {
+		var err error
+		session, err = s.cache.SetExpiry(ctx, id, expiresAt, ttl, lastActive)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// get retrieves a session by ID.
+func (s *kvStore) get(ctx context.Context, id string) (*domain.Session, error) {
+	session, err := s.cache.Get(ctx, id)
+	if !s.bounded() || !errors.Is(err, domain.ErrSessionNotFound) {
+		return session, err
+	}
+
+	s.mu.Lock()
+	session, err = s.cached(ctx, id)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if session.IsExpired() {
+		return nil, domain.ErrSessionExpired
+	}
+	return session, nil
+}
+
+// getByToken retrieves a session by token hash.
+func (s *kvStore) getByToken(ctx context.Context, tokenHash string) (*domain.Session, error) {
+	session, err := s.cache.GetByToken(ctx, tokenHash)
+	if !s.bounded() || !errors.Is(err, domain.ErrTokenInvalid) {
+		return session, err
+	}
+
+	id, err := s.kv.Get(ctx, kvTokenKey(tokenHash))
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, domain.ErrTokenInvalid
+		}
+		return nil, err
+	}
+	session, err = s.get(ctx, string(id))
+	if errors.Is(err, domain.ErrSessionNotFound) || (err == nil && session.TokenHash != tokenHash) {
+		return nil, domain.ErrTokenInvalid
+	}
+	return session, err
+}
+
+// userSessionIDs returns the IDs of the sessions of a user, from the
+// cache unless bounded, else from Badger.
+func (s *kvStore) userSessionIDs(ctx context.Context, userID string) ([]string, error) {
+	if !s.bounded() {
+		return s.cache.UserSessionIDs(userID), nil
+	}
+	prefix := kvUserKeyPrefix(userID)
+	var ids []string
+	err := s.kv.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			ids = append(ids, string(it.Item().Key()[len(prefix):]))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// userSessions returns the sessions of a user, expired or not.
+func (s *kvStore) userSessions(ctx context.Context, userID string) ([]*domain.Session, error) {
+	ids, err := s.userSessionIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*domain.Session, 0, len(ids))
+	for _, id := range ids {
+		session, ok := s.cache.Lookup(id)
+		if !ok {
+			if session, err = s.read(ctx, id); err != nil {
+				if errors.Is(err, domain.ErrSessionNotFound) {
+					continue // Deleted meanwhile
+				}
+				return nil, err
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// deleteExpired deletes the expired sessions and returns them.
+func (s *kvStore) deleteExpired(ctx context.Context) ([]*domain.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*domain.Session
+	s.scan(func(session *domain.Session) bool {
+		if session.IsExpired() {
+			expired = append(expired, session)
+		}
+		return true
+	})
+
+	deleted := expired[:0]
+	for _, session := range expired {
+		if err := s.deleteLocked(ctx, session.ID); err != nil {
+			if errors.Is(err, domain.ErrSessionNotFound) {
+				continue
+			}
+			return deleted, err
+		}
+		deleted = append(deleted, session)
+	}
+	return deleted, nil
+}
+
+// countByUser counts the sessions of a user.
+func (s *kvStore) countByUser(ctx context.Context, userID string) (int, error) {
+	if !s.bounded() {
+		return s.cache.CountByUserID(ctx, userID)
+	}
+	ids, err := s.userSessionIDs(ctx, userID)
+	return len(ids), err
+}
+
+// listByUser lists the unexpired sessions of a user.
+func (s *kvStore) listByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	if !s.bounded() {
+		return s.cache.ListByUserID(ctx, userID)
+	}
+	sessions, err := s.userSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	unexpired := sessions[:0]
+	for _, session := range sessions {
+		if !session.IsExpired() {
+			unexpired = append(unexpired, session)
+		}
+	}
+	if len(unexpired) == 0 {
+		return nil, nil
+	}
+	return unexpired, nil
+}
+
+// deleteByUser deletes the sessions of a user.
+func (s *kvStore) deleteByUser(ctx context.Context, userID string) (int, error) {
+	ids, err := s.userSessionIDs(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	errs := s.writeBatch(ctx, len(ids), func(i int) error {
+		return s.deleteLocked(ctx, ids[i])
+	})
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			deleted++
+		case !errors.Is(err, domain.ErrSessionNotFound):
+			s.logger.Error("delete user session failed",
+				"session_id", ids[i],
+				"error", err)
+		}
+	}
+	return deleted, nil
+}
+
+// list lists sessions matching the filter. With a bounded cache, the
+// sessions of the filter's user, or else all sessions in Badger, are
+// listed, the cached copy of each taking precedence as it may hold
+// touches not committed yet.
+func (s *kvStore) list(ctx context.Context, filter *service.SessionFilter) ([]*domain.Session, int, error) {
+	if !s.bounded() {
+		return s.cache.List(ctx, filter)
+	}
+	if filter == nil || filter.UserID == "" {
+		return memory.ListScan(ctx, filter, func(fn func(*domain.Session) bool) {
+			s.scanKV(func(session *domain.Session) bool {
+				if cached, ok := s.cache.Lookup(session.ID); ok {
+					session = cached
+				}
+				return fn(session)
+			})
+		})
+	}
+
+	sessions, err := s.userSessions(ctx, filter.UserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	user := memory.New(memory.WithMaxSessionsPerUser(math.MaxInt))
+	user.Restore(sessions)
+	return user.List(ctx, filter)
+}
+
+// count returns the number of sessions.
+func (s *kvStore) count() int {
+	if !s.bounded() {
+		return s.cache.Count()
+	}
+	count := 0
+	_ = s.kv.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = kvSessionPrefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// scan iterates over all sessions.
+func (s *kvStore) scan(fn func(*domain.Session) bool) {
+	if !s.bounded() {
+		s.cache.Scan(fn)
+		return
+	}
+	s.scanKV(fn)
+}
+
+// scanKV iterates over the sessions in Badger, as of the start of the
+// scan. Records that fail to decode are logged and skipped.
+func (s *kvStore) scanKV(fn func(*domain.Session) bool) {
+	err := s.kv.Scan(context.Background(), kvSessionPrefix, func(key, value []byte) bool {
+		session, err := s.decode(value)
+		if err != nil {
+			s.logger.Warn("decode badger session failed",
+				"key", string(key),
+				"error", err)
+			return true
+		}
+		return fn(session)
+	})
+	if err != nil {
+		s.logger.Error("scan badger sessions failed", "error", err)
+	}
+}
+
+// load fills the cache with the sessions in Badger, up to its size, and
+// returns the number loaded.
+func (s *kvStore) load() int {
+	const batchSize = 1024
+
+	loaded := 0
+	batch := make([]*domain.Session, 0, batchSize)
+	flush := func() {
+		for i, err := range s.cache.Restore(batch) {
+			if err != nil {
+				s.logger.Warn("failed to restore session from badger",
+					"session_id", batch[i].ID,
+					"error", err)
+				continue
+			}
+			loaded++
+		}
+		batch = batch[:0]
+	}
+
+	s.scanKV(func(session *domain.Session) bool {
+		if session.IsExpired() {
+			return true
+		}
+		batch = append(batch, session)
+		if len(batch) == batchSize {
+			flush()
+		}
+		return !s.bounded() || loaded+len(batch) < s.size
+	})
+	flush()
+	return loaded
+}
+
+// migrateBatchSize is the number of sessions copied into Badger at a
+// time by a migration.
+const migrateBatchSize = 1024
+
+// overlay brings the cache, filled from the WAL backend, up to date with
+// a migration that was stopped before it finished: the sessions written
+// to Badger since it started replace the cached ones, and the sessions
+// deleted meanwhile are removed.
+func (s *kvStore) overlay(ctx context.Context) error {
+	s.scanKV(func(session *domain.Session) bool {
+		_ = s.cache.Delete(ctx, session.ID)
+		if err := s.cache.Restore([]*domain.Session{session})[0]; err != nil {
+			s.logger.Warn("failed to restore session from badger",
+				"session_id", session.ID,
+				"error", err)
+		}
+		return true
+	})
+	return s.kv.Scan(ctx, kvDeletedPrefix, func(key, _ []byte) bool {
+		_ = s.cache.Delete(ctx, string(key[len(kvDeletedPrefix):]))
+		return true
+	})
+}
+
+// migrate copies the unexpired sessions of the cache into Badger, in
+// batches written under mu, until all are copied or stop is closed.
+// Writes go on meanwhile, so each session is copied as it is when its
+// batch is written. It returns the number of sessions copied, and
+// whether all were.
+func (s *kvStore) migrate(stop <-chan struct{}) (int, bool, error) {
+	var ids []string
+	s.cache.Scan(func(session *domain.Session) bool {
+		ids = append(ids, session.ID)
+		return true
+	})
+
+	copied := 0
+	for start := 0; start < len(ids); start += migrateBatchSize {
+		select {
+		case <-stop:
+			return copied, false, nil
+		default:
+		}
+		n, err := s.copyBatch(ids[start:min(start+migrateBatchSize, len(ids))])
+		copied += n
+		if err != nil {
+			return copied, false, err
+		}
+	}
+	return copied, true, s.kv.db.Sync()
+}
+
+// copyBatch writes the sessions ids of the cache to Badger, but those
+// deleted or expired since, and returns the number written.
+func (s *kvStore) copyBatch(ids []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wb := s.kv.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	copied := 0
+	for _, id := range ids {
+		session, ok := s.cache.Lookup(id)
+		if !ok || session.IsExpired() {
+			continue
+		}
+		value, err := s.encode(session)
+		if err != nil {
+			return copied, err
+		}
+		for _, e := range kvEntries(session, value) {
+			if err := wb.SetEntry(e); err != nil {
+				return copied, err
+			}
+		}
+		copied++
+	}
+	return copied, wb.Flush()
+}
+
+// finishMigration records the migration, then bounds the cache again and
+// drops the m/deleted/ keys, which only a migration started over reads.
+func (s *kvStore) finishMigration(ctx context.Context) error {
+	if err := s.setMigrated(ctx); err != nil {
+		return fmt.Errorf("write migration marker: %w", err)
+	}
+
+	s.mu.Lock()
+	s.migrating.Store(false)
+	s.evict("")
+	s.mu.Unlock()
+
+	return s.kv.db.DropPrefix(kvDeletedPrefix)
+}
+
+// migrated reports whether the data of the WAL backend, if any, has been
+// migrated.
+func (s *kvStore) migrated(ctx context.Context) (bool, error) {
+	_, err := s.kv.Get(ctx, kvMigratedKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// setMigrated records that the data of the WAL backend, if any, has been
+// migrated.
+func (s *kvStore) setMigrated(ctx context.Context) error {
+	value := []byte(time.Now().UTC().Format(time.RFC3339))
+	if err := s.kv.Set(ctx, kvMigratedKey, value); err != nil {
+		return err
+	}
+	return s.kv.db.Sync()
+}
+
+// recoverKV recovers the Badger backend. The first time, it migrates the
+// data of the WAL backend found in the data directory online: the
+// sessions recovered from its snapshot and WAL are served from the cache
+// while migrateToBadger copies them into Badger, and the WAL and snapshot
+// files are left as they are. Otherwise it fills the cache from Badger.
+func (e *Engine) recoverKV(ctx context.Context) error {
+	migrated, err := e.kv.migrated(ctx)
+	if err != nil {
+		return fmt.Errorf("read migration marker: %w", err)
+	}
+
+	if !migrated && e.hasWALData() {
+		e.logger.Info("migrating wal backend data to badger")
+		if err := e.recoverWAL(ctx); err != nil {
+			return err
+		}
+		if err := e.kv.overlay(ctx); err != nil {
+			return fmt.Errorf("migrate to badger: %w", err)
+		}
+		e.kv.migrating.Store(true)
+		e.migrateDone = make(chan struct{})
+		go e.migrateToBadger()
+		return nil
+	}
+
+	loaded := e.kv.load()
+	e.logger.Info("sessions loaded from badger", "session_count", loaded)
+	if !migrated {
+		if err := e.kv.setMigrated(ctx); err != nil {
+			return fmt.Errorf("write migration marker: %w", err)
+		}
+	}
+
+	e.kv.mu.Lock()
+	e.kv.evict("")
+	e.kv.mu.Unlock()
+	return nil
+}
+
+// migrateToBadger copies the data of the WAL backend, recovered into the
+// cache, into Badger while the engine serves requests. If stopped by
+// Close, or failing, the migration starts over with the next Recover.
+func (e *Engine) migrateToBadger() {
+	defer close(e.migrateDone)
+
+	start := time.Now()
+	copied, done, err := e.kv.migrate(e.stopCh)
+	if err == nil && done {
+		err = e.kv.finishMigration(context.Background())
+	}
+	switch {
+	case err != nil:
+		e.logger.Error("migrate to badger failed, to be retried on next start",
+			"session_count", copied,
+			"error", err)
+	case !done:
+		e.logger.Info("migration to badger stopped, to be resumed on next start",
+			"session_count", copied)
+	default:
+		e.logger.Info("wal backend data migrated to badger",
+			"session_count", copied,
+			"elapsed", time.Since(start),
+			"wal_dir", e.cfg.WAL.Dir,
+			"snapshot_dir", e.cfg.Snapshot.Dir)
+	}
+}
+
+// hasWALData reports whether the data directory holds WAL segments or
+// snapshots.
+func (e *Engine) hasWALData() bool {
+	if infos, err := e.snapshot.List(); err == nil && len(infos) > 0 {
+		return true
+	}
+	entries, err := os.ReadDir(e.cfg.WAL.Dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, wal.FilePrefix) && strings.HasSuffix(name, wal.FileExtension) {
+			return true
+		}
+	}
+	return false
+}
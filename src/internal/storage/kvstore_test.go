@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage/storagetest"
+)
+
+// newBackendEngine opens and recovers an engine of the given backend on
+// dir.
+func newBackendEngine(t *testing.T, dir, backend string, cacheSize int) *Engine {
+	t.Helper()
+
+	cfg := DefaultConfig(dir)
+	cfg.Backend = backend
+	cfg.CacheSize = cacheSize
+	cfg.MaxSessionsPerUser = storagetest.Quota
+	cfg.SnapshotInterval = time.Hour
+	cfg.Badger.Badger.GCInterval = "1h"
+
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(%s) failed: %v", backend, err)
+	}
+	if err := engine.Recover(context.Background()); err != nil {
+		engine.Close()
+		t.Fatalf("Recover(%s) failed: %v", backend, err)
+	}
+	return engine
+}
+
+func newTestSession(t *testing.T, userID, tokenHash string) *domain.Session {
+	t.Helper()
+
+	s, err := domain.NewSession(userID)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	s.TokenHash = tokenHash
+	s.SetExpiration(time.Hour)
+	return s
+}
+
+func TestEngine_BackendParity(t *testing.T) {
+	tests := []struct {
+		name      string
+		backend   string
+		cacheSize int
+	}{
+		{"wal", BackendWAL, 0},
+		{"badger", BackendBadger, 0},
+		{"badger bounded cache", BackendBadger, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storagetest.RunSessionRepositorySuite(t, func(t *testing.T, dir string) service.SessionRepository {
+				return newBackendEngine(t, dir, tt.backend, tt.cacheSize)
+			})
+		})
+	}
+}
+
+func TestEngine_BadgerRecover(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	engine := newBackendEngine(t, dir, BackendBadger, 0)
+	kept := newTestSession(t, "user1", "tmth_kv_kept")
+	deleted := newTestSession(t, "user1", "tmth_kv_deleted")
+	for _, s := range []*domain.Session{kept, deleted} {
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if err := engine.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	lastActive := time.Now().Add(time.Minute).UnixMilli()
+	if _, err := engine.TouchSession(ctx, kept.ID, lastActive, "10.0.0.1", ""); err != nil {
+		t.Fatalf("TouchSession failed: %v", err)
+	}
+	expiresAt := time.Now().Add(2 * time.Hour).UnixMilli()
+	if _, err := engine.SetSessionExpiry(ctx, kept.ID, expiresAt, 0, 0); err != nil {
+		t.Fatalf("SetSessionExpiry failed: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	engine = newBackendEngine(t, dir, BackendBadger, 0)
+	defer engine.Close()
+
+	got, err := engine.Get(ctx, kept.ID)
+	if err != nil {
+		t.Fatalf("Get after reopen failed: %v", err)
+	}
+	if got.LastActive != lastActive || got.LastAccessIP != "10.0.0.1" || got.ExpiresAt != expiresAt {
+		t.Errorf("after reopen = LastActive %d IP %q ExpiresAt %d; want %d %q %d",
+			got.LastActive, got.LastAccessIP, got.ExpiresAt, lastActive, "10.0.0.1", expiresAt)
+	}
+	if _, err := engine.Get(ctx, deleted.ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get deleted after reopen err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if _, err := engine.GetByToken(ctx, deleted.TokenHash); !errors.Is(err, domain.ErrTokenInvalid) {
+		t.Errorf("GetByToken deleted after reopen err = %v, want %v", err, domain.ErrTokenInvalid)
+	}
+}
+
+func TestEngine_BadgerMigrate(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Write with the WAL backend, part of it into a snapshot
+	engine := newBackendEngine(t, dir, BackendWAL, 0)
+	var sessions []*domain.Session
+	for i := 0; i < 4; i++ {
+		s := newTestSession(t, fmt.Sprintf("user%d", i), fmt.Sprintf("tmth_migrate_%d", i))
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		sessions = append(sessions, s)
+		if i == 1 {
+			if _, err := engine.TriggerSnapshot(ctx); err != nil {
+				t.Fatalf("TriggerSnapshot failed: %v", err)
+			}
+		}
+	}
+	if err := engine.Delete(ctx, sessions[3].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	engine.Close()
+
+	// Reopen with the Badger backend
+	engine = newBackendEngine(t, dir, BackendBadger, 0)
+	for _, s := range sessions[:3] {
+		if _, err := engine.GetByToken(ctx, s.TokenHash); err != nil {
+			t.Errorf("GetByToken(%s) after migration failed: %v", s.TokenHash, err)
+		}
+	}
+	if _, err := engine.Get(ctx, sessions[3].ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get deleted after migration err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if err := engine.Delete(ctx, sessions[0].ID); err != nil {
+		t.Fatalf("Delete after migration failed: %v", err)
+	}
+	engine.Close()
+
+	// The WAL data is migrated once: the delete made in Badger holds
+	engine = newBackendEngine(t, dir, BackendBadger, 2)
+	defer engine.Close()
+
+	if _, err := engine.Get(ctx, sessions[0].ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get deleted in badger err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if n := engine.Count(ctx); n != 2 {
+		t.Errorf("Count = %d, want 2", n)
+	}
+}
+
+func TestEngine_BadgerMigrateOnline(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// More sessions than a migration copies at a time
+	const n = 3*migrateBatchSize + 10
+	engine := newBackendEngine(t, dir, BackendWAL, 0)
+	sessions := make([]*domain.Session, n)
+	for i := range sessions {
+		sessions[i] = newTestSession(t, fmt.Sprintf("user%d", i), fmt.Sprintf("tmth_online_%d", i))
+	}
+	for i, err := range engine.CreateBatch(ctx, sessions) {
+		if err != nil {
+			t.Fatalf("CreateBatch %d failed: %v", i, err)
+		}
+	}
+	engine.Close()
+
+	// Serve and write while the migration runs
+	engine = newBackendEngine(t, dir, BackendBadger, 2)
+	if engine.migrateDone == nil {
+		t.Fatal("no migration started")
+	}
+	if n := engine.Count(ctx); n != len(sessions) {
+		t.Errorf("Count while migrating = %d, want %d", n, len(sessions))
+	}
+	if _, err := engine.GetByToken(ctx, sessions[n-1].TokenHash); err != nil {
+		t.Errorf("GetByToken while migrating failed: %v", err)
+	}
+	if err := engine.Delete(ctx, sessions[n-1].ID); err != nil {
+		t.Fatalf("Delete while migrating failed: %v", err)
+	}
+	updated := sessions[n-2].Clone()
+	updated.DeviceID = "migrated-device"
+	if err := engine.Update(ctx, updated, sessions[n-2].Version); err != nil {
+		t.Fatalf("Update while migrating failed: %v", err)
+	}
+	created := newTestSession(t, "user-new", "tmth_online_new")
+	if err := engine.Create(ctx, created); err != nil {
+		t.Fatalf("Create while migrating failed: %v", err)
+	}
+	<-engine.migrateDone
+	if cached := engine.store.Count(); cached > 2 {
+		t.Errorf("cached sessions after migration = %d, want at most 2", cached)
+	}
+	engine.Close()
+
+	engine = newBackendEngine(t, dir, BackendBadger, 2)
+	defer engine.Close()
+
+	if engine.migrateDone != nil {
+		t.Error("migration started again")
+	}
+	if n := engine.Count(ctx); n != len(sessions) {
+		t.Errorf("Count = %d, want %d", n, len(sessions))
+	}
+	if _, err := engine.Get(ctx, sessions[n-1].ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get deleted while migrating err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if got, err := engine.Get(ctx, updated.ID); err != nil || got.DeviceID != updated.DeviceID {
+		t.Errorf("Get updated while migrating = %v, %v, want DeviceID %q", got, err, updated.DeviceID)
+	}
+	for _, s := range append(sessions[:n-2:n-2], created) {
+		if _, err := engine.GetByToken(ctx, s.TokenHash); err != nil {
+			t.Errorf("GetByToken(%s) failed: %v", s.TokenHash, err)
+		}
+	}
+}
+
+func TestEngine_BadgerMigrateResume(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	engine := newBackendEngine(t, dir, BackendWAL, 0)
+	var sessions []*domain.Session
+	for i := 0; i < 3; i++ {
+		s := newTestSession(t, fmt.Sprintf("user%d", i), fmt.Sprintf("tmth_resume_%d", i))
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		sessions = append(sessions, s)
+	}
+	engine.Close()
+
+	// Write as if during a migration, then drop its marker so that the
+	// next start migrates the WAL data again
+	engine = newBackendEngine(t, dir, BackendBadger, 0)
+	<-engine.migrateDone
+	engine.kv.migrating.Store(true)
+	if err := engine.Delete(ctx, sessions[0].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	updated := sessions[1].Clone()
+	updated.DeviceID = "resumed-device"
+	if err := engine.Update(ctx, updated, sessions[1].Version); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	created := newTestSession(t, "user-new", "tmth_resume_new")
+	if err := engine.Create(ctx, created); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := engine.kv.kv.Delete(ctx, kvMigratedKey); err != nil {
+		t.Fatalf("Delete migration marker failed: %v", err)
+	}
+	engine.Close()
+
+	// The writes made in Badger take precedence over the WAL data
+	engine = newBackendEngine(t, dir, BackendBadger, 2)
+	defer engine.Close()
+	if engine.migrateDone == nil {
+		t.Fatal("no migration started")
+	}
+	<-engine.migrateDone
+
+	if _, err := engine.Get(ctx, sessions[0].ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get deleted err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if got, err := engine.Get(ctx, updated.ID); err != nil || got.DeviceID != updated.DeviceID {
+		t.Errorf("Get updated = %v, %v, want DeviceID %q", got, err, updated.DeviceID)
+	}
+	if _, err := engine.Get(ctx, created.ID); err != nil {
+		t.Errorf("Get created failed: %v", err)
+	}
+	if n := engine.Count(ctx); n != 3 {
+		t.Errorf("Count = %d, want 3", n)
+	}
+	if migrated, err := engine.kv.migrated(ctx); err != nil || !migrated {
+		t.Errorf("migrated = %v, %v, want true", migrated, err)
+	}
+	tombstones := 0
+	_ = engine.kv.kv.Scan(ctx, kvDeletedPrefix, func(_, _ []byte) bool {
+		tombstones++
+		return true
+	})
+	if tombstones != 0 {
+		t.Errorf("m/deleted/ keys = %d, want 0", tombstones)
+	}
+}
+
+func TestEngine_BadgerBoundedCache(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	engine := newBackendEngine(t, dir, BackendBadger, 2)
+	defer engine.Close()
+
+	// A full quota of sessions for user0, two for user1
+	const n = storagetest.Quota + 2
+	var sessions []*domain.Session
+	for i := 0; i < n; i++ {
+		s := newTestSession(t, fmt.Sprintf("user%d", i/storagetest.Quota), fmt.Sprintf("tmth_cache_%d", i))
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create %d failed: %v", i, err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	if cached := engine.store.Count(); cached > 2 {
+		t.Errorf("cached sessions = %d, want at most 2", cached)
+	}
+	if count := engine.Count(ctx); count != n {
+		t.Errorf("Count = %d, want %d", count, n)
+	}
+	for _, s := range sessions {
+		if _, err := engine.GetByToken(ctx, s.TokenHash); err != nil {
+			t.Errorf("GetByToken(%s) failed: %v", s.TokenHash, err)
+		}
+	}
+	if cached := engine.store.Count(); cached > 2 {
+		t.Errorf("cached sessions after reads = %d, want at most 2", cached)
+	}
+
+	// Quota and conflicts span the uncached sessions
+	if err := engine.Create(ctx, newTestSession(t, "user0", "tmth_cache_over")); !errors.Is(err, domain.ErrSessionQuotaExceeded) {
+		t.Errorf("Create over quota err = %v, want %v", err, domain.ErrSessionQuotaExceeded)
+	}
+	if err := engine.Create(ctx, newTestSession(t, "user9", sessions[0].TokenHash)); !errors.Is(err, domain.ErrTokenHashConflict) {
+		t.Errorf("Create duplicate token err = %v, want %v", err, domain.ErrTokenHashConflict)
+	}
+
+	// Writes to uncached sessions
+	for _, s := range sessions {
+		got, err := engine.Get(ctx, s.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		for _, other := range sessions {
+			if other.ID != s.ID {
+				engine.Get(ctx, other.ID)
+			}
+		}
+		if err := engine.Update(ctx, got, got.Version); err != nil {
+			t.Errorf("Update %s failed: %v", s.ID, err)
+		}
+	}
+	var seen int
+	engine.Scan(func(s *domain.Session) bool {
+		if s.Version != sessions[0].Version+1 {
+			t.Errorf("session %s version = %d, want %d", s.ID, s.Version, sessions[0].Version+1)
+		}
+		seen++
+		return true
+	})
+	if seen != n {
+		t.Errorf("Scan saw %d sessions, want %d", seen, n)
+	}
+
+	info, err := engine.TriggerSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("TriggerSnapshot failed: %v", err)
+	}
+	if info.SessionCount != n {
+		t.Errorf("snapshot SessionCount = %d, want %d", info.SessionCount, n)
+	}
+}
@@ -9,6 +9,8 @@
 //   - Secondary Indexes: Fast lookup by UserID and TokenHash
 //   - Optimistic Locking: Version-based concurrency control
 //   - Session Quotas: Configurable per-user session limits
+//   - Point-in-time Views: Consistent scans for snapshots without
+//     blocking writers (OpenView)
 //
 // Thread Safety:
 //
@@ -2,8 +2,11 @@
 package memory
 
 import (
+	"strings"
 	"sync"
 
+	"github.com/google/btree"
+
 	"github.com/yndnr/tokmesh-go/pkg/cmap"
 )
 
@@ -185,3 +188,205 @@ func (i *DeviceIndex) Count(deviceID string) int {
 	}
 	return set.Len()
 }
+
+// TermIndex provides exact-match secondary indexing on an arbitrary term.
+//
+// It maps a term (an API key ID, or an encoded Data key/value pair) to the
+// set of SessionIDs carrying it. Empty terms are not indexed.
+type TermIndex struct {
+	index *cmap.Map[string, *SessionSet]
+}
+
+// NewTermIndex creates a new term index.
+func NewTermIndex() *TermIndex {
+	return &TermIndex{
+		index: cmap.New[string, *SessionSet](),
+	}
+}
+
+// Add adds a session to the term's session set.
+func (i *TermIndex) Add(term, sessionID string) {
+	if term == "" {
+		return
+	}
+	set, _ := i.index.GetOrSet(term, NewSessionSet())
+	set.Add(sessionID)
+}
+
+// Remove removes a session from the term's session set.
+func (i *TermIndex) Remove(term, sessionID string) {
+	if term == "" {
+		return
+	}
+	set, ok := i.index.Get(term)
+	if !ok {
+		return
+	}
+
+	set.Remove(sessionID)
+
+	if set.Len() == 0 {
+		i.index.Delete(term)
+	}
+}
+
+// Get returns all session IDs for a term.
+func (i *TermIndex) Get(term string) []string {
+	set, ok := i.index.Get(term)
+	if !ok {
+		return nil
+	}
+	return set.Items()
+}
+
+// Count returns the number of sessions for a term.
+func (i *TermIndex) Count(term string) int {
+	set, ok := i.index.Get(term)
+	if !ok {
+		return 0
+	}
+	return set.Len()
+}
+
+// dataTerm encodes a Data key/value pair as a TermIndex term.
+// Candidates are always re-checked against the session, so a collision
+// through an embedded NUL only costs an extra comparison.
+func dataTerm(key, value string) string {
+	return key + "\x00" + value
+}
+
+// OrderKey is an OrderedIndex entry: a sort value with the session ID
+// as tie-breaker, so every key is unique.
+type OrderKey struct {
+	Value int64
+	ID    string
+}
+
+func lessOrderKey(a, b OrderKey) bool {
+	if a.Value != b.Value {
+		return a.Value < b.Value
+	}
+	return a.ID < b.ID
+}
+
+// OrderedIndex keeps session IDs ordered by an int64 attribute
+// (created_at, last_active or expires_at).
+//
+// It backs keyset pagination and range queries without sorting the whole
+// store. It is not safe for concurrent mutation; the Store serializes
+// writers with its global lock and readers hold the read lock.
+type OrderedIndex struct {
+	tree *btree.BTreeG[OrderKey]
+}
+
+// NewOrderedIndex creates a new ordered index.
+func NewOrderedIndex() *OrderedIndex {
+	return &OrderedIndex{
+		tree: btree.NewG(32, lessOrderKey),
+	}
+}
+
+// Add inserts a session at the given value.
+func (i *OrderedIndex) Add(value int64, sessionID string) {
+	i.tree.ReplaceOrInsert(OrderKey{Value: value, ID: sessionID})
+}
+
+// Remove deletes a session at the given value.
+func (i *OrderedIndex) Remove(value int64, sessionID string) {
+	i.tree.Delete(OrderKey{Value: value, ID: sessionID})
+}
+
+// Len returns the number of indexed sessions.
+func (i *OrderedIndex) Len() int {
+	return i.tree.Len()
+}
+
+// Ascend visits keys in ascending order, starting strictly after from
+// when from is non-nil. Return false from fn to stop.
+func (i *OrderedIndex) Ascend(from *OrderKey, fn func(OrderKey) bool) {
+	if from == nil {
+		i.tree.Ascend(fn)
+		return
+	}
+	pivot := *from
+	i.tree.AscendGreaterOrEqual(pivot, func(k OrderKey) bool {
+		if k == pivot {
+			return true
+		}
+		return fn(k)
+	})
+}
+
+// Descend visits keys in descending order, starting strictly before from
+// when from is non-nil. Return false from fn to stop.
+func (i *OrderedIndex) Descend(from *OrderKey, fn func(OrderKey) bool) {
+	if from == nil {
+		i.tree.Descend(fn)
+		return
+	}
+	pivot := *from
+	i.tree.DescendLessOrEqual(pivot, func(k OrderKey) bool {
+		if k == pivot {
+			return true
+		}
+		return fn(k)
+	})
+}
+
+// AscendRange visits keys with lo <= Value < hi in ascending order.
+func (i *OrderedIndex) AscendRange(lo, hi int64, fn func(OrderKey) bool) {
+	i.tree.AscendRange(OrderKey{Value: lo}, OrderKey{Value: hi}, fn)
+}
+
+type prefixKey struct {
+	term string
+	id   string
+}
+
+func lessPrefixKey(a, b prefixKey) bool {
+	if a.term != b.term {
+		return a.term < b.term
+	}
+	return a.id < b.id
+}
+
+// PrefixIndex keeps session IDs ordered by a string attribute so that
+// both exact and prefix lookups are range scans. Empty terms are not
+// indexed. Like OrderedIndex, it relies on the Store's lock.
+type PrefixIndex struct {
+	tree *btree.BTreeG[prefixKey]
+}
+
+// NewPrefixIndex creates a new prefix index.
+func NewPrefixIndex() *PrefixIndex {
+	return &PrefixIndex{
+		tree: btree.NewG(32, lessPrefixKey),
+	}
+}
+
+// Add inserts a session under the given term.
+func (i *PrefixIndex) Add(term, sessionID string) {
+	if term == "" {
+		return
+	}
+	i.tree.ReplaceOrInsert(prefixKey{term: term, id: sessionID})
+}
+
+// Remove deletes a session from the given term.
+func (i *PrefixIndex) Remove(term, sessionID string) {
+	if term == "" {
+		return
+	}
+	i.tree.Delete(prefixKey{term: term, id: sessionID})
+}
+
+// AscendPrefix visits the session IDs whose term starts with prefix.
+// Return false from fn to stop.
+func (i *PrefixIndex) AscendPrefix(prefix string, fn func(term, sessionID string) bool) {
+	i.tree.AscendGreaterOrEqual(prefixKey{term: prefix}, func(k prefixKey) bool {
+		if !strings.HasPrefix(k.term, prefix) {
+			return false
+		}
+		return fn(k.term, k.id)
+	})
+}
@@ -0,0 +1,381 @@
+// Package memory provides in-memory storage for TokMesh.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// List retrieves sessions matching the given filter with pagination.
+//
+// Query plan:
+//  1. If an exact-match set index applies (user, creator, data pair), the
+//     smallest such set is fetched, filtered and sorted.
+//  2. Otherwise, if a range index applies (device ID/prefix, expiring
+//     within), the range is scanned, filtered and sorted.
+//  3. Otherwise, the created_at or last_active index is walked in the
+//     requested order; in keyset mode the walk stops as soon as the page
+//     is full, so a page costs O(limit) instead of a sort of the store.
+//
+// In keyset mode the returned total is -1.
+//
+// @design DS-0102 § 2.3 索引查询
+func (s *Store) List(_ context.Context, filter *service.SessionFilter) ([]*domain.Session, int, error) {
+	if filter == nil {
+		filter = &service.SessionFilter{}
+	}
+
+	q, err := newListQuery(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if ids, ok := s.candidateIDs(filter, q.now); ok {
+		s.listCandidates(q, ids)
+	} else {
+		s.listByOrder(q)
+	}
+
+	if q.keyset {
+		return q.results, -1, nil
+	}
+	return q.results, q.total, nil
+}
+
+// ListScan lists the sessions visited by scan that match the filter, as
+// List does, for sessions that are not in a Store. It keeps the sessions
+// up to the end of the requested page only, not every match.
+//
+// In keyset mode the returned total is -1.
+func ListScan(_ context.Context, filter *service.SessionFilter, scan func(fn func(*domain.Session) bool)) ([]*domain.Session, int, error) {
+	if filter == nil {
+		filter = &service.SessionFilter{}
+	}
+
+	q, err := newListQuery(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Keep the first `keep` matches in sort order, trimming the
+	// candidates whenever they reach twice that.
+	keep := q.limit
+	if !q.keyset {
+		keep = q.offset + q.pageSize
+	}
+	var candidates []*domain.Session
+	trim := func() {
+		sort.Slice(candidates, func(i, j int) bool {
+			if q.desc {
+				return lessOrderKey(q.key(candidates[j]), q.key(candidates[i]))
+			}
+			return lessOrderKey(q.key(candidates[i]), q.key(candidates[j]))
+		})
+		if len(candidates) > keep {
+			clear(candidates[keep:])
+			candidates = candidates[:keep]
+		}
+	}
+	scan(func(session *domain.Session) bool {
+		if !q.afterCursor(q.key(session)) || !q.matches(session) {
+			return true
+		}
+		q.total++
+		candidates = append(candidates, session)
+		if len(candidates) >= 2*keep {
+			trim()
+		}
+		return true
+	})
+	trim()
+
+	if q.keyset {
+		for _, session := range candidates {
+			q.results = append(q.results, session.Clone())
+		}
+		return q.results, -1, nil
+	}
+	for _, session := range candidates[min(q.offset, len(candidates)):] {
+		q.results = append(q.results, session.Clone())
+	}
+	return q.results, q.total, nil
+}
+
+// listQuery holds the normalized state of a single List call.
+type listQuery struct {
+	filter *service.SessionFilter
+	now    int64
+	sortBy string
+	desc   bool
+
+	// Keyset mode
+	keyset bool
+	after  *OrderKey // Resume strictly after this key (nil = first page)
+	limit  int
+
+	// Offset mode
+	offset   int
+	pageSize int
+
+	results []*domain.Session
+	total   int
+}
+
+func newListQuery(filter *service.SessionFilter) (*listQuery, error) {
+	q := &listQuery{
+		filter: filter,
+		now:    time.Now().UnixMilli(),
+		sortBy: filter.SortBy,
+		desc:   filter.SortOrder != "asc",
+		keyset: filter.Keyset(),
+	}
+	if q.sortBy == "" {
+		q.sortBy = "created_at"
+	}
+
+	if q.keyset {
+		q.limit = filter.Limit
+		if q.limit <= 0 {
+			q.limit = 20
+		}
+		if filter.Cursor != "" {
+			cursor, err := service.DecodeSessionCursor(filter.Cursor)
+			if err != nil {
+				return nil, err
+			}
+			q.after = &OrderKey{Value: cursor.Value, ID: cursor.ID}
+		}
+		return q, nil
+	}
+
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	q.pageSize = filter.PageSize
+	if q.pageSize <= 0 {
+		q.pageSize = 20
+	} else if q.pageSize > 100 {
+		q.pageSize = 100
+	}
+	q.offset = (page - 1) * q.pageSize
+
+	return q, nil
+}
+
+// add offers a session (already in sort order) to the query.
+// It returns false once no further sessions are needed.
+func (q *listQuery) add(session *domain.Session) bool {
+	if !q.matches(session) {
+		return true
+	}
+
+	if q.keyset {
+		q.results = append(q.results, session.Clone())
+		return len(q.results) < q.limit
+	}
+
+	if q.total >= q.offset && q.total < q.offset+q.pageSize {
+		q.results = append(q.results, session.Clone())
+	}
+	q.total++
+	return true
+}
+
+// key returns the sort key of a session.
+func (q *listQuery) key(session *domain.Session) OrderKey {
+	return OrderKey{Value: service.SessionSortValue(session, q.sortBy), ID: session.ID}
+}
+
+// afterCursor reports whether a key lies strictly after the keyset cursor.
+func (q *listQuery) afterCursor(k OrderKey) bool {
+	if q.after == nil {
+		return true
+	}
+	if q.desc {
+		return lessOrderKey(k, *q.after)
+	}
+	return lessOrderKey(*q.after, k)
+}
+
+// matches applies every filter criterion to a session.
+func (q *listQuery) matches(session *domain.Session) bool {
+	f := q.filter
+
+	if f.UserID != "" && session.UserID != f.UserID {
+		return false
+	}
+
+	// Filter by DeviceID
+	if f.DeviceID != "" && session.DeviceID != f.DeviceID {
+		return false
+	}
+	if f.DeviceIDPrefix != "" && !strings.HasPrefix(session.DeviceID, f.DeviceIDPrefix) {
+		return false
+	}
+
+	// Filter by CreatedBy (API Key ID)
+	if f.CreatedBy != "" && session.CreatedBy != f.CreatedBy {
+		return false
+	}
+
+	// Filter by IPAddress (match last_access_ip or ip_address)
+	if f.IPAddress != "" {
+		if session.LastAccessIP != f.IPAddress && session.IPAddress != f.IPAddress {
+			return false
+		}
+	}
+
+	// Filter by Data key/value pairs
+	for k, v := range f.Data {
+		if got, ok := session.Data[k]; !ok || got != v {
+			return false
+		}
+	}
+
+	// Filter by Status
+	if f.Status != "" {
+		isExpired := session.ExpiresAt > 0 && session.ExpiresAt < q.now
+		if f.Status == "active" && isExpired {
+			return false
+		}
+		if f.Status == "expired" && !isExpired {
+			return false
+		}
+	}
+
+	// Filter by CreatedAfter
+	if f.CreatedAfter != nil && session.CreatedAt < f.CreatedAfter.UnixMilli() {
+		return false
+	}
+
+	// Filter by CreatedBefore
+	if f.CreatedBefore != nil && session.CreatedAt >= f.CreatedBefore.UnixMilli() {
+		return false
+	}
+
+	// Filter by ActiveAfter
+	if f.ActiveAfter != nil && session.LastActive < f.ActiveAfter.UnixMilli() {
+		return false
+	}
+
+	// Filter by ExpiresWithin (not yet expired, but will be within the window)
+	if f.ExpiresWithin > 0 {
+		if session.ExpiresAt <= q.now || session.ExpiresAt > q.now+f.ExpiresWithin.Milliseconds() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// candidateIDs returns the session IDs from the most selective index that
+// applies to the filter. ok is false when no index narrows the search.
+// Caller must hold mu.
+func (s *Store) candidateIDs(f *service.SessionFilter, now int64) (ids []string, ok bool) {
+	// Exact-match set indexes: pick the smallest set.
+	var best func() []string
+	bestCount := -1
+	consider := func(count int, get func() []string) {
+		if bestCount < 0 || count < bestCount {
+			best, bestCount = get, count
+		}
+	}
+	if f.UserID != "" {
+		consider(s.userIndex.Count(f.UserID), func() []string { return s.userIndex.Get(f.UserID) })
+	}
+	if f.CreatedBy != "" {
+		consider(s.creatorIndex.Count(f.CreatedBy), func() []string { return s.creatorIndex.Get(f.CreatedBy) })
+	}
+	for k, v := range f.Data {
+		term := dataTerm(k, v)
+		consider(s.dataIndex.Count(term), func() []string { return s.dataIndex.Get(term) })
+	}
+	if bestCount >= 0 {
+		return best(), true
+	}
+
+	// Range indexes.
+	if f.DeviceID != "" || f.DeviceIDPrefix != "" {
+		prefix := f.DeviceIDPrefix
+		if f.DeviceID != "" {
+			prefix = f.DeviceID
+		}
+		s.deviceIndex.AscendPrefix(prefix, func(_, id string) bool {
+			ids = append(ids, id)
+			return true
+		})
+		return ids, true
+	}
+	if f.ExpiresWithin > 0 {
+		s.expiryIndex.AscendRange(now+1, now+f.ExpiresWithin.Milliseconds()+1, func(k OrderKey) bool {
+			ids = append(ids, k.ID)
+			return true
+		})
+		return ids, true
+	}
+
+	return nil, false
+}
+
+// listCandidates filters and sorts an index-provided candidate set.
+// Caller must hold mu.
+func (s *Store) listCandidates(q *listQuery, ids []string) {
+	candidates := make([]*domain.Session, 0, len(ids))
+	for _, id := range ids {
+		session, ok := s.sessions.Get(id)
+		if !ok {
+			continue // Skip if session was deleted
+		}
+		if !q.afterCursor(q.key(session)) || !q.matches(session) {
+			continue
+		}
+		candidates = append(candidates, session)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if q.desc {
+			return lessOrderKey(q.key(candidates[j]), q.key(candidates[i]))
+		}
+		return lessOrderKey(q.key(candidates[i]), q.key(candidates[j]))
+	})
+
+	for _, session := range candidates {
+		if !q.add(session) {
+			return
+		}
+	}
+}
+
+// listByOrder walks the sort-order index directly. Caller must hold mu.
+func (s *Store) listByOrder(q *listQuery) {
+	index := s.createdIndex
+	if q.sortBy == "last_active" {
+		s.activeMu.Lock()
+		defer s.activeMu.Unlock()
+		s.moveTouched()
+		index = s.activeIndex
+	}
+
+	visit := func(k OrderKey) bool {
+		session, ok := s.sessions.Get(k.ID)
+		if !ok {
+			return true
+		}
+		return q.add(session)
+	}
+
+	if q.desc {
+		index.Descend(q.after, visit)
+	} else {
+		index.Ascend(q.after, visit)
+	}
+}
@@ -9,12 +9,10 @@ package memory
 
 import (
 	"context"
-	"sort"
 	"sync"
 	"time"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
-	"github.com/yndnr/tokmesh-go/internal/core/service"
 	"github.com/yndnr/tokmesh-go/pkg/cmap"
 )
 
@@ -32,9 +30,29 @@ type Store struct {
 	// Secondary index: UserID -> set of SessionIDs
 	userIndex *UserIndex
 
+	// Secondary indexes used by List (guarded by mu)
+	createdIndex *OrderedIndex // (CreatedAt, ID)
+	activeIndex  *OrderedIndex // (LastActive, ID)
+	expiryIndex  *OrderedIndex // (ExpiresAt, ID), sessions with an expiry only
+	deviceIndex  *PrefixIndex  // (DeviceID, ID)
+	creatorIndex *TermIndex    // CreatedBy -> set of SessionIDs
+	dataIndex    *TermIndex    // Data key/value -> set of SessionIDs
+
 	// Configuration
 	maxSessionsPerUser int
 
+	// Open point-in-time views (guarded by mu)
+	views []*View
+
+	// Touched sessions not moved in activeIndex yet, per sessions shard:
+	// the LastActive each one is indexed under. Touch records them under
+	// the shard's lock, so touches do not take mu for writing.
+	touchMu []sync.Mutex
+	touched []map[string]int64
+
+	// activeMu guards activeIndex while List walks it under mu.RLock.
+	activeMu sync.Mutex
+
 	// Global lock for operations requiring atomicity across indexes
 	mu sync.RWMutex
 }
@@ -57,6 +75,12 @@ func New(opts ...Option) *Store {
 		userIndex:          NewUserIndex(),
 		maxSessionsPerUser: DefaultMaxSessionsPerUser,
 	}
+	s.touchMu = make([]sync.Mutex, s.sessions.ShardCount())
+	s.touched = make([]map[string]int64, s.sessions.ShardCount())
+	for i := range s.touched {
+		s.touched[i] = make(map[string]int64)
+	}
+	s.resetListIndexes()
 
 	for _, opt := range opts {
 		opt(s)
@@ -65,6 +89,66 @@ func New(opts ...Option) *Store {
 	return s
 }
 
+// resetListIndexes replaces the List indexes with empty ones.
+// Caller must hold mu (or own the store exclusively).
+func (s *Store) resetListIndexes() {
+	s.createdIndex = NewOrderedIndex()
+	s.activeIndex = NewOrderedIndex()
+	s.expiryIndex = NewOrderedIndex()
+	s.deviceIndex = NewPrefixIndex()
+	s.creatorIndex = NewTermIndex()
+	s.dataIndex = NewTermIndex()
+	for _, touched := range s.touched {
+		clear(touched)
+	}
+}
+
+// moveTouched moves the sessions touched since the last call to their
+// LastActive in activeIndex. Caller must hold mu, or mu.RLock and
+// activeMu.
+func (s *Store) moveTouched() {
+	for shard, touched := range s.touched {
+		s.touchMu[shard].Lock()
+		for id, indexed := range touched {
+			s.activeIndex.Remove(indexed, id)
+			if session, ok := s.sessions.Get(id); ok {
+				s.activeIndex.Add(session.LastActive, id)
+			}
+		}
+		clear(touched)
+		s.touchMu[shard].Unlock()
+	}
+}
+
+// indexSession adds a session to the List indexes. Caller must hold mu.
+func (s *Store) indexSession(session *domain.Session) {
+	s.createdIndex.Add(session.CreatedAt, session.ID)
+	s.activeIndex.Add(session.LastActive, session.ID)
+	if session.ExpiresAt > 0 {
+		s.expiryIndex.Add(session.ExpiresAt, session.ID)
+	}
+	s.deviceIndex.Add(session.DeviceID, session.ID)
+	s.creatorIndex.Add(session.CreatedBy, session.ID)
+	for k, v := range session.Data {
+		s.dataIndex.Add(dataTerm(k, v), session.ID)
+	}
+}
+
+// unindexSession removes a session from the List indexes. Caller must hold mu.
+func (s *Store) unindexSession(session *domain.Session) {
+	s.moveTouched()
+	s.createdIndex.Remove(session.CreatedAt, session.ID)
+	s.activeIndex.Remove(session.LastActive, session.ID)
+	if session.ExpiresAt > 0 {
+		s.expiryIndex.Remove(session.ExpiresAt, session.ID)
+	}
+	s.deviceIndex.Remove(session.DeviceID, session.ID)
+	s.creatorIndex.Remove(session.CreatedBy, session.ID)
+	for k, v := range session.Data {
+		s.dataIndex.Remove(dataTerm(k, v), session.ID)
+	}
+}
+
 // Get retrieves a session by ID.
 func (s *Store) Get(_ context.Context, id string) (*domain.Session, error) {
 	session, ok := s.sessions.Get(id)
@@ -81,6 +165,15 @@ func (s *Store) Get(_ context.Context, id string) (*domain.Session, error) {
 	return session.Clone(), nil
 }
 
+// Lookup returns a copy of the session with the given ID, expired or not.
+func (s *Store) Lookup(id string) (*domain.Session, bool) {
+	session, ok := s.sessions.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return session.Clone(), true
+}
+
 // GetByToken retrieves a session by token hash.
 // @design DS-0102 § 2.3 索引查询
 func (s *Store) GetByToken(_ context.Context, tokenHash string) (*domain.Session, error) {
@@ -113,6 +206,32 @@ func (s *Store) Create(_ context.Context, session *domain.Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Store a clone to prevent external modification
+	return s.createLocked(session, session.Clone())
+}
+
+// Restore stores sessions loaded during recovery, taking ownership of
+// them instead of cloning. It takes the lock once for the whole batch and
+// returns one error (or nil) per session, in order.
+func (s *Store) Restore(sessions []*domain.Session) []error {
+	errs := make([]error, len(sessions))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, session := range sessions {
+		if err := session.Validate(); err != nil {
+			errs[i] = err
+			continue
+		}
+		errs[i] = s.createLocked(session, session)
+	}
+	return errs
+}
+
+// createLocked checks quota and conflicts for session, then stores clone
+// (session itself or a copy of it). Caller must hold mu.
+func (s *Store) createLocked(session, clone *domain.Session) error {
 	// Check quota
 	if s.userIndex.Count(session.UserID) >= s.maxSessionsPerUser {
 		return domain.ErrSessionQuotaExceeded
@@ -128,8 +247,8 @@ func (s *Store) Create(_ context.Context, session *domain.Session) error {
 		return domain.ErrTokenHashConflict
 	}
 
-	// Store session (clone to prevent external modification)
-	clone := session.Clone()
+	// Store session
+	s.preserve(session.ID, nil)
 	s.sessions.Set(session.ID, clone)
 
 	// Update indexes
@@ -137,11 +256,14 @@ func (s *Store) Create(_ context.Context, session *domain.Session) error {
 		s.tokens.Set(session.TokenHash, session.ID)
 	}
 	s.userIndex.Add(session.UserID, session.ID)
+	s.indexSession(clone)
 
 	return nil
 }
 
-// Update updates an existing session with optimistic locking.
+// Update updates an existing session with optimistic locking. The stored
+// version must be expectedVersion; the update sets it, and the caller's
+// session.Version, to expectedVersion+1.
 func (s *Store) Update(_ context.Context, session *domain.Session, expectedVersion uint64) error {
 	if err := session.Validate(); err != nil {
 		return err
@@ -150,37 +272,30 @@ func (s *Store) Update(_ context.Context, session *domain.Session, expectedVersi
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	existing, ok := s.sessions.Get(session.ID)
-	if !ok {
-		return domain.ErrSessionNotFound
-	}
-
-	// Optimistic locking: check version
-	if existing.Version != expectedVersion {
-		return domain.ErrSessionVersionConflict
+	existing, err := s.checkUpdate(session, expectedVersion)
+	if err != nil {
+		return err
 	}
 
 	// Handle token hash change
 	if existing.TokenHash != session.TokenHash {
-		// Remove old token mapping
 		if existing.TokenHash != "" {
 			s.tokens.Delete(existing.TokenHash)
 		}
-		// Add new token mapping
 		if session.TokenHash != "" {
-			if s.tokens.Has(session.TokenHash) {
-				return domain.ErrTokenHashConflict
-			}
 			s.tokens.Set(session.TokenHash, session.ID)
 		}
 	}
 
 	// Increment version
 	clone := session.Clone()
-	clone.IncrVersion()
+	clone.Version = expectedVersion + 1
 
 	// Update session
+	s.preserve(session.ID, existing)
 	s.sessions.Set(session.ID, clone)
+	s.unindexSession(existing)
+	s.indexSession(clone)
 
 	// Update version in the caller's session too
 	session.Version = clone.Version
@@ -188,21 +303,58 @@ func (s *Store) Update(_ context.Context, session *domain.Session, expectedVersi
 	return nil
 }
 
+// CheckUpdate reports the error Update would return for session and
+// expectedVersion, without updating anything.
+func (s *Store) CheckUpdate(_ context.Context, session *domain.Session, expectedVersion uint64) error {
+	if err := session.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, err := s.checkUpdate(session, expectedVersion)
+	return err
+}
+
+// checkUpdate returns the stored session that session updates, checking
+// the version and token hash. Caller must hold mu.
+func (s *Store) checkUpdate(session *domain.Session, expectedVersion uint64) (*domain.Session, error) {
+	existing, ok := s.sessions.Get(session.ID)
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+
+	// Optimistic locking: check version
+	if existing.Version != expectedVersion {
+		return nil, domain.ErrSessionVersionConflict
+	}
+
+	if existing.TokenHash != session.TokenHash && session.TokenHash != "" && s.tokens.Has(session.TokenHash) {
+		return nil, domain.ErrTokenHashConflict
+	}
+
+	return existing, nil
+}
+
 // Delete removes a session.
 func (s *Store) Delete(_ context.Context, id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	session, ok := s.sessions.Pop(id)
+	session, ok := s.sessions.Get(id)
 	if !ok {
 		return domain.ErrSessionNotFound
 	}
+	s.preserve(id, session)
+	s.sessions.Delete(id)
 
 	// Clean up indexes
 	if session.TokenHash != "" {
 		s.tokens.Delete(session.TokenHash)
 	}
 	s.userIndex.Remove(session.UserID, id)
+	s.unindexSession(session)
 
 	return nil
 }
@@ -217,12 +369,15 @@ func (s *Store) DeleteByToken(_ context.Context, tokenHash string) error {
 		return domain.ErrTokenInvalid
 	}
 
-	session, ok := s.sessions.Pop(sessionID)
+	session, ok := s.sessions.Get(sessionID)
 	if !ok {
 		return domain.ErrSessionNotFound
 	}
+	s.preserve(sessionID, session)
+	s.sessions.Delete(sessionID)
 
 	s.userIndex.Remove(session.UserID, sessionID)
+	s.unindexSession(session)
 
 	return nil
 }
@@ -249,141 +404,6 @@ func (s *Store) ListByUserID(_ context.Context, userID string) ([]*domain.Sessio
 	return sessions, nil
 }
 
-// List retrieves sessions matching the given filter with pagination.
-func (s *Store) List(_ context.Context, filter *service.SessionFilter) ([]*domain.Session, int, error) {
-	if filter == nil {
-		filter = &service.SessionFilter{}
-	}
-
-	// Step 1: Collect candidate sessions (use indexes when possible)
-	var candidates []*domain.Session
-
-	if filter.UserID != "" {
-		// Use user index for efficiency
-		sessionIDs := s.userIndex.Get(filter.UserID)
-		for _, id := range sessionIDs {
-			if session, ok := s.sessions.Get(id); ok {
-				candidates = append(candidates, session)
-			}
-		}
-	} else {
-		// Full scan (expensive, should be avoided in production with limits)
-		s.sessions.Range(func(_ string, session *domain.Session) bool {
-			candidates = append(candidates, session)
-			return true
-		})
-	}
-
-	// Step 2: Filter candidates
-	var filtered []*domain.Session
-	now := time.Now().UnixMilli()
-
-	for _, session := range candidates {
-		// Filter by DeviceID
-		if filter.DeviceID != "" && session.DeviceID != filter.DeviceID {
-			continue
-		}
-
-		// Filter by CreatedBy (API Key ID)
-		if filter.CreatedBy != "" && session.CreatedBy != filter.CreatedBy {
-			continue
-		}
-
-		// Filter by IPAddress (match last_access_ip or ip_address)
-		if filter.IPAddress != "" {
-			if session.LastAccessIP != filter.IPAddress && session.IPAddress != filter.IPAddress {
-				continue
-			}
-		}
-
-		// Filter by Status
-		if filter.Status != "" {
-			isExpired := session.ExpiresAt > 0 && session.ExpiresAt < now
-			if filter.Status == "active" && isExpired {
-				continue
-			}
-			if filter.Status == "expired" && !isExpired {
-				continue
-			}
-		}
-
-		// Filter by CreatedAfter
-		if filter.CreatedAfter != nil && session.CreatedAt < filter.CreatedAfter.UnixMilli() {
-			continue
-		}
-
-		// Filter by CreatedBefore
-		if filter.CreatedBefore != nil && session.CreatedAt >= filter.CreatedBefore.UnixMilli() {
-			continue
-		}
-
-		// Filter by ActiveAfter
-		if filter.ActiveAfter != nil && session.LastActive < filter.ActiveAfter.UnixMilli() {
-			continue
-		}
-
-		filtered = append(filtered, session)
-	}
-
-	total := len(filtered)
-
-	// Step 3: Sort results
-	sortBy := filter.SortBy
-	if sortBy == "" {
-		sortBy = "created_at"
-	}
-	sortOrder := filter.SortOrder
-	if sortOrder == "" {
-		sortOrder = "desc"
-	}
-
-	sort.Slice(filtered, func(i, j int) bool {
-		var less bool
-		switch sortBy {
-		case "last_active":
-			less = filtered[i].LastActive < filtered[j].LastActive
-		default: // "created_at"
-			less = filtered[i].CreatedAt < filtered[j].CreatedAt
-		}
-
-		if sortOrder == "asc" {
-			return less
-		}
-		return !less
-	})
-
-	// Step 4: Paginate
-	page := filter.Page
-	if page < 1 {
-		page = 1
-	}
-	pageSize := filter.PageSize
-	if pageSize <= 0 {
-		pageSize = 20
-	} else if pageSize > 100 {
-		pageSize = 100
-	}
-
-	startIdx := (page - 1) * pageSize
-	endIdx := startIdx + pageSize
-
-	if startIdx >= len(filtered) {
-		return []*domain.Session{}, total, nil
-	}
-
-	if endIdx > len(filtered) {
-		endIdx = len(filtered)
-	}
-
-	// Clone results to prevent external modification
-	results := make([]*domain.Session, 0, endIdx-startIdx)
-	for i := startIdx; i < endIdx; i++ {
-		results = append(results, filtered[i].Clone())
-	}
-
-	return results, total, nil
-}
-
 // DeleteByUserID removes all sessions for a user.
 func (s *Store) DeleteByUserID(_ context.Context, userID string) (int, error) {
 	s.mu.Lock()
@@ -396,13 +416,16 @@ func (s *Store) DeleteByUserID(_ context.Context, userID string) (int, error) {
 
 	deleted := 0
 	for _, id := range sessionIDs {
-		session, ok := s.sessions.Pop(id)
+		session, ok := s.sessions.Get(id)
 		if !ok {
 			continue
 		}
+		s.preserve(id, session)
+		s.sessions.Delete(id)
 		if session.TokenHash != "" {
 			s.tokens.Delete(session.TokenHash)
 		}
+		s.unindexSession(session)
 		deleted++
 	}
 
@@ -411,6 +434,11 @@ func (s *Store) DeleteByUserID(_ context.Context, userID string) (int, error) {
 	return deleted, nil
 }
 
+// UserSessionIDs returns the IDs of the sessions of a user, expired or not.
+func (s *Store) UserSessionIDs(userID string) []string {
+	return s.userIndex.Get(userID)
+}
+
 // Count returns the total number of sessions.
 func (s *Store) Count() int {
 	return s.sessions.Count()
@@ -453,26 +481,45 @@ func (s *Store) LoadFromSnapshot(sessions []*domain.Session) error {
 	defer s.mu.Unlock()
 
 	// Clear existing data
+	if len(s.views) > 0 {
+		s.sessions.Range(func(id string, session *domain.Session) bool {
+			s.preserve(id, session)
+			return true
+		})
+	}
 	s.sessions.Clear()
 	s.tokens.Clear()
 	s.userIndex = NewUserIndex()
+	s.resetListIndexes()
 
 	// Load sessions
 	for _, session := range sessions {
 		clone := session.Clone()
+		s.preserve(session.ID, nil)
 		s.sessions.Set(session.ID, clone)
 
 		if session.TokenHash != "" {
 			s.tokens.Set(session.TokenHash, session.ID)
 		}
 		s.userIndex.Add(session.UserID, session.ID)
+		s.indexSession(clone)
 	}
 
 	return nil
 }
 
 // Touch updates the last access time for a session.
+//
+// Touches only share mu with other touches and reads, and serialize per
+// shard; the last_active index is moved in batches by moveTouched.
 func (s *Store) Touch(_ context.Context, id, ip, userAgent string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shard := s.sessions.ShardOf(id)
+	s.touchMu[shard].Lock()
+	defer s.touchMu[shard].Unlock()
+
 	session, ok := s.sessions.Get(id)
 	if !ok {
 		return domain.ErrSessionNotFound
@@ -482,39 +529,118 @@ func (s *Store) Touch(_ context.Context, id, ip, userAgent string) error {
 		return domain.ErrSessionExpired
 	}
 
-	// Update in place (atomic operation on the session fields)
-	session.Touch(ip, userAgent)
+	// Copy-on-write so concurrent readers never observe a half-updated
+	// session. Data is shared: it is never modified in place.
+	touched := *session
+	touched.Touch(ip, userAgent)
+	s.preserve(id, session)
+	s.sessions.Set(id, &touched)
+	if _, ok := s.touched[shard][id]; !ok {
+		s.touched[shard][id] = session.LastActive
+	}
 
 	return nil
 }
 
+// ApplyTouch sets LastActive (if later), and the access IP and user agent
+// when not empty, without changing the version. Unlike Touch it applies
+// to expired sessions too, as when replaying a logged touch. It returns a
+// copy of the updated session.
+func (s *Store) ApplyTouch(_ context.Context, id string, lastActive int64, ip, userAgent string) (*domain.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shard := s.sessions.ShardOf(id)
+	s.touchMu[shard].Lock()
+	defer s.touchMu[shard].Unlock()
+
+	session, ok := s.sessions.Get(id)
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+
+	// Copy-on-write, as in Touch
+	touched := *session
+	touched.TouchAt(lastActive, ip, userAgent)
+	s.preserve(id, session)
+	s.sessions.Set(id, &touched)
+	if _, ok := s.touched[shard][id]; !ok {
+		s.touched[shard][id] = session.LastActive
+	}
+
+	return touched.Clone(), nil
+}
+
+// SetExpiry sets ExpiresAt and the TTL hint (milliseconds), and
+// LastActive when not zero, without changing the version. It returns a
+// copy of the updated session.
+func (s *Store) SetExpiry(_ context.Context, id string, expiresAt, ttl, lastActive int64) (*domain.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions.Get(id)
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+
+	clone := session.Clone()
+	clone.ExpiresAt = expiresAt
+	clone.TTL = ttl
+	if lastActive > clone.LastActive {
+		clone.LastActive = lastActive
+	}
+	s.moveTouched()
+	s.preserve(id, session)
+	s.sessions.Set(id, clone)
+	s.activeIndex.Remove(session.LastActive, id)
+	s.activeIndex.Add(clone.LastActive, id)
+	if session.ExpiresAt > 0 {
+		s.expiryIndex.Remove(session.ExpiresAt, id)
+	}
+	if clone.ExpiresAt > 0 {
+		s.expiryIndex.Add(clone.ExpiresAt, id)
+	}
+
+	return clone.Clone(), nil
+}
+
 // CleanupExpired removes all expired sessions.
 // Returns the number of sessions removed.
 func (s *Store) CleanupExpired() int {
+	return len(s.cleanupExpired())
+}
+
+// cleanupExpired removes all expired sessions and returns them.
+func (s *Store) cleanupExpired() []*domain.Session {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// The expiry index holds only sessions with an expiration, ordered by
+	// ExpiresAt, so this visits expired sessions only.
 	var toDelete []string
-
-	s.sessions.Range(func(id string, session *domain.Session) bool {
-		if session.IsExpired() {
-			toDelete = append(toDelete, id)
-		}
+	now := time.Now().UnixMilli()
+	s.expiryIndex.AscendRange(1, now, func(k OrderKey) bool {
+		toDelete = append(toDelete, k.ID)
 		return true
 	})
 
+	deleted := make([]*domain.Session, 0, len(toDelete))
 	for _, id := range toDelete {
-		session, ok := s.sessions.Pop(id)
+		session, ok := s.sessions.Get(id)
 		if !ok {
 			continue
 		}
+		s.preserve(id, session)
+		s.sessions.Delete(id)
 		if session.TokenHash != "" {
 			s.tokens.Delete(session.TokenHash)
 		}
 		s.userIndex.Remove(session.UserID, id)
+		s.unindexSession(session)
+		deleted = append(deleted, session)
 	}
 
-	return len(toDelete)
+	return deleted
 }
 
 // DeleteExpired deletes all expired sessions and returns the count.
@@ -524,6 +650,12 @@ func (s *Store) DeleteExpired(ctx context.Context) (int, error) {
 	return count, nil
 }
 
+// DeleteExpiredSessions deletes all expired sessions and returns them.
+// This method implements the service.ExpiredSessionRepository interface.
+func (s *Store) DeleteExpiredSessions(ctx context.Context) ([]*domain.Session, error) {
+	return s.cleanupExpired(), nil
+}
+
 // ============================================================================
 // TokenRepository Interface Methods
 // ============================================================================
@@ -545,14 +677,30 @@ func (s *Store) UpdateSession(ctx context.Context, session *domain.Session) erro
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, ok := s.sessions.Get(session.ID)
+	existing, ok := s.sessions.Get(session.ID)
 	if !ok {
 		return domain.ErrSessionNotFound
 	}
 
+	// Handle token hash change
+	if existing.TokenHash != session.TokenHash {
+		if session.TokenHash != "" && s.tokens.Has(session.TokenHash) {
+			return domain.ErrTokenHashConflict
+		}
+		if existing.TokenHash != "" {
+			s.tokens.Delete(existing.TokenHash)
+		}
+		if session.TokenHash != "" {
+			s.tokens.Set(session.TokenHash, session.ID)
+		}
+	}
+
 	// Update without version checking (for touch operations)
 	clone := session.Clone()
+	s.preserve(session.ID, existing)
 	s.sessions.Set(session.ID, clone)
+	s.unindexSession(existing)
+	s.indexSession(clone)
 
 	return nil
 }
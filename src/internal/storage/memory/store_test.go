@@ -2,13 +2,21 @@ package memory
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
 	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage/storagetest"
 )
 
+func TestStore_Conformance(t *testing.T) {
+	storagetest.RunSessionRepositorySuite(t, func(*testing.T, string) service.SessionRepository {
+		return New(WithMaxSessionsPerUser(storagetest.Quota))
+	})
+}
+
 func TestStore_CreateIndexesAndLookup(t *testing.T) {
 	store := New()
 	ctx := context.Background()
@@ -143,6 +151,39 @@ func TestStore_UpdateChangesTokenIndex(t *testing.T) {
 	}
 }
 
+func TestStore_UpdateSessionChangesTokenIndex(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	a, _ := domain.NewSession("u1")
+	a.TokenHash = "tmth_us_a"
+	a.SetExpiration(time.Hour)
+	b, _ := domain.NewSession("u1")
+	b.TokenHash = "tmth_us_b"
+	b.SetExpiration(time.Hour)
+	for _, s := range []*domain.Session{a, b} {
+		if err := store.Create(ctx, s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	a.TokenHash = b.TokenHash
+	if err := store.UpdateSession(ctx, a); err != domain.ErrTokenHashConflict {
+		t.Fatalf("UpdateSession(taken token) err = %v, want %v", err, domain.ErrTokenHashConflict)
+	}
+
+	a.TokenHash = "tmth_us_new"
+	if err := store.UpdateSession(ctx, a); err != nil {
+		t.Fatalf("UpdateSession: %v", err)
+	}
+	if _, err := store.GetByToken(ctx, "tmth_us_a"); err != domain.ErrTokenInvalid {
+		t.Fatalf("GetByToken(old) err = %v, want %v", err, domain.ErrTokenInvalid)
+	}
+	if got, err := store.GetByToken(ctx, "tmth_us_new"); err != nil || got.ID != a.ID {
+		t.Fatalf("GetByToken(new) = %v, %v; want %s", got, err, a.ID)
+	}
+}
+
 func TestStore_DeleteByToken(t *testing.T) {
 	store := New()
 	ctx := context.Background()
@@ -208,6 +249,37 @@ func TestStore_LoadFromSnapshotAndCleanupExpired(t *testing.T) {
 	}
 }
 
+func TestStore_DeleteExpiredSessions(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	expired, _ := domain.NewSession("u1")
+	expired.TokenHash = "tmth_expired"
+	expired.ExpiresAt = time.Now().Add(-time.Minute).UnixMilli()
+
+	active, _ := domain.NewSession("u1")
+	active.TokenHash = "tmth_active"
+	active.SetExpiration(time.Hour)
+
+	if err := store.LoadFromSnapshot([]*domain.Session{expired, active}); err != nil {
+		t.Fatalf("LoadFromSnapshot: %v", err)
+	}
+
+	deleted, err := store.DeleteExpiredSessions(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSessions: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != expired.ID {
+		t.Fatalf("DeleteExpiredSessions = %v, want [%s]", deleted, expired.ID)
+	}
+	if _, err := store.GetSessionByTokenHash(ctx, "tmth_expired"); err == nil {
+		t.Error("expired session still indexed by token hash")
+	}
+	if store.Count() != 1 {
+		t.Fatalf("Count = %d, want 1", store.Count())
+	}
+}
+
 func TestStore_ListWithUserFilterAndPaging(t *testing.T) {
 	store := New()
 	ctx := context.Background()
@@ -287,6 +359,69 @@ func TestStore_TouchNotFound(t *testing.T) {
 	}
 }
 
+func TestStore_ApplyTouch(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	s, _ := domain.NewSession("u1")
+	s.TokenHash = "tmth_apply_touch"
+	s.ExpiresAt = time.Now().Add(-time.Minute).UnixMilli()
+	store.sessions.Set(s.ID, s)
+	store.indexSession(s)
+
+	// Applies to expired sessions too, and keeps the version.
+	at := s.LastActive + 5000
+	got, err := store.ApplyTouch(ctx, s.ID, at, "1.2.3.4", "ua")
+	if err != nil {
+		t.Fatalf("ApplyTouch: %v", err)
+	}
+	if got.LastActive != at || got.LastAccessIP != "1.2.3.4" || got.LastAccessUA != "ua" || got.Version != s.Version {
+		t.Fatalf("ApplyTouch = %+v", got)
+	}
+
+	// An older touch does not move LastActive back; empty fields are kept.
+	got, err = store.ApplyTouch(ctx, s.ID, at-1000, "", "")
+	if err != nil {
+		t.Fatalf("ApplyTouch: %v", err)
+	}
+	if got.LastActive != at || got.LastAccessIP != "1.2.3.4" {
+		t.Fatalf("ApplyTouch of an older touch = %+v", got)
+	}
+
+	if _, err := store.ApplyTouch(ctx, "nonexistent", at, "", ""); err != domain.ErrSessionNotFound {
+		t.Fatalf("ApplyTouch err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+}
+
+func TestStore_SetExpiry(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	s, _ := domain.NewSession("u1")
+	s.TokenHash = "tmth_set_expiry"
+	s.SetExpiration(time.Minute)
+	if err := store.Create(ctx, s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	expiresAt := time.Now().Add(-time.Second).UnixMilli()
+	got, err := store.SetExpiry(ctx, s.ID, expiresAt, 1000, 0)
+	if err != nil {
+		t.Fatalf("SetExpiry: %v", err)
+	}
+	if got.ExpiresAt != expiresAt || got.TTL != 1000 || got.LastActive != s.LastActive || got.Version != s.Version {
+		t.Fatalf("SetExpiry = %+v", got)
+	}
+
+	// The expiry index follows the new expiration.
+	if n := store.CleanupExpired(); n != 1 {
+		t.Fatalf("CleanupExpired = %d, want 1", n)
+	}
+	if _, err := store.SetExpiry(ctx, s.ID, expiresAt, 1000, 0); err != domain.ErrSessionNotFound {
+		t.Fatalf("SetExpiry err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+}
+
 func TestStore_CountByUser(t *testing.T) {
 	store := New()
 	ctx := context.Background()
@@ -455,6 +590,25 @@ func TestStore_GetExpired(t *testing.T) {
 	}
 }
 
+func TestStore_LookupExpired(t *testing.T) {
+	store := New()
+
+	s, _ := domain.NewSession("u1")
+	s.ExpiresAt = time.Now().Add(-time.Minute).UnixMilli()
+	store.sessions.Set(s.ID, s)
+
+	got, ok := store.Lookup(s.ID)
+	if !ok || got.ID != s.ID {
+		t.Fatalf("Lookup = %v, %v; want the expired session", got, ok)
+	}
+	if got == s {
+		t.Fatal("Lookup returned the stored session, want a copy")
+	}
+	if _, ok := store.Lookup("missing"); ok {
+		t.Fatal("Lookup(missing) ok = true")
+	}
+}
+
 func TestStore_GetByTokenExpired(t *testing.T) {
 	store := New()
 	ctx := context.Background()
@@ -610,3 +764,313 @@ func TestStore_ListSortByLastActive(t *testing.T) {
 		}
 	}
 }
+
+// newListSession creates a session with a fixed created_at for list tests.
+func newListSession(t *testing.T, userID string, createdAt int64) *domain.Session {
+	t.Helper()
+	s, err := domain.NewSession(userID)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	s.TokenHash = "tmth_" + s.ID
+	s.CreatedAt = createdAt
+	s.LastActive = createdAt
+	s.SetExpiration(time.Hour)
+	return s
+}
+
+func TestStore_ListKeysetPagination(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	base := time.Now().UnixMilli()
+	for i := 0; i < 25; i++ {
+		// Every pair shares a created_at to exercise the ID tie-breaker.
+		s := newListSession(t, "u"+string(rune('a'+i)), base+int64(i/2))
+		if err := store.Create(ctx, s); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var prev *OrderKey
+	cursor := ""
+	pages := 0
+	for {
+		filter := &service.SessionFilter{
+			SortBy:    "created_at",
+			SortOrder: "desc",
+			Cursor:    cursor,
+			Limit:     10,
+		}
+		sessions, total, err := store.List(ctx, filter)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if total != -1 {
+			t.Fatalf("total = %d, want -1 in keyset mode", total)
+		}
+		pages++
+
+		for _, s := range sessions {
+			if seen[s.ID] {
+				t.Fatalf("session %s returned twice", s.ID)
+			}
+			seen[s.ID] = true
+			k := OrderKey{Value: s.CreatedAt, ID: s.ID}
+			if prev != nil && !lessOrderKey(k, *prev) {
+				t.Fatalf("page not in descending order: %+v after %+v", k, *prev)
+			}
+			prev = &k
+		}
+
+		if pages == 1 {
+			// A session created mid-listing sorts before the cursor and must
+			// not shift later pages.
+			late := newListSession(t, "late", base+1000)
+			if err := store.Create(ctx, late); err != nil {
+				t.Fatalf("Create late: %v", err)
+			}
+		}
+
+		if len(sessions) < 10 {
+			break
+		}
+		cursor = service.NewSessionCursor(sessions[len(sessions)-1], "created_at", "desc").Encode()
+	}
+
+	if len(seen) != 25 {
+		t.Fatalf("saw %d sessions, want 25", len(seen))
+	}
+	if pages != 3 {
+		t.Fatalf("pages = %d, want 3", pages)
+	}
+}
+
+func TestStore_ListKeysetAscendingWithCandidates(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	base := time.Now().UnixMilli()
+	for i := 0; i < 6; i++ {
+		s := newListSession(t, "u1", base+int64(i))
+		if err := store.Create(ctx, s); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+
+	first, _, err := store.List(ctx, &service.SessionFilter{UserID: "u1", SortOrder: "asc", Limit: 4})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(first) != 4 {
+		t.Fatalf("len(first) = %d, want 4", len(first))
+	}
+
+	cursor := service.NewSessionCursor(first[3], "created_at", "asc").Encode()
+	second, _, err := store.List(ctx, &service.SessionFilter{UserID: "u1", SortOrder: "asc", Limit: 4, Cursor: cursor})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(second) != 2 {
+		t.Fatalf("len(second) = %d, want 2", len(second))
+	}
+	if second[0].CreatedAt != base+4 || second[1].CreatedAt != base+5 {
+		t.Fatalf("second page = [%d %d], want [%d %d]", second[0].CreatedAt, second[1].CreatedAt, base+4, base+5)
+	}
+}
+
+func TestStore_ListInvalidCursor(t *testing.T) {
+	store := New()
+
+	_, _, err := store.List(context.Background(), &service.SessionFilter{Cursor: "not-a-cursor"})
+	if !domain.IsDomainError(err, "TM-ARG-1001") {
+		t.Fatalf("List error = %v, want TM-ARG-1001", err)
+	}
+}
+
+func TestStore_ListExtendedFilters(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	base := time.Now().UnixMilli()
+
+	mk := func(user, device, createdBy string, data map[string]string, ttl time.Duration) *domain.Session {
+		s := newListSession(t, user, base)
+		s.DeviceID = device
+		s.CreatedBy = createdBy
+		s.Data = data
+		s.SetExpiration(ttl)
+		if err := store.Create(ctx, s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return s
+	}
+
+	ios1 := mk("u1", "ios-1", "key-a", map[string]string{"tenant": "acme"}, time.Hour)
+	ios2 := mk("u2", "ios-2", "key-b", map[string]string{"tenant": "acme", "plan": "pro"}, 5*time.Minute)
+	web := mk("u3", "web-1", "key-a", map[string]string{"tenant": "globex"}, 2*time.Minute)
+
+	tests := []struct {
+		name   string
+		filter service.SessionFilter
+		want   []string
+	}{
+		{"device prefix", service.SessionFilter{DeviceIDPrefix: "ios-"}, []string{ios1.ID, ios2.ID}},
+		{"device exact", service.SessionFilter{DeviceID: "ios-2"}, []string{ios2.ID}},
+		{"created by", service.SessionFilter{CreatedBy: "key-a"}, []string{ios1.ID, web.ID}},
+		{"data match", service.SessionFilter{Data: map[string]string{"tenant": "acme"}}, []string{ios1.ID, ios2.ID}},
+		{"data all pairs", service.SessionFilter{Data: map[string]string{"tenant": "acme", "plan": "pro"}}, []string{ios2.ID}},
+		{"expiring within", service.SessionFilter{ExpiresWithin: 10 * time.Minute}, []string{ios2.ID, web.ID}},
+		{"combined", service.SessionFilter{CreatedBy: "key-a", DeviceIDPrefix: "web"}, []string{web.ID}},
+		{"no match", service.SessionFilter{Data: map[string]string{"tenant": "initech"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			sessions, total, err := store.List(ctx, &filter)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if total != len(tt.want) {
+				t.Fatalf("total = %d, want %d", total, len(tt.want))
+			}
+			got := make(map[string]bool)
+			for _, s := range sessions {
+				got[s.ID] = true
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("missing session %s", id)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_ListIndexesFollowMutations(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+
+	s := newListSession(t, "u1", time.Now().UnixMilli())
+	s.DeviceID = "ios-1"
+	s.Data = map[string]string{"tenant": "acme"}
+	if err := store.Create(ctx, s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Move the session to another device and tenant.
+	updated := s.Clone()
+	updated.DeviceID = "web-1"
+	updated.Data = map[string]string{"tenant": "globex"}
+	if err := store.Update(ctx, updated, s.Version); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	count := func(f service.SessionFilter) int {
+		_, total, err := store.List(ctx, &f)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		return total
+	}
+
+	if n := count(service.SessionFilter{DeviceIDPrefix: "ios"}); n != 0 {
+		t.Errorf("old device still indexed: %d", n)
+	}
+	if n := count(service.SessionFilter{Data: map[string]string{"tenant": "acme"}}); n != 0 {
+		t.Errorf("old data still indexed: %d", n)
+	}
+	if n := count(service.SessionFilter{DeviceIDPrefix: "web"}); n != 1 {
+		t.Errorf("new device not indexed: %d", n)
+	}
+
+	if err := store.Delete(ctx, s.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n := count(service.SessionFilter{Data: map[string]string{"tenant": "globex"}}); n != 0 {
+		t.Errorf("deleted session still indexed: %d", n)
+	}
+	if store.createdIndex.Len() != 0 || store.activeIndex.Len() != 0 || store.expiryIndex.Len() != 0 {
+		t.Errorf("ordered indexes not empty after delete")
+	}
+}
+
+func TestStore_TouchReordersLastActive(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	base := time.Now().Add(-time.Minute).UnixMilli()
+
+	older := newListSession(t, "u1", base)
+	newer := newListSession(t, "u2", base+1)
+	for _, s := range []*domain.Session{older, newer} {
+		if err := store.Create(ctx, s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if err := store.Touch(ctx, older.ID, "", ""); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+
+	sessions, _, err := store.List(ctx, &service.SessionFilter{SortBy: "last_active", SortOrder: "desc", Limit: 1})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != older.ID {
+		t.Fatalf("most recently active = %v, want %s", sessions, older.ID)
+	}
+}
+
+func TestStore_TouchIndexedLazily(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	base := time.Now().Add(-time.Minute).UnixMilli()
+
+	sessions := make([]*domain.Session, 8)
+	for i := range sessions {
+		sessions[i] = newListSession(t, "u1", base+int64(i))
+		if err := store.Create(ctx, sessions[i]); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	// Concurrent touches and listings by last_active
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := store.Touch(ctx, id, "10.0.0.1", ""); err != nil {
+					t.Errorf("Touch: %v", err)
+					return
+				}
+				if _, _, err := store.List(ctx, &service.SessionFilter{SortBy: "last_active"}); err != nil {
+					t.Errorf("List: %v", err)
+					return
+				}
+			}
+		}(sessions[i].ID)
+	}
+	wg.Wait()
+
+	listed, _, err := store.List(ctx, &service.SessionFilter{SortBy: "last_active"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(listed) != len(sessions) || store.activeIndex.Len() != len(sessions) {
+		t.Fatalf("listed %d sessions, %d indexed, want %d", len(listed), store.activeIndex.Len(), len(sessions))
+	}
+
+	// A touched session deleted before the index is moved leaves nothing
+	if err := store.Touch(ctx, sessions[0].ID, "", ""); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	if err := store.Delete(ctx, sessions[0].ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n := store.activeIndex.Len(); n != len(sessions)-1 {
+		t.Errorf("active index holds %d sessions after delete, want %d", n, len(sessions)-1)
+	}
+}
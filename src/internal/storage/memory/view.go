@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// View is a point-in-time view of a Store, opened by OpenView.
+//
+// Opening a view is O(1), and scanning it does not block writers: stored
+// sessions are never modified in place (writes replace them with a new
+// clone), so the view only needs the version a session had when the view
+// was opened. The first write to a session after that saves the previous
+// version (or its absence) for the view, until the scan has passed the
+// session's shard.
+//
+// @design DS-0102
+type View struct {
+	store *Store
+	count int
+
+	mu sync.Mutex
+	// done marks the shards the scan has passed.
+	done []bool
+	// saved holds, per shard, the version of each session written since
+	// the view was opened, or nil for a session created since.
+	saved []map[string]*domain.Session
+}
+
+// OpenView opens a point-in-time view of the store. The view must be
+// closed after use, since open views make writes keep old versions.
+func (s *Store) OpenView() *View {
+	shards := s.sessions.ShardCount()
+	v := &View{
+		store: s,
+		done:  make([]bool, shards),
+		saved: make([]map[string]*domain.Session, shards),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v.count = s.sessions.Count()
+	s.views = append(s.views, v)
+	return v
+}
+
+// Len returns the number of sessions in the view.
+func (v *View) Len() int {
+	return v.count
+}
+
+// Scan calls fn for each session in the view, shard by shard, until fn
+// returns false. The sessions are the stored ones rather than clones and
+// must not be modified. A view can be scanned once.
+func (v *View) Scan(fn func(*domain.Session) bool) {
+	var items []*domain.Session
+	for i := range v.done {
+		items = items[:0]
+		v.store.sessions.RangeShard(i, func(_ string, session *domain.Session) bool {
+			items = append(items, session)
+			return true
+		})
+
+		// Writes to this shard from now on were not seen by RangeShard
+		// and need no saving; those before it were saved.
+		v.mu.Lock()
+		v.done[i] = true
+		saved := v.saved[i]
+		v.saved[i] = nil
+		v.mu.Unlock()
+
+		for _, session := range items {
+			if old, ok := saved[session.ID]; ok {
+				delete(saved, session.ID)
+				if old == nil {
+					continue
+				}
+				session = old
+			}
+			if !fn(session) {
+				return
+			}
+		}
+
+		// Sessions deleted since the view was opened.
+		for _, old := range saved {
+			if old != nil && !fn(old) {
+				return
+			}
+		}
+	}
+}
+
+// Close releases the view.
+func (v *View) Close() {
+	s := v.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, open := range s.views {
+		if open == v {
+			s.views = append(s.views[:i], s.views[i+1:]...)
+			return
+		}
+	}
+}
+
+// preserve saves the current version of a session (nil if it does not
+// exist) for the open views before it is written. Caller must hold mu.
+func (s *Store) preserve(id string, current *domain.Session) {
+	if len(s.views) == 0 {
+		return
+	}
+	shard := s.sessions.ShardOf(id)
+	for _, v := range s.views {
+		v.save(shard, id, current)
+	}
+}
+
+// save keeps the first saved version of a session.
+func (v *View) save(shard int, id string, session *domain.Session) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.done[shard] {
+		return
+	}
+	if v.saved[shard] == nil {
+		v.saved[shard] = make(map[string]*domain.Session)
+	}
+	if _, ok := v.saved[shard][id]; !ok {
+		v.saved[shard][id] = session
+	}
+}
@@ -0,0 +1,170 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+// fillStore creates n sessions for distinct users and returns their IDs.
+func fillStore(t *testing.T, store *Store, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		s, _ := domain.NewSession(fmt.Sprintf("user-%d", i))
+		s.TokenHash = fmt.Sprintf("tmth_view_%d", i)
+		s.SetExpiration(time.Hour)
+		if err := store.Create(context.Background(), s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// scanView returns the sessions of a view by ID.
+func scanView(t *testing.T, v *View) map[string]*domain.Session {
+	t.Helper()
+	got := make(map[string]*domain.Session)
+	v.Scan(func(s *domain.Session) bool {
+		if _, dup := got[s.ID]; dup {
+			t.Errorf("session %s scanned twice", s.ID)
+		}
+		got[s.ID] = s
+		return true
+	})
+	return got
+}
+
+func TestView_PointInTime(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	ids := fillStore(t, store, 200)
+
+	v := store.OpenView()
+	defer v.Close()
+	if v.Len() != 200 {
+		t.Fatalf("Len = %d, want 200", v.Len())
+	}
+
+	// Writes after the view was opened are not visible in it.
+	for _, id := range ids[:50] {
+		if err := store.Delete(ctx, id); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+	for _, id := range ids[50:100] {
+		if err := store.Touch(ctx, id, "192.0.2.1", "test"); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		s, _ := store.Get(ctx, id)
+		s.DeviceID = "changed"
+		if err := store.Update(ctx, s, s.Version); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	extra, _ := domain.NewSession("late-user")
+	if err := store.Create(ctx, extra); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got := scanView(t, v)
+	if len(got) != 200 {
+		t.Fatalf("view has %d sessions, want 200", len(got))
+	}
+	for _, id := range ids {
+		s, ok := got[id]
+		if !ok {
+			t.Fatalf("session %s missing from view", id)
+		}
+		if s.DeviceID != "" || s.LastAccessIP != "" {
+			t.Errorf("session %s changed in view: %+v", id, s)
+		}
+	}
+	if _, ok := got[extra.ID]; ok {
+		t.Error("session created after the view is in it")
+	}
+}
+
+func TestView_ClosedViewSavesNothing(t *testing.T) {
+	store := New()
+	ids := fillStore(t, store, 10)
+
+	v := store.OpenView()
+	v.Close()
+	if err := store.Delete(context.Background(), ids[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	for _, saved := range v.saved {
+		if len(saved) != 0 {
+			t.Fatal("closed view saved a session")
+		}
+	}
+	if len(store.views) != 0 {
+		t.Errorf("%d views open after Close", len(store.views))
+	}
+}
+
+func TestView_ConcurrentWriters(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	ids := fillStore(t, store, 1000)
+
+	v := store.OpenView()
+	defer v.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(ids); i += 4 {
+				if i%2 == 0 {
+					_ = store.Delete(ctx, ids[i])
+				} else {
+					_ = store.Touch(ctx, ids[i], "192.0.2.1", "test")
+				}
+				s, _ := domain.NewSession(fmt.Sprintf("new-%d", i))
+				_ = store.Create(ctx, s)
+			}
+		}(w)
+	}
+
+	got := scanView(t, v)
+	wg.Wait()
+
+	if len(got) != len(ids) {
+		t.Fatalf("view has %d sessions, want %d", len(got), len(ids))
+	}
+	for _, id := range ids {
+		if s, ok := got[id]; !ok || s.LastAccessIP != "" {
+			t.Fatalf("session %s = %+v, want its version when the view was opened", id, s)
+		}
+	}
+}
+
+func TestStore_Restore(t *testing.T) {
+	store := New(WithMaxSessionsPerUser(1))
+
+	a, _ := domain.NewSession("u1")
+	b, _ := domain.NewSession("u1")
+	invalid := &domain.Session{}
+
+	errs := store.Restore([]*domain.Session{a, b, invalid})
+	if errs[0] != nil {
+		t.Errorf("Restore a: %v", errs[0])
+	}
+	if errs[1] != domain.ErrSessionQuotaExceeded {
+		t.Errorf("Restore b = %v, want ErrSessionQuotaExceeded", errs[1])
+	}
+	if errs[2] == nil {
+		t.Error("Restore of an invalid session should fail")
+	}
+	if got, err := store.Get(context.Background(), a.ID); err != nil || got.ID != a.ID {
+		t.Errorf("Get = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/yndnr/tokmesh-go/internal/storage/archive"
+)
+
+// Stats is a point-in-time view of the storage engine.
+type Stats struct {
+	// Sessions is the number of sessions in memory.
+	Sessions int
+
+	// WALSizeBytes is the total size of the WAL segment files, 0 with
+	// the Badger backend.
+	WALSizeBytes int64
+
+	// LastSnapshot is when the latest snapshot was taken or loaded;
+	// zero if there is none.
+	LastSnapshot time.Time
+
+	// Archive describes the shipping to the archive, nil unless
+	// archiving.
+	Archive *archive.Stats
+}
+
+// Stats returns the engine's current statistics.
+func (e *Engine) Stats() Stats {
+	s := Stats{Sessions: e.store.Count()}
+	if e.wal != nil {
+		if size, err := e.wal.Size(); err == nil {
+			s.WALSizeBytes = size
+		}
+	}
+	if ms := e.lastSnapshot.Load(); ms > 0 {
+		s.LastSnapshot = time.UnixMilli(ms)
+	}
+	if e.archive != nil {
+		st := e.archive.Stats()
+		s.Archive = &st
+	}
+	return s
+}
+
+// newFsyncHistogram returns the WAL fsync latency histogram, with
+// buckets from 50µs to about 1.6s.
+func newFsyncHistogram() prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tokmesh",
+		Subsystem: "wal",
+		Name:      "fsync_duration_seconds",
+		Help:      "Duration of WAL segment fsyncs in seconds.",
+		Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 16),
+	})
+}
+
+// newCommitHistograms returns the histograms of the number of entries
+// made durable by each WAL group commit (1 to 4096) and of the group
+// commit latency.
+func newCommitHistograms() (batch, seconds prometheus.Histogram) {
+	batch = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tokmesh",
+		Subsystem: "wal",
+		Name:      "group_commit_entries",
+		Help:      "Number of WAL entries made durable by each group commit.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 13),
+	})
+	seconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tokmesh",
+		Subsystem: "wal",
+		Name:      "group_commit_duration_seconds",
+		Help:      "Duration of WAL group commits (write and fsync) in seconds.",
+		Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 16),
+	})
+	return batch, seconds
+}
+
+// Collectors returns the engine's Prometheus collectors: active sessions,
+// WAL size, fsync latency and group commits, the time of the latest
+// snapshot, and archive shipping when archiving.
+func (e *Engine) Collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "tokmesh",
+			Name:      "sessions_active",
+			Help:      "Number of sessions held by the storage engine.",
+		}, func() float64 {
+			return float64(e.store.Count())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "tokmesh",
+			Subsystem: "wal",
+			Name:      "size_bytes",
+			Help:      "Total size of the WAL segment files in bytes.",
+		}, func() float64 {
+			return float64(e.Stats().WALSizeBytes)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "tokmesh",
+			Subsystem: "snapshot",
+			Name:      "last_timestamp_seconds",
+			Help:      "Unix time of the latest snapshot taken or loaded, 0 if none.",
+		}, func() float64 {
+			return float64(e.lastSnapshot.Load()) / 1000
+		}),
+		e.fsyncSeconds,
+		e.commitEntries,
+		e.commitSeconds,
+	}
+	if e.archive != nil {
+		collectors = append(collectors, e.archive.Collectors()...)
+	}
+	return collectors
+}
@@ -0,0 +1,407 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/memory"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+// pitrProgressInterval is how many replayed entries RecoverToPoint
+// reports progress and checks for cancellation after.
+const pitrProgressInterval = 1000
+
+// RecoveryTarget is the point RecoverToPoint recovers to. If both Time
+// and Offset are set, replay stops at whichever comes first.
+type RecoveryTarget struct {
+	// Time stops replay at the first WAL entry logged after it.
+	Time time.Time
+
+	// Offset stops replay at this composite WAL offset: only entries
+	// ending at or before it are applied.
+	Offset uint64
+}
+
+// IsZero reports whether no target is set.
+func (t RecoveryTarget) IsZero() bool {
+	return t.Time.IsZero() && t.Offset == 0
+}
+
+// past reports whether an entry logged at ts (Unix milliseconds) and
+// ending at the composite offset end lies past the target.
+func (t RecoveryTarget) past(end uint64, ts int64) bool {
+	if t.Offset != 0 && end > t.Offset {
+		return true
+	}
+	return !t.Time.IsZero() && ts > t.Time.UnixMilli()
+}
+
+// allows reports whether a snapshot precedes the target, so recovery can
+// start from it.
+func (t RecoveryTarget) allows(info *snapshot.Info) bool {
+	if t.Offset != 0 && info.WALLastOffset > t.Offset {
+		return false
+	}
+	return t.Time.IsZero() || info.CreatedAt <= t.Time.UnixMilli()
+}
+
+// PointInTimeConfig configures RecoverToPoint.
+type PointInTimeConfig struct {
+	// DataDir is the data directory to recover from. WALDir and
+	// SnapshotDir default to the engine's directories under it.
+	DataDir     string
+	WALDir      string
+	SnapshotDir string
+
+	// WALArchiveDir holds the segments archived by compaction (see
+	// Config.WALArchiveDir). They are replayed along with the WAL.
+	WALArchiveDir string
+
+	// Cipher decrypts the snapshots and WAL, and encrypts the output.
+	Cipher adaptive.Cipher
+
+	// NodeID is recorded in the output snapshot.
+	NodeID string
+
+	// MaxSessionsPerUser is the session quota applied while replaying.
+	MaxSessionsPerUser int
+
+	// Target is the point to recover to.
+	Target RecoveryTarget
+
+	// OutputDataDir, if set, is a new data directory that receives the
+	// recovered state as its only snapshot, for a server to start from.
+	OutputDataDir string
+
+	// OutputSnapshotDir, if set, receives the recovered state as a new
+	// snapshot covering the WAL up to the target. It must not be the
+	// snapshot directory recovered from: on startup, the server would
+	// load the snapshot and replay the entries after the target again.
+	OutputSnapshotDir string
+
+	// Logger is the structured logger.
+	Logger *slog.Logger
+}
+
+// PointInTimeResult describes a point-in-time recovery.
+type PointInTimeResult struct {
+	// BaseSnapshot is the ID of the snapshot recovery started from, and
+	// BaseWALOffset the WAL offset it covers. BaseSnapshot is empty when
+	// the WAL was replayed from its start.
+	BaseSnapshot  string `json:"base_snapshot,omitempty"`
+	BaseWALOffset uint64 `json:"base_wal_offset"`
+
+	// EntriesApplied counts the WAL entries replayed, and LastTimestamp
+	// is the timestamp of the last of them (Unix milliseconds).
+	EntriesApplied int   `json:"entries_applied"`
+	LastTimestamp  int64 `json:"last_timestamp,omitempty"`
+
+	// StopOffset is the composite WAL offset the recovered state covers.
+	StopOffset uint64 `json:"stop_offset"`
+
+	// TargetReached is false when the WAL ended before the target.
+	TargetReached bool `json:"target_reached"`
+
+	SessionCount int            `json:"session_count"`
+	Snapshot     *snapshot.Info `json:"snapshot"`
+}
+
+// RecoverToPoint rebuilds the sessions as they were at a point in time:
+// it loads the latest snapshot preceding the target, replays the WAL
+// (and archived segments) from its offset up to the target, and writes
+// the result to OutputDataDir or OutputSnapshotDir. The data recovered
+// from is only read.
+//
+// progress, if not nil, is called with the number of entries replayed so
+// far.
+//
+// @design DS-0102
+func RecoverToPoint(ctx context.Context, cfg PointInTimeConfig, progress func(applied int)) (*PointInTimeResult, error) {
+	if err := cfg.setDefaults(); err != nil {
+		return nil, err
+	}
+	log := cfg.Logger
+
+	var storeOpts []memory.Option
+	if cfg.MaxSessionsPerUser > 0 {
+		storeOpts = append(storeOpts, memory.WithMaxSessionsPerUser(cfg.MaxSessionsPerUser))
+	}
+	store := memory.New(storeOpts...)
+	result := &PointInTimeResult{}
+
+	// Step 1: Load the latest snapshot preceding the target
+	base, err := cfg.baseSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		_, err := base.mgr.LoadFileInto(base.info.Path, func(sessions []*domain.Session) error {
+			for i, err := range store.Restore(sessions) {
+				if err != nil {
+					log.Warn("failed to restore session from snapshot",
+						"session_id", sessions[i].ID,
+						"error", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("storage: load snapshot %s: %w", base.info.ID, err)
+		}
+		result.BaseSnapshot = base.info.ID
+		result.BaseWALOffset = base.info.WALLastOffset
+		log.Info("pitr base snapshot loaded",
+			"id", base.info.ID,
+			"session_count", base.info.SessionCount,
+			"wal_last_offset", base.info.WALLastOffset)
+	}
+	result.StopOffset = result.BaseWALOffset
+
+	// Step 2: Replay the WAL up to the target
+	if err := cfg.replay(ctx, store, result, progress); err != nil {
+		return nil, err
+	}
+	result.SessionCount = store.Count()
+
+	// Step 3: Write the recovered state
+	info, err := cfg.write(store, result.StopOffset)
+	if err != nil {
+		return nil, err
+	}
+	result.Snapshot = info
+
+	log.Info("pitr completed",
+		"base_snapshot", result.BaseSnapshot,
+		"entries_applied", result.EntriesApplied,
+		"stop_offset", result.StopOffset,
+		"target_reached", result.TargetReached,
+		"session_count", result.SessionCount,
+		"output", info.Path)
+	return result, nil
+}
+
+// setDefaults validates cfg and fills in the source directories.
+func (cfg *PointInTimeConfig) setDefaults() error {
+	if cfg.Target.IsZero() {
+		return fmt.Errorf("storage: pitr target time or offset is required")
+	}
+	if (cfg.OutputDataDir == "") == (cfg.OutputSnapshotDir == "") {
+		return fmt.Errorf("storage: exactly one of pitr output data dir and output snapshot dir is required")
+	}
+	if cfg.WALDir == "" || cfg.SnapshotDir == "" {
+		if cfg.DataDir == "" {
+			return fmt.Errorf("storage: data_dir is required")
+		}
+		defaults := DefaultConfig(cfg.DataDir)
+		if cfg.WALDir == "" {
+			cfg.WALDir = defaults.WAL.Dir
+		}
+		if cfg.SnapshotDir == "" {
+			cfg.SnapshotDir = defaults.Snapshot.Dir
+		}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	if cfg.OutputDataDir != "" {
+		entries, err := os.ReadDir(cfg.OutputDataDir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("storage: pitr output: %w", err)
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("storage: pitr output data dir %s is not empty", cfg.OutputDataDir)
+		}
+	}
+	if cfg.OutputSnapshotDir != "" && samePath(cfg.OutputSnapshotDir, cfg.SnapshotDir) {
+		return fmt.Errorf("storage: pitr output snapshot dir must not be the snapshot dir recovered from")
+	}
+	return nil
+}
+
+// samePath reports whether a and b name the same directory.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// baseSnapshot is the snapshot a point-in-time recovery starts from.
+type baseSnapshot struct {
+	mgr  *snapshot.Manager
+	info *snapshot.Info
+}
+
+// baseSnapshot returns the latest valid snapshot preceding the target,
+// or nil if there is none.
+func (cfg *PointInTimeConfig) baseSnapshot() (*baseSnapshot, error) {
+	if _, err := os.Stat(cfg.SnapshotDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	mgr, err := snapshot.NewManager(snapshot.Config{Dir: cfg.SnapshotDir, Cipher: cfg.Cipher})
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	listed, err := mgr.List()
+	if err != nil {
+		return nil, fmt.Errorf("storage: list snapshots: %w", err)
+	}
+
+	for i := len(listed) - 1; i >= 0; i-- {
+		info, err := mgr.ReadInfo(listed[i].Path)
+		if err != nil {
+			cfg.Logger.Warn("skipping unreadable snapshot", "id", listed[i].ID, "error", err)
+			continue
+		}
+		if !cfg.Target.allows(info) {
+			continue
+		}
+		if info.Encrypted && cfg.Cipher == nil {
+			return nil, fmt.Errorf("storage: snapshot %s is encrypted and no cipher is configured", info.ID)
+		}
+		return &baseSnapshot{mgr: mgr, info: info}, nil
+	}
+	return nil, nil
+}
+
+// replay applies the WAL entries after result.BaseWALOffset up to the
+// target to store, recording how far it got in result.
+func (cfg *PointInTimeConfig) replay(ctx context.Context, store *memory.Store, result *PointInTimeResult, progress func(int)) error {
+	var reader *wal.Reader
+	var err error
+	if cfg.WALArchiveDir != "" {
+		reader, err = wal.NewArchiveReader(cfg.WALDir, cfg.WALArchiveDir, cfg.Cipher)
+	} else {
+		reader, err = wal.NewReader(cfg.WALDir, cfg.Cipher)
+	}
+	if err != nil {
+		return fmt.Errorf("storage: open wal: %w", err)
+	}
+	defer reader.Close()
+
+	if err := checkSegmentChain(reader.SegmentIDs(), result.BaseWALOffset); err != nil {
+		return err
+	}
+	if err := reader.Seek(result.BaseWALOffset); err != nil {
+		return fmt.Errorf("storage: seek wal: %w", err)
+	}
+
+	for {
+		entry, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("storage: read wal: %w", err)
+		}
+
+		end := reader.Offset()
+		if cfg.Target.past(end, entry.Timestamp) {
+			result.TargetReached = true
+			break
+		}
+
+		if err := applyWALEntry(ctx, store, entry); err != nil {
+			cfg.Logger.Warn("apply wal entry failed",
+				"type", entry.OpType,
+				"session_id", entry.SessionID,
+				"error", err)
+		}
+		result.EntriesApplied++
+		result.LastTimestamp = entry.Timestamp
+		result.StopOffset = end
+
+		if result.EntriesApplied%pitrProgressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(result.EntriesApplied)
+			}
+		}
+	}
+
+	if cfg.Target.Offset != 0 && result.StopOffset == cfg.Target.Offset {
+		result.TargetReached = true
+	}
+	if progress != nil {
+		progress(result.EntriesApplied)
+	}
+	return nil
+}
+
+// checkSegmentChain fails if a WAL segment needed to replay from the
+// composite offset from is missing, e.g. compacted without an archive.
+func checkSegmentChain(ids []uint64, from uint64) error {
+	next := max(from>>32, 1)
+	for _, id := range ids {
+		if id < next {
+			continue
+		}
+		if id != next {
+			return fmt.Errorf("storage: WAL segments %d to %d are missing (compacted without storage.wal_archive_dir?)", next, id-1)
+		}
+		next++
+	}
+	return nil
+}
+
+// write writes the recovered sessions to the configured output.
+func (cfg *PointInTimeConfig) write(store *memory.Store, stopOffset uint64) (*snapshot.Info, error) {
+	dir := cfg.OutputSnapshotDir
+	walOffset := stopOffset
+	if cfg.OutputDataDir != "" {
+		// The new data directory starts a new WAL, replayed from its
+		// start.
+		dir = DefaultConfig(cfg.OutputDataDir).Snapshot.Dir
+		walOffset = 0
+	}
+
+	mgr, err := snapshot.NewManager(snapshot.Config{Dir: dir, Cipher: cfg.Cipher, NodeID: cfg.NodeID})
+	if err != nil {
+		return nil, fmt.Errorf("storage: pitr output: %w", err)
+	}
+
+	info, err := mgr.CreateFrom(store.Scan, walOffset)
+	if err != nil {
+		return nil, fmt.Errorf("storage: write pitr snapshot: %w", err)
+	}
+	return info, nil
+}
+
+// RecoverToPoint recovers the sessions as they were at cfg.Target from
+// the engine's snapshots and WAL, including archived segments, into
+// cfg's output (see the RecoverToPoint function). The engine's data is
+// not changed.
+func (e *Engine) RecoverToPoint(ctx context.Context, cfg PointInTimeConfig, progress func(applied int)) (*PointInTimeResult, error) {
+	if e.wal == nil {
+		return nil, fmt.Errorf("storage: point-in-time recovery requires the %s backend", BackendWAL)
+	}
+
+	// Include the entries still buffered
+	if err := e.wal.Sync(); err != nil {
+		return nil, fmt.Errorf("storage: sync wal: %w", err)
+	}
+
+	cfg.DataDir = e.cfg.DataDir
+	cfg.WALDir = e.cfg.WAL.Dir
+	cfg.SnapshotDir = e.cfg.Snapshot.Dir
+	cfg.WALArchiveDir = e.cfg.WALArchiveDir
+	cfg.Cipher = e.cfg.Cipher
+	cfg.NodeID = e.cfg.NodeID
+	cfg.MaxSessionsPerUser = e.cfg.MaxSessionsPerUser
+	cfg.Logger = e.logger
+
+	return RecoverToPoint(ctx, cfg, progress)
+}
@@ -0,0 +1,389 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/archive"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// pitrFixture is an engine whose sessions "a" and "b" were created
+// before before, and which then revoked "a" and created "c".
+type pitrFixture struct {
+	engine *Engine
+	dir    string
+	before time.Time
+	offset uint64 // WAL offset at before
+}
+
+func newPITRFixture(t *testing.T, mutate func(*Config)) *pitrFixture {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := DefaultConfig(dir)
+	cfg.SnapshotInterval = time.Hour
+	cfg.WAL.SyncMode = wal.SyncModeGroup
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	create := func(id string) {
+		s, _ := domain.NewSession("pitr_user")
+		s.ID = id
+		s.TokenHash = "pitr_hash_" + id
+		s.SetExpiration(time.Hour)
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+
+	create("a")
+	create("b")
+	time.Sleep(5 * time.Millisecond)
+	f := &pitrFixture{engine: engine, dir: dir, before: time.Now(), offset: engine.wal.CurrentOffset()}
+	time.Sleep(5 * time.Millisecond)
+
+	if err := engine.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	create("c")
+	return f
+}
+
+// snapshotIDs loads the snapshot described by info and returns its
+// session IDs, sorted.
+func snapshotIDs(t *testing.T, info *snapshot.Info) string {
+	t.Helper()
+	mgr, err := snapshot.NewManager(snapshot.Config{Dir: filepath.Dir(info.Path)})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	sessions, _, err := mgr.LoadFile(info.Path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	return sortedJoin(ids)
+}
+
+func sortedJoin(ids []string) string {
+	for i := 1; i < len(ids); i++ {
+		for j := i; j > 0 && ids[j] < ids[j-1]; j-- {
+			ids[j], ids[j-1] = ids[j-1], ids[j]
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRecoverToPoint_Time(t *testing.T) {
+	f := newPITRFixture(t, nil)
+	ctx := context.Background()
+
+	// A snapshot after the target is not a valid base.
+	if _, err := f.engine.TriggerSnapshot(ctx); err != nil {
+		t.Fatalf("TriggerSnapshot: %v", err)
+	}
+
+	out := t.TempDir()
+	res, err := f.engine.RecoverToPoint(ctx, PointInTimeConfig{
+		Target:            RecoveryTarget{Time: f.before},
+		OutputSnapshotDir: out,
+	}, nil)
+	if err != nil {
+		t.Fatalf("RecoverToPoint: %v", err)
+	}
+
+	if res.BaseSnapshot != "" {
+		t.Errorf("BaseSnapshot = %q, want none", res.BaseSnapshot)
+	}
+	if !res.TargetReached {
+		t.Error("TargetReached = false")
+	}
+	if res.EntriesApplied != 2 || res.SessionCount != 2 {
+		t.Errorf("EntriesApplied = %d, SessionCount = %d, want 2, 2", res.EntriesApplied, res.SessionCount)
+	}
+	if res.StopOffset != f.offset {
+		t.Errorf("StopOffset = %x, want %x", res.StopOffset, f.offset)
+	}
+	if got := snapshotIDs(t, res.Snapshot); got != "a,b" {
+		t.Errorf("sessions = %s, want a,b", got)
+	}
+	if res.Snapshot.WALLastOffset != f.offset {
+		t.Errorf("snapshot WALLastOffset = %x, want %x", res.Snapshot.WALLastOffset, f.offset)
+	}
+}
+
+func TestRecoverToPoint_OffsetFromSnapshot(t *testing.T) {
+	f := newPITRFixture(t, nil)
+	ctx := context.Background()
+
+	// Snapshot "b" and "c", then revoke "b"
+	snap, err := f.engine.TriggerSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("TriggerSnapshot: %v", err)
+	}
+	target := f.engine.wal.CurrentOffset()
+	if err := f.engine.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	out := t.TempDir()
+	res, err := f.engine.RecoverToPoint(ctx, PointInTimeConfig{
+		Target:            RecoveryTarget{Offset: target},
+		OutputSnapshotDir: out,
+	}, nil)
+	if err != nil {
+		t.Fatalf("RecoverToPoint: %v", err)
+	}
+	if res.BaseSnapshot != snap.ID {
+		t.Errorf("BaseSnapshot = %q, want %q", res.BaseSnapshot, snap.ID)
+	}
+	if res.EntriesApplied != 0 || !res.TargetReached {
+		t.Errorf("EntriesApplied = %d, TargetReached = %v, want 0, true", res.EntriesApplied, res.TargetReached)
+	}
+	if got := snapshotIDs(t, res.Snapshot); got != "b,c" {
+		t.Errorf("sessions = %s, want b,c", got)
+	}
+}
+
+func TestRecoverToPoint_OutputDataDir(t *testing.T) {
+	f := newPITRFixture(t, nil)
+	ctx := context.Background()
+
+	out := filepath.Join(t.TempDir(), "restored")
+	if _, err := f.engine.RecoverToPoint(ctx, PointInTimeConfig{
+		Target:        RecoveryTarget{Time: f.before},
+		OutputDataDir: out,
+	}, nil); err != nil {
+		t.Fatalf("RecoverToPoint: %v", err)
+	}
+
+	// A server started on the new data directory has the old state, and
+	// keeps its writes across restarts.
+	open := func() *Engine {
+		cfg := DefaultConfig(out)
+		cfg.SnapshotInterval = time.Hour
+		engine, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if err := engine.Recover(ctx); err != nil {
+			t.Fatalf("Recover: %v", err)
+		}
+		return engine
+	}
+	restored := open()
+	if _, err := restored.Get(ctx, "a"); err != nil {
+		t.Errorf("Get(a): %v", err)
+	}
+	if err := restored.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	restored.Close()
+
+	restored = open()
+	defer restored.Close()
+	if n := restored.Count(ctx); n != 1 {
+		t.Errorf("Count = %d, want 1", n)
+	}
+
+	// The output must be a new directory
+	_, err := f.engine.RecoverToPoint(ctx, PointInTimeConfig{
+		Target:        RecoveryTarget{Time: f.before},
+		OutputDataDir: out,
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Errorf("RecoverToPoint into a used data dir: err = %v", err)
+	}
+}
+
+func TestRecoverToPoint_Archive(t *testing.T) {
+	run := func(t *testing.T, archive bool) error {
+		archiveDir := ""
+		f := newPITRFixture(t, func(cfg *Config) {
+			cfg.WAL.MaxEntryCount = 1
+			if archive {
+				archiveDir = filepath.Join(cfg.DataDir, "archive")
+				cfg.WALArchiveDir = archiveDir
+			}
+		})
+		ctx := context.Background()
+
+		// Enough segments for compaction to remove the first ones
+		for i := 0; i < 5; i++ {
+			s, _ := domain.NewSession("filler")
+			s.SetExpiration(time.Hour)
+			if err := f.engine.Create(ctx, s); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		if _, err := f.engine.TriggerSnapshot(ctx); err != nil {
+			t.Fatalf("TriggerSnapshot: %v", err)
+		}
+		count, err := wal.NewCompactor(DefaultConfig(f.dir).WAL.Dir).FileCount()
+		if err != nil || count != wal.DefaultRetainCount {
+			t.Fatalf("WAL segments after compaction = %d (%v), want %d", count, err, wal.DefaultRetainCount)
+		}
+
+		res, err := f.engine.RecoverToPoint(ctx, PointInTimeConfig{
+			Target:            RecoveryTarget{Time: f.before},
+			OutputSnapshotDir: t.TempDir(),
+		}, nil)
+		if err != nil {
+			return err
+		}
+		if got := snapshotIDs(t, res.Snapshot); got != "a,b" {
+			t.Errorf("sessions = %s, want a,b", got)
+		}
+		return nil
+	}
+
+	t.Run("archived", func(t *testing.T) {
+		if err := run(t, true); err != nil {
+			t.Fatalf("RecoverToPoint: %v", err)
+		}
+	})
+	t.Run("deleted", func(t *testing.T) {
+		err := run(t, false)
+		if err == nil || !strings.Contains(err.Error(), "missing") {
+			t.Fatalf("RecoverToPoint without archive: err = %v, want missing segments", err)
+		}
+	})
+}
+
+func TestRecoverToPoint_Validation(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  PointInTimeConfig
+		want string
+	}{
+		{"no target", PointInTimeConfig{DataDir: dir, OutputDataDir: t.TempDir()}, "target"},
+		{"no output", PointInTimeConfig{DataDir: dir, Target: RecoveryTarget{Offset: 1 << 32}}, "output"},
+		{"source snapshot dir", PointInTimeConfig{
+			DataDir:           dir,
+			Target:            RecoveryTarget{Offset: 1 << 32},
+			OutputSnapshotDir: DefaultConfig(dir).Snapshot.Dir,
+		}, "must not be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RecoverToPoint(context.Background(), tt.cfg, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// unreachableTarget fails every upload.
+type unreachableTarget struct {
+	archive.Target
+}
+
+func (unreachableTarget) Put(context.Context, string, io.Reader, int64) error {
+	return errors.New("connection refused")
+}
+
+func TestEngine_Archive(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("compaction keeps unshipped segments", func(t *testing.T) {
+		dir, _ := archive.NewDirTarget(t.TempDir())
+		f := newPITRFixture(t, func(cfg *Config) {
+			cfg.WAL.MaxEntryCount = 1
+			cfg.Archive = &archive.Config{Target: unreachableTarget{dir}, ScanInterval: time.Hour}
+		})
+		if err := f.engine.archive.Ship(ctx); err == nil {
+			t.Fatal("Ship to an unreachable target should fail")
+		}
+		walDir := DefaultConfig(f.dir).WAL.Dir
+		before, _ := wal.NewCompactor(walDir).FileCount()
+		if _, err := f.engine.TriggerSnapshot(ctx); err != nil {
+			t.Fatalf("TriggerSnapshot: %v", err)
+		}
+		if after, _ := wal.NewCompactor(walDir).FileCount(); after != before {
+			t.Errorf("WAL segments after compaction = %d, want %d", after, before)
+		}
+		if st := f.engine.Stats().Archive; st == nil || st.Failures == 0 {
+			t.Errorf("Stats().Archive = %+v", st)
+		}
+	})
+
+	t.Run("restore for recovery", func(t *testing.T) {
+		target, _ := archive.NewDirTarget(t.TempDir())
+		f := newPITRFixture(t, func(cfg *Config) {
+			cfg.WAL.MaxEntryCount = 1
+			cfg.Archive = &archive.Config{Target: target, ScanInterval: time.Hour}
+		})
+		if _, err := f.engine.TriggerSnapshot(ctx); err != nil {
+			t.Fatalf("TriggerSnapshot: %v", err)
+		}
+		// A segment sealed after the snapshot is shipped too
+		s, _ := domain.NewSession("pitr_user")
+		s.SetExpiration(time.Hour)
+		if err := f.engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := f.engine.Delete(ctx, "b"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if err := f.engine.archive.Ship(ctx); err != nil {
+			t.Fatalf("Ship: %v", err)
+		}
+
+		restored := filepath.Join(t.TempDir(), "restored")
+		rcfg := DefaultConfig(restored)
+		if _, err := archive.Restore(ctx, target, archive.RestoreOptions{WALDir: rcfg.WAL.Dir, SnapshotDir: rcfg.Snapshot.Dir}); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+
+		// Point-in-time recovery from the restored archive
+		res, err := RecoverToPoint(ctx, PointInTimeConfig{
+			DataDir:           restored,
+			Target:            RecoveryTarget{Time: f.before},
+			OutputSnapshotDir: t.TempDir(),
+		}, nil)
+		if err != nil {
+			t.Fatalf("RecoverToPoint: %v", err)
+		}
+		if got := snapshotIDs(t, res.Snapshot); got != "a,b" {
+			t.Errorf("sessions at the target = %s, want a,b", got)
+		}
+
+		// Recover of the restored data directory
+		rcfg.SnapshotInterval = time.Hour
+		engine, err := New(rcfg)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		defer engine.Close()
+		if err := engine.Recover(ctx); err != nil {
+			t.Fatalf("Recover: %v", err)
+		}
+		if _, err := engine.Get(ctx, s.ID); err != nil {
+			t.Errorf("session shipped after the snapshot: %v", err)
+		}
+		if n := engine.Count(ctx); n != 3 {
+			t.Errorf("Count = %d, want 3 (the deletion is in the active segment)", n)
+		}
+	})
+}
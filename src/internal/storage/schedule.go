@@ -0,0 +1,426 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default snapshot policy values.
+const (
+	DefaultSnapshotMaxWALBytes   = 256 << 20
+	DefaultSnapshotMaxWALEntries = 1_000_000
+	DefaultSnapshotCheckInterval = 10 * time.Second
+	DefaultSnapshotHighWriteRate = 20_000
+	DefaultSnapshotMaxDefer      = 5 * time.Minute
+
+	// snapshotPruneInterval is how often snapshots are pruned between
+	// snapshots, so RetentionDays applies on an idle node.
+	snapshotPruneInterval = time.Hour
+
+	// snapshotTimeout bounds a snapshot taken by the engine.
+	snapshotTimeout = 30 * time.Second
+)
+
+// Snapshot triggers, reported in SnapshotRun and SnapshotDecision.
+const (
+	TriggerManual     = "manual"
+	TriggerWALBytes   = "wal_bytes"
+	TriggerWALEntries = "wal_entries"
+	TriggerMaxAge     = "max_age"
+	TriggerShutdown   = "shutdown"
+)
+
+// Scheduling decisions, reported in SnapshotDecision.
+const (
+	DecisionSnapshot = "snapshot"
+	DecisionDefer    = "defer"
+)
+
+// SnapshotPolicy decides when the engine takes snapshots with the WAL
+// backend, besides Config.SnapshotInterval. A zero threshold disables
+// its trigger.
+type SnapshotPolicy struct {
+	// MaxWALBytes triggers a snapshot once the WAL holds this many bytes
+	// past the latest snapshot.
+	MaxWALBytes int64
+
+	// MaxWALEntries triggers a snapshot once this many entries were
+	// logged since the latest snapshot.
+	MaxWALEntries int64
+
+	// CheckInterval is how often the triggers are evaluated; zero means
+	// DefaultSnapshotCheckInterval.
+	CheckInterval time.Duration
+
+	// HighWriteRate, in WAL entries per second, postpones a due snapshot
+	// while writes are faster, for at most MaxDefer. Zero never
+	// postpones.
+	HighWriteRate float64
+	MaxDefer      time.Duration
+
+	// OnShutdown takes a snapshot in Close if entries were logged since
+	// the latest one, so the next start need not replay them.
+	OnShutdown bool
+}
+
+// DefaultSnapshotPolicy returns the default snapshot policy, without
+// the shutdown snapshot.
+func DefaultSnapshotPolicy() SnapshotPolicy {
+	return SnapshotPolicy{
+		MaxWALBytes:   DefaultSnapshotMaxWALBytes,
+		MaxWALEntries: DefaultSnapshotMaxWALEntries,
+		CheckInterval: DefaultSnapshotCheckInterval,
+		HighWriteRate: DefaultSnapshotHighWriteRate,
+		MaxDefer:      DefaultSnapshotMaxDefer,
+	}
+}
+
+// SnapshotDecision is a decision of the scheduler to take a snapshot,
+// or to postpone it.
+type SnapshotDecision struct {
+	At      time.Time
+	Action  string // DecisionSnapshot or DecisionDefer
+	Trigger string
+	Reason  string
+}
+
+// SnapshotRun reports a snapshot and the maintenance that follows it.
+type SnapshotRun struct {
+	Trigger string
+	Started time.Time
+
+	// Duration is the whole run: the snapshot, pruning the older
+	// snapshots and compacting the WAL behind the snapshot.
+	Duration time.Duration
+	Snapshot time.Duration
+	Prune    time.Duration
+	Compact  time.Duration
+
+	SessionCount int64
+	Size         int64
+	WALOffset    uint64
+
+	// Err is set if the snapshot failed.
+	Err string
+}
+
+// SnapshotSchedule reports the snapshot policy and its decisions.
+type SnapshotSchedule struct {
+	Policy SnapshotPolicy
+
+	// MaxAge is Config.SnapshotInterval: a snapshot older than this is
+	// replaced if entries were logged since.
+	MaxAge time.Duration
+
+	// WALBytes and WALEntries have been logged since the latest
+	// snapshot, WriteRate is in entries per second over the last check.
+	WALBytes   int64
+	WALEntries int64
+	WriteRate  float64
+
+	LastSnapshot time.Time
+	LastCheck    time.Time
+	NextCheck    time.Time
+
+	// DeferredSince is when a due snapshot was first postponed, zero if
+	// none is.
+	DeferredSince time.Time
+
+	LastDecision *SnapshotDecision
+	LastRun      *SnapshotRun
+
+	// Snapshots, Deferrals and Failures count the runs since the engine
+	// started.
+	Snapshots uint64
+	Deferrals uint64
+	Failures  uint64
+}
+
+// snapshotScheduler holds the state of the snapshot policy.
+type snapshotScheduler struct {
+	policy  SnapshotPolicy
+	maxAge  time.Duration
+	started time.Time
+
+	mu sync.Mutex
+
+	// entryBase is the writer's Appended count at the latest snapshot,
+	// less the entries replayed at recovery.
+	entryBase int64
+
+	lastCheck     time.Time
+	lastAppended  uint64
+	rate          float64
+	deferredSince time.Time
+	lastPrune     time.Time
+
+	decision  *SnapshotDecision
+	run       *SnapshotRun
+	snapshots uint64
+	deferrals uint64
+	failures  uint64
+}
+
+func newSnapshotScheduler(policy SnapshotPolicy, maxAge time.Duration) *snapshotScheduler {
+	if policy.CheckInterval <= 0 {
+		policy.CheckInterval = DefaultSnapshotCheckInterval
+	}
+	now := time.Now()
+	return &snapshotScheduler{policy: policy, maxAge: maxAge, started: now, lastPrune: now}
+}
+
+// checkInterval returns how often the triggers are evaluated, often
+// enough for the maximum age.
+func (s *snapshotScheduler) checkInterval() time.Duration {
+	if s.maxAge > 0 {
+		return min(s.policy.CheckInterval, s.maxAge)
+	}
+	return s.policy.CheckInterval
+}
+
+// recovered counts the entries replayed at recovery as logged since the
+// latest snapshot.
+func (s *snapshotScheduler) recovered(entries int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entryBase -= int64(entries)
+}
+
+// entriesSince returns the entries logged since the latest snapshot,
+// given the writer's Appended count.
+func (s *snapshotScheduler) entriesSince(appended uint64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(appended) - s.entryBase
+}
+
+// decide evaluates the triggers with the WAL bytes since the latest
+// snapshot and the writer's Appended count. It returns the decision to
+// take or postpone a snapshot, or nil if none is due.
+func (s *snapshotScheduler) decide(now time.Time, walBytes int64, appended uint64, lastSnapshot time.Time) *SnapshotDecision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastCheck.IsZero() {
+		if elapsed := now.Sub(s.lastCheck).Seconds(); elapsed > 0 {
+			s.rate = float64(appended-s.lastAppended) / elapsed
+		}
+	}
+	s.lastCheck, s.lastAppended = now, appended
+
+	trigger, reason := s.due(now, walBytes, int64(appended)-s.entryBase, lastSnapshot)
+	if trigger == "" {
+		s.deferredSince = time.Time{}
+		return nil
+	}
+
+	p := s.policy
+	if p.HighWriteRate > 0 && s.rate > p.HighWriteRate {
+		if s.deferredSince.IsZero() {
+			s.deferredSince = now
+		}
+		if now.Sub(s.deferredSince) < p.MaxDefer {
+			s.deferrals++
+			s.decision = &SnapshotDecision{
+				At:      now,
+				Action:  DecisionDefer,
+				Trigger: trigger,
+				Reason:  fmt.Sprintf("%s; write rate %.0f/s above %.0f/s", reason, s.rate, p.HighWriteRate),
+			}
+			return s.decision
+		}
+		reason = fmt.Sprintf("%s; deferred for %s", reason, now.Sub(s.deferredSince).Round(time.Second))
+	}
+
+	s.deferredSince = time.Time{}
+	s.decision = &SnapshotDecision{At: now, Action: DecisionSnapshot, Trigger: trigger, Reason: reason}
+	return s.decision
+}
+
+// due returns the first trigger reached and why, or "".
+func (s *snapshotScheduler) due(now time.Time, walBytes, walEntries int64, lastSnapshot time.Time) (string, string) {
+	p := s.policy
+	if p.MaxWALBytes > 0 && walBytes >= p.MaxWALBytes {
+		return TriggerWALBytes, fmt.Sprintf("%d WAL bytes since the last snapshot, threshold %d", walBytes, p.MaxWALBytes)
+	}
+	if p.MaxWALEntries > 0 && walEntries >= p.MaxWALEntries {
+		return TriggerWALEntries, fmt.Sprintf("%d WAL entries since the last snapshot, threshold %d", walEntries, p.MaxWALEntries)
+	}
+	if s.maxAge > 0 && walEntries > 0 {
+		since := lastSnapshot
+		if since.IsZero() {
+			since = s.started
+		}
+		if age := now.Sub(since); age >= s.maxAge {
+			return TriggerMaxAge, fmt.Sprintf("last snapshot %s old, maximum %s", age.Round(time.Second), s.maxAge)
+		}
+	}
+	return "", ""
+}
+
+// decideShutdown records the decision of a shutdown snapshot.
+func (s *snapshotScheduler) decideShutdown(now time.Time, walEntries int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decision = &SnapshotDecision{
+		At:      now,
+		Action:  DecisionSnapshot,
+		Trigger: TriggerShutdown,
+		Reason:  fmt.Sprintf("%d WAL entries since the last snapshot at shutdown", walEntries),
+	}
+}
+
+// finish records a snapshot run. appended is the writer's Appended
+// count when the snapshot started.
+func (s *snapshotScheduler) finish(run *SnapshotRun, appended uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = run
+	if run.Err != "" {
+		s.failures++
+		return
+	}
+	s.snapshots++
+	s.entryBase = int64(appended)
+	s.lastPrune = run.Started
+}
+
+// pruneDue reports whether the snapshots are due for pruning, and if so
+// resets the prune interval.
+func (s *snapshotScheduler) pruneDue(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPrune) < snapshotPruneInterval {
+		return false
+	}
+	s.lastPrune = now
+	return true
+}
+
+// status returns the scheduler's part of a SnapshotSchedule.
+func (s *snapshotScheduler) status() *SnapshotSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &SnapshotSchedule{
+		Policy:        s.policy,
+		MaxAge:        s.maxAge,
+		WriteRate:     s.rate,
+		LastCheck:     s.lastCheck,
+		DeferredSince: s.deferredSince,
+		Snapshots:     s.snapshots,
+		Deferrals:     s.deferrals,
+		Failures:      s.failures,
+	}
+	if !s.lastCheck.IsZero() {
+		st.NextCheck = s.lastCheck.Add(s.checkInterval())
+	}
+	if s.decision != nil {
+		d := *s.decision
+		st.LastDecision = &d
+	}
+	if s.run != nil {
+		r := *s.run
+		st.LastRun = &r
+	}
+	return st
+}
+
+// SnapshotSchedule returns the snapshot policy, what the WAL holds since
+// the latest snapshot, and the latest decision and snapshot run.
+func (e *Engine) SnapshotSchedule() (*SnapshotSchedule, error) {
+	if e.wal == nil {
+		return nil, ErrNoWAL
+	}
+
+	st := e.sched.status()
+	walBytes, err := e.walBytesSince(e.lastSnapshotOffset.Load())
+	if err != nil {
+		return nil, err
+	}
+	st.WALBytes = walBytes
+	st.WALEntries = e.sched.entriesSince(e.wal.Status().Appended)
+	if ms := e.lastSnapshot.Load(); ms > 0 {
+		st.LastSnapshot = time.UnixMilli(ms)
+	}
+	return st, nil
+}
+
+// checkSnapshot evaluates the snapshot policy, taking a snapshot if one
+// is due, or else pruning the snapshots if that is due.
+func (e *Engine) checkSnapshot(now time.Time) {
+	walBytes, err := e.walBytesSince(e.lastSnapshotOffset.Load())
+	if err != nil {
+		e.logger.Warn("snapshot policy check failed", "error", err)
+		return
+	}
+	var lastSnapshot time.Time
+	if ms := e.lastSnapshot.Load(); ms > 0 {
+		lastSnapshot = time.UnixMilli(ms)
+	}
+
+	d := e.sched.decide(now, walBytes, e.wal.Status().Appended, lastSnapshot)
+	switch {
+	case d == nil:
+		if e.sched.pruneDue(now) {
+			if err := e.snapshot.Prune(); err != nil {
+				e.logger.Warn("snapshot cleanup failed", "error", err)
+			}
+		}
+
+	case d.Action == DecisionDefer:
+		e.logger.Info("snapshot deferred", "trigger", d.Trigger, "reason", d.Reason)
+
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+		defer cancel()
+		if _, err := e.runSnapshot(ctx, d.Trigger); err != nil {
+			e.logger.Error("auto snapshot failed", "trigger", d.Trigger, "error", err)
+		}
+	}
+}
+
+// shutdownSnapshot takes a snapshot on shutdown if the policy asks for
+// one and entries were logged since the engine started and the latest
+// snapshot.
+func (e *Engine) shutdownSnapshot() {
+	if e.wal == nil || !e.cfg.SnapshotPolicy.OnShutdown {
+		return
+	}
+	// Entries only replayed at recovery are still in the WAL for the
+	// next start.
+	appended := e.wal.Status().Appended
+	entries := e.sched.entriesSince(appended)
+	if appended == 0 || entries <= 0 {
+		return
+	}
+
+	e.sched.decideShutdown(time.Now(), entries)
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	if _, err := e.runSnapshot(ctx, TriggerShutdown); err != nil {
+		e.logger.Error("shutdown snapshot failed", "error", err)
+	}
+}
+
+// walBytesSince returns the size of the WAL segments past the composite
+// offset.
+func (e *Engine) walBytesSince(offset uint64) (int64, error) {
+	segments, err := e.compactor().Segments()
+	if err != nil {
+		return 0, fmt.Errorf("storage: list wal segments: %w", err)
+	}
+	segID, segOff := offset>>32, int64(uint32(offset))
+	var n int64
+	for _, seg := range segments {
+		switch {
+		case seg.ID > segID:
+			n += seg.Size
+		case seg.ID == segID:
+			n += max(seg.Size-segOff, 0)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,191 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+)
+
+func TestSnapshotScheduler_Decide(t *testing.T) {
+	start := time.Now()
+	policy := SnapshotPolicy{MaxWALBytes: 1000, MaxWALEntries: 100, CheckInterval: time.Second}
+
+	tests := []struct {
+		name     string
+		walBytes int64
+		appended uint64
+		last     time.Time
+		want     string
+	}{
+		{"below thresholds", 999, 99, start, ""},
+		{"wal bytes", 1000, 1, start, TriggerWALBytes},
+		{"wal entries", 10, 100, start, TriggerWALEntries},
+		{"max age", 10, 1, start.Add(-2 * time.Hour), TriggerMaxAge},
+		{"max age without entries", 10, 0, start.Add(-2 * time.Hour), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSnapshotScheduler(policy, time.Hour)
+			d := s.decide(start, tt.walBytes, tt.appended, tt.last)
+			if tt.want == "" {
+				if d != nil {
+					t.Errorf("decide() = %+v, want none", d)
+				}
+				return
+			}
+			if d == nil || d.Action != DecisionSnapshot || d.Trigger != tt.want || d.Reason == "" {
+				t.Errorf("decide() = %+v, want a %s snapshot", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotScheduler_Backoff(t *testing.T) {
+	policy := SnapshotPolicy{MaxWALEntries: 100, HighWriteRate: 50, MaxDefer: time.Minute}
+	s := newSnapshotScheduler(policy, 0)
+	now := time.Now()
+
+	if d := s.decide(now, 0, 0, time.Time{}); d != nil {
+		t.Fatalf("first check = %+v", d)
+	}
+
+	// 1000 entries in 10s is above 50/s: the snapshot is postponed
+	now = now.Add(10 * time.Second)
+	d := s.decide(now, 0, 1000, time.Time{})
+	if d == nil || d.Action != DecisionDefer || d.Trigger != TriggerWALEntries {
+		t.Fatalf("under load = %+v, want defer", d)
+	}
+	if st := s.status(); st.Deferrals != 1 || !st.DeferredSince.Equal(now) || st.WriteRate != 100 {
+		t.Errorf("status = %+v", st)
+	}
+
+	// Still under load past MaxDefer: taken anyway
+	now = now.Add(time.Minute)
+	d = s.decide(now, 0, 10000, time.Time{})
+	if d == nil || d.Action != DecisionSnapshot {
+		t.Fatalf("past max defer = %+v, want snapshot", d)
+	}
+	if !s.status().DeferredSince.IsZero() {
+		t.Error("DeferredSince not reset")
+	}
+
+	// After the snapshot, entries are counted from its start
+	s.finish(&SnapshotRun{Trigger: d.Trigger, Started: now}, 10000)
+	if n := s.entriesSince(10050); n != 50 {
+		t.Errorf("entriesSince = %d, want 50", n)
+	}
+
+	// A failed run keeps counting from the previous snapshot
+	s.finish(&SnapshotRun{Started: now, Err: "disk full"}, 10050)
+	if st := s.status(); st.Snapshots != 1 || st.Failures != 1 || st.LastRun.Err != "disk full" {
+		t.Errorf("status = %+v", st)
+	}
+	if n := s.entriesSince(10060); n != 60 {
+		t.Errorf("entriesSince after a failure = %d, want 60", n)
+	}
+}
+
+func TestEngine_AdaptiveSnapshot(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig(t.TempDir())
+	cfg.SnapshotInterval = time.Hour
+	cfg.SnapshotPolicy = SnapshotPolicy{MaxWALEntries: 3, CheckInterval: 10 * time.Millisecond}
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer engine.Close()
+
+	for i := 0; i < 3; i++ {
+		s, _ := domain.NewSession("adaptive_user")
+		s.SetExpiration(time.Hour)
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for engine.lastSnapshot.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no snapshot after the entry threshold")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	st, err := engine.SnapshotSchedule()
+	if err != nil {
+		t.Fatalf("SnapshotSchedule: %v", err)
+	}
+	if st.LastDecision == nil || st.LastDecision.Trigger != TriggerWALEntries {
+		t.Errorf("LastDecision = %+v", st.LastDecision)
+	}
+	run := st.LastRun
+	if run == nil || run.Trigger != TriggerWALEntries || run.SessionCount != 3 || run.Duration < run.Snapshot || run.Err != "" {
+		t.Fatalf("LastRun = %+v", run)
+	}
+	if st.Snapshots != 1 || st.WALEntries != 0 || st.WALBytes != 0 || st.LastCheck.IsZero() {
+		t.Errorf("schedule = %+v", st)
+	}
+	if run.WALOffset != engine.lastSnapshotOffset.Load() {
+		t.Errorf("run offset %x, snapshot offset %x", run.WALOffset, engine.lastSnapshotOffset.Load())
+	}
+}
+
+func TestEngine_ShutdownSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := DefaultConfig(dir)
+	cfg.SnapshotInterval = time.Hour
+	cfg.SnapshotPolicy.OnShutdown = true
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	s, _ := domain.NewSession("shutdown_user")
+	s.SetExpiration(time.Hour)
+	if err := engine.Create(ctx, s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	infos, err := engine.snapshot.List()
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("snapshots after Close = %d, %v", len(infos), err)
+	}
+
+	// Nothing logged since: no second snapshot
+	engine, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := engine.Recover(ctx); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if infos, _ := engine.snapshot.List(); len(infos) != 1 {
+		t.Errorf("snapshots after an idle restart = %d, want 1", len(infos))
+	}
+}
+
+func TestEngine_SnapshotScheduleBadger(t *testing.T) {
+	cfg := DefaultConfig(t.TempDir())
+	cfg.Backend = BackendBadger
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer engine.Close()
+
+	if _, err := engine.SnapshotSchedule(); !errors.Is(err, ErrNoWAL) {
+		t.Errorf("SnapshotSchedule: err = %v, want ErrNoWAL", err)
+	}
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+)
+
+// sessionLockCount is the number of locks sessions are spread over.
+const sessionLockCount = 256
+
+// sessionLocks serializes the writes to each session on the WAL backend,
+// from the WAL append until the entry is in memory, so that the writes to
+// a session are logged in the order they are applied and an update
+// checked against memory before its append is still valid at its apply.
+type sessionLocks struct {
+	mu [sessionLockCount]sync.Mutex
+}
+
+// index returns the lock of a session ID (FNV-1a).
+func (l *sessionLocks) index(id string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return int(h % sessionLockCount)
+}
+
+// lock locks the session ID and returns the function that unlocks it.
+func (l *sessionLocks) lock(id string) func() {
+	m := &l.mu[l.index(id)]
+	m.Lock()
+	return m.Unlock
+}
+
+// lockAll locks the session IDs, in lock order so that batches do not
+// deadlock each other, and returns the function that unlocks them.
+func (l *sessionLocks) lockAll(ids []string) func() {
+	held := make([]int, 0, len(ids))
+	for _, id := range ids {
+		held = append(held, l.index(id))
+	}
+	slices.Sort(held)
+	held = slices.Compact(held)
+	for _, i := range held {
+		l.mu[i].Lock()
+	}
+	return func() {
+		for _, i := range held {
+			l.mu[i].Unlock()
+		}
+	}
+}
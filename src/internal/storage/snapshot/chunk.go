@@ -0,0 +1,286 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/codec"
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+// Chunk compression settings (Config.Compression).
+const (
+	CompressionZstd = "zstd"
+	CompressionNone = "none"
+)
+
+// DefaultChunkSize is the default uncompressed size of a data chunk.
+const DefaultChunkSize = 4 << 20
+
+const (
+	// chunkHeaderSize is CRC32(4) + Flags(1) + Count(4).
+	chunkHeaderSize = 9
+
+	// chunkFlagZstd marks a zstd-compressed chunk.
+	chunkFlagZstd = 1 << 0
+)
+
+// ErrCorruptChunk is returned for a chunk that fails its CRC or does not
+// decode. The file checksum is verified before chunks are read, so it
+// means the file changed while loading, or a bug.
+var ErrCorruptChunk = errors.New("snapshot: corrupt chunk")
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		return dec
+	})
+)
+
+// chunkCodec encodes and decodes the data chunks of a snapshot.
+type chunkCodec struct {
+	cipher   adaptive.Cipher
+	compress bool
+}
+
+// encode returns the chunk of count session records:
+//
+//	[CRC32:4][Flags:1][Count:4][Data]
+//
+// Data is the records, compressed and then encrypted as configured. The
+// CRC covers Flags, Count and Data.
+func (c chunkCodec) encode(records []byte, count int) ([]byte, error) {
+	out := make([]byte, chunkHeaderSize, chunkHeaderSize+len(records)/2)
+	data := records
+	if c.compress {
+		out[4] |= chunkFlagZstd
+		data = zstdEncoder().EncodeAll(records, nil)
+	}
+	if c.cipher != nil {
+		encrypted, err := c.cipher.Encrypt(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: encrypt chunk: %w", err)
+		}
+		data = encrypted
+	}
+	binary.BigEndian.PutUint32(out[5:9], uint32(count))
+	out = append(out, data...)
+	binary.BigEndian.PutUint32(out[0:4], crc32.ChecksumIEEE(out[4:]))
+	return out, nil
+}
+
+// decode returns the sessions of a chunk.
+func (c chunkCodec) decode(chunk []byte) ([]*domain.Session, error) {
+	if len(chunk) < chunkHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrCorruptChunk, len(chunk))
+	}
+	if crc32.ChecksumIEEE(chunk[4:]) != binary.BigEndian.Uint32(chunk[0:4]) {
+		return nil, fmt.Errorf("%w: crc mismatch", ErrCorruptChunk)
+	}
+	flags := chunk[4]
+	count := binary.BigEndian.Uint32(chunk[5:9])
+	data := chunk[chunkHeaderSize:]
+
+	var err error
+	if c.cipher != nil {
+		if data, err = c.cipher.Decrypt(data, nil); err != nil {
+			return nil, fmt.Errorf("snapshot: decrypt chunk: %w", err)
+		}
+	}
+	if flags&chunkFlagZstd != 0 {
+		if data, err = zstdDecoder().DecodeAll(data, nil); err != nil {
+			return nil, fmt.Errorf("%w: decompress: %v", ErrCorruptChunk, err)
+		}
+	}
+
+	if uint64(count) > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: %d sessions in %d bytes", ErrCorruptChunk, count, len(data))
+	}
+	sessions := make([]*domain.Session, 0, count)
+	for len(data) > 0 {
+		s, n, err := codec.DecodeSession(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: session %d: %v", ErrCorruptChunk, len(sessions), err)
+		}
+		sessions = append(sessions, s)
+		data = data[n:]
+	}
+	if len(sessions) != int(count) {
+		return nil, fmt.Errorf("%w: %d sessions, header says %d", ErrCorruptChunk, len(sessions), count)
+	}
+	return sessions, nil
+}
+
+// firstError keeps the first error reported by concurrent workers.
+type firstError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *firstError) set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *firstError) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// writeChunks encodes the sessions from scan into chunks of about
+// chunkSize bytes on workers goroutines, and writes each as
+// [ChunkLen:4][Chunk] to w, followed by a zero ChunkLen. Chunks are
+// independent, so they are written in the order they finish.
+func writeChunks(w io.Writer, scan func(fn func(*domain.Session) bool), c chunkCodec, chunkSize, workers int) (sessions, chunks uint64, err error) {
+	type job struct {
+		records []byte
+		count   int
+	}
+	jobs := make(chan job, workers)
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+		failed  firstError
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if failed.get() != nil {
+					continue
+				}
+				chunk, err := c.encode(j.records, j.count)
+				if err != nil {
+					failed.set(err)
+					continue
+				}
+				var length [4]byte
+				binary.BigEndian.PutUint32(length[:], uint32(len(chunk)))
+				writeMu.Lock()
+				_, err = w.Write(length[:])
+				if err == nil {
+					_, err = w.Write(chunk)
+				}
+				chunks++
+				writeMu.Unlock()
+				if err != nil {
+					failed.set(fmt.Errorf("snapshot: write chunk: %w", err))
+				}
+			}
+		}()
+	}
+
+	records := make([]byte, 0, chunkSize+chunkSize/8)
+	count := 0
+	scan(func(s *domain.Session) bool {
+		records = codec.AppendSession(records, s)
+		count++
+		sessions++
+		if len(records) >= chunkSize {
+			jobs <- job{records: records, count: count}
+			records = make([]byte, 0, chunkSize+chunkSize/8)
+			count = 0
+		}
+		return failed.get() == nil
+	})
+	if count > 0 {
+		jobs <- job{records: records, count: count}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := failed.get(); err != nil {
+		return 0, 0, err
+	}
+	if _, err := w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return 0, 0, fmt.Errorf("snapshot: write chunk end: %w", err)
+	}
+	return sessions, chunks, nil
+}
+
+// readChunks reads chunks from r up to the zero ChunkLen, decodes them on
+// workers goroutines and passes the sessions of each to apply, which is
+// called concurrently. A nil apply only counts the chunks.
+func readChunks(r *bufio.Reader, c chunkCodec, workers int, apply func([]*domain.Session) error) (sessions, chunks uint64, err error) {
+	jobs := make(chan []byte, workers)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed firstError
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				if failed.get() != nil {
+					continue
+				}
+				decoded, err := c.decode(chunk)
+				if err == nil {
+					err = apply(decoded)
+				}
+				if err != nil {
+					failed.set(err)
+					continue
+				}
+				mu.Lock()
+				sessions += uint64(len(decoded))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	readErr := func() error {
+		var length [4]byte
+		for failed.get() == nil {
+			if _, err := io.ReadFull(r, length[:]); err != nil {
+				return fmt.Errorf("snapshot: read chunk length: %w", err)
+			}
+			n := binary.BigEndian.Uint32(length[:])
+			if n == 0 {
+				return nil
+			}
+			chunks++
+			if apply == nil {
+				if _, err := r.Discard(int(n)); err != nil {
+					return fmt.Errorf("snapshot: skip chunk: %w", err)
+				}
+				continue
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return fmt.Errorf("snapshot: read chunk: %w", err)
+			}
+			jobs <- chunk
+		}
+		return nil
+	}()
+	close(jobs)
+	wg.Wait()
+
+	if readErr != nil {
+		return 0, 0, readErr
+	}
+	if err := failed.get(); err != nil {
+		return 0, 0, err
+	}
+	return sessions, chunks, nil
+}
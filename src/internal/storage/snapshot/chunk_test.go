@@ -0,0 +1,218 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+func chunkTestSessions(t *testing.T, n int) []*domain.Session {
+	t.Helper()
+	sessions := make([]*domain.Session, n)
+	for i := range sessions {
+		s, err := domain.NewSession(fmt.Sprintf("user-%d", i))
+		if err != nil {
+			t.Fatalf("NewSession: %v", err)
+		}
+		s.TokenHash = fmt.Sprintf("tmth_chunk_%d", i)
+		s.UserAgent = "Mozilla/5.0 (X11; Linux x86_64)"
+		s.Data = map[string]string{"tenant": "acme"}
+		s.SetExpiration(time.Hour)
+		sessions[i] = s
+	}
+	return sessions
+}
+
+func byID(sessions []*domain.Session) map[string]*domain.Session {
+	m := make(map[string]*domain.Session, len(sessions))
+	for _, s := range sessions {
+		m[s.ID] = s
+	}
+	return m
+}
+
+func TestManager_Chunks(t *testing.T) {
+	sessions := chunkTestSessions(t, 300)
+
+	for _, compression := range []string{CompressionZstd, CompressionNone} {
+		t.Run(compression, func(t *testing.T) {
+			m, err := NewManager(Config{Dir: t.TempDir(), ChunkSize: 2048, Compression: compression, Workers: 4})
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			info, err := m.Create(sessions, 1<<32|64)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if info.SessionCount != 300 || info.Chunks < 2 {
+				t.Fatalf("Create = %d sessions in %d chunks", info.SessionCount, info.Chunks)
+			}
+
+			var batches atomic.Int64
+			var c collector
+			loaded, err := m.LoadInto(func(batch []*domain.Session) error {
+				batches.Add(1)
+				return c.add(batch)
+			})
+			if err != nil {
+				t.Fatalf("LoadInto: %v", err)
+			}
+			if int(batches.Load()) != info.Chunks {
+				t.Errorf("apply called %d times, want once per chunk (%d)", batches.Load(), info.Chunks)
+			}
+			if loaded.SessionCount != 300 || loaded.Chunks != info.Chunks || loaded.WALLastOffset != 1<<32|64 {
+				t.Errorf("loaded info = %+v", loaded)
+			}
+			if !reflect.DeepEqual(byID(c.sessions), byID(sessions)) {
+				t.Error("loaded sessions differ from the created ones")
+			}
+		})
+	}
+}
+
+func TestManager_ChunksCompressed(t *testing.T) {
+	sessions := chunkTestSessions(t, 500)
+	sizes := make(map[string]int64)
+	for _, compression := range []string{CompressionZstd, CompressionNone} {
+		m, err := NewManager(Config{Dir: t.TempDir(), Compression: compression})
+		if err != nil {
+			t.Fatalf("NewManager: %v", err)
+		}
+		info, err := m.Create(sessions, 0)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		sizes[compression] = info.Size
+	}
+	if sizes[CompressionZstd] >= sizes[CompressionNone] {
+		t.Errorf("zstd snapshot %d bytes, uncompressed %d bytes", sizes[CompressionZstd], sizes[CompressionNone])
+	}
+}
+
+func TestManager_ChunksEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	c, err := adaptive.New(key)
+	if err != nil {
+		t.Fatalf("adaptive.New: %v", err)
+	}
+
+	m, err := NewManager(Config{Dir: dir, Cipher: c, ChunkSize: 1024})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	sessions := chunkTestSessions(t, 50)
+	if _, err := m.Create(sessions, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, info, err := m.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !info.Encrypted || !reflect.DeepEqual(byID(got), byID(sessions)) {
+		t.Errorf("Load = %d sessions, info %+v", len(got), info)
+	}
+
+	// Without the cipher only the metadata is loaded.
+	plain, err := NewManager(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	got, info, err = plain.Load()
+	if err != nil {
+		t.Fatalf("Load without cipher: %v", err)
+	}
+	if got != nil || info.SessionCount != 50 || info.Chunks < 2 {
+		t.Errorf("Load without cipher = %d sessions, info %+v", len(got), info)
+	}
+}
+
+func TestManager_CorruptChunk(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Config{Dir: dir, Compression: CompressionNone})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	info, err := m.Create(chunkTestSessions(t, 10), 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Flip a byte of the last session record and fix the file checksum,
+	// so only the chunk CRC catches it.
+	data, err := os.ReadFile(info.Path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	footer, err := readFooter(mustOpen(t, info.Path), int64(len(data)-checksumSize))
+	if err != nil || footer.SessionCount != 10 {
+		t.Fatalf("readFooter = %+v, %v", footer, err)
+	}
+	data[len(data)-checksumSize-100] ^= 0xFF
+	sum := sha256.Sum256(data[:len(data)-checksumSize])
+	copy(data[len(data)-checksumSize:], sum[:])
+	if err := os.WriteFile(info.Path, data, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := m.LoadInto(func([]*domain.Session) error { return nil }); !errors.Is(err, ErrCorruptChunk) {
+		t.Errorf("LoadInto = %v, want ErrCorruptChunk", err)
+	}
+}
+
+func TestManager_LoadIntoApplyError(t *testing.T) {
+	m, err := NewManager(Config{Dir: t.TempDir(), ChunkSize: 512})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, err := m.Create(chunkTestSessions(t, 100), 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	errFull := errors.New("store full")
+	if _, err := m.LoadInto(func([]*domain.Session) error { return errFull }); !errors.Is(err, errFull) {
+		t.Errorf("LoadInto = %v, want the apply error", err)
+	}
+}
+
+func TestNewManager_UnknownCompression(t *testing.T) {
+	if _, err := NewManager(Config{Dir: t.TempDir(), Compression: "lz4"}); err == nil {
+		t.Error("NewManager should reject an unknown compression")
+	}
+}
+
+func TestChunkCodec_Truncated(t *testing.T) {
+	c := chunkCodec{compress: true}
+	chunk, err := c.encode(nil, 0)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := c.decode(chunk[:chunkHeaderSize-1]); !errors.Is(err, ErrCorruptChunk) {
+		t.Errorf("decode of a short chunk = %v, want ErrCorruptChunk", err)
+	}
+	if got, err := c.decode(chunk); err != nil || len(got) != 0 {
+		t.Errorf("decode of an empty chunk = %v, %v", got, err)
+	}
+}
+
+func mustOpen(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
@@ -9,9 +9,23 @@
 //   snapshot-<timestamp>-<sequence>.snap
 //   [magic:8 "TOKMSNAP"]
 //   [HeaderLen:4][HeaderJSON:HeaderLen]
-//   [DataLen:4][Data:DataLen]   (JSON sessions, or encrypted bytes)
+//   [ChunkLen:4][Chunk:ChunkLen]*  (terminated by ChunkLen 0)
+//   [FooterJSON][FooterLen:4]      (session and chunk counts)
 //   [checksum:32 SHA-256 of all bytes above]
 //
+// A chunk holds a few MB of codec session records, compressed (zstd)
+// and then encrypted as configured, with its own CRC:
+//
+//   [CRC32:4][Flags:1][Count:4][Data]
+//
+// Chunks are written as a point-in-time view of the store is scanned and
+// decoded in parallel on load, straight into the store, so neither side
+// holds the whole data set in memory.
+//
+// The header version selects the data encoding: version 3 (written) is
+// chunked; versions 1 and 2 hold a single [DataLen:4][Data] block with a
+// JSON array of sessions or concatenated session records. All are loaded.
+//
 // Recovery Process:
 //
 //  1. Load latest valid snapshot
@@ -16,11 +16,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/codec"
 	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
 )
 
@@ -31,21 +34,43 @@ const (
 	filePrefix    = "snapshot-"
 	fileExtension = ".snap"
 	checksumSize  = 32
-	headerVersion = 1
+
+	// Snapshot header versions. The version gives the encoding of the
+	// data: a single block holding a JSON array of sessions (version 1)
+	// or concatenated codec session records (version 2), or chunks of
+	// session records (version 3). Versions 1 and 2 are still loaded.
+	headerVersionJSON    = 1
+	headerVersionBinary  = 2
+	headerVersionChunked = 3
+	headerVersion        = headerVersionChunked
+
+	// footerLenSize is the size of the footer length, which follows the
+	// footer so it can be read from the end of the file.
+	footerLenSize = 4
 
 	DefaultRetentionCount = 5
 	DefaultRetentionDays  = 7
 )
 
 type snapshotHeader struct {
-	Version       int    `json:"version"`
-	CreatedAt     int64  `json:"created_at"`
-	NodeID        string `json:"node_id,omitempty"`
-	SessionCount  uint64 `json:"session_count"`
+	Version   int    `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+	NodeID    string `json:"node_id,omitempty"`
+
+	// SessionCount is in the footer from version 3 on, since chunks are
+	// written before the count is known.
+	SessionCount  uint64 `json:"session_count,omitempty"`
 	WALLastOffset uint64 `json:"wal_last_offset"`
 	Encrypted     bool   `json:"encrypted"`
 }
 
+// snapshotFooter follows the chunks of a version 3 snapshot.
+type snapshotFooter struct {
+	SessionCount uint64 `json:"session_count"`
+	ChunkCount   uint64 `json:"chunk_count"`
+}
+
+// snapshotSession is a session in a version 1 (JSON) snapshot.
 type snapshotSession struct {
 	ID           string            `json:"id"`
 	UserID       string            `json:"user_id"`
@@ -67,28 +92,6 @@ type snapshotSession struct {
 	IsDeleted bool   `json:"is_deleted"`
 }
 
-func snapshotSessionFromDomain(s *domain.Session) snapshotSession {
-	return snapshotSession{
-		ID:           s.ID,
-		UserID:       s.UserID,
-		TokenHash:    s.TokenHash,
-		IPAddress:    s.IPAddress,
-		UserAgent:    s.UserAgent,
-		LastAccessIP: s.LastAccessIP,
-		LastAccessUA: s.LastAccessUA,
-		DeviceID:     s.DeviceID,
-		CreatedBy:    s.CreatedBy,
-		CreatedAt:    s.CreatedAt,
-		ExpiresAt:    s.ExpiresAt,
-		LastActive:   s.LastActive,
-		Data:         s.Data,
-		Version:      s.Version,
-		ShardID:      s.ShardID,
-		TTL:          s.TTL,
-		IsDeleted:    s.IsDeleted,
-	}
-}
-
 func (s snapshotSession) toDomain() *domain.Session {
 	return &domain.Session{
 		ID:           s.ID,
@@ -116,6 +119,10 @@ var (
 	ErrChecksumMismatch = errors.New("snapshot: checksum mismatch")
 	ErrNotFound         = errors.New("snapshot: not found")
 	ErrNoSnapshots      = errors.New("snapshot: no snapshots available")
+
+	// ErrUnsupportedVersion is returned for a snapshot written by a newer
+	// version with an unknown header version.
+	ErrUnsupportedVersion = errors.New("snapshot: unsupported version")
 )
 
 // Config configures the snapshot manager.
@@ -127,6 +134,16 @@ type Config struct {
 
 	Cipher adaptive.Cipher
 	NodeID string
+
+	// ChunkSize is the uncompressed size of a data chunk in bytes.
+	ChunkSize int
+
+	// Compression is CompressionZstd (default) or CompressionNone.
+	Compression string
+
+	// Workers is the number of chunks encoded or decoded in parallel.
+	// Defaults to GOMAXPROCS.
+	Workers int
 }
 
 func DefaultConfig(dir string) Config {
@@ -134,6 +151,8 @@ func DefaultConfig(dir string) Config {
 		Dir:            dir,
 		RetentionCount: DefaultRetentionCount,
 		RetentionDays:  DefaultRetentionDays,
+		ChunkSize:      DefaultChunkSize,
+		Compression:    CompressionZstd,
 	}
 }
 
@@ -155,6 +174,19 @@ func NewManager(cfg Config) (*Manager, error) {
 	if cfg.RetentionDays == 0 {
 		cfg.RetentionDays = DefaultRetentionDays
 	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultChunkSize
+	}
+	switch cfg.Compression {
+	case "":
+		cfg.Compression = CompressionZstd
+	case CompressionZstd, CompressionNone:
+	default:
+		return nil, fmt.Errorf("snapshot: unknown compression %q", cfg.Compression)
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
 
 	return &Manager{
 		cfg:    cfg,
@@ -176,10 +208,27 @@ type Info struct {
 	Path         string `json:"path"`
 	Checksum     string `json:"checksum"`
 	NodeID       string `json:"node_id,omitempty"`
+	Encrypted    bool   `json:"encrypted,omitempty"`
+
+	// Chunks is the number of data chunks (0 before version 3).
+	Chunks int `json:"chunks,omitempty"`
 }
 
 // Create creates a new snapshot file from the given sessions.
 func (m *Manager) Create(sessions []*domain.Session, walLastOffset uint64) (*Info, error) {
+	return m.CreateFrom(func(fn func(*domain.Session) bool) {
+		for _, s := range sessions {
+			if !fn(s) {
+				return
+			}
+		}
+	}, walLastOffset)
+}
+
+// CreateFrom creates a new snapshot file from the sessions passed to fn
+// by scan, such as memory.View.Scan. Sessions are encoded into chunks as
+// they are scanned, so the whole store is never serialized in memory.
+func (m *Manager) CreateFrom(scan func(fn func(*domain.Session) bool), walLastOffset uint64) (*Info, error) {
 	now := time.Now()
 	id := m.generateID(now)
 
@@ -191,7 +240,7 @@ func (m *Manager) Create(sessions []*domain.Session, walLastOffset uint64) (*Inf
 	defer os.Remove(tempPath)
 
 	hash := sha256.New()
-	writer := io.MultiWriter(file, hash)
+	writer := bufio.NewWriterSize(io.MultiWriter(file, hash), 1<<20)
 
 	if _, err := writer.Write(magicBytes); err != nil {
 		file.Close()
@@ -202,53 +251,32 @@ func (m *Manager) Create(sessions []*domain.Session, walLastOffset uint64) (*Inf
 		Version:       headerVersion,
 		CreatedAt:     now.UnixMilli(),
 		NodeID:        m.cfg.NodeID,
-		SessionCount:  uint64(len(sessions)),
 		WALLastOffset: walLastOffset,
 		Encrypted:     m.cipher != nil,
 	}
-
-	hdrJSON, err := json.Marshal(hdr)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("snapshot: marshal header: %w", err)
-	}
-
-	var hdrLen [4]byte
-	binary.BigEndian.PutUint32(hdrLen[:], uint32(len(hdrJSON)))
-	if _, err := writer.Write(hdrLen[:]); err != nil {
-		file.Close()
-		return nil, fmt.Errorf("snapshot: write header length: %w", err)
-	}
-	if _, err := writer.Write(hdrJSON); err != nil {
+	if err := writeBlock(writer, hdr); err != nil {
 		file.Close()
 		return nil, fmt.Errorf("snapshot: write header: %w", err)
 	}
 
-	encoded := make([]snapshotSession, 0, len(sessions))
-	for _, s := range sessions {
-		encoded = append(encoded, snapshotSessionFromDomain(s))
+	chunkCodec := chunkCodec{cipher: m.cipher, compress: m.cfg.Compression == CompressionZstd}
+	sessionCount, chunkCount, err := writeChunks(writer, scan, chunkCodec, m.cfg.ChunkSize, m.cfg.Workers)
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
 
-	data, err := json.Marshal(encoded)
+	footer, err := json.Marshal(snapshotFooter{SessionCount: sessionCount, ChunkCount: chunkCount})
 	if err != nil {
 		file.Close()
-		return nil, fmt.Errorf("snapshot: marshal sessions: %w", err)
-	}
-	if m.cipher != nil {
-		data, err = m.cipher.Encrypt(data, nil)
-		if err != nil {
-			file.Close()
-			return nil, fmt.Errorf("snapshot: encrypt: %w", err)
-		}
+		return nil, fmt.Errorf("snapshot: marshal footer: %w", err)
 	}
-
-	var dataLen [4]byte
-	binary.BigEndian.PutUint32(dataLen[:], uint32(len(data)))
-	if _, err := writer.Write(dataLen[:]); err != nil {
+	footer = binary.BigEndian.AppendUint32(footer, uint32(len(footer)))
+	if _, err := writer.Write(footer); err != nil {
 		file.Close()
-		return nil, fmt.Errorf("snapshot: write data length: %w", err)
+		return nil, fmt.Errorf("snapshot: write footer: %w", err)
 	}
-	if _, err := writer.Write(data); err != nil {
+	if err := writer.Flush(); err != nil {
 		file.Close()
 		return nil, fmt.Errorf("snapshot: write data: %w", err)
 	}
@@ -284,136 +312,151 @@ func (m *Manager) Create(sessions []*domain.Session, walLastOffset uint64) (*Inf
 	return &Info{
 		ID:            id,
 		WALLastOffset: walLastOffset,
-		SessionCount:  int64(len(sessions)),
+		SessionCount:  int64(sessionCount),
 		CreatedAt:     now.UnixMilli(),
 		Size:          stat.Size(),
 		Path:          finalPath,
 		Checksum:      hex.EncodeToString(sum),
 		NodeID:        m.cfg.NodeID,
+		Encrypted:     m.cipher != nil,
+		Chunks:        int(chunkCount),
 	}, nil
 }
 
+// writeBlock writes v as [Len:4][JSON:Len].
+func writeBlock(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
 // Load loads sessions from the latest valid snapshot.
 // If the latest snapshot is corrupted, it falls back to older snapshots.
 func (m *Manager) Load() ([]*domain.Session, *Info, error) {
-	snapshots, err := m.List()
+	var c collector
+	info, err := m.LoadInto(c.add)
 	if err != nil {
 		return nil, nil, err
 	}
+	return c.sessions, info, nil
+}
+
+// LoadInto loads the latest valid snapshot, passing its sessions to apply
+// in batches (one per chunk) as they are decoded. apply is called from
+// several goroutines at once. If the latest snapshot is corrupted, it
+// falls back to older snapshots; corruption is detected before apply is
+// first called. Without a cipher, apply is not called for an encrypted
+// snapshot.
+func (m *Manager) LoadInto(apply func([]*domain.Session) error) (*Info, error) {
+	snapshots, err := m.List()
+	if err != nil {
+		return nil, err
+	}
 	if len(snapshots) == 0 {
-		return nil, nil, ErrNoSnapshots
+		return nil, ErrNoSnapshots
 	}
 
 	for i := len(snapshots) - 1; i >= 0; i-- {
-		sessions, info, err := m.loadFile(snapshots[i].Path)
+		info, err := m.loadFile(snapshots[i].Path, apply)
 		if err == nil {
-			return sessions, info, nil
+			return info, nil
 		}
 		if errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrInvalidMagic) {
 			continue
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
-	return nil, nil, ErrNoSnapshots
+	return nil, ErrNoSnapshots
+}
+
+// collector gathers the batches passed to an apply function.
+type collector struct {
+	mu       sync.Mutex
+	sessions []*domain.Session
 }
 
-func (m *Manager) loadFile(path string) ([]*domain.Session, *Info, error) {
+func (c *collector) add(sessions []*domain.Session) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessions = append(c.sessions, sessions...)
+	return nil
+}
+
+func (m *Manager) loadFile(path string, apply func([]*domain.Session) error) (*Info, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer f.Close()
 
 	stat, err := f.Stat()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	if stat.Size() < int64(len(magicBytes))+checksumSize {
-		return nil, nil, ErrChecksumMismatch
+		return nil, ErrChecksumMismatch
 	}
 
 	// Verify checksum.
 	dataLen := stat.Size() - checksumSize
 	expected := make([]byte, checksumSize)
 	if _, err := io.ReadFull(io.NewSectionReader(f, dataLen, checksumSize), expected); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	h := sha256.New()
 	if _, err := io.CopyN(h, io.NewSectionReader(f, 0, dataLen), dataLen); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	if !bytes.Equal(h.Sum(nil), expected) {
-		return nil, nil, ErrChecksumMismatch
+		return nil, ErrChecksumMismatch
 	}
 
-	br := bufio.NewReader(io.NewSectionReader(f, 0, dataLen))
+	br := bufio.NewReaderSize(io.NewSectionReader(f, 0, dataLen), 1<<20)
 
 	magic := make([]byte, len(magicBytes))
 	if _, err := io.ReadFull(br, magic); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	if !bytes.Equal(magic, magicBytes) {
-		return nil, nil, ErrInvalidMagic
+		return nil, ErrInvalidMagic
 	}
 
 	var hdrLenBuf [4]byte
 	if _, err := io.ReadFull(br, hdrLenBuf[:]); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	hdrLen := binary.BigEndian.Uint32(hdrLenBuf[:])
 	if hdrLen == 0 {
-		return nil, nil, fmt.Errorf("snapshot: empty header")
+		return nil, fmt.Errorf("snapshot: empty header")
 	}
 	hdrJSON := make([]byte, hdrLen)
 	if _, err := io.ReadFull(br, hdrJSON); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	var hdr snapshotHeader
 	if err := json.Unmarshal(hdrJSON, &hdr); err != nil {
-		return nil, nil, fmt.Errorf("snapshot: unmarshal header: %w", err)
+		return nil, fmt.Errorf("snapshot: unmarshal header: %w", err)
 	}
-
-	var dataLenBuf [4]byte
-	if _, err := io.ReadFull(br, dataLenBuf[:]); err != nil {
-		return nil, nil, err
+	if hdr.Version < headerVersionJSON || hdr.Version > headerVersionChunked {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, hdr.Version)
 	}
-		dataSize := binary.BigEndian.Uint32(dataLenBuf[:])
-		data := make([]byte, dataSize)
-	if _, err := io.ReadFull(br, data); err != nil {
-		return nil, nil, err
+	if !hdr.Encrypted && m.cipher != nil {
+		return nil, fmt.Errorf("snapshot: expected encrypted snapshot")
+	}
+	// Compatibility behavior: allow loading metadata without decrypting data.
+	if hdr.Encrypted && m.cipher == nil {
+		apply = nil
 	}
-
-		var sessions []*domain.Session
-		if hdr.Encrypted {
-			if m.cipher == nil {
-				// Compatibility behavior: allow loading metadata without decrypting data.
-				// This matches the previous "encrypted block with nil Sessions" semantics.
-				sessions = nil
-			} else {
-				plain, err := m.cipher.Decrypt(data, nil)
-				if err != nil {
-					return nil, nil, fmt.Errorf("snapshot: decrypt: %w", err)
-				}
-				data = plain
-			}
-		} else if m.cipher != nil {
-			return nil, nil, fmt.Errorf("snapshot: expected encrypted snapshot")
-		}
-
-		if sessions == nil && hdr.Encrypted && m.cipher == nil {
-			// Skip decoding the encrypted data block.
-		} else {
-			var decoded []snapshotSession
-			if err := json.Unmarshal(data, &decoded); err != nil {
-				return nil, nil, fmt.Errorf("snapshot: unmarshal sessions: %w", err)
-			}
-			sessions = make([]*domain.Session, 0, len(decoded))
-			for _, s := range decoded {
-				sessions = append(sessions, s.toDomain())
-			}
-		}
 
 	info := &Info{
 		ID:            strings.TrimSuffix(filepath.Base(path), fileExtension),
@@ -424,9 +467,150 @@ func (m *Manager) loadFile(path string) ([]*domain.Session, *Info, error) {
 		Path:          path,
 		Checksum:      hex.EncodeToString(expected),
 		NodeID:        hdr.NodeID,
+		Encrypted:     hdr.Encrypted,
+	}
+
+	if hdr.Version != headerVersionChunked {
+		if err := m.loadBlock(br, hdr, apply); err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+
+	footer, err := readFooter(f, dataLen)
+	if err != nil {
+		return nil, err
+	}
+	info.SessionCount = int64(footer.SessionCount)
+	info.Chunks = int(footer.ChunkCount)
+
+	chunkCodec := chunkCodec{cipher: m.cipher}
+	sessions, chunks, err := readChunks(br, chunkCodec, m.cfg.Workers, apply)
+	if err != nil {
+		return nil, err
+	}
+	if chunks != footer.ChunkCount || (apply != nil && sessions != footer.SessionCount) {
+		return nil, fmt.Errorf("%w: %d sessions in %d chunks, footer says %d in %d",
+			ErrCorruptChunk, sessions, chunks, footer.SessionCount, footer.ChunkCount)
+	}
+	return info, nil
+}
+
+// readFooter reads the footer of a version 3 snapshot, which ends at end.
+func readFooter(f *os.File, end int64) (snapshotFooter, error) {
+	var footer snapshotFooter
+	var lenBuf [footerLenSize]byte
+	if _, err := f.ReadAt(lenBuf[:], end-footerLenSize); err != nil {
+		return footer, fmt.Errorf("snapshot: read footer length: %w", err)
+	}
+	n := int64(binary.BigEndian.Uint32(lenBuf[:]))
+	if n > end-footerLenSize {
+		return footer, fmt.Errorf("snapshot: footer length %d out of range", n)
+	}
+	data := make([]byte, n)
+	if _, err := f.ReadAt(data, end-footerLenSize-n); err != nil {
+		return footer, fmt.Errorf("snapshot: read footer: %w", err)
+	}
+	if err := json.Unmarshal(data, &footer); err != nil {
+		return footer, fmt.Errorf("snapshot: unmarshal footer: %w", err)
+	}
+	return footer, nil
+}
+
+// loadBlock loads the single data block of a version 1 or 2 snapshot.
+func (m *Manager) loadBlock(br *bufio.Reader, hdr snapshotHeader, apply func([]*domain.Session) error) error {
+	var dataLenBuf [4]byte
+	if _, err := io.ReadFull(br, dataLenBuf[:]); err != nil {
+		return err
+	}
+	dataSize := binary.BigEndian.Uint32(dataLenBuf[:])
+	data := make([]byte, dataSize)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return err
+	}
+	if apply == nil {
+		return nil
+	}
+
+	if hdr.Encrypted {
+		plain, err := m.cipher.Decrypt(data, nil)
+		if err != nil {
+			return fmt.Errorf("snapshot: decrypt: %w", err)
+		}
+		data = plain
+	}
+
+	sessions, err := decodeSessions(hdr, data)
+	if err != nil {
+		return err
+	}
+	return apply(sessions)
+}
+
+// decodeSessions decodes the plaintext data block of a snapshot.
+func decodeSessions(hdr snapshotHeader, data []byte) ([]*domain.Session, error) {
+	if hdr.Version == headerVersionJSON {
+		var decoded []snapshotSession
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return nil, fmt.Errorf("snapshot: unmarshal sessions: %w", err)
+		}
+		sessions := make([]*domain.Session, 0, len(decoded))
+		for _, s := range decoded {
+			sessions = append(sessions, s.toDomain())
+		}
+		return sessions, nil
+	}
+
+	sessions := make([]*domain.Session, 0, hdr.SessionCount)
+	for len(data) > 0 {
+		s, n, err := codec.DecodeSession(data)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: decode session %d: %w", len(sessions), err)
+		}
+		sessions = append(sessions, s)
+		data = data[n:]
+	}
+	if uint64(len(sessions)) != hdr.SessionCount {
+		return nil, fmt.Errorf("snapshot: %d sessions, header says %d", len(sessions), hdr.SessionCount)
+	}
+	return sessions, nil
+}
+
+// LoadFile loads the snapshot at path, verifying its checksum. Without a
+// cipher the sessions of an encrypted snapshot are nil.
+func (m *Manager) LoadFile(path string) ([]*domain.Session, *Info, error) {
+	var c collector
+	info, err := m.loadFile(path, c.add)
+	if err != nil {
+		return nil, nil, err
 	}
+	return c.sessions, info, nil
+}
+
+// LoadFileInto loads the snapshot at path like LoadInto, without falling
+// back to another snapshot.
+func (m *Manager) LoadFileInto(path string, apply func([]*domain.Session) error) (*Info, error) {
+	return m.loadFile(path, apply)
+}
+
+// ReadInfo verifies the snapshot at path and returns its metadata,
+// without decoding its sessions.
+func (m *Manager) ReadInfo(path string) (*Info, error) {
+	return m.loadFile(path, nil)
+}
 
-	return sessions, info, nil
+// QuarantineSuffix is appended to the name of a quarantined snapshot,
+// which List and Load then ignore.
+const QuarantineSuffix = ".corrupt"
+
+// Quarantine renames a snapshot so it is no longer loaded, keeping it for
+// analysis, and returns the new path.
+func (m *Manager) Quarantine(path string) (string, error) {
+	target := path + QuarantineSuffix
+	if err := os.Rename(path, target); err != nil {
+		return "", fmt.Errorf("snapshot: quarantine: %w", err)
+	}
+	return target, nil
 }
 
 // List lists snapshot files (metadata only).
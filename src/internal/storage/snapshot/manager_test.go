@@ -1,12 +1,19 @@
 package snapshot
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/codec"
 	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
 )
 
@@ -180,6 +187,9 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.RetentionDays != DefaultRetentionDays {
 		t.Fatalf("RetentionDays = %d, want %d", cfg.RetentionDays, DefaultRetentionDays)
 	}
+	if cfg.ChunkSize != DefaultChunkSize || cfg.Compression != CompressionZstd {
+		t.Fatalf("ChunkSize = %d, Compression = %q", cfg.ChunkSize, cfg.Compression)
+	}
 }
 
 func TestNewManager_EmptyDir(t *testing.T) {
@@ -887,6 +897,9 @@ func TestManager_RetentionDefaultsApplied(t *testing.T) {
 }
 
 func TestManager_LoadFileOpenError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can open files regardless of permissions")
+	}
 	dir := t.TempDir()
 	m, err := NewManager(Config{Dir: dir, RetentionCount: 5, RetentionDays: 7, NodeID: "n1"})
 	if err != nil {
@@ -1071,3 +1084,167 @@ func TestManager_MultipleSessionsWithData(t *testing.T) {
 		t.Fatalf("deletedCount = %d, want 3", deletedCount)
 	}
 }
+
+func TestManager_LoadFileAndQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Config{Dir: dir, NodeID: "n1"})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	s1, _ := domain.NewSession("u1")
+	s1.TokenHash = "tmth_x"
+	oldInfo, err := m.Create([]*domain.Session{s1}, uint64(1)<<32|8)
+	if err != nil {
+		t.Fatalf("Create(old): %v", err)
+	}
+	newInfo, err := m.Create([]*domain.Session{s1}, uint64(2)<<32|8)
+	if err != nil {
+		t.Fatalf("Create(new): %v", err)
+	}
+
+	sessions, info, err := m.LoadFile(oldInfo.Path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if len(sessions) != 1 || info.Checksum != oldInfo.Checksum || info.WALLastOffset != oldInfo.WALLastOffset || info.Encrypted {
+		t.Errorf("LoadFile = %d sessions, %+v", len(sessions), info)
+	}
+
+	// Corrupt and quarantine the latest; Load then uses the older one.
+	if err := os.WriteFile(newInfo.Path, []byte("TOKMSNAP garbage"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, _, err := m.LoadFile(newInfo.Path); err != ErrChecksumMismatch {
+		t.Errorf("LoadFile(corrupted) err = %v, want %v", err, ErrChecksumMismatch)
+	}
+	moved, err := m.Quarantine(newInfo.Path)
+	if err != nil {
+		t.Fatalf("Quarantine: %v", err)
+	}
+	if moved != newInfo.Path+QuarantineSuffix {
+		t.Errorf("quarantined to %s", moved)
+	}
+	infos, err := m.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Path != oldInfo.Path {
+		t.Errorf("List after quarantine = %+v", infos)
+	}
+}
+
+func snapshotSessionFromDomain(s *domain.Session) snapshotSession {
+	return snapshotSession{
+		ID:           s.ID,
+		UserID:       s.UserID,
+		TokenHash:    s.TokenHash,
+		IPAddress:    s.IPAddress,
+		UserAgent:    s.UserAgent,
+		LastAccessIP: s.LastAccessIP,
+		LastAccessUA: s.LastAccessUA,
+		DeviceID:     s.DeviceID,
+		CreatedBy:    s.CreatedBy,
+		CreatedAt:    s.CreatedAt,
+		ExpiresAt:    s.ExpiresAt,
+		LastActive:   s.LastActive,
+		Data:         s.Data,
+		Version:      s.Version,
+		ShardID:      s.ShardID,
+		TTL:          s.TTL,
+		IsDeleted:    s.IsDeleted,
+	}
+}
+
+// writeSnapshotFile writes a snapshot file with the given header version
+// and plaintext data block, as an older or newer version would.
+func writeSnapshotFile(t *testing.T, dir string, version int, count int, data []byte) string {
+	t.Helper()
+	hdr, _ := json.Marshal(snapshotHeader{
+		Version:       version,
+		CreatedAt:     time.Now().UnixMilli(),
+		SessionCount:  uint64(count),
+		WALLastOffset: 1<<32 | 8,
+	})
+
+	var buf bytes.Buffer
+	buf.Write(magicBytes)
+	binary.Write(&buf, binary.BigEndian, uint32(len(hdr)))
+	buf.Write(hdr)
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+
+	path := filepath.Join(dir, "snapshot-20250101000000-0001.snap")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestManager_LoadJSONSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	s1, _ := domain.NewSession("u1")
+	s1.TokenHash = "tmth_legacy"
+	s1.Data = map[string]string{"role": "admin"}
+	s1.ShardID = 7
+	s1.SetExpiration(time.Hour)
+	data, _ := json.Marshal([]snapshotSession{snapshotSessionFromDomain(s1)})
+	writeSnapshotFile(t, dir, headerVersionJSON, 1, data)
+
+	m, err := NewManager(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	got, info, err := m.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got) != 1 || info.WALLastOffset != 1<<32|8 {
+		t.Fatalf("loaded %d sessions, offset %d", len(got), info.WALLastOffset)
+	}
+	if !reflect.DeepEqual(got[0], s1) {
+		t.Errorf("session = %+v, want %+v", got[0], s1)
+	}
+
+	// A new snapshot of the loaded sessions is chunked and loads the same.
+	if _, err := m.Create(got, info.WALLastOffset); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	again, _, err := m.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(again, got) {
+		t.Errorf("binary snapshot = %+v, want %+v", again[0], got[0])
+	}
+}
+
+func TestManager_LoadUnsupportedVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := writeSnapshotFile(t, dir, headerVersion+1, 0, nil)
+
+	m, err := NewManager(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, _, err := m.LoadFile(path); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("LoadFile = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestManager_LoadSessionCountMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s1, _ := domain.NewSession("u1")
+	path := writeSnapshotFile(t, dir, headerVersionBinary, 2, codec.EncodeSession(s1))
+
+	m, err := NewManager(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, _, err := m.LoadFile(path); err == nil {
+		t.Error("LoadFile should fail when the header count does not match the data")
+	}
+}
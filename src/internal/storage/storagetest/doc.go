@@ -0,0 +1,23 @@
+// Package storagetest provides a conformance suite for implementations of
+// service.SessionRepository.
+//
+// RunSessionRepositorySuite checks the behaviour the service layer relies
+// on, the same way for every storage implementation:
+//
+//   - Optimistic locking: stale versions conflict, one of concurrent
+//     updates wins
+//   - Quota: at most Quota sessions per user, enforced under concurrency
+//   - Token index: token hashes are unique, released on delete and
+//     rotation
+//   - Expiry: expired sessions are reported, unlisted and removed by
+//     DeleteExpired
+//   - Listing: filters, sort orders, offset and keyset pagination
+//   - Races: concurrent creates, revokes and bulk deletes
+//   - Recovery: a repository closed and reopened on the same directory
+//     holds the same sessions
+//
+// Listings are made for one user at a time, the listing every backend
+// serves in full.
+//
+// @design DS-0102
+package storagetest
@@ -0,0 +1,704 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+)
+
+// Quota is the number of sessions per user the repositories under test
+// must allow.
+const Quota = 8
+
+// Factory opens the repository under test on dir, an empty directory the
+// first time. The repository must allow Quota sessions per user.
+//
+// If the repository implements io.Closer, the suite closes it, and checks
+// that the repository opened again on the same dir holds what was written
+// before. Repositories that keep no data ignore dir.
+type Factory func(t *testing.T, dir string) service.SessionRepository
+
+// RunSessionRepositorySuite runs the conformance suite against the
+// repositories opened by open.
+func RunSessionRepositorySuite(t *testing.T, open Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, open Factory)
+	}{
+		{"CreateGet", testCreateGet},
+		{"OptimisticLocking", testOptimisticLocking},
+		{"ConflictRecovery", testConflictRecovery},
+		{"Quota", testQuota},
+		{"TokenIndex", testTokenIndex},
+		{"Expiry", testExpiry},
+		{"List", testList},
+		{"ConcurrentCreateRevoke", testConcurrentCreateRevoke},
+		{"Recovery", testRecovery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open)
+		})
+	}
+}
+
+// start opens a repository on dir and returns it with a function closing
+// it, if it is an io.Closer; the repository is closed at the end of the
+// test in any case.
+func start(t *testing.T, open Factory, dir string) (service.SessionRepository, func()) {
+	t.Helper()
+
+	repo := open(t, dir)
+	var once sync.Once
+	closeRepo := func() {
+		once.Do(func() {
+			if c, ok := repo.(io.Closer); ok {
+				if err := c.Close(); err != nil {
+					t.Errorf("Close failed: %v", err)
+				}
+			}
+		})
+	}
+	t.Cleanup(closeRepo)
+	return repo, closeRepo
+}
+
+// newSession returns an unsaved session of userID with the given token
+// hash, expiring in an hour.
+func newSession(t *testing.T, userID, tokenHash string) *domain.Session {
+	t.Helper()
+
+	s, err := domain.NewSession(userID)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	s.TokenHash = tokenHash
+	s.SetExpiration(time.Hour)
+	return s
+}
+
+// mustCreate creates sessions, failing the test on error.
+func mustCreate(t *testing.T, repo service.SessionRepository, sessions ...*domain.Session) {
+	t.Helper()
+
+	for _, s := range sessions {
+		if err := repo.Create(context.Background(), s); err != nil {
+			t.Fatalf("Create(%s) failed: %v", s.ID, err)
+		}
+	}
+}
+
+// checkToken checks, if repo is a service.TokenRepository, that the
+// token hash resolves to the session wantID, or fails with wantErr.
+func checkToken(t *testing.T, repo service.SessionRepository, tokenHash, wantID string, wantErr error) {
+	t.Helper()
+
+	tokens, ok := repo.(service.TokenRepository)
+	if !ok {
+		return
+	}
+	got, err := tokens.GetSessionByTokenHash(context.Background(), tokenHash)
+	switch {
+	case wantErr != nil:
+		if !errors.Is(err, wantErr) {
+			t.Errorf("GetSessionByTokenHash(%s) err = %v, want %v", tokenHash, err, wantErr)
+		}
+	case err != nil:
+		t.Errorf("GetSessionByTokenHash(%s) failed: %v", tokenHash, err)
+	case got.ID != wantID:
+		t.Errorf("GetSessionByTokenHash(%s) = %s, want %s", tokenHash, got.ID, wantID)
+	}
+}
+
+// sameSession reports whether a and b hold the same fields, an empty and
+// a nil Data being the same.
+func sameSession(a, b *domain.Session) bool {
+	a, b = a.Clone(), b.Clone()
+	for _, s := range []*domain.Session{a, b} {
+		if len(s.Data) == 0 {
+			s.Data = nil
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// concurrently runs fn(i) for i in [0, n) in parallel and returns the
+// errors, in order.
+func concurrently(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// countErrors returns the number of nil errors and of errors matching
+// target; other errors fail the test.
+func countErrors(t *testing.T, errs []error, target error) (ok, matched int) {
+	t.Helper()
+
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, target):
+			matched++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	return ok, matched
+}
+
+func testCreateGet(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	s := newSession(t, "alice", "tmth_suite_create")
+	s.DeviceID = "phone-1"
+	s.Data["plan"] = "pro"
+	mustCreate(t, repo, s)
+
+	got, err := repo.Get(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !sameSession(got, s) {
+		t.Errorf("Get = %+v, want %+v", got, s)
+	}
+
+	// Returned sessions are copies
+	got.Data["plan"] = "free"
+	if again, _ := repo.Get(ctx, s.ID); again.Data["plan"] != "pro" {
+		t.Errorf("Data after changing a returned session = %v, want plan=pro", again.Data)
+	}
+
+	if _, err := repo.Get(ctx, "tmss-missing"); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get missing err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if err := repo.Create(ctx, s); !errors.Is(err, domain.ErrSessionConflict) {
+		t.Errorf("Create duplicate ID err = %v, want %v", err, domain.ErrSessionConflict)
+	}
+	if err := repo.Create(ctx, newSession(t, "bob", s.TokenHash)); !errors.Is(err, domain.ErrTokenHashConflict) {
+		t.Errorf("Create duplicate token err = %v, want %v", err, domain.ErrTokenHashConflict)
+	}
+	invalid := newSession(t, "alice", "tmth_suite_invalid")
+	invalid.UserID = ""
+	if err := repo.Create(ctx, invalid); err == nil {
+		t.Error("Create without user ID succeeded")
+	}
+}
+
+func testOptimisticLocking(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	s := newSession(t, "alice", "tmth_suite_lock")
+	mustCreate(t, repo, s)
+
+	got, _ := repo.Get(ctx, s.ID)
+	stale, _ := repo.Get(ctx, s.ID)
+	version := got.Version
+	got.Data["step"] = "1"
+	if err := repo.Update(ctx, got, version+1); !errors.Is(err, domain.ErrSessionVersionConflict) {
+		t.Errorf("Update with a future version err = %v, want %v", err, domain.ErrSessionVersionConflict)
+	}
+	if err := repo.Update(ctx, got, version); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got.Version != version+1 {
+		t.Errorf("Version after Update = %d, want %d", got.Version, version+1)
+	}
+	updated, _ := repo.Get(ctx, s.ID)
+	if updated.Version != version+1 || updated.Data["step"] != "1" {
+		t.Errorf("after Update = version %d data %v, want %d step=1", updated.Version, updated.Data, version+1)
+	}
+	if err := repo.Update(ctx, stale, stale.Version); !errors.Is(err, domain.ErrSessionVersionConflict) {
+		t.Errorf("Update of a stale copy err = %v, want %v", err, domain.ErrSessionVersionConflict)
+	}
+	if err := repo.Update(ctx, newSession(t, "alice", ""), 1); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Update missing err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+
+	// One of concurrent updates from the same version wins
+	base, _ := repo.Get(ctx, s.ID)
+	errs := concurrently(8, func(i int) error {
+		c := base.Clone()
+		c.Data["writer"] = fmt.Sprint(i)
+		return repo.Update(ctx, c, base.Version)
+	})
+	if ok, _ := countErrors(t, errs, domain.ErrSessionVersionConflict); ok != 1 {
+		t.Errorf("concurrent updates succeeded %d times, want 1", ok)
+	}
+	final, _ := repo.Get(ctx, s.ID)
+	if final.Version != base.Version+1 {
+		t.Errorf("Version after concurrent updates = %d, want %d", final.Version, base.Version+1)
+	}
+}
+
+func testConflictRecovery(t *testing.T, open Factory) {
+	dir := t.TempDir()
+	repo, closeRepo := start(t, open, dir)
+	if _, ok := repo.(io.Closer); !ok {
+		t.Skip("repository does not persist sessions")
+	}
+	ctx := context.Background()
+
+	s := newSession(t, "alice", "tmth_suite_conflict")
+	mustCreate(t, repo, s)
+
+	stale, _ := repo.Get(ctx, s.ID)
+	got, _ := repo.Get(ctx, s.ID)
+	got.Data["step"] = "1"
+	if err := repo.Update(ctx, got, got.Version); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Rejected updates are not there after reopen
+	stale.Data["step"] = "stale"
+	stale.TokenHash = "tmth_suite_conflict_stale"
+	if err := repo.Update(ctx, stale, stale.Version); !errors.Is(err, domain.ErrSessionVersionConflict) {
+		t.Fatalf("Update of a stale copy err = %v, want %v", err, domain.ErrSessionVersionConflict)
+	}
+	ahead := got.Clone()
+	ahead.Data["step"] = "ahead"
+	if err := repo.Update(ctx, ahead, got.Version+1); !errors.Is(err, domain.ErrSessionVersionConflict) {
+		t.Fatalf("Update with a future version err = %v, want %v", err, domain.ErrSessionVersionConflict)
+	}
+
+	before, _ := repo.Get(ctx, s.ID)
+	closeRepo()
+
+	repo, _ = start(t, open, dir)
+	after, err := repo.Get(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("Get after reopen failed: %v", err)
+	}
+	if !sameSession(after, before) {
+		t.Errorf("after reopen:\n got %+v\nwant %+v", after, before)
+	}
+	checkToken(t, repo, s.TokenHash, s.ID, nil)
+	checkToken(t, repo, stale.TokenHash, "", domain.ErrTokenInvalid)
+
+	// Updates go on from the version before reopen
+	after.Data["step"] = "2"
+	if err := repo.Update(ctx, after, before.Version); err != nil {
+		t.Fatalf("Update after reopen failed: %v", err)
+	}
+	if after.Version != before.Version+1 {
+		t.Errorf("Version after reopen and Update = %d, want %d", after.Version, before.Version+1)
+	}
+}
+
+func testQuota(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	var sessions []*domain.Session
+	for i := 0; i < Quota; i++ {
+		s := newSession(t, "alice", fmt.Sprintf("tmth_suite_quota_%d", i))
+		mustCreate(t, repo, s)
+		sessions = append(sessions, s)
+	}
+	over := newSession(t, "alice", "tmth_suite_quota_over")
+	if err := repo.Create(ctx, over); !errors.Is(err, domain.ErrSessionQuotaExceeded) {
+		t.Errorf("Create over quota err = %v, want %v", err, domain.ErrSessionQuotaExceeded)
+	}
+	if n, err := repo.CountByUserID(ctx, "alice"); err != nil || n != Quota {
+		t.Errorf("CountByUserID = %d, %v; want %d", n, err, Quota)
+	}
+
+	// The quota is per user
+	mustCreate(t, repo, newSession(t, "bob", "tmth_suite_quota_bob"))
+
+	// Deleting a session frees its place
+	if err := repo.Delete(ctx, sessions[0].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := repo.Create(ctx, over); err != nil {
+		t.Errorf("Create after Delete failed: %v", err)
+	}
+}
+
+func testTokenIndex(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	a := newSession(t, "alice", "tmth_suite_token_1")
+	mustCreate(t, repo, a)
+
+	// Rotation releases the old token hash and takes the new one
+	rotated, _ := repo.Get(ctx, a.ID)
+	rotated.TokenHash = "tmth_suite_token_2"
+	if err := repo.Update(ctx, rotated, rotated.Version); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := repo.Create(ctx, newSession(t, "bob", "tmth_suite_token_2")); !errors.Is(err, domain.ErrTokenHashConflict) {
+		t.Errorf("Create with the rotated token err = %v, want %v", err, domain.ErrTokenHashConflict)
+	}
+	b := newSession(t, "bob", "tmth_suite_token_1")
+	if err := repo.Create(ctx, b); err != nil {
+		t.Errorf("Create with the released token failed: %v", err)
+	}
+	checkToken(t, repo, "tmth_suite_token_1", b.ID, nil)
+	checkToken(t, repo, "tmth_suite_token_2", a.ID, nil)
+
+	// Delete releases the token hash
+	if err := repo.Delete(ctx, a.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	checkToken(t, repo, "tmth_suite_token_2", "", domain.ErrTokenInvalid)
+	mustCreate(t, repo, newSession(t, "carol", "tmth_suite_token_2"))
+
+	// So does DeleteByUserID
+	if n, err := repo.DeleteByUserID(ctx, "bob"); err != nil || n != 1 {
+		t.Errorf("DeleteByUserID = %d, %v; want 1", n, err)
+	}
+	checkToken(t, repo, "tmth_suite_token_1", "", domain.ErrTokenInvalid)
+	mustCreate(t, repo, newSession(t, "dave", "tmth_suite_token_1"))
+}
+
+func testExpiry(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	expired := newSession(t, "alice", "tmth_suite_expired")
+	expired.ExpiresAt = time.Now().Add(-time.Minute).UnixMilli()
+	live := newSession(t, "alice", "tmth_suite_live")
+	mustCreate(t, repo, expired, live)
+
+	if _, err := repo.Get(ctx, expired.ID); !errors.Is(err, domain.ErrSessionExpired) {
+		t.Errorf("Get expired err = %v, want %v", err, domain.ErrSessionExpired)
+	}
+	checkToken(t, repo, expired.TokenHash, "", domain.ErrSessionExpired)
+	if sessions, err := repo.ListByUserID(ctx, "alice"); err != nil || len(sessions) != 1 || sessions[0].ID != live.ID {
+		t.Errorf("ListByUserID = %v, %v; want only the live session", sessions, err)
+	}
+	for status, want := range map[string]string{"active": live.ID, "expired": expired.ID} {
+		sessions, total, err := repo.List(ctx, &service.SessionFilter{UserID: "alice", Status: status})
+		if err != nil || total != 1 || len(sessions) != 1 || sessions[0].ID != want {
+			t.Errorf("List(status=%s) = %v, %d, %v; want %s", status, sessions, total, err, want)
+		}
+	}
+
+	if n, err := repo.DeleteExpired(ctx); err != nil || n != 1 {
+		t.Errorf("DeleteExpired = %d, %v; want 1", n, err)
+	}
+	if _, err := repo.Get(ctx, expired.ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("Get after DeleteExpired err = %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if _, err := repo.Get(ctx, live.ID); err != nil {
+		t.Errorf("Get live after DeleteExpired failed: %v", err)
+	}
+	if n, err := repo.DeleteExpired(ctx); err != nil || n != 0 {
+		t.Errorf("second DeleteExpired = %d, %v; want 0", n, err)
+	}
+}
+
+func testList(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	// Seven sessions created a second apart by one API key, last active
+	// in the reverse order; even ones on phones with the gold tier. The
+	// lists cover more sessions than a bounded cache holds.
+	const n = 7
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	sessions := make([]*domain.Session, n)
+	for i := range sessions {
+		s := newSession(t, "lister", fmt.Sprintf("tmth_suite_list_%d", i))
+		s.CreatedAt = base.Add(time.Duration(i) * time.Second).UnixMilli()
+		s.LastActive = base.Add(time.Duration(n-i) * time.Minute).UnixMilli()
+		s.CreatedBy = "tmak-lister"
+		if i%2 == 0 {
+			s.DeviceID = fmt.Sprintf("phone-%d", i)
+			s.Data["tier"] = "gold"
+		} else {
+			s.DeviceID = fmt.Sprintf("laptop-%d", i)
+			s.Data["tier"] = "free"
+		}
+		sessions[i] = s
+	}
+	mustCreate(t, repo, sessions...)
+	other := newSession(t, "other", "tmth_suite_list_other")
+	other.DeviceID = "phone-other"
+	mustCreate(t, repo, other)
+
+	ids := func(list []*domain.Session) []string {
+		out := make([]string, len(list))
+		for i, s := range list {
+			out[i] = s.ID
+		}
+		return out
+	}
+	want := func(indexes ...int) []string {
+		out := make([]string, len(indexes))
+		for i, idx := range indexes {
+			out[i] = sessions[idx].ID
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		filter    service.SessionFilter
+		want      []string
+		wantTotal int
+	}{
+		{"newest first", service.SessionFilter{PageSize: 3}, want(6, 5, 4), n},
+		{"last page", service.SessionFilter{PageSize: 3, Page: 3}, want(0), n},
+		{"past the end", service.SessionFilter{PageSize: 3, Page: 4}, want(), n},
+		{"oldest first", service.SessionFilter{SortOrder: "asc", PageSize: 3}, want(0, 1, 2), n},
+		{"last active", service.SessionFilter{SortBy: "last_active", PageSize: 2}, want(0, 1), n},
+		{"device prefix", service.SessionFilter{DeviceIDPrefix: "phone-"}, want(6, 4, 2, 0), 4},
+		{"device", service.SessionFilter{DeviceID: "laptop-3"}, want(3), 1},
+		{"data", service.SessionFilter{Data: map[string]string{"tier": "free"}, SortOrder: "asc"}, want(1, 3, 5), 3},
+		{"created range", service.SessionFilter{
+			CreatedAfter:  timePtr(base.Add(2 * time.Second)),
+			CreatedBefore: timePtr(base.Add(4 * time.Second)),
+		}, want(3, 2), 2},
+		{"active after", service.SessionFilter{ActiveAfter: timePtr(base.Add(6 * time.Minute))}, want(1, 0), 2},
+	}
+	// Each case selects the sessions by user, and by API key
+	type scope struct {
+		name  string
+		apply func(f *service.SessionFilter)
+	}
+	scopes := []scope{
+		{"user", func(f *service.SessionFilter) { f.UserID = "lister" }},
+		{"created by", func(f *service.SessionFilter) { f.CreatedBy = "tmak-lister" }},
+	}
+	for _, sc := range scopes {
+		for _, tt := range tests {
+			filter := tt.filter
+			sc.apply(&filter)
+			got, total, err := repo.List(ctx, &filter)
+			if err != nil {
+				t.Errorf("%s, %s: List failed: %v", sc.name, tt.name, err)
+				continue
+			}
+			if !reflect.DeepEqual(ids(got), tt.want) && !(len(got) == 0 && len(tt.want) == 0) {
+				t.Errorf("%s, %s: List = %v, want %v", sc.name, tt.name, ids(got), tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("%s, %s: total = %d, want %d", sc.name, tt.name, total, tt.wantTotal)
+			}
+		}
+	}
+
+	// Filters selecting no user list every matching session
+	unscoped := []struct {
+		name      string
+		filter    service.SessionFilter
+		want      []string
+		wantTotal int
+	}{
+		{"all", service.SessionFilter{PageSize: 3, Page: 3}, want(1, 0), n + 1},
+		{"device", service.SessionFilter{DeviceID: "laptop-3"}, want(3), 1},
+		{"device prefix", service.SessionFilter{DeviceIDPrefix: "phone-", PageSize: 2}, []string{other.ID, sessions[6].ID}, 5},
+		{"data", service.SessionFilter{Data: map[string]string{"tier": "gold"}, SortOrder: "asc"}, want(0, 2, 4, 6), 4},
+	}
+	for _, tt := range unscoped {
+		filter := tt.filter
+		got, total, err := repo.List(ctx, &filter)
+		if err != nil {
+			t.Errorf("%s: List failed: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(ids(got), tt.want) {
+			t.Errorf("%s: List = %v, want %v", tt.name, ids(got), tt.want)
+		}
+		if total != tt.wantTotal {
+			t.Errorf("%s: total = %d, want %d", tt.name, total, tt.wantTotal)
+		}
+	}
+
+	// Keyset pagination visits every session once, in order
+	for _, sc := range append(scopes, scope{"all", func(*service.SessionFilter) {}}) {
+		listed := want(0, 1, 2, 3, 4, 5, 6)
+		if sc.name == "all" {
+			listed = append(listed, other.ID)
+		}
+		for _, order := range []string{"desc", "asc"} {
+			var visited []string
+			filter := service.SessionFilter{SortOrder: order, Limit: 3}
+			sc.apply(&filter)
+			for page := 0; page <= len(listed); page++ {
+				got, total, err := repo.List(ctx, &filter)
+				if err != nil {
+					t.Fatalf("keyset %s %s: List failed: %v", sc.name, order, err)
+				}
+				if total != -1 {
+					t.Errorf("keyset %s %s: total = %d, want -1", sc.name, order, total)
+				}
+				visited = append(visited, ids(got)...)
+				if len(got) < filter.Limit {
+					break
+				}
+				filter.Cursor = service.NewSessionCursor(got[len(got)-1], "created_at", order).Encode()
+			}
+			wantOrder := slices.Clone(listed)
+			if order == "desc" {
+				slices.Reverse(wantOrder)
+			}
+			if !reflect.DeepEqual(visited, wantOrder) {
+				t.Errorf("keyset %s %s visited %v, want %v", sc.name, order, visited, wantOrder)
+			}
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func testConcurrentCreateRevoke(t *testing.T, open Factory) {
+	repo, _ := start(t, open, t.TempDir())
+	ctx := context.Background()
+
+	// Concurrent creates respect the quota
+	racers := make([]*domain.Session, 2*Quota)
+	for i := range racers {
+		racers[i] = newSession(t, "racer", fmt.Sprintf("tmth_suite_race_%d", i))
+	}
+	errs := concurrently(len(racers), func(i int) error {
+		return repo.Create(ctx, racers[i])
+	})
+	if ok, _ := countErrors(t, errs, domain.ErrSessionQuotaExceeded); ok != Quota {
+		t.Errorf("concurrent creates succeeded %d times, want %d", ok, Quota)
+	}
+
+	// Concurrent creates with one token hash: one wins
+	holders := make([]*domain.Session, 8)
+	for i := range holders {
+		holders[i] = newSession(t, fmt.Sprintf("holder%d", i), "tmth_suite_race_shared")
+	}
+	errs = concurrently(len(holders), func(i int) error {
+		return repo.Create(ctx, holders[i])
+	})
+	if ok, _ := countErrors(t, errs, domain.ErrTokenHashConflict); ok != 1 {
+		t.Errorf("concurrent creates of one token succeeded %d times, want 1", ok)
+	}
+
+	// Concurrent revokes of one session: one wins
+	victim := newSession(t, "victim", "tmth_suite_race_victim")
+	mustCreate(t, repo, victim)
+	errs = concurrently(8, func(int) error {
+		return repo.Delete(ctx, victim.ID)
+	})
+	if ok, _ := countErrors(t, errs, domain.ErrSessionNotFound); ok != 1 {
+		t.Errorf("concurrent deletes succeeded %d times, want 1", ok)
+	}
+
+	// Creates racing a bulk revoke leave consistent indexes
+	mixers := make([]*domain.Session, Quota)
+	for i := range mixers {
+		mixers[i] = newSession(t, "mixer", fmt.Sprintf("tmth_suite_mix_%d", i))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			if _, err := repo.DeleteByUserID(ctx, "mixer"); err != nil {
+				t.Errorf("DeleteByUserID failed: %v", err)
+			}
+		}
+	}()
+	errs = concurrently(len(mixers), func(i int) error {
+		return repo.Create(ctx, mixers[i])
+	})
+	wg.Wait()
+	countErrors(t, errs, domain.ErrSessionQuotaExceeded)
+
+	count, _ := repo.CountByUserID(ctx, "mixer")
+	listed, _ := repo.ListByUserID(ctx, "mixer")
+	if count != len(listed) {
+		t.Errorf("CountByUserID = %d, ListByUserID has %d", count, len(listed))
+	}
+	if n, err := repo.DeleteByUserID(ctx, "mixer"); err != nil || n != count {
+		t.Errorf("final DeleteByUserID = %d, %v; want %d", n, err, count)
+	}
+	for _, s := range mixers {
+		checkToken(t, repo, s.TokenHash, "", domain.ErrTokenInvalid)
+	}
+}
+
+func testRecovery(t *testing.T, open Factory) {
+	dir := t.TempDir()
+	repo, closeRepo := start(t, open, dir)
+	if _, ok := repo.(io.Closer); !ok {
+		t.Skip("repository does not persist sessions")
+	}
+	ctx := context.Background()
+
+	var sessions []*domain.Session
+	for i := 0; i < 6; i++ {
+		s := newSession(t, fmt.Sprintf("user%d", i%2), fmt.Sprintf("tmth_suite_recover_%d", i))
+		s.Data["n"] = fmt.Sprint(i)
+		mustCreate(t, repo, s)
+		sessions = append(sessions, s)
+	}
+	rotated, _ := repo.Get(ctx, sessions[0].ID)
+	rotated.TokenHash = "tmth_suite_recover_rotated"
+	rotated.Data["rotated"] = "yes"
+	if err := repo.Update(ctx, rotated, rotated.Version); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := repo.Delete(ctx, sessions[1].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	before := userSessions(t, repo, "user0", "user1")
+	closeRepo()
+
+	repo, _ = start(t, open, dir)
+	after := userSessions(t, repo, "user0", "user1")
+	if len(after) != len(before) {
+		t.Fatalf("after reopen: %d sessions, want %d", len(after), len(before))
+	}
+	for i := range before {
+		if !sameSession(after[i], before[i]) {
+			t.Errorf("after reopen:\n got %+v\nwant %+v", after[i], before[i])
+		}
+	}
+
+	// The token index is recovered too
+	if err := repo.Create(ctx, newSession(t, "user9", "tmth_suite_recover_rotated")); !errors.Is(err, domain.ErrTokenHashConflict) {
+		t.Errorf("Create with a recovered token err = %v, want %v", err, domain.ErrTokenHashConflict)
+	}
+	mustCreate(t, repo, newSession(t, "user9", "tmth_suite_recover_0"))
+	mustCreate(t, repo, newSession(t, "user9", "tmth_suite_recover_1"))
+}
+
+// userSessions returns the sessions of the users, sorted by ID.
+func userSessions(t *testing.T, repo service.SessionRepository, userIDs ...string) []*domain.Session {
+	t.Helper()
+
+	var out []*domain.Session
+	for _, userID := range userIDs {
+		sessions, err := repo.ListByUserID(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("ListByUserID(%s) failed: %v", userID, err)
+		}
+		out = append(out, sessions...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// TouchSession records an access to a session: LastActive, and the
+// access IP and user agent when not empty. It logs a TOUCH entry instead
+// of the whole session and does not change the session version.
+//
+// With Config.TouchCoalesceInterval set, at most one touch per session
+// is logged per interval; the latest touch in between is applied to
+// memory at once and logged when the interval has passed, or on Close.
+func (e *Engine) TouchSession(ctx context.Context, id string, lastActive int64, ip, userAgent string) (*domain.Session, error) {
+	// Step 1: Write to WAL, unless coalesced
+	entry := wal.NewTouchEntry(id, lastActive, ip, userAgent)
+	logged := e.touches == nil || e.touches.admit(entry, time.Now().UnixMilli())
+	if e.kv != nil {
+		var session *domain.Session
+		err := e.kv.write(ctx, func() (err error) {
+			session, err = e.kv.touchLocked(ctx, id, lastActive, ip, userAgent, logged)
+			return err
+		})
+		return session, err
+	}
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+	if logged {
+		if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
+			return nil, fmt.Errorf("write wal: %w", err)
+		}
+	}
+
+	// Step 2: Update memory
+	session, err := e.store.ApplyTouch(ctx, id, lastActive, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	if logged {
+		e.lastWALOffset.Store(e.wal.CurrentOffset())
+	}
+	return session, nil
+}
+
+// TouchSessionBatch applies several touches as TouchSession does, logging
+// their TOUCH entries with a single WAL commit. It returns the updated
+// sessions and one error (or nil) per touch, in order; if the WAL commit
+// fails, every touch fails with that error.
+func (e *Engine) TouchSessionBatch(ctx context.Context, touches []service.SessionTouch) ([]*domain.Session, []error) {
+	sessions := make([]*domain.Session, len(touches))
+	errs := make([]error, len(touches))
+	if len(touches) == 0 {
+		return sessions, errs
+	}
+
+	// Step 1: Write to WAL, but the coalesced touches
+	now := time.Now().UnixMilli()
+	logged := make([]bool, len(touches))
+	var entries []*wal.Entry
+	for i, t := range touches {
+		entry := wal.NewTouchEntry(t.ID, t.LastActive, t.IP, t.UserAgent)
+		logged[i] = e.touches == nil || e.touches.admit(entry, now)
+		if logged[i] {
+			entries = append(entries, entry)
+		}
+	}
+	if e.kv != nil {
+		errs = e.kv.writeBatch(ctx, len(touches), func(i int) (err error) {
+			t := touches[i]
+			sessions[i], err = e.kv.touchLocked(ctx, t.ID, t.LastActive, t.IP, t.UserAgent, logged[i])
+			return err
+		})
+		return sessions, errs
+	}
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+	if len(entries) > 0 {
+		if err := e.wal.AppendBatchDurable(entries, walDurability(ctx)); err != nil {
+			err = fmt.Errorf("write wal: %w", err)
+			for i := range errs {
+				errs[i] = err
+			}
+			return sessions, errs
+		}
+	}
+
+	// Step 2: Update memory
+	for i, t := range touches {
+		sessions[i], errs[i] = e.store.ApplyTouch(ctx, t.ID, t.LastActive, t.IP, t.UserAgent)
+	}
+
+	if len(entries) > 0 {
+		e.lastWALOffset.Store(e.wal.CurrentOffset())
+	}
+	return sessions, errs
+}
+
+// SetSessionExpiry sets the expiration of a session (Unix milliseconds)
+// and its TTL hint (milliseconds), and LastActive when not zero. It logs
+// a SET_EXPIRY entry instead of the whole session and does not change the
+// session version.
+func (e *Engine) SetSessionExpiry(ctx context.Context, id string, expiresAt, ttl, lastActive int64) (*domain.Session, error) {
+	if e.kv != nil {
+		var session *domain.Session
+		err := e.kv.write(ctx, func() (err error) {
+			session, err = e.kv.setExpiryLocked(ctx, id, expiresAt, ttl, lastActive)
+			return err
+		})
+		return session, err
+	}
+
+	defer e.sessionMu.lock(id)()
+	e.applyMu.RLock()
+	defer e.applyMu.RUnlock()
+
+	// Step 1: Write to WAL
+	entry := wal.NewSetExpiryEntry(id, expiresAt, ttl, lastActive)
+	if err := e.wal.AppendDurable(entry, walDurability(ctx)); err != nil {
+		return nil, fmt.Errorf("write wal: %w", err)
+	}
+
+	// Step 2: Update memory
+	session, err := e.store.SetExpiry(ctx, id, expiresAt, ttl, lastActive)
+	if err != nil {
+		return nil, err
+	}
+
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
+	return session, nil
+}
+
+// flushTouches logs the coalesced touches whose interval has passed, or
+// all of them.
+func (e *Engine) flushTouches(all bool) {
+	if e.touches == nil {
+		return
+	}
+	entries := e.touches.due(time.Now().UnixMilli(), all)
+	if len(entries) == 0 {
+		return
+	}
+	if e.kv != nil {
+		ctx := context.Background()
+		errs := e.kv.writeBatch(ctx, len(entries), func(i int) error {
+			t := entries[i]
+			_, err := e.kv.touchLocked(ctx, t.SessionID, t.LastActive, t.AccessIP, t.AccessUA, true)
+			return err
+		})
+		for i, err := range errs {
+			if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+				e.logger.Error("write coalesced touch failed",
+					"session_id", entries[i].SessionID,
+					"error", err)
+			}
+		}
+		return
+	}
+	if err := e.wal.AppendBatch(entries); err != nil {
+		e.logger.Error("write coalesced touches failed",
+			"count", len(entries),
+			"error", err)
+		return
+	}
+	e.lastWALOffset.Store(e.wal.CurrentOffset())
+}
+
+// touchCoalescer limits TOUCH entries to one per session per interval,
+// keeping the latest touch in between until it is due.
+type touchCoalescer struct {
+	interval int64 // milliseconds
+
+	mu sync.Mutex
+	// logged holds the time each recently touched session was last logged.
+	logged map[string]int64
+	// pending holds the latest unlogged touch of each session.
+	pending map[string]*wal.Entry
+}
+
+func newTouchCoalescer(interval time.Duration) *touchCoalescer {
+	return &touchCoalescer{
+		interval: interval.Milliseconds(),
+		logged:   make(map[string]int64),
+		pending:  make(map[string]*wal.Entry),
+	}
+}
+
+// admit reports whether the touch e, made at now, is to be logged now.
+// Otherwise it becomes the pending touch of its session, keeping the
+// access IP and user agent of the one it replaces if it has none.
+func (c *touchCoalescer) admit(e *wal.Entry, now int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.logged[e.SessionID]; !ok || now-last >= c.interval {
+		c.logged[e.SessionID] = now
+		delete(c.pending, e.SessionID)
+		return true
+	}
+
+	if prev, ok := c.pending[e.SessionID]; ok {
+		if e.AccessIP == "" {
+			e.AccessIP = prev.AccessIP
+		}
+		if e.AccessUA == "" {
+			e.AccessUA = prev.AccessUA
+		}
+		if prev.LastActive > e.LastActive {
+			e.LastActive = prev.LastActive
+		}
+	}
+	c.pending[e.SessionID] = e
+	return false
+}
+
+// due removes and returns the pending touches whose interval has passed
+// at now, or all of them, and forgets sessions not touched for an
+// interval.
+func (c *touchCoalescer) due(now int64, all bool) []*wal.Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []*wal.Entry
+	for id, e := range c.pending {
+		if all || now-c.logged[id] >= c.interval {
+			out = append(out, e)
+			c.logged[id] = now
+			delete(c.pending, id)
+		}
+	}
+	for id, last := range c.logged {
+		if _, ok := c.pending[id]; !ok && now-last >= c.interval {
+			delete(c.logged, id)
+		}
+	}
+	return out
+}
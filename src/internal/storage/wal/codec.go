@@ -4,24 +4,39 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/crc32"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/codec"
 	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
 )
 
-type wirePayload struct {
-	Timestamp int64  `json:"ts"`
-	SessionID string `json:"sid"`
-	Version   uint64 `json:"ver,omitempty"`
-
-	Session *domain.Session `json:"session,omitempty"`
+// errMalformedPayload is returned for a binary payload that does not
+// decode although its frame CRC is valid.
+var errMalformedPayload = errors.New("wal: malformed entry payload")
 
-	// EncryptedSession is base64 of adaptive.Cipher.Encrypt(sessionJSON).
-	EncryptedSession string `json:"enc_session,omitempty"`
-}
+// Session kinds of a binary entry payload.
+const (
+	sessionNone      byte = 0
+	sessionPlain     byte = 1
+	sessionEncrypted byte = 2
+)
 
+// encodeEntryFrame encodes e as a frame of the current schema
+// (SchemaBinary). The binary payload is:
+//
+//	[Timestamp:varint][SessionID:string][Version:uvarint][Kind:1][Session]
+//
+// where Session is a codec session record (Kind 1), or the ciphertext of
+// one (Kind 2), to the end of the frame, and absent for DELETE (Kind 0).
+// TOUCH and SET_EXPIRY carry a change record in place of Session:
+//
+//	TOUCH:      [LastActive:varint][AccessIP:string][AccessUA:string]
+//	SET_EXPIRY: [ExpiresAt:varint][TTL:varint][LastActive:varint]
+//
+// so the access IP and user agent are encrypted like a session.
 func encodeEntryFrame(e *Entry, cipher adaptive.Cipher) ([]byte, error) {
 	if e == nil {
 		return nil, fmt.Errorf("wal: entry is nil")
@@ -29,73 +44,205 @@ func encodeEntryFrame(e *Entry, cipher adaptive.Cipher) ([]byte, error) {
 	if e.OpType == OpTypeUnspecified {
 		return nil, ErrInvalidEntryType
 	}
-	if e.OpType != OpTypeDelete && e.Session == nil {
+	if (e.OpType == OpTypeCreate || e.OpType == OpTypeUpdate) && e.Session == nil {
 		return nil, fmt.Errorf("wal: missing session for op %d", e.OpType)
 	}
 
-	p := wirePayload{
-		Timestamp: e.Timestamp,
-		SessionID: e.SessionID,
-		Version:   e.Version,
-	}
+	// Reserve the frame header: length, CRC and type.
+	out := make([]byte, headerSize+1, 256)
+	out[headerSize] = byte(e.OpType)
+	out = binary.AppendVarint(out, e.Timestamp)
+	out = binary.AppendUvarint(out, uint64(len(e.SessionID)))
+	out = append(out, e.SessionID...)
+	out = binary.AppendUvarint(out, e.Version)
 
-	if e.OpType != OpTypeDelete {
-		if cipher == nil {
-			p.Session = e.Session
-		} else {
-			plainSession, err := json.Marshal(e.Session)
-			if err != nil {
-				return nil, fmt.Errorf("wal: marshal session: %w", err)
-			}
-			encrypted, err := cipher.Encrypt(plainSession, nil)
-			if err != nil {
-				return nil, fmt.Errorf("wal: encrypt session: %w", err)
-			}
-			p.EncryptedSession = base64.StdEncoding.EncodeToString(encrypted)
+	switch {
+	case e.OpType == OpTypeDelete:
+		out = append(out, sessionNone)
+	case cipher == nil:
+		out = append(out, sessionPlain)
+		out = appendEntryBody(out, e)
+	default:
+		encrypted, err := cipher.Encrypt(appendEntryBody(nil, e), nil)
+		if err != nil {
+			return nil, fmt.Errorf("wal: encrypt session: %w", err)
 		}
+		out = append(out, sessionEncrypted)
+		out = append(out, encrypted...)
 	}
 
-	payload, err := json.Marshal(p)
-	if err != nil {
-		return nil, fmt.Errorf("wal: marshal payload: %w", err)
+	// Length = CRC(4) + Type(1) + Payload; CRC covers Type+Payload.
+	binary.BigEndian.PutUint32(out[0:4], uint32(len(out)-4))
+	binary.BigEndian.PutUint32(out[4:8], crc32.ChecksumIEEE(out[headerSize:]))
+	return out, nil
+}
+
+// appendEntryBody appends the session record, or the change record of a
+// TOUCH or SET_EXPIRY entry, to b.
+func appendEntryBody(b []byte, e *Entry) []byte {
+	switch e.OpType {
+	case OpTypeTouch:
+		b = binary.AppendVarint(b, e.LastActive)
+		b = appendString(b, e.AccessIP)
+		return appendString(b, e.AccessUA)
+	case OpTypeSetExpiry:
+		b = binary.AppendVarint(b, e.ExpiresAt)
+		b = binary.AppendVarint(b, e.TTL)
+		return binary.AppendVarint(b, e.LastActive)
+	default:
+		return codec.AppendSession(b, e.Session)
 	}
+}
 
-	typeByte := []byte{byte(e.OpType)}
-	crc := crc32.ChecksumIEEE(append(typeByte, payload...))
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
 
-	// Length = CRC(4) + Type(1) + Payload.
-	length := uint32(4 + 1 + len(payload))
-	if length < 5 {
-		return nil, ErrCorruptedEntry
+// decodeEntryBody decodes the session or change record of out from body.
+func decodeEntryBody(out *Entry, body []byte) error {
+	var err error
+	switch out.OpType {
+	case OpTypeTouch:
+		if out.LastActive, body, err = readVarint(body); err != nil {
+			return err
+		}
+		if out.AccessIP, body, err = readString(body); err != nil {
+			return err
+		}
+		if out.AccessUA, body, err = readString(body); err != nil {
+			return err
+		}
+	case OpTypeSetExpiry:
+		if out.ExpiresAt, body, err = readVarint(body); err != nil {
+			return err
+		}
+		if out.TTL, body, err = readVarint(body); err != nil {
+			return err
+		}
+		if out.LastActive, body, err = readVarint(body); err != nil {
+			return err
+		}
+	default:
+		if out.Session, _, err = codec.DecodeSession(body); err != nil {
+			return fmt.Errorf("wal: decode session: %w", err)
+		}
+		return nil
 	}
+	if len(body) != 0 {
+		return errMalformedPayload
+	}
+	return nil
+}
 
-	out := make([]byte, 0, 4+int(length))
-	var header [4]byte
-	binary.BigEndian.PutUint32(header[:], length)
-	out = append(out, header[:]...)
+func readVarint(b []byte) (int64, []byte, error) {
+	v, n := binary.Varint(b)
+	if n <= 0 {
+		return 0, nil, errMalformedPayload
+	}
+	return v, b[n:], nil
+}
 
-	var crcBuf [4]byte
-	binary.BigEndian.PutUint32(crcBuf[:], crc)
-	out = append(out, crcBuf[:]...)
+func readString(b []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return "", nil, errMalformedPayload
+	}
+	return string(b[n : n+int(l)]), b[n+int(l):], nil
+}
 
-	out = append(out, typeByte...)
-	out = append(out, payload...)
-	return out, nil
+// decodeFrame decodes a frame of a segment with the given schema.
+func decodeFrame(frame []byte, schema int, cipher adaptive.Cipher) (*Entry, error) {
+	if schema == SchemaJSON {
+		return decodeLegacyEntryFrame(frame, cipher)
+	}
+	return decodeEntryFrame(frame, cipher)
 }
 
-func decodeEntryFrame(frame []byte, cipher adaptive.Cipher) (*Entry, error) {
-	// Frame layout: [crc32:4][type:1][payload...]
+// checkFrame verifies the CRC of a frame ([crc32:4][type:1][payload...])
+// and returns its operation type and payload.
+func checkFrame(frame []byte) (OpType, []byte, error) {
 	if len(frame) < 5 {
-		return nil, ErrCorruptedEntry
+		return 0, nil, ErrCorruptedEntry
+	}
+	if crc32.ChecksumIEEE(frame[4:]) != binary.BigEndian.Uint32(frame[:4]) {
+		return 0, nil, ErrChecksumMismatch
 	}
+	op := OpType(frame[4])
+	switch op {
+	case OpTypeCreate, OpTypeUpdate, OpTypeDelete, OpTypeTouch, OpTypeSetExpiry:
+		return op, frame[5:], nil
+	default:
+		return 0, nil, ErrInvalidEntryType
+	}
+}
+
+// decodeEntryFrame decodes a frame of the current schema.
+func decodeEntryFrame(frame []byte, cipher adaptive.Cipher) (*Entry, error) {
+	op, payload, err := checkFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Entry{OpType: op}
+	var n int
+	if out.Timestamp, n = binary.Varint(payload); n <= 0 {
+		return nil, errMalformedPayload
+	}
+	payload = payload[n:]
+	idLen, n := binary.Uvarint(payload)
+	if n <= 0 || idLen > uint64(len(payload)-n) {
+		return nil, errMalformedPayload
+	}
+	out.SessionID = string(payload[n : n+int(idLen)])
+	payload = payload[n+int(idLen):]
+	if out.Version, n = binary.Uvarint(payload); n <= 0 || n >= len(payload) {
+		return nil, errMalformedPayload
+	}
+	kind, session := payload[n], payload[n+1:]
 
-	wantCRC := binary.BigEndian.Uint32(frame[:4])
-	typeByte := frame[4]
-	payload := frame[5:]
+	switch kind {
+	case sessionNone:
+		if op != OpTypeDelete {
+			return nil, fmt.Errorf("wal: missing session payload")
+		}
+		return out, nil
+	case sessionPlain:
+	case sessionEncrypted:
+		if cipher == nil {
+			return out, ErrCipherRequired
+		}
+		if session, err = cipher.Decrypt(session, nil); err != nil {
+			return nil, fmt.Errorf("wal: decrypt session: %w", err)
+		}
+	default:
+		return nil, errMalformedPayload
+	}
 
-	gotCRC := crc32.ChecksumIEEE(append([]byte{typeByte}, payload...))
-	if gotCRC != wantCRC {
-		return nil, ErrChecksumMismatch
+	if err := decodeEntryBody(out, session); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// wirePayload is the JSON payload of a SchemaJSON frame.
+type wirePayload struct {
+	Timestamp int64  `json:"ts"`
+	SessionID string `json:"sid"`
+	Version   uint64 `json:"ver,omitempty"`
+
+	Session *domain.Session `json:"session,omitempty"`
+
+	// EncryptedSession is base64 of adaptive.Cipher.Encrypt(sessionJSON).
+	EncryptedSession string `json:"enc_session,omitempty"`
+}
+
+// decodeLegacyEntryFrame decodes a frame of a SchemaJSON segment, written
+// before the binary encoding.
+func decodeLegacyEntryFrame(frame []byte, cipher adaptive.Cipher) (*Entry, error) {
+	op, payload, err := checkFrame(frame)
+	if err != nil {
+		return nil, err
 	}
 
 	var p wirePayload
@@ -103,13 +250,6 @@ func decodeEntryFrame(frame []byte, cipher adaptive.Cipher) (*Entry, error) {
 		return nil, fmt.Errorf("wal: unmarshal payload: %w", err)
 	}
 
-	op := OpType(typeByte)
-	switch op {
-	case OpTypeCreate, OpTypeUpdate, OpTypeDelete:
-	default:
-		return nil, ErrInvalidEntryType
-	}
-
 	out := &Entry{
 		OpType:    op,
 		Timestamp: p.Timestamp,
@@ -130,7 +270,7 @@ func decodeEntryFrame(frame []byte, cipher adaptive.Cipher) (*Entry, error) {
 		return nil, fmt.Errorf("wal: missing session payload")
 	}
 	if cipher == nil {
-		return nil, fmt.Errorf("wal: encrypted entry requires cipher")
+		return out, ErrCipherRequired
 	}
 
 	ciphertext, err := base64.StdEncoding.DecodeString(p.EncryptedSession)
@@ -150,4 +290,3 @@ func decodeEntryFrame(frame []byte, cipher adaptive.Cipher) (*Entry, error) {
 	out.Session = &sess
 	return out, nil
 }
-
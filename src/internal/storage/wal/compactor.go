@@ -4,9 +4,11 @@ package wal
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 )
 
 // DefaultRetainCount is the default number of WAL files to retain after compaction.
@@ -15,6 +17,7 @@ const DefaultRetainCount = 3
 // Compactor compacts WAL files to reduce disk usage.
 type Compactor struct {
 	walDir      string
+	archiveDir  string
 	retainCount int
 }
 
@@ -30,6 +33,14 @@ func WithRetainCount(count int) CompactorOption {
 	}
 }
 
+// WithArchiveDir makes Compact move segments to dir instead of deleting
+// them, so they can still be replayed for point-in-time recovery.
+func WithArchiveDir(dir string) CompactorOption {
+	return func(c *Compactor) {
+		c.archiveDir = dir
+	}
+}
+
 // NewCompactor creates a new WAL compactor.
 func NewCompactor(walDir string, opts ...CompactorOption) *Compactor {
 	c := &Compactor{
@@ -44,7 +55,8 @@ func NewCompactor(walDir string, opts ...CompactorOption) *Compactor {
 	return c
 }
 
-// Compact removes WAL segments that are fully covered by the given snapshot offset.
+// Compact removes WAL segments that are fully covered by the given snapshot offset,
+// or moves them to the archive directory if one is set.
 // It always retains at least retainCount segments.
 //
 // snapshotOffset uses the composite format: (segmentID<<32 | offsetWithinSegment).
@@ -83,21 +95,70 @@ func (c *Compactor) Compact(snapshotOffset uint64) error {
 		toDelete = toDelete[:len(toDelete)-keepCount]
 	}
 
-	// Delete old files
+	// Archive or delete old files
+	if c.archiveDir != "" {
+		if err := os.MkdirAll(c.archiveDir, DefaultDirPerm); err != nil {
+			return fmt.Errorf("wal: create archive dir: %w", err)
+		}
+	}
 	var errs []error
 	for _, file := range toDelete {
+		if c.archiveDir != "" {
+			if err := archiveSegment(file, filepath.Join(c.archiveDir, filepath.Base(file))); err != nil {
+				errs = append(errs, fmt.Errorf("archive %s: %w", file, err))
+			}
+			continue
+		}
 		if err := os.Remove(file); err != nil {
 			errs = append(errs, fmt.Errorf("remove %s: %w", file, err))
 		}
 	}
 
 	if len(errs) > 0 {
-		return fmt.Errorf("wal: failed to delete %d files: %w", len(errs), errors.Join(errs...))
+		return fmt.Errorf("wal: failed to compact %d files: %w", len(errs), errors.Join(errs...))
 	}
 
 	return nil
 }
 
+// archiveSegment moves a segment to target, copying it when target is on
+// another file system. The segment is removed only once the copy is
+// synced.
+func archiveSegment(path, target string) error {
+	if err := os.Rename(path, target); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := target + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, DefaultFilePerm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
 // NeedsCompaction returns true if the total WAL size exceeds the threshold.
 func (c *Compactor) NeedsCompaction(threshold int64) bool {
 	totalSize, _ := c.TotalSize()
@@ -132,6 +193,39 @@ func (c *Compactor) FileCount() (int, error) {
 	return len(files), nil
 }
 
+// SegmentFile describes a WAL segment file.
+type SegmentFile struct {
+	ID      uint64
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Segments returns the WAL segment files, oldest first.
+func (c *Compactor) Segments() ([]SegmentFile, error) {
+	files, err := c.listWALFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]SegmentFile, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			// Removed by a concurrent compaction.
+			continue
+		}
+		id, _ := c.parseSegmentID(file)
+		segments = append(segments, SegmentFile{
+			ID:      id,
+			Path:    file,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return segments, nil
+}
+
 // listWALFiles returns all WAL files sorted by index (oldest first).
 func (c *Compactor) listWALFiles() ([]string, error) {
 	entries, err := os.ReadDir(c.walDir)
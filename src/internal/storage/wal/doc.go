@@ -6,9 +6,13 @@
 // Features:
 //
 //   - Batched Writes: Configurable batch size and sync interval
+//   - Group Commit: Appends wait for an fsync shared with concurrent
+//     appends; each append can choose its durability (none, buffered,
+//     fsync)
 //   - File Rotation: Automatic rotation at configurable file sizes
 //   - Encryption: Optional encryption using adaptive ciphers
-//   - Compaction: Automatic cleanup of old WAL files after snapshots
+//   - Compaction: Automatic cleanup of old WAL files after snapshots, or
+//     moving them to an archive directory for point-in-time recovery
 //   - Recovery: Sequential replay for crash recovery
 //
 // Entry Types:
@@ -16,11 +20,13 @@
 //   - CREATE: New session creation
 //   - UPDATE: Session modification
 //   - DELETE: Session deletion
+//   - TOUCH: LastActive and access IP/UA, applied in place on replay
+//   - SET_EXPIRY: New expiration, applied in place on replay
 //
 // Format (AD-0105):
 //
 //	wal-<segment-id>.log
-//	[magic:8 "TOKMWAL\\x01"]
+//	[magic:8 "TOKMWAL" + schema byte]
 //	[Entry]*
 //	[checksum:32 SHA-256 of all bytes above] (optional for the active segment)
 //
@@ -31,7 +37,14 @@
 // Where:
 //   - Length = CRC32 + Type + Payload (big-endian uint32)
 //   - CRC32 covers Type+Payload (IEEE)
-//   - Payload is JSON (optionally includes an encrypted session blob)
+//   - Payload is binary (schema 2, written by this version):
+//     [Timestamp:varint][SessionID:string][Version:uvarint][Kind:1][Session]
+//     where Session is a codec session record, or its ciphertext when
+//     encryption is enabled; TOUCH and SET_EXPIRY carry only the changed
+//     fields in its place
+//
+// Segments of schema 1 (JSON payloads) are still read. An open schema 1
+// segment is sealed on startup and writing continues in a new segment.
 //
 // @design DS-0102
 package wal
@@ -3,6 +3,7 @@ package wal
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
@@ -25,6 +26,10 @@ var (
 	ErrCorruptedEntry   = errors.New("wal: corrupted entry")
 	ErrChecksumMismatch = errors.New("wal: checksum mismatch")
 	ErrInvalidEntryType = errors.New("wal: invalid entry type")
+
+	// ErrCipherRequired is returned for an encrypted entry decoded
+	// without a cipher.
+	ErrCipherRequired = errors.New("wal: encrypted entry requires cipher")
 )
 
 // OpType represents the type of operation in the WAL.
@@ -35,8 +40,44 @@ const (
 	OpTypeCreate
 	OpTypeUpdate
 	OpTypeDelete
+
+	// OpTypeTouch records an access to a session (LastActive and the
+	// access IP and user agent) without logging the session.
+	OpTypeTouch
+
+	// OpTypeSetExpiry records a new expiration of a session without
+	// logging the session.
+	OpTypeSetExpiry
 )
 
+// String returns the operation name, e.g. "create".
+func (t OpType) String() string {
+	switch t {
+	case OpTypeCreate:
+		return "create"
+	case OpTypeUpdate:
+		return "update"
+	case OpTypeDelete:
+		return "delete"
+	case OpTypeTouch:
+		return "touch"
+	case OpTypeSetExpiry:
+		return "set_expiry"
+	default:
+		return fmt.Sprintf("op(%d)", uint8(t))
+	}
+}
+
+// ParseOpType returns the operation named s, as returned by String.
+func ParseOpType(s string) (OpType, bool) {
+	for t := OpTypeCreate; t <= OpTypeSetExpiry; t++ {
+		if t.String() == s {
+			return t, true
+		}
+	}
+	return OpTypeUnspecified, false
+}
+
 // Legacy type alias for backward compatibility.
 type EntryType = OpType
 
@@ -50,12 +91,25 @@ const (
 // Entry represents one durable operation written to the WAL.
 //
 // Timestamp uses Unix milliseconds to match the Protobuf schema.
+//
+// TOUCH and SET_EXPIRY entries carry only the changed fields instead of
+// Session, and do not change the session version.
 type Entry struct {
 	OpType    OpType
 	Timestamp int64
 	SessionID string
 	Version   uint64
 	Session   *domain.Session
+
+	// LastActive is set by TOUCH, and by SET_EXPIRY when not zero.
+	LastActive int64
+	// AccessIP and AccessUA are set by TOUCH when not empty.
+	AccessIP string
+	AccessUA string
+
+	// ExpiresAt and TTL (milliseconds) are set by SET_EXPIRY.
+	ExpiresAt int64
+	TTL       int64
 }
 
 // NewCreateEntry creates a CREATE WAL entry.
@@ -88,3 +142,28 @@ func NewDeleteEntry(sessionID string) *Entry {
 		SessionID: sessionID,
 	}
 }
+
+// NewTouchEntry creates a TOUCH WAL entry.
+func NewTouchEntry(sessionID string, lastActive int64, ip, userAgent string) *Entry {
+	return &Entry{
+		OpType:     OpTypeTouch,
+		Timestamp:  time.Now().UnixMilli(),
+		SessionID:  sessionID,
+		LastActive: lastActive,
+		AccessIP:   ip,
+		AccessUA:   userAgent,
+	}
+}
+
+// NewSetExpiryEntry creates a SET_EXPIRY WAL entry. A zero lastActive
+// leaves LastActive unchanged.
+func NewSetExpiryEntry(sessionID string, expiresAt, ttl, lastActive int64) *Entry {
+	return &Entry{
+		OpType:     OpTypeSetExpiry,
+		Timestamp:  time.Now().UnixMilli(),
+		SessionID:  sessionID,
+		ExpiresAt:  expiresAt,
+		TTL:        ttl,
+		LastActive: lastActive,
+	}
+}
@@ -0,0 +1,216 @@
+// Package wal provides Write-Ahead Logging for durability.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yndnr/tokmesh-go/pkg/crypto/adaptive"
+)
+
+// SegmentReport describes a WAL segment file as found on disk, for
+// offline inspection and repair.
+type SegmentReport struct {
+	ID   uint64 `json:"id"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+
+	// Schema is the encoding of the segment's entries, SchemaJSON or
+	// SchemaBinary.
+	Schema int `json:"schema,omitempty"`
+
+	// Sealed reports a valid SHA-256 trailer, written when the writer
+	// rotated away from the segment; Checksum is the trailer in hex.
+	Sealed   bool   `json:"sealed"`
+	Checksum string `json:"checksum,omitempty"`
+
+	// Entries counts the intact entries, Encrypted those of them whose
+	// session could not be decrypted without a cipher.
+	Entries   int `json:"entries"`
+	Encrypted int `json:"encrypted,omitempty"`
+
+	// FirstOffset and LastOffset are the composite offsets of the first
+	// and last intact entry; FirstTimestamp and LastTimestamp their
+	// timestamps (Unix milliseconds).
+	FirstOffset    uint64 `json:"first_offset,omitempty"`
+	LastOffset     uint64 `json:"last_offset,omitempty"`
+	FirstTimestamp int64  `json:"first_timestamp,omitempty"`
+	LastTimestamp  int64  `json:"last_timestamp,omitempty"`
+
+	// ValidSize is the file size up to the end of the last intact
+	// entry, excluding the trailer.
+	ValidSize int64 `json:"valid_size"`
+
+	// Problem describes why the segment could not be read to its end;
+	// empty for a healthy segment.
+	Problem string `json:"problem,omitempty"`
+
+	// damaged is set when reading stopped at bytes that are not a whole
+	// entry with a valid CRC, as opposed to an intact entry that failed
+	// to decode (e.g. with the wrong cipher).
+	damaged bool
+}
+
+// EndOffset returns the composite offset just after the last intact
+// entry.
+func (s *SegmentReport) EndOffset() uint64 {
+	return s.ID<<32 | uint64(uint32(s.ValidSize))
+}
+
+// TornTail reports whether the segment is unsealed and ends with bytes
+// that are not an intact entry, as left by a crash during a write.
+// Truncating it to ValidSize repairs it.
+func (s *SegmentReport) TornTail() bool {
+	return !s.Sealed && s.damaged && s.ValidSize >= MagicBytesSize && s.ValidSize < s.Size
+}
+
+// ScanFunc is called for each intact entry with its composite offset.
+// An entry whose session is encrypted has a nil Session when scanned
+// without a cipher.
+type ScanFunc func(offset uint64, e *Entry) error
+
+// ScanSegments reads every segment in dir in order, reporting on each and
+// calling fn (if not nil) for its intact entries. Unlike Reader, it stops
+// a segment at its first damaged entry and records why, so damage is
+// reported rather than skipped. It fails only on I/O errors or when fn
+// fails.
+func ScanSegments(dir string, cipher adaptive.Cipher, fn ScanFunc) ([]*SegmentReport, error) {
+	r := &Reader{dirs: []string{dir}}
+	if err := r.scanSegments(); err != nil {
+		return nil, err
+	}
+
+	reports := make([]*SegmentReport, 0, len(r.segments))
+	for _, seg := range r.segments {
+		report, err := scanSegment(seg, cipher, fn)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func scanSegment(seg segmentInfo, cipher adaptive.Cipher, fn ScanFunc) (*SegmentReport, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	report := &SegmentReport{ID: seg.id, Path: seg.path, Size: stat.Size()}
+
+	if report.Size < MagicBytesSize {
+		report.Problem = "file shorter than the segment header"
+		return report, nil
+	}
+	sealed, dataLen, err := verifyChecksumTrailer(f, report.Size)
+	if errors.Is(err, errInvalidMagic) {
+		report.Problem = err.Error()
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if report.Schema, err = readSegmentSchema(f); err != nil {
+		return nil, err
+	}
+	if sealed {
+		report.Sealed = true
+		trailer := make([]byte, ChecksumSize)
+		if _, err := f.ReadAt(trailer, dataLen); err != nil {
+			return nil, err
+		}
+		report.Checksum = hex.EncodeToString(trailer)
+	}
+
+	pos := int64(MagicBytesSize)
+	report.ValidSize = pos
+	br := bufio.NewReader(io.NewSectionReader(f, pos, dataLen-pos))
+	for pos < dataLen {
+		var lenBuf [4]byte
+		if _, err := io.ReadFull(br, lenBuf[:]); err != nil {
+			report.Problem = fmt.Sprintf("truncated entry header at offset %d", pos)
+			report.damaged = true
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(lenBuf[:]))
+		if length < 5 || length > dataLen-pos-4 {
+			report.Problem = fmt.Sprintf("invalid entry length %d at offset %d", length, pos)
+			report.damaged = true
+			break
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return nil, err
+		}
+
+		e, err := decodeFrame(frame, report.Schema, cipher)
+		if errors.Is(err, ErrCipherRequired) {
+			report.Encrypted++
+		} else if err != nil {
+			report.Problem = fmt.Sprintf("entry at offset %d: %v", pos, err)
+			report.damaged = errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrCorruptedEntry) ||
+				errors.Is(err, ErrInvalidEntryType)
+			break
+		}
+
+		offset := seg.id<<32 | uint64(uint32(pos))
+		if report.Entries == 0 {
+			report.FirstOffset, report.FirstTimestamp = offset, e.Timestamp
+		}
+		report.LastOffset, report.LastTimestamp = offset, e.Timestamp
+		report.Entries++
+		if fn != nil {
+			if err := fn(offset, e); err != nil {
+				return nil, err
+			}
+		}
+
+		pos += 4 + length
+		report.ValidSize = pos
+	}
+	return report, nil
+}
+
+// TruncateSegment truncates an unsealed segment to size, dropping a torn
+// tail (see SegmentReport.TornTail). The server must not be running.
+func TruncateSegment(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR, DefaultFilePerm)
+	if err != nil {
+		return fmt.Errorf("wal: open segment: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("wal: stat segment: %w", err)
+	}
+	sealed, _, err := verifyChecksumTrailer(f, stat.Size())
+	if err != nil {
+		return err
+	}
+	if sealed {
+		return fmt.Errorf("wal: segment %s is sealed", path)
+	}
+	if size < MagicBytesSize || size > stat.Size() {
+		return fmt.Errorf("wal: invalid truncation size %d for a %d byte segment", size, stat.Size())
+	}
+
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("wal: truncate segment: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("wal: sync segment: %w", err)
+	}
+	return nil
+}
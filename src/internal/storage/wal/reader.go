@@ -25,23 +25,42 @@ type segmentInfo struct {
 
 // Reader reads WAL entries across all segments in order.
 type Reader struct {
-	dir    string
+	dirs   []string
 	cipher adaptive.Cipher
 
 	segments []segmentInfo
 	segIndex int
 
-	file     *os.File
-	dataLen  int64
-	startAt  int64
-	reader   *bufio.Reader
-	headerOK bool
+	file    *os.File
+	dataLen int64
+	startAt int64
+	reader  *bufio.Reader
+	schema  int
+
+	// segID and pos locate the next entry of the open segment; start
+	// and offset are the composite offsets of the entry last read and
+	// just past it.
+	segID  uint64
+	pos    int64
+	start  uint64
+	offset uint64
 }
 
 // NewReader creates a new WAL reader for a directory.
 func NewReader(dir string, cipher adaptive.Cipher) (*Reader, error) {
+	return newReader([]string{dir}, cipher)
+}
+
+// NewArchiveReader creates a WAL reader for the segments of dir and of
+// archiveDir, where compaction archives them (see WithArchiveDir). A
+// segment found in both is read from dir.
+func NewArchiveReader(dir, archiveDir string, cipher adaptive.Cipher) (*Reader, error) {
+	return newReader([]string{dir, archiveDir}, cipher)
+}
+
+func newReader(dirs []string, cipher adaptive.Cipher) (*Reader, error) {
 	r := &Reader{
-		dir:    dir,
+		dirs:   dirs,
 		cipher: cipher,
 	}
 	if err := r.scanSegments(); err != nil {
@@ -66,10 +85,34 @@ func (r *Reader) Seek(offset uint64) error {
 	r.closeCurrent()
 	r.segIndex = i
 	r.startAt = segOff
-	r.headerOK = false
+	if i < len(r.segments) && r.segments[i].id != segID {
+		// The offset's segment is missing; start at the next one.
+		r.startAt = 0
+	}
 	return nil
 }
 
+// Offset returns the composite offset just past the entry last returned
+// by Read, where a snapshot covering it continues.
+func (r *Reader) Offset() uint64 {
+	return r.offset
+}
+
+// EntryOffset returns the composite offset of the entry last returned by
+// Read.
+func (r *Reader) EntryOffset() uint64 {
+	return r.start
+}
+
+// SegmentIDs returns the IDs of the segments read, in order.
+func (r *Reader) SegmentIDs() []uint64 {
+	ids := make([]uint64, len(r.segments))
+	for i, seg := range r.segments {
+		ids[i] = seg.id
+	}
+	return ids
+}
+
 // Read reads the next entry from the WAL stream.
 func (r *Reader) Read() (*Entry, error) {
 	for {
@@ -80,19 +123,6 @@ func (r *Reader) Read() (*Entry, error) {
 			}
 		}
 
-		// Ensure header is consumed when starting at offset 0.
-		if !r.headerOK && r.startAt == 0 {
-			if err := r.readAndValidateHeader(); err != nil {
-				if errors.Is(err, ErrCorrupted) || errors.Is(err, errChecksumInvalid) {
-					r.closeCurrent()
-					continue
-				}
-				return nil, err
-			}
-		} else {
-			r.headerOK = true
-		}
-
 		e, err := r.readOneEntry()
 		if err != nil {
 			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
@@ -130,28 +160,31 @@ func (r *Reader) Close() error {
 }
 
 func (r *Reader) scanSegments() error {
-	entries, err := os.ReadDir(r.dir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			r.segments = nil
-			return nil
-		}
-		return err
-	}
-
 	var segs []segmentInfo
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
+	seen := make(map[uint64]bool)
+	for _, dir := range r.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
 		}
-		id, ok := parseSegmentFilename(e.Name())
-		if !ok {
-			continue
+
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			id, ok := parseSegmentFilename(e.Name())
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			segs = append(segs, segmentInfo{
+				id:   id,
+				path: filepath.Join(dir, e.Name()),
+			})
 		}
-		segs = append(segs, segmentInfo{
-			id:   id,
-			path: filepath.Join(r.dir, e.Name()),
-		})
 	}
 	sort.Slice(segs, func(i, j int) bool { return segs[i].id < segs[j].id })
 	r.segments = segs
@@ -203,32 +236,27 @@ func (r *Reader) openNextSegment() error {
 		// already verified by verifyChecksumTrailer
 	}
 
-	// Start from requested offset. If startAt==0, we will read magic+header.
-	sr := io.NewSectionReader(f, r.startAt, r.dataLen-r.startAt)
-	r.reader = bufio.NewReader(sr)
+	// The magic bytes give the schema of the entries.
+	r.schema, err = readSegmentSchema(f)
+	if err != nil {
+		r.closeCurrent()
+		return err
+	}
 
-	r.headerOK = false
+	// Start from requested offset, or after the magic bytes.
+	start := max(r.startAt, MagicBytesSize)
+	sr := io.NewSectionReader(f, start, r.dataLen-start)
+	r.reader = bufio.NewReader(sr)
+	r.segID = seg.id
+	r.pos = start
 
 	// After first segment, subsequent segments start at 0.
 	r.startAt = 0
 	return nil
 }
 
-func (r *Reader) readAndValidateHeader() error {
-	magic := make([]byte, MagicBytesSize)
-	if _, err := io.ReadFull(r.reader, magic); err != nil {
-		return err
-	}
-	if string(magic) != MagicBytes {
-		return errInvalidMagic
-	}
-	r.headerOK = true
-	return nil
-}
-
 func (r *Reader) closeCurrent() error {
 	r.reader = nil
-	r.headerOK = false
 
 	if r.file != nil {
 		err := r.file.Close()
@@ -254,7 +282,17 @@ func (r *Reader) readOneEntry() (*Entry, error) {
 		return nil, err
 	}
 
-	return decodeEntryFrame(frame, r.cipher)
+	start := r.segID<<32 | uint64(uint32(r.pos))
+	r.pos += 4 + int64(length)
+	end := r.segID<<32 | uint64(uint32(r.pos))
+
+	e, err := decodeFrame(frame, r.schema, r.cipher)
+	if err != nil {
+		return nil, err
+	}
+	r.start = start
+	r.offset = end
+	return e, nil
 }
 
 // VerifyTrailerChecksum is a helper used by tests.
@@ -1,9 +1,16 @@
 package wal
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 	"github.com/yndnr/tokmesh-go/internal/core/domain"
@@ -197,6 +204,102 @@ func TestCompactor_Compact(t *testing.T) {
 	}
 }
 
+func TestCompactor_CompactToArchive(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(t.TempDir(), "archive")
+
+	cfg := DefaultConfig(dir)
+	cfg.SyncMode = SyncModeSync
+	cfg.MaxEntryCount = 1
+	w, err := NewWriter(cfg)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	var ends []uint64
+	for i := 0; i < 5; i++ {
+		if err := w.AppendBatch([]*Entry{NewDeleteEntry(fmt.Sprintf("s%d", i))}); err != nil {
+			t.Fatalf("AppendBatch: %v", err)
+		}
+		ends = append(ends, w.CurrentOffset())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	c := NewCompactor(dir, WithRetainCount(2), WithArchiveDir(archiveDir))
+	if err := c.Compact(uint64(5) << 32); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if n, _ := c.FileCount(); n != 2 {
+		t.Fatalf("FileCount = %d, want 2", n)
+	}
+	archived, err := NewCompactor(archiveDir).FileCount()
+	if err != nil || archived != 3 {
+		t.Fatalf("archived segments = %d (%v), want 3", archived, err)
+	}
+
+	// The archive and the WAL read back as one log, with offsets.
+	r, err := NewArchiveReader(dir, archiveDir, nil)
+	if err != nil {
+		t.Fatalf("NewArchiveReader: %v", err)
+	}
+	defer r.Close()
+	if got := r.SegmentIDs(); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4, 5}) {
+		t.Fatalf("SegmentIDs = %v", got)
+	}
+	for i := 0; i < 5; i++ {
+		e, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("s%d", i); e.SessionID != want {
+			t.Errorf("entry %d = %s, want %s", i, e.SessionID, want)
+		}
+		if r.Offset() != ends[i] {
+			t.Errorf("Offset after entry %d = %x, want %x", i, r.Offset(), ends[i])
+		}
+	}
+}
+
+func TestReader_SeekMissingSegment(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig(dir)
+	cfg.SyncMode = SyncModeSync
+	cfg.MaxEntryCount = 1
+	w, err := NewWriter(cfg)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.AppendBatch([]*Entry{NewDeleteEntry(fmt.Sprintf("s%d", i))}); err != nil {
+			t.Fatalf("AppendBatch: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, formatSegmentFilename(2))); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	// An offset within a missing segment starts at the next one's start.
+	r, err := NewReader(dir, nil)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.Seek(uint64(2)<<32 | 20); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	e, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if e.SessionID != "s2" {
+		t.Errorf("SessionID = %s, want s2", e.SessionID)
+	}
+}
+
 func TestWriter_RotationByEntryCount(t *testing.T) {
 	dir := t.TempDir()
 
@@ -569,6 +672,104 @@ func TestWriter_Flush(t *testing.T) {
 	}
 }
 
+func TestWriter_OnSyncAndSize(t *testing.T) {
+	dir := t.TempDir()
+
+	var syncs int
+	w, err := NewWriter(Config{
+		Dir:      dir,
+		SyncMode: SyncModeSync,
+		OnSync: func(d time.Duration) {
+			if d < 0 {
+				t.Errorf("OnSync duration = %v", d)
+			}
+			syncs++
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+
+	s, _ := domain.NewSession("user1")
+	s.TokenHash = "sync_test"
+	s.SetExpiration(time.Hour)
+	if err := w.AppendBatch([]*Entry{NewCreateEntry(s)}); err != nil {
+		t.Fatalf("AppendBatch: %v", err)
+	}
+	if syncs != 1 {
+		t.Errorf("OnSync calls = %d, want 1", syncs)
+	}
+
+	size, err := w.Size()
+	if err != nil {
+		t.Fatalf("Size: %v", err)
+	}
+	if want := int64(w.CurrentOffset() & 0xFFFFFFFF); size != want {
+		t.Errorf("Size = %d, want %d", size, want)
+	}
+}
+
+func TestWriter_AppendBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewWriter(Config{
+		Dir:           dir,
+		SyncMode:      SyncModeSync,
+		BatchCount:    1000, // Thresholds never reached by the batch itself
+		BatchBytes:    1 << 20,
+		MaxFileSize:   DefaultMaxFileSize,
+		MaxEntryCount: DefaultMaxEntryCount,
+	})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+
+	before := w.CurrentOffset()
+
+	var entries []*Entry
+	for i := 0; i < 5; i++ {
+		s, _ := domain.NewSession("user1")
+		s.TokenHash = fmt.Sprintf("batch_%d", i)
+		s.SetExpiration(time.Hour)
+		entries = append(entries, NewCreateEntry(s))
+	}
+	entries = append(entries, NewDeleteEntry(entries[0].SessionID))
+
+	if err := w.AppendBatch(entries); err != nil {
+		t.Fatalf("AppendBatch: %v", err)
+	}
+
+	// The batch is committed immediately, not left in the buffer
+	if w.CurrentOffset() == before {
+		t.Error("AppendBatch should flush the batch")
+	}
+	if err := w.AppendBatch(nil); err != nil {
+		t.Errorf("AppendBatch(nil): %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, err := NewReader(dir, nil)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+
+	got, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("ReadAll returned %d entries, want %d", len(got), len(entries))
+	}
+	if got[5].OpType != OpTypeDelete || got[5].SessionID != entries[0].SessionID {
+		t.Errorf("last entry = %+v, want delete of %s", got[5], entries[0].SessionID)
+	}
+}
+
 func TestWriter_BatchModeSyncLoop(t *testing.T) {
 	dir := t.TempDir()
 
@@ -600,6 +801,107 @@ func TestWriter_BatchModeSyncLoop(t *testing.T) {
 	}
 }
 
+func TestWriter_GroupCommit(t *testing.T) {
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var commits, committed int
+	w, err := NewWriter(Config{
+		Dir:      dir,
+		SyncMode: SyncModeGroup,
+		// Slow fsyncs make concurrent appends pile up behind them.
+		OnSync: func(time.Duration) { time.Sleep(2 * time.Millisecond) },
+		OnCommit: func(entries int, _ time.Duration) {
+			mu.Lock()
+			commits++
+			committed += entries
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+
+	const writers, perWriter = 16, 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				if err := w.Append(NewDeleteEntry(fmt.Sprintf("tmss-%d-%d", i, j))); err != nil {
+					t.Errorf("Append: %v", err)
+					return
+				}
+				// Acknowledged entries are fsynced.
+				w.mu.Lock()
+				synced := w.synced
+				w.mu.Unlock()
+				if synced == 0 {
+					t.Error("Append returned before its entry was fsynced")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	w.mu.Lock()
+	synced, appended := w.synced, w.appended
+	w.mu.Unlock()
+	if synced != appended || appended != writers*perWriter {
+		t.Errorf("synced %d of %d appended entries", synced, appended)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if committed != writers*perWriter {
+		t.Errorf("OnCommit reported %d entries, want %d", committed, writers*perWriter)
+	}
+	if commits >= committed {
+		t.Errorf("%d commits for %d entries, want fsyncs shared", commits, committed)
+	}
+}
+
+func TestWriter_AppendDurable(t *testing.T) {
+	dir := t.TempDir()
+
+	var syncs int
+	w, err := NewWriter(Config{
+		Dir:          dir,
+		SyncMode:     SyncModeBatch,
+		SyncInterval: time.Hour,
+		BatchCount:   1000,
+		OnSync:       func(time.Duration) { syncs++ },
+	})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+
+	check := func(d Durability, written, synced uint64) {
+		t.Helper()
+		if err := w.AppendDurable(NewDeleteEntry("tmss-"+d.String()), d); err != nil {
+			t.Fatalf("AppendDurable(%s): %v", d, err)
+		}
+		if w.written != written || w.synced != synced {
+			t.Errorf("after %s: written %d, synced %d; want %d, %d", d, w.written, w.synced, written, synced)
+		}
+	}
+	check(DurabilityDefault, 0, 0) // batch mode: buffered in memory
+	check(DurabilityNone, 0, 0)
+	check(DurabilityBuffered, 3, 0)
+	if syncs != 0 {
+		t.Errorf("%d fsyncs before DurabilityFsync", syncs)
+	}
+	check(DurabilityFsync, 4, 4)
+	if err := w.AppendBatchDurable([]*Entry{NewDeleteEntry("a"), NewDeleteEntry("b")}, DurabilityNone); err != nil {
+		t.Fatalf("AppendBatchDurable: %v", err)
+	}
+	if w.written != 6 || w.synced != 4 {
+		t.Errorf("batch with DurabilityNone: written %d, synced %d; want 6, 4", w.written, w.synced)
+	}
+}
+
 func TestOpTypeConstants(t *testing.T) {
 	if OpTypeUnspecified != 0 {
 		t.Fatalf("OpTypeUnspecified = %d, want 0", OpTypeUnspecified)
@@ -613,6 +915,9 @@ func TestOpTypeConstants(t *testing.T) {
 	if OpTypeDelete != 3 {
 		t.Fatalf("OpTypeDelete = %d, want 3", OpTypeDelete)
 	}
+	if OpTypeTouch != 4 || OpTypeSetExpiry != 5 {
+		t.Fatalf("OpTypeTouch = %d, OpTypeSetExpiry = %d, want 4 and 5", OpTypeTouch, OpTypeSetExpiry)
+	}
 }
 
 func TestErrorConstants(t *testing.T) {
@@ -1411,11 +1716,16 @@ func TestReader_Seek(t *testing.T) {
 		t.Fatalf("NewWriter: %v", err)
 	}
 
+	var afterFirst uint64
 	for i := 0; i < 3; i++ {
 		s, _ := domain.NewSession(fmt.Sprintf("user%d", i))
 		s.TokenHash = fmt.Sprintf("seek_test_%d", i)
 		s.SetExpiration(time.Hour)
 		w.Append(NewCreateEntry(s))
+		if i == 0 {
+			w.Flush()
+			afterFirst = w.CurrentOffset()
+		}
 	}
 	w.Close()
 
@@ -1439,4 +1749,436 @@ func TestReader_Seek(t *testing.T) {
 	if len(entries) != 3 {
 		t.Errorf("got %d entries, want 3", len(entries))
 	}
+
+	// Seek past the first entry, as recovery does after a snapshot
+	if err := r.Seek(afterFirst); err != nil {
+		t.Fatalf("Seek(%d): %v", afterFirst, err)
+	}
+	entries, err = r.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll after mid-segment Seek: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Session.UserID != "user1" {
+		t.Errorf("got %d entries after mid-segment Seek, want user1 and user2", len(entries))
+	}
+}
+
+func TestScanSegments_TornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewWriter(Config{
+		Dir:           dir,
+		SyncMode:      SyncModeSync,
+		BatchCount:    1,
+		BatchBytes:    1,
+		MaxFileSize:   DefaultMaxFileSize,
+		MaxEntryCount: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s, _ := domain.NewSession(fmt.Sprintf("u%d", i))
+		s.TokenHash = fmt.Sprintf("tmth_scan%d", i)
+		s.SetExpiration(time.Hour)
+		if err := w.Append(NewCreateEntry(s)); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Unseal the last segment and leave half an entry behind it, like
+	// a crash in the middle of a write.
+	last := filepath.Join(dir, formatSegmentFilename(2))
+	st, err := os.Stat(last)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if err := os.Truncate(last, st.Size()-ChecksumSize); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	f, err := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 0xde, 0xad})
+	f.Close()
+
+	var offsets []uint64
+	reports, err := ScanSegments(dir, nil, func(offset uint64, e *Entry) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanSegments: %v", err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("reports = %d, want 2", len(reports))
+	}
+
+	first, second := reports[0], reports[1]
+	if !first.Sealed || first.Checksum == "" || first.Entries != 2 || first.Problem != "" || first.TornTail() {
+		t.Errorf("first segment = %+v", first)
+	}
+	if first.FirstOffset != 1<<32|MagicBytesSize {
+		t.Errorf("first offset = %#x", first.FirstOffset)
+	}
+	if second.Sealed || second.Entries != 1 || second.Problem == "" || !second.TornTail() {
+		t.Errorf("second segment = %+v", second)
+	}
+	if second.Size-second.ValidSize != 6 {
+		t.Errorf("valid size %d of %d, want 6 torn bytes", second.ValidSize, second.Size)
+	}
+	if len(offsets) != 3 || offsets[2] != second.FirstOffset {
+		t.Errorf("scanned offsets = %x", offsets)
+	}
+
+	// Repair, after which a resumed writer appends readable entries.
+	if err := TruncateSegment(first.Path, first.ValidSize); err == nil {
+		t.Error("TruncateSegment of a sealed segment should fail")
+	}
+	if err := TruncateSegment(second.Path, second.ValidSize); err != nil {
+		t.Fatalf("TruncateSegment: %v", err)
+	}
+	reports, err = ScanSegments(dir, nil, nil)
+	if err != nil {
+		t.Fatalf("ScanSegments: %v", err)
+	}
+	if reports[1].Problem != "" || reports[1].TornTail() {
+		t.Errorf("repaired segment = %+v", reports[1])
+	}
+}
+
+func TestScanSegments_EncryptedWithoutCipher(t *testing.T) {
+	dir := t.TempDir()
+	c, err := adaptive.New(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("adaptive.New: %v", err)
+	}
+
+	w, err := NewWriter(Config{Dir: dir, SyncMode: SyncModeSync, BatchCount: 1, BatchBytes: 1, Cipher: c})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	s, _ := domain.NewSession("u1")
+	s.TokenHash = "tmth_enc"
+	if err := w.Append(NewCreateEntry(s)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := w.Append(NewDeleteEntry(s.ID)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	w.Close()
+
+	var ids []string
+	reports, err := ScanSegments(dir, nil, func(offset uint64, e *Entry) error {
+		if e.Session != nil {
+			t.Errorf("entry at %#x has a session without the cipher", offset)
+		}
+		ids = append(ids, e.SessionID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanSegments: %v", err)
+	}
+	if reports[0].Entries != 2 || reports[0].Encrypted != 1 || reports[0].Problem != "" {
+		t.Errorf("report = %+v", reports[0])
+	}
+	if len(ids) != 2 || ids[0] != s.ID {
+		t.Errorf("session IDs = %v", ids)
+	}
+}
+
+// writeJSONSegment writes a segment of the SchemaJSON format, as written
+// before the binary encoding, sealing it if sealed is set.
+func writeJSONSegment(t *testing.T, path string, sealed bool, entries ...*Entry) {
+	t.Helper()
+	buf := []byte(magicPrefix + "\x01")
+	for _, e := range entries {
+		payload, err := json.Marshal(wirePayload{
+			Timestamp: e.Timestamp,
+			SessionID: e.SessionID,
+			Version:   e.Version,
+			Session:   e.Session,
+		})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		body := append([]byte{byte(e.OpType)}, payload...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(4+len(body)))
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(body))
+		buf = append(buf, body...)
+	}
+	if sealed {
+		sum := sha256.Sum256(buf)
+		buf = append(buf, sum[:]...)
+	}
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestReader_JSONSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	s1, _ := domain.NewSession("u1")
+	s1.TokenHash = "tmth_json_1"
+	s1.Data = map[string]string{"k": "v"}
+	s1.SetExpiration(time.Hour)
+	s2, _ := domain.NewSession("u2")
+	s2.TokenHash = "tmth_json_2"
+	s2.SetExpiration(time.Hour)
+
+	// A sealed and an open segment of an upgraded node.
+	writeJSONSegment(t, filepath.Join(dir, formatSegmentFilename(1)), true, NewCreateEntry(s1))
+	writeJSONSegment(t, filepath.Join(dir, formatSegmentFilename(2)), false, NewCreateEntry(s2), NewDeleteEntry(s1.ID))
+
+	// The writer seals the open JSON segment and continues in a new
+	// binary one.
+	w, err := NewWriter(Config{Dir: dir, SyncMode: SyncModeSync, BatchCount: 1})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if got := w.CurrentOffset() >> 32; got != 3 {
+		t.Errorf("writer segment = %d, want 3", got)
+	}
+	s3, _ := domain.NewSession("u3")
+	s3.TokenHash = "tmth_binary_3"
+	s3.SetExpiration(time.Hour)
+	if err := w.Append(NewUpdateEntry(s3)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := VerifyTrailerChecksum(filepath.Join(dir, formatSegmentFilename(2))); err != nil {
+		t.Errorf("JSON segment not sealed: %v", err)
+	}
+
+	r, err := NewReader(dir, nil)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	entries, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	if entries[0].Session.Data["k"] != "v" || entries[1].Session.TokenHash != s2.TokenHash {
+		t.Errorf("JSON entries = %+v, %+v", entries[0].Session, entries[1].Session)
+	}
+	if entries[2].OpType != OpTypeDelete || entries[2].SessionID != s1.ID {
+		t.Errorf("delete entry = %+v", entries[2])
+	}
+	if entries[3].OpType != OpTypeUpdate || entries[3].Session.TokenHash != s3.TokenHash {
+		t.Errorf("binary entry = %+v", entries[3])
+	}
+
+	reports, err := ScanSegments(dir, nil, nil)
+	if err != nil {
+		t.Fatalf("ScanSegments: %v", err)
+	}
+	for i, want := range []int{SchemaJSON, SchemaJSON, SchemaBinary} {
+		if reports[i].Schema != want || !reports[i].Sealed || reports[i].Problem != "" {
+			t.Errorf("segment %d: schema %d, sealed %v, problem %q", reports[i].ID, reports[i].Schema, reports[i].Sealed, reports[i].Problem)
+		}
+	}
+}
+
+func TestCodec_BinaryRoundTrip(t *testing.T) {
+	s, _ := domain.NewSession("u1")
+	s.TokenHash = "tmth_rt"
+	s.IPAddress = "10.0.0.1"
+	s.Data = map[string]string{"a": "1", "b": "2"}
+	s.SetExpiration(time.Hour)
+	s.Version = 4
+
+	for _, e := range []*Entry{NewCreateEntry(s), NewUpdateEntry(s), NewDeleteEntry(s.ID)} {
+		frame, err := encodeEntryFrame(e, nil)
+		if err != nil {
+			t.Fatalf("encodeEntryFrame: %v", err)
+		}
+		got, err := decodeEntryFrame(frame[4:], nil)
+		if err != nil {
+			t.Fatalf("decodeEntryFrame(%s): %v", e.OpType, err)
+		}
+		if got.OpType != e.OpType || got.Timestamp != e.Timestamp || got.SessionID != e.SessionID || got.Version != e.Version {
+			t.Errorf("%s entry = %+v, want %+v", e.OpType, got, e)
+		}
+		if e.Session != nil && !reflect.DeepEqual(got.Session, e.Session) {
+			t.Errorf("%s session = %+v, want %+v", e.OpType, got.Session, e.Session)
+		}
+	}
+
+	// A payload that does not decode under a valid CRC is not reported as
+	// frame damage.
+	body := []byte{byte(OpTypeCreate), 0xFF}
+	frame := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(body))
+	if _, err := decodeEntryFrame(append(frame, body...), nil); !errors.Is(err, errMalformedPayload) {
+		t.Errorf("decodeEntryFrame = %v, want errMalformedPayload", err)
+	}
+}
+
+func TestCodec_TouchAndSetExpiry(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	c, err := adaptive.New(key)
+	if err != nil {
+		t.Fatalf("adaptive.New: %v", err)
+	}
+
+	entries := []*Entry{
+		NewTouchEntry("tmss-touch", 1700000000123, "192.0.2.7", "curl/8.0"),
+		NewTouchEntry("tmss-touch", 1700000000456, "", ""),
+		NewSetExpiryEntry("tmss-touch", 1700003600000, 3600000, 1700000000789),
+		NewSetExpiryEntry("tmss-touch", 1700003600000, 3600000, 0),
+	}
+	for _, cipher := range []adaptive.Cipher{nil, c} {
+		for _, e := range entries {
+			frame, err := encodeEntryFrame(e, cipher)
+			if err != nil {
+				t.Fatalf("encodeEntryFrame(%s): %v", e.OpType, err)
+			}
+			got, err := decodeEntryFrame(frame[4:], cipher)
+			if err != nil {
+				t.Fatalf("decodeEntryFrame(%s): %v", e.OpType, err)
+			}
+			if !reflect.DeepEqual(got, e) {
+				t.Errorf("%s entry = %+v, want %+v", e.OpType, got, e)
+			}
+		}
+	}
+
+	// The access IP and user agent are encrypted like a session.
+	frame, _ := encodeEntryFrame(entries[0], c)
+	got, err := decodeEntryFrame(frame[4:], nil)
+	if !errors.Is(err, ErrCipherRequired) || got.AccessIP != "" || got.LastActive != 0 {
+		t.Errorf("decode without cipher = %+v, %v", got, err)
+	}
+
+	// Trailing bytes after the change record are malformed.
+	plain, _ := encodeEntryFrame(entries[2], nil)
+	body := append(plain[headerSize:], 0)
+	frame = binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(body))
+	if _, err := decodeEntryFrame(append(frame, body...), nil); !errors.Is(err, errMalformedPayload) {
+		t.Errorf("decodeEntryFrame = %v, want errMalformedPayload", err)
+	}
+}
+
+func TestSegmentSchema(t *testing.T) {
+	for magic, want := range map[string]int{
+		"TOKMWAL\x01": SchemaJSON,
+		MagicBytes:    SchemaBinary,
+	} {
+		if got, err := segmentSchema([]byte(magic)); err != nil || got != want {
+			t.Errorf("segmentSchema(%q) = %d, %v; want %d", magic, got, err, want)
+		}
+	}
+	for _, magic := range []string{"TOKMWAL\x03", "BADMAGIC", "TOKM"} {
+		if _, err := segmentSchema([]byte(magic)); !errors.Is(err, errInvalidMagic) {
+			t.Errorf("segmentSchema(%q) = %v, want errInvalidMagic", magic, err)
+		}
+	}
+}
+
+func TestWriter_StatusPending(t *testing.T) {
+	w, err := NewWriter(Config{Dir: t.TempDir(), SyncMode: SyncModeBatch, SyncInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Append(NewDeleteEntry("s1")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	st := w.Status()
+	if st.PendingEntries != 1 || st.PendingBytes == 0 || st.Appended != 1 {
+		t.Errorf("buffered: pending %d bytes, %d entries", st.PendingBytes, st.PendingEntries)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	st = w.Status()
+	if st.PendingEntries != 0 || st.PendingBytes != 0 || st.LastSync.IsZero() {
+		t.Errorf("synced: pending %d bytes, %d entries, last sync %v", st.PendingBytes, st.PendingEntries, st.LastSync)
+	}
+}
+
+func TestCompactor_Segments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Config{Dir: dir, SyncMode: SyncModeSync, MaxEntryCount: 1})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, id := range []string{"s1", "s2", "s3"} {
+		if err := w.AppendBatch([]*Entry{NewDeleteEntry(id)}); err != nil {
+			t.Fatalf("AppendBatch: %v", err)
+		}
+	}
+	w.Close()
+
+	segments, err := NewCompactor(dir).Segments()
+	if err != nil {
+		t.Fatalf("Segments: %v", err)
+	}
+	total, _ := NewCompactor(dir).TotalSize()
+	var sum int64
+	for i, seg := range segments {
+		if seg.ID != uint64(i+1) || filepath.Base(seg.Path) != formatSegmentFilename(seg.ID) || seg.ModTime.IsZero() {
+			t.Errorf("segment %d = %+v", i, seg)
+		}
+		sum += seg.Size
+	}
+	if len(segments) != 3 || sum != total {
+		t.Errorf("%d segments of %d bytes, want 3 of %d", len(segments), sum, total)
+	}
+}
+
+func TestReader_EntryOffset(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Config{Dir: dir, SyncMode: SyncModeSync})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	var offsets []uint64
+	for _, id := range []string{"s1", "s2"} {
+		offsets = append(offsets, w.CurrentOffset())
+		if err := w.AppendBatch([]*Entry{NewDeleteEntry(id)}); err != nil {
+			t.Fatalf("AppendBatch: %v", err)
+		}
+	}
+	end := w.CurrentOffset()
+	w.Close()
+
+	r, err := NewReader(dir, nil)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	r.Seek(offsets[1])
+	e, err := r.Read()
+	if err != nil || e.SessionID != "s2" {
+		t.Fatalf("Read = %+v, %v", e, err)
+	}
+	if r.EntryOffset() != offsets[1] || r.Offset() != end {
+		t.Errorf("EntryOffset %x, Offset %x; want %x, %x", r.EntryOffset(), r.Offset(), offsets[1], end)
+	}
+}
+
+func TestParseOpType(t *testing.T) {
+	for op := OpTypeCreate; op <= OpTypeSetExpiry; op++ {
+		if got, ok := ParseOpType(op.String()); !ok || got != op {
+			t.Errorf("ParseOpType(%q) = %v, %v", op.String(), got, ok)
+		}
+	}
+	if _, ok := ParseOpType("op(9)"); ok {
+		t.Error("ParseOpType accepted an unknown operation")
+	}
 }
@@ -26,14 +26,50 @@ var (
 const (
 	FilePrefix      = "wal-"
 	FileExtension   = ".log"
-	MagicBytes      = "TOKMWAL\x01"
+	MagicBytes      = "TOKMWAL\x02" // magicPrefix + HeaderVersion
 	MagicBytesSize  = 8
 	ChecksumSize    = 32
-	HeaderVersion   = 1
+	HeaderVersion   = SchemaBinary
 	DefaultFilePerm = 0600
 	DefaultDirPerm  = 0750
 )
 
+// Segment schemas. The last magic byte of a segment is its schema, which
+// determines how its entry payloads are encoded.
+const (
+	// SchemaJSON segments hold JSON payloads; they are still read, but
+	// no longer written.
+	SchemaJSON = 1
+	// SchemaBinary segments hold binary payloads with codec session
+	// records.
+	SchemaBinary = 2
+
+	magicPrefix = "TOKMWAL"
+)
+
+// segmentSchema returns the schema of a segment from its magic bytes.
+func segmentSchema(magic []byte) (int, error) {
+	if len(magic) != MagicBytesSize || string(magic[:len(magicPrefix)]) != magicPrefix {
+		return 0, errInvalidMagic
+	}
+	switch schema := int(magic[len(magicPrefix)]); schema {
+	case SchemaJSON, SchemaBinary:
+		return schema, nil
+	default:
+		return 0, fmt.Errorf("%w: unsupported schema %d", errInvalidMagic, schema)
+	}
+}
+
+// readSegmentSchema reads the magic bytes of a segment and returns its
+// schema.
+func readSegmentSchema(f *os.File) (int, error) {
+	magic := make([]byte, MagicBytesSize)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return 0, fmt.Errorf("wal: read magic: %w", err)
+	}
+	return segmentSchema(magic)
+}
+
 // Default configuration values.
 const (
 	DefaultBatchCount          = 100
@@ -49,8 +85,49 @@ type SyncMode string
 const (
 	SyncModeSync  SyncMode = "sync"
 	SyncModeBatch SyncMode = "batch"
+
+	// SyncModeGroup group-commits appends: an append returns once it is
+	// fsynced, and concurrent appends share one fsync.
+	SyncModeGroup SyncMode = "group"
 )
 
+// Durability is how far an append is taken before it returns.
+type Durability uint8
+
+const (
+	// DurabilityDefault follows the SyncMode: DurabilityFsync in group
+	// mode, DurabilityNone otherwise.
+	DurabilityDefault Durability = iota
+
+	// DurabilityNone returns once the entry is buffered in memory. It is
+	// written when the batch thresholds are reached or by the sync loop.
+	DurabilityNone
+
+	// DurabilityBuffered returns once the entry is written to the segment
+	// file, so it survives a crash of the process but not of the host.
+	DurabilityBuffered
+
+	// DurabilityFsync returns once the entry is fsynced, sharing the
+	// fsync with concurrent appends (group commit).
+	DurabilityFsync
+)
+
+// String returns the durability name, e.g. "fsync".
+func (d Durability) String() string {
+	switch d {
+	case DurabilityDefault:
+		return "default"
+	case DurabilityNone:
+		return "none"
+	case DurabilityBuffered:
+		return "buffered"
+	case DurabilityFsync:
+		return "fsync"
+	default:
+		return fmt.Sprintf("durability(%d)", uint8(d))
+	}
+}
+
 // Config configures the WAL writer.
 type Config struct {
 	Dir string
@@ -67,6 +144,20 @@ type Config struct {
 	MaxEntryCount int
 
 	Cipher adaptive.Cipher
+
+	// OnSync, if set, is called with the duration of every fsync of a
+	// segment file, e.g. to export fsync latency.
+	OnSync func(time.Duration)
+
+	// OnCommit, if set, is called after every group commit with the
+	// number of entries it made durable and its duration (write and
+	// fsync).
+	OnCommit func(entries int, d time.Duration)
+
+	// OnRotate, if set, is called with the ID of each segment sealed by
+	// rotation, e.g. to ship it. It is called with the writer locked and
+	// must not block.
+	OnRotate func(sealed uint64)
 }
 
 // DefaultConfig returns the default WAL configuration.
@@ -88,12 +179,24 @@ type Writer struct {
 	cipher adaptive.Cipher
 
 	mu sync.Mutex
+	// cond signals the end of a group commit fsync; it uses mu.
+	cond *sync.Cond
+
+	// Sequence numbers of the frames appended to the buffer, written to
+	// the segment file, and fsynced.
+	appended uint64
+	written  uint64
+	synced   uint64
+	// syncing is set while a group commit fsyncs without holding mu.
+	syncing bool
 
 	segmentID uint64
 	file      *os.File
 	filePath  string
 
 	fileSize       int64 // bytes written excluding trailing checksum
+	syncedSize     int64 // bytes of the segment covered by the last fsync
+	lastSync       time.Time
 	segmentEntries int
 	hash           hash.Hash
 	buffer         [][]byte
@@ -122,6 +225,7 @@ func NewWriter(cfg Config) (*Writer, error) {
 		hash:   sha256.New(),
 		stopCh: make(chan struct{}),
 	}
+	w.cond = sync.NewCond(&w.mu)
 
 	latestID, latestPath, isClosed, err := findLatestSegment(cfg.Dir)
 	if err != nil {
@@ -136,12 +240,24 @@ func NewWriter(cfg Config) (*Writer, error) {
 	} else {
 		w.segmentID = latestID
 		w.filePath = latestPath
-		if err := w.openExistingOpenSegment(); err != nil {
+		legacy, err := w.openExistingOpenSegment()
+		if err != nil {
 			return nil, err
 		}
+		// Entries are appended in the current schema only, so an open
+		// segment of an older schema is sealed instead of continued.
+		if legacy {
+			if err := w.finalizeSegmentWithoutFlushingLocked(); err != nil {
+				return nil, err
+			}
+			w.segmentID++
+			if err := w.openNewSegment(); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	if w.cfg.SyncMode == SyncModeBatch {
+	if w.cfg.SyncMode == SyncModeBatch || w.cfg.SyncMode == SyncModeGroup {
 		w.startSyncLoop()
 	}
 
@@ -177,27 +293,130 @@ func (w *Writer) CurrentOffset() uint64 {
 	return (w.segmentID << 32) | uint64(uint32(w.fileSize))
 }
 
-// Append buffers an entry and flushes depending on batch thresholds.
-func (w *Writer) Append(entry *Entry) error {
+// WriterStatus is a point-in-time view of a Writer.
+type WriterStatus struct {
+	// SegmentID is the ID of the segment being written, and Offset the
+	// composite offset of the next entry written to it.
+	SegmentID uint64
+	Offset    uint64
+
+	// PendingBytes and PendingEntries are buffered or written but not
+	// fsynced yet; they are lost in a machine crash.
+	PendingBytes   int64
+	PendingEntries int
+
+	// Appended is the number of entries appended since the writer was
+	// opened.
+	Appended uint64
+
+	// LastSync is the time of the last fsync, zero if none since the
+	// writer was opened.
+	LastSync time.Time
+}
+
+// Status returns the writer's current status.
+func (w *Writer) Status() WriterStatus {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-
-	if w.closed {
-		return fmt.Errorf("wal: writer is closed")
+	return WriterStatus{
+		SegmentID:      w.segmentID,
+		Offset:         (w.segmentID << 32) | uint64(uint32(w.fileSize)),
+		PendingBytes:   w.bufferBytes + w.fileSize - w.syncedSize,
+		PendingEntries: int(w.appended - w.synced),
+		Appended:       w.appended,
+		LastSync:       w.lastSync,
 	}
+}
 
+// Append buffers an entry and flushes depending on batch thresholds, or
+// in group mode returns once the entry is fsynced.
+func (w *Writer) Append(entry *Entry) error {
+	return w.AppendDurable(entry, DurabilityDefault)
+}
+
+// AppendDurable appends an entry and returns once it is as durable as d.
+func (w *Writer) AppendDurable(entry *Entry, d Durability) error {
 	frame, err := encodeEntryFrame(entry, w.cipher)
 	if err != nil {
 		return err
 	}
 
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("wal: writer is closed")
+	}
+
 	w.buffer = append(w.buffer, frame)
 	w.bufferBytes += int64(len(frame))
+	w.appended++
 
-	if len(w.buffer) >= w.cfg.BatchCount || w.bufferBytes >= w.cfg.BatchBytes {
+	switch w.durability(d) {
+	case DurabilityFsync:
+		return w.commitLocked(w.appended)
+	case DurabilityBuffered:
 		return w.flushLocked()
+	default:
+		if len(w.buffer) >= w.cfg.BatchCount || w.bufferBytes >= w.cfg.BatchBytes {
+			return w.flushLocked()
+		}
+		return nil
 	}
-	return nil
+}
+
+// AppendBatch encodes all entries and commits them with a single flush
+// (one write and, in sync mode, one fsync) regardless of batch thresholds.
+// In group mode it returns once they are fsynced. Either every entry is
+// buffered or none is.
+func (w *Writer) AppendBatch(entries []*Entry) error {
+	return w.AppendBatchDurable(entries, DurabilityDefault)
+}
+
+// AppendBatchDurable is AppendBatch with the durability d, which is at
+// least DurabilityBuffered.
+func (w *Writer) AppendBatchDurable(entries []*Entry, d Durability) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	frames := make([][]byte, 0, len(entries))
+	var frameBytes int64
+	for _, entry := range entries {
+		frame, err := encodeEntryFrame(entry, w.cipher)
+		if err != nil {
+			return err
+		}
+		frames = append(frames, frame)
+		frameBytes += int64(len(frame))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("wal: writer is closed")
+	}
+
+	w.buffer = append(w.buffer, frames...)
+	w.bufferBytes += frameBytes
+	w.appended += uint64(len(frames))
+
+	if w.durability(d) == DurabilityFsync {
+		return w.commitLocked(w.appended)
+	}
+	return w.flushLocked()
+}
+
+// durability resolves DurabilityDefault for the sync mode.
+func (w *Writer) durability(d Durability) Durability {
+	if d != DurabilityDefault {
+		return d
+	}
+	if w.cfg.SyncMode == SyncModeGroup {
+		return DurabilityFsync
+	}
+	return DurabilityNone
 }
 
 // Flush writes buffered entries to disk.
@@ -207,10 +426,79 @@ func (w *Writer) Flush() error {
 	return w.flushLocked()
 }
 
+// Sync writes buffered entries to disk and fsyncs them, as a group
+// commit.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.commitLocked(w.appended)
+}
+
+// commitLocked returns once the frames up to sequence number seq are
+// fsynced. Concurrent callers share an fsync: the first one writes all
+// buffered frames and fsyncs without holding mu, and the others wait for
+// it, and are covered by it or by the next one, which includes the frames
+// appended meanwhile.
+func (w *Writer) commitLocked(seq uint64) error {
+	for w.synced < seq {
+		if w.syncing {
+			w.cond.Wait()
+			continue
+		}
+
+		start := time.Now()
+		if err := w.flushLocked(); err != nil {
+			return err
+		}
+		if w.synced >= seq {
+			// Synced by the flush (sync mode or rotation).
+			break
+		}
+		if w.file == nil {
+			return fmt.Errorf("wal: file not open")
+		}
+
+		file, target, size := w.file, w.written, w.fileSize
+		w.syncing = true
+		w.mu.Unlock()
+		err := w.syncFile(file)
+		w.mu.Lock()
+		w.syncing = false
+		w.cond.Broadcast()
+
+		// A segment rotated meanwhile was fsynced when it was sealed.
+		if err != nil && !errors.Is(err, os.ErrClosed) {
+			return fmt.Errorf("wal: sync: %w", err)
+		}
+		if err == nil && w.file == file && size > w.syncedSize {
+			w.syncedSize = size
+			w.lastSync = time.Now()
+		}
+		if target > w.synced {
+			if w.cfg.OnCommit != nil {
+				w.cfg.OnCommit(int(target-w.synced), time.Since(start))
+			}
+			w.markSyncedLocked(target)
+		}
+	}
+	return nil
+}
+
+// markSyncedLocked records that the frames up to seq are fsynced.
+func (w *Writer) markSyncedLocked(seq uint64) {
+	if seq > w.synced {
+		w.synced = seq
+		w.cond.Broadcast()
+	}
+}
+
 func (w *Writer) flushLocked() error {
 	if len(w.buffer) == 0 {
 		if w.cfg.SyncMode == SyncModeSync && w.file != nil {
-			return w.file.Sync()
+			return w.syncLocked()
 		}
 		return nil
 	}
@@ -227,6 +515,8 @@ func (w *Writer) flushLocked() error {
 		return fmt.Errorf("wal: file not open")
 	}
 	if w.fileSize+int64(buf.Len()) > w.cfg.MaxFileSize || w.segmentEntries+len(w.buffer) > w.cfg.MaxEntryCount {
+		// Sealing fsyncs the segment, so a group commit fsyncing it
+		// without mu is covered too.
 		if err := w.finalizeSegmentWithoutFlushingLocked(); err != nil {
 			return err
 		}
@@ -234,6 +524,9 @@ func (w *Writer) flushLocked() error {
 		if err := w.openNewSegment(); err != nil {
 			return err
 		}
+		if w.cfg.OnRotate != nil {
+			w.cfg.OnRotate(w.segmentID - 1)
+		}
 	}
 
 	if _, err := w.writeLocked(buf.Bytes()); err != nil {
@@ -241,16 +534,62 @@ func (w *Writer) flushLocked() error {
 	}
 
 	w.segmentEntries += len(w.buffer)
+	w.written += uint64(len(w.buffer))
 	w.buffer = nil
 	w.bufferBytes = 0
 
 	if w.cfg.SyncMode == SyncModeSync {
-		return w.file.Sync()
+		return w.syncLocked()
 	}
 
 	return nil
 }
 
+// syncLocked fsyncs the current segment, reporting its duration to
+// Config.OnSync.
+func (w *Writer) syncLocked() error {
+	if err := w.syncFile(w.file); err != nil {
+		return err
+	}
+	w.syncedSize = w.fileSize
+	w.lastSync = time.Now()
+	w.markSyncedLocked(w.written)
+	return nil
+}
+
+// syncFile fsyncs a segment file, reporting its duration to
+// Config.OnSync.
+func (w *Writer) syncFile(f *os.File) error {
+	start := time.Now()
+	err := f.Sync()
+	if w.cfg.OnSync != nil {
+		w.cfg.OnSync(time.Since(start))
+	}
+	return err
+}
+
+// Size returns the total size in bytes of the WAL segment files.
+func (w *Writer) Size() (int64, error) {
+	entries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return 0, fmt.Errorf("wal: read dir: %w", err)
+	}
+
+	var total int64
+	for _, e := range entries {
+		if _, ok := parseSegmentFilename(e.Name()); !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// Removed by compaction meanwhile.
+			continue
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
 func (w *Writer) startSyncLoop() {
 	w.syncTicker = time.NewTicker(w.cfg.SyncInterval)
 	w.wg.Add(1)
@@ -260,7 +599,11 @@ func (w *Writer) startSyncLoop() {
 		for {
 			select {
 			case <-w.syncTicker.C:
-				_ = w.Flush()
+				if w.cfg.SyncMode == SyncModeGroup {
+					_ = w.Sync()
+				} else {
+					_ = w.Flush()
+				}
 			case <-w.stopCh:
 				return
 			}
@@ -278,6 +621,7 @@ func (w *Writer) openNewSegment() error {
 	w.file = file
 	w.filePath = path
 	w.fileSize = 0
+	w.syncedSize = 0
 	w.segmentEntries = 0
 	w.hash = sha256.New()
 	w.headerWritten = false
@@ -290,58 +634,57 @@ func (w *Writer) openNewSegment() error {
 	return nil
 }
 
-func (w *Writer) openExistingOpenSegment() error {
+// openExistingOpenSegment opens the unsealed segment at w.filePath to
+// continue it, and reports whether it has an older schema.
+func (w *Writer) openExistingOpenSegment() (legacy bool, err error) {
 	file, err := os.OpenFile(w.filePath, os.O_RDWR, DefaultFilePerm)
 	if err != nil {
-		return fmt.Errorf("wal: open existing segment: %w", err)
+		return false, fmt.Errorf("wal: open existing segment: %w", err)
 	}
 
 	stat, err := file.Stat()
 	if err != nil {
 		file.Close()
-		return fmt.Errorf("wal: stat segment: %w", err)
+		return false, fmt.Errorf("wal: stat segment: %w", err)
 	}
 
 	// Validate magic.
-	magic := make([]byte, MagicBytesSize)
-	if _, err := io.ReadFull(io.NewSectionReader(file, 0, MagicBytesSize), magic); err != nil {
-		file.Close()
-		return fmt.Errorf("wal: read magic: %w", err)
-	}
-	if string(magic) != MagicBytes {
+	schema, err := readSegmentSchema(file)
+	if err != nil {
 		file.Close()
-		return errInvalidMagic
+		return false, err
 	}
 
 	// Check if file is already finalized (has a valid checksum trailer).
 	closed, dataLen, err := verifyChecksumTrailer(file, stat.Size())
 	if err != nil {
 		file.Close()
-		return err
+		return false, err
 	}
 	if closed {
 		file.Close()
-		return fmt.Errorf("wal: latest segment already finalized")
+		return false, fmt.Errorf("wal: latest segment already finalized")
 	}
 
 	// Recompute hash over existing bytes (excluding trailer).
 	w.hash = sha256.New()
 	if _, err := io.CopyN(w.hash, io.NewSectionReader(file, 0, dataLen), dataLen); err != nil {
 		file.Close()
-		return fmt.Errorf("wal: hash existing segment: %w", err)
+		return false, fmt.Errorf("wal: hash existing segment: %w", err)
 	}
 
 	w.file = file
 	w.fileSize = dataLen
+	w.syncedSize = dataLen
 	w.headerWritten = true
 
 	// Move cursor to end for appends.
 	if _, err := file.Seek(dataLen, io.SeekStart); err != nil {
 		file.Close()
-		return fmt.Errorf("wal: seek: %w", err)
+		return false, fmt.Errorf("wal: seek: %w", err)
 	}
 
-	return nil
+	return schema != HeaderVersion, nil
 }
 
 func (w *Writer) writeHeaderLocked() error {
@@ -390,7 +733,7 @@ func (w *Writer) finalizeSegmentWithoutFlushingLocked() error {
 	if _, err := w.file.Write(checksum); err != nil {
 		return fmt.Errorf("wal: write checksum: %w", err)
 	}
-	if err := w.file.Sync(); err != nil {
+	if err := w.syncLocked(); err != nil {
 		return fmt.Errorf("wal: sync: %w", err)
 	}
 	if err := w.file.Close(); err != nil {
@@ -431,6 +774,12 @@ func formatSegmentFilename(segmentID uint64) string {
 	return fmt.Sprintf("%s%08d%s", FilePrefix, segmentID, FileExtension)
 }
 
+// ParseSegmentFilename returns the segment ID of a WAL segment file name,
+// and false if name is not one.
+func ParseSegmentFilename(name string) (uint64, bool) {
+	return parseSegmentFilename(name)
+}
+
 func parseSegmentFilename(name string) (uint64, bool) {
 	if !stringsHasPrefix(name, FilePrefix) || !stringsHasSuffix(name, FileExtension) {
 		return 0, false
@@ -489,12 +838,8 @@ func verifyChecksumTrailer(f *os.File, size int64) (closed bool, dataLen int64,
 		return false, size, nil
 	}
 
-	magic := make([]byte, MagicBytesSize)
-	if _, err := io.ReadFull(io.NewSectionReader(f, 0, MagicBytesSize), magic); err != nil {
-		return false, 0, fmt.Errorf("wal: read magic: %w", err)
-	}
-	if string(magic) != MagicBytes {
-		return false, 0, errInvalidMagic
+	if _, err := readSegmentSchema(f); err != nil {
+		return false, 0, err
 	}
 
 	if size < MagicBytesSize+ChecksumSize {
@@ -0,0 +1,198 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+// ErrNoWAL is returned by the WAL inspection methods with the Badger
+// backend.
+var ErrNoWAL = errors.New("storage: no WAL with the badger backend")
+
+// Limits of WALLogs.
+const (
+	// DefaultWALLogLimit is the page size when WALLogQuery.Limit is 0.
+	DefaultWALLogLimit = 100
+
+	// MaxWALLogLimit is the largest page size.
+	MaxWALLogLimit = 1000
+
+	// walLogScanLimit is the number of entries a page scans at most, so
+	// a selective filter does not read the whole WAL in one request.
+	walLogScanLimit = 100_000
+)
+
+// WALStatus describes the WAL of the engine.
+type WALStatus struct {
+	wal.WriterStatus
+
+	// Segments lists the segment files, oldest first; the last one is
+	// being written.
+	Segments   []wal.SegmentFile
+	TotalBytes int64
+
+	// SnapshotOffset is the WAL offset of the latest snapshot, where
+	// recovery starts replaying, and LastSnapshot when it was taken.
+	SnapshotOffset uint64
+	LastSnapshot   time.Time
+}
+
+// WALStatus returns the status of the WAL writer and segment files.
+func (e *Engine) WALStatus() (*WALStatus, error) {
+	if e.wal == nil {
+		return nil, ErrNoWAL
+	}
+
+	segments, err := e.compactor().Segments()
+	if err != nil {
+		return nil, fmt.Errorf("storage: list wal segments: %w", err)
+	}
+	s := &WALStatus{
+		WriterStatus:   e.wal.Status(),
+		Segments:       segments,
+		SnapshotOffset: e.lastSnapshotOffset.Load(),
+	}
+	for _, seg := range segments {
+		s.TotalBytes += seg.Size
+	}
+	if ms := e.lastSnapshot.Load(); ms > 0 {
+		s.LastSnapshot = time.UnixMilli(ms)
+	}
+	return s, nil
+}
+
+// WALLogQuery selects the WAL entries returned by WALLogs.
+type WALLogQuery struct {
+	// From is the composite offset to read from; 0 reads from the
+	// oldest segment.
+	From uint64
+
+	// Limit is the maximum number of entries returned, up to
+	// MaxWALLogLimit; 0 means DefaultWALLogLimit.
+	Limit int
+
+	// Tail returns the last Limit matching entries at or after From
+	// instead of the first ones.
+	Tail bool
+
+	// Ops, if not empty, selects entries of these operations.
+	Ops []wal.OpType
+
+	// SessionID selects the entries of a session.
+	SessionID string
+
+	// UserID selects the entries of a user's sessions. Entries without
+	// the session (delete, touch, set_expiry) match while the session
+	// is in memory.
+	UserID string
+}
+
+// WALLogEntry is a WAL entry and its composite offset.
+type WALLogEntry struct {
+	Offset uint64
+	Entry  *wal.Entry
+}
+
+// WALLogPage is a page of WAL entries.
+type WALLogPage struct {
+	Entries []WALLogEntry
+
+	// NextOffset is where the next page starts: just past the last
+	// entry scanned.
+	NextOffset uint64
+
+	// More is set when the page stopped before the end of the WAL.
+	More bool
+}
+
+// WALLogs reads the entries written to the WAL segment files that match
+// q, in order. Entries still buffered by the writer are not returned
+// (see WALStatus.PendingEntries), nor are compacted segments.
+func (e *Engine) WALLogs(ctx context.Context, q WALLogQuery) (*WALLogPage, error) {
+	if e.wal == nil {
+		return nil, ErrNoWAL
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultWALLogLimit
+	}
+	limit = min(limit, MaxWALLogLimit)
+
+	r, err := wal.NewReader(e.cfg.WAL.Dir, e.cfg.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("storage: open wal: %w", err)
+	}
+	defer r.Close()
+	if err := r.Seek(q.From); err != nil {
+		return nil, fmt.Errorf("storage: seek wal: %w", err)
+	}
+
+	page := &WALLogPage{NextOffset: q.From}
+	for scanned := 0; ; scanned++ {
+		if !q.Tail && (len(page.Entries) == limit || scanned == walLogScanLimit) {
+			page.More = true
+			break
+		}
+		if scanned%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		entry, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("storage: read wal: %w", err)
+		}
+		page.NextOffset = r.Offset()
+		if !e.walEntryMatches(ctx, entry, &q) {
+			continue
+		}
+
+		page.Entries = append(page.Entries, WALLogEntry{Offset: r.EntryOffset(), Entry: entry})
+		if q.Tail && len(page.Entries) > limit {
+			page.Entries = page.Entries[1:]
+		}
+	}
+	return page, nil
+}
+
+// walEntryMatches reports whether entry is selected by q.
+func (e *Engine) walEntryMatches(ctx context.Context, entry *wal.Entry, q *WALLogQuery) bool {
+	if len(q.Ops) > 0 {
+		found := false
+		for _, op := range q.Ops {
+			if entry.OpType == op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.SessionID != "" && entry.SessionID != q.SessionID {
+		return false
+	}
+	if q.UserID != "" {
+		var session *domain.Session
+		if entry.Session != nil {
+			session = entry.Session
+		} else if s, err := e.store.Get(ctx, entry.SessionID); err == nil {
+			session = s
+		}
+		if session == nil || session.UserID != q.UserID {
+			return false
+		}
+	}
+	return true
+}
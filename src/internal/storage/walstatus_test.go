@@ -0,0 +1,151 @@
+// Package storage provides the storage engine for TokMesh.
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage/wal"
+)
+
+func TestEngine_WALStatus(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig(t.TempDir())
+	cfg.SnapshotInterval = time.Hour
+	cfg.WAL.SyncMode = wal.SyncModeGroup
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer engine.Close()
+
+	s, _ := domain.NewSession("status_user")
+	s.SetExpiration(time.Hour)
+	if err := engine.Create(ctx, s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	st, err := engine.WALStatus()
+	if err != nil {
+		t.Fatalf("WALStatus: %v", err)
+	}
+	if st.SegmentID != 1 || st.Offset>>32 != 1 || st.Offset == 1<<32 {
+		t.Errorf("segment %d, offset %x", st.SegmentID, st.Offset)
+	}
+	if st.PendingBytes != 0 || st.PendingEntries != 0 || st.LastSync.IsZero() {
+		t.Errorf("after a group commit: pending %d bytes, %d entries, last sync %v", st.PendingBytes, st.PendingEntries, st.LastSync)
+	}
+	if len(st.Segments) != 1 || st.TotalBytes != st.Segments[0].Size || st.TotalBytes == 0 {
+		t.Errorf("segments %+v, total %d", st.Segments, st.TotalBytes)
+	}
+	if st.SnapshotOffset != 0 {
+		t.Errorf("SnapshotOffset = %x before any snapshot", st.SnapshotOffset)
+	}
+
+	info, err := engine.TriggerSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("TriggerSnapshot: %v", err)
+	}
+	st, _ = engine.WALStatus()
+	if st.SnapshotOffset != info.WALLastOffset || st.LastSnapshot.IsZero() {
+		t.Errorf("after a snapshot: offset %x, want %x; last snapshot %v", st.SnapshotOffset, info.WALLastOffset, st.LastSnapshot)
+	}
+}
+
+func TestEngine_WALLogs(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig(t.TempDir())
+	cfg.SnapshotInterval = time.Hour
+	cfg.WAL.SyncMode = wal.SyncModeGroup
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer engine.Close()
+
+	for _, user := range []string{"alice", "bob", "alice"} {
+		s, _ := domain.NewSession(user)
+		s.SetExpiration(time.Hour)
+		if err := engine.Create(ctx, s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	alice, _ := engine.ListByUserID(ctx, "alice")
+	if err := engine.Delete(ctx, alice[0].ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := engine.TouchSession(ctx, alice[1].ID, time.Now().UnixMilli(), "10.0.0.1", "ua"); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+
+	// Pages
+	page, err := engine.WALLogs(ctx, WALLogQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("WALLogs: %v", err)
+	}
+	if len(page.Entries) != 2 || !page.More {
+		t.Fatalf("first page: %d entries, more %v", len(page.Entries), page.More)
+	}
+	if page.Entries[1].Offset <= page.Entries[0].Offset || page.NextOffset <= page.Entries[1].Offset {
+		t.Errorf("offsets %x %x, next %x", page.Entries[0].Offset, page.Entries[1].Offset, page.NextOffset)
+	}
+	rest, err := engine.WALLogs(ctx, WALLogQuery{From: page.NextOffset})
+	if err != nil {
+		t.Fatalf("WALLogs: %v", err)
+	}
+	if len(rest.Entries) != 3 || rest.More || rest.NextOffset != engine.wal.CurrentOffset() {
+		t.Errorf("second page: %d entries, more %v, next %x", len(rest.Entries), rest.More, rest.NextOffset)
+	}
+	if rest.Entries[0].Offset != page.NextOffset {
+		t.Errorf("second page starts at %x, want %x", rest.Entries[0].Offset, page.NextOffset)
+	}
+
+	// Filters
+	count := func(q WALLogQuery) int {
+		t.Helper()
+		page, err := engine.WALLogs(ctx, q)
+		if err != nil {
+			t.Fatalf("WALLogs(%+v): %v", q, err)
+		}
+		return len(page.Entries)
+	}
+	if n := count(WALLogQuery{Ops: []wal.OpType{wal.OpTypeCreate}}); n != 3 {
+		t.Errorf("creates = %d, want 3", n)
+	}
+	if n := count(WALLogQuery{SessionID: alice[0].ID}); n != 2 {
+		t.Errorf("entries of a deleted session = %d, want 2", n)
+	}
+	// The delete of a session no longer in memory has no user
+	if n := count(WALLogQuery{UserID: "alice"}); n != 3 {
+		t.Errorf("entries of alice = %d, want 3", n)
+	}
+
+	// Tail
+	tail, err := engine.WALLogs(ctx, WALLogQuery{Limit: 2, Tail: true})
+	if err != nil {
+		t.Fatalf("WALLogs tail: %v", err)
+	}
+	if len(tail.Entries) != 2 || tail.Entries[1].Entry.OpType != wal.OpTypeTouch || tail.More {
+		t.Errorf("tail = %+v", tail)
+	}
+}
+
+func TestEngine_WALInspectionBadger(t *testing.T) {
+	cfg := DefaultConfig(t.TempDir())
+	cfg.Backend = BackendBadger
+	engine, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer engine.Close()
+
+	if _, err := engine.WALStatus(); !errors.Is(err, ErrNoWAL) {
+		t.Errorf("WALStatus: err = %v, want ErrNoWAL", err)
+	}
+	if _, err := engine.WALLogs(context.Background(), WALLogQuery{}); !errors.Is(err, ErrNoWAL) {
+		t.Errorf("WALLogs: err = %v, want ErrNoWAL", err)
+	}
+}
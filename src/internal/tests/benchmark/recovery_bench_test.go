@@ -0,0 +1,155 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/storage"
+	"github.com/yndnr/tokmesh-go/internal/storage/codec"
+	"github.com/yndnr/tokmesh-go/internal/storage/snapshot"
+)
+
+// RecoverySessionCounts are the data directory sizes of
+// BenchmarkRecoveryLarge, up to the 5M sessions of a large node.
+var RecoverySessionCounts = []int{1000000, 5000000}
+
+// BenchmarkRecovery benchmarks a cold start: loading the latest snapshot
+// and replaying the WAL written after it.
+func BenchmarkRecovery(b *testing.B) {
+	runWithSessionCounts(b, SmallSessionCounts, benchmarkRecovery)
+}
+
+// BenchmarkRecoveryLarge benchmarks a cold start of a large node. It
+// needs several GB of memory and disk:
+//
+//	go test -run '^$' -bench BenchmarkRecoveryLarge -benchtime 1x ./internal/tests/benchmark/
+func BenchmarkRecoveryLarge(b *testing.B) {
+	if testing.Short() {
+		b.Skip("Skipping large recovery benchmark in short mode")
+	}
+	runWithSessionCounts(b, RecoverySessionCounts, benchmarkRecovery)
+}
+
+// benchmarkRecovery writes a data directory with a snapshot of count
+// sessions and count/100 WAL entries after it, then recovers it.
+func benchmarkRecovery(b *testing.B, count int) {
+	dir := b.TempDir()
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	cfg := storage.DefaultConfig(dir)
+	cfg.Logger = quiet
+	// No snapshot besides the one below, on shutdown or otherwise, so the
+	// tail is left in the WAL for recovery to replay.
+	cfg.SnapshotPolicy = storage.SnapshotPolicy{}
+	sessions := make([]*domain.Session, count)
+	for i := range sessions {
+		sessions[i] = createSession(fmt.Sprintf("user-%d", i%100000))
+	}
+	mgr, err := snapshot.NewManager(cfg.Snapshot)
+	if err != nil {
+		b.Fatalf("NewManager: %v", err)
+	}
+	info, err := mgr.Create(sessions, 0)
+	if err != nil {
+		b.Fatalf("Create snapshot: %v", err)
+	}
+	sessions = nil
+
+	engine, err := storage.New(cfg)
+	if err != nil {
+		b.Fatalf("storage.New: %v", err)
+	}
+	tail := make([]*domain.Session, 0, count/100)
+	for i := 0; i < count/100; i++ {
+		tail = append(tail, createSession(fmt.Sprintf("tail-user-%d", i)))
+	}
+	for start := 0; start < len(tail); start += 1000 {
+		for _, err := range engine.CreateBatch(ctx, tail[start:min(start+1000, len(tail))]) {
+			if err != nil {
+				b.Fatalf("CreateBatch: %v", err)
+			}
+		}
+	}
+	if err := engine.Close(); err != nil {
+		b.Fatalf("Close: %v", err)
+	}
+	if infos, err := mgr.List(); err != nil || len(infos) != 1 {
+		b.Fatalf("snapshots before recovery = %d, %v, want 1", len(infos), err)
+	}
+	want := count + len(tail)
+
+	b.ResetTimer()
+
+	var elapsed time.Duration
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		engine, err := storage.New(cfg)
+		if err != nil {
+			b.Fatalf("storage.New: %v", err)
+		}
+		if err := engine.Recover(ctx); err != nil {
+			b.Fatalf("Recover: %v", err)
+		}
+		elapsed += time.Since(start)
+
+		b.StopTimer()
+		if got := engine.Count(ctx); got != want {
+			b.Fatalf("recovered %d sessions, want %d", got, want)
+		}
+		engine.Close()
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(info.Size)/float64(count), "snapshot_B/session")
+	b.ReportMetric(float64(len(tail)), "wal_entries")
+	b.ReportMetric(elapsed.Seconds()/float64(b.N), "recovery_s")
+	b.ReportMetric(float64(want)*float64(b.N)/elapsed.Seconds(), "sessions/s")
+}
+
+// BenchmarkSessionEncoding compares the binary session record used by the
+// WAL and snapshots with the JSON encoding it replaced.
+func BenchmarkSessionEncoding(b *testing.B) {
+	s := createSession("bench-user")
+	s.Data = map[string]string{"role": "user", "tenant": "acme"}
+	js, _ := json.Marshal(s)
+	bin := codec.EncodeSession(s)
+
+	b.Run("json_encode", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ReportMetric(float64(len(js)), "bytes")
+		for i := 0; i < b.N; i++ {
+			json.Marshal(s)
+		}
+	})
+	b.Run("binary_encode", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ReportMetric(float64(len(bin)), "bytes")
+		buf := make([]byte, 0, 512)
+		for i := 0; i < b.N; i++ {
+			buf = codec.AppendSession(buf[:0], s)
+		}
+	})
+	b.Run("json_decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var out domain.Session
+			if err := json.Unmarshal(js, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("binary_decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := codec.DecodeSession(bin); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -3,8 +3,14 @@ package benchmark
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"testing"
+	"time"
 
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/storage"
 	"github.com/yndnr/tokmesh-go/internal/storage/memory"
 )
 
@@ -228,3 +234,78 @@ func BenchmarkSessionConcurrent(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkEngineTouchSession benchmarks touches through the storage
+// engine, which logs a TOUCH entry and applies it to memory, alone and
+// alongside List sorted by last activity.
+func BenchmarkEngineTouchSession(b *testing.B) {
+	ctx := context.Background()
+	cfg := storage.DefaultConfig(b.TempDir())
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	engine, err := storage.New(cfg)
+	if err != nil {
+		b.Fatalf("storage.New: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.Recover(ctx); err != nil {
+		b.Fatalf("Recover: %v", err)
+	}
+
+	// Prefill
+	sessions := make([]*domain.Session, 10000)
+	for i := range sessions {
+		sessions[i] = createSession(fmt.Sprintf("user-%d", i%1000))
+	}
+	for start := 0; start < len(sessions); start += 1000 {
+		for _, err := range engine.CreateBatch(ctx, sessions[start:start+1000]) {
+			if err != nil {
+				b.Fatalf("CreateBatch: %v", err)
+			}
+		}
+	}
+
+	touch := func(i int) error {
+		id := sessions[i%len(sessions)].ID
+		_, err := engine.TouchSession(ctx, id, time.Now().UnixMilli(), "10.0.0.1", "")
+		return err
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := touch(i); err != nil {
+				b.Fatalf("TouchSession: %v", err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if err := touch(i); err != nil {
+					b.Errorf("TouchSession: %v", err)
+					return
+				}
+			}
+		})
+	})
+	b.Run("parallel_with_list", func(b *testing.B) {
+		b.ReportAllocs()
+		filter := &service.SessionFilter{SortBy: "last_active", PageSize: 20}
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if i%100 == 0 {
+					if _, _, err := engine.List(ctx, filter); err != nil {
+						b.Errorf("List: %v", err)
+						return
+					}
+					continue
+				}
+				if err := touch(i); err != nil {
+					b.Errorf("TouchSession: %v", err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,293 @@
+// The Redis conformance suite drives a running redisserver.Server with
+// go-redis over RESP2 and RESP3. It covers the generic key commands on
+// TokMesh sessions and on the opaque values that framework session stores
+// write under their own keys.
+//
+// @design DS-0301
+// @req RQ-0303
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/yndnr/tokmesh-go/internal/core/domain"
+	"github.com/yndnr/tokmesh-go/internal/core/service"
+	"github.com/yndnr/tokmesh-go/internal/server/redisserver"
+	"github.com/yndnr/tokmesh-go/internal/storage/memory"
+)
+
+// startRedisServer starts a server on a random loopback port backed by
+// in-memory storage and returns its address and an API key.
+func startRedisServer(t *testing.T) (string, *service.CreateAPIKeyResponse) {
+	t.Helper()
+
+	store := memory.New()
+	tokenSvc := service.NewTokenService(store, nil)
+	sessionSvc := service.NewSessionService(store, tokenSvc)
+	authSvc := service.NewAuthService(memory.NewAPIKeyStore(), nil)
+
+	ctx := context.Background()
+	key, err := authSvc.CreateAPIKey(ctx, &service.CreateAPIKeyRequest{Name: "conformance", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	cfg := redisserver.DefaultConfig()
+	cfg.PlainEnabled = true
+	cfg.PlainAddress = "127.0.0.1:0"
+	cfg.TLSEnabled = false
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := redisserver.New(cfg, sessionSvc, tokenSvc, authSvc, logger)
+	if err := srv.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("redis server did not start listening")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return srv.Addr().String(), key
+}
+
+// newSessionValue returns a SET value that creates a session.
+func newSessionValue(t *testing.T, userID string) string {
+	t.Helper()
+	token, _, err := domain.GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	data, _ := json.Marshal(map[string]any{"user_id": userID, "token": token})
+	return string(data)
+}
+
+func newSessionID(t *testing.T) string {
+	t.Helper()
+	id, err := domain.GenerateSessionID()
+	if err != nil {
+		t.Fatalf("GenerateSessionID: %v", err)
+	}
+	return id
+}
+
+func TestRedisConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	addr, key := startRedisServer(t)
+
+	for _, proto := range []int{2, 3} {
+		t.Run(fmt.Sprintf("RESP%d", proto), func(t *testing.T) {
+			rdb := redis.NewClient(&redis.Options{
+				Addr:     addr,
+				Username: key.KeyID,
+				Password: key.Secret,
+				Protocol: proto,
+			})
+			defer rdb.Close()
+
+			testRedisConformance(t, rdb)
+		})
+	}
+}
+
+func testRedisConformance(t *testing.T, rdb *redis.Client) {
+	ctx := context.Background()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatalf("PING: %v", err)
+	}
+	base, err := rdb.DBSize(ctx).Result()
+	if err != nil {
+		t.Fatalf("DBSIZE: %v", err)
+	}
+
+	// Sessions written by a TokMesh-aware client: SET ... EX with a
+	// session ID key and the session fields, GET, EXPIRE to touch, DEL to
+	// destroy.
+	id := newSessionID(t)
+	if err := rdb.Set(ctx, id, newSessionValue(t, "alice"), time.Hour).Err(); err != nil {
+		t.Fatalf("SET EX: %v", err)
+	}
+	val, err := rdb.Get(ctx, id).Result()
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(val), &got); err != nil || got["user_id"] != "alice" {
+		t.Fatalf("GET = %q, %v", val, err)
+	}
+	if ok, err := rdb.Expire(ctx, id, 2*time.Hour).Result(); err != nil || !ok {
+		t.Fatalf("EXPIRE = %v, %v", ok, err)
+	}
+	if ttl, err := rdb.TTL(ctx, id).Result(); err != nil || ttl <= time.Hour || ttl > 2*time.Hour {
+		t.Fatalf("TTL = %v, %v", ttl, err)
+	}
+
+	// Millisecond TTLs (Spring Session, Django).
+	if ok, err := rdb.PExpire(ctx, id, 90*time.Minute).Result(); err != nil || !ok {
+		t.Fatalf("PEXPIRE = %v, %v", ok, err)
+	}
+	if pttl, err := rdb.PTTL(ctx, id).Result(); err != nil || pttl <= 89*time.Minute || pttl > 90*time.Minute {
+		t.Fatalf("PTTL = %v, %v", pttl, err)
+	}
+
+	// SETEX and GETEX.
+	id2 := newSessionID(t)
+	if err := rdb.SetEx(ctx, id2, newSessionValue(t, "bob"), 10*time.Minute).Err(); err != nil {
+		t.Fatalf("SETEX: %v", err)
+	}
+	if _, err := rdb.GetEx(ctx, id2, 20*time.Minute).Result(); err != nil {
+		t.Fatalf("GETEX: %v", err)
+	}
+	if ttl, err := rdb.TTL(ctx, id2).Result(); err != nil || ttl <= 10*time.Minute {
+		t.Fatalf("TTL after GETEX = %v, %v", ttl, err)
+	}
+
+	// Multi-key reads.
+	missing := newSessionID(t)
+	vals, err := rdb.MGet(ctx, id, missing, id2).Result()
+	if err != nil || len(vals) != 3 || vals[0] == nil || vals[1] != nil || vals[2] == nil {
+		t.Fatalf("MGET = %v, %v", vals, err)
+	}
+	if n, err := rdb.Exists(ctx, id, missing, id2).Result(); err != nil || n != 2 {
+		t.Fatalf("EXISTS = %d, %v", n, err)
+	}
+	if typ, err := rdb.Type(ctx, id).Result(); err != nil || typ != "string" {
+		t.Fatalf("TYPE = %q, %v", typ, err)
+	}
+	if typ, err := rdb.Type(ctx, missing).Result(); err != nil || typ != "none" {
+		t.Fatalf("TYPE missing = %q, %v", typ, err)
+	}
+	if n, err := rdb.DBSize(ctx).Result(); err != nil || n != base+2 {
+		t.Fatalf("DBSIZE = %d, %v, want %d", n, err, base+2)
+	}
+	info, err := rdb.Info(ctx, "keyspace").Result()
+	if err != nil || !strings.Contains(info, fmt.Sprintf("db0:keys=%d,", base+2)) {
+		t.Fatalf("INFO keyspace = %q, %v", info, err)
+	}
+
+	keys, _, err := rdb.Scan(ctx, 0, "tmss-*", 100).Result()
+	if err != nil || !contains(keys, id) || !contains(keys, id2) {
+		t.Fatalf("SCAN = %v, %v", keys, err)
+	}
+
+	// Pipelines and transactions.
+	cmds, err := rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Exists(ctx, id)
+		p.TTL(ctx, id2)
+		return nil
+	})
+	if err != nil || len(cmds) != 2 || cmds[0].(*redis.IntCmd).Val() != 1 {
+		t.Fatalf("MULTI/EXEC = %v, %v", cmds, err)
+	}
+
+	// Missing keys.
+	if _, err := rdb.Get(ctx, missing).Result(); err != redis.Nil {
+		t.Fatalf("GET missing err = %v, want redis.Nil", err)
+	}
+	if ttl, err := rdb.TTL(ctx, missing).Result(); err != nil || ttl != -2 {
+		t.Fatalf("TTL missing = %v, %v", ttl, err)
+	}
+
+	// Framework session stores write their own serialized sessions under
+	// their own keys: JSON for express-session, a pickle for Django.
+	frameworkValues := []struct {
+		name, key, value string
+		ttl              time.Duration
+	}{
+		{"express-session", "sess:Mx5wHVNFqHn9YGiB8sxcI7DFeRGTr4Oe",
+			`{"cookie":{"originalMaxAge":86400000,"expires":"2026-10-19T12:00:00.000Z","httpOnly":true,"path":"/"},"userId":"alice"}`, 86400 * time.Second},
+		{"django", ":1:django.contrib.sessions.cachepxd0c8kqv9xn2zldwqyd4uju5myxbkq0",
+			"\x80\x05\x95\x1d\x00\x00\x00\x00\x00\x00\x00}\x94\x8c\r_auth_user_id\x94\x8c\x011\x94s.", 1209600 * time.Second},
+		{"large", "sess:large", strings.Repeat("0123456789abcdef", 180), time.Hour},
+	}
+	for _, v := range frameworkValues {
+		if err := rdb.Set(ctx, v.key, v.value, v.ttl).Err(); err != nil {
+			t.Fatalf("SET of a %s session: %v", v.name, err)
+		}
+		if got, err := rdb.Get(ctx, v.key).Result(); err != nil || got != v.value {
+			t.Fatalf("GET of a %s session = %q, %v, want %q", v.name, got, err, v.value)
+		}
+		if ttl, err := rdb.TTL(ctx, v.key).Result(); err != nil || ttl <= v.ttl-time.Minute || ttl > v.ttl {
+			t.Fatalf("TTL of a %s session = %v, %v", v.name, ttl, err)
+		}
+	}
+	express := frameworkValues[0]
+	if err := rdb.Set(ctx, express.key, `{"userId":"bob"}`, 0).Err(); err != nil {
+		t.Fatalf("SET overwrite: %v", err)
+	}
+	if got, err := rdb.Get(ctx, express.key).Result(); err != nil || got != `{"userId":"bob"}` {
+		t.Fatalf("GET after overwrite = %q, %v", got, err)
+	}
+	if ok, err := rdb.Expire(ctx, express.key, time.Hour).Result(); err != nil || !ok {
+		t.Fatalf("EXPIRE of a value = %v, %v", ok, err)
+	}
+	if typ, err := rdb.Type(ctx, express.key).Result(); err != nil || typ != "string" {
+		t.Fatalf("TYPE of a value = %q, %v", typ, err)
+	}
+	vals, err = rdb.MGet(ctx, express.key, "sess:missing").Result()
+	if err != nil || len(vals) != 2 || vals[0] != `{"userId":"bob"}` || vals[1] != nil {
+		t.Fatalf("MGET of values = %v, %v", vals, err)
+	}
+	keys, _, err = rdb.Scan(ctx, 0, "sess:*", 100).Result()
+	if err != nil || len(keys) != 2 || !contains(keys, express.key) || !contains(keys, "sess:large") {
+		t.Fatalf("SCAN sess:* = %v, %v", keys, err)
+	}
+	if n, err := rdb.DBSize(ctx).Result(); err != nil || n != base+5 {
+		t.Fatalf("DBSIZE after framework writes = %d, %v, want %d", n, err, base+5)
+	}
+	for _, v := range frameworkValues {
+		if n, err := rdb.Del(ctx, v.key).Result(); err != nil || n != 1 {
+			t.Fatalf("DEL of a %s session = %d, %v", v.name, n, err)
+		}
+	}
+	if _, err := rdb.Get(ctx, express.key).Result(); err != redis.Nil {
+		t.Fatalf("GET of a deleted value err = %v, want redis.Nil", err)
+	}
+	// Spring Session keeps sessions in hashes, which are not supported.
+	if err := rdb.HSet(ctx, "spring:session:sessions:2f1c5a0e", "creationTime", "1760788800000").Err(); err == nil {
+		t.Fatal("HSET of a Spring Session succeeded")
+	}
+
+	// Deletion.
+	if n, err := rdb.Unlink(ctx, id2).Result(); err != nil || n != 1 {
+		t.Fatalf("UNLINK = %d, %v", n, err)
+	}
+	if err := rdb.Del(ctx, id).Err(); err != nil {
+		t.Fatalf("DEL: %v", err)
+	}
+	if n, err := rdb.Exists(ctx, id, id2).Result(); err != nil || n != 0 {
+		t.Fatalf("EXISTS after delete = %d, %v", n, err)
+	}
+	if n, err := rdb.DBSize(ctx).Result(); err != nil || n != base {
+		t.Fatalf("DBSIZE after delete = %d, %v, want %d", n, err, base)
+	}
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
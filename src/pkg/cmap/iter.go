@@ -198,6 +198,26 @@ func (m *Map[K, V]) ShardCount() int {
 	return len(m.shards)
 }
 
+// ShardOf returns the index of the shard holding key, in [0, ShardCount()).
+func (m *Map[K, V]) ShardOf(key K) int {
+	return m.shardIndex(key)
+}
+
+// RangeShard iterates over the key-value pairs of shard i while holding
+// its read lock, so it sees the shard at a single point in time.
+//
+// The callback returns false to stop iteration.
+func (m *Map[K, V]) RangeShard(i int, fn func(key K, value V) bool) {
+	shard := m.shards[i]
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	for k, v := range shard.items {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
 // ShardStats returns statistics about each shard.
 type ShardStats struct {
 	Index int
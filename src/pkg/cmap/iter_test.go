@@ -1,6 +1,7 @@
 package cmap
 
 import (
+	"fmt"
 	"sort"
 	"sync"
 	"testing"
@@ -276,6 +277,27 @@ func TestRangeWithLimitEarlyStop(t *testing.T) {
 	}
 }
 
+func TestRangeShard(t *testing.T) {
+	m := New[string, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(fmt.Sprintf("key-%d", i), i)
+	}
+
+	total := 0
+	for i := 0; i < m.ShardCount(); i++ {
+		m.RangeShard(i, func(key string, _ int) bool {
+			if got := m.ShardOf(key); got != i {
+				t.Errorf("ShardOf(%q) = %d, found in shard %d", key, got, i)
+			}
+			total++
+			return true
+		})
+	}
+	if total != 100 {
+		t.Errorf("RangeShard visited %d keys, want 100", total)
+	}
+}
+
 // Versioned test type
 type versionedItem struct {
 	ID      string
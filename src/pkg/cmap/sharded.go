@@ -62,12 +62,16 @@ func NewWithShards[K comparable, V any](shardCount int) *Map[K, V] {
 // Note: This is the slow path for non-string keys (uses fmt.Sprintf + reflection).
 // For string keys, use getShardByString() for better performance.
 func (m *Map[K, V]) getShard(key K) *shard[K, V] {
+	return m.shards[m.shardIndex(key)]
+}
+
+// shardIndex returns the index of the shard for a key.
+func (m *Map[K, V]) shardIndex(key K) int {
 	var h maphash.Hash
 	h.SetSeed(m.seed)
 	// Convert key to bytes for hashing
 	h.WriteString(fmt.Sprintf("%v", key))
-	idx := h.Sum64() & m.shardMask
-	return m.shards[idx]
+	return int(h.Sum64() & m.shardMask)
 }
 
 // getShardByString returns the shard for a string key (optimized path).